@@ -1,18 +1,28 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/google/renameio/v2"
 	"github.com/spf13/cobra"
+
+	"github.com/deevus/pixels/internal/config"
+	"github.com/deevus/pixels/internal/retention"
+	"github.com/deevus/pixels/sandbox"
 )
 
 func init() {
 	cpCmd := &cobra.Command{
-		Use:     "checkpoint",
-		Aliases: []string{"cp"},
-		Short:   "Manage pixel checkpoints (ZFS snapshots)",
+		Use:   "checkpoint",
+		Short: "Manage pixel checkpoints (ZFS snapshots)",
 	}
 
 	createCmd := &cobra.Command{
@@ -43,9 +53,297 @@ func init() {
 		RunE:  runCheckpointDelete,
 	})
 
+	exportCmd := &cobra.Command{
+		Use:   "export <name> <label>",
+		Short: "Write a checkpoint to a portable archive",
+		Long: `Write a checkpoint to a zstd-compressed archive that "checkpoint import"
+can turn into a new pixel on another host running the same backend.`,
+		Example: `  pixels checkpoint export mybox ready -o mybox-ready.tar.zst
+  pixels checkpoint export mybox ready -o - | ssh otherhost pixels checkpoint import - --as mybox`,
+		Args: cobra.ExactArgs(2),
+		RunE: runCheckpointExport,
+	}
+	exportCmd.Flags().StringP("output", "o", "", `archive path, or "-" for stdout (default <name>-<label>.tar.zst)`)
+	cpCmd.AddCommand(exportCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Create a pixel from a checkpoint archive",
+		Long: `Create a pixel from an archive written by "checkpoint export". The new
+pixel starts from the checkpoint and keeps it under its original label.`,
+		Example: `  pixels checkpoint import mybox-ready.tar.zst --as mybox`,
+		Args:    cobra.ExactArgs(1),
+		RunE:    runCheckpointImport,
+	}
+	importCmd.Flags().String("as", "", "name of the new pixel")
+	_ = importCmd.MarkFlagRequired("as")
+	cpCmd.AddCommand(importCmd)
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune <name>",
+		Short: "Delete checkpoints a retention policy doesn't keep",
+		Long: `Delete the checkpoints of a pixel that no retention rule keeps. A
+checkpoint survives if any rule keeps it: it is one of the newest
+--keep-last, the newest on one of the last --keep-daily days, or younger
+than --older-than.`,
+		Example: `  pixels checkpoint prune mybox --keep-last 10 --keep-daily 7
+  pixels checkpoint prune mybox --older-than 7d --dry-run`,
+		Args: cobra.ExactArgs(1),
+		RunE: runCheckpointPrune,
+	}
+	addRetentionFlags(pruneCmd)
+	pruneCmd.Flags().Bool("dry-run", false, "list what would be deleted without deleting it")
+	cpCmd.AddCommand(pruneCmd)
+
+	autoCmd := &cobra.Command{
+		Use:   "auto [name...]",
+		Short: "Checkpoint running pixels on a schedule",
+		Long: `Checkpoint running pixels on the schedule in [checkpoint.auto], then prune
+their automatic checkpoints by its retention rules. Runs until interrupted;
+use --once to make a single pass from cron or a systemd timer.
+
+Automatic checkpoints are labelled "auto-<timestamp>" and are the only ones
+pruned. Without names, every running pixel except MCP bases is considered.
+Flags override the configured schedule for this run.`,
+		Example: `  pixels checkpoint auto
+  pixels checkpoint auto mybox --every 30m --keep-last 10 --keep-daily 7`,
+		RunE: runCheckpointAuto,
+	}
+	autoCmd.Flags().String("every", "", "checkpoint interval, e.g. 30m")
+	addRetentionFlags(autoCmd)
+	autoCmd.Flags().Duration("interval", time.Minute, "how often to check schedules")
+	autoCmd.Flags().Bool("once", false, "make a single pass and exit")
+	cpCmd.AddCommand(autoCmd)
+
 	rootCmd.AddCommand(cpCmd)
 }
 
+// autoLabelPrefix marks checkpoints made by "checkpoint auto", followed by
+// the local time in autoLabelTime format.
+const (
+	autoLabelPrefix = "auto-"
+	autoLabelTime   = "20060102-150405"
+)
+
+func addRetentionFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("keep-last", 0, "keep the newest N checkpoints")
+	cmd.Flags().Int("keep-daily", 0, "keep the newest checkpoint on each of the last N days")
+	cmd.Flags().String("older-than", "", "keep checkpoints younger than this, e.g. 7d or 12h")
+}
+
+// applyRetentionFlags overrides s with the retention flags the user set.
+func applyRetentionFlags(cmd *cobra.Command, s *config.AutoSchedule) {
+	if cmd.Flags().Changed("keep-last") {
+		s.KeepLast, _ = cmd.Flags().GetInt("keep-last")
+	}
+	if cmd.Flags().Changed("keep-daily") {
+		s.KeepDaily, _ = cmd.Flags().GetInt("keep-daily")
+	}
+	if cmd.Flags().Changed("older-than") {
+		s.OlderThan, _ = cmd.Flags().GetString("older-than")
+	}
+}
+
+func retentionPolicy(s config.AutoSchedule) (retention.Policy, error) {
+	if s.KeepLast < 0 || s.KeepDaily < 0 {
+		return retention.Policy{}, fmt.Errorf("--keep-last and --keep-daily must not be negative")
+	}
+	p := retention.Policy{KeepLast: s.KeepLast, KeepDaily: s.KeepDaily}
+	if s.OlderThan != "" {
+		age, err := retention.ParseAge(s.OlderThan)
+		if err != nil {
+			return p, err
+		}
+		p.OlderThan = age
+	}
+	return p, nil
+}
+
+func runCheckpointPrune(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	var s config.AutoSchedule
+	applyRetentionFlags(cmd, &s)
+	policy, err := retentionPolicy(s)
+	if err != nil {
+		return err
+	}
+	if policy.IsZero() {
+		return fmt.Errorf("nothing to keep by: set --keep-last, --keep-daily or --older-than")
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	snapshots, err := sb.ListSnapshots(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+	prune := retention.Prune(snapshots, policy, time.Now())
+	if len(prune) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "Nothing to prune for %s.\n", name)
+		return nil
+	}
+	for _, snap := range prune {
+		if dryRun {
+			fmt.Fprintf(cmd.OutOrStdout(), "Would delete checkpoint %q from %s\n", snap.Label, name)
+			continue
+		}
+		if err := sb.DeleteSnapshot(cmd.Context(), name, snap.Label); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Deleted checkpoint %q from %s\n", snap.Label, name)
+	}
+	return nil
+}
+
+func runCheckpointAuto(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("invalid --interval %s: must be positive", interval)
+	}
+	once, _ := cmd.Flags().GetBool("once")
+
+	schedule := func(name string) config.AutoSchedule {
+		s := cfg.Checkpoint.Auto.For(name)
+		if cmd.Flags().Changed("every") {
+			s.Every, _ = cmd.Flags().GetString("every")
+		}
+		applyRetentionFlags(cmd, &s)
+		return s
+	}
+	// Check flag values up front rather than once per pixel per pass.
+	plan, err := parseSchedule(schedule(""))
+	if err != nil {
+		return err
+	}
+	if plan.every == 0 && len(cfg.Checkpoint.Auto.Pixels) == 0 {
+		return fmt.Errorf("no checkpoint schedule: set every in [checkpoint.auto] or pass --every")
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := autoCheckpointPass(ctx, cmd, sb, args, schedule)
+		if once {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// autoPlan is a schedule in parsed form; every is zero when it is off.
+type autoPlan struct {
+	every  time.Duration
+	policy retention.Policy
+}
+
+func parseSchedule(s config.AutoSchedule) (autoPlan, error) {
+	var p autoPlan
+	if s.Enabled() {
+		every, err := time.ParseDuration(s.Every)
+		if err != nil || every <= 0 {
+			return p, fmt.Errorf("invalid checkpoint interval %q", s.Every)
+		}
+		p.every = every
+	}
+	policy, err := retentionPolicy(s)
+	p.policy = policy
+	return p, err
+}
+
+// autoCheckpointPass checkpoints each running pixel (or each of names) whose
+// newest automatic checkpoint is older than its interval, then prunes its
+// automatic checkpoints. A failing pixel doesn't stop the others.
+func autoCheckpointPass(ctx context.Context, cmd *cobra.Command, sb sandbox.Sandbox, names []string, schedule func(string) config.AutoSchedule) error {
+	instances, err := sb.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, inst := range instances {
+		if len(names) > 0 {
+			if !slices.Contains(names, inst.Name) {
+				continue
+			}
+		} else if strings.HasPrefix(inst.Name, cfg.MCP.BasePrefix) {
+			continue // new sandboxes clone a base's newest checkpoint
+		}
+		if !inst.Status.IsRunning() {
+			continue
+		}
+		plan, err := parseSchedule(schedule(inst.Name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", inst.Name, err))
+			continue
+		}
+		if plan.every == 0 {
+			continue
+		}
+		if err := autoCheckpoint(ctx, cmd, sb, inst.Name, plan); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", inst.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func autoCheckpoint(ctx context.Context, cmd *cobra.Command, sb sandbox.Sandbox, name string, plan autoPlan) error {
+	snapshots, err := sb.ListSnapshots(ctx, name)
+	if err != nil {
+		return err
+	}
+	var auto []sandbox.Snapshot
+	for _, s := range snapshots {
+		stamp, ok := strings.CutPrefix(s.Label, autoLabelPrefix)
+		if !ok {
+			continue
+		}
+		// Fall back to the time in the label when the backend can't say
+		// when the checkpoint was taken.
+		if t, err := time.ParseInLocation(autoLabelTime, stamp, time.Local); err == nil && s.CreatedAt.IsZero() {
+			s.CreatedAt = t
+		}
+		auto = append(auto, s)
+	}
+
+	now := time.Now()
+	if len(auto) == 0 || now.Sub(auto[len(auto)-1].CreatedAt) >= plan.every {
+		label := autoLabelPrefix + now.Format(autoLabelTime)
+		if err := sb.CreateSnapshot(ctx, name, label); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Checkpoint %q created for %s\n", label, name)
+		auto = append(auto, sandbox.Snapshot{Label: label, CreatedAt: now})
+	}
+
+	for _, snap := range retention.Prune(auto, plan.policy, now) {
+		if err := sb.DeleteSnapshot(ctx, name, snap.Label); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Deleted checkpoint %q from %s\n", snap.Label, name)
+	}
+	return nil
+}
+
 func runCheckpointCreate(cmd *cobra.Command, args []string) error {
 	name := args[0]
 	label, _ := cmd.Flags().GetString("label")
@@ -138,3 +436,75 @@ func runCheckpointDelete(cmd *cobra.Command, args []string) error {
 	fmt.Fprintf(cmd.OutOrStdout(), "Deleted checkpoint %q from %s\n", label, name)
 	return nil
 }
+
+func runCheckpointExport(cmd *cobra.Command, args []string) error {
+	name, label := args[0], args[1]
+	out, _ := cmd.Flags().GetString("output")
+	if out == "" {
+		out = name + "-" + label + ".tar.zst"
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	if out == "-" {
+		return sb.ExportSnapshot(cmd.Context(), name, label, cmd.OutOrStdout())
+	}
+
+	// Write through a pending file so a failed export leaves nothing behind.
+	f, err := renameio.NewPendingFile(out)
+	if err != nil {
+		return err
+	}
+	defer f.Cleanup()
+	if err := sb.ExportSnapshot(cmd.Context(), name, label, f); err != nil {
+		return err
+	}
+	size, _ := f.Seek(0, io.SeekCurrent)
+	if err := f.CloseAtomicallyReplace(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Exported %s checkpoint %q to %s (%s)\n", name, label, out, humanize.IBytes(uint64(size)))
+	return nil
+}
+
+func runCheckpointImport(cmd *cobra.Command, args []string) error {
+	path := args[0]
+	name, _ := cmd.Flags().GetString("as")
+
+	var r io.Reader = cmd.InOrStdin()
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	start := time.Now()
+	if err := sb.ImportSnapshot(cmd.Context(), name, r); err != nil {
+		return fmt.Errorf("importing %s: %w", path, err)
+	}
+	elapsed := time.Since(start).Truncate(100 * time.Millisecond)
+
+	inst, err := sb.Get(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Imported %s from %s in %s\n", name, inst.Origin, elapsed)
+	if len(inst.Addresses) > 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "  SSH: ssh %s@%s\n", cfg.SSH.User, inst.Addresses[0])
+	}
+	return nil
+}
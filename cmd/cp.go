@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/deevus/pixels/internal/archive"
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/user"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "cp <src> <dst>",
+		Short: "Copy files and directories to or from a pixel",
+		Long: `Copy files and directories to or from a pixel.
+
+Exactly one of src and dst names a path inside a pixel as name:path; a
+relative path is taken from the sandbox user's home directory. Directories
+are copied recursively and modes are preserved. Copying into an existing
+directory (or a path ending in /) places src inside it, as cp does.
+
+Files pushed into a pixel are owned by the sandbox user unless --archive is
+given, which keeps their local ownership. Files pulled out keep the pixel's
+ownership only when pixels runs as root.`,
+		Example: `  pixels cp ./src mybox:/home/pixel/src
+  pixels cp mybox:/tmp/out.tar .`,
+		Args: cobra.ExactArgs(2),
+		RunE: runCp,
+	}
+	cmd.Flags().BoolP("archive", "a", false, "keep local ownership when copying into a pixel")
+	rootCmd.AddCommand(cmd)
+}
+
+func runCp(cmd *cobra.Command, args []string) error {
+	srcName, srcPath, srcRemote := splitRemote(args[0])
+	dstName, dstPath, dstRemote := splitRemote(args[1])
+	if srcRemote == dstRemote {
+		return fmt.Errorf("exactly one of src and dst must be a pixel path (name:path)")
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	var n int64
+	if dstRemote {
+		keep, _ := cmd.Flags().GetBool("archive")
+		n, err = pushTree(cmd.Context(), sb, srcPath, dstName, remotePath(dstPath), keep)
+	} else {
+		n, err = pullTree(cmd.Context(), sb, srcName, remotePath(srcPath), dstPath)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Copied %s to %s\n", humanize.Bytes(uint64(n)), args[1])
+	return nil
+}
+
+// splitRemote splits a name:path argument. Anything with a path separator
+// before the first colon, or a single letter (a Windows drive), is local.
+func splitRemote(arg string) (name, p string, remote bool) {
+	i := strings.IndexByte(arg, ':')
+	if i <= 1 || strings.ContainsAny(arg[:i], `/\`) {
+		return "", arg, false
+	}
+	return arg[:i], arg[i+1:], true
+}
+
+// remotePath resolves p against the sandbox user's home directory.
+func remotePath(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	home := path.Join("/home", cfg.SSH.User)
+	if cfg.SSH.User == "" {
+		home = "/home/pixel"
+	}
+	if p == "" || p == "~" {
+		return home
+	}
+	return path.Join(home, strings.TrimPrefix(p, "~/"))
+}
+
+// pushTree copies the local src into dst inside name, returning the size of
+// the tar stream sent.
+func pushTree(ctx context.Context, sb sandbox.Sandbox, src, name, dst string, keepOwner bool) (int64, error) {
+	if _, err := os.Stat(src); err != nil {
+		return 0, err
+	}
+	dir, base := path.Dir(dst), path.Base(dst)
+	if strings.HasSuffix(dst, "/") || remoteIsDir(ctx, sb, name, dst) {
+		dir, base = path.Clean(dst), filepath.Base(src)
+	}
+	var owner *archive.Owner
+	if !keepOwner {
+		owner = &archive.Owner{UID: user.UID, GID: user.GID}
+	}
+
+	pr, pw := io.Pipe()
+	packed := make(chan error, 1)
+	go func() {
+		err := archive.Pack(pw, src, base, owner)
+		pw.CloseWithError(err)
+		packed <- err
+	}()
+	cr := &countingReader{r: pr}
+	err := sb.WriteArchive(ctx, name, dir, cr)
+	pr.CloseWithError(io.ErrClosedPipe)
+	if perr := <-packed; perr != nil && err == nil {
+		err = perr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("copying %s to %s:%s: %w", src, name, dst, err)
+	}
+	return cr.n, nil
+}
+
+// pullTree copies src inside name to the local dst, returning the size of
+// the tar stream received.
+func pullTree(ctx context.Context, sb sandbox.Sandbox, name, src, dst string) (int64, error) {
+	dir, rename := filepath.Dir(dst), filepath.Base(dst)
+	if fi, err := os.Stat(dst); (err == nil && fi.IsDir()) || strings.HasSuffix(dst, string(filepath.Separator)) {
+		dir, rename = dst, ""
+	}
+
+	pr, pw := io.Pipe()
+	read := make(chan error, 1)
+	go func() {
+		err := sb.ReadArchive(ctx, name, src, pw)
+		pw.CloseWithError(err)
+		read <- err
+	}()
+	cr := &countingReader{r: pr}
+	err := archive.Unpack(cr, dir, rename)
+	if err == nil {
+		// Drain the tar padding so the sender isn't left blocked.
+		_, err = io.Copy(io.Discard, cr)
+	}
+	pr.CloseWithError(io.ErrClosedPipe)
+	// A failed read reaches Unpack through the pipe, so rerr only matters
+	// when the stream itself looked fine.
+	if rerr := <-read; rerr != nil && err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("copying %s:%s to %s: %w", name, src, dst, err)
+	}
+	return cr.n, nil
+}
+
+// remoteIsDir reports whether p is a directory inside name.
+func remoteIsDir(ctx context.Context, sb sandbox.Sandbox, name, p string) bool {
+	rc, err := sb.Run(ctx, name, sandbox.ExecOpts{Cmd: []string{"test", "-d", p}, Root: true})
+	return err == nil && rc == 0
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
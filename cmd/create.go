@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/spf13/cobra"
 
+	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/provision"
 	"github.com/deevus/pixels/sandbox"
 )
@@ -25,7 +28,9 @@ func init() {
 	cmd.Flags().Bool("no-provision", false, "skip all provisioning")
 	cmd.Flags().Bool("console", false, "wait for provisioning and open console")
 	cmd.Flags().String("from", "", "create from checkpoint (container:label)")
-	cmd.Flags().String("egress", "", "egress policy: unrestricted, agent, allowlist (default from config)")
+	cmd.Flags().String("egress", "", "egress policy: unrestricted, allowlist, or presets such as agent or agent,rust (default from config)")
+	cmd.Flags().StringArray("mount", nil, "attach a host directory as source:target[:ro] (repeatable; adds to [[mounts]] in config)")
+	cmd.Flags().StringArray("label", nil, "attach a key=value label (repeatable)")
 	rootCmd.AddCommand(cmd)
 }
 
@@ -38,15 +43,29 @@ func runCreate(cmd *cobra.Command, args []string) error {
 	memory, _ := cmd.Flags().GetInt64("memory")
 	from, _ := cmd.Flags().GetString("from")
 
+	mounts, err := createMounts(cmd)
+	if err != nil {
+		return err
+	}
+	if from != "" && cmd.Flags().Changed("mount") {
+		return fmt.Errorf("--mount cannot be used with --from: clones keep their source's mounts")
+	}
+	labels, err := createLabels(cmd)
+	if err != nil {
+		return err
+	}
+	if from != "" && len(labels) > 0 {
+		return fmt.Errorf("--label cannot be used with --from: clones keep their source's labels")
+	}
+
 	egressMode, _ := cmd.Flags().GetString("egress")
 	if egressMode == "" {
 		egressMode = cfg.Network.Egress
 	}
-	switch egressMode {
-	case "unrestricted", "agent", "allowlist", "":
-		// valid
-	default:
-		return fmt.Errorf("invalid --egress %q: must be unrestricted, agent, or allowlist", egressMode)
+	if egressMode != "" {
+		if err := egress.ValidateEgress(egressMode); err != nil {
+			return fmt.Errorf("invalid --egress %q: %w", egressMode, err)
+		}
 	}
 
 	logv(cmd, "Config: image=%s cpu=%s memory=%dMiB egress=%s", image, cpu, memory, egressMode)
@@ -140,6 +159,8 @@ func runCreate(cmd *cobra.Command, args []string) error {
 			Image:  image,
 			CPU:    cpu,
 			Memory: memory * 1024 * 1024,
+			Mounts: mounts,
+			Labels: labels,
 		})
 		if err != nil {
 			return fmt.Errorf("creating instance: %w", err)
@@ -196,3 +217,48 @@ func runCreate(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// createMounts returns the [[mounts]] from config followed by any --mount
+// flags. Flag sources may use ~ or be relative to the working directory.
+func createMounts(cmd *cobra.Command) ([]sandbox.Mount, error) {
+	var mounts []sandbox.Mount
+	for _, m := range cfg.Mounts {
+		mounts = append(mounts, sandbox.Mount{Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	specs, _ := cmd.Flags().GetStringArray("mount")
+	for _, spec := range specs {
+		m, err := sandbox.ParseMount(spec)
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(m.Source, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("expanding %s: %w", m.Source, err)
+			}
+			m.Source = filepath.Join(home, rest)
+		}
+		if m.Source, err = filepath.Abs(m.Source); err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// createLabels parses the --label flags. A repeated key keeps its last value.
+func createLabels(cmd *cobra.Command) (map[string]string, error) {
+	specs, _ := cmd.Flags().GetStringArray("label")
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		k, v, err := sandbox.ParseLabel(spec)
+		if err != nil {
+			return nil, err
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deevus/pixels/internal/egress"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "egress-dns",
+		Short: "Run the egress DNS filter inside a container",
+		Long: `Run the DNS forwarder that restricted containers resolve through when
+network.dns_filter is set. It answers only for names in the domains file,
+returning NXDOMAIN for everything else, and adds each answered address to the
+egress ruleset for the record's TTL. With --learn, it answers every name and
+only logs what each address was resolved from. pixels installs and starts it;
+it is not meant to be run by hand.`,
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		// Runs inside the container, where there is no pixels config.
+		PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+		RunE:              runEgressDNS,
+	}
+	cmd.Flags().String("listen", "127.0.0.1:53", "address to serve DNS on")
+	cmd.Flags().String("upstream", "", "nameserver to forward allowed queries to")
+	cmd.Flags().String("domains", "/etc/pixels-egress-domains", "allowlist of names to answer for")
+	cmd.Flags().Bool("learn", false, "answer every name without touching the ruleset")
+	_ = cmd.MarkFlagRequired("upstream")
+	rootCmd.AddCommand(cmd)
+}
+
+func runEgressDNS(cmd *cobra.Command, _ []string) error {
+	listen, _ := cmd.Flags().GetString("listen")
+	upstream, _ := cmd.Flags().GetString("upstream")
+	domains, _ := cmd.Flags().GetString("domains")
+	learn, _ := cmd.Flags().GetBool("learn")
+	if _, _, err := net.SplitHostPort(upstream); err != nil {
+		upstream = net.JoinHostPort(upstream, "53")
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	list := egress.NewDomainFile(domains)
+	f := &egress.DNSFilter{
+		Upstream: upstream,
+		Allowed:  list.Contains,
+		Allow: func(ctx context.Context, name string, addr netip.Addr, ttl time.Duration) error {
+			return egress.NftAllow(ctx, addr, list.Rules(name), ttl)
+		},
+		Log: slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	}
+	if learn {
+		f.Allowed = func(string) bool { return true }
+		f.Allow = func(context.Context, string, netip.Addr, time.Duration) error { return nil }
+	}
+	return f.ListenAndServe(ctx, listen)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "events [name...]",
+		Short: "Stream lifecycle events for pixels",
+		Long: `Stream lifecycle events for pixels as they happen: created, started,
+stopped, deleted, snapshot-created and exec-started. Only events after the
+command starts are shown. Give names to follow just those pixels.
+
+With --json, each event is printed as one JSON object per line.`,
+		RunE: runEvents,
+	}
+	cmd.Flags().Bool("json", false, "print events as JSON lines")
+	cmd.Flags().Int("count", 0, "exit after this many events (0 streams until interrupted)")
+	rootCmd.AddCommand(cmd)
+}
+
+func runEvents(cmd *cobra.Command, names []string) error {
+	asJSON, _ := cmd.Flags().GetBool("json")
+	count, _ := cmd.Flags().GetInt("count")
+	if count < 0 {
+		return fmt.Errorf("invalid --count %d: must not be negative", count)
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	out := cmd.OutOrStdout()
+	enc := json.NewEncoder(out)
+	seen := 0
+	var writeErr error
+	err = sb.Watch(ctx, func(e sandbox.Event) {
+		if ctx.Err() != nil || (len(names) > 0 && !slices.Contains(names, e.Name)) {
+			return
+		}
+		if asJSON {
+			writeErr = enc.Encode(e)
+		} else {
+			_, writeErr = fmt.Fprintln(out, formatEvent(e))
+		}
+		if seen++; writeErr != nil || seen == count {
+			cancel()
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("watching events: %w", err)
+	}
+	return writeErr
+}
+
+// formatEvent renders an event as a line of text in local time.
+func formatEvent(e sandbox.Event) string {
+	line := fmt.Sprintf("%s  %-16s  %s", e.Time.Local().Format(time.DateTime), e.Type, e.Name)
+	if e.Snapshot != "" {
+		line += "  " + e.Snapshot
+	}
+	return line
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "forward <name> [[addr:]local:remote]",
+		Short: "Forward a host port to a port inside a pixel",
+		Long: `Forward a host port to a port inside a pixel.
+
+With a spec, starts forwarding local (on 127.0.0.1 unless addr is given) to
+remote inside the pixel. Without one, lists the pixel's forwards. Forwards
+are named after their local port; pass --rm with that name to remove one.
+
+On Incus the forward is a proxy device on the Incus host; on TrueNAS it is
+an SSH tunnel running on this machine.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: runForward,
+	}
+	cmd.Flags().String("name", "", "name for the new forward (default: its local port)")
+	cmd.Flags().String("rm", "", "remove the named forward")
+	rootCmd.AddCommand(cmd)
+}
+
+func runForward(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	remove, _ := cmd.Flags().GetString("rm")
+	if remove != "" && len(args) > 1 {
+		return fmt.Errorf("--rm takes no forward spec")
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	switch {
+	case remove != "":
+		if err := sb.RemoveForward(cmd.Context(), name, remove); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed forward %s from %s\n", remove, name)
+		return nil
+
+	case len(args) == 2:
+		f, err := sandbox.ParseForward(args[1])
+		if err != nil {
+			return err
+		}
+		if n, _ := cmd.Flags().GetString("name"); n != "" {
+			f.Name = n
+		}
+		if err := sb.AddForward(cmd.Context(), name, f); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Forwarding %s to %s:%d (forward %s)\n", f.Listen, name, f.Port, f.Name)
+		return nil
+	}
+
+	forwards, err := sb.ListForwards(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+	if len(forwards) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "No forwards for %s.\n", name)
+		return nil
+	}
+	w := newTabWriter(cmd)
+	fmt.Fprintln(w, "NAME\tLISTEN\tPORT")
+	for _, f := range forwards {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", f.Name, f.Listen, f.Port)
+	}
+	return w.Flush()
+}
@@ -2,20 +2,41 @@ package cmd
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
+
+	"github.com/deevus/pixels/sandbox"
 )
 
 func init() {
-	rootCmd.AddCommand(&cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all pixels",
-		Args:  cobra.NoArgs,
-		RunE:  runList,
-	})
+		Example: `  pixels list
+  pixels list -l team=infra -l task
+  pixels list --wide`,
+		Args: cobra.NoArgs,
+		RunE: runList,
+	}
+	cmd.Flags().StringArrayP("label", "l", nil, "only show pixels with this label, as key=value or key (repeatable)")
+	cmd.Flags().BoolP("wide", "w", false, "also show IPv6 addresses, clone origin and labels")
+	rootCmd.AddCommand(cmd)
 }
 
 func runList(cmd *cobra.Command, _ []string) error {
+	selectors, _ := cmd.Flags().GetStringArray("label")
+	for _, sel := range selectors {
+		key, _, _ := strings.Cut(sel, "=")
+		if err := sandbox.ValidateLabelKey(key); err != nil {
+			return err
+		}
+	}
+	wide, _ := cmd.Flags().GetBool("wide")
+
 	sb, err := openSandbox()
 	if err != nil {
 		return err
@@ -26,6 +47,9 @@ func runList(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	instances = slices.DeleteFunc(instances, func(inst sandbox.Instance) bool {
+		return !matchLabels(inst.Labels, selectors)
+	})
 
 	if len(instances) == 0 {
 		fmt.Fprintln(cmd.OutOrStdout(), "No pixels found.")
@@ -33,13 +57,59 @@ func runList(cmd *cobra.Command, _ []string) error {
 	}
 
 	w := newTabWriter(cmd)
-	fmt.Fprintln(w, "NAME\tSTATUS\tIP")
+	header := "NAME\tSTATUS\tIP\tIMAGE\tCPU\tMEMORY\tEGRESS\tCREATED"
+	if wide {
+		header += "\tIPV6\tORIGIN\tLABELS"
+	}
+	fmt.Fprintln(w, header)
 	for _, inst := range instances {
 		ip := "—"
 		if len(inst.Addresses) > 0 {
 			ip = inst.Addresses[0]
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\n", inst.Name, inst.Status, ip)
+		memory, created := "—", "—"
+		if inst.Memory > 0 {
+			memory = humanize.IBytes(uint64(inst.Memory))
+		}
+		if !inst.CreatedAt.IsZero() {
+			created = humanize.Time(inst.CreatedAt)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s", inst.Name, inst.Status, ip,
+			orDash(inst.Image), orDash(inst.CPU), memory, orDash(string(inst.Egress)), created)
+		if wide {
+			fmt.Fprintf(w, "\t%s\t%s\t%s", orDash(strings.Join(inst.AddressesV6, ",")),
+				orDash(inst.Origin), orDash(formatLabels(inst.Labels)))
+		}
+		fmt.Fprintln(w)
 	}
 	return w.Flush()
 }
+
+// matchLabels reports whether labels satisfy every selector. A selector is
+// key=value for an exact match or a bare key for presence.
+func matchLabels(labels map[string]string, selectors []string) bool {
+	for _, sel := range selectors {
+		key, value, hasValue := strings.Cut(sel, "=")
+		got, ok := labels[key]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatLabels renders labels as sorted, comma-separated key=value pairs.
+func formatLabels(labels map[string]string) string {
+	var pairs []string
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
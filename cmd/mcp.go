@@ -11,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/deevus/pixels/internal/egress"
 	mcppkg "github.com/deevus/pixels/internal/mcp"
 	"github.com/spf13/cobra"
 )
@@ -128,9 +129,17 @@ func runMCP(cmd *cobra.Command, args []string) error {
 		IdleStopAfter:    idle,
 		HardDestroyAfter: hard,
 		Log:              log,
+		ReapplyEgress:    cfg.MCP.EgressDrift == "reapply",
+	}
+	if cfg.MCP.EgressDrift != "off" {
+		reaper.Egress = sb
+	}
+	if h, ok := sb.(egress.HostEnforcer); ok && cfg.Network.Enforce == "host" {
+		reaper.HostEgress = h
 	}
 	reaper.Tick(ctx) // immediate startup pass
 	go reaper.Run(ctx, reapInterval)
+	go tools.WatchBackend(ctx)
 
 	srv := &http.Server{Addr: listenAddr, Handler: mux}
 
@@ -0,0 +1,433 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/memory"
+)
+
+// runCLI executes the root command against the in-memory backend with an
+// isolated config and cache directory, returning stdout.
+func runCLI(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := runCLIErr(t, args...)
+	if err != nil {
+		t.Fatalf("pixels %s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+// runCLIErr is runCLI for commands expected to fail: it returns the error
+// along with stdout.
+func runCLIErr(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	resetFlags(rootCmd)
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&bytes.Buffer{})
+	rootCmd.SetArgs(append([]string{"--backend", "memory"}, args...))
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+	})
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+// resetFlags restores every flag a previous runCLI call set, since cobra
+// keeps flag values on the (package-level) command tree between Executes.
+func resetFlags(c *cobra.Command) {
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			sv.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	for _, sub := range c.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func TestCLIWithMemoryBackend(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	if out := runCLI(t, "create", "demo"); !strings.Contains(out, "Created px-demo") {
+		t.Errorf("create output = %q", out)
+	}
+	if out := runCLI(t, "list"); !strings.Contains(out, "demo") || !strings.Contains(out, "RUNNING") {
+		t.Errorf("list output = %q", out)
+	}
+
+	runCLI(t, "checkpoint", "create", "demo", "--label", "ready")
+	if out := runCLI(t, "checkpoint", "list", "demo"); !strings.Contains(out, "ready") {
+		t.Errorf("checkpoint list output = %q", out)
+	}
+
+	runCLI(t, "destroy", "demo", "--force")
+	if out := runCLI(t, "list"); !strings.Contains(out, "No pixels found.") {
+		t.Errorf("list after destroy = %q", out)
+	}
+}
+
+func TestCLIForward(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo")
+	if out := runCLI(t, "forward", "demo", "8080:3000"); !strings.Contains(out, "Forwarding 127.0.0.1:8080 to demo:3000") {
+		t.Errorf("forward output = %q", out)
+	}
+	if out := runCLI(t, "forward", "demo"); !strings.Contains(out, "127.0.0.1:8080") {
+		t.Errorf("forward list output = %q", out)
+	}
+	runCLI(t, "forward", "demo", "--rm", "8080")
+	if out := runCLI(t, "forward", "demo"); !strings.Contains(out, "No forwards for demo.") {
+		t.Errorf("forward list after rm = %q", out)
+	}
+}
+
+func TestCLIResize(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo")
+	if out := runCLI(t, "resize", "demo", "--cpu", "4", "--memory", "8192"); !strings.Contains(out, "Resized demo: cpu=4 memory=8192MiB") {
+		t.Errorf("resize output = %q", out)
+	}
+}
+
+func TestCLITop(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo")
+	if out := runCLI(t, "top", "--once", "--interval", "10ms"); !strings.Contains(out, "CPU%") || !strings.Contains(out, "demo") {
+		t.Errorf("top output = %q", out)
+	}
+}
+
+func TestCLILabels(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo", "--label", "team=infra")
+	if out := runCLI(t, "list", "--wide", "-l", "team=infra"); !strings.Contains(out, "demo") || !strings.Contains(out, "team=infra") {
+		t.Errorf("list -l team=infra output = %q", out)
+	}
+	if out := runCLI(t, "list", "-l", "team=web"); !strings.Contains(out, "No pixels found.") {
+		t.Errorf("list -l team=web output = %q", out)
+	}
+}
+
+func TestCLICheckpointExport(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo")
+	runCLI(t, "checkpoint", "create", "demo", "--label", "ready")
+	archive := filepath.Join(t.TempDir(), "demo.tar.zst")
+	if out := runCLI(t, "checkpoint", "export", "demo", "ready", "-o", archive); !strings.Contains(out, `Exported demo checkpoint "ready"`) {
+		t.Errorf("checkpoint export output = %q", out)
+	}
+	if out := runCLI(t, "checkpoint", "import", archive, "--as", "imported"); !strings.Contains(out, "Imported imported from demo:ready") {
+		t.Errorf("checkpoint import output = %q", out)
+	}
+	if out := runCLI(t, "checkpoint", "list", "imported"); !strings.Contains(out, "ready") {
+		t.Errorf("checkpoint list of the import = %q", out)
+	}
+}
+
+func TestCLICopy(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "pkg"), 0o755)
+	os.WriteFile(filepath.Join(src, "pkg", "main.go"), []byte("package main\n"), 0o644)
+	os.WriteFile(filepath.Join(src, "build.sh"), []byte("#!/bin/sh\n"), 0o755)
+
+	runCLI(t, "create", "demo")
+	if out := runCLI(t, "cp", src, "demo:src"); !strings.Contains(out, "Copied") {
+		t.Errorf("cp output = %q", out)
+	}
+	// An existing directory receives the source inside it.
+	runCLI(t, "cp", filepath.Join(src, "build.sh"), "demo:src/pkg")
+
+	dst := filepath.Join(t.TempDir(), "out")
+	runCLI(t, "cp", "demo:/home/pixel/src", dst)
+	if got, _ := os.ReadFile(filepath.Join(dst, "pkg", "main.go")); string(got) != "package main\n" {
+		t.Errorf("pulled main.go = %q", got)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "pkg", "build.sh"))
+	if err != nil {
+		t.Fatalf("pulled build.sh: %v", err)
+	}
+	if fi.Mode().Perm() != 0o755 {
+		t.Errorf("build.sh mode = %v, want 0755", fi.Mode().Perm())
+	}
+}
+
+func TestCLICheckpointRetention(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo")
+	for _, label := range []string{"a", "b", "c"} {
+		runCLI(t, "checkpoint", "create", "demo", "--label", label)
+	}
+
+	out := runCLI(t, "checkpoint", "prune", "demo", "--keep-last", "1", "--dry-run")
+	if !strings.Contains(out, `Would delete checkpoint "a"`) || !strings.Contains(out, `Would delete checkpoint "b"`) {
+		t.Errorf("prune --dry-run output = %q", out)
+	}
+	runCLI(t, "checkpoint", "prune", "demo", "--keep-last", "1")
+	if out := runCLI(t, "checkpoint", "list", "demo"); strings.Contains(out, "a ") || !strings.Contains(out, "c") {
+		t.Errorf("checkpoint list after prune = %q", out)
+	}
+
+	if out := runCLI(t, "checkpoint", "auto", "--once", "--every", "1h", "--keep-last", "1"); !strings.Contains(out, `Checkpoint "auto-`) {
+		t.Errorf("checkpoint auto output = %q", out)
+	}
+	// The next pass is inside the interval, so it neither checkpoints nor
+	// prunes the manual checkpoint.
+	if out := runCLI(t, "checkpoint", "auto", "--once", "--every", "1h", "--keep-last", "1"); out != "" {
+		t.Errorf("second checkpoint auto output = %q", out)
+	}
+	if out := runCLI(t, "checkpoint", "list", "demo"); !strings.Contains(out, "auto-") || !strings.Contains(out, "c") {
+		t.Errorf("checkpoint list after auto = %q", out)
+	}
+}
+
+func TestCLIEvents(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	t.Setenv("PIXELS_MEMORY_STATE_FILE", stateFile)
+
+	runCLI(t, "create", "demo")
+	runCLI(t, "create", "other")
+
+	// Another process sharing the state file keeps restarting the pixels
+	// until the command has seen its events. Watch doesn't replay events
+	// from before it subscribed, so one round could be missed.
+	sb, err := memory.New(map[string]string{"state_file": stateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx := context.Background()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+			sb.Stop(ctx, "other")
+			sb.Start(ctx, "other")
+			sb.Stop(ctx, "demo")
+			sb.Start(ctx, "demo")
+		}
+	}()
+
+	out := runCLI(t, "events", "demo", "--json", "--count", "2")
+	close(done)
+	wg.Wait()
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var e sandbox.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("event line %q: %v", line, err)
+		}
+		got = append(got, string(e.Type)+" "+e.Name)
+	}
+	// Subscribing mid-round may start the stream at either event.
+	want := []string{"stopped demo", "started demo"}
+	if !slices.Equal(got, want) && !slices.Equal(got, []string{want[1], want[0]}) {
+		t.Errorf("events = %v, want %v in either order", got, want)
+	}
+}
+
+func TestCLINetworkLogEmpty(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo")
+	if out := runCLI(t, "network", "log", "demo", "--since", "10m"); !strings.Contains(out, "No denials for demo in the last 10m0s.") {
+		t.Errorf("network log output = %q", out)
+	}
+	if out := runCLI(t, "network", "log", "demo", "--json"); strings.TrimSpace(out) != "[]" {
+		t.Errorf("network log --json output = %q, want []", out)
+	}
+}
+
+func TestCLINetworkLearn(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo")
+	runCLI(t, "network", "set", "demo", "learn")
+	if out := runCLI(t, "network", "show", "demo"); !strings.Contains(out, "Mode: learn") {
+		t.Errorf("network show output = %q", out)
+	}
+	if out := runCLI(t, "network", "suggest", "demo"); !strings.Contains(out, "Nothing learned for demo yet.") {
+		t.Errorf("network suggest output = %q", out)
+	}
+	runCLI(t, "network", "suggest", "demo", "--apply")
+	if out := runCLI(t, "network", "show", "demo"); !strings.Contains(out, "Mode: allowlist") || strings.Contains(out, "Domains:") {
+		t.Errorf("network show after --apply = %q, want an empty allowlist", out)
+	}
+}
+
+func TestCLINetworkPolicyRecord(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo", "--egress", "agent")
+	runCLI(t, "network", "allow", "demo", "db.internal:5432")
+	runCLI(t, "network", "deny", "demo", "api.anthropic.com")
+	out := runCLI(t, "network", "show", "demo")
+	for _, want := range []string{"Mode: agent\n", "Presets: agent\n", "Added: db.internal:5432\n", "Removed: api.anthropic.com\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("network show output = %q, want %q", out, want)
+		}
+	}
+
+	// The memory backend runs no rules, so nothing of the policy is in
+	// force.
+	out = runCLI(t, "network", "diff", "demo", "--json")
+	var diffs []egress.Difference
+	if err := json.Unmarshal([]byte(out), &diffs); err != nil {
+		t.Fatalf("network diff --json: %v: %q", err, out)
+	}
+	if len(diffs) == 0 || diffs[0].Kind != egress.DiffRuleset || diffs[0].Change != egress.DiffMissing {
+		t.Errorf("network diff = %+v, want the allowlist ruleset missing first", diffs)
+	}
+
+	runCLI(t, "network", "set", "demo", "unrestricted")
+	if out := runCLI(t, "network", "diff", "demo"); !strings.Contains(out, "match its unrestricted policy") {
+		t.Errorf("network diff output = %q", out)
+	}
+}
+
+func TestCLINetworkVerify(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "open")
+	runCLI(t, "create", "locked", "--egress", "agent")
+	if out := runCLI(t, "network", "verify", "open"); out != "open: ok (unrestricted)\n" {
+		t.Errorf("network verify output = %q", out)
+	}
+
+	// The memory backend runs no rules, so a restricted policy is never
+	// in force.
+	out, err := runCLIErr(t, "network", "verify", "--all", "--json")
+	if err == nil || !strings.Contains(err.Error(), "egress drift in 1 of 2") {
+		t.Errorf("network verify --all: err = %v", err)
+	}
+	var reports []egressReport
+	if err := json.Unmarshal([]byte(out), &reports); err != nil {
+		t.Fatalf("network verify --json: %v: %q", err, out)
+	}
+	for _, r := range reports {
+		if drifted := len(r.Drift) > 0; drifted != (r.Name == "locked") {
+			t.Errorf("report %+v", r)
+		}
+	}
+}
+
+func TestCLINetworkShowRefresh(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runCLI(t, "create", "demo", "--egress", "agent")
+	if out := runCLI(t, "network", "show", "demo"); strings.Contains(out, "Last refresh") {
+		t.Errorf("network show before any refresh = %q", out)
+	}
+
+	status := filepath.Join(t.TempDir(), "refresh")
+	data := "time=" + time.Now().Add(-time.Minute).Format(time.RFC3339) + "\nresult=ok\nelements=42\nadded=2\nremoved=3\nunresolved=pypi.org\nmessage=\n"
+	if err := os.WriteFile(status, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runCLI(t, "cp", status, "demo:"+egress.RefreshStatusFile)
+	out := runCLI(t, "network", "show", "demo")
+	for _, want := range []string{"Last refresh: 1 minute ago, ok: 42 addresses, 2 added, 3 removed\n", "Unresolved (kept at their last addresses): pypi.org\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("network show output = %q, want %q", out, want)
+		}
+	}
+}
+
+func TestCLINetworkPresets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	if err := os.MkdirAll(filepath.Join(dir, "pixels"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	config := "[network.presets.rust]\ndomains = [\"index.crates.io\"]\nextends = [\"agent\"]\n"
+	if err := os.WriteFile(filepath.Join(dir, "pixels", "config.toml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { egress.SetUserPresets(nil) })
+
+	out := runCLI(t, "network", "presets")
+	if !strings.Contains(out, "agent") || !strings.Contains(out, "rust") || !strings.Contains(out, "config") {
+		t.Errorf("network presets output = %q", out)
+	}
+	if out := runCLI(t, "network", "presets", "rust"); !strings.Contains(out, "index.crates.io\n") || !strings.Contains(out, "api.anthropic.com\n") {
+		t.Errorf("network presets rust output = %q", out)
+	}
+
+	runCLI(t, "create", "demo", "--egress", "agent,rust")
+	if out := runCLI(t, "network", "show", "demo"); !strings.Contains(out, "Mode: agent,rust") || !strings.Contains(out, "index.crates.io") {
+		t.Errorf("network show output = %q", out)
+	}
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	runCLI(t, "create", "demo")
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"start", "missing"}, 3},
+		{[]string{"create", "demo"}, 4},
+		{[]string{"checkpoint", "restore", "demo", "nope"}, 3},
+	}
+	for _, tt := range tests {
+		_, err := runCLIErr(t, tt.args...)
+		if got := exitCode(err); got != tt.want {
+			t.Errorf("pixels %s: exit %d (%v), want %d", strings.Join(tt.args, " "), got, err, tt.want)
+		}
+	}
+}
@@ -1,10 +1,20 @@
 package cmd
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 
+	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/sandbox"
 )
 
@@ -23,16 +33,28 @@ func init() {
 
 	networkCmd.AddCommand(&cobra.Command{
 		Use:   "set <name> <mode>",
-		Short: "Set egress mode (unrestricted, agent, allowlist)",
-		Args:  cobra.ExactArgs(2),
-		RunE:  runNetworkSet,
+		Short: "Set egress mode (unrestricted, allowlist, learn, or presets)",
+		Long: `Set the container's egress mode. In learn mode, all egress is allowed and
+recorded, for "pixels network suggest" to propose an allowlist from.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runNetworkSet,
 	})
 
 	networkCmd.AddCommand(&cobra.Command{
 		Use:   "allow <name> <domain>",
 		Short: "Add a domain to the container's egress allowlist",
-		Args:  cobra.ExactArgs(2),
-		RunE:  runNetworkAllow,
+		Long: `Add a domain to the container's egress allowlist. Besides host names,
+"*.example.com" allows any name below example.com, and ".example.com" allows
+example.com and any name below it. Patterns are only enforced in full with
+network.dns_filter. IP addresses and CIDRs are allowed as they are.
+
+An entry may be narrowed to one port, over TCP and UDP or over one protocol:
+"github.com:443/tcp", "10.0.0.5:5432", "[2001:db8::1]:443".`,
+		Example: `  pixels network allow mybox pypi.org
+  pixels network allow mybox '*.githubusercontent.com'
+  pixels network allow mybox db.internal:5432/tcp`,
+		Args: cobra.ExactArgs(2),
+		RunE: runNetworkAllow,
 	})
 
 	networkCmd.AddCommand(&cobra.Command{
@@ -42,6 +64,114 @@ func init() {
 		RunE:  runNetworkDeny,
 	})
 
+	logCmd := &cobra.Command{
+		Use:   "log <name>",
+		Short: "Show connections and lookups the egress policy denied",
+		Long: `Show the connections the container's egress policy dropped, and the names the
+DNS filter refused to resolve, grouped by destination with the most frequent
+first. Destination addresses are shown as the names the container resolved
+them from, where it still knows.
+
+Dropped packets are read from the kernel log, which containers may only see if
+the host logs packets from container network namespaces (on Linux, sysctl
+net.netfilter.nf_log_all_netns=1).
+
+With --follow, each denial is printed as it is logged; with --json, output is
+JSON: a list of destinations, or one denial per line when following.`,
+		Example: `  pixels network log mybox
+  pixels network log mybox --since 10m
+  pixels network log mybox --follow --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: runNetworkLog,
+	}
+	logCmd.Flags().BoolP("follow", "f", false, "print denials as they are logged")
+	logCmd.Flags().Bool("json", false, "print JSON")
+	logCmd.Flags().Duration("since", time.Hour, "how far back to look")
+	networkCmd.AddCommand(logCmd)
+
+	suggestCmd := &cobra.Command{
+		Use:   "suggest <name>",
+		Short: "Propose an allowlist from what a container in learn mode used",
+		Long: `Propose an allowlist from the connections a container made in learn mode,
+compared against the list it had before learning:
+
+  +  used, and not on the list
+     used, and already allowed
+  -  on the list, but not used
+  ?  used, but with no name to allow
+
+Destinations are named from the DNS filter's log, or from the resolver cache
+where the filter isn't installed. With --apply, the container switches to
+allowlist mode with the proposed list.`,
+		Example: `  pixels network set mybox learn
+  pixels network suggest mybox
+  pixels network suggest mybox --apply`,
+		Args: cobra.ExactArgs(1),
+		RunE: runNetworkSuggest,
+	}
+	suggestCmd.Flags().Bool("apply", false, "switch to allowlist mode with the proposed list")
+	suggestCmd.Flags().Bool("json", false, "print JSON")
+	networkCmd.AddCommand(suggestCmd)
+
+	diffCmd := &cobra.Command{
+		Use:   "diff <name>",
+		Short: "Compare the egress rules in force with the container's policy",
+		Long: `Compare the egress rules in force inside the container with its recorded
+policy: the nftables ruleset loaded, the domain and CIDR lists, the addresses
+in the allowed sets and, for restricted modes, the pixel user's sudo rules.
+
+  -  in the policy, but not in force
+  +  in force, but not in the policy
+
+Listed names are resolved again to check their addresses, so an address a name
+has since moved off shows as +. Names allowed through network.dns_filter are
+not in the allowed sets and are not checked. With network.enforce = "host",
+the container's network ACL is compared instead.`,
+		Example: `  pixels network diff mybox
+  pixels network diff mybox --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: runNetworkDiff,
+	}
+	diffCmd.Flags().Bool("json", false, "print JSON")
+	networkCmd.AddCommand(diffCmd)
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify [name...]",
+		Short: "Check that containers' egress rules still enforce their policies",
+		Long: `Check that the egress rules in force inside each container still enforce its
+recorded policy: that the nftables ruleset for its mode is loaded, its domain
+and CIDR lists and allowed addresses are as recorded, and, for restricted
+modes, that sudo is restricted. Unlike diff, addresses that change with what
+names resolve to are not reported.
+
+With --all, every running container is checked. With --reapply, a container
+whose rules have drifted has its policy applied again. Exits non-zero if any
+container is left drifted. With network.enforce = "host", the container's
+network ACL is checked instead.`,
+		Example: `  pixels network verify mybox
+  pixels network verify --all --reapply`,
+		RunE: runNetworkVerify,
+	}
+	verifyCmd.Flags().Bool("all", false, "check every running container")
+	verifyCmd.Flags().Bool("reapply", false, "apply drifted policies again")
+	verifyCmd.Flags().Bool("json", false, "print JSON")
+	networkCmd.AddCommand(verifyCmd)
+
+	networkCmd.AddCommand(&cobra.Command{
+		Use:   "presets [name]",
+		Short: "List egress presets, or show the entries of one",
+		Long: `List the egress presets: those built into pixels, and those defined under
+[network.presets] in config. Any preset, or several separated by commas, can be
+used as an egress mode, as in "pixels create --egress agent,rust".
+
+Domain and CIDR counts include the presets each one extends. Given a name,
+print the preset's entries with its extends expanded.`,
+		Example: `  pixels network presets
+  pixels network presets rust`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runNetworkPresets,
+	})
+
 	rootCmd.AddCommand(networkCmd)
 }
 
@@ -59,26 +189,245 @@ func runNetworkShow(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Mode: %s\n", policy.Mode)
 	if policy.Mode == sandbox.EgressUnrestricted {
-		fmt.Fprintln(cmd.OutOrStdout(), "Mode: unrestricted")
 		return nil
 	}
-
-	fmt.Fprintf(cmd.OutOrStdout(), "Mode: %s\n", policy.Mode)
+	if policy.Version == 0 {
+		fmt.Fprintln(out, "No policy record; mode read from the container's egress files.")
+	}
+	if len(policy.Presets) > 0 {
+		fmt.Fprintf(out, "Presets: %s\n", strings.Join(policy.Presets, ", "))
+	}
+	if len(policy.Allow) > 0 {
+		fmt.Fprintf(out, "Added: %s\n", strings.Join(policy.Allow, ", "))
+	}
+	if len(policy.Deny) > 0 {
+		fmt.Fprintf(out, "Removed: %s\n", strings.Join(policy.Deny, ", "))
+	}
+	if policy.Mode == sandbox.EgressLearn {
+		fmt.Fprintf(out, "Run `pixels network suggest %s` for a proposed allowlist.\n", name)
+		return nil
+	}
 	if len(policy.Domains) > 0 {
-		fmt.Fprintln(cmd.OutOrStdout(), "Domains:")
+		fmt.Fprintln(out, "Domains:")
+		w := newTabWriter(cmd)
 		for _, d := range policy.Domains {
-			fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", d)
+			r, err := egress.ParseRule(d)
+			if err != nil {
+				fmt.Fprintf(w, "  %s\t\n", d)
+				continue
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", r.Host, r.Ports())
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if cfg.Network.Enforce == "host" {
+		return nil
+	}
+	// A stopped container has no refresh to report; show the policy anyway.
+	if status, err := egress.ReadRefreshStatus(cmd.Context(), sb, name); err == nil && status != nil {
+		fmt.Fprintf(out, "Last refresh: %s\n", formatRefresh(*status))
+		if len(status.Unresolved) > 0 {
+			fmt.Fprintf(out, "Unresolved (kept at their last addresses): %s\n", strings.Join(status.Unresolved, ", "))
 		}
 	}
 	return nil
 }
 
+// formatRefresh describes the result of an egress refresh for network show.
+func formatRefresh(s egress.RefreshStatus) string {
+	when := humanize.Time(s.Time)
+	switch s.Result {
+	case egress.RefreshOK:
+		msg := fmt.Sprintf("%s, ok: %d addresses, %d added, %d removed", when, s.Elements, s.Added, s.Removed)
+		if s.Message != "" {
+			msg += " (" + s.Message + ")"
+		}
+		return msg
+	default:
+		return fmt.Sprintf("%s, %s: %s", when, s.Result, s.Message)
+	}
+}
+
+func runNetworkDiff(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	ctx := cmd.Context()
+	policy, err := sb.GetPolicy(ctx, name)
+	if err != nil {
+		return err
+	}
+	state, err := egress.ReadState(ctx, sb, name, *policy)
+	if err != nil {
+		return err
+	}
+	diffs := egress.Diff(*policy, state)
+
+	out := cmd.OutOrStdout()
+	if asJSON {
+		if diffs == nil {
+			diffs = []egress.Difference{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintf(out, "Egress rules for %s match its %s policy.\n", name, policy.Mode)
+		return nil
+	}
+	w := newTabWriter(cmd)
+	for _, d := range diffs {
+		marker := map[string]string{egress.DiffMissing: "-", egress.DiffExtra: "+"}[d.Change]
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", marker, d.Kind, d.Entry, d.Detail)
+	}
+	return w.Flush()
+}
+
+// egressReport is the result of verifying one container's egress policy.
+type egressReport struct {
+	Name      string              `json:"name"`
+	Mode      sandbox.EgressMode  `json:"mode,omitempty"`
+	Drift     []egress.Difference `json:"drift,omitempty"`
+	Reapplied bool                `json:"reapplied,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+func runNetworkVerify(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	reapply, _ := cmd.Flags().GetBool("reapply")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	if all == (len(args) > 0) {
+		return fmt.Errorf("give container names or --all")
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	ctx := cmd.Context()
+	names := args
+	if all {
+		instances, err := sb.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, inst := range instances {
+			if inst.Status == sandbox.StatusRunning {
+				names = append(names, inst.Name)
+			}
+		}
+	}
+
+	var reports []egressReport
+	failed := 0
+	for _, name := range names {
+		r := verifyEgress(ctx, sb, name, reapply)
+		if r.Error != "" || (len(r.Drift) > 0 && !r.Reapplied) {
+			failed++
+		}
+		reports = append(reports, r)
+	}
+
+	out := cmd.OutOrStdout()
+	if asJSON {
+		if reports == nil {
+			reports = []egressReport{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range reports {
+			switch {
+			case r.Error != "" && r.Mode == "":
+				fmt.Fprintf(out, "%s: %s\n", r.Name, r.Error)
+				continue
+			case len(r.Drift) == 0:
+				fmt.Fprintf(out, "%s: ok (%s)\n", r.Name, r.Mode)
+				continue
+			}
+			if r.Mode == "" {
+				fmt.Fprintf(out, "%s: drifted\n", r.Name)
+			} else {
+				fmt.Fprintf(out, "%s: drifted from %s\n", r.Name, r.Mode)
+			}
+			w := newTabWriter(cmd)
+			for _, d := range r.Drift {
+				marker := map[string]string{egress.DiffMissing: "-", egress.DiffExtra: "+"}[d.Change]
+				fmt.Fprintf(w, "  %s %s\t%s\t%s\n", marker, d.Kind, d.Entry, d.Detail)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			switch {
+			case r.Reapplied:
+				fmt.Fprintf(out, "  reapplied %s\n", r.Mode)
+			case r.Error != "":
+				fmt.Fprintf(out, "  %s\n", r.Error)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("egress drift in %d of %d containers", failed, len(names))
+	}
+	return nil
+}
+
+// verifyEgress checks name's egress enforcement against its policy and, if
+// reapply is set and it has drifted, applies the policy again and checks
+// that took.
+func verifyEgress(ctx context.Context, sb sandbox.Sandbox, name string, reapply bool) egressReport {
+	r := egressReport{Name: name}
+	policy, drift, err := egress.Verify(ctx, sb, name)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Mode, r.Drift = policy.Mode, drift
+	if len(drift) == 0 || !reapply {
+		return r
+	}
+	if policy.Mode == "" {
+		r.Error = "no policy record to reapply"
+		return r
+	}
+	if err := egress.Reapply(ctx, sb, name, *policy); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	if _, drift, err := egress.Verify(ctx, sb, name); err != nil {
+		r.Error = err.Error()
+	} else if len(drift) > 0 {
+		r.Error = fmt.Sprintf("still drifted after reapplying: %d differences", len(drift))
+	} else {
+		r.Reapplied = true
+	}
+	return r
+}
+
 func runNetworkSet(cmd *cobra.Command, args []string) error {
 	name, mode := args[0], args[1]
 
-	if mode != "unrestricted" && mode != "agent" && mode != "allowlist" {
-		return fmt.Errorf("invalid mode %q: must be unrestricted, agent, or allowlist", mode)
+	if mode != "learn" {
+		if err := egress.ValidateEgress(mode); err != nil {
+			return fmt.Errorf("invalid mode %q: %w", mode, err)
+		}
 	}
 
 	sb, err := openSandbox()
@@ -95,8 +444,47 @@ func runNetworkSet(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runNetworkPresets(cmd *cobra.Command, args []string) error {
+	if len(args) == 1 {
+		for _, name := range strings.Split(args[0], ",") {
+			if _, ok := egress.LookupPreset(name); !ok {
+				return fmt.Errorf("unknown preset %q", name)
+			}
+		}
+		for _, d := range egress.PresetDomains(args[0]) {
+			fmt.Fprintln(cmd.OutOrStdout(), d)
+		}
+		for _, c := range egress.PresetCIDRs(args[0]) {
+			fmt.Fprintln(cmd.OutOrStdout(), c)
+		}
+		return nil
+	}
+
+	tw := newTabWriter(cmd)
+	fmt.Fprintln(tw, "PRESET\tSOURCE\tEXTENDS\tDOMAINS\tCIDRS")
+	for _, name := range egress.PresetNames() {
+		p, _ := egress.LookupPreset(name)
+		source := "config"
+		if egress.IsBuiltinPreset(name) {
+			source = "built-in"
+		}
+		extends := cmp.Or(strings.Join(p.Extends, ","), "-")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", name, source, extends,
+			len(egress.PresetDomains(name)), len(egress.PresetCIDRs(name)))
+	}
+	return tw.Flush()
+}
+
 func runNetworkAllow(cmd *cobra.Command, args []string) error {
-	name, domain := args[0], args[1]
+	name := args[0]
+	rule, err := egress.ParseRule(args[1])
+	if err != nil {
+		return err
+	}
+	domain := rule.String()
+	if egress.IsPattern(rule.Host) && (!cfg.Network.DNSFilter || cfg.Network.Enforce == "host") {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s needs network.dns_filter to match subdomains\n", domain)
+	}
 
 	sb, err := openSandbox()
 	if err != nil {
@@ -114,6 +502,9 @@ func runNetworkAllow(cmd *cobra.Command, args []string) error {
 
 func runNetworkDeny(cmd *cobra.Command, args []string) error {
 	name, domain := args[0], args[1]
+	if d, err := egress.NormalizeRule(domain); err == nil {
+		domain = d
+	}
 
 	sb, err := openSandbox()
 	if err != nil {
@@ -128,3 +519,209 @@ func runNetworkDeny(cmd *cobra.Command, args []string) error {
 	fmt.Fprintf(cmd.OutOrStdout(), "Denied %s for %s\n", domain, name)
 	return nil
 }
+
+func runNetworkLog(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	follow, _ := cmd.Flags().GetBool("follow")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	since, _ := cmd.Flags().GetDuration("since")
+	if since <= 0 {
+		return fmt.Errorf("invalid --since %s: must be positive", since)
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	ctx := cmd.Context()
+	inst, err := sb.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	own := slices.Concat(inst.Addresses, inst.AddressesV6)
+	out := cmd.OutOrStdout()
+
+	if !follow {
+		denials, err := collectDenials(ctx, sb, name, own, since)
+		if err != nil {
+			return err
+		}
+		summary := egress.SummarizeDenials(denials)
+		if asJSON {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			if summary == nil {
+				summary = []egress.DenialSummary{}
+			}
+			return enc.Encode(summary)
+		}
+		if len(summary) == 0 {
+			fmt.Fprintf(out, "No denials for %s in the last %s.\n", name, since)
+			return nil
+		}
+		w := newTabWriter(cmd)
+		fmt.Fprintln(w, "DESTINATION\tPROTO\tPORT\tCOUNT\tLAST")
+		for _, s := range summary {
+			port := "—"
+			if s.Port > 0 {
+				port = strconv.Itoa(s.Port)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", cmp.Or(s.Host, s.Addr), orDash(s.Proto), port, s.Count, humanize.Time(s.Last))
+		}
+		return w.Flush()
+	}
+
+	// Poll, looking back a little past the last poll so entries logged
+	// late aren't missed, and skip what was already printed.
+	enc := json.NewEncoder(out)
+	seen := map[egress.Denial]bool{}
+	window := since
+	for {
+		start := time.Now()
+		denials, err := collectDenials(ctx, sb, name, own, window)
+		if err != nil {
+			return err
+		}
+		next := map[egress.Denial]bool{}
+		for _, d := range denials {
+			next[d] = true
+			if seen[d] {
+				continue
+			}
+			if asJSON {
+				err = enc.Encode(d)
+			} else {
+				_, err = fmt.Fprintln(out, formatDenial(d))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		seen = next
+		window = networkLogPoll + 10*time.Second
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(start.Add(networkLogPoll))):
+		}
+	}
+}
+
+// networkLogPoll is how often `network log --follow` reads the logs.
+const networkLogPoll = 2 * time.Second
+
+// collectDenials reads the denials logged in name over the last window.
+func collectDenials(ctx context.Context, sb sandbox.Sandbox, name string, own []string, window time.Duration) ([]egress.Denial, error) {
+	var stdout, stderr bytes.Buffer
+	secs := strconv.Itoa(int(window.Seconds()) + 1)
+	rc, err := sb.Run(ctx, name, sandbox.ExecOpts{
+		Cmd:    []string{"bash", "-c", egress.DenialLogScript(), "pixels-network-log", secs},
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Root:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading egress logs: %w", err)
+	}
+	if rc != 0 {
+		return nil, fmt.Errorf("reading egress logs: exit code %d: %s", rc, strings.TrimSpace(stderr.String()))
+	}
+	cutoff := time.Now().Add(-window)
+	return slices.DeleteFunc(egress.ParseDenials(stdout.Bytes(), own), func(d egress.Denial) bool {
+		return d.Time.Before(cutoff)
+	}), nil
+}
+
+// formatDenial renders a denial as a line of text in local time.
+func formatDenial(d egress.Denial) string {
+	dst := d.Host
+	switch {
+	case d.Addr != "" && dst != "":
+		dst += " (" + d.Addr + ")"
+	case d.Addr != "":
+		dst = d.Addr
+	}
+	if d.Port > 0 {
+		dst += " port " + strconv.Itoa(d.Port)
+	}
+	return fmt.Sprintf("%s  %-4s  %s", d.Time.Local().Format(time.DateTime), d.Proto, dst)
+}
+
+func runNetworkSuggest(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	apply, _ := cmd.Flags().GetBool("apply")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	ctx := cmd.Context()
+	policy, err := sb.GetPolicy(ctx, name)
+	if err != nil {
+		return err
+	}
+	if policy.Mode != sandbox.EgressLearn {
+		return fmt.Errorf("%s is not in learn mode; run `pixels network set %s learn` first", name, name)
+	}
+
+	var stdout, stderr bytes.Buffer
+	rc, err := sb.Run(ctx, name, sandbox.ExecOpts{
+		Cmd:    []string{"bash", "-c", egress.LearnedScript()},
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Root:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("reading learned egress: %w", err)
+	}
+	if rc != 0 {
+		return fmt.Errorf("reading learned egress: exit code %d: %s", rc, strings.TrimSpace(stderr.String()))
+	}
+	suggestions := egress.Suggest(policy.Domains, egress.ParseLearned(stdout.Bytes()))
+
+	out := cmd.OutOrStdout()
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if suggestions == nil {
+			suggestions = []egress.Suggestion{}
+		}
+		if err := enc.Encode(suggestions); err != nil {
+			return err
+		}
+	} else if len(suggestions) == 0 {
+		fmt.Fprintf(out, "Nothing learned for %s yet.\n", name)
+	} else {
+		w := newTabWriter(cmd)
+		for _, s := range suggestions {
+			marker := map[string]string{egress.SuggestAdd: "+", egress.SuggestKeep: " ", egress.SuggestRemove: "-", egress.SuggestUnnamed: "?"}[s.Status]
+			fmt.Fprintf(w, "%s %s\t%s\n", marker, s.Entry, strings.Join(s.Ports, " "))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if !apply {
+		return nil
+	}
+
+	// Start from the configured allowlist, then make it match the
+	// proposal.
+	proposed := egress.Proposed(policy.Domains, suggestions)
+	if err := sb.SetEgressMode(ctx, name, sandbox.EgressAllowlist); err != nil {
+		return err
+	}
+	if err := egress.SetDomains(ctx, sb, name, proposed); err != nil {
+		return err
+	}
+	if !asJSON {
+		fmt.Fprintf(out, "Egress set to allowlist for %s with %d domains\n", name, len(proposed))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "resize <name>",
+		Short: "Change a pixel's CPU, memory, or disk limits",
+		Long: `Change a pixel's CPU, memory, or disk limits in place.
+
+CPU and memory changes apply to a running pixel without a restart. Growing
+the root disk is supported on the incus backend only.`,
+		Example: `  pixels resize mybox --cpu 4 --memory 8192
+  pixels resize mybox --disk 40G`,
+		Args: cobra.ExactArgs(1),
+		RunE: runResize,
+	}
+	cmd.Flags().String("cpu", "", "CPU cores")
+	cmd.Flags().Int64("memory", 0, "memory in MiB")
+	cmd.Flags().String("disk", "", "root disk size (e.g. 40G)")
+	rootCmd.AddCommand(cmd)
+}
+
+func runResize(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	var l sandbox.Limits
+	var changed []string
+	if cpu, _ := cmd.Flags().GetString("cpu"); cpu != "" {
+		l.CPU = cpu
+		changed = append(changed, "cpu="+cpu)
+	}
+	if memory, _ := cmd.Flags().GetInt64("memory"); memory != 0 {
+		if memory < 0 {
+			return fmt.Errorf("invalid --memory %d: must be positive", memory)
+		}
+		l.Memory = memory * 1024 * 1024
+		changed = append(changed, fmt.Sprintf("memory=%dMiB", memory))
+	}
+	if disk, _ := cmd.Flags().GetString("disk"); disk != "" {
+		n, err := humanize.ParseBytes(disk)
+		if err != nil || n == 0 {
+			return fmt.Errorf("invalid --disk %q: want a size such as 40G", disk)
+		}
+		l.Disk = int64(n)
+		changed = append(changed, "disk="+humanize.IBytes(n))
+	}
+	if len(changed) == 0 {
+		return fmt.Errorf("nothing to change: give at least one of --cpu, --memory, --disk")
+	}
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	if err := sb.UpdateLimits(cmd.Context(), name, l); err != nil {
+		return fmt.Errorf("resizing %s: %w", name, err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Resized %s: %s\n", name, strings.Join(changed, " "))
+	return nil
+}
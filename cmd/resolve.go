@@ -36,7 +36,7 @@ func resolveRunningIP(ctx context.Context, name string) (string, error) {
 		return "", fmt.Errorf("looking up %s: %w", name, err)
 	}
 	if !inst.Status.IsRunning() {
-		return "", fmt.Errorf("pixel %q is %s — start it first", name, inst.Status)
+		return "", sandbox.Wrap(sandbox.ErrNotRunning, fmt.Errorf("pixel %q is %s — start it first", name, inst.Status))
 	}
 	if len(inst.Addresses) == 0 {
 		return "", fmt.Errorf("no IP address for %s", name)
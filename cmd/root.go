@@ -13,13 +13,16 @@ import (
 	"github.com/deevus/pixels/sandbox"
 
 	// Register sandbox backends.
+	_ "github.com/deevus/pixels/sandbox/docker"
 	_ "github.com/deevus/pixels/sandbox/incus"
+	_ "github.com/deevus/pixels/sandbox/memory"
 	_ "github.com/deevus/pixels/sandbox/truenas"
 )
 
 var (
 	cfg     *config.Config
 	verbose bool
+	backend string
 )
 
 var rootCmd = &cobra.Command{
@@ -33,12 +36,16 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if backend != "" {
+			cfg.Backend = backend
+		}
 		return nil
 	},
 }
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVar(&backend, "backend", "", "sandbox backend (incus, truenas, docker, memory); overrides config")
 }
 
 func logv(cmd *cobra.Command, format string, a ...any) {
@@ -88,6 +95,12 @@ func sandboxConfig() map[string]string {
 	if cfg.Network.Egress != "" {
 		m["egress"] = cfg.Network.Egress
 	}
+	if cfg.Network.Enforce != "" {
+		m["enforce"] = cfg.Network.Enforce
+	}
+	if cfg.Network.DNSFilter {
+		m["dns_filter"] = "true"
+	}
 	if len(cfg.Network.Allow) > 0 {
 		m["allow"] = strings.Join(cfg.Network.Allow, ",")
 	}
@@ -117,9 +130,20 @@ func sandboxConfig() map[string]string {
 		if cfg.TrueNAS.InsecureSkipVerify != nil {
 			m["insecure"] = strconv.FormatBool(*cfg.TrueNAS.InsecureSkipVerify)
 		}
+		if cfg.TrueNAS.StatsOverSSH {
+			m["stats_over_ssh"] = "true"
+		}
 		if cfg.Checkpoint.DatasetPrefix != "" {
 			m["dataset_prefix"] = cfg.Checkpoint.DatasetPrefix
 		}
+		m["forward_dir"] = config.ForwardDir()
+	case "docker":
+		if cfg.Docker.Socket != "" {
+			m["socket"] = cfg.Docker.Socket
+		}
+		m["policy_dir"] = config.PolicyDir()
+	case "memory":
+		m["state_file"] = cfg.MemoryStateFile()
 	case "incus":
 		if cfg.Incus.Socket != "" {
 			m["socket"] = cfg.Incus.Socket
@@ -149,9 +173,30 @@ func openSandbox() (sandbox.Sandbox, error) {
 	return sandbox.Open(cfg.Backend, sandboxConfig())
 }
 
+// exitCodes are the exit statuses for each sandbox error kind, keyed by
+// sandbox.ErrorCode, so scripts can tell failures apart without matching
+// messages. Other errors exit 1.
+var exitCodes = map[string]int{
+	"not_found":       3,
+	"already_exists":  4,
+	"not_running":     5,
+	"snapshot_in_use": 6,
+	"unsupported":     7,
+	"quota_exceeded":  8,
+	"unavailable":     9,
+}
+
+// exitCode returns the exit status for an error from a command.
+func exitCode(err error) int {
+	if code, ok := exitCodes[sandbox.ErrorCode(err)]; ok {
+		return code
+	}
+	return 1
+}
+
 // Execute runs the root command.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
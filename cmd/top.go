@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Show live resource usage across pixels",
+		Long: `Show live resource usage across pixels, busiest first.
+
+CPU% is measured between refreshes, so 100% is one full core. Memory, disk
+and network columns are the current totals reported by the backend.`,
+		Args: cobra.NoArgs,
+		RunE: runTop,
+	}
+	cmd.Flags().DurationP("interval", "n", 2*time.Second, "refresh interval")
+	cmd.Flags().Bool("once", false, "print a single sample and exit")
+	rootCmd.AddCommand(cmd)
+}
+
+// topRow is one pixel in a top sample. Stats is nil for stopped pixels and
+// for pixels whose stats couldn't be read.
+type topRow struct {
+	Name   string
+	Status sandbox.Status
+	Stats  *sandbox.Stats
+	CPU    float64 // percent of one core since the previous sample; -1 if unknown
+}
+
+func runTop(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("invalid --interval %s: must be positive", interval)
+	}
+	once, _ := cmd.Flags().GetBool("once")
+
+	sb, err := openSandbox()
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	out := cmd.OutOrStdout()
+	f, ok := out.(*os.File)
+	redraw := ok && term.IsTerminal(int(f.Fd()))
+
+	prev, err := topSample(ctx, sb)
+	if err != nil {
+		return err
+	}
+	last := time.Now()
+	if !once {
+		if redraw {
+			fmt.Fprint(out, "\033[H\033[2J")
+		}
+		if err := writeTop(out, prev); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		cur, err := topSample(ctx, sb)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		topCPU(cur, prev, now.Sub(last))
+		prev, last = cur, now
+
+		if redraw && !once {
+			fmt.Fprint(out, "\033[H\033[2J")
+		}
+		if err := writeTop(out, cur); err != nil {
+			return err
+		}
+		if once {
+			return nil
+		}
+	}
+}
+
+// topSample lists every pixel and reads stats for the running ones in
+// parallel.
+func topSample(ctx context.Context, sb sandbox.Sandbox) ([]topRow, error) {
+	instances, err := sb.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]topRow, len(instances))
+	var wg sync.WaitGroup
+	for i, inst := range instances {
+		rows[i] = topRow{Name: inst.Name, Status: inst.Status, CPU: -1}
+		if !inst.Status.IsRunning() {
+			continue
+		}
+		wg.Add(1)
+		go func(r *topRow) {
+			defer wg.Done()
+			if st, err := sb.Stats(ctx, r.Name); err == nil {
+				r.Stats = st
+			}
+		}(&rows[i])
+	}
+	wg.Wait()
+	return rows, nil
+}
+
+// topCPU fills in CPU% on cur from the CPU time used since prev.
+func topCPU(cur, prev []topRow, elapsed time.Duration) {
+	before := make(map[string]*sandbox.Stats, len(prev))
+	for _, r := range prev {
+		before[r.Name] = r.Stats
+	}
+	for i := range cur {
+		old, now := before[cur[i].Name], cur[i].Stats
+		if old == nil || now == nil || elapsed <= 0 || now.CPUTime < old.CPUTime {
+			continue
+		}
+		cur[i].CPU = float64(now.CPUTime-old.CPUTime) / float64(elapsed) * 100
+	}
+}
+
+// writeTop prints rows busiest first; pixels without a CPU reading sort by
+// memory, then name.
+func writeTop(w io.Writer, rows []topRow) error {
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(w, "No pixels found.")
+		return err
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		ra, rb := rows[a], rows[b]
+		if ra.CPU != rb.CPU {
+			return ra.CPU > rb.CPU
+		}
+		if ma, mb := topMemory(ra), topMemory(rb); ma != mb {
+			return ma > mb
+		}
+		return ra.Name < rb.Name
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tCPU%\tMEM\tPEAK\tDISK\tNET RX\tNET TX")
+	for _, r := range rows {
+		cpu, mem, peak, disk, rx, tx := "—", "—", "—", "—", "—", "—"
+		if r.CPU >= 0 {
+			cpu = fmt.Sprintf("%.1f", r.CPU)
+		}
+		if st := r.Stats; st != nil {
+			mem, disk = humanize.IBytes(uint64(st.Memory)), humanize.IBytes(uint64(st.Disk))
+			rx, tx = humanize.IBytes(uint64(st.NetRX)), humanize.IBytes(uint64(st.NetTX))
+			if st.MemoryPeak > 0 {
+				peak = humanize.IBytes(uint64(st.MemoryPeak))
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Name, r.Status, cpu, mem, peak, disk, rx, tx)
+	}
+	return tw.Flush()
+}
+
+func topMemory(r topRow) int64 {
+	if r.Stats == nil {
+		return -1
+	}
+	return r.Stats.Memory
+}
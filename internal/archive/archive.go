@@ -0,0 +1,227 @@
+// Package archive packs local files into tar streams and unpacks them
+// again, for copying trees in and out of sandboxes without holding them in
+// memory.
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Owner overrides the ownership recorded for packed entries.
+type Owner struct {
+	UID, GID int
+}
+
+// Pack writes src (a file or a directory tree) to w as a tar stream whose
+// entries are rooted at name. Modes, timestamps and symlinks are recorded
+// as found; ownership is the local one unless owner is non-nil. A symlink
+// given as src itself is followed.
+func Pack(w io.Writer, src, name string, owner *Owner) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	if !info.IsDir() {
+		if err := writeEntry(tw, src, name, info, owner); err != nil {
+			return err
+		}
+		return tw.Close()
+	}
+
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		info := info
+		if p != src {
+			if info, err = d.Info(); err != nil {
+				return err
+			}
+		}
+		return writeEntry(tw, p, path.Join(name, filepath.ToSlash(rel)), info, owner)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeEntry(tw *tar.Writer, p, name string, info fs.FileInfo, owner *Owner) error {
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		l, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		link = l
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() && link == "" {
+		// Sockets, devices and fifos have no place in a copy.
+		return nil
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if owner != nil {
+		hdr.Uid, hdr.Gid = owner.UID, owner.GID
+		hdr.Uname, hdr.Gname = "", ""
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Unpack extracts the tar stream r into dir, which must exist. When rename
+// is non-empty the first path element of every entry is replaced with it,
+// so a tree archived as "out" lands as dir/rename. Entries that would land
+// outside dir are rejected. Ownership is applied only when running as root;
+// symlinks are created last so no entry is written through one.
+func Unpack(r io.Reader, dir, rename string) error {
+	type dirTime struct {
+		path string
+		mod  time.Time
+	}
+	var (
+		links   []*tar.Header
+		targets = map[string]string{} // header name → local path for symlinks
+		dirs    []dirTime
+	)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, err := entryName(hdr.Name, rename)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		mode := fs.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			if err := os.Chmod(target, mode); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTime{target, hdr.ModTime})
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, mode); err != nil {
+				return err
+			}
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		case tar.TypeSymlink:
+			links = append(links, hdr)
+			targets[hdr.Name] = target
+			continue
+		case tar.TypeLink:
+			old, err := entryName(hdr.Linkname, rename)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(filepath.Join(dir, filepath.FromSlash(old)), target); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		chown(target, hdr)
+	}
+
+	for _, hdr := range links {
+		target := targets[hdr.Name]
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+		chown(target, hdr)
+	}
+	// Directory times last: writing their contents bumped them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Chtimes(dirs[i].path, dirs[i].mod, dirs[i].mod)
+	}
+	return nil
+}
+
+// entryName cleans a header name, applies rename to its first element and
+// rejects names that escape the extraction directory.
+func entryName(name, rename string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return "", fmt.Errorf("archive entry %q escapes the destination", name)
+	}
+	if rename != "" {
+		_, rest, _ := strings.Cut(clean, "/")
+		clean = path.Join(rename, rest)
+	}
+	return clean, nil
+}
+
+func writeFile(target string, r io.Reader, mode fs.FileMode) error {
+	// Replace rather than truncate, so a symlink already at target isn't
+	// followed.
+	os.Remove(target)
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// The umask may have masked bits off at create time.
+	return os.Chmod(target, mode)
+}
+
+// chown applies the header's ownership when running as root, as tar does.
+// Errors are ignored: ownership is best-effort on the local side.
+func chown(target string, hdr *tar.Header) {
+	if os.Geteuid() == 0 {
+		os.Lchown(target, hdr.Uid, hdr.Gid)
+	}
+}
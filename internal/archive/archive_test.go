@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub"), 0o750)
+	os.WriteFile(filepath.Join(src, "sub", "run.sh"), []byte("#!/bin/sh\n"), 0o755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o600)
+	os.Symlink("a.txt", filepath.Join(src, "link"))
+
+	var buf bytes.Buffer
+	if err := Pack(&buf, src, "tree", &Owner{UID: 1000, GID: 1000}); err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Uid != 1000 || h.Gid != 1000 || h.Uname != "" {
+			t.Errorf("%s owner = %d:%d (%s), want 1000:1000", h.Name, h.Uid, h.Gid, h.Uname)
+		}
+	}
+
+	dst := t.TempDir()
+	if err := Unpack(&buf, dst, "copy"); err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "copy", "sub", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o755 {
+		t.Errorf("run.sh mode = %v, want 0755", fi.Mode().Perm())
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "copy", "sub")); fi == nil || fi.Mode().Perm() != 0o750 {
+		t.Errorf("sub = %v, want a 0750 directory", fi)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "copy", "link")); err != nil || link != "a.txt" {
+		t.Errorf("link = %q, %v, want a.txt", link, err)
+	}
+}
+
+func TestPackSingleFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "f.txt")
+	os.WriteFile(src, []byte("hello"), 0o644)
+
+	var buf bytes.Buffer
+	if err := Pack(&buf, src, "g.txt", nil); err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	dst := t.TempDir()
+	if err := Unpack(&buf, dst, ""); err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dst, "g.txt")); string(got) != "hello" {
+		t.Errorf("g.txt = %q, want hello", got)
+	}
+}
+
+func TestUnpackRejectsEscapes(t *testing.T) {
+	for _, name := range []string{"../evil", "/etc/evil", "a/../../evil"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644})
+		tw.Close()
+		if err := Unpack(&buf, t.TempDir(), ""); err == nil {
+			t.Errorf("Unpack(%q) succeeded", name)
+		}
+	}
+}
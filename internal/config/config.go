@@ -5,21 +5,28 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/caarlos0/env/v11"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/internal/retention"
 )
 
 type Config struct {
-	Backend    string         `toml:"backend"    env:"PIXELS_BACKEND"` // "truenas" or "incus"
+	Backend    string         `toml:"backend"    env:"PIXELS_BACKEND"` // "truenas", "incus", "docker", or "memory"
 	TrueNAS    TrueNAS        `toml:"truenas"`
 	Incus      Incus          `toml:"incus"`
+	Docker     Docker         `toml:"docker"`
+	Memory     Memory         `toml:"memory"`
 	Defaults   Defaults       `toml:"defaults"`
 	SSH        SSH            `toml:"ssh"`
 	Checkpoint Checkpoint     `toml:"checkpoint"`
 	Provision  Provision      `toml:"provision"`
 	Network    Network        `toml:"network"`
 	MCP        MCP            `toml:"mcp"`
+	Mounts     []Mount        `toml:"mounts"`
 	RawEnv     map[string]any `toml:"env"`
 
 	// Resolved env vars (not from TOML directly).
@@ -36,12 +43,26 @@ type Incus struct {
 	Project    string `toml:"project"     env:"PIXELS_INCUS_PROJECT"`
 }
 
+// Docker configures the Docker Engine API backend. Socket also accepts a
+// Podman API socket; when empty, DOCKER_HOST (unix:// only) or
+// /var/run/docker.sock is used.
+type Docker struct {
+	Socket string `toml:"socket" env:"PIXELS_DOCKER_SOCKET"`
+}
+
+// Memory configures the in-memory backend. Its instances only outlive the
+// process when StateFile is set (see [Config.MemoryStateFile]).
+type Memory struct {
+	StateFile string `toml:"state_file" env:"PIXELS_MEMORY_STATE_FILE"`
+}
+
 type TrueNAS struct {
 	Host               string `toml:"host"                env:"PIXELS_TRUENAS_HOST"`
 	Port               int    `toml:"port"                env:"PIXELS_TRUENAS_PORT"`
 	Username           string `toml:"username"            env:"PIXELS_TRUENAS_USERNAME"`
 	APIKey             string `toml:"api_key"             env:"PIXELS_TRUENAS_API_KEY"`
 	InsecureSkipVerify *bool  `toml:"insecure_skip_verify" env:"PIXELS_TRUENAS_INSECURE"`
+	StatsOverSSH       bool   `toml:"stats_over_ssh"      env:"PIXELS_TRUENAS_STATS_OVER_SSH"`
 }
 
 type Base struct {
@@ -58,6 +79,7 @@ type MCP struct {
 	IdleStopAfter    string          `toml:"idle_stop_after"    env:"PIXELS_MCP_IDLE_STOP_AFTER"`
 	HardDestroyAfter string          `toml:"hard_destroy_after" env:"PIXELS_MCP_HARD_DESTROY_AFTER"`
 	ReapInterval     string          `toml:"reap_interval"      env:"PIXELS_MCP_REAP_INTERVAL"`
+	EgressDrift      string          `toml:"egress_drift"       env:"PIXELS_MCP_EGRESS_DRIFT"` // "report", "reapply" or "off"
 	StateFile        string          `toml:"state_file"         env:"PIXELS_MCP_STATE_FILE"`
 	PIDFile          string          `toml:"pid_file"           env:"PIXELS_MCP_PID_FILE"`
 	ExecTimeoutMax   string          `toml:"exec_timeout_max"   env:"PIXELS_MCP_EXEC_TIMEOUT_MAX"`
@@ -66,6 +88,14 @@ type MCP struct {
 	Bases            map[string]Base `toml:"bases"`
 }
 
+// Mount is a [[mounts]] entry: a host directory attached to every new
+// pixel. Source is a path on the container host (for TrueNAS, the server).
+type Mount struct {
+	Source   string `toml:"source"`
+	Target   string `toml:"target"`
+	ReadOnly bool   `toml:"readonly"`
+}
+
 type Defaults struct {
 	Image   string   `toml:"image"    env:"PIXELS_DEFAULT_IMAGE"`
 	CPU     string   `toml:"cpu"      env:"PIXELS_DEFAULT_CPU"`
@@ -93,7 +123,69 @@ func (s *SSH) StrictHostKeysEnabled() bool {
 }
 
 type Checkpoint struct {
-	DatasetPrefix string `toml:"dataset_prefix" env:"PIXELS_CHECKPOINT_DATASET_PREFIX"`
+	DatasetPrefix string         `toml:"dataset_prefix" env:"PIXELS_CHECKPOINT_DATASET_PREFIX"`
+	Auto          AutoCheckpoint `toml:"auto"`
+}
+
+// AutoCheckpoint is the [checkpoint.auto] section read by "pixels checkpoint
+// auto". Its schedule applies to every running pixel; entries in Pixels
+// ([checkpoint.auto.pixels.<name>]) override it field by field.
+type AutoCheckpoint struct {
+	AutoSchedule
+	Pixels map[string]AutoSchedule `toml:"pixels"`
+}
+
+// AutoSchedule says how often to checkpoint a pixel and which of its
+// automatic checkpoints to keep. An empty Every, or "off", disables it.
+type AutoSchedule struct {
+	Every     string `toml:"every"`      // e.g. "30m"
+	KeepLast  int    `toml:"keep_last"`  // newest N automatic checkpoints
+	KeepDaily int    `toml:"keep_daily"` // newest one on each of the last N days
+	OlderThan string `toml:"older_than"` // keep anything younger, e.g. "7d"
+}
+
+// For returns the schedule for the named pixel.
+func (a *AutoCheckpoint) For(name string) AutoSchedule {
+	s := a.AutoSchedule
+	o, ok := a.Pixels[name]
+	if !ok {
+		return s
+	}
+	if o.Every != "" {
+		s.Every = o.Every
+	}
+	if o.KeepLast != 0 {
+		s.KeepLast = o.KeepLast
+	}
+	if o.KeepDaily != 0 {
+		s.KeepDaily = o.KeepDaily
+	}
+	if o.OlderThan != "" {
+		s.OlderThan = o.OlderThan
+	}
+	return s
+}
+
+// Enabled reports whether s checkpoints at all.
+func (s AutoSchedule) Enabled() bool {
+	return s.Every != "" && s.Every != "off"
+}
+
+func (s AutoSchedule) validate() error {
+	if s.Enabled() {
+		if d, err := time.ParseDuration(s.Every); err != nil || d <= 0 {
+			return fmt.Errorf("invalid every %q", s.Every)
+		}
+	}
+	if s.KeepLast < 0 || s.KeepDaily < 0 {
+		return fmt.Errorf("keep_last and keep_daily must not be negative")
+	}
+	if s.OlderThan != "" {
+		if _, err := retention.ParseAge(s.OlderThan); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type Provision struct {
@@ -116,12 +208,17 @@ func (p *Provision) DevToolsEnabled() bool {
 }
 
 type Network struct {
-	Egress string   `toml:"egress" env:"PIXELS_NETWORK_EGRESS"`
-	Allow  []string `toml:"allow"`
+	Egress    string   `toml:"egress" env:"PIXELS_NETWORK_EGRESS"`
+	Enforce   string   `toml:"enforce" env:"PIXELS_NETWORK_ENFORCE"` // "container" or "host" (incus only)
+	DNSFilter bool     `toml:"dns_filter" env:"PIXELS_NETWORK_DNS_FILTER"`
+	Allow     []string `toml:"allow"`
+	// Presets are named allowlists selectable as egress modes alongside
+	// the built-in ones, keyed by name.
+	Presets map[string]egress.Preset `toml:"presets"`
 }
 
 func (n *Network) IsRestricted() bool {
-	return n.Egress == "agent" || n.Egress == "allowlist"
+	return egress.IsRestricted(n.Egress)
 }
 
 func Load() (*Config, error) {
@@ -152,6 +249,7 @@ func Load() (*Config, error) {
 			IdleStopAfter:    "1h",
 			HardDestroyAfter: "24h",
 			ReapInterval:     "1m",
+			EgressDrift:      "report",
 			ExecTimeoutMax:   "10m",
 			ListenAddr:       "127.0.0.1:8765",
 			EndpointPath:     "/mcp",
@@ -174,6 +272,11 @@ func Load() (*Config, error) {
 	cfg.Incus.ClientCert = expandHome(cfg.Incus.ClientCert)
 	cfg.Incus.ClientKey = expandHome(cfg.Incus.ClientKey)
 	cfg.Incus.ServerCert = expandHome(cfg.Incus.ServerCert)
+	cfg.Docker.Socket = expandHome(cfg.Docker.Socket)
+
+	for i := range cfg.Mounts {
+		cfg.Mounts[i].Source = expandHome(cfg.Mounts[i].Source)
+	}
 
 	for name, b := range cfg.MCP.Bases {
 		b.SetupScript = expandHome(b.SetupScript)
@@ -198,6 +301,37 @@ func Load() (*Config, error) {
 	if err := validateBases(cfg.MCP.Bases); err != nil {
 		return nil, err
 	}
+	switch cfg.MCP.EgressDrift {
+	case "report", "reapply", "off":
+	default:
+		return nil, fmt.Errorf("mcp.egress_drift: %q must be report, reapply or off", cfg.MCP.EgressDrift)
+	}
+	for i, d := range cfg.Network.Allow {
+		norm, err := egress.NormalizeRule(d)
+		if err != nil {
+			return nil, fmt.Errorf("network.allow: %w", err)
+		}
+		cfg.Network.Allow[i] = norm
+	}
+	// Presets are registered here so that every egress mode check after
+	// loading config sees them.
+	if err := egress.SetUserPresets(cfg.Network.Presets); err != nil {
+		return nil, fmt.Errorf("network.presets: %w", err)
+	}
+	for i, m := range cfg.Mounts {
+		if m.Source == "" || !strings.HasPrefix(m.Target, "/") {
+			return nil, fmt.Errorf("mounts[%d]: source and an absolute target are required", i)
+		}
+	}
+
+	if err := cfg.Checkpoint.Auto.validate(); err != nil {
+		return nil, fmt.Errorf("checkpoint.auto: %w", err)
+	}
+	for name, sched := range cfg.Checkpoint.Auto.Pixels {
+		if err := sched.validate(); err != nil {
+			return nil, fmt.Errorf("checkpoint.auto.pixels.%s: %w", name, err)
+		}
+	}
 
 	return cfg, nil
 }
@@ -331,6 +465,15 @@ func (c *Config) MCPStateFile() string {
 	return filepath.Join(mcpCacheDir(), "mcp-state.json")
 }
 
+// MemoryStateFile returns the resolved path to the memory backend's state
+// file, so separate CLI invocations share the same instances.
+func (c *Config) MemoryStateFile() string {
+	if c.Memory.StateFile != "" {
+		return expandHome(c.Memory.StateFile)
+	}
+	return filepath.Join(mcpCacheDir(), "memory-state.json")
+}
+
 // MCPPIDFile returns the resolved path to the MCP pidfile.
 func (c *Config) MCPPIDFile() string {
 	if c.MCP.PIDFile != "" {
@@ -347,6 +490,18 @@ func mcpCacheDir() string {
 	return filepath.Join(dir, "pixels")
 }
 
+// ForwardDir returns the directory where SSH port-forward tunnels are
+// tracked.
+func ForwardDir() string {
+	return filepath.Join(mcpCacheDir(), "forwards")
+}
+
+// PolicyDir returns the directory where egress policy records are kept for
+// backends that can't store them with the instance.
+func PolicyDir() string {
+	return filepath.Join(filepath.Dir(configPath()), "policies")
+}
+
 // KnownHostsPath returns the path to the pixels-managed SSH known_hosts file.
 func KnownHostsPath() string {
 	dir := filepath.Dir(configPath())
@@ -3,7 +3,11 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/deevus/pixels/internal/egress"
 )
 
 func TestLoadDefaults(t *testing.T) {
@@ -452,6 +456,81 @@ allow = ["internal.mycompany.com", "registry.example.com"]
 	}
 }
 
+func TestNetworkAllowPatterns(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	cfgDir := filepath.Join(dir, "pixels")
+	if err := os.MkdirAll(cfgDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(allow string) {
+		t.Helper()
+		content := "[network]\nallow = [" + allow + "]\n"
+		if err := os.WriteFile(filepath.Join(cfgDir, "config.toml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`"*.GitHubUserContent.com", ".amazonaws.com.", "db.internal:5432/TCP"`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	want := []string{"*.githubusercontent.com", ".amazonaws.com", "db.internal:5432/tcp"}
+	if !slices.Equal(cfg.Network.Allow, want) {
+		t.Errorf("Network.Allow = %v, want %v", cfg.Network.Allow, want)
+	}
+
+	write(`"*.com"`)
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "network.allow") {
+		t.Errorf("Load() error = %v, want network.allow error", err)
+	}
+}
+
+func TestNetworkPresets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	cfgDir := filepath.Join(dir, "pixels")
+	if err := os.MkdirAll(cfgDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cfgDir, "config.toml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { egress.SetUserPresets(nil) })
+
+	write(`
+[network]
+egress = "agent,rust"
+
+[network.presets.rust]
+domains = ["index.crates.io"]
+cidrs = ["10.20.0.0/16"]
+extends = ["agent"]
+`)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if p := cfg.Network.Presets["rust"]; !slices.Equal(p.Extends, []string{"agent"}) {
+		t.Errorf("Presets[rust] = %+v", p)
+	}
+	if err := egress.ValidateEgress(cfg.Network.Egress); err != nil {
+		t.Errorf("ValidateEgress(%q) = %v", cfg.Network.Egress, err)
+	}
+	if !slices.Contains(egress.PresetDomains("rust"), "index.crates.io") {
+		t.Error("rust preset not registered")
+	}
+
+	write("[network.presets.agent]\ndomains = [\"example.com\"]\n")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "network.presets") {
+		t.Errorf("Load() error = %v, want network.presets error", err)
+	}
+}
+
 func TestNetworkEnvOverride(t *testing.T) {
 	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 	t.Setenv("PIXELS_NETWORK_EGRESS", "allowlist")
@@ -474,6 +553,8 @@ func TestNetworkIsRestricted(t *testing.T) {
 		{"unrestricted", false},
 		{"agent", true},
 		{"allowlist", true},
+		{"agent,rust", true},
+		{"", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.egress, func(t *testing.T) {
@@ -600,6 +681,27 @@ func TestMCPDefaults(t *testing.T) {
 	if got, want := cfg.MCP.ListenAddr, "127.0.0.1:8765"; got != want {
 		t.Errorf("ListenAddr = %q, want %q", got, want)
 	}
+	if got, want := cfg.MCP.EgressDrift, "report"; got != want {
+		t.Errorf("EgressDrift = %q, want %q", got, want)
+	}
+}
+
+func TestMCPEgressDrift(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	t.Setenv("PIXELS_MCP_EGRESS_DRIFT", "reapply")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MCP.EgressDrift != "reapply" {
+		t.Errorf("EgressDrift = %q, want reapply", cfg.MCP.EgressDrift)
+	}
+
+	t.Setenv("PIXELS_MCP_EGRESS_DRIFT", "fix")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "mcp.egress_drift") {
+		t.Errorf("Load with egress_drift = fix: err = %v", err)
+	}
 }
 
 func TestMCPEnvOverride(t *testing.T) {
@@ -662,6 +764,31 @@ func TestMCPStateFilePathOverride(t *testing.T) {
 	}
 }
 
+func TestMemoryStateFilePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", tmpDir)
+
+	cfg := &Config{}
+	got := cfg.MemoryStateFile()
+	want := filepath.Join(tmpDir, "pixels", "memory-state.json")
+	if got != want {
+		t.Errorf("MemoryStateFile = %q, want %q", got, want)
+	}
+}
+
+func TestMemoryStateFileEnvOverride(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("PIXELS_MEMORY_STATE_FILE", "/custom/memory.json")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.MemoryStateFile(), "/custom/memory.json"; got != want {
+		t.Errorf("MemoryStateFile = %q, want %q", got, want)
+	}
+}
+
 func TestMCPBasesParsed(t *testing.T) {
 	tmpDir := t.TempDir()
 	t.Setenv("XDG_CONFIG_HOME", tmpDir)
@@ -933,3 +1060,92 @@ description = "my python"
 		t.Errorf("dev (untouched default) should still be present")
 	}
 }
+
+func TestMountsParsed(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	cfgPath := filepath.Join(tmpDir, "pixels", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, []byte(`
+[[mounts]]
+source = "~/code/app"
+target = "/home/pixel/app"
+
+[[mounts]]
+source = "/srv/datasets"
+target = "/data"
+readonly = true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Mounts) != 2 {
+		t.Fatalf("Mounts = %+v, want 2", cfg.Mounts)
+	}
+	home, _ := os.UserHomeDir()
+	if want := filepath.Join(home, "code/app"); cfg.Mounts[0].Source != want {
+		t.Errorf("Source = %q, want %q (expanded)", cfg.Mounts[0].Source, want)
+	}
+	if m := cfg.Mounts[1]; m.Target != "/data" || !m.ReadOnly {
+		t.Errorf("second mount = %+v", m)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("[[mounts]]\nsource = \"/srv\"\ntarget = \"data\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted a relative mount target")
+	}
+}
+
+func TestAutoCheckpointParsed(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tmpDir)
+	cfgPath := filepath.Join(tmpDir, "pixels", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, []byte(`
+[checkpoint.auto]
+every = "30m"
+keep_last = 10
+keep_daily = 7
+
+[checkpoint.auto.pixels.scratch]
+every = "off"
+
+[checkpoint.auto.pixels.agent]
+every = "10m"
+older_than = "2d"
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auto := cfg.Checkpoint.Auto
+	if got := auto.For("other"); got != (AutoSchedule{Every: "30m", KeepLast: 10, KeepDaily: 7}) {
+		t.Errorf("For(other) = %+v", got)
+	}
+	if auto.For("scratch").Enabled() {
+		t.Error("For(scratch) enabled, want off")
+	}
+	if got := auto.For("agent"); got != (AutoSchedule{Every: "10m", KeepLast: 10, KeepDaily: 7, OlderThan: "2d"}) {
+		t.Errorf("For(agent) = %+v", got)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("[checkpoint.auto.pixels.x]\nevery = \"often\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted an invalid every")
+	}
+}
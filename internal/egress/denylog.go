@@ -0,0 +1,204 @@
+package egress
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeniedLogPrefix starts each kernel log entry for a packet the egress
+// ruleset dropped.
+const DeniedLogPrefix = "pixels-egress-denied: "
+
+// DenialLogScript returns a shell script, run as root inside a container,
+// that prints everything ParseDenials needs from the last $1 seconds:
+// kernel log entries for dropped packets (K lines), the DNS filter's log
+// (D lines) and, where systemd-resolved is running, its cache (C lines),
+// which maps addresses back to names.
+func DenialLogScript() string {
+	return `set -u
+since=$(( $(date +%s) - $1 ))
+
+kernel=$(journalctl -k --no-pager -q -o short-unix --since "@$since" 2>/dev/null | grep -F '` + DeniedLogPrefix + `' || true)
+if [ -n "$kernel" ]; then
+    printf '%s\n' "$kernel" | sed 's/^/K /'
+else
+    dmesg --time-format iso 2>/dev/null | grep -F '` + DeniedLogPrefix + `' | sed 's/^/K /' || true
+fi
+
+journalctl -u pixels-egress-dns --no-pager -q -o cat --since "@$since" 2>/dev/null | sed 's/^/D /' || true
+` + resolverLogTail
+}
+
+// Denial is one packet the egress ruleset dropped, or one name the DNS
+// filter refused to resolve (Proto "dns", with no Addr). Times are in UTC,
+// so equal denials compare equal.
+type Denial struct {
+	Time  time.Time `json:"time"`
+	Host  string    `json:"host,omitempty"` // name Addr was resolved from, if known
+	Addr  string    `json:"addr,omitempty"`
+	Proto string    `json:"proto"` // lower-case, e.g. "tcp", "udp", "icmp" or "dns"
+	Port  int       `json:"port,omitempty"`
+}
+
+// ParseDenials parses the output of DenialLogScript into denials, oldest
+// first, with destination addresses mapped to the names they were most
+// recently resolved from. The kernel log may be shared with the host, so
+// dropped packets from addresses other than own are left out; with own
+// empty, all are kept.
+func ParseDenials(out []byte, own []string) []Denial {
+	var denials []Denial
+	names := newNameIndex()
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		kind, line, _ := strings.Cut(sc.Text(), " ")
+		switch kind {
+		case "K":
+			if d, src, ok := parseKernelDenial(line); ok && (len(own) == 0 || slices.Contains(own, src)) {
+				denials = append(denials, d)
+			}
+		case "D":
+			if kv := logFields(line); kv["msg"] == "denied" {
+				t, _ := time.Parse(time.RFC3339Nano, kv["time"])
+				denials = append(denials, Denial{Time: t.UTC(), Host: kv["name"], Proto: "dns"})
+			}
+		}
+		names.add(kind, line)
+	}
+	for i, d := range denials {
+		if d.Addr != "" {
+			denials[i].Host = names.lookup(d.Addr)
+		}
+	}
+	slices.SortStableFunc(denials, func(a, b Denial) int { return a.Time.Compare(b.Time) })
+	return denials
+}
+
+// parseKernelDenial parses a kernel log line for a dropped packet: a
+// journalctl short-unix or dmesg ISO timestamp, then nftables' log fields.
+// src is the packet's source address.
+func parseKernelDenial(line string) (d Denial, src string, ok bool) {
+	ts, _, _ := strings.Cut(line, " ")
+	_, fields, found := strings.Cut(line, DeniedLogPrefix)
+	if !found {
+		return Denial{}, "", false
+	}
+	d.Time = parseLogTime(ts)
+	for _, f := range strings.Fields(fields) {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "SRC":
+			src = v
+		case "DST":
+			d.Addr = v
+		case "PROTO":
+			d.Proto = strings.ToLower(v)
+		case "DPT":
+			d.Port, _ = strconv.Atoi(v)
+		}
+	}
+	if d.Addr == "" {
+		return Denial{}, "", false
+	}
+	if a, err := netip.ParseAddr(d.Addr); err == nil {
+		d.Addr = a.String()
+	}
+	return d, src, true
+}
+
+// parseLogTime parses a journalctl short-unix timestamp (seconds since the
+// epoch) or a dmesg ISO one into UTC, returning the zero time for anything
+// else.
+func parseLogTime(s string) time.Time {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.UnixMicro(int64(secs * 1e6)).UTC()
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05,000000-07:00", "2006-01-02T15:04:05,000000-0700"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// logFields parses a log/slog text line into its keys and values.
+func logFields(line string) map[string]string {
+	kv := map[string]string{}
+	for line != "" {
+		line = strings.TrimLeft(line, " ")
+		k, rest, ok := strings.Cut(line, "=")
+		if !ok || strings.Contains(k, " ") {
+			break
+		}
+		var v string
+		if strings.HasPrefix(rest, `"`) {
+			q, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				break
+			}
+			v, _ = strconv.Unquote(q)
+			rest = rest[len(q):]
+		} else {
+			v, rest, _ = strings.Cut(rest, " ")
+		}
+		kv[k] = v
+		line = rest
+	}
+	return kv
+}
+
+// DenialSummary counts the denials to one destination.
+type DenialSummary struct {
+	Host  string    `json:"host,omitempty"`
+	Addr  string    `json:"addr,omitempty"`
+	Proto string    `json:"proto"`
+	Port  int       `json:"port,omitempty"`
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// SummarizeDenials groups denials by destination, most frequent first.
+// Packets to a resolved name are grouped by name rather than address, as
+// a name's addresses rotate.
+func SummarizeDenials(denials []Denial) []DenialSummary {
+	type key struct {
+		host, addr, proto string
+		port              int
+	}
+	index := map[key]int{}
+	var out []DenialSummary
+	for _, d := range denials {
+		k := key{d.Host, d.Addr, d.Proto, d.Port}
+		if d.Host != "" {
+			k.addr = ""
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(out)
+			index[k] = i
+			out = append(out, DenialSummary{Host: d.Host, Addr: k.addr, Proto: d.Proto, Port: d.Port, First: d.Time})
+		}
+		s := &out[i]
+		s.Count++
+		if d.Time.Before(s.First) {
+			s.First = d.Time
+		}
+		if d.Time.After(s.Last) {
+			s.Last = d.Time
+		}
+	}
+	slices.SortStableFunc(out, func(a, b DenialSummary) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return b.Last.Compare(a.Last)
+	})
+	return out
+}
@@ -0,0 +1,56 @@
+package egress
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+const sampleDenialLog = `K 1792108800.000001 px-mybox kernel: pixels-egress-denied: IN= OUT=eth0 SRC=10.0.0.5 DST=104.16.1.34 LEN=60 TOS=0x00 PREC=0x00 TTL=64 ID=1 DF PROTO=TCP SPT=40000 DPT=443 WINDOW=64240 RES=0x00 SYN URGP=0
+K 1792108801.000000 px-mybox kernel: pixels-egress-denied: IN= OUT=eth0 SRC=10.0.0.5 DST=104.16.1.34 LEN=60 PROTO=TCP SPT=40002 DPT=443 SYN URGP=0
+K 1792108802.500000 px-mybox kernel: pixels-egress-denied: IN= OUT=eth0 SRC=10.0.0.9 DST=1.1.1.1 LEN=60 PROTO=UDP SPT=5000 DPT=53 LEN=40
+K 2026-10-16T00:00:03,000000+00:00 pixels-egress-denied: IN= OUT=eth0 SRC=fd42::5 DST=2606:4700::6810:122 LEN=80 PROTO=TCP SPT=40004 DPT=443
+D time=2026-10-16T00:00:04.000Z level=INFO msg=denied name=evil.example.com
+D time=2026-10-16T00:00:04.100Z level=INFO msg=allowed name=github.com addr=140.82.112.3
+D garbage
+C Scope protocol=dns interface=eth0
+C registry.yarnpkg.com IN CNAME yarn.cdn.example.net
+C yarn.cdn.example.net IN A 104.16.1.34
+C yarn.cdn.example.net IN AAAA 2606:4700::6810:122
+`
+
+func TestParseDenials(t *testing.T) {
+	got := ParseDenials([]byte(sampleDenialLog), []string{"10.0.0.5", "fd42::5"})
+	want := []Denial{
+		{Time: time.Unix(1792108800, 1000).UTC(), Host: "registry.yarnpkg.com", Addr: "104.16.1.34", Proto: "tcp", Port: 443},
+		{Time: time.Unix(1792108801, 0).UTC(), Host: "registry.yarnpkg.com", Addr: "104.16.1.34", Proto: "tcp", Port: 443},
+		{Time: time.Unix(1792108803, 0).UTC(), Host: "registry.yarnpkg.com", Addr: "2606:4700::6810:122", Proto: "tcp", Port: 443},
+		{Time: time.Unix(1792108804, 0).UTC(), Host: "evil.example.com", Proto: "dns"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseDenials =\n%v\nwant\n%v", got, want)
+	}
+
+	// Without addresses to attribute by, the other source is kept too.
+	if all := ParseDenials([]byte(sampleDenialLog), nil); len(all) != 5 {
+		t.Errorf("ParseDenials with no own addresses = %d denials, want 5", len(all))
+	}
+}
+
+func TestSummarizeDenials(t *testing.T) {
+	got := SummarizeDenials(ParseDenials([]byte(sampleDenialLog), nil))
+	if len(got) != 3 {
+		t.Fatalf("SummarizeDenials = %v, want 3 destinations", got)
+	}
+	first := got[0]
+	if first.Host != "registry.yarnpkg.com" || first.Addr != "" || first.Count != 3 || first.Port != 443 {
+		t.Errorf("top destination = %+v", first)
+	}
+	if !first.First.Equal(time.Unix(1792108800, 1000)) || !first.Last.Equal(time.Unix(1792108803, 0)) {
+		t.Errorf("first/last = %v/%v", first.First, first.Last)
+	}
+	// Ties are broken by the most recent.
+	if got[1].Host != "evil.example.com" || got[2].Addr != "1.1.1.1" {
+		t.Errorf("order = %+v", got)
+	}
+}
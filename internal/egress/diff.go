@@ -0,0 +1,342 @@
+package egress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Rulesets StateScript reports as loaded.
+const (
+	RulesetNone      = "none"
+	RulesetAllowlist = "allowlist"
+	RulesetLearn     = "learn"
+)
+
+// StateScript returns a shell script, run as root inside a container, that
+// prints the egress rules in force for ParseState: the loaded ruleset (T
+// line), the domains and CIDRs files (F and N lines), the allowed sets as
+// nftables JSON (J lines), and the pixel user's sudoers file (P lines) and
+// whether sudo gives it every command (A line). If the DNS filter is
+// running it says so (S
+// line); otherwise each name in p's entries is resolved as the resolve
+// script would (R lines), so the addresses it added can be told apart from
+// any others.
+func StateScript(p sandbox.Policy) string {
+	var names []string
+	for _, r := range ParseRules(p.Domains) {
+		if name, ok := r.Resolvable(); ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return `set -u
+if nft list set inet pixels_egress learned_v4 >/dev/null 2>&1; then
+    echo 'T ` + RulesetLearn + `'
+elif nft list table inet pixels_egress >/dev/null 2>&1; then
+    echo 'T ` + RulesetAllowlist + `'
+else
+    echo 'T ` + RulesetNone + `'
+fi
+[ -f /etc/pixels-egress-domains ] && sed 's/^/F /' /etc/pixels-egress-domains
+[ -f /etc/pixels-egress-cidrs ] && sed 's/^/N /' /etc/pixels-egress-cidrs
+for set in allowed_v4 allowed_v6 allowed_ports_v4 allowed_ports_v6; do
+    printf 'J %s\n' "$(nft -j list set inet pixels_egress "$set" 2>/dev/null | tr -d '\n')"
+done
+[ -f /etc/sudoers.d/pixel ] && sed 's/^/P /' /etc/sudoers.d/pixel
+if command -v sudo >/dev/null && sudo -n -l -U pixel 2>/dev/null | grep -Eq '\) (NOPASSWD: )?ALL$'; then
+    echo 'A all'
+fi
+if systemctl is-active -q pixels-egress-dns 2>/dev/null; then
+    echo 'S filter'
+    exit 0
+fi
+for host in ` + strings.Join(names, " ") + `; do
+    { getent ahostsv4 "$host"; getent ahostsv6 "$host"; } 2>/dev/null | awk '{print $1}' | grep -vi '^::ffff:' | sort -u | sed "s/^/R $host /"
+done
+true
+`
+}
+
+// State is the egress enforcement found in a container.
+type State struct {
+	Ruleset   string              // RulesetNone, RulesetAllowlist or RulesetLearn
+	Domains   []string            // entries in the domains file
+	CIDRs     []string            // entries in the CIDRs file
+	Allowed   []string            // elements of the allowed sets, as allowlist entries
+	DNSFilter bool                // names are allowed by the DNS filter, not up front
+	Resolved  map[string][]string // name -> addresses it resolves to now
+	Sudoers   string              // /etc/sudoers.d/pixel; "" if missing
+	SudoAll   bool                // sudo lets the pixel user run any command
+	Host      bool                // enforced by the host, so sudo inside doesn't matter
+}
+
+// ParseState parses the output of StateScript.
+func ParseState(out []byte) State {
+	s := State{Ruleset: RulesetNone, Resolved: map[string][]string{}}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		kind, line, _ := strings.Cut(sc.Text(), " ")
+		line = strings.TrimSpace(line)
+		switch kind {
+		case "T":
+			s.Ruleset = line
+		case "S":
+			s.DNSFilter = line == "filter"
+		case "P":
+			s.Sudoers += strings.TrimPrefix(sc.Text(), "P ") + "\n"
+		case "A":
+			s.SudoAll = true
+		case "F":
+			if line != "" && !strings.HasPrefix(line, "#") {
+				s.Domains = append(s.Domains, line)
+			}
+		case "N":
+			if line != "" && !strings.HasPrefix(line, "#") {
+				s.CIDRs = append(s.CIDRs, line)
+			}
+		case "J":
+			s.Allowed = append(s.Allowed, parseAllowedSet(line)...)
+		case "R":
+			name, addr, _ := strings.Cut(line, " ")
+			if a, err := netip.ParseAddr(addr); err == nil {
+				s.Resolved[name] = append(s.Resolved[name], a.Unmap().String())
+			}
+		}
+	}
+	return s
+}
+
+// parseAllowedSet reads the elements of an allowed or allowed_ports set
+// from `nft -j list set` output, as allowlist entries: "10.0.0.0/8",
+// "192.0.2.1" or "192.0.2.1:443/tcp".
+func parseAllowedSet(js string) []string {
+	var doc struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []any `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if json.Unmarshal([]byte(js), &doc) != nil {
+		return nil
+	}
+	var entries []string
+	for _, item := range doc.Nftables {
+		if item.Set == nil {
+			continue
+		}
+		for _, e := range item.Set.Elem {
+			if entry, ok := allowedEntry(e); ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+// allowedEntry converts one set element to an allowlist entry. Elements are
+// an address, a {"prefix": ...} or a {"concat": [addr, proto, port]},
+// wrapped in {"elem": {"val": ...}} when they carry flags.
+func allowedEntry(e any) (string, bool) {
+	switch v := e.(type) {
+	case string:
+		return parseAddrOrPrefix(v)
+	case map[string]any:
+		if el, ok := v["elem"].(map[string]any); ok {
+			return allowedEntry(el["val"])
+		}
+		if p, ok := v["prefix"].(map[string]any); ok {
+			addr, _ := p["addr"].(string)
+			bits, _ := p["len"].(float64)
+			return parseAddrOrPrefix(fmt.Sprintf("%s/%d", addr, int(bits)))
+		}
+		if parts, ok := v["concat"].([]any); ok && len(parts) == 3 {
+			host, ok := allowedEntry(parts[0])
+			if !ok {
+				return "", false
+			}
+			proto, port, ok := protoPort(parts[1], parts[2])
+			if !ok {
+				return "", false
+			}
+			return Rule{Host: host, Port: port, Proto: proto}.String(), true
+		}
+	}
+	return "", false
+}
+
+// Kinds of Difference.
+const (
+	DiffRuleset = "ruleset" // the loaded ruleset doesn't match the mode
+	DiffDomains = "domains" // the domains file doesn't match the policy
+	DiffCIDRs   = "cidrs"   // the CIDRs file doesn't match the policy
+	DiffAllowed = "allowed" // the allowed sets don't match the policy
+	DiffSudoers = "sudoers" // sudo isn't restricted as the policy needs
+	DiffRecord  = "record"  // the policy record itself is missing
+)
+
+// Changes a Difference records.
+const (
+	DiffMissing = "missing" // in the policy, not in force
+	DiffExtra   = "extra"   // in force, not in the policy
+)
+
+// Difference is one way a container's egress enforcement departs from its
+// policy record.
+type Difference struct {
+	Kind   string `json:"kind"`
+	Entry  string `json:"entry"`
+	Change string `json:"change"`
+	Detail string `json:"detail,omitempty"`
+
+	resolved bool // depends on what names resolve to; see Drift
+}
+
+// String returns d as a line of a diff: "-" or "+", the kind and entry, and
+// any detail in parentheses.
+func (d Difference) String() string {
+	s := map[string]string{DiffMissing: "-", DiffExtra: "+"}[d.Change] + d.Kind + " " + d.Entry
+	if d.Detail != "" {
+		s += " (" + d.Detail + ")"
+	}
+	return s
+}
+
+// Diff compares the enforcement found in a container with its policy p.
+// Names are checked against the allowed sets by the addresses they resolve
+// to now, so an address a name has since moved off shows as extra. Under
+// the DNS filter, names aren't in those sets and aren't checked.
+func Diff(p sandbox.Policy, s State) []Difference {
+	var diffs []Difference
+	want := RulesetAllowlist
+	switch p.Mode {
+	case sandbox.EgressUnrestricted:
+		want = RulesetNone
+	case sandbox.EgressLearn:
+		want = RulesetLearn
+	}
+	if s.Ruleset != want {
+		if want != RulesetNone {
+			diffs = append(diffs, Difference{Kind: DiffRuleset, Entry: want, Change: DiffMissing, Detail: "loaded: " + s.Ruleset})
+		}
+		if s.Ruleset != RulesetNone {
+			diffs = append(diffs, Difference{Kind: DiffRuleset, Entry: s.Ruleset, Change: DiffExtra, Detail: "mode: " + string(p.Mode)})
+		}
+	}
+	if p.Mode == sandbox.EgressLearn {
+		return diffs
+	}
+
+	if p.Mode != sandbox.EgressUnrestricted && !s.Host {
+		if s.Sudoers != SudoersRestricted() {
+			detail := "/etc/sudoers.d/pixel differs"
+			if s.Sudoers == "" {
+				detail = "/etc/sudoers.d/pixel is missing"
+			}
+			diffs = append(diffs, Difference{Kind: DiffSudoers, Entry: "restricted sudo", Change: DiffMissing, Detail: detail})
+		}
+		if s.SudoAll {
+			diffs = append(diffs, Difference{Kind: DiffSudoers, Entry: "unrestricted sudo", Change: DiffExtra, Detail: "pixel may run any command as root"})
+		}
+	}
+
+	diffs = append(diffs, diffLists(DiffDomains, p.Domains, s.Domains)...)
+	diffs = append(diffs, diffLists(DiffCIDRs, p.CIDRs, s.CIDRs)...)
+	if s.Ruleset != RulesetAllowlist {
+		return diffs
+	}
+
+	// expected maps each element the policy puts in the allowed sets to
+	// the entry it comes from.
+	type source struct {
+		entry    string
+		resolved bool
+	}
+	expected := map[string]source{}
+	var order []string
+	add := func(elem string, from source) {
+		if _, ok := expected[elem]; !ok {
+			expected[elem] = from
+			order = append(order, elem)
+		}
+	}
+	for _, c := range p.CIDRs {
+		if c, ok := parseAddrOrPrefix(c); ok {
+			add(c, source{entry: c})
+		}
+	}
+	names := false // whether any name was resolved into the sets
+	for _, r := range ParseRules(p.Domains) {
+		hosts := []string{r.Host}
+		if !r.IsAddr() {
+			name, ok := r.Resolvable()
+			if !ok || s.DNSFilter {
+				continue
+			}
+			hosts, names = s.Resolved[name], true
+		}
+		from := source{entry: r.String(), resolved: !r.IsAddr()}
+		for _, h := range hosts {
+			if r.Port == 0 {
+				add(h, from)
+				continue
+			}
+			for _, proto := range r.Protos() {
+				add(Rule{Host: h, Port: r.Port, Proto: proto}.String(), from)
+			}
+		}
+	}
+
+	for _, elem := range order {
+		if !slices.Contains(s.Allowed, elem) {
+			from := expected[elem]
+			d := Difference{Kind: DiffAllowed, Entry: elem, Change: DiffMissing, resolved: from.resolved}
+			if from.entry != elem {
+				d.Detail = "from " + from.entry
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	for _, elem := range s.Allowed {
+		if _, ok := expected[elem]; !ok {
+			// Names only resolve to single addresses, so an extra prefix
+			// wasn't left by one.
+			r, err := ParseRule(elem)
+			prefix := err == nil && strings.Contains(r.Host, "/")
+			diffs = append(diffs, Difference{Kind: DiffAllowed, Entry: elem, Change: DiffExtra, resolved: names && !prefix})
+		}
+	}
+	return diffs
+}
+
+// Drift returns the differences between p and s that mean p isn't being
+// enforced as recorded. Unlike Diff, it leaves out addresses that come and
+// go with what names resolve to, so it only reports changes made to the
+// container's rules, files or sudo.
+func Drift(p sandbox.Policy, s State) []Difference {
+	return slices.DeleteFunc(Diff(p, s), func(d Difference) bool { return d.resolved })
+}
+
+// diffLists reports the entries of want missing from got, then those of got
+// not in want.
+func diffLists(kind string, want, got []string) []Difference {
+	var diffs []Difference
+	for _, w := range want {
+		if !slices.Contains(got, w) {
+			diffs = append(diffs, Difference{Kind: kind, Entry: w, Change: DiffMissing})
+		}
+	}
+	for _, g := range got {
+		if !slices.Contains(want, g) {
+			diffs = append(diffs, Difference{Kind: kind, Entry: g, Change: DiffExtra})
+		}
+	}
+	return diffs
+}
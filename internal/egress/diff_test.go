@@ -0,0 +1,103 @@
+package egress
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestParseState(t *testing.T) {
+	out := []byte(`T allowlist
+F github.com
+F # comment
+F 10.0.0.5:5432
+N 140.82.112.0/20
+J {"nftables": [{"metainfo": {"version": "1.0.9"}}, {"set": {"family": "inet", "name": "allowed_v4", "table": "pixels_egress", "type": "ipv4_addr", "flags": ["interval"], "elem": [{"prefix": {"addr": "140.82.112.0", "len": 20}}, "192.0.2.1"]}}]}
+J {"nftables": [{"set": {"family": "inet", "name": "allowed_v6", "table": "pixels_egress", "type": "ipv6_addr", "flags": ["interval"]}}]}
+J {"nftables": [{"set": {"family": "inet", "name": "allowed_ports_v4", "table": "pixels_egress", "elem": [{"concat": ["10.0.0.5", "tcp", 5432]}, {"elem": {"val": {"concat": ["10.0.0.5", 17, 5432]}}}]}}]}
+J
+P pixel ALL=(ALL) NOPASSWD: ALL
+A all
+R github.com 140.82.112.3
+R github.com 2606:50c0:8000::154
+`)
+	s := ParseState(out)
+	if s.Ruleset != RulesetAllowlist || s.DNSFilter {
+		t.Errorf("Ruleset = %q, DNSFilter = %v", s.Ruleset, s.DNSFilter)
+	}
+	if !slices.Equal(s.Domains, []string{"github.com", "10.0.0.5:5432"}) || !slices.Equal(s.CIDRs, []string{"140.82.112.0/20"}) {
+		t.Errorf("files = %v, %v", s.Domains, s.CIDRs)
+	}
+	if want := []string{"140.82.112.0/20", "192.0.2.1", "10.0.0.5:5432/tcp", "10.0.0.5:5432/udp"}; !slices.Equal(s.Allowed, want) {
+		t.Errorf("Allowed = %v, want %v", s.Allowed, want)
+	}
+	if got := s.Resolved["github.com"]; !slices.Equal(got, []string{"140.82.112.3", "2606:50c0:8000::154"}) {
+		t.Errorf("Resolved[github.com] = %v", got)
+	}
+	if s.Sudoers != SudoersUnrestricted() || !s.SudoAll {
+		t.Errorf("Sudoers = %q, SudoAll = %v", s.Sudoers, s.SudoAll)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	p := sandbox.Policy{
+		Version: sandbox.PolicyVersion,
+		Mode:    "agent",
+		Domains: []string{"github.com", "pypi.org:443/tcp", "10.0.0.5:5432"},
+		CIDRs:   []string{"140.82.112.0/20"},
+	}
+	s := State{
+		Ruleset:  RulesetAllowlist,
+		Domains:  []string{"github.com", "10.0.0.5:5432", "example.com"},
+		CIDRs:    []string{"140.82.112.0/20"},
+		Allowed:  []string{"140.82.112.0/20", "140.82.112.3", "10.0.0.5:5432/tcp", "10.0.0.5:5432/udp", "198.51.100.9"},
+		Resolved: map[string][]string{"github.com": {"140.82.112.3"}, "pypi.org": {"151.101.0.223"}},
+		Sudoers:  SudoersRestricted(),
+	}
+	want := []Difference{
+		{Kind: DiffDomains, Entry: "pypi.org:443/tcp", Change: DiffMissing},
+		{Kind: DiffDomains, Entry: "example.com", Change: DiffExtra},
+		{Kind: DiffAllowed, Entry: "151.101.0.223:443/tcp", Change: DiffMissing, Detail: "from pypi.org:443/tcp", resolved: true},
+		{Kind: DiffAllowed, Entry: "198.51.100.9", Change: DiffExtra, resolved: true},
+	}
+	if got := Diff(p, s); !slices.Equal(got, want) {
+		t.Errorf("Diff =\n%v\nwant\n%v", got, want)
+	}
+	if got := Drift(p, s); !slices.Equal(got, want[:2]) {
+		t.Errorf("Drift =\n%v\nwant only the domains file", got)
+	}
+	// A prefix can't have come from a name, so it's drift.
+	widened := s
+	widened.Allowed = append(slices.Clone(s.Allowed), "0.0.0.0/0")
+	if got := Drift(p, widened); !slices.Contains(got, Difference{Kind: DiffAllowed, Entry: "0.0.0.0/0", Change: DiffExtra}) {
+		t.Errorf("Drift with an extra prefix = %v", got)
+	}
+
+	s.DNSFilter = true
+	s.Allowed = []string{"140.82.112.0/20", "10.0.0.5:5432/tcp", "10.0.0.5:5432/udp"}
+	s.Domains = p.Domains
+	if got := Diff(p, s); len(got) != 0 {
+		t.Errorf("Diff under the DNS filter = %v, want none", got)
+	}
+
+	if got := Diff(sandbox.Policy{Mode: sandbox.EgressUnrestricted}, State{Ruleset: RulesetNone}); len(got) != 0 {
+		t.Errorf("Diff(unrestricted) = %v, want none", got)
+	}
+	got := Drift(p, State{Ruleset: RulesetNone, Sudoers: SudoersUnrestricted(), SudoAll: true})
+	want = []Difference{
+		{Kind: DiffRuleset, Entry: RulesetAllowlist, Change: DiffMissing, Detail: "loaded: none"},
+		{Kind: DiffSudoers, Entry: "restricted sudo", Change: DiffMissing, Detail: "/etc/sudoers.d/pixel differs"},
+		{Kind: DiffSudoers, Entry: "unrestricted sudo", Change: DiffExtra, Detail: "pixel may run any command as root"},
+	}
+	if len(got) < 3 || !slices.Equal(got[:3], want) {
+		t.Errorf("Drift after a flush = %v", got)
+	}
+
+	// Under host enforcement, sudo inside the container can't lift the
+	// rules.
+	got = Drift(p, State{Ruleset: RulesetNone, Host: true, SudoAll: true})
+	if len(got) == 0 || slices.ContainsFunc(got, func(d Difference) bool { return d.Kind == DiffSudoers }) {
+		t.Errorf("Drift of a detached host ACL = %v, want the ruleset and no sudo", got)
+	}
+}
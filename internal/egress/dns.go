@@ -0,0 +1,455 @@
+package egress
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Paths used by the in-container DNS filter. The filter is the pixels
+// binary itself, run as `pixels-egress-dns egress-dns`.
+const (
+	DNSFilterPath     = "/usr/local/bin/pixels-egress-dns"
+	DNSFilterUnitPath = "/etc/systemd/system/pixels-egress-dns.service"
+)
+
+// MinDNSTimeout is the shortest time an answered address stays in the
+// allowed set. Clients and libraries cache answers a little past their
+// TTL, and records with a TTL of a few seconds would otherwise expire
+// between the answer and the connection.
+const MinDNSTimeout = time.Minute
+
+// DNSFilter is a DNS forwarder that answers only for allowed names. Other
+// names get NXDOMAIN without reaching the upstream server, and every A and
+// AAAA record in an answer is passed to Allow before the client sees it,
+// so a connection to the answered address is never raced.
+type DNSFilter struct {
+	Upstream string                 // host:port of the real resolver
+	Allowed  func(name string) bool // name is lower-case, without the trailing dot
+	Allow    func(ctx context.Context, name string, addr netip.Addr, ttl time.Duration) error
+	Log      *slog.Logger
+}
+
+// ListenAndServe serves DNS over UDP and TCP on addr until ctx is done.
+func (f *DNSFilter) ListenAndServe(ctx context.Context, addr string) error {
+	var lc net.ListenConfig
+	pc, err := lc.ListenPacket(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+		l.Close()
+	}()
+
+	errc := make(chan error, 2)
+	go func() { errc <- f.serveUDP(ctx, pc) }()
+	go func() { errc <- f.serveTCP(ctx, l) }()
+	err = <-errc
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (f *DNSFilter) serveUDP(ctx context.Context, pc net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		q := bytes.Clone(buf[:n])
+		go func() {
+			if resp := f.handle(ctx, "udp", q); resp != nil {
+				_, _ = pc.WriteTo(resp, from)
+			}
+		}()
+	}
+}
+
+func (f *DNSFilter) serveTCP(ctx context.Context, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+				q, err := readTCPMsg(conn)
+				if err != nil {
+					return
+				}
+				resp := f.handle(ctx, "tcp", q)
+				if resp == nil || writeTCPMsg(conn, resp) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handle answers one query, returning nil if it is too malformed to
+// answer.
+func (f *DNSFilter) handle(ctx context.Context, network string, q []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(q)
+	if err != nil {
+		return nil
+	}
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil
+	}
+	if len(qs) != 1 {
+		return reply(h, qs, dnsmessage.RCodeFormatError)
+	}
+	name := strings.TrimSuffix(strings.ToLower(qs[0].Name.String()), ".")
+	if !f.Allowed(name) {
+		f.logf("denied", "name", name)
+		return reply(h, qs, dnsmessage.RCodeNameError)
+	}
+
+	resp, err := f.exchange(ctx, network, q)
+	if err != nil {
+		f.logf("upstream failed", "name", name, "err", err)
+		return reply(h, qs, dnsmessage.RCodeServerFailure)
+	}
+	for _, rr := range answers(resp) {
+		if err := f.Allow(ctx, name, rr.addr, rr.ttl); err != nil {
+			f.logf("allowing address failed", "name", name, "addr", rr.addr, "err", err)
+			continue
+		}
+		f.logf("allowed", "name", name, "addr", rr.addr)
+	}
+	return resp
+}
+
+func (f *DNSFilter) logf(msg string, args ...any) {
+	if f.Log != nil {
+		f.Log.Info(msg, args...)
+	}
+}
+
+// exchange forwards q to the upstream server over network and returns its
+// answer.
+func (f *DNSFilter) exchange(ctx context.Context, network string, q []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, f.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if network == "tcp" {
+		if err := writeTCPMsg(conn, q); err != nil {
+			return nil, err
+		}
+		return readTCPMsg(conn)
+	}
+	if _, err := conn.Write(q); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Drop stray datagrams that don't answer this query.
+		if n >= 2 && buf[0] == q[0] && buf[1] == q[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+type answer struct {
+	addr netip.Addr
+	ttl  time.Duration
+}
+
+// answers returns the A and AAAA records in a response. A record's TTL is
+// raised to MinDNSTimeout.
+func answers(resp []byte) []answer {
+	var p dnsmessage.Parser
+	if _, err := p.Start(resp); err != nil {
+		return nil
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil
+	}
+	var out []answer
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			return out
+		}
+		ttl := max(time.Duration(h.TTL)*time.Second, MinDNSTimeout)
+		switch h.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return out
+			}
+			out = append(out, answer{netip.AddrFrom4(r.A), ttl})
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return out
+			}
+			out = append(out, answer{netip.AddrFrom16(r.AAAA).Unmap(), ttl})
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return out
+			}
+		}
+	}
+}
+
+// reply builds a response to a query with no answers.
+func reply(h dnsmessage.Header, qs []dnsmessage.Question, rcode dnsmessage.RCode) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 h.ID,
+		Response:           true,
+		OpCode:             h.OpCode,
+		RecursionDesired:   h.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	if err := b.StartQuestions(); err != nil {
+		return nil
+	}
+	for _, q := range qs {
+		if err := b.Question(q); err != nil {
+			return nil
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+func readTCPMsg(r io.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, n)
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+func writeTCPMsg(w io.Writer, msg []byte) error {
+	if len(msg) > 65535 {
+		return errors.New("dns message too long")
+	}
+	buf := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(msg)), uint16(len(msg)))
+	_, err := w.Write(append(buf, msg...))
+	return err
+}
+
+// NftAllow adds addr to the egress ruleset for ttl, as allowed by rules:
+// to the dns_v4 or dns_v6 set if any rule allows every port, otherwise to
+// dns_ports_v4 or dns_ports_v6 with each rule's protocols and port. An
+// element already in a set has its timeout reset, atomically, so it is
+// never briefly missing.
+func NftAllow(ctx context.Context, addr netip.Addr, rules []Rule, ttl time.Duration) error {
+	cmd := exec.CommandContext(ctx, "nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(nftAllowBatch(addr, rules, ttl))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// nftAllowBatch returns the nft commands NftAllow runs.
+func nftAllowBatch(addr netip.Addr, rules []Rule, ttl time.Duration) string {
+	family := "v4"
+	if addr.Is6() {
+		family = "v6"
+	}
+	set, keys := "dns_"+family, []string{addr.String()}
+	if len(rules) > 0 && !slices.ContainsFunc(rules, func(r Rule) bool { return r.Port == 0 }) {
+		set, keys = "dns_ports_"+family, nil
+		for _, r := range rules {
+			for _, proto := range r.Protos() {
+				keys = append(keys, fmt.Sprintf("%s . %s . %d", addr, proto, r.Port))
+			}
+		}
+	}
+
+	var batch strings.Builder
+	for _, key := range keys {
+		elem := fmt.Sprintf("inet pixels_egress %s { %s timeout %ds }", set, key, int(ttl.Seconds()))
+		fmt.Fprintf(&batch, "add element %s\ndelete element inet pixels_egress %s { %s }\nadd element %s\n", elem, set, key, elem)
+	}
+	return batch.String()
+}
+
+// DomainFile is an allowlist read from a domains file, one entry per line,
+// that is re-read whenever the file changes.
+type DomainFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	set     *DomainSet
+}
+
+// NewDomainFile returns the allowlist in path.
+func NewDomainFile(path string) *DomainFile {
+	return &DomainFile{path: path, set: NewDomainSet(nil)}
+}
+
+// Contains reports whether name is allowed by the allowlist. If the file
+// can't be read, the last list read is used.
+func (d *DomainFile) Contains(name string) bool {
+	return d.load().Contains(name)
+}
+
+// Rules returns the entries in the allowlist that allow name.
+func (d *DomainFile) Rules(name string) []Rule {
+	return d.load().Rules(name)
+}
+
+// load returns the allowlist, re-reading the file if it has changed.
+func (d *DomainFile) load() *DomainSet {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fi, err := os.Stat(d.path); err == nil && !fi.ModTime().Equal(d.modTime) {
+		if data, err := os.ReadFile(d.path); err == nil {
+			d.set = NewDomainSet(strings.Split(string(data), "\n"))
+			d.modTime = fi.ModTime()
+		}
+	}
+	return d.set
+}
+
+// DNSFilterBinary returns the running pixels executable, for installing at
+// DNSFilterPath. It fails unless this is a Linux build; the resolve script
+// checks the copy runs before relying on it, since the container's
+// architecture may still differ.
+func DNSFilterBinary() ([]byte, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("the egress DNS filter needs a Linux build of pixels, not %s", runtime.GOOS)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("finding pixels executable: %w", err)
+	}
+	return os.ReadFile(exe)
+}
+
+// DNSFilterUnit returns the systemd unit that runs the DNS filter. The
+// resolve script records the upstream server in /etc/pixels-egress-upstream
+// before it points the container's resolver at the filter. The unit closes
+// DNS to everyone but root itself, where the ruleset has a dns chain, since
+// nftables.service restores the base ruleset on boot.
+func DNSFilterUnit() string {
+	return `[Unit]
+Description=pixels egress DNS filter
+After=network.target nftables.service
+
+[Service]
+EnvironmentFile=/etc/pixels-egress-upstream
+ExecStartPre=-/usr/sbin/nft flush chain inet pixels_egress dns
+ExecStartPre=-/usr/sbin/nft add rule inet pixels_egress dns meta skuid 0 ip daddr @resolvers_v4 accept
+ExecStartPre=-/usr/sbin/nft add rule inet pixels_egress dns meta skuid 0 ip6 daddr @resolvers_v6 accept
+ExecStart=` + DNSFilterPath + ` egress-dns --upstream ${UPSTREAM} $DNS_FILTER_ARGS
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+}
+
+// startDNSFilterFunc defines DNS_FILTER and two shell functions:
+// nameservers, which prints the container's upstream nameservers (the DNS
+// filter's, once it has one), and start_dns_filter, which records the
+// upstream nameserver and the filter's extra arguments in
+// /etc/pixels-egress-upstream, points the container's resolver at the
+// filter, and (re)starts it.
+const startDNSFilterFunc = `DNS_FILTER="` + DNSFilterPath + `"
+UPSTREAM_FILE="/etc/pixels-egress-upstream"
+
+nameservers() {
+    if [ -f "$UPSTREAM_FILE" ]; then
+        (. "$UPSTREAM_FILE" && echo "$UPSTREAM")
+        return
+    fi
+    for conf in /run/systemd/resolve/resolv.conf /etc/resolv.conf; do
+        [ -f "$conf" ] || continue
+        awk '$1 == "nameserver" && $2 != "127.0.0.1" && $2 != "127.0.0.53" && $2 != "::1" { print $2 }' "$conf"
+    done | awk '!seen[$0]++'
+}
+
+start_dns_filter() {
+    local upstream
+    upstream=$(nameservers | head -n 1)
+    if [ -z "$upstream" ]; then
+        echo "No upstream nameserver found for the DNS filter" >&2
+        exit 1
+    fi
+    printf 'UPSTREAM=%s\nDNS_FILTER_ARGS=%s\n' "$upstream" "$*" > "$UPSTREAM_FILE"
+
+    systemctl disable --now systemd-resolved 2>/dev/null || true
+    [ -L /etc/resolv.conf ] && rm -f /etc/resolv.conf
+    echo "nameserver 127.0.0.1" > /etc/resolv.conf
+
+    if [ -d /run/systemd/system ]; then
+        systemctl daemon-reload
+        systemctl enable pixels-egress-dns >/dev/null 2>&1 || true
+        systemctl restart pixels-egress-dns
+    else
+        pkill -f "$DNS_FILTER egress-dns" || true
+        nohup setsid "$DNS_FILTER" egress-dns --upstream "$upstream" "$@" >>/var/log/pixels-egress-dns.log 2>&1 &
+    fi
+}
+`
+
+// StopDNSFilterScript returns a shell snippet that stops the DNS filter,
+// if it was set up, and hands name resolution back to the container's own
+// resolver.
+func StopDNSFilterScript() string {
+	return `if [ -f /etc/pixels-egress-upstream ]; then
+    . /etc/pixels-egress-upstream
+    systemctl disable --now pixels-egress-dns 2>/dev/null || pkill -f 'pixels-egress-dns egress-dns' || true
+    if systemctl enable --now systemd-resolved 2>/dev/null; then
+        rm -f /etc/resolv.conf
+        ln -s ../run/systemd/resolve/stub-resolv.conf /etc/resolv.conf
+    else
+        echo "nameserver $UPSTREAM" > /etc/resolv.conf
+    fi
+    rm -f /etc/pixels-egress-upstream ` + DNSFilterPath + ` ` + DNSFilterUnitPath + `
+fi
+`
+}
@@ -0,0 +1,187 @@
+package egress
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeUpstream answers every A query with 192.0.2.1 and every AAAA query
+// with 2001:db8::1, each with a TTL of ttl seconds, and counts queries.
+func fakeUpstream(t *testing.T, ttl uint32) (addr string, queries func() int) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	var mu sync.Mutex
+	n := 0
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			size, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			h, err := p.Start(buf[:size])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			mu.Lock()
+			n++
+			mu.Unlock()
+
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true})
+			_ = b.StartQuestions()
+			_ = b.Question(q)
+			_ = b.StartAnswers()
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+			switch q.Type {
+			case dnsmessage.TypeA:
+				_ = b.AResource(rh, dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}})
+			case dnsmessage.TypeAAAA:
+				_ = b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::1").As16()})
+			}
+			msg, _ := b.Finish()
+			_, _ = pc.WriteTo(msg, from)
+		}
+	}()
+	return pc.LocalAddr().String(), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return n
+	}
+}
+
+func query(t *testing.T, name string, typ dnsmessage.Type) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	_ = b.StartQuestions()
+	if err := b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestDNSFilterHandle(t *testing.T) {
+	upstream, queries := fakeUpstream(t, 5)
+	allowed := map[string]netip.Addr{}
+	f := &DNSFilter{
+		Upstream: upstream,
+		Allowed:  func(name string) bool { return name == "github.com" },
+		Allow: func(_ context.Context, name string, addr netip.Addr, ttl time.Duration) error {
+			if name != "github.com" {
+				t.Errorf("Allow(%s) name = %q, want github.com", addr, name)
+			}
+			if ttl != MinDNSTimeout {
+				t.Errorf("Allow(%s) ttl = %v, want %v", addr, ttl, MinDNSTimeout)
+			}
+			allowed[addr.String()] = addr
+			return nil
+		},
+	}
+	ctx := context.Background()
+
+	t.Run("denied name", func(t *testing.T) {
+		resp := f.handle(ctx, "udp", query(t, "evil.example.", dnsmessage.TypeA))
+		var p dnsmessage.Parser
+		h, err := p.Start(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.RCode != dnsmessage.RCodeNameError {
+			t.Errorf("rcode = %v, want NXDOMAIN", h.RCode)
+		}
+		if h.ID != 42 {
+			t.Errorf("id = %d, want 42", h.ID)
+		}
+		if queries() != 0 {
+			t.Errorf("denied query reached upstream")
+		}
+	})
+
+	t.Run("allowed name", func(t *testing.T) {
+		for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			resp := f.handle(ctx, "udp", query(t, "GitHub.com.", typ))
+			if got := answers(resp); len(got) != 1 {
+				t.Fatalf("answers = %v, want 1", got)
+			}
+		}
+		for _, want := range []string{"192.0.2.1", "2001:db8::1"} {
+			if _, ok := allowed[want]; !ok {
+				t.Errorf("%s not allowed; got %v", want, allowed)
+			}
+		}
+	})
+}
+
+func TestDNSFilterUpstreamDown(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	f := &DNSFilter{
+		Upstream: addr,
+		Allowed:  func(string) bool { return true },
+		Allow:    func(context.Context, string, netip.Addr, time.Duration) error { return nil },
+	}
+	resp := f.handle(context.Background(), "tcp", query(t, "github.com.", dnsmessage.TypeA))
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.RCode != dnsmessage.RCodeServerFailure {
+		t.Errorf("rcode = %v, want SERVFAIL", h.RCode)
+	}
+}
+
+func TestDomainFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains")
+	if err := os.WriteFile(path, []byte("# comment\nGitHub.com\n\n  pypi.org \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDomainFile(path)
+	for name, want := range map[string]bool{"github.com": true, "pypi.org": true, "# comment": false, "npmjs.org": false} {
+		if got := d.Contains(name); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	// A rewrite is picked up; a missing file keeps the last list.
+	if err := os.WriteFile(path, []byte("npmjs.org\n*.example.org\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Contains("npmjs.org") || !d.Contains("cdn.example.org") || d.Contains("github.com") {
+		t.Error("rewritten file not reloaded")
+	}
+	os.Remove(path)
+	if !d.Contains("npmjs.org") {
+		t.Error("missing file dropped the last list")
+	}
+}
@@ -0,0 +1,135 @@
+package egress
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// NormalizeDomain checks that entry is a valid domain or domain pattern and
+// returns it in canonical form: lower-case, without a trailing dot. A pattern must
+// cover a name of at least two labels, so "*.com" is rejected.
+func NormalizeDomain(entry string) (string, error) {
+	d := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry)), ".")
+	host, wildcard := patternBase(d)
+	if host == "" {
+		return "", fmt.Errorf("invalid domain %q", entry)
+	}
+	labels := strings.Split(host, ".")
+	if wildcard && len(labels) < 2 {
+		return "", fmt.Errorf("invalid domain %q: a pattern must name at least a second-level domain", entry)
+	}
+	for _, l := range labels {
+		if !validLabel(l) {
+			return "", fmt.Errorf("invalid domain %q", entry)
+		}
+	}
+	return d, nil
+}
+
+// IsPattern reports whether entry is a "*." or "." pattern rather than a
+// single host name.
+func IsPattern(entry string) bool {
+	_, wildcard := patternBase(entry)
+	return wildcard
+}
+
+// ResolvableDomains returns the names in entries that can be resolved up
+// front: host names as they are, the apex of each "." pattern, and nothing
+// for "*." patterns or addresses. Ports are dropped.
+func ResolvableDomains(entries []string) []string {
+	seen := make(map[string]bool, len(entries))
+	var out []string
+	for _, r := range ParseRules(entries) {
+		if d, ok := r.Resolvable(); ok && !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// DomainSet matches names against a list of allowlist entries. An entry's
+// host is a host name, matched exactly, or one of two patterns:
+//
+//   - "*.example.com" matches any name below example.com, but not
+//     example.com itself.
+//   - ".example.com" matches example.com and any name below it.
+//
+// Matching is case-insensitive and ignores a trailing dot. Patterns can
+// only be enforced by the DNS filter; when domains are resolved up front,
+// ".example.com" allows just example.com and "*.example.com" nothing.
+// Entries for addresses and CIDRs match no names.
+type DomainSet struct {
+	exact    map[string][]Rule
+	suffixes []suffixRule
+}
+
+// suffixRule is a pattern entry, matching names ending in suffix.
+type suffixRule struct {
+	suffix string // ".example.com"
+	rule   Rule
+}
+
+// NewDomainSet returns the set of names allowed by entries. Blank entries,
+// "#" comments and invalid entries are ignored.
+func NewDomainSet(entries []string) *DomainSet {
+	s := &DomainSet{exact: make(map[string][]Rule, len(entries))}
+	for _, r := range ParseRules(entries) {
+		switch h := r.Host; {
+		case r.IsAddr():
+		case strings.HasPrefix(h, "*."):
+			s.suffixes = append(s.suffixes, suffixRule{h[1:], r})
+		case strings.HasPrefix(h, "."):
+			s.exact[h[1:]] = append(s.exact[h[1:]], r)
+			s.suffixes = append(s.suffixes, suffixRule{h, r})
+		default:
+			s.exact[h] = append(s.exact[h], r)
+		}
+	}
+	return s
+}
+
+// Contains reports whether name is allowed.
+func (s *DomainSet) Contains(name string) bool {
+	return len(s.Rules(name)) > 0
+}
+
+// Rules returns the entries that allow name.
+func (s *DomainSet) Rules(name string) []Rule {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	rules := slices.Clone(s.exact[name])
+	for _, sr := range s.suffixes {
+		if strings.HasSuffix(name, sr.suffix) {
+			rules = append(rules, sr.rule)
+		}
+	}
+	return rules
+}
+
+// patternBase returns the host name an entry is built on, and whether the
+// entry is a pattern.
+func patternBase(entry string) (string, bool) {
+	switch {
+	case strings.HasPrefix(entry, "*."):
+		return entry[2:], true
+	case strings.HasPrefix(entry, "."):
+		return entry[1:], true
+	default:
+		return entry, false
+	}
+}
+
+// validLabel reports whether l is a DNS label of letters, digits, hyphens
+// and underscores, not starting or ending with a hyphen.
+func validLabel(l string) bool {
+	if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+		return false
+	}
+	for _, c := range l {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package egress
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "GitHub.com", want: "github.com"},
+		{in: "api.github.com.", want: "api.github.com"},
+		{in: "*.githubusercontent.com", want: "*.githubusercontent.com"},
+		{in: ".amazonaws.com", want: ".amazonaws.com"},
+		{in: "_acme.example.com", want: "_acme.example.com"},
+		{in: "localhost", want: "localhost"},
+		{in: "", wantErr: true},
+		{in: "*.com", wantErr: true},
+		{in: ".com", wantErr: true},
+		{in: "*", wantErr: true},
+		{in: "a.*.example.com", wantErr: true},
+		{in: "foo..com", wantErr: true},
+		{in: "-foo.com", wantErr: true},
+		{in: "foo.com\nbar.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDomain(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeDomain(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDomainSet(t *testing.T) {
+	s := NewDomainSet([]string{"github.com", "*.githubusercontent.com", ".amazonaws.com", "# comment", ""})
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"github.com", true},
+		{"GitHub.com.", true},
+		{"api.github.com", false},
+		{"raw.githubusercontent.com", true},
+		{"a.b.githubusercontent.com", true},
+		{"githubusercontent.com", false},
+		{"evilgithubusercontent.com", false},
+		{"amazonaws.com", true},
+		{"s3.us-east-1.amazonaws.com", true},
+		{"notamazonaws.com", false},
+		{"# comment", false},
+	}
+	for _, tt := range tests {
+		if got := s.Contains(tt.name); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolvableDomains(t *testing.T) {
+	got := ResolvableDomains([]string{"github.com", "*.githubusercontent.com", ".amazonaws.com", "amazonaws.com"})
+	want := []string{"github.com", "amazonaws.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ResolvableDomains = %v, want %v", got, want)
+	}
+}
@@ -1,49 +1,12 @@
 package egress
 
 import (
-	_ "embed"
-	"fmt"
 	"strings"
-
-	"github.com/BurntSushi/toml"
 )
 
-//go:embed presets.toml
-var presetsFile string
-
-type preset struct {
-	Domains []string `toml:"domains"`
-	CIDRs   []string `toml:"cidrs"`
-}
-
-var presets map[string]preset
-
-func init() {
-	if _, err := toml.Decode(presetsFile, &presets); err != nil {
-		panic(fmt.Sprintf("parsing egress presets.toml: %v", err))
-	}
-}
-
-// PresetDomains returns the domain allowlist for a named preset.
-// Returns nil if the preset doesn't exist.
-func PresetDomains(name string) []string {
-	if p, ok := presets[name]; ok {
-		return p.Domains
-	}
-	return nil
-}
-
-// PresetCIDRs returns the CIDR ranges for a named preset.
-// Returns nil if the preset doesn't exist or has no CIDRs.
-func PresetCIDRs(name string) []string {
-	if p, ok := presets[name]; ok {
-		return p.CIDRs
-	}
-	return nil
-}
-
-// ResolveDomains returns the final domain list for the given egress mode.
-// Returns nil for "unrestricted".
+// ResolveDomains returns the final domain list for the given egress mode:
+// the allow list, merged after the mode's presets unless the mode is
+// "allowlist". Returns nil for "unrestricted".
 func ResolveDomains(egress string, allow []string) []string {
 	switch egress {
 	case "unrestricted":
@@ -51,22 +14,7 @@ func ResolveDomains(egress string, allow []string) []string {
 	case "allowlist":
 		return allow
 	default:
-		// Treat as preset name (e.g. "agent").
-		seen := make(map[string]bool)
-		var merged []string
-		for _, d := range PresetDomains(egress) {
-			if !seen[d] {
-				seen[d] = true
-				merged = append(merged, d)
-			}
-		}
-		for _, d := range allow {
-			if !seen[d] {
-				seen[d] = true
-				merged = append(merged, d)
-			}
-		}
-		return merged
+		return unique(PresetDomains(egress), allow)
 	}
 }
 
@@ -83,7 +31,11 @@ func CIDRsFileContent(cidrs []string) string {
 	return strings.Join(cidrs, "\n") + "\n"
 }
 
-// NftablesConf returns the base nftables.conf content.
+// NftablesConf returns the base nftables.conf content. Addresses allowed on
+// any port go in the allowed and dns sets; those allowed on one port go in
+// the allowed_ports and dns_ports sets, keyed by address, protocol and
+// port. DNS may only go to the container's own nameservers, in the
+// resolvers sets.
 func NftablesConf() string {
 	return `#!/usr/sbin/nft -f
 flush ruleset
@@ -94,25 +46,98 @@ table inet pixels_egress {
         flags interval
     }
 
+    set allowed_v6 {
+        type ipv6_addr
+        flags interval
+    }
+
+    set allowed_ports_v4 {
+        type ipv4_addr . inet_proto . inet_service
+        flags interval
+    }
+
+    set allowed_ports_v6 {
+        type ipv6_addr . inet_proto . inet_service
+        flags interval
+    }
+
+    set dns_v4 {
+        type ipv4_addr
+        flags timeout
+    }
+
+    set dns_v6 {
+        type ipv6_addr
+        flags timeout
+    }
+
+    set dns_ports_v4 {
+        type ipv4_addr . inet_proto . inet_service
+        flags timeout
+    }
+
+    set dns_ports_v6 {
+        type ipv6_addr . inet_proto . inet_service
+        flags timeout
+    }
+
+    set resolvers_v4 {
+        type ipv4_addr
+    }
+
+    set resolvers_v6 {
+        type ipv6_addr
+    }
+
+    chain dns {
+        ip daddr @resolvers_v4 accept
+        ip6 daddr @resolvers_v6 accept
+    }
+
     chain output {
         type filter hook output priority 0; policy drop;
 
         oif lo accept
         ct state established,related accept
-        udp dport 53 accept
+        meta l4proto { tcp, udp } th dport 53 jump dns
+        meta l4proto { tcp, udp } th dport 53 log prefix "` + DeniedLogPrefix + `" drop
         udp dport 67-68 accept
+        ip6 daddr ff02::1:2 udp dport 547 accept
+        icmpv6 type { nd-router-solicit, nd-neighbor-solicit, nd-neighbor-advert } accept
         tcp sport 22 accept
 
         ip daddr @allowed_v4 accept
-
-        log prefix "pixels-egress-denied: " drop
+        ip6 daddr @allowed_v6 accept
+        ip daddr @dns_v4 accept
+        ip6 daddr @dns_v6 accept
+        meta l4proto { tcp, udp } ip daddr . meta l4proto . th dport @allowed_ports_v4 accept
+        meta l4proto { tcp, udp } ip6 daddr . meta l4proto . th dport @allowed_ports_v6 accept
+        meta l4proto { tcp, udp } ip daddr . meta l4proto . th dport @dns_ports_v4 accept
+        meta l4proto { tcp, udp } ip6 daddr . meta l4proto . th dport @dns_ports_v6 accept
+
+        log prefix "` + DeniedLogPrefix + `" drop
     }
 }
 `
 }
 
 // ResolveScript returns the shell script that reads /etc/pixels-egress-domains
-// and /etc/pixels-egress-cidrs, and populates the nftables allowed_v4 set.
+// and /etc/pixels-egress-cidrs, and populates the egress ruleset: the
+// container's nameservers, CIDRs, addresses listed in the domains file, and
+// the A and AAAA records of listed domains, each on the ports its entry
+// allows. The allowed sets are filled in a staging table first and swapped
+// in with one nft transaction, so they never hold a partial list.
+//
+// Run with --refresh, it re-resolves the domains into the loaded ruleset
+// instead of reloading it, dropping addresses the names no longer resolve
+// to. A name that resolves to nothing keeps the addresses it had. Applying
+// the rules starts a timer that refreshes them every RefreshInterval, and
+// each run records its result in RefreshStatusFile.
+//
+// If the DNS filter is installed at DNSFilterPath, domains are not resolved
+// up front. Instead the container's resolver is pointed at the filter, only
+// the filter may reach the upstream server, and the filter fills the dns
+// sets as it answers.
 func ResolveScript() string {
 	return `#!/bin/bash
 set -euo pipefail
@@ -120,41 +145,228 @@ set -euo pipefail
 DOMAIN_FILE="/etc/pixels-egress-domains"
 CIDR_FILE="/etc/pixels-egress-cidrs"
 NFT_CONF="/etc/nftables.conf"
+ELEMENTS="/var/lib/pixels-egress/elements"
+` + startDNSFilterFunc + refreshFuncs + `
+refresh=""
+[ "${1:-}" = "--refresh" ] && refresh=1
 
 if [ ! -f "$DOMAIN_FILE" ]; then
     echo "No domain file found, skipping egress setup"
+    if [ -n "$refresh" ]; then
+        stop_refresh
+        record_refresh ` + RefreshSkipped + ` "no domain file"
+    fi
     exit 0
 fi
 
-# Load the base ruleset (creates table and empty set).
-nft -f "$NFT_CONF"
+filter=""
+if [ -x "$DNS_FILTER" ] && "$DNS_FILTER" egress-dns --help >/dev/null 2>&1; then
+    filter=1
+fi
+if [ -n "$refresh" ]; then
+    if [ -n "$filter" ]; then
+        stop_refresh
+        record_refresh ` + RefreshSkipped + ` "names are allowed by the DNS filter"
+        exit 0
+    fi
+    if ! nft list table inet pixels_egress >/dev/null 2>&1; then
+        record_refresh ` + RefreshFailed + ` "egress ruleset not loaded"
+        echo "Egress ruleset not loaded, not refreshing" >&2
+        exit 1
+    fi
+else
+    # Load the base ruleset (creates table and empty sets).
+    nft -f "$NFT_CONF"
+fi
+
+work=$(mktemp -d)
+trap 'nft delete table inet pixels_egress_stage 2>/dev/null || true; rm -rf "$work"' EXIT
+mkdir -p "$(dirname "$ELEMENTS")"
+touch "$ELEMENTS" "$work/staged"
+nft delete table inet pixels_egress_stage 2>/dev/null || true
+nft -f - <<'NFT'
+` + stageTable + `NFT
+
+# setfor prints the set of the family of address or CIDR $2 named $1.
+setfor() {
+    case "$2" in
+        *:*) echo "$1_v6" ;;
+        *) echo "$1_v4" ;;
+    esac
+}
+
+# stage adds element $2 to the staging copy of set $1, unless it overlaps
+# an element already there, and notes that it came from entry $src.
+stage() {
+    if ! grep -qxF "$1 $2" "$work/staged"; then
+        nft add element inet pixels_egress_stage "$1" "{ $2 }" 2>/dev/null || return 0
+        echo "$1 $2" >> "$work/staged"
+    fi
+    echo "$src $1 $2" >> "$work/elements"
+}
+
+# allow stages address or CIDR $1 on $port and $proto, as parsed by
+# parse_entry, or on any port.
+allow() {
+    if [ -z "$port" ]; then
+        stage "$(setfor allowed "$1")" "$1"
+        return
+    fi
+    for p in ${proto:-tcp udp}; do
+        stage "$(setfor allowed_ports "$1")" "$1 . $p . $port"
+    done
+}
+
+# parse_entry splits a domains file entry, "host[:port][/proto]" with IPv6
+# hosts in brackets before a port, into host, port and proto.
+parse_entry() {
+    host="$1" port="" proto=""
+    case "$host" in
+        */tcp|*/udp) proto="${host##*/}"; host="${host%/*}" ;;
+    esac
+    if [[ "$host" == \[*\]:* ]]; then
+        port="${host##*]:}"
+        host="${host#[}"
+        host="${host%%]*}"
+    elif [[ "$host" == *:* && "$host" != *:*:* ]]; then
+        port="${host##*:}"
+        host="${host%:*}"
+    fi
+}
+
+# DNS may only go to the container's nameservers.
+for ns in $(nameservers); do
+    nft add element inet pixels_egress "$(setfor resolvers "$ns")" "{ $ns }" 2>/dev/null || true
+done
 
 # Add CIDR ranges first (CDN providers with rotating IPs).
+src="-"
 if [ -f "$CIDR_FILE" ]; then
+    port="" proto=""
     while IFS= read -r cidr || [ -n "$cidr" ]; do
         cidr=$(echo "$cidr" | xargs)
         [ -z "$cidr" ] && continue
         [[ "$cidr" == \#* ]] && continue
-        nft add element inet pixels_egress allowed_v4 "{ $cidr }" 2>/dev/null || true
+        allow "$cidr"
     done < "$CIDR_FILE"
 fi
 
-# Resolve each domain and add IPs to the allowed set.
-while IFS= read -r domain || [ -n "$domain" ]; do
-    domain=$(echo "$domain" | xargs)
-    [ -z "$domain" ] && continue
-    [[ "$domain" == \#* ]] && continue
-
-    ips=$(getent ahostsv4 "$domain" 2>/dev/null | awk '{print $1}' | sort -u || true)
+# Allow listed addresses, and resolve each domain unless the DNS filter
+# will.
+unresolved=""
+while IFS= read -r entry || [ -n "$entry" ]; do
+    entry=$(echo "$entry" | xargs)
+    [ -z "$entry" ] && continue
+    [[ "$entry" == \#* ]] && continue
+    parse_entry "$entry"
+
+    if [[ "$host" == *:* || "$host" =~ ^[0-9./]+$ ]]; then
+        src="-"
+        allow "$host"
+        continue
+    fi
+    [ -n "$filter" ] && continue
+
+    # Only the DNS filter can follow patterns: "*.x" is skipped and ".x"
+    # allows just x.
+    [[ "$host" == \** ]] && continue
+    host="${host#.}"
+    src="$host"
+
+    # ahostsv6 maps A records to ::ffff:a.b.c.d when there is no AAAA; those
+    # are already covered by ahostsv4.
+    ips=$( { getent ahostsv4 "$host"; getent ahostsv6 "$host"; } 2>/dev/null | awk '{print $1}' | grep -vi '^::ffff:' | sort -u || true)
     for ip in $ips; do
-        nft add element inet pixels_egress allowed_v4 "{ $ip }" 2>/dev/null || true
+        allow "$ip"
     done
+
+    # A name that no longer resolves (or whose resolver is down) keeps the
+    # addresses it had rather than losing access.
+    if [ -z "$ips" ] && [ -n "$refresh" ]; then
+        unresolved="${unresolved:+$unresolved }$host"
+        while read -r set elem; do
+            stage "$set" "$elem"
+        done < <(awk -v h="$host" '$1 == h { $1 = ""; sub(/^ /, ""); print }' "$ELEMENTS")
+    fi
 done < "$DOMAIN_FILE"
 
+# Swap the staged elements into the allowed sets in one transaction.
+{
+    for set in allowed_v4 allowed_v6 allowed_ports_v4 allowed_ports_v6; do
+        echo "flush set inet pixels_egress $set"
+    done
+    while read -r set elem; do
+        echo "add element inet pixels_egress $set { $elem }"
+    done < "$work/staged"
+    echo "delete table inet pixels_egress_stage"
+} > "$work/batch"
+if ! out=$(nft -f "$work/batch" 2>&1); then
+    record_refresh ` + RefreshFailed + ` "$(echo "$out" | head -n 1)"
+    echo "$out" >&2
+    exit 1
+fi
+
+touch "$work/elements"
+cut -d' ' -f2- "$ELEMENTS" | sort -u > "$work/old"
+sort -u "$work/staged" > "$work/new"
+added=$(comm -13 "$work/old" "$work/new" | wc -l)
+removed=$(comm -23 "$work/old" "$work/new" | wc -l)
+elements=$(wc -l < "$work/new")
+mv "$work/elements" "$ELEMENTS"
+
+# With the DNS filter, only it (running as root) may query the upstream
+# server, and the container resolves through it.
+if [ -n "$filter" ]; then
+    nft flush chain inet pixels_egress dns
+    nft add rule inet pixels_egress dns meta skuid 0 ip daddr @resolvers_v4 accept
+    nft add rule inet pixels_egress dns meta skuid 0 ip6 daddr @resolvers_v6 accept
+
+    start_dns_filter
+    stop_refresh
+    record_refresh ` + RefreshOK + ` "names are allowed by the DNS filter"
+
+    echo "Egress rules loaded (DNS filter)"
+    exit 0
+fi
+
+if [ -n "$refresh" ]; then
+    record_refresh ` + RefreshOK + ` ""
+    echo "Egress rules refreshed: $added added, $removed removed"
+    exit 0
+fi
+record_refresh ` + RefreshOK + ` ""
+start_refresh
+
 echo "Egress rules loaded"
 `
 }
 
+// stageTable is the table the resolve script fills before swapping its
+// sets' elements into the egress ruleset. It has no chains, so it filters
+// nothing.
+const stageTable = `table inet pixels_egress_stage {
+    set allowed_v4 {
+        type ipv4_addr
+        flags interval
+    }
+
+    set allowed_v6 {
+        type ipv6_addr
+        flags interval
+    }
+
+    set allowed_ports_v4 {
+        type ipv4_addr . inet_proto . inet_service
+        flags interval
+    }
+
+    set allowed_ports_v6 {
+        type ipv6_addr . inet_proto . inet_service
+        flags interval
+    }
+}
+`
+
 // SafeAptScript returns a wrapper script that sanitizes apt-get arguments,
 // blocking -o flags (which allow arbitrary command execution via Pre-Invoke)
 // and restricting to safe subcommands.
@@ -1,6 +1,7 @@
 package egress
 
 import (
+	"net/netip"
 	"strings"
 	"testing"
 )
@@ -84,9 +85,37 @@ func TestNftablesConf(t *testing.T) {
 	if !strings.Contains(conf, "@allowed_v4") {
 		t.Error("missing allowed_v4 set reference")
 	}
+	if !strings.Contains(conf, "ip6 daddr @allowed_v6 accept") {
+		t.Error("missing allowed_v6 set reference")
+	}
+	if !strings.Contains(conf, "nd-neighbor-solicit") {
+		t.Error("missing IPv6 neighbor discovery rule")
+	}
 	if !strings.Contains(conf, "oif lo accept") {
 		t.Error("missing loopback rule")
 	}
+	if !strings.Contains(conf, "ip daddr @dns_v4 accept") || !strings.Contains(conf, "ip6 daddr @dns_v6 accept") {
+		t.Error("missing DNS filter set references")
+	}
+	if !strings.Contains(conf, "jump dns") {
+		t.Error("DNS traffic not routed through the dns chain")
+	}
+	if !strings.Contains(conf, "ip daddr @resolvers_v4 accept") || !strings.Contains(conf, `th dport 53 log prefix "`+DeniedLogPrefix+`" drop`) {
+		t.Error("DNS not limited to the container's resolvers")
+	}
+	if !strings.Contains(conf, "ip daddr . meta l4proto . th dport @allowed_ports_v4 accept") || !strings.Contains(conf, "@dns_ports_v6 accept") {
+		t.Error("missing port set references")
+	}
+	// DHCPv6 is only open to the servers' multicast group, not to port 547
+	// anywhere.
+	if !strings.Contains(conf, "ip6 daddr ff02::1:2 udp dport 547 accept") {
+		t.Error("missing DHCPv6 rule")
+	}
+	for _, line := range strings.Split(conf, "\n") {
+		if strings.TrimSpace(line) == "udp dport 547 accept" {
+			t.Error("DHCPv6 port open to every address")
+		}
+	}
 }
 
 func TestResolveScript(t *testing.T) {
@@ -100,6 +129,40 @@ func TestResolveScript(t *testing.T) {
 	if !strings.Contains(script, "nft") {
 		t.Error("missing nft command")
 	}
+	if !strings.Contains(script, "getent ahostsv6") || !strings.Contains(script, `*:*) echo "$1_v6"`) {
+		t.Error("missing AAAA resolution into the v6 sets")
+	}
+	if !strings.Contains(script, "setfor allowed_ports") || !strings.Contains(script, "setfor resolvers") {
+		t.Error("missing port rules or resolvers")
+	}
+	if !strings.Contains(script, `DNS_FILTER="`+DNSFilterPath+`"`) || !strings.Contains(script, "dns meta skuid 0 ip daddr @resolvers_v4 accept") {
+		t.Error("missing DNS filter setup")
+	}
+	if !strings.Contains(script, "flush set inet pixels_egress $set") || !strings.Contains(script, `nft -f "$work/batch"`) {
+		t.Error("allowed sets not swapped in one transaction")
+	}
+	if !strings.Contains(script, `"${1:-}" = "--refresh"`) || !strings.Contains(script, "start_refresh") || !strings.Contains(script, "record_refresh") {
+		t.Error("missing periodic refresh")
+	}
+}
+
+func TestPresetCIDRs(t *testing.T) {
+	var v4, v6 int
+	for _, c := range PresetCIDRs("agent") {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			t.Errorf("invalid CIDR %q: %v", c, err)
+			continue
+		}
+		if p.Addr().Is4() {
+			v4++
+		} else {
+			v6++
+		}
+	}
+	if v4 == 0 || v6 == 0 {
+		t.Errorf("agent preset has %d IPv4 and %d IPv6 CIDRs, want both", v4, v6)
+	}
 }
 
 func TestDomainsFileContent(t *testing.T) {
@@ -0,0 +1,333 @@
+package egress
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// LearnFile marks a container in learn mode. It holds the domain list the
+// container had before, which suggestions are compared against.
+const LearnFile = "/etc/pixels-egress-learn"
+
+// LearnNftablesConf returns the nftables.conf for learn mode: all egress is
+// accepted, and the destination, protocol and port of each new TCP or UDP
+// connection are recorded in the learned_v4 and learned_v6 sets.
+func LearnNftablesConf() string {
+	return `#!/usr/sbin/nft -f
+flush ruleset
+
+table inet pixels_egress {
+    set learned_v4 {
+        type ipv4_addr . inet_proto . inet_service
+        flags dynamic
+        size 65536
+    }
+
+    set learned_v6 {
+        type ipv6_addr . inet_proto . inet_service
+        flags dynamic
+        size 65536
+    }
+
+    chain output {
+        type filter hook output priority 0; policy accept;
+
+        oif lo accept
+        ct state new meta l4proto { tcp, udp } add @learned_v4 { ip daddr . meta l4proto . th dport }
+        ct state new meta l4proto { tcp, udp } add @learned_v6 { ip6 daddr . meta l4proto . th dport }
+    }
+}
+`
+}
+
+// LearnScript returns the script that puts a container in learn mode. It is
+// installed in place of the resolve script, so whatever re-applies egress
+// rules re-applies learn mode instead. If the DNS filter is installed, it
+// is started answering every name, so its log records what each address
+// was resolved from. Nothing is resolved in learn mode, so it stops the
+// refresh timer and does nothing when run with --refresh.
+func LearnScript() string {
+	return `#!/bin/bash
+set -euo pipefail
+
+NFT_CONF="/etc/nftables.conf"
+` + startDNSFilterFunc + refreshFuncs + `
+stop_refresh
+record_refresh ` + RefreshSkipped + ` "learn mode"
+[ "${1:-}" = "--refresh" ] && exit 0
+
+nft -f "$NFT_CONF"
+
+if [ -x "$DNS_FILTER" ] && "$DNS_FILTER" egress-dns --help >/dev/null 2>&1; then
+    start_dns_filter --learn
+fi
+
+echo "Egress learn mode enabled"
+`
+}
+
+// LearnedScript returns a shell script, run as root inside a container in
+// learn mode, that prints everything ParseLearned needs: the learned sets
+// as nftables JSON (J lines), and the DNS filter's log and resolver cache
+// as for DenialLogScript.
+func LearnedScript() string {
+	return `set -u
+for set in learned_v4 learned_v6; do
+    printf 'J %s\n' "$(nft -j list set inet pixels_egress "$set" 2>/dev/null | tr -d '\n')"
+done
+journalctl -u pixels-egress-dns --no-pager -q -o cat 2>/dev/null | sed 's/^/D /' || true
+` + resolverLogTail
+}
+
+// resolverLogTail prints the DNS filter's log file and the systemd-resolved
+// cache, for scripts whose output is read with a nameIndex.
+const resolverLogTail = `[ -f /var/log/pixels-egress-dns.log ] && sed 's/^/D /' /var/log/pixels-egress-dns.log
+command -v resolvectl >/dev/null && resolvectl show-cache 2>/dev/null | sed 's/^/C /'
+true
+`
+
+// Destination is one address, protocol and port a container connected to.
+type Destination struct {
+	Host  string `json:"host,omitempty"` // name Addr was resolved from, if known
+	Addr  string `json:"addr"`
+	Proto string `json:"proto"` // "tcp" or "udp"
+	Port  int    `json:"port"`
+}
+
+// ParseLearned parses the output of LearnedScript into the destinations
+// recorded in learn mode, with addresses mapped to the names they were
+// resolved from.
+func ParseLearned(out []byte) []Destination {
+	var dests []Destination
+	names := newNameIndex()
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		kind, line, _ := strings.Cut(sc.Text(), " ")
+		switch kind {
+		case "J":
+			dests = append(dests, parseLearnedSet(line)...)
+		default:
+			names.add(kind, line)
+		}
+	}
+	for i := range dests {
+		dests[i].Host = names.lookup(dests[i].Addr)
+	}
+	slices.SortFunc(dests, func(a, b Destination) int {
+		return cmp.Or(cmp.Compare(a.Host, b.Host), cmp.Compare(a.Addr, b.Addr),
+			cmp.Compare(a.Proto, b.Proto), cmp.Compare(a.Port, b.Port))
+	})
+	return slices.Compact(dests)
+}
+
+// parseLearnedSet reads the elements of a learned set from `nft -j list
+// set` output. Elements are concatenations of address, protocol and port,
+// bare or wrapped in an "elem" object when the set has timeouts.
+func parseLearnedSet(js string) []Destination {
+	var doc struct {
+		Nftables []struct {
+			Set *struct {
+				Elem []json.RawMessage `json:"elem"`
+			} `json:"set"`
+		} `json:"nftables"`
+	}
+	if json.Unmarshal([]byte(js), &doc) != nil {
+		return nil
+	}
+	var dests []Destination
+	for _, item := range doc.Nftables {
+		if item.Set == nil {
+			continue
+		}
+		for _, raw := range item.Set.Elem {
+			var e struct {
+				Concat []any `json:"concat"`
+				Elem   *struct {
+					Val struct {
+						Concat []any `json:"concat"`
+					} `json:"val"`
+				} `json:"elem"`
+			}
+			if json.Unmarshal(raw, &e) != nil {
+				continue
+			}
+			parts := e.Concat
+			if e.Elem != nil {
+				parts = e.Elem.Val.Concat
+			}
+			if d, ok := learnedDestination(parts); ok {
+				dests = append(dests, d)
+			}
+		}
+	}
+	return dests
+}
+
+func learnedDestination(parts []any) (Destination, bool) {
+	if len(parts) != 3 {
+		return Destination{}, false
+	}
+	addrStr, _ := parts[0].(string)
+	addr, err := netip.ParseAddr(addrStr)
+	if err != nil {
+		return Destination{}, false
+	}
+	proto, port, ok := protoPort(parts[1], parts[2])
+	if !ok {
+		return Destination{}, false
+	}
+	return Destination{Addr: addr.String(), Proto: proto, Port: port}, true
+}
+
+// protoPort reads the protocol and port of a set element, where nft gives
+// the protocol by name or number.
+func protoPort(protoVal, portVal any) (proto string, port int, ok bool) {
+	switch p := protoVal.(type) {
+	case string:
+		proto = p
+	case float64:
+		proto = map[float64]string{6: "tcp", 17: "udp"}[p]
+	}
+	n, ok := portVal.(float64)
+	if proto == "" || !ok {
+		return "", 0, false
+	}
+	return proto, int(n), true
+}
+
+// nameIndex maps addresses back to the names they were resolved from, from
+// the DNS filter's log (D lines) and the systemd-resolved cache (C lines).
+type nameIndex struct {
+	names  map[string]string // address -> name
+	cnames map[string]string // CNAME target -> alias
+}
+
+func newNameIndex() *nameIndex {
+	return &nameIndex{names: map[string]string{}, cnames: map[string]string{}}
+}
+
+// add records what a D or C line says; other lines are ignored. The DNS
+// filter's answers take precedence over the resolver cache.
+func (n *nameIndex) add(kind, line string) {
+	switch kind {
+	case "D":
+		if kv := logFields(line); kv["msg"] == "allowed" && kv["addr"] != "" {
+			n.names[kv["addr"]] = kv["name"]
+		}
+	case "C":
+		f := strings.Fields(line)
+		if len(f) < 4 || f[1] != "IN" {
+			return
+		}
+		name := strings.TrimSuffix(f[0], ".")
+		switch f[2] {
+		case "A", "AAAA":
+			if addr, err := netip.ParseAddr(f[3]); err == nil {
+				if _, ok := n.names[addr.String()]; !ok {
+					n.names[addr.String()] = name
+				}
+			}
+		case "CNAME":
+			n.cnames[strings.TrimSuffix(f[3], ".")] = name
+		}
+	}
+}
+
+// lookup returns the name addr was resolved from, following CNAMEs back to
+// the name that was asked for, or "" if it isn't known.
+func (n *nameIndex) lookup(addr string) string {
+	name := n.names[addr]
+	for range 8 {
+		alias, ok := n.cnames[name]
+		if !ok {
+			break
+		}
+		name = alias
+	}
+	return name
+}
+
+// Suggestion is one line of a proposed allowlist.
+type Suggestion struct {
+	Entry  string   `json:"entry"`           // domain, or address for destinations with no name
+	Ports  []string `json:"ports,omitempty"` // observed "port/proto", e.g. "443/tcp"
+	Status string   `json:"status"`          // SuggestAdd, SuggestKeep, SuggestRemove or SuggestUnnamed
+}
+
+// Suggestion statuses.
+const (
+	SuggestAdd     = "add"     // used, and not allowed by the current list
+	SuggestKeep    = "keep"    // used, and already allowed
+	SuggestRemove  = "remove"  // on the current list, but not used
+	SuggestUnnamed = "unnamed" // used, but with no name to allow
+)
+
+// Suggest proposes an allowlist from the destinations seen in learn mode,
+// compared against the current list. DNS, DHCP and DHCPv6, which every
+// policy allows, are left out.
+func Suggest(current []string, dests []Destination) []Suggestion {
+	set := NewDomainSet(current)
+	byEntry := map[string]*Suggestion{}
+	var out []*Suggestion
+	used := map[string]bool{} // current entries something matched
+	for _, d := range dests {
+		if d.Proto == "udp" && slices.Contains([]int{53, 67, 68, 547}, d.Port) || d.Proto == "tcp" && d.Port == 53 {
+			continue
+		}
+		entry, status := d.Host, SuggestAdd
+		switch {
+		case entry == "":
+			entry, status = d.Addr, SuggestUnnamed
+		case set.Contains(entry):
+			status = SuggestKeep
+			for _, c := range current {
+				if NewDomainSet([]string{c}).Contains(entry) {
+					used[c] = true
+				}
+			}
+		}
+		s, ok := byEntry[entry]
+		if !ok {
+			s = &Suggestion{Entry: entry, Status: status}
+			byEntry[entry] = s
+			out = append(out, s)
+		}
+		if p := fmt.Sprintf("%d/%s", d.Port, d.Proto); !slices.Contains(s.Ports, p) {
+			s.Ports = append(s.Ports, p)
+		}
+	}
+	for _, c := range current {
+		if !used[c] {
+			out = append(out, &Suggestion{Entry: c, Status: SuggestRemove})
+		}
+	}
+
+	result := make([]Suggestion, len(out))
+	for i, s := range out {
+		result[i] = *s
+	}
+	return result
+}
+
+// Proposed returns the allowlist suggestions propose: the entries of
+// current that were used, then the names to add.
+func Proposed(current []string, suggestions []Suggestion) []string {
+	var removed, added []string
+	for _, s := range suggestions {
+		switch s.Status {
+		case SuggestRemove:
+			removed = append(removed, s.Entry)
+		case SuggestAdd:
+			added = append(added, s.Entry)
+		}
+	}
+	domains := slices.DeleteFunc(slices.Clone(current), func(d string) bool { return slices.Contains(removed, d) })
+	return append(domains, added...)
+}
@@ -0,0 +1,56 @@
+package egress
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseLearned(t *testing.T) {
+	out := []byte(`J {"nftables": [{"metainfo": {"version": "1.0.9"}}, {"set": {"family": "inet", "name": "learned_v4", "table": "pixels_egress", "type": ["ipv4_addr", "inet_proto", "inet_service"], "flags": ["dynamic"], "elem": [{"concat": ["140.82.112.3", "tcp", 443]}, {"concat": ["151.101.0.223", "tcp", 443]}, {"concat": ["203.0.113.7", 17, 3478]}, {"elem": {"val": {"concat": ["140.82.112.3", "tcp", 22]}, "timeout": 3600}}]}}]}
+J {"nftables": [{"set": {"family": "inet", "name": "learned_v6", "table": "pixels_egress", "elem": [{"concat": ["2a04:4e42:0:0:0:0:0:223", "tcp", 443]}]}}]}
+D time=2026-10-16T09:00:00.000Z level=INFO msg=allowed name=pypi.org addr=151.101.0.223
+D time=2026-10-16T09:00:00.000Z level=INFO msg=allowed name=pypi.org addr=2a04:4e42::223
+C github.com IN A 140.82.112.3
+`)
+	got := ParseLearned(out)
+	want := []Destination{
+		{Addr: "203.0.113.7", Proto: "udp", Port: 3478},
+		{Host: "github.com", Addr: "140.82.112.3", Proto: "tcp", Port: 22},
+		{Host: "github.com", Addr: "140.82.112.3", Proto: "tcp", Port: 443},
+		{Host: "pypi.org", Addr: "151.101.0.223", Proto: "tcp", Port: 443},
+		{Host: "pypi.org", Addr: "2a04:4e42::223", Proto: "tcp", Port: 443},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseLearned =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	current := []string{"github.com", "*.githubusercontent.com", "npmjs.org"}
+	dests := []Destination{
+		{Host: "github.com", Addr: "140.82.112.3", Proto: "tcp", Port: 443},
+		{Host: "github.com", Addr: "140.82.112.4", Proto: "tcp", Port: 22},
+		{Host: "raw.githubusercontent.com", Addr: "185.199.108.133", Proto: "tcp", Port: 443},
+		{Host: "pypi.org", Addr: "151.101.0.223", Proto: "tcp", Port: 443},
+		{Addr: "203.0.113.7", Proto: "udp", Port: 3478},
+		{Addr: "10.0.0.1", Proto: "udp", Port: 53},
+	}
+	got := Suggest(current, dests)
+	want := []Suggestion{
+		{Entry: "github.com", Ports: []string{"443/tcp", "22/tcp"}, Status: SuggestKeep},
+		{Entry: "raw.githubusercontent.com", Ports: []string{"443/tcp"}, Status: SuggestKeep},
+		{Entry: "pypi.org", Ports: []string{"443/tcp"}, Status: SuggestAdd},
+		{Entry: "203.0.113.7", Ports: []string{"3478/udp"}, Status: SuggestUnnamed},
+		{Entry: "npmjs.org", Status: SuggestRemove},
+	}
+	if !slices.EqualFunc(got, want, func(a, b Suggestion) bool {
+		return a.Entry == b.Entry && a.Status == b.Status && slices.Equal(a.Ports, b.Ports)
+	}) {
+		t.Errorf("Suggest =\n%v\nwant\n%v", got, want)
+	}
+
+	proposed := Proposed(current, got)
+	if want := []string{"github.com", "*.githubusercontent.com", "pypi.org"}; !slices.Equal(proposed, want) {
+		t.Errorf("Proposed = %v, want %v", proposed, want)
+	}
+}
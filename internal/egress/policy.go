@@ -0,0 +1,80 @@
+package egress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// ErrNoRecord means a container's policy record is missing where one was
+// written, so there is nothing to check its egress against.
+var ErrNoRecord = errors.New("egress policy record missing")
+
+// NewPolicy returns the policy record for mode with allow, the configured
+// extra entries, on top of its presets.
+func NewPolicy(mode sandbox.EgressMode, allow []string) sandbox.Policy {
+	p := sandbox.Policy{Version: sandbox.PolicyVersion, Mode: mode}
+	switch mode {
+	case sandbox.EgressUnrestricted, sandbox.EgressLearn:
+		return p
+	case sandbox.EgressAllowlist:
+	default:
+		p.Presets = strings.Split(string(mode), ",")
+	}
+	preset := PresetDomains(string(mode))
+	for _, a := range allow {
+		if !slices.Contains(preset, a) && !slices.Contains(p.Allow, a) {
+			p.Allow = append(p.Allow, a)
+		}
+	}
+	p.Domains = ResolveDomains(string(mode), allow)
+	p.CIDRs = PresetCIDRs(string(mode))
+	return p
+}
+
+// LearnPolicy returns the policy record for switching to learn mode from
+// prev, which is kept for suggestions to be compared against. A container
+// already learning keeps the list it had before.
+func LearnPolicy(prev *sandbox.Policy) sandbox.Policy {
+	p := sandbox.Policy{Version: sandbox.PolicyVersion, Mode: sandbox.EgressLearn}
+	if prev != nil && prev.Mode != sandbox.EgressUnrestricted {
+		p = *UpgradePolicy(prev)
+		p.Mode = sandbox.EgressLearn
+	}
+	return p
+}
+
+// UpgradePolicy returns p as a current record. A policy applied before
+// records were kept is taken to be an allowlist of its domains.
+func UpgradePolicy(p *sandbox.Policy) *sandbox.Policy {
+	if p.Version != 0 {
+		return p
+	}
+	up := sandbox.Policy{Version: sandbox.PolicyVersion, Mode: p.Mode, Domains: p.Domains}
+	if p.Mode != sandbox.EgressUnrestricted {
+		up.Allow = slices.Clone(p.Domains)
+	}
+	return &up
+}
+
+// MarshalPolicy encodes p for storage.
+func MarshalPolicy(p sandbox.Policy) []byte {
+	b, _ := json.MarshalIndent(p, "", "  ")
+	return append(b, '\n')
+}
+
+// ParsePolicy decodes a policy record written by MarshalPolicy.
+func ParsePolicy(data []byte) (*sandbox.Policy, error) {
+	var p sandbox.Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing egress policy: %w", err)
+	}
+	if p.Version < 1 || p.Version > sandbox.PolicyVersion {
+		return nil, fmt.Errorf("parsing egress policy: unsupported version %d", p.Version)
+	}
+	return &p, nil
+}
@@ -0,0 +1,60 @@
+package egress
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestNewPolicy(t *testing.T) {
+	agent := PresetDomains("agent")
+	p := NewPolicy("agent", []string{agent[0], "example.com"})
+	if p.Version != sandbox.PolicyVersion || !slices.Equal(p.Presets, []string{"agent"}) {
+		t.Errorf("NewPolicy(agent) = %+v", p)
+	}
+	if !slices.Equal(p.Allow, []string{"example.com"}) {
+		t.Errorf("Allow = %v, want only the entry not in the preset", p.Allow)
+	}
+	if len(p.Domains) != len(agent)+1 || len(p.CIDRs) == 0 {
+		t.Errorf("Domains = %v, CIDRs = %v", p.Domains, p.CIDRs)
+	}
+
+	p.Remove(agent[0])
+	p.Remove("example.com")
+	p.Add("db.internal")
+	if !slices.Equal(p.Deny, []string{agent[0]}) || !slices.Equal(p.Allow, []string{"db.internal"}) {
+		t.Errorf("after edits Allow = %v, Deny = %v", p.Allow, p.Deny)
+	}
+	p.Add(agent[0])
+	if len(p.Deny) != 0 {
+		t.Errorf("re-adding a preset entry left Deny = %v", p.Deny)
+	}
+
+	got, err := ParsePolicy(MarshalPolicy(p))
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	if got.Mode != p.Mode || !slices.Equal(got.Domains, p.Domains) || !slices.Equal(got.Allow, p.Allow) {
+		t.Errorf("round trip = %+v, want %+v", got, p)
+	}
+	if _, err := ParsePolicy([]byte(`{"version": 99, "mode": "agent"}`)); err == nil {
+		t.Error("ParsePolicy accepted a newer version")
+	}
+}
+
+func TestUpgradePolicy(t *testing.T) {
+	old := &sandbox.Policy{Mode: sandbox.EgressAllowlist, Domains: []string{"github.com"}}
+	p := UpgradePolicy(old)
+	if p.Version != sandbox.PolicyVersion || !slices.Equal(p.Allow, old.Domains) {
+		t.Errorf("UpgradePolicy = %+v", p)
+	}
+
+	learn := LearnPolicy(p)
+	if learn.Mode != sandbox.EgressLearn || !slices.Equal(learn.Domains, old.Domains) {
+		t.Errorf("LearnPolicy = %+v, want the allowlist kept", learn)
+	}
+	if got := LearnPolicy(&learn); !slices.Equal(got.Domains, old.Domains) {
+		t.Errorf("LearnPolicy while learning = %+v", got)
+	}
+}
@@ -0,0 +1,223 @@
+package egress
+
+import (
+	_ "embed"
+	"fmt"
+	"maps"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+//go:embed presets.toml
+var presetsFile string
+
+// Preset is a named set of allowlist entries. Extends names other presets
+// whose entries it includes.
+type Preset struct {
+	Domains []string `toml:"domains"`
+	CIDRs   []string `toml:"cidrs"`
+	Extends []string `toml:"extends"`
+}
+
+var (
+	presets     map[string]Preset // built in, from presets.toml
+	userPresets map[string]Preset // defined in config; see SetUserPresets
+)
+
+func init() {
+	if _, err := toml.Decode(presetsFile, &presets); err != nil {
+		panic(fmt.Sprintf("parsing egress presets.toml: %v", err))
+	}
+	for name, p := range presets {
+		for _, d := range p.Domains {
+			if _, err := NormalizeRule(d); err != nil {
+				panic(fmt.Sprintf("egress preset %s: %v", name, err))
+			}
+		}
+	}
+}
+
+// presetName is the form of a preset name. Commas separate presets in an
+// egress mode, so names can't contain them.
+var presetName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// SetUserPresets validates the presets defined in config and makes them
+// available alongside the built-in ones, replacing any set before. Names
+// may not shadow a built-in preset or egress mode, extends must name known
+// presets without forming a cycle, and entries are stored in canonical
+// form.
+func SetUserPresets(defs map[string]Preset) error {
+	user := make(map[string]Preset, len(defs))
+	names := slices.Sorted(maps.Keys(defs))
+	for _, name := range names {
+		def := defs[name]
+		switch _, builtin := presets[name]; {
+		case !presetName.MatchString(name):
+			return fmt.Errorf("preset %q: name must be lower-case letters, digits, - and _", name)
+		case name == "unrestricted" || name == "allowlist" || name == "learn":
+			return fmt.Errorf("preset %q: name is an egress mode", name)
+		case builtin:
+			return fmt.Errorf("preset %q: name is a built-in preset", name)
+		}
+
+		p := Preset{Extends: def.Extends}
+		for _, d := range def.Domains {
+			entry, err := NormalizeRule(d)
+			if err != nil {
+				return fmt.Errorf("preset %q: %w", name, err)
+			}
+			p.Domains = append(p.Domains, entry)
+		}
+		for _, c := range def.CIDRs {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(c))
+			if err != nil {
+				return fmt.Errorf("preset %q: invalid CIDR %q", name, c)
+			}
+			p.CIDRs = append(p.CIDRs, prefix.Masked().String())
+		}
+		for _, e := range def.Extends {
+			if _, ok := presets[e]; !ok {
+				if _, ok := defs[e]; !ok {
+					return fmt.Errorf("preset %q: extends unknown preset %q", name, e)
+				}
+			}
+		}
+		user[name] = p
+	}
+	for _, name := range names {
+		if err := checkExtends(user, name, nil); err != nil {
+			return err
+		}
+	}
+	userPresets = user
+	return nil
+}
+
+// checkExtends reports an error if following name's extends through defs
+// leads back to a preset already on path.
+func checkExtends(defs map[string]Preset, name string, path []string) error {
+	path = append(slices.Clip(path), name)
+	for _, e := range defs[name].Extends {
+		if slices.Contains(path, e) {
+			return fmt.Errorf("preset %q: extends cycle %s -> %s", path[0], strings.Join(path, " -> "), e)
+		}
+		if err := checkExtends(defs, e, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LookupPreset returns the definition of a built-in or user preset, with
+// extends left unexpanded.
+func LookupPreset(name string) (Preset, bool) {
+	if p, ok := presets[name]; ok {
+		return p, true
+	}
+	p, ok := userPresets[name]
+	return p, ok
+}
+
+// IsBuiltinPreset reports whether name is a preset shipped with pixels
+// rather than defined in config.
+func IsBuiltinPreset(name string) bool {
+	_, ok := presets[name]
+	return ok
+}
+
+// PresetNames returns the names of all built-in and user presets, sorted.
+func PresetNames() []string {
+	names := slices.Collect(maps.Keys(presets))
+	names = append(names, slices.Collect(maps.Keys(userPresets))...)
+	slices.Sort(names)
+	return names
+}
+
+// expandPresets returns the entries of the presets in names, a
+// comma-separated list such as "agent,rust". Each preset's extends come
+// before its own entries, and duplicates are dropped. ok is false if any
+// preset doesn't exist.
+func expandPresets(names string) (p Preset, ok bool) {
+	seen := map[string]bool{}
+	var walk func(name string) bool
+	walk = func(name string) bool {
+		if seen[name] {
+			return true
+		}
+		seen[name] = true
+		def, ok := LookupPreset(name)
+		if !ok {
+			return false
+		}
+		for _, e := range def.Extends {
+			if !walk(e) {
+				return false
+			}
+		}
+		p.Domains = append(p.Domains, def.Domains...)
+		p.CIDRs = append(p.CIDRs, def.CIDRs...)
+		return true
+	}
+	for _, name := range strings.Split(names, ",") {
+		if !walk(name) {
+			return Preset{}, false
+		}
+	}
+	return Preset{Domains: unique(p.Domains), CIDRs: unique(p.CIDRs)}, true
+}
+
+// PresetDomains returns the domain allowlist for a preset, or for several
+// separated by commas. Returns nil if a preset doesn't exist.
+func PresetDomains(name string) []string {
+	p, _ := expandPresets(name)
+	return p.Domains
+}
+
+// PresetCIDRs returns the CIDR ranges for a preset, or for several
+// separated by commas. Returns nil if a preset doesn't exist or has no
+// CIDRs.
+func PresetCIDRs(name string) []string {
+	p, _ := expandPresets(name)
+	return p.CIDRs
+}
+
+// ValidateEgress checks that mode is an egress setting a sandbox can be
+// created with: "unrestricted", "allowlist", or one or more presets
+// separated by commas.
+func ValidateEgress(mode string) error {
+	if mode == "unrestricted" || mode == "allowlist" {
+		return nil
+	}
+	for _, name := range strings.Split(mode, ",") {
+		if _, ok := LookupPreset(name); !ok {
+			return fmt.Errorf("unknown preset %q: must be unrestricted, allowlist, or presets from %s",
+				name, strings.Join(PresetNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// IsRestricted reports whether an egress mode limits outbound traffic:
+// anything but "unrestricted" or unset.
+func IsRestricted(mode string) bool {
+	return mode != "" && mode != "unrestricted"
+}
+
+// unique concatenates lists, keeping the first of any duplicates.
+func unique(lists ...[]string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, list := range lists {
+		for _, s := range list {
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package egress
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSetUserPresets(t *testing.T) {
+	t.Cleanup(func() { SetUserPresets(nil) })
+
+	err := SetUserPresets(map[string]Preset{
+		"rust": {Domains: []string{"crates.io", "Index.Crates.io", "github.com"}, Extends: []string{"agent"}},
+		"work": {Domains: []string{"registry.internal:443/TCP"}, CIDRs: []string{"10.20.1.0/16"}, Extends: []string{"rust"}},
+	})
+	if err != nil {
+		t.Fatalf("SetUserPresets: %v", err)
+	}
+
+	rust := PresetDomains("rust")
+	if !slices.Contains(rust, "index.crates.io") || !slices.Contains(rust, "api.anthropic.com") {
+		t.Errorf("PresetDomains(rust) = %v, want agent's domains and its own", rust)
+	}
+	if n := len(PresetDomains("agent")) + 1; len(rust) != n {
+		t.Errorf("PresetDomains(rust) has %d domains, want %d with duplicates dropped", len(rust), n)
+	}
+	if got := PresetDomains("work"); got[len(got)-1] != "registry.internal:443/tcp" || len(got) != len(rust)+1 {
+		t.Errorf("PresetDomains(work) = %v, want rust's domains then its own", got)
+	}
+	if got := PresetCIDRs("work"); got[len(got)-1] != "10.20.0.0/16" {
+		t.Errorf("PresetCIDRs(work) = %v, want agent's CIDRs then 10.20.0.0/16", got)
+	}
+	if got := PresetDomains("agent,work"); len(got) != len(rust)+1 {
+		t.Errorf("PresetDomains(agent,work) has %d domains, want %d", len(got), len(rust)+1)
+	}
+	if got := PresetDomains("agent,nope"); got != nil {
+		t.Errorf("PresetDomains(agent,nope) = %v, want nil", got)
+	}
+	if got := PresetNames(); !slices.Equal(got, []string{"agent", "rust", "work"}) {
+		t.Errorf("PresetNames() = %v", got)
+	}
+	if IsBuiltinPreset("rust") || !IsBuiltinPreset("agent") {
+		t.Error("IsBuiltinPreset mixed up built-in and user presets")
+	}
+}
+
+func TestSetUserPresetsErrors(t *testing.T) {
+	t.Cleanup(func() { SetUserPresets(nil) })
+
+	tests := []struct {
+		name    string
+		presets map[string]Preset
+		want    string
+	}{
+		{"built-in name", map[string]Preset{"agent": {}}, "built-in"},
+		{"mode name", map[string]Preset{"allowlist": {}}, "egress mode"},
+		{"comma", map[string]Preset{"a,b": {}}, "name must be"},
+		{"bad domain", map[string]Preset{"x": {Domains: []string{"*.com"}}}, `preset "x"`},
+		{"bad cidr", map[string]Preset{"x": {CIDRs: []string{"10.0.0.0/33"}}}, "invalid CIDR"},
+		{"unknown extends", map[string]Preset{"x": {Extends: []string{"nope"}}}, `unknown preset "nope"`},
+		{"cycle", map[string]Preset{"x": {Extends: []string{"y"}}, "y": {Extends: []string{"x"}}}, "x -> y -> x"},
+	}
+	for _, tt := range tests {
+		err := SetUserPresets(tt.presets)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if got := PresetNames(); !slices.Equal(got, []string{"agent"}) {
+		t.Errorf("PresetNames() after errors = %v, want only built-ins", got)
+	}
+}
+
+func TestValidateEgress(t *testing.T) {
+	t.Cleanup(func() { SetUserPresets(nil) })
+	if err := SetUserPresets(map[string]Preset{"rust": {Domains: []string{"crates.io"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{"unrestricted", "allowlist", "agent", "rust", "agent,rust"} {
+		if err := ValidateEgress(mode); err != nil {
+			t.Errorf("ValidateEgress(%q) = %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"", "learn", "nope", "agent,", "agent, rust", "allowlist,rust"} {
+		if err := ValidateEgress(mode); err == nil {
+			t.Errorf("ValidateEgress(%q) = nil, want error", mode)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package egress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Paths used by the periodic re-resolution of the domains file.
+const (
+	RefreshUnitPath   = "/etc/systemd/system/pixels-egress-refresh.service"
+	RefreshTimerPath  = "/etc/systemd/system/pixels-egress-refresh.timer"
+	RefreshStatusFile = "/var/lib/pixels-egress/refresh"
+)
+
+// RefreshInterval is how often the resolve script re-resolves the domains
+// file in a container.
+const RefreshInterval = 15 * time.Minute
+
+// RefreshUnit returns the systemd service that re-resolves the domains
+// file and swaps the results into the allowed sets.
+func RefreshUnit() string {
+	return `[Unit]
+Description=pixels egress address refresh
+After=network-online.target nftables.service
+
+[Service]
+Type=oneshot
+ExecStart=/usr/local/bin/pixels-resolve-egress.sh --refresh
+`
+}
+
+// RefreshTimer returns the systemd timer that runs RefreshUnit every
+// RefreshInterval.
+func RefreshTimer() string {
+	return fmt.Sprintf(`[Unit]
+Description=pixels egress address refresh
+
+[Timer]
+OnBootSec=%[1]ds
+OnUnitActiveSec=%[1]ds
+
+[Install]
+WantedBy=timers.target
+`, int(RefreshInterval.Seconds()))
+}
+
+// refreshFuncs defines the shell functions the resolve and learn scripts
+// use to run the refresh: start_refresh installs and starts the timer (or,
+// without systemd, a loop in the background), stop_refresh removes it, and
+// record_refresh writes the result of a run to RefreshStatusFile.
+var refreshFuncs = `REFRESH_STATUS="` + RefreshStatusFile + `"
+REFRESH_LOOP="while sleep [0-9]*; do /usr/local/bin/pixels-resolve-egress.sh --refresh"
+
+start_refresh() {
+    if [ -d /run/systemd/system ]; then
+        cat > "` + RefreshUnitPath + `" <<'UNIT'
+` + RefreshUnit() + `UNIT
+        cat > "` + RefreshTimerPath + `" <<'UNIT'
+` + RefreshTimer() + `UNIT
+        systemctl daemon-reload
+        systemctl enable pixels-egress-refresh.timer >/dev/null 2>&1 || true
+        systemctl restart pixels-egress-refresh.timer
+    else
+        pkill -f "$REFRESH_LOOP" 2>/dev/null || true
+        nohup setsid bash -c "while sleep ` + strconv.Itoa(int(RefreshInterval.Seconds())) + `; do /usr/local/bin/pixels-resolve-egress.sh --refresh; done" >>/var/log/pixels-egress-refresh.log 2>&1 &
+    fi
+}
+
+stop_refresh() {
+    systemctl disable --now pixels-egress-refresh.timer 2>/dev/null || true
+    pkill -f "$REFRESH_LOOP" 2>/dev/null || true
+    rm -f "` + RefreshUnitPath + `" "` + RefreshTimerPath + `"
+}
+
+# record_refresh records result $1 of this run, with message $2, and the
+# counts in added, removed, elements and unresolved.
+record_refresh() {
+    mkdir -p "$(dirname "$REFRESH_STATUS")"
+    {
+        echo "time=$(date -Iseconds)"
+        echo "result=$1"
+        echo "elements=${elements:-0}"
+        echo "added=${added:-0}"
+        echo "removed=${removed:-0}"
+        echo "unresolved=${unresolved:-}"
+        echo "message=$2"
+    } > "$REFRESH_STATUS.tmp"
+    mv "$REFRESH_STATUS.tmp" "$REFRESH_STATUS"
+}
+`
+
+// StopRefreshScript returns a shell snippet that stops re-resolving the
+// domains file and removes the refresh's state.
+func StopRefreshScript() string {
+	return refreshFuncs + `stop_refresh
+rm -rf "$(dirname "$REFRESH_STATUS")"
+`
+}
+
+// Results of a refresh.
+const (
+	RefreshOK      = "ok"
+	RefreshFailed  = "failed"
+	RefreshSkipped = "skipped"
+)
+
+// RefreshStatus is the result of the last time the resolve script filled a
+// container's allowed sets, whether applying a policy or refreshing it.
+type RefreshStatus struct {
+	Time       time.Time `json:"time"`
+	Result     string    `json:"result"`   // RefreshOK, RefreshFailed or RefreshSkipped
+	Elements   int       `json:"elements"` // elements in the allowed sets afterwards
+	Added      int       `json:"added"`
+	Removed    int       `json:"removed"`
+	Unresolved []string  `json:"unresolved,omitempty"` // names that resolved to nothing, kept at their last addresses
+	Message    string    `json:"message,omitempty"`
+}
+
+// ParseRefreshStatus parses RefreshStatusFile. It reports false if data
+// holds no result.
+func ParseRefreshStatus(data []byte) (RefreshStatus, bool) {
+	var s RefreshStatus
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		key, val, _ := strings.Cut(sc.Text(), "=")
+		switch key {
+		case "time":
+			s.Time, _ = time.Parse(time.RFC3339, val)
+		case "result":
+			s.Result = val
+		case "elements":
+			s.Elements, _ = strconv.Atoi(val)
+		case "added":
+			s.Added, _ = strconv.Atoi(val)
+		case "removed":
+			s.Removed, _ = strconv.Atoi(val)
+		case "unresolved":
+			s.Unresolved = strings.Fields(val)
+		case "message":
+			s.Message = val
+		}
+	}
+	return s, s.Result != ""
+}
+
+// ReadRefreshStatus reads the result of the last refresh in name. It
+// returns nil if none has been recorded.
+func ReadRefreshStatus(ctx context.Context, e Enforcer, name string) (*RefreshStatus, error) {
+	var stdout, stderr bytes.Buffer
+	rc, err := e.Run(ctx, name, sandbox.ExecOpts{
+		Cmd:    []string{"bash", "-c", "cat " + RefreshStatusFile + " 2>/dev/null || true"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Root:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading egress refresh status: %w", err)
+	}
+	if rc != 0 {
+		return nil, fmt.Errorf("reading egress refresh status: exit code %d: %s", rc, strings.TrimSpace(stderr.String()))
+	}
+	s, ok := ParseRefreshStatus(stdout.Bytes())
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
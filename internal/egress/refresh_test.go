@@ -0,0 +1,50 @@
+package egress
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRefreshStatus(t *testing.T) {
+	s, ok := ParseRefreshStatus([]byte(`time=2026-10-16T12:00:00+00:00
+result=ok
+elements=42
+added=2
+removed=3
+unresolved=pypi.org example.com
+message=
+`))
+	if !ok {
+		t.Fatal("ParseRefreshStatus reported no result")
+	}
+	want := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	if !s.Time.Equal(want) || s.Result != RefreshOK || s.Elements != 42 || s.Added != 2 || s.Removed != 3 || s.Message != "" {
+		t.Errorf("ParseRefreshStatus = %+v", s)
+	}
+	if !slices.Equal(s.Unresolved, []string{"pypi.org", "example.com"}) {
+		t.Errorf("Unresolved = %v", s.Unresolved)
+	}
+
+	s, _ = ParseRefreshStatus([]byte("result=failed\nmessage=Error: No such file or directory; did you mean table 'pixels_egress' in family inet?\n"))
+	if s.Result != RefreshFailed || !strings.HasPrefix(s.Message, "Error: No such file") {
+		t.Errorf("failed status = %+v", s)
+	}
+	if _, ok := ParseRefreshStatus(nil); ok {
+		t.Error("ParseRefreshStatus(nil) reported a result")
+	}
+}
+
+func TestRefreshUnits(t *testing.T) {
+	if !strings.Contains(RefreshUnit(), "ExecStart=/usr/local/bin/pixels-resolve-egress.sh --refresh") {
+		t.Error("refresh unit doesn't run the resolve script with --refresh")
+	}
+	if !strings.Contains(RefreshTimer(), "OnUnitActiveSec=900s") {
+		t.Errorf("refresh timer = %q, want every 15 minutes", RefreshTimer())
+	}
+	stop := StopRefreshScript()
+	if !strings.Contains(stop, "systemctl disable --now pixels-egress-refresh.timer") || !strings.HasSuffix(stop, "stop_refresh\nrm -rf \"$(dirname \"$REFRESH_STATUS\")\"\n") {
+		t.Errorf("StopRefreshScript = %q", stop)
+	}
+}
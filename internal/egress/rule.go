@@ -0,0 +1,165 @@
+package egress
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Rule is one allowlist entry: a destination, optionally narrowed to a
+// port and protocol. Entries are written
+//
+//	host            any port, e.g. "github.com" or "10.0.0.0/8"
+//	host:port       TCP and UDP to port, e.g. "10.0.0.5:5432"
+//	host:port/proto one protocol, e.g. "github.com:443/tcp"
+//
+// where host is a domain or domain pattern (see DomainSet), an IP address
+// or a CIDR. IPv6 addresses take brackets when a port follows, as in
+// "[2001:db8::1]:443".
+type Rule struct {
+	Host  string // domain, pattern, address or CIDR, in canonical form
+	Port  int    // 0 for any port
+	Proto string // "tcp" or "udp"; "" for both
+}
+
+// ParseRule parses an allowlist entry.
+func ParseRule(entry string) (Rule, error) {
+	s := strings.ToLower(strings.TrimSpace(entry))
+	var r Rule
+	if i := strings.LastIndex(s, "/"); i >= 0 && (s[i+1:] == "tcp" || s[i+1:] == "udp") {
+		s, r.Proto = s[:i], s[i+1:]
+	}
+
+	host, port := s, ""
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return Rule{}, fmt.Errorf("invalid entry %q: missing ]", entry)
+		}
+		host = s[1:end]
+		if rest := s[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return Rule{}, fmt.Errorf("invalid entry %q", entry)
+			}
+			port = rest[1:]
+		}
+	case strings.Count(s, ":") == 1:
+		host, port, _ = strings.Cut(s, ":")
+	}
+
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return Rule{}, fmt.Errorf("invalid entry %q: bad port %q", entry, port)
+		}
+		r.Port = n
+	}
+	if r.Proto != "" && r.Port == 0 {
+		return Rule{}, fmt.Errorf("invalid entry %q: a protocol needs a port", entry)
+	}
+
+	switch p, ok := parseAddrOrPrefix(host); {
+	case ok:
+		r.Host = p
+	case strings.Contains(host, ":"):
+		return Rule{}, fmt.Errorf("invalid entry %q: bad address %q", entry, host)
+	default:
+		d, err := NormalizeDomain(host)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid entry %q: %w", entry, err)
+		}
+		r.Host = d
+	}
+	return r, nil
+}
+
+// NormalizeRule checks that entry is a valid allowlist entry and returns it
+// in canonical form.
+func NormalizeRule(entry string) (string, error) {
+	r, err := ParseRule(entry)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// String returns r as an allowlist entry.
+func (r Rule) String() string {
+	s := r.Host
+	if r.Port > 0 {
+		if strings.Contains(s, ":") {
+			s = "[" + s + "]"
+		}
+		s += ":" + strconv.Itoa(r.Port)
+	}
+	if r.Proto != "" {
+		s += "/" + r.Proto
+	}
+	return s
+}
+
+// IsAddr reports whether r's host is an IP address or CIDR rather than a
+// domain.
+func (r Rule) IsAddr() bool {
+	_, ok := parseAddrOrPrefix(r.Host)
+	return ok
+}
+
+// Resolvable returns the name to resolve up front for r: its host, the
+// apex of a "." pattern, or nothing for a "*." pattern or an address.
+func (r Rule) Resolvable() (string, bool) {
+	if r.IsAddr() || strings.HasPrefix(r.Host, "*.") {
+		return "", false
+	}
+	return strings.TrimPrefix(r.Host, "."), true
+}
+
+// Protos returns the protocols r allows: both, unless it names one.
+func (r Rule) Protos() []string {
+	if r.Proto != "" {
+		return []string{r.Proto}
+	}
+	return []string{"tcp", "udp"}
+}
+
+// Ports describes the ports r allows, e.g. "443/tcp", "5432/tcp+udp" or
+// "any".
+func (r Rule) Ports() string {
+	if r.Port == 0 {
+		return "any"
+	}
+	return strconv.Itoa(r.Port) + "/" + strings.Join(r.Protos(), "+")
+}
+
+// ParseRules parses entries, skipping blank lines, "#" comments and
+// invalid entries.
+func ParseRules(entries []string) []Rule {
+	var rules []Rule
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e == "" || strings.HasPrefix(e, "#") {
+			continue
+		}
+		if r, err := ParseRule(e); err == nil {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// parseAddrOrPrefix returns s in canonical form if it is an IP address or
+// CIDR. A CIDR covering a single address is written as the address.
+func parseAddrOrPrefix(s string) (string, bool) {
+	if a, err := netip.ParseAddr(s); err == nil && a.Zone() == "" {
+		return a.Unmap().String(), true
+	}
+	if p, err := netip.ParsePrefix(s); err == nil {
+		p = p.Masked()
+		if p.IsSingleIP() {
+			return p.Addr().String(), true
+		}
+		return p.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,88 @@
+package egress
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Rule
+		str     string
+		wantErr bool
+	}{
+		{in: "GitHub.com", want: Rule{Host: "github.com"}, str: "github.com"},
+		{in: "github.com:443/TCP", want: Rule{Host: "github.com", Port: 443, Proto: "tcp"}, str: "github.com:443/tcp"},
+		{in: "10.0.0.5:5432", want: Rule{Host: "10.0.0.5", Port: 5432}, str: "10.0.0.5:5432"},
+		{in: "10.0.0.0/8:53/udp", want: Rule{Host: "10.0.0.0/8", Port: 53, Proto: "udp"}, str: "10.0.0.0/8:53/udp"},
+		{in: "10.1.2.3/8", want: Rule{Host: "10.0.0.0/8"}, str: "10.0.0.0/8"},
+		{in: "192.0.2.1/32", want: Rule{Host: "192.0.2.1"}, str: "192.0.2.1"},
+		{in: "2001:DB8::1", want: Rule{Host: "2001:db8::1"}, str: "2001:db8::1"},
+		{in: "[2001:db8::1]:443/tcp", want: Rule{Host: "2001:db8::1", Port: 443, Proto: "tcp"}, str: "[2001:db8::1]:443/tcp"},
+		{in: "2001:db8::/32", want: Rule{Host: "2001:db8::/32"}, str: "2001:db8::/32"},
+		{in: "*.githubusercontent.com:443", want: Rule{Host: "*.githubusercontent.com", Port: 443}, str: "*.githubusercontent.com:443"},
+		{in: "github.com/tcp", wantErr: true},
+		{in: "github.com:0", wantErr: true},
+		{in: "github.com:65536", wantErr: true},
+		{in: "github.com:https", wantErr: true},
+		{in: "[2001:db8::1", wantErr: true},
+		{in: "2001:db8::zz", wantErr: true},
+		{in: "*.com:443", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRule(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRule(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRule(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if !tt.wantErr && got.String() != tt.str {
+			t.Errorf("ParseRule(%q).String() = %q, want %q", tt.in, got.String(), tt.str)
+		}
+	}
+}
+
+func TestDomainSetRules(t *testing.T) {
+	s := NewDomainSet([]string{"github.com:443/tcp", "github.com:22/tcp", ".example.com:8080", "10.0.0.5:5432"})
+	if got := s.Rules("github.com"); len(got) != 2 || got[0].Port != 443 || got[1].Port != 22 {
+		t.Errorf("Rules(github.com) = %+v", got)
+	}
+	if got := s.Rules("api.example.com"); len(got) != 1 || got[0].Ports() != "8080/tcp+udp" {
+		t.Errorf("Rules(api.example.com) = %+v", got)
+	}
+	if s.Contains("10.0.0.5") {
+		t.Error("address entry matched a name")
+	}
+}
+
+func TestNftAllowBatch(t *testing.T) {
+	addr := netip.MustParseAddr("192.0.2.1")
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  []string
+	}{
+		{"any port", []Rule{{Host: "github.com"}, {Host: "github.com", Port: 22}}, []string{"dns_v4 { 192.0.2.1 timeout 60s }"}},
+		{"one port", []Rule{{Host: "github.com", Port: 443, Proto: "tcp"}}, []string{"dns_ports_v4 { 192.0.2.1 . tcp . 443 timeout 60s }"}},
+		{"both protocols", []Rule{{Host: "github.com", Port: 53}}, []string{
+			"dns_ports_v4 { 192.0.2.1 . tcp . 53 timeout 60s }",
+			"dns_ports_v4 { 192.0.2.1 . udp . 53 timeout 60s }",
+		}},
+	}
+	for _, tt := range tests {
+		batch := nftAllowBatch(addr, tt.rules, time.Minute)
+		for _, want := range tt.want {
+			if !strings.Contains(batch, "add element inet pixels_egress "+want) {
+				t.Errorf("%s: batch missing %q:\n%s", tt.name, want, batch)
+			}
+		}
+		if n := strings.Count(batch, "delete element"); n != len(tt.want) {
+			t.Errorf("%s: %d elements refreshed, want %d", tt.name, n, len(tt.want))
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package egress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Enforcer is the part of a sandbox that checking and reapplying egress
+// policies needs.
+type Enforcer interface {
+	sandbox.NetworkPolicy
+	Run(ctx context.Context, name string, opts sandbox.ExecOpts) (int, error)
+}
+
+// HostEnforcer is implemented by backends that can enforce egress from the
+// host, outside the container, where names are resolved by the host.
+type HostEnforcer interface {
+	// HostState returns the egress rules the host applies to name,
+	// resolving the names in its policy p from the host. ok is false if
+	// name's egress is enforced inside the container instead.
+	HostState(ctx context.Context, name string, p sandbox.Policy) (s State, ok bool, err error)
+	// RefreshHost resolves the names in name's host-side rules again and
+	// rewrites the rules with the result. It does nothing if the host
+	// doesn't enforce name's egress.
+	RefreshHost(ctx context.Context, name string) error
+}
+
+// ReadState reads the egress enforcement in force in name, resolving the
+// names in its policy p. Rules the host enforces are read from the host.
+func ReadState(ctx context.Context, e Enforcer, name string, p sandbox.Policy) (State, error) {
+	if h, ok := e.(HostEnforcer); ok {
+		if s, ok, err := h.HostState(ctx, name, p); err != nil || ok {
+			return s, err
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	rc, err := e.Run(ctx, name, sandbox.ExecOpts{
+		Cmd:    []string{"bash", "-c", StateScript(p)},
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Root:   true,
+	})
+	if err != nil {
+		return State{}, fmt.Errorf("reading egress rules: %w", err)
+	}
+	if rc != 0 {
+		return State{}, fmt.Errorf("reading egress rules: exit code %d: %s", rc, strings.TrimSpace(stderr.String()))
+	}
+	return ParseState(stdout.Bytes()), nil
+}
+
+// Verify checks name's egress enforcement against its recorded policy,
+// returning the policy and how enforcement has drifted from it. A missing
+// record is drift too, reported with an empty policy.
+func Verify(ctx context.Context, e Enforcer, name string) (*sandbox.Policy, []Difference, error) {
+	p, err := e.GetPolicy(ctx, name)
+	if errors.Is(err, ErrNoRecord) {
+		return &sandbox.Policy{}, []Difference{MissingRecord(err)}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := ReadState(ctx, e, name, *p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, Drift(*p, s), nil
+}
+
+// MissingRecord returns the Difference reporting err, an ErrNoRecord.
+func MissingRecord(err error) Difference {
+	return Difference{Kind: DiffRecord, Entry: "policy record", Change: DiffMissing, Detail: err.Error()}
+}
+
+// Reapply sets up p on name again: its mode, then its allowlist as
+// recorded.
+func Reapply(ctx context.Context, e sandbox.NetworkPolicy, name string, p sandbox.Policy) error {
+	if err := e.SetEgressMode(ctx, name, p.Mode); err != nil {
+		return fmt.Errorf("reapplying %s egress: %w", p.Mode, err)
+	}
+	if p.Mode == sandbox.EgressUnrestricted || p.Mode == sandbox.EgressLearn {
+		return nil
+	}
+	return SetDomains(ctx, e, name, p.Domains)
+}
+
+// SetDomains allows and denies entries on name's allowlist until it holds
+// exactly domains.
+func SetDomains(ctx context.Context, e sandbox.NetworkPolicy, name string, domains []string) error {
+	current, err := e.GetPolicy(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, d := range domains {
+		if !slices.Contains(current.Domains, d) {
+			if err := e.AllowDomain(ctx, name, d); err != nil {
+				return err
+			}
+		}
+	}
+	for _, d := range current.Domains {
+		if !slices.Contains(domains, d) {
+			if err := e.DenyDomain(ctx, name, d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// noRecord is an Enforcer whose policy record has gone missing.
+type noRecord struct{ sandbox.NetworkPolicy }
+
+func (noRecord) GetPolicy(ctx context.Context, name string) (*sandbox.Policy, error) {
+	return nil, fmt.Errorf("%s: %w", name, ErrNoRecord)
+}
+func (noRecord) Run(ctx context.Context, name string, opts sandbox.ExecOpts) (int, error) {
+	return 0, errors.New("unexpected Run")
+}
+
+func TestVerifyMissingRecord(t *testing.T) {
+	p, drift, err := Verify(context.Background(), noRecord{}, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode != "" {
+		t.Errorf("policy = %+v, want none", p)
+	}
+	if len(drift) != 1 || drift[0].Kind != DiffRecord || drift[0].Change != DiffMissing {
+		t.Errorf("drift = %+v, want the record missing", drift)
+	}
+}
@@ -0,0 +1,257 @@
+package mcp
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Job is a background process started by exec_background.
+type Job struct {
+	ID        string
+	Sandbox   string
+	Command   []string
+	StartedAt time.Time
+	Process   sandbox.Process
+
+	exitedAt time.Time // when the job was first seen to have exited
+}
+
+// Finished jobs are kept for their output until they have been done for
+// jobRetention, and no more than maxFinishedJobs of them at once.
+const (
+	jobRetention    = time.Hour
+	maxFinishedJobs = 32
+)
+
+// Jobs tracks background processes by ID. The zero value is ready to use.
+// Jobs are held in memory only; a daemon restart forgets them (the
+// processes themselves keep running inside their sandboxes).
+type Jobs struct {
+	mu   sync.Mutex
+	seq  int
+	jobs map[string]*Job
+}
+
+// Add registers p and returns its job, evicting finished jobs past their
+// retention.
+func (j *Jobs) Add(sandboxName string, cmd []string, p sandbox.Process) *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.jobs == nil {
+		j.jobs = make(map[string]*Job)
+	}
+	j.evict(time.Now())
+	j.seq++
+	job := &Job{
+		ID:        "job-" + strconv.Itoa(j.seq),
+		Sandbox:   sandboxName,
+		Command:   cmd,
+		StartedAt: time.Now().UTC(),
+		Process:   p,
+	}
+	j.jobs[job.ID] = job
+	return job
+}
+
+// evict drops finished jobs that exited over jobRetention ago, then the
+// oldest finished jobs beyond maxFinishedJobs. Running jobs are kept.
+func (j *Jobs) evict(now time.Time) {
+	var finished []*Job
+	for id, job := range j.jobs {
+		if _, done := job.Process.Exited(); !done {
+			continue
+		}
+		if job.exitedAt.IsZero() {
+			job.exitedAt = now
+		}
+		if now.Sub(job.exitedAt) > jobRetention {
+			delete(j.jobs, id)
+			continue
+		}
+		finished = append(finished, job)
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	slices.SortFunc(finished, func(a, b *Job) int {
+		return cmp.Or(a.exitedAt.Compare(b.exitedAt), a.StartedAt.Compare(b.StartedAt))
+	})
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(j.jobs, job.ID)
+	}
+}
+
+// Get returns the job with the given ID.
+func (j *Jobs) Get(id string) (*Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	return job, ok
+}
+
+// Forget drops every job in a sandbox. Used when the sandbox is destroyed.
+func (j *Jobs) Forget(sandboxName string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, job := range j.jobs {
+		if job.Sandbox == sandboxName {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+// --- Input/output types ---
+
+type ExecBackgroundIn struct {
+	Name    string            `json:"name"`
+	Command []string          `json:"command"`
+	Cwd     string            `json:"cwd,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+type ExecBackgroundOut struct {
+	JobID string `json:"job_id"`
+	PID   int    `json:"pid"`
+}
+
+type JobRef struct {
+	JobID string `json:"job_id"`
+}
+type JobStatusOut struct {
+	JobID     string    `json:"job_id"`
+	Name      string    `json:"name"`
+	Command   []string  `json:"command"`
+	PID       int       `json:"pid"`
+	Running   bool      `json:"running"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type JobOutputIn struct {
+	JobID    string `json:"job_id"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+type JobOutputOut struct {
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Running   bool   `json:"running"`
+	Truncated bool   `json:"truncated"`
+}
+
+type JobKillIn struct {
+	JobID  string `json:"job_id"`
+	Signal string `json:"signal,omitempty"` // name or number; default KILL
+}
+
+// --- Job handlers ---
+
+func (t *Tools) ExecBackground(ctx context.Context, in ExecBackgroundIn) (ExecBackgroundOut, error) {
+	sb, err := t.requireSandbox(in.Name)
+	if err != nil {
+		return ExecBackgroundOut{}, err
+	}
+	if len(in.Command) == 0 {
+		return ExecBackgroundOut{}, errors.New("command is required")
+	}
+
+	// Hold the sandbox lock only while starting; the job itself runs
+	// alongside later tool calls.
+	unlock := t.Locks.Acquire(sb.Name)
+	p, err := t.Backend.StartProcess(ctx, sb.Name, sandbox.ExecOpts{
+		Cmd: execCommand(in.Command, in.Cwd, in.Env),
+	})
+	unlock()
+	t.touch(sb.Name)
+	if err != nil {
+		return ExecBackgroundOut{}, fmt.Errorf("starting job in %s: %w", sb.Name, err)
+	}
+
+	job := t.jobs.Add(sb.Name, in.Command, p)
+	t.log().Info("job started", "job", job.ID, "name", sb.Name, "pid", p.PID())
+	return ExecBackgroundOut{JobID: job.ID, PID: p.PID()}, nil
+}
+
+func (t *Tools) requireJob(id string) (*Job, error) {
+	job, ok := t.jobs.Get(id)
+	if !ok {
+		return nil, sandbox.Wrap(sandbox.ErrNotFound, fmt.Errorf("job %q not found", id))
+	}
+	// Polling a job counts as activity, so a sandbox running a long job
+	// isn't reaped while the caller is still watching it.
+	t.touch(job.Sandbox)
+	return job, nil
+}
+
+func (t *Tools) JobStatus(ctx context.Context, in JobRef) (JobStatusOut, error) {
+	job, err := t.requireJob(in.JobID)
+	if err != nil {
+		return JobStatusOut{}, err
+	}
+	out := JobStatusOut{
+		JobID:     job.ID,
+		Name:      job.Sandbox,
+		Command:   job.Command,
+		PID:       job.Process.PID(),
+		Running:   true,
+		StartedAt: job.StartedAt,
+	}
+	if code, done := job.Process.Exited(); done {
+		out.Running = false
+		out.ExitCode = &code
+	}
+	return out, nil
+}
+
+func (t *Tools) JobOutput(ctx context.Context, in JobOutputIn) (JobOutputOut, error) {
+	job, err := t.requireJob(in.JobID)
+	if err != nil {
+		return JobOutputOut{}, err
+	}
+	max := in.MaxBytes
+	if max <= 0 || max > readFileDefaultMaxBytes {
+		max = readFileDefaultMaxBytes
+	}
+	_, done := job.Process.Exited()
+	stdout, tout := tail(job.Process.Stdout(), max)
+	stderr, terr := tail(job.Process.Stderr(), max)
+	return JobOutputOut{
+		Stdout:    string(stdout),
+		Stderr:    string(stderr),
+		Running:   !done,
+		Truncated: tout || terr,
+	}, nil
+}
+
+func (t *Tools) JobKill(ctx context.Context, in JobKillIn) (Ack, error) {
+	job, err := t.requireJob(in.JobID)
+	if err != nil {
+		return Ack{}, err
+	}
+	sig := syscall.SIGKILL
+	if in.Signal != "" {
+		if sig, err = sandbox.ParseSignal(in.Signal); err != nil {
+			return Ack{}, err
+		}
+	}
+	if err := job.Process.Signal(ctx, sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return Ack{}, err
+	}
+	return Ack{OK: true}, nil
+}
+
+// tail returns the last max bytes of b and whether anything was cut.
+func tail(b []byte, max int64) ([]byte, bool) {
+	if int64(len(b)) <= max {
+		return b, false
+	}
+	return b[int64(len(b))-max:], true
+}
@@ -0,0 +1,57 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeProcess is a sandbox.Process that has exited or not.
+type fakeProcess struct{ done bool }
+
+func (p *fakeProcess) PID() int                                     { return 1 }
+func (p *fakeProcess) Wait(context.Context) (int, error)            { return 0, nil }
+func (p *fakeProcess) Exited() (int, bool)                          { return 0, p.done }
+func (p *fakeProcess) Signal(context.Context, syscall.Signal) error { return nil }
+func (p *fakeProcess) Kill(context.Context) error                   { return nil }
+func (p *fakeProcess) Stdout() []byte                               { return nil }
+func (p *fakeProcess) Stderr() []byte                               { return nil }
+
+func TestJobsEvictFinished(t *testing.T) {
+	var j Jobs
+	running := j.Add("demo", []string{"serve"}, &fakeProcess{})
+	old := j.Add("demo", []string{"true"}, &fakeProcess{done: true})
+	j.evict(time.Now())
+	old.exitedAt = time.Now().Add(-2 * jobRetention)
+	recent := j.Add("demo", []string{"true"}, &fakeProcess{done: true})
+
+	if _, ok := j.Get(old.ID); ok {
+		t.Error("job finished past its retention was kept")
+	}
+	if _, ok := j.Get(running.ID); !ok {
+		t.Error("running job was evicted")
+	}
+	if _, ok := j.Get(recent.ID); !ok {
+		t.Error("just-finished job was evicted")
+	}
+
+	// Past the cap, the oldest finished jobs go first.
+	start := time.Now().Add(-time.Minute)
+	recent.exitedAt = start.Add(-time.Second)
+	for i := range maxFinishedJobs + 5 {
+		job := j.Add("demo", []string{fmt.Sprint(i)}, &fakeProcess{done: true})
+		job.exitedAt = start.Add(time.Duration(i) * time.Second)
+	}
+	j.Add("demo", []string{"last"}, &fakeProcess{})
+	if got := len(j.jobs); got != maxFinishedJobs+2 {
+		t.Errorf("jobs after the cap = %d, want %d finished and 2 running", got, maxFinishedJobs)
+	}
+	if _, ok := j.Get(recent.ID); ok {
+		t.Error("the oldest finished job survived the cap")
+	}
+	if _, ok := j.Get(running.ID); !ok {
+		t.Error("running job was evicted by the cap")
+	}
+}
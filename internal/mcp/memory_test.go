@@ -0,0 +1,174 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deevus/pixels/internal/config"
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/memory"
+)
+
+// newMemoryTools wires Tools, Builder and Reaper to a real in-memory backend
+// so the MCP layer can be exercised end-to-end without a container runtime.
+func newMemoryTools(t *testing.T) (*Tools, *memory.Memory) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "py.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/bash\napt-get install -y python3\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	be, err := memory.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := LoadState(filepath.Join(dir, "s.json"))
+	cfg := &config.Config{MCP: config.MCP{
+		BasePrefix: "base-",
+		Bases: map[string]config.Base{
+			"py": {ParentImage: "ubuntu/24.04", SetupScript: script},
+		},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tt := &Tools{
+		State:          s,
+		Backend:        be,
+		Prefix:         "mcp-",
+		DefaultImage:   "ubuntu/24.04",
+		ExecTimeoutMax: time.Minute,
+		Log:            NopLogger(),
+		Locks:          &SandboxLocks{},
+		DaemonCtx:      ctx,
+		Cfg:            cfg,
+	}
+	tt.Builder = &Builder{DoBuild: func(ctx context.Context, name string) error {
+		return BuildBase(ctx, be, cfg, name, cfg.MCP.Bases[name], BuildBaseOpts{})
+	}}
+	t.Cleanup(func() {
+		cancel()
+		tt.provisionWG.Wait()
+	})
+	return tt, be
+}
+
+func TestMemoryBackendEndToEnd(t *testing.T) {
+	ctx := context.Background()
+	tt, be := newMemoryTools(t)
+
+	out, err := tt.CreateSandbox(ctx, CreateSandboxIn{Base: "py"})
+	if err != nil {
+		t.Fatalf("CreateSandbox: %v", err)
+	}
+	tt.WaitProvisioning()
+
+	sb, ok := tt.State.Get(out.Name)
+	if !ok || sb.Status != "running" {
+		t.Fatalf("sandbox after provisioning = %+v (ok=%v)", sb, ok)
+	}
+	if sb.IP == "" {
+		t.Error("IP not recorded")
+	}
+	if snaps, _ := be.ListSnapshots(ctx, "base-py"); len(snaps) != 1 || snaps[0].Label != InitialCheckpointLabel {
+		t.Errorf("base snapshots = %+v", snaps)
+	}
+
+	if _, err := tt.WriteFile(ctx, WriteFileIn{Name: out.Name, Path: "/work/hello.txt", Content: "hi\n"}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	exec, err := tt.Exec(ctx, ExecIn{Name: out.Name, Command: []string{"cat", "hello.txt"}, Cwd: "/work", Env: map[string]string{"A": "b c"}})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if exec.ExitCode != 0 || exec.Stdout != "hi\n" {
+		t.Errorf("Exec = %+v", exec)
+	}
+	exec, _ = tt.Exec(ctx, ExecIn{Name: out.Name, Command: []string{"sh", "-c", "echo $A"}, Env: map[string]string{"A": "b c"}})
+	if strings.TrimSpace(exec.Stdout) != "b c" {
+		t.Errorf("env not forwarded: %+v", exec)
+	}
+
+	r := &Reaper{
+		State:            tt.State,
+		Backend:          be,
+		Locks:            tt.Locks,
+		IdleStopAfter:    time.Minute,
+		HardDestroyAfter: time.Hour,
+		Now:              func() time.Time { return time.Now().Add(2 * time.Minute) },
+	}
+	r.Tick(ctx)
+	inst, err := be.Get(ctx, out.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Status != sandbox.StatusStopped {
+		t.Errorf("reaper left sandbox %s", inst.Status)
+	}
+
+	if _, err := tt.DestroySandbox(ctx, SandboxRef{Name: out.Name}); err != nil {
+		t.Fatalf("DestroySandbox: %v", err)
+	}
+	if _, err := be.Get(ctx, out.Name); err == nil {
+		t.Error("sandbox still exists after destroy")
+	}
+}
+
+func TestMemoryBackendJobs(t *testing.T) {
+	ctx := context.Background()
+	tt, _ := newMemoryTools(t)
+
+	out, err := tt.CreateSandbox(ctx, CreateSandboxIn{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.WaitProvisioning()
+
+	started, err := tt.ExecBackground(ctx, ExecBackgroundIn{Name: out.Name, Command: []string{"sh", "-c", "echo $A; sleep 60"}, Env: map[string]string{"A": "up"}})
+	if err != nil {
+		t.Fatalf("ExecBackground: %v", err)
+	}
+	if started.PID <= 0 {
+		t.Errorf("PID = %d", started.PID)
+	}
+	st, err := tt.JobStatus(ctx, JobRef{JobID: started.JobID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Running || st.ExitCode != nil || st.Name != out.Name {
+		t.Errorf("JobStatus while running = %+v", st)
+	}
+	jo, _ := tt.JobOutput(ctx, JobOutputIn{JobID: started.JobID})
+	if jo.Stdout != "up\n" || !jo.Running {
+		t.Errorf("JobOutput = %+v", jo)
+	}
+
+	if _, err := tt.JobKill(ctx, JobKillIn{JobID: started.JobID, Signal: "TERM"}); err != nil {
+		t.Fatalf("JobKill: %v", err)
+	}
+	job, _ := tt.jobs.Get(started.JobID)
+	if rc, _ := job.Process.Wait(ctx); rc != 143 {
+		t.Errorf("exit code after TERM = %d, want 143", rc)
+	}
+	st, _ = tt.JobStatus(ctx, JobRef{JobID: started.JobID})
+	if st.Running || st.ExitCode == nil || *st.ExitCode != 143 {
+		t.Errorf("JobStatus after kill = %+v", st)
+	}
+	if _, err := tt.JobKill(ctx, JobKillIn{JobID: started.JobID}); err != nil {
+		t.Errorf("JobKill on exited job: %v", err)
+	}
+	if _, err := tt.JobKill(ctx, JobKillIn{JobID: started.JobID, Signal: "BOGUS"}); err == nil {
+		t.Error("JobKill with unknown signal: want error")
+	}
+
+	if _, err := tt.DestroySandbox(ctx, SandboxRef{Name: out.Name}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tt.JobStatus(ctx, JobRef{JobID: started.JobID}); err == nil {
+		t.Error("job still tracked after destroy")
+	}
+}
@@ -2,8 +2,13 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"strings"
 	"time"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
 )
 
 // LifecycleBackend is the subset of sandbox.Backend that the reaper needs.
@@ -12,7 +17,9 @@ type LifecycleBackend interface {
 	Delete(ctx context.Context, name string) error
 }
 
-// Reaper enforces idle-stop and hard-destroy TTLs on tracked sandboxes.
+// Reaper enforces idle-stop and hard-destroy TTLs on tracked sandboxes,
+// and optionally checks that running ones still enforce their egress
+// policies.
 type Reaper struct {
 	State            *State
 	Backend          LifecycleBackend
@@ -21,6 +28,18 @@ type Reaper struct {
 	HardDestroyAfter time.Duration
 	Log              *slog.Logger
 	Now              func() time.Time // injectable clock for tests
+
+	// Egress, if set, is used to check each running sandbox with a
+	// restricted egress policy for drift on every pass. Drift is logged,
+	// and with ReapplyEgress the policy is applied again.
+	Egress        egress.Enforcer
+	ReapplyEgress bool
+
+	// HostEgress, if set, re-resolves the names in each running sandbox's
+	// host-enforced egress rules every egress.RefreshInterval, as the
+	// timer inside the container does for rules enforced there.
+	HostEgress egress.HostEnforcer
+	refreshed  map[string]time.Time // when HostEgress last refreshed each sandbox
 }
 
 func (r *Reaper) log() *slog.Logger {
@@ -43,6 +62,11 @@ func (r *Reaper) Tick(ctx context.Context) {
 	for _, sb := range r.State.Sandboxes() {
 		r.tickOne(ctx, sb, now)
 	}
+	for name := range r.refreshed {
+		if _, ok := r.State.Get(name); !ok {
+			delete(r.refreshed, name)
+		}
+	}
 	if err := r.State.Save(); err != nil {
 		r.log().Error("save state during reap", "err", err)
 	}
@@ -58,6 +82,8 @@ func (r *Reaper) tickOne(ctx context.Context, sb Sandbox, now time.Time) {
 		defer m.Unlock()
 	}
 	r.applyTTL(ctx, sb, now)
+	r.refreshEgress(ctx, sb.Name, now)
+	r.checkEgress(ctx, sb.Name)
 }
 
 func (r *Reaper) applyTTL(ctx context.Context, sb Sandbox, now time.Time) {
@@ -82,6 +108,76 @@ func (r *Reaper) applyTTL(ctx context.Context, sb Sandbox, now time.Time) {
 	}
 }
 
+// refreshEgress re-resolves a running sandbox's host-enforced egress rules
+// if it's been egress.RefreshInterval since they were last refreshed.
+func (r *Reaper) refreshEgress(ctx context.Context, name string, now time.Time) {
+	if r.HostEgress == nil {
+		return
+	}
+	if sb, ok := r.State.Get(name); !ok || sb.Status != "running" {
+		delete(r.refreshed, name)
+		return
+	}
+	if last, ok := r.refreshed[name]; ok && now.Sub(last) < egress.RefreshInterval {
+		return
+	}
+	if r.refreshed == nil {
+		r.refreshed = map[string]time.Time{}
+	}
+	r.refreshed[name] = now
+	if err := r.HostEgress.RefreshHost(ctx, name); err != nil {
+		r.log().Error("refresh egress", "name", name, "err", err)
+	}
+}
+
+// checkEgress verifies a running sandbox's egress enforcement against its
+// recorded policy, reapplying the policy if it has drifted and
+// ReapplyEgress is set.
+func (r *Reaper) checkEgress(ctx context.Context, name string) {
+	if r.Egress == nil {
+		return
+	}
+	// applyTTL may have just stopped or destroyed it.
+	if sb, ok := r.State.Get(name); !ok || sb.Status != "running" {
+		return
+	}
+	policy, err := r.Egress.GetPolicy(ctx, name)
+	if errors.Is(err, egress.ErrNoRecord) {
+		// Nothing to reapply, but it isn't unrestricted either.
+		r.log().Warn("egress drift", "name", name, "drift", egress.MissingRecord(err).String())
+		return
+	}
+	if err != nil {
+		r.log().Error("get egress policy", "name", name, "err", err)
+		return
+	}
+	if policy.Mode == sandbox.EgressUnrestricted {
+		return
+	}
+	state, err := egress.ReadState(ctx, r.Egress, name, *policy)
+	if err != nil {
+		r.log().Error("verify egress", "name", name, "err", err)
+		return
+	}
+	drift := egress.Drift(*policy, state)
+	if len(drift) == 0 {
+		return
+	}
+	lines := make([]string, len(drift))
+	for i, d := range drift {
+		lines[i] = d.String()
+	}
+	r.log().Warn("egress drift", "name", name, "mode", policy.Mode, "drift", strings.Join(lines, "; "))
+	if !r.ReapplyEgress {
+		return
+	}
+	if err := egress.Reapply(ctx, r.Egress, name, *policy); err != nil {
+		r.log().Error("reapply egress", "name", name, "err", err)
+		return
+	}
+	r.log().Info("egress reapplied", "name", name, "mode", policy.Mode)
+}
+
 // Run starts a ticker that calls Tick until ctx is cancelled.
 func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
 	t := time.NewTicker(interval)
@@ -1,12 +1,21 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
 )
 
 type fakeBackend struct {
@@ -153,3 +162,143 @@ func TestReaperDestroysOld(t *testing.T) {
 		t.Error("ancient should be removed from state")
 	}
 }
+
+// fakeEnforcer serves a fixed egress policy, or err, and reports state,
+// the output of egress.StateScript, from every Run.
+type fakeEnforcer struct {
+	policy  sandbox.Policy
+	err     error
+	state   string
+	checked []string
+	applied []string // modes set, then domains allowed
+}
+
+func (e *fakeEnforcer) SetEgressMode(ctx context.Context, name string, mode sandbox.EgressMode) error {
+	e.applied = append(e.applied, string(mode))
+	return nil
+}
+func (e *fakeEnforcer) AllowDomain(ctx context.Context, name, domain string) error {
+	e.applied = append(e.applied, domain)
+	return nil
+}
+func (e *fakeEnforcer) DenyDomain(ctx context.Context, name, domain string) error { return nil }
+func (e *fakeEnforcer) GetPolicy(ctx context.Context, name string) (*sandbox.Policy, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	p := e.policy
+	if len(e.applied) > 0 {
+		p.Domains = nil // as freshly reset
+	}
+	return &p, nil
+}
+func (e *fakeEnforcer) Run(ctx context.Context, name string, opts sandbox.ExecOpts) (int, error) {
+	e.checked = append(e.checked, name)
+	io.WriteString(opts.Stdout, e.state)
+	return 0, nil
+}
+
+func TestReaperEgressDrift(t *testing.T) {
+	s, _ := LoadState(filepath.Join(t.TempDir(), "s.json"))
+	now := time.Date(2026, 4, 27, 10, 0, 0, 0, time.UTC)
+	s.Add(Sandbox{Name: "flushed", Status: "running", CreatedAt: now, LastActivityAt: now})
+	s.Add(Sandbox{Name: "asleep", Status: "stopped", CreatedAt: now, LastActivityAt: now})
+
+	for _, reapply := range []bool{false, true} {
+		enf := &fakeEnforcer{
+			policy: sandbox.Policy{Version: sandbox.PolicyVersion, Mode: sandbox.EgressAllowlist, Domains: []string{"10.0.0.5"}},
+			state:  "T none\n",
+		}
+		r := &Reaper{
+			State:            s,
+			Backend:          &fakeBackend{},
+			IdleStopAfter:    time.Hour,
+			HardDestroyAfter: 24 * time.Hour,
+			Now:              func() time.Time { return now },
+			Egress:           enf,
+			ReapplyEgress:    reapply,
+		}
+		r.Tick(context.Background())
+
+		if !slices.Equal(enf.checked, []string{"flushed"}) {
+			t.Errorf("checked = %v, want only the running sandbox", enf.checked)
+		}
+		want := []string(nil)
+		if reapply {
+			want = []string{"allowlist", "10.0.0.5"}
+		}
+		if !slices.Equal(enf.applied, want) {
+			t.Errorf("reapply=%v: applied = %v, want %v", reapply, enf.applied, want)
+		}
+	}
+}
+
+func TestReaperEgressMissingRecord(t *testing.T) {
+	s, _ := LoadState(filepath.Join(t.TempDir(), "s.json"))
+	now := time.Date(2026, 4, 27, 10, 0, 0, 0, time.UTC)
+	s.Add(Sandbox{Name: "web", Status: "running", CreatedAt: now, LastActivityAt: now})
+
+	var log bytes.Buffer
+	enf := &fakeEnforcer{err: fmt.Errorf("web: %w", egress.ErrNoRecord)}
+	r := &Reaper{
+		State:            s,
+		Backend:          &fakeBackend{},
+		IdleStopAfter:    time.Hour,
+		HardDestroyAfter: 24 * time.Hour,
+		Now:              func() time.Time { return now },
+		Egress:           enf,
+		ReapplyEgress:    true,
+		Log:              slog.New(slog.NewTextHandler(&log, nil)),
+	}
+	r.Tick(context.Background())
+
+	if len(enf.applied) != 0 {
+		t.Errorf("applied = %v, want nothing without a record", enf.applied)
+	}
+	if !strings.Contains(log.String(), "egress drift") || !strings.Contains(log.String(), "policy record") {
+		t.Errorf("log = %q, want the missing record reported as drift", log.String())
+	}
+}
+
+// fakeHostEnforcer records the sandboxes whose host-side rules were
+// refreshed.
+type fakeHostEnforcer struct {
+	refreshed []string
+}
+
+func (h *fakeHostEnforcer) HostState(ctx context.Context, name string, p sandbox.Policy) (egress.State, bool, error) {
+	return egress.State{}, false, nil
+}
+func (h *fakeHostEnforcer) RefreshHost(ctx context.Context, name string) error {
+	h.refreshed = append(h.refreshed, name)
+	return nil
+}
+
+func TestReaperRefreshesHostEgress(t *testing.T) {
+	s, _ := LoadState(filepath.Join(t.TempDir(), "s.json"))
+	now := time.Date(2026, 4, 27, 10, 0, 0, 0, time.UTC)
+	s.Add(Sandbox{Name: "web", Status: "running", CreatedAt: now, LastActivityAt: now})
+	s.Add(Sandbox{Name: "asleep", Status: "stopped", CreatedAt: now, LastActivityAt: now})
+
+	host := &fakeHostEnforcer{}
+	clock := now
+	r := &Reaper{
+		State:            s,
+		Backend:          &fakeBackend{},
+		IdleStopAfter:    24 * time.Hour,
+		HardDestroyAfter: 48 * time.Hour,
+		Now:              func() time.Time { return clock },
+		HostEgress:       host,
+	}
+	r.Tick(context.Background())
+	clock = clock.Add(time.Minute)
+	r.Tick(context.Background())
+	if !slices.Equal(host.refreshed, []string{"web"}) {
+		t.Errorf("refreshed = %v, want web once within the interval", host.refreshed)
+	}
+	clock = clock.Add(egress.RefreshInterval)
+	r.Tick(context.Background())
+	if !slices.Equal(host.refreshed, []string{"web", "web"}) {
+		t.Errorf("refreshed = %v, want web again after the interval", host.refreshed)
+	}
+}
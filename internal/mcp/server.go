@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
@@ -58,15 +59,21 @@ func NewServer(opts ServerOpts, endpointPath string) (http.Handler, *Tools) {
 	addTool(srv, "destroy_sandbox", "Destroy a sandbox and its filesystem.", tools.DestroySandbox)
 	addTool(srv, "start_sandbox", "Start (resume) a stopped sandbox.", tools.StartSandbox)
 	addTool(srv, "stop_sandbox", "Stop (pause) a running sandbox.", tools.StopSandbox)
-	addTool(srv, "list_sandboxes", "List all tracked sandboxes. State is reconciled with the backend at most once every 15s; recently-changed containers may briefly show stale status.", tools.ListSandboxes)
+	addTool(srv, "list_sandboxes", "List all tracked sandboxes. State follows backend lifecycle events as they happen; if the event stream is down it is reconciled at most once every 15s, so recently-changed containers may briefly show stale status.", tools.ListSandboxes)
 	addTool(srv, "list_bases", "List declared base pixels and their status (ready, missing, building, failed).", tools.ListBases)
 	addTool(srv, "exec", "Run a command inside a sandbox.", tools.Exec)
+	addTool(srv, "exec_background", "Start a long-running command (dev server, watcher, test suite) inside a sandbox without waiting for it. Returns a job_id for job_status, job_output and job_kill.", tools.ExecBackground)
+	addTool(srv, "job_status", "Report whether a background job is still running, and its exit code once it has finished.", tools.JobStatus)
+	addTool(srv, "job_output", "Read the stdout and stderr a background job has produced so far (the most recent max_bytes of each, default 1 MiB).", tools.JobOutput)
+	addTool(srv, "job_kill", "Signal a background job and its process group. signal defaults to KILL; TERM, INT, HUP or a number are also accepted.", tools.JobKill)
 	addTool(srv, "write_file", "Write a file inside a sandbox (create or full overwrite). The file is owned by the sandbox exec user so subsequent exec calls can read and modify it.", tools.WriteFile)
 	addTool(srv, "read_file", "Read a file from a sandbox, optionally truncated.", tools.ReadFile)
 	addTool(srv, "list_files", "List files inside a sandbox path.", tools.ListFiles)
 	addTool(srv, "edit_file", "Replace one occurrence of old_string with new_string in a file. Pass replace_all=true to replace every occurrence.", tools.EditFile)
 	addTool(srv, "delete_file", "Delete a single file from a sandbox.", tools.DeleteFile)
 
+	srv.AddReceivingMiddleware(errorPayloads)
+
 	handler := sdk.NewStreamableHTTPHandler(func(r *http.Request) *sdk.Server { return srv }, nil)
 	mux := http.NewServeMux()
 	mux.Handle(endpointPath, handler)
@@ -89,3 +96,39 @@ func adapt[I, O any](fn func(context.Context, I) (O, error)) func(context.Contex
 		return nil, out, err
 	}
 }
+
+// ToolError is the structured content of a failed tool call. Clients branch
+// on Code, which stays stable when messages are reworded.
+type ToolError struct {
+	Error ToolErrorDetail `json:"error"`
+}
+type ToolErrorDetail struct {
+	Code      string `json:"code"` // sandbox.ErrorCode, or "error" for anything else
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"` // true for "unavailable"
+}
+
+// errorPayloads adds a ToolError to failed tool calls. The SDK has already
+// turned the handler's error into text content by this point and kept the
+// error itself on the result.
+func errorPayloads(next sdk.MethodHandler) sdk.MethodHandler {
+	return func(ctx context.Context, method string, req sdk.Request) (sdk.Result, error) {
+		res, err := next(ctx, method, req)
+		if r, ok := res.(*sdk.CallToolResult); ok && r.IsError && r.GetError() != nil {
+			r.StructuredContent = toolError(r.GetError())
+		}
+		return res, err
+	}
+}
+
+func toolError(err error) ToolError {
+	code := sandbox.ErrorCode(err)
+	if code == "" {
+		code = "error"
+	}
+	return ToolError{Error: ToolErrorDetail{
+		Code:      code,
+		Message:   err.Error(),
+		Retryable: errors.Is(err, sandbox.ErrUnavailable),
+	}}
+}
@@ -1,11 +1,15 @@
 package mcp
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"testing"
 	"time"
+
+	sdk "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 func TestNewServerMountsHandler(t *testing.T) {
@@ -32,3 +36,39 @@ func TestNewServerMountsHandler(t *testing.T) {
 		t.Errorf("unexpected 5xx: %d", resp.StatusCode)
 	}
 }
+
+func TestToolErrorsCarryCode(t *testing.T) {
+	st, _ := LoadState(filepath.Join(t.TempDir(), "s.json"))
+	mux, _ := NewServer(ServerOpts{
+		State:          st,
+		Backend:        newFakeSandbox(),
+		Prefix:         "px-mcp-",
+		ExecTimeoutMax: 10 * time.Minute,
+	}, "/mcp")
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := sdk.NewClient(&sdk.Implementation{Name: "test", Version: "0"}, nil)
+	session, err := client.Connect(ctx, &sdk.StreamableClientTransport{Endpoint: srv.URL + "/mcp"}, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+
+	res, err := session.CallTool(ctx, &sdk.CallToolParams{Name: "read_file", Arguments: map[string]any{"name": "px-mcp-gone", "path": "/x"}})
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if !res.IsError {
+		t.Fatal("read_file on an unknown sandbox succeeded")
+	}
+	raw, _ := json.Marshal(res.StructuredContent)
+	var got ToolError
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("structured content %s: %v", raw, err)
+	}
+	if got.Error.Code != "not_found" || got.Error.Retryable || got.Error.Message == "" {
+		t.Errorf("error payload = %+v, want a non-retryable not_found", got.Error)
+	}
+}
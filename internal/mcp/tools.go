@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"al.essio.dev/pkg/shellescape"
@@ -35,12 +36,14 @@ type Tools struct {
 	Builder         *Builder
 	BuildLockDir    string
 	provisionWG     sync.WaitGroup // test affordance: tracks in-flight provisioning goroutines
+	jobs            Jobs           // background processes started by exec_background
 
 	// reconcileTTL controls how often ListSandboxes reconciles in-memory state
 	// against backend reality. Zero defaults to reconcileDefaultTTL.
 	reconcileTTL time.Duration
 	reconcileMu  sync.Mutex
 	lastSync     time.Time
+	watching     atomic.Bool // set while WatchBackend is receiving events
 }
 
 // reconcileDefaultTTL is how often ListSandboxes will query the backend to
@@ -48,6 +51,15 @@ type Tools struct {
 // the window, the next caller pays one round-trip.
 const reconcileDefaultTTL = 15 * time.Second
 
+// reconcileWatchTTL replaces reconcileTTL while backend events keep state
+// current. Polling is only a backstop then, for events missed while the
+// watch was reconnecting.
+const reconcileWatchTTL = 5 * time.Minute
+
+// watchRetryDelay is how long WatchBackend waits before resubscribing after
+// the backend's event stream fails.
+const watchRetryDelay = 10 * time.Second
+
 // WaitProvisioning blocks until all in-flight provisioning goroutines complete.
 // Used by the daemon shutdown path so final State writes (MarkRunning /
 // MarkFailed / SetIP) make it to disk before the process exits.
@@ -186,7 +198,7 @@ func (t *Tools) generateName() string {
 func (t *Tools) requireSandbox(name string) (Sandbox, error) {
 	sb, ok := t.State.Get(name)
 	if !ok {
-		return sb, fmt.Errorf("sandbox %q not found", name)
+		return sb, sandbox.Wrap(sandbox.ErrNotFound, fmt.Errorf("sandbox %q not found", name))
 	}
 	return sb, nil
 }
@@ -360,6 +372,7 @@ func (t *Tools) DestroySandbox(ctx context.Context, in SandboxRef) (Ack, error)
 	// Backend either deleted the instance or it was already gone. Either way,
 	// drop the state record so ghosts don't accumulate.
 	t.State.Remove(in.Name)
+	t.jobs.Forget(in.Name)
 	_ = t.persist()
 	return Ack{OK: true}, nil
 }
@@ -435,6 +448,9 @@ func (t *Tools) reconcileWithBackend(ctx context.Context) {
 	if ttl == 0 {
 		ttl = reconcileDefaultTTL
 	}
+	if t.watching.Load() {
+		ttl = max(ttl, reconcileWatchTTL)
+	}
 	t.reconcileMu.Lock()
 	if time.Since(t.lastSync) < ttl {
 		t.reconcileMu.Unlock()
@@ -474,6 +490,55 @@ func (t *Tools) reconcileWithBackend(ctx context.Context) {
 	}
 }
 
+// WatchBackend keeps state in step with backend lifecycle events until ctx
+// is done, applying the same transitions as reconcileWithBackend as they
+// happen. While events flow, ListSandboxes polls only every
+// reconcileWatchTTL; if the stream fails it falls back to normal polling and
+// WatchBackend resubscribes after watchRetryDelay.
+func (t *Tools) WatchBackend(ctx context.Context) {
+	for {
+		t.watching.Store(true)
+		err := t.Backend.Watch(ctx, func(e sandbox.Event) { t.applyEvent(ctx, e) })
+		t.watching.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		t.log().Warn("backend event stream failed; polling until it reconnects", "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryDelay):
+		}
+	}
+}
+
+// applyEvent updates one tracked sandbox from a backend event. Sandboxes
+// still provisioning are left to the provisioning goroutine, and deletions
+// are left for destroy_sandbox, as in reconcileWithBackend.
+func (t *Tools) applyEvent(ctx context.Context, e sandbox.Event) {
+	sb, ok := t.State.Get(e.Name)
+	if !ok || sb.Status == "provisioning" {
+		return
+	}
+	switch e.Type {
+	case sandbox.EventStarted:
+		inst, err := t.Backend.Get(ctx, e.Name)
+		if err != nil || inst.Status != sandbox.StatusRunning || len(inst.Addresses) == 0 {
+			return
+		}
+		if ip := inst.Addresses[0]; sb.Status != "running" || sb.IP != ip {
+			t.State.MarkRunning(e.Name)
+			t.State.SetIP(e.Name, ip)
+			_ = t.persist()
+		}
+	case sandbox.EventStopped:
+		if sb.Status != "stopped" {
+			t.State.SetStatus(e.Name, "stopped")
+			_ = t.persist()
+		}
+	}
+}
+
 // --- ListBases handler ---
 
 type ListBasesOut struct {
@@ -563,32 +628,9 @@ func (t *Tools) Exec(ctx context.Context, in ExecIn) (ExecOut, error) {
 
 	defer t.Locks.Acquire(sb.Name)()
 
-	// Wrap the command in `env [-C cwd] [KEY=val ...] -- <command>` so cwd and
-	// env take effect regardless of how the backend handles ExecOpts.Env.
-	argv := []string{"env"}
-	if in.Cwd != "" {
-		argv = append(argv, "-C", in.Cwd)
-	}
-	keys := make([]string, 0, len(in.Env))
-	for k := range in.Env {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		argv = append(argv, k+"="+in.Env[k])
-	}
-	argv = append(argv, "--")
-	argv = append(argv, in.Command...)
-
-	// Backends like SSH space-join argv before sending — the remote shell then
-	// re-tokenizes, which silently splits any element containing whitespace or
-	// shell metacharacters (e.g. `bash -c "rm -f /path"`). Shell-escape and
-	// collapse to a single element so re-tokenization recovers the original argv.
-	cmd := []string{shellescape.QuoteCommand(argv)}
-
 	var stdout, stderr strings.Builder
 	exit, err := t.Backend.Run(ctx, sb.Name, sandbox.ExecOpts{
-		Cmd:    cmd,
+		Cmd:    execCommand(in.Command, in.Cwd, in.Env),
 		Stdout: &stdout,
 		Stderr: &stderr,
 	})
@@ -605,6 +647,31 @@ func (t *Tools) Exec(ctx context.Context, in ExecIn) (ExecOut, error) {
 	return out, nil
 }
 
+// execCommand wraps command in `env [-C cwd] [KEY=val ...] -- <command>` so
+// cwd and env take effect regardless of how the backend handles ExecOpts.Env.
+func execCommand(command []string, cwd string, env map[string]string) []string {
+	argv := []string{"env"}
+	if cwd != "" {
+		argv = append(argv, "-C", cwd)
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		argv = append(argv, k+"="+env[k])
+	}
+	argv = append(argv, "--")
+	argv = append(argv, command...)
+
+	// Backends like SSH space-join argv before sending — the remote shell then
+	// re-tokenizes, which silently splits any element containing whitespace or
+	// shell metacharacters (e.g. `bash -c "rm -f /path"`). Shell-escape and
+	// collapse to a single element so re-tokenization recovers the original argv.
+	return []string{shellescape.QuoteCommand(argv)}
+}
+
 // --- File handlers ---
 
 func (t *Tools) WriteFile(ctx context.Context, in WriteFileIn) (WriteFileOut, error) {
@@ -42,7 +42,8 @@ type fakeSandbox struct {
 	containers map[string]sandbox.Instance
 	clonedNew  []cloneCall
 	runs       [][]string
-	deleteErr  error // injected; Delete returns this if non-nil
+	deleteErr  error              // injected; Delete returns this if non-nil
+	events     chan sandbox.Event // Watch delivers these until ctx is done
 }
 
 func newFakeSandbox() *fakeSandbox {
@@ -106,6 +107,12 @@ func (f *fakeSandbox) Delete(ctx context.Context, n string) error {
 	f.deleted = append(f.deleted, n)
 	return f.deleteErr
 }
+func (f *fakeSandbox) UpdateLimits(ctx context.Context, n string, l sandbox.Limits) error {
+	return nil
+}
+func (f *fakeSandbox) Stats(ctx context.Context, n string) (*sandbox.Stats, error) {
+	return &sandbox.Stats{}, nil
+}
 func (f *fakeSandbox) CreateSnapshot(ctx context.Context, n, l string) error {
 	if f.snapshots == nil {
 		f.snapshots = make(map[string]interface{})
@@ -140,6 +147,22 @@ func (f *fakeSandbox) CloneFrom(ctx context.Context, src, lbl, nn string) error
 	f.containers[nn] = sandbox.Instance{Name: nn, Status: sandbox.StatusRunning}
 	return nil
 }
+func (f *fakeSandbox) ExportSnapshot(ctx context.Context, n, l string, w io.Writer) error {
+	return nil
+}
+func (f *fakeSandbox) ImportSnapshot(ctx context.Context, nn string, r io.Reader) error {
+	return nil
+}
+func (f *fakeSandbox) Watch(ctx context.Context, fn func(sandbox.Event)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-f.events:
+			fn(e)
+		}
+	}
+}
 func (f *fakeSandbox) Run(ctx context.Context, n string, o sandbox.ExecOpts) (int, error) {
 	f.runs = append(f.runs, o.Cmd)
 	if f.runHook != nil {
@@ -150,11 +173,21 @@ func (f *fakeSandbox) Run(ctx context.Context, n string, o sandbox.ExecOpts) (in
 func (f *fakeSandbox) Output(ctx context.Context, n string, c []string) ([]byte, error) {
 	return nil, nil
 }
+func (f *fakeSandbox) StartProcess(ctx context.Context, n string, o sandbox.ExecOpts) (sandbox.Process, error) {
+	return nil, errors.New("fakeSandbox: StartProcess not supported")
+}
 func (f *fakeSandbox) Console(ctx context.Context, n string, o sandbox.ConsoleOpts) error { return nil }
 func (f *fakeSandbox) Ready(ctx context.Context, n string, t time.Duration) error         { return nil }
 func (f *fakeSandbox) SetEgressMode(ctx context.Context, n string, m sandbox.EgressMode) error {
 	return nil
 }
+func (f *fakeSandbox) AddForward(ctx context.Context, n string, fw sandbox.Forward) error {
+	return nil
+}
+func (f *fakeSandbox) ListForwards(ctx context.Context, n string) ([]sandbox.Forward, error) {
+	return nil, nil
+}
+func (f *fakeSandbox) RemoveForward(ctx context.Context, n, fw string) error { return nil }
 func (f *fakeSandbox) AllowDomain(ctx context.Context, n, d string) error { return nil }
 func (f *fakeSandbox) DenyDomain(ctx context.Context, n, d string) error  { return nil }
 func (f *fakeSandbox) GetPolicy(ctx context.Context, n string) (*sandbox.Policy, error) {
@@ -206,6 +239,12 @@ func (f *fakeSandbox) DeleteFile(ctx context.Context, name, path string) error {
 	delete(f.files, path)
 	return nil
 }
+func (f *fakeSandbox) WriteArchive(ctx context.Context, name, dir string, r io.Reader) error {
+	return errors.ErrUnsupported
+}
+func (f *fakeSandbox) ReadArchive(ctx context.Context, name, path string, w io.Writer) error {
+	return errors.ErrUnsupported
+}
 
 func newTestTools(t *testing.T) (*Tools, *fakeSandbox) {
 	t.Helper()
@@ -1091,6 +1130,48 @@ func TestListSandboxesCachesBackendQueries(t *testing.T) {
 	}
 }
 
+func TestWatchBackendAppliesEvents(t *testing.T) {
+	tt, fb := newTestTools(t)
+	tt.State.Add(Sandbox{Name: "mcp-a", Status: "running", IP: "10.0.0.1"})
+	tt.State.Add(Sandbox{Name: "mcp-b", Status: "provisioning"})
+	fb.events = make(chan sandbox.Event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tt.WatchBackend(ctx)
+		close(done)
+	}()
+
+	fb.events <- sandbox.Event{Type: sandbox.EventStopped, Name: "mcp-a"}
+	fb.events <- sandbox.Event{Type: sandbox.EventStopped, Name: "mcp-b"}
+	fb.events <- sandbox.Event{Type: sandbox.EventSnapshotCreated, Name: "mcp-a", Snapshot: "x"} // flush
+	if sb, _ := tt.State.Get("mcp-a"); sb.Status != "stopped" {
+		t.Errorf("mcp-a status = %q after stopped event, want stopped", sb.Status)
+	}
+	if sb, _ := tt.State.Get("mcp-b"); sb.Status != "provisioning" {
+		t.Errorf("mcp-b status = %q, want provisioning left alone", sb.Status)
+	}
+
+	fb.mu.Lock()
+	fb.containers["mcp-a"] = sandbox.Instance{Name: "mcp-a", Status: sandbox.StatusRunning, Addresses: []string{"10.0.0.2"}}
+	fb.mu.Unlock()
+	fb.events <- sandbox.Event{Type: sandbox.EventStarted, Name: "mcp-a"}
+	fb.events <- sandbox.Event{Type: sandbox.EventSnapshotCreated, Name: "mcp-a", Snapshot: "x"} // flush
+	if sb, _ := tt.State.Get("mcp-a"); sb.Status != "running" || sb.IP != "10.0.0.2" {
+		t.Errorf("mcp-a = %s/%s after started event, want running/10.0.0.2", sb.Status, sb.IP)
+	}
+	if !tt.watching.Load() {
+		t.Error("watching not set while events flow")
+	}
+
+	cancel()
+	<-done
+	if tt.watching.Load() {
+		t.Error("watching still set after WatchBackend returned")
+	}
+}
+
 func TestDestroySandboxRemovesGhostState(t *testing.T) {
 	tt, be := newTestTools(t)
 	// Pre-seed a state record without a corresponding backend instance — a ghost.
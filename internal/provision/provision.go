@@ -14,6 +14,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/ssh"
 )
 
@@ -215,7 +216,7 @@ func (r *Runner) WaitProvisioned(ctx context.Context, setStatus func(string)) {
 // All steps run concurrently via zmx. Steps with a Finalize script have
 // that script executed after ALL steps complete — this allows egress
 // lockdown to be deferred until devtools finishes downloading.
-func Steps(egress string, devtools bool) []Step {
+func Steps(egressMode string, devtools bool) []Step {
 	var steps []Step
 
 	if devtools {
@@ -225,7 +226,7 @@ func Steps(egress string, devtools bool) []Step {
 		})
 	}
 
-	isRestricted := egress == "agent" || egress == "allowlist"
+	isRestricted := egress.IsRestricted(egressMode)
 	if isRestricted {
 		steps = append(steps, Step{
 			Name:     "px-egress",
@@ -0,0 +1,92 @@
+// Package retention decides which checkpoints a retention policy keeps.
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Policy describes which checkpoints to keep. A checkpoint survives if any
+// rule keeps it; zero fields are ignored.
+type Policy struct {
+	KeepLast  int           // the newest KeepLast checkpoints
+	KeepDaily int           // the newest checkpoint on each of the last KeepDaily days
+	OlderThan time.Duration // checkpoints younger than this
+}
+
+// IsZero reports whether p has no rules. Prune keeps everything under a
+// zero policy rather than nothing, so a missing setting never empties a
+// pixel's checkpoints.
+func (p Policy) IsZero() bool {
+	return p.KeepLast == 0 && p.KeepDaily == 0 && p.OlderThan == 0
+}
+
+// Prune returns the checkpoints in snaps that p doesn't keep, oldest first.
+// Days for KeepDaily are calendar days in now's location. Checkpoints
+// without a creation time are always kept, since their age is unknown.
+func Prune(snaps []sandbox.Snapshot, p Policy, now time.Time) []sandbox.Snapshot {
+	if p.IsZero() {
+		return nil
+	}
+	sorted := make([]sandbox.Snapshot, 0, len(snaps))
+	for _, s := range snaps {
+		if !s.CreatedAt.IsZero() {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedAt.After(sorted[j].CreatedAt) })
+
+	keep := make(map[string]bool)
+	for i := 0; i < p.KeepLast && i < len(sorted); i++ {
+		keep[sorted[i].Label] = true
+	}
+	if p.KeepDaily > 0 {
+		y, m, d := now.Date()
+		cutoff := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1-p.KeepDaily)
+		seen := make(map[string]bool)
+		for _, s := range sorted {
+			t := s.CreatedAt.In(now.Location())
+			day := t.Format(time.DateOnly)
+			if t.Before(cutoff) || seen[day] {
+				continue
+			}
+			seen[day] = true
+			keep[s.Label] = true
+		}
+	}
+
+	var prune []sandbox.Snapshot
+	for i := len(sorted) - 1; i >= 0; i-- {
+		s := sorted[i]
+		if keep[s.Label] || (p.OlderThan > 0 && now.Sub(s.CreatedAt) < p.OlderThan) {
+			continue
+		}
+		prune = append(prune, s)
+	}
+	return prune
+}
+
+// ParseAge parses a duration for Policy.OlderThan. On top of
+// time.ParseDuration units it accepts whole days and weeks, e.g. "7d" or
+// "2w".
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
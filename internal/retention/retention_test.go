@@ -0,0 +1,77 @@
+package retention
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func labels(snaps []sandbox.Snapshot) []string {
+	var out []string
+	for _, s := range snaps {
+		out = append(out, s.Label)
+	}
+	return out
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(label string, ago time.Duration) sandbox.Snapshot {
+		return sandbox.Snapshot{Label: label, CreatedAt: now.Add(-ago)}
+	}
+	snaps := []sandbox.Snapshot{
+		at("d3-late", 3*24*time.Hour-time.Hour), // Mar 7 13:00
+		at("d3-early", 3*24*time.Hour),          // Mar 7 12:00
+		at("d1", 24*time.Hour),                  // Mar 9 12:00
+		at("h2", 2*time.Hour),
+		at("h1", time.Hour),
+		at("now", 0),
+		{Label: "undated"},
+	}
+
+	tests := []struct {
+		name string
+		p    Policy
+		want []string
+	}{
+		{"zero policy keeps everything", Policy{}, nil},
+		{"keep last", Policy{KeepLast: 2}, []string{"d3-early", "d3-late", "d1", "h2"}},
+		{"keep daily", Policy{KeepDaily: 2}, []string{"d3-early", "d3-late", "h2", "h1"}},
+		{"keep daily reaches back", Policy{KeepDaily: 4}, []string{"d3-early", "h2", "h1"}},
+		{"older than", Policy{OlderThan: 36 * time.Hour}, []string{"d3-early", "d3-late"}},
+		{"rules combine", Policy{KeepLast: 1, KeepDaily: 4, OlderThan: 90 * time.Minute}, []string{"d3-early", "h2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := labels(Prune(snaps, tt.p, now))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Prune = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"7d", 7 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"0d", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAge(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "d", "1.5d", "-1d", "-5m", "soon"} {
+		if _, err := ParseAge(in); err == nil {
+			t.Errorf("ParseAge(%q) succeeded, want error", in)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// forwardReadyTimeout bounds how long StartForward waits for the local end
+// of a tunnel to accept connections.
+const forwardReadyTimeout = 15 * time.Second
+
+// forwardArgs builds SSH arguments for a tunnel that forwards listen on
+// this machine to port on the remote host's loopback.
+func forwardArgs(cc ConnConfig, listen string, port int) []string {
+	args := Args(cc)
+	// Insert the tunnel options before user@host (last element).
+	userHost := args[len(args)-1]
+	return append(args[:len(args)-1],
+		"-N",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+		"-L", listen+":127.0.0.1:"+strconv.Itoa(port),
+		userHost,
+	)
+}
+
+// Tunnel identifies a tunnel process started by StartForward. Start is
+// the process's start time as the OS reports it, so a later process that
+// reuses the PID is not mistaken for the tunnel.
+type Tunnel struct {
+	PID   int    `json:"pid"`
+	Start string `json:"start"`
+}
+
+// StartForward starts a detached `ssh -N -L` tunnel and returns it once
+// listen accepts connections. The tunnel outlives the caller; stop it with
+// StopForward. SSH's stderr is appended to logPath.
+func StartForward(ctx context.Context, cc ConnConfig, listen string, port int, logPath string) (Tunnel, error) {
+	sshBin, err := exec.LookPath("ssh")
+	if err != nil {
+		return Tunnel{}, fmt.Errorf("ssh binary not found: %w", err)
+	}
+	// A file rather than a pipe: a pipe would break once this process exits.
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return Tunnel{}, fmt.Errorf("opening tunnel log: %w", err)
+	}
+	defer logFile.Close()
+	logStart, _ := logFile.Seek(0, io.SeekEnd)
+
+	cmd := exec.Command(sshBin, forwardArgs(cc, listen, port)...)
+	cmd.Stderr = logFile
+	applyEnv(cmd, cc)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return Tunnel{}, fmt.Errorf("starting tunnel: %w", err)
+	}
+	// Until it is waited for, the child's PID can't be reused.
+	tun := Tunnel{PID: cmd.Process.Pid}
+	if tun.Start, err = processStart(tun.PID); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return Tunnel{}, fmt.Errorf("reading tunnel start time: %w", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, forwardReadyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return Tunnel{}, fmt.Errorf("tunnel exited: %s", tunnelLog(logPath, logStart))
+		case <-ctx.Done():
+			cmd.Process.Kill()
+			return Tunnel{}, fmt.Errorf("tunnel on %s not ready: %w", listen, ctx.Err())
+		case <-ticker.C:
+			conn, err := net.DialTimeout("tcp", listen, time.Second)
+			if err == nil {
+				conn.Close()
+				return tun, nil
+			}
+		}
+	}
+}
+
+// StopForward terminates a tunnel started by StartForward. A tunnel that
+// has already exited is not an error, and a process that merely reuses
+// its PID is left alone.
+func StopForward(t Tunnel) error {
+	if !ForwardRunning(t) {
+		return nil
+	}
+	p, err := os.FindProcess(t.PID)
+	if err != nil {
+		return nil
+	}
+	if err := p.Kill(); err != nil && ForwardRunning(t) {
+		return fmt.Errorf("stopping tunnel %d: %w", t.PID, err)
+	}
+	return nil
+}
+
+// ForwardRunning reports whether the tunnel process is still alive: its
+// PID is in use and the process there started when the tunnel did. A
+// tunnel recorded without a start time can't be told apart from a reused
+// PID, so it counts as gone.
+func ForwardRunning(t Tunnel) bool {
+	if t.PID <= 0 || t.Start == "" {
+		return false
+	}
+	start, err := processStart(t.PID)
+	return err == nil && start == t.Start
+}
+
+// tunnelLog returns what SSH logged since offset, for error messages.
+func tunnelLog(path string, offset int64) string {
+	data, err := os.ReadFile(path)
+	if err != nil || int64(len(data)) <= offset {
+		return "no output"
+	}
+	return string(bytes.TrimSpace(data[offset:]))
+}
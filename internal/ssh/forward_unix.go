@@ -0,0 +1,14 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts cmd in its own session so it survives the caller's
+// terminal closing.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
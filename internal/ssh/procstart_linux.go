@@ -0,0 +1,34 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// processStart returns the start time of process pid, in clock ticks since
+// boot, from field 22 of /proc/<pid>/stat.
+func processStart(pid int) (string, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", err
+	}
+	return parseStatStart(string(data))
+}
+
+// parseStatStart extracts the start time from a /proc/<pid>/stat line. The
+// command name in field 2 may hold spaces and parentheses, so fields are
+// counted from its closing parenthesis.
+func parseStatStart(stat string) (string, error) {
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return "", fmt.Errorf("malformed stat %q", stat)
+	}
+	// Field 3 (state) is the first after the name.
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 20 {
+		return "", fmt.Errorf("malformed stat %q", stat)
+	}
+	return fields[19], nil
+}
@@ -0,0 +1,59 @@
+package ssh
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestParseStatStart(t *testing.T) {
+	stat := "4242 (ssh (x) y) S 1 4242 4242 0 -1 4194560 120 0 0 0 0 0 0 0 20 0 1 0 987654 12345 100\n"
+	got, err := parseStatStart(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "987654" {
+		t.Errorf("start = %q, want 987654", got)
+	}
+	if _, err := parseStatStart("4242 (ssh) S 1"); err == nil {
+		t.Error("short stat: want error")
+	}
+}
+
+func TestStopForwardChecksStart(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("starting sleep: %v", err)
+	}
+	defer cmd.Process.Kill()
+	start, err := processStart(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tun := Tunnel{PID: cmd.Process.Pid, Start: start}
+	if !ForwardRunning(tun) {
+		t.Fatal("ForwardRunning = false for a live tunnel")
+	}
+
+	// The same PID with another start time is a different process.
+	reused := Tunnel{PID: tun.PID, Start: start + "0"}
+	if ForwardRunning(reused) {
+		t.Error("ForwardRunning = true for a reused PID")
+	}
+	if err := StopForward(reused); err != nil {
+		t.Fatal(err)
+	}
+	if !ForwardRunning(tun) {
+		t.Fatal("StopForward killed a process that only shares the PID")
+	}
+	if ForwardRunning(Tunnel{PID: tun.PID}) {
+		t.Error("ForwardRunning = true without a start time")
+	}
+
+	if err := StopForward(tun); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	if ForwardRunning(tun) {
+		t.Error("tunnel still running after StopForward")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows && !linux
+
+package ssh
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// processStart returns the start time of process pid as ps reports it.
+// Without /proc, ps is the portable way to read it on macOS and the BSDs.
+func processStart(pid int) (string, error) {
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", fmt.Errorf("ps -p %d: %w", pid, err)
+	}
+	start := strings.TrimSpace(string(out))
+	if start == "" {
+		return "", fmt.Errorf("no process %d", pid)
+	}
+	return start, nil
+}
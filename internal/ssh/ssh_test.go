@@ -329,3 +329,15 @@ func TestEnvWithOverrides(t *testing.T) {
 		}
 	})
 }
+
+func TestForwardArgs(t *testing.T) {
+	cc := ConnConfig{Host: "px-web", User: "pixel", KeyPath: "/tmp/key"}
+	args := forwardArgs(cc, "127.0.0.1:8080", 3000)
+	tail := args[len(args)-8:]
+	want := []string{"-N", "-o", "ExitOnForwardFailure=yes", "-o", "ServerAliveInterval=30", "-L", "127.0.0.1:8080:127.0.0.1:3000", "pixel@px-web"}
+	for i := range want {
+		if tail[i] != want[i] {
+			t.Errorf("args[%d] = %q, want %q (args = %v)", i, tail[i], want[i], args)
+		}
+	}
+}
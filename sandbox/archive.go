@@ -0,0 +1,39 @@
+package sandbox
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"al.essio.dev/pkg/shellescape"
+)
+
+// ExtractCommand returns a shell line that extracts a tar stream on stdin
+// into dir, for backends that implement [Files.WriteArchive] with tar. Run
+// it as root so recorded ownership is applied.
+func ExtractCommand(dir string) []string {
+	d := shellescape.Quote(dir)
+	return []string{"mkdir -p -- " + d + " && tar -x -p --numeric-owner -C " + d + " -f -"}
+}
+
+// ArchiveCommand returns a shell line that writes path to stdout as a tar
+// stream rooted at its base name, for backends that implement
+// [Files.ReadArchive] with tar.
+func ArchiveCommand(p string) []string {
+	p = path.Clean(p)
+	return []string{fmt.Sprintf("tar -c --numeric-owner -C %s -f - -- %s",
+		shellescape.Quote(path.Dir(p)), shellescape.Quote(path.Base(p)))}
+}
+
+// ArchiveError turns a failed tar run into an error, wrapping [ErrNotFound]
+// when tar reports the path missing.
+func ArchiveError(p string, exitCode int, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if strings.Contains(stderr, "No such file or directory") {
+		return fmt.Errorf("%s: %w", p, ErrNotFound)
+	}
+	if stderr == "" {
+		return fmt.Errorf("tar %s: exit code %d", p, exitCode)
+	}
+	return fmt.Errorf("tar %s: exit code %d: %s", p, exitCode, stderr)
+}
@@ -0,0 +1,636 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+)
+
+const containerPrefix = "px-"
+
+func prefixed(name string) string   { return containerPrefix + name }
+func unprefixed(name string) string { return strings.TrimPrefix(name, containerPrefix) }
+
+// Labels stamped on containers and snapshot images. The resource limits are
+// recorded at create as a fallback for when HostConfig doesn't carry them.
+// User labels are stored as dev.pixels.label.<key>. labelSnapshotPolicy holds
+// the policy a snapshot was taken with.
+const (
+	labelManaged         = "dev.pixels.managed"
+	labelCPU             = "dev.pixels.cpu"
+	labelMemory          = "dev.pixels.memory"
+	labelImage           = "dev.pixels.image"
+	labelOrigin          = "dev.pixels.origin"
+	labelUserPrefix      = "dev.pixels.label."
+	labelSnapshotCreated = "dev.pixels.snapshot.created"
+	labelSnapshotPolicy  = "dev.pixels.snapshot.egress"
+)
+
+// snapshotRepo is the image repository holding an instance's snapshots.
+func snapshotRepo(name string) string { return "pixels-snapshot/" + prefixed(name) }
+
+// Create creates and starts a new container. Unless opts.Bare is set, the
+// sandbox user is created and the configured egress policy applied.
+func (d *Docker) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.Instance, error) {
+	name := opts.Name
+
+	image := opts.Image
+	if image == "" {
+		image = d.cfg.image
+	}
+	cpu := opts.CPU
+	if cpu == "" {
+		cpu = d.cfg.cpu
+	}
+	memory := opts.Memory
+	if memory == 0 {
+		memory = d.cfg.memory * 1024 * 1024 // MiB → bytes
+	}
+
+	labels := map[string]string{labelImage: image}
+	for k, v := range opts.Labels {
+		labels[labelUserPrefix+k] = v
+	}
+	spec := containerSpec{
+		Image:  imageRef(image),
+		CPU:    cpu,
+		Memory: memory,
+		Binds:  binds(opts.Mounts),
+		Labels: labels,
+	}
+	if err := d.createContainer(ctx, name, spec); err != nil {
+		return nil, err
+	}
+	err := d.writePolicy(prefixed(name), egress.NewPolicy(sandbox.EgressUnrestricted, nil))
+	if err == nil {
+		err = d.setup(ctx, name, opts)
+	}
+	if err != nil {
+		// Don't leave a half-provisioned container behind.
+		_ = d.Delete(context.WithoutCancel(ctx), name)
+		return nil, err
+	}
+	return d.Get(ctx, name)
+}
+
+// setup starts a newly created container and, unless opts.Bare is set,
+// provisions it and applies the egress policy.
+func (d *Docker) setup(ctx context.Context, name string, opts sandbox.CreateOpts) error {
+	if err := d.startContainer(ctx, name); err != nil {
+		return err
+	}
+	if opts.Bare || !d.cfg.provision {
+		return nil
+	}
+	if err := d.provision(ctx, prefixed(name)); err != nil {
+		return fmt.Errorf("provisioning %s: %w", name, err)
+	}
+	if d.cfg.egress != "unrestricted" {
+		if err := d.SetEgressMode(ctx, name, sandbox.EgressMode(d.cfg.egress)); err != nil {
+			return fmt.Errorf("applying egress policy to %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// containerSpec is what createContainer needs to create a container.
+type containerSpec struct {
+	Image  string
+	CPU    string
+	Memory int64 // bytes
+	Binds  []string
+	Labels map[string]string // metadata and user labels; the managed and limit labels are added
+}
+
+// spec returns the spec that recreates c, for restores and clones.
+func (d *Docker) spec(c *containerJSON) containerSpec {
+	cpu, memory := d.limits(c)
+	labels := maps.Clone(c.Config.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return containerSpec{Image: c.Config.Image, CPU: cpu, Memory: memory, Binds: c.binds(), Labels: labels}
+}
+
+// createContainer creates (but does not start) px-name, pulling the image
+// first if the daemon doesn't have it.
+func (d *Docker) createContainer(ctx context.Context, name string, spec containerSpec) error {
+	nano, err := nanoCPUs(spec.CPU)
+	if err != nil {
+		return err
+	}
+	full := prefixed(name)
+	labels := map[string]string{}
+	maps.Copy(labels, spec.Labels)
+	labels[labelManaged] = "true"
+	labels[labelCPU] = spec.CPU
+	labels[labelMemory] = strconv.FormatInt(spec.Memory, 10)
+	body := containerConfig{
+		Image:    spec.Image,
+		Cmd:      []string{"sleep", "infinity"},
+		Hostname: full,
+		Labels:   labels,
+		HostConfig: &hostConfig{
+			NanoCPUs:    nano,
+			Memory:      spec.Memory,
+			Init:        true,
+			CapAdd:      []string{"NET_ADMIN"},
+			DNS:         d.cfg.dns,
+			NetworkMode: d.cfg.network,
+			Binds:       spec.Binds,
+		},
+	}
+	q := url.Values{"name": {full}}
+
+	err = d.api.do(ctx, http.MethodPost, "/containers/create", q, body, &createResponse{})
+	if isStatus(err, http.StatusNotFound) {
+		if err := d.api.pull(ctx, spec.Image); err != nil {
+			return err
+		}
+		err = d.api.do(ctx, http.MethodPost, "/containers/create", q, body, &createResponse{})
+	}
+	if err != nil {
+		return fmt.Errorf("creating container: %w", err)
+	}
+	return nil
+}
+
+// nanoCPUs converts a CPU count such as "2" or "0.5" to Engine API NanoCpus.
+func nanoCPUs(cpu string) (int64, error) {
+	f, err := strconv.ParseFloat(cpu, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cpu %q: %w", cpu, err)
+	}
+	return int64(f * 1e9), nil
+}
+
+func (d *Docker) startContainer(ctx context.Context, name string) error {
+	// 304 Not Modified (already running) is not an error.
+	if err := d.api.do(ctx, http.MethodPost, "/containers/"+prefixed(name)+"/start", nil, nil, nil); err != nil {
+		return fmt.Errorf("starting %s: %w", name, err)
+	}
+	return nil
+}
+
+// inspect returns the container for a bare name.
+func (d *Docker) inspect(ctx context.Context, name string) (*containerJSON, error) {
+	var c containerJSON
+	if err := d.api.do(ctx, http.MethodGet, "/containers/"+prefixed(name)+"/json", nil, nil, &c); err != nil {
+		return nil, fmt.Errorf("getting %s: %w", name, err)
+	}
+	return &c, nil
+}
+
+// Get returns a single instance by bare name.
+func (d *Docker) Get(ctx context.Context, name string) (*sandbox.Instance, error) {
+	c, err := d.inspect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.toInstance(name, c), nil
+}
+
+// List returns all pixels-managed px- containers with the prefix stripped.
+func (d *Docker) List(ctx context.Context) ([]sandbox.Instance, error) {
+	filters, _ := json.Marshal(map[string][]string{"label": {labelManaged + "=true"}})
+	q := url.Values{"all": {"1"}, "filters": {string(filters)}}
+
+	var containers []containerSummary
+	if err := d.api.do(ctx, http.MethodGet, "/containers/json", q, nil, &containers); err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+
+	var result []sandbox.Instance
+	for _, c := range containers {
+		for _, n := range c.Names {
+			n = strings.TrimPrefix(n, "/")
+			if !strings.HasPrefix(n, containerPrefix) || strings.HasSuffix(n, asideSuffix) {
+				continue
+			}
+			// The summary lacks limits and creation time, so inspect each.
+			full, err := d.inspect(ctx, unprefixed(n))
+			if errors.Is(err, sandbox.ErrNotFound) {
+				break // removed since the listing
+			}
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, *d.toInstance(unprefixed(n), full))
+			break
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Start starts a stopped container and reloads its egress rules, which live
+// in the container's network namespace and don't survive a stop.
+func (d *Docker) Start(ctx context.Context, name string) error {
+	if err := d.startContainer(ctx, name); err != nil {
+		return err
+	}
+	d.reloadEgress(ctx, prefixed(name))
+	return nil
+}
+
+// Stop stops a running container. Stopping a stopped container is a no-op.
+func (d *Docker) Stop(ctx context.Context, name string) error {
+	q := url.Values{"t": {"10"}}
+	if err := d.api.do(ctx, http.MethodPost, "/containers/"+prefixed(name)+"/stop", q, nil, nil); err != nil {
+		return fmt.Errorf("stopping %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete force-removes a container and its snapshot images.
+func (d *Docker) Delete(ctx context.Context, name string) error {
+	snaps, _ := d.snapshotImages(ctx, name)
+
+	q := url.Values{"force": {"1"}, "v": {"1"}}
+	if err := d.api.do(ctx, http.MethodDelete, "/containers/"+prefixed(name), q, nil, nil); err != nil {
+		return fmt.Errorf("deleting %s: %w", name, err)
+	}
+
+	// Best-effort: snapshots still used by clones stay behind untagged.
+	for _, s := range snaps {
+		_ = d.deleteImage(ctx, snapshotRepo(name)+":"+s.Label)
+	}
+	return d.removePolicy(prefixed(name))
+}
+
+// UpdateLimits changes CPU and memory on the container in place. The
+// Engine API has no way to resize a container's root filesystem.
+func (d *Docker) UpdateLimits(ctx context.Context, name string, l sandbox.Limits) error {
+	if l.Disk > 0 {
+		return fmt.Errorf("resizing the root disk: %w", errors.ErrUnsupported)
+	}
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	var body updateConfig
+	if l.CPU != "" {
+		nano, err := nanoCPUs(l.CPU)
+		if err != nil {
+			return err
+		}
+		body.NanoCPUs = nano
+	}
+	if l.Memory > 0 {
+		// Keep swap at twice memory, the daemon's default at create;
+		// raising Memory past the old swap limit is otherwise refused.
+		body.Memory, body.MemorySwap = l.Memory, 2*l.Memory
+	}
+	if err := d.api.do(ctx, http.MethodPost, "/containers/"+prefixed(name)+"/update", nil, body, nil); err != nil {
+		return fmt.Errorf("updating limits on %s: %w", name, err)
+	}
+	return nil
+}
+
+// Stats combines a one-shot stats sample with the size of the container's
+// writable layer. Memory excludes the inactive page cache, as docker stats
+// does.
+func (d *Docker) Stats(ctx context.Context, name string) (*sandbox.Stats, error) {
+	var c containerJSON
+	q := url.Values{"size": {"true"}}
+	if err := d.api.do(ctx, http.MethodGet, "/containers/"+prefixed(name)+"/json", q, nil, &c); err != nil {
+		return nil, fmt.Errorf("getting %s: %w", name, err)
+	}
+	var cs containerStats
+	q = url.Values{"stream": {"false"}, "one-shot": {"true"}}
+	if err := d.api.do(ctx, http.MethodGet, "/containers/"+prefixed(name)+"/stats", q, nil, &cs); err != nil {
+		return nil, fmt.Errorf("reading stats for %s: %w", name, err)
+	}
+	st := &sandbox.Stats{
+		CPUTime:    time.Duration(cs.CPUStats.CPUUsage.TotalUsage),
+		Memory:     cs.MemoryStats.Usage,
+		MemoryPeak: cs.MemoryStats.MaxUsage,
+		Disk:       c.SizeRw,
+	}
+	if inactive, ok := cs.MemoryStats.Stats["inactive_file"]; ok && inactive < st.Memory {
+		st.Memory -= inactive
+	}
+	for _, n := range cs.Networks {
+		st.NetRX += n.RxBytes
+		st.NetTX += n.TxBytes
+	}
+	return st, nil
+}
+
+// CreateSnapshot commits the container's filesystem to a snapshot image.
+func (d *Docker) CreateSnapshot(ctx context.Context, name, label string) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	snaps, err := d.snapshotImages(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, s := range snaps {
+		if s.Label == label {
+			return fmt.Errorf("snapshot %s of %s: %w", label, name, sandbox.ErrAlreadyExists)
+		}
+	}
+
+	q := url.Values{
+		"container": {prefixed(name)},
+		"repo":      {snapshotRepo(name)},
+		"tag":       {label},
+		"pause":     {"true"},
+	}
+	body := containerConfig{Labels: map[string]string{
+		labelSnapshotCreated: time.Now().UTC().Format(time.RFC3339Nano),
+	}}
+	// A snapshot of a container whose record is missing is taken without
+	// one, and restoring it reports the same drift.
+	if p, err := d.readPolicy(prefixed(name)); err == nil {
+		body.Labels[labelSnapshotPolicy] = string(egress.MarshalPolicy(*p))
+	} else if !errors.Is(err, egress.ErrNoRecord) {
+		return err
+	}
+	if err := d.api.do(ctx, http.MethodPost, "/commit", q, body, &createResponse{}); err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	return nil
+}
+
+// ListSnapshots returns the instance's snapshot images, oldest first.
+func (d *Docker) ListSnapshots(ctx context.Context, name string) ([]sandbox.Snapshot, error) {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return nil, err
+	}
+	return d.snapshotImages(ctx, name)
+}
+
+// snapshotImages lists the tags of snapshotRepo(name), oldest first.
+func (d *Docker) snapshotImages(ctx context.Context, name string) ([]sandbox.Snapshot, error) {
+	repo := snapshotRepo(name)
+	filters, _ := json.Marshal(map[string][]string{"reference": {repo}})
+	q := url.Values{"filters": {string(filters)}}
+
+	var images []imageSummary
+	if err := d.api.do(ctx, http.MethodGet, "/images/json", q, nil, &images); err != nil {
+		return nil, fmt.Errorf("listing snapshots: %w", err)
+	}
+
+	var result []sandbox.Snapshot
+	for _, img := range images {
+		createdAt := time.Unix(img.Created, 0).UTC()
+		if t, err := time.Parse(time.RFC3339Nano, img.Labels[labelSnapshotCreated]); err == nil {
+			createdAt = t
+		}
+		for _, tag := range img.RepoTags {
+			label, ok := strings.CutPrefix(tag, repo+":")
+			if !ok {
+				continue
+			}
+			result = append(result, sandbox.Snapshot{
+				Label:     label,
+				Size:      img.Size,
+				CreatedAt: createdAt,
+			})
+		}
+	}
+	sort.SliceStable(result, func(a, b int) bool { return result[a].CreatedAt.Before(result[b].CreatedAt) })
+	return result, nil
+}
+
+// requireSnapshot returns an error wrapping sandbox.ErrNotFound if name has
+// no snapshot called label.
+func (d *Docker) requireSnapshot(ctx context.Context, name, label string) error {
+	snaps, err := d.snapshotImages(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, s := range snaps {
+		if s.Label == label {
+			return nil
+		}
+	}
+	return fmt.Errorf("snapshot %s of %s: %w", label, name, sandbox.ErrNotFound)
+}
+
+// DeleteSnapshot removes a snapshot image by label.
+func (d *Docker) DeleteSnapshot(ctx context.Context, name, label string) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	if err := d.deleteImage(ctx, snapshotRepo(name)+":"+label); err != nil {
+		return fmt.Errorf("deleting snapshot: %w", err)
+	}
+	return nil
+}
+
+func (d *Docker) deleteImage(ctx context.Context, ref string) error {
+	q := url.Values{"force": {"1"}}
+	return d.api.do(ctx, http.MethodDelete, "/images/"+ref, q, nil, nil)
+}
+
+// RestoreSnapshot replaces the container with a fresh one created from the
+// snapshot image, keeping its name and resource limits, then starts it.
+// The old container is stopped and renamed aside until its replacement
+// exists, and put back if creating that fails.
+func (d *Docker) RestoreSnapshot(ctx context.Context, name, label string) error {
+	c, err := d.inspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := d.requireSnapshot(ctx, name, label); err != nil {
+		return err
+	}
+	snap, err := d.snapshotPolicy(ctx, name, label)
+	if err != nil {
+		return err
+	}
+
+	full := prefixed(name)
+	aside := full + asideSuffix
+	if c.State.Running {
+		if err := d.Stop(ctx, name); err != nil {
+			return err
+		}
+	}
+	if err := d.rename(ctx, full, aside); err != nil {
+		return fmt.Errorf("moving %s aside for restore: %w", name, err)
+	}
+	spec := d.spec(c)
+	spec.Image = snapshotRepo(name) + ":" + label
+	if err := d.createContainer(ctx, name, spec); err != nil {
+		if rerr := d.rename(ctx, aside, full); rerr != nil {
+			return fmt.Errorf("restoring snapshot: %w (and putting back %s failed, it is left as %s: %v)", err, name, aside, rerr)
+		}
+		if c.State.Running {
+			_ = d.startContainer(ctx, name)
+		}
+		return fmt.Errorf("restoring snapshot: %w", err)
+	}
+
+	q := url.Values{"force": {"1"}, "v": {"1"}}
+	if err := d.api.do(ctx, http.MethodDelete, "/containers/"+aside, q, nil, nil); err != nil {
+		return fmt.Errorf("removing the container replaced by the restore (%s): %w", aside, err)
+	}
+	if err := d.restorePolicy(full, snap); err != nil {
+		return err
+	}
+	return d.Start(ctx, name)
+}
+
+// asideSuffix marks a container moved aside by RestoreSnapshot, which List
+// and Watch leave out.
+const asideSuffix = ".pre-restore"
+
+// rename renames container from to to.
+func (d *Docker) rename(ctx context.Context, from, to string) error {
+	return d.api.do(ctx, http.MethodPost, "/containers/"+from+"/rename", url.Values{"name": {to}}, nil, nil)
+}
+
+// CloneFrom creates newName from source's snapshot image with source's
+// resource limits and the egress policy recorded with the snapshot, then
+// starts it.
+func (d *Docker) CloneFrom(ctx context.Context, source, label, newName string) error {
+	c, err := d.inspect(ctx, source)
+	if err != nil {
+		return fmt.Errorf("getting source instance: %w", err)
+	}
+	if err := d.requireSnapshot(ctx, source, label); err != nil {
+		return err
+	}
+	snap, err := d.snapshotPolicy(ctx, source, label)
+	if err != nil {
+		return err
+	}
+
+	spec := d.spec(c)
+	spec.Image = snapshotRepo(source) + ":" + label
+	spec.Labels[labelOrigin] = source + ":" + label
+	if err := d.createContainer(ctx, newName, spec); err != nil {
+		return fmt.Errorf("creating clone: %w", err)
+	}
+	if err := d.restorePolicy(prefixed(newName), snap); err != nil {
+		return err
+	}
+	if err := d.Start(ctx, newName); err != nil {
+		return fmt.Errorf("starting clone: %w", err)
+	}
+	return nil
+}
+
+// limits returns a container's CPU and memory. The live host config wins,
+// since UpdateLimits can't rewrite the labels recorded at create; the
+// labels and then the configured defaults cover older containers.
+func (d *Docker) limits(c *containerJSON) (string, int64) {
+	cpu := c.Config.Labels[labelCPU]
+	if cpu == "" {
+		cpu = d.cfg.cpu
+	}
+	memory, err := strconv.ParseInt(c.Config.Labels[labelMemory], 10, 64)
+	if err != nil || memory <= 0 {
+		memory = d.cfg.memory * 1024 * 1024
+	}
+	if h := c.HostConfig; h != nil {
+		if h.NanoCPUs > 0 {
+			cpu = strconv.FormatFloat(float64(h.NanoCPUs)/1e9, 'f', -1, 64)
+		}
+		if h.Memory > 0 {
+			memory = h.Memory
+		}
+	}
+	return cpu, memory
+}
+
+// toInstance converts an inspected container. Egress isn't reported: the
+// mode is applied inside the container and labels can't be changed after
+// create to record it.
+func (d *Docker) toInstance(name string, c *containerJSON) *sandbox.Instance {
+	cpu, memory := d.limits(c)
+	out := &sandbox.Instance{
+		Name:        name,
+		Status:      normalizeStatus(c.State.Status),
+		Addresses:   extractAddresses(c.NetworkSettings, false),
+		AddressesV6: extractAddresses(c.NetworkSettings, true),
+		Image:       c.Config.Labels[labelImage],
+		Origin:      c.Config.Labels[labelOrigin],
+		CPU:         cpu,
+		Memory:      memory,
+	}
+	if out.Image == "" {
+		out.Image = c.Config.Image
+	}
+	if t, err := time.Parse(time.RFC3339Nano, c.Created); err == nil {
+		out.CreatedAt = t
+	}
+	for k, v := range c.Config.Labels {
+		if key, ok := strings.CutPrefix(k, labelUserPrefix); ok {
+			if out.Labels == nil {
+				out.Labels = map[string]string{}
+			}
+			out.Labels[key] = v
+		}
+	}
+	return out
+}
+
+// binds converts mounts to Engine API bind specs.
+func binds(mounts []sandbox.Mount) []string {
+	var out []string
+	for _, m := range mounts {
+		out = append(out, m.String())
+	}
+	return out
+}
+
+// binds returns the container's bind mounts, so recreating it from a
+// snapshot keeps them.
+func (c *containerJSON) binds() []string {
+	if c.HostConfig == nil {
+		return nil
+	}
+	return c.HostConfig.Binds
+}
+
+// normalizeStatus maps Engine API container states onto sandbox.Status.
+// Containers that exist but aren't running ("created", "exited", "dead")
+// are reported as stopped.
+func normalizeStatus(s string) sandbox.Status {
+	switch strings.ToLower(s) {
+	case "running":
+		return sandbox.StatusRunning
+	case "created", "exited", "dead":
+		return sandbox.StatusStopped
+	}
+	return sandbox.Status(strings.ToUpper(s))
+}
+
+// extractAddresses returns the container's IPv4 address on each attached
+// network, or with v6 its global IPv6 address on each network that has one.
+func extractAddresses(ns *networkSettings, v6 bool) []string {
+	if ns == nil {
+		return nil
+	}
+	names := make([]string, 0, len(ns.Networks))
+	for n := range ns.Networks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var addrs []string
+	for _, n := range names {
+		ip := ns.Networks[n].IPAddress
+		if v6 {
+			ip = ns.Networks[n].GlobalIPv6Address
+		}
+		if ip != "" {
+			addrs = append(addrs, ip)
+		}
+	}
+	return addrs
+}
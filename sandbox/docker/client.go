@@ -0,0 +1,269 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// apiVersion is the Engine API version requested. 1.41 is served by Docker
+// 20.10+ and by Podman's compat API.
+const apiVersion = "v1.41"
+
+// client is a minimal Docker Engine API client over a unix socket. Only the
+// endpoints the backend needs are wrapped; request and response bodies are
+// the plain JSON wire types declared in types.go.
+type client struct {
+	socket string
+	http   *http.Client
+}
+
+func newClient(socket string) *client {
+	c := &client{socket: socket}
+	c.http = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return c.dial(ctx)
+		},
+	}}
+	return c
+}
+
+func (c *client) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", c.socket)
+}
+
+// apiError is a non-2xx Engine API response.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("docker: %s (HTTP %d)", e.Message, e.Status)
+}
+
+// Is matches responses to the sandbox error kinds. The Engine API says
+// "No such container" / "No such image" for 404s, which WrapNotFound
+// doesn't know, and answers name clashes, commands on stopped containers
+// and removing images in use all with 409, told apart by message.
+func (e *apiError) Is(target error) bool {
+	conflict := e.Status == http.StatusConflict
+	switch target {
+	case sandbox.ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case sandbox.ErrNotRunning:
+		return conflict && strings.Contains(e.Message, "is not running")
+	case sandbox.ErrSnapshotInUse:
+		return conflict && strings.Contains(e.Message, "is being used")
+	case sandbox.ErrAlreadyExists:
+		return conflict && !strings.Contains(e.Message, "is not running") && !strings.Contains(e.Message, "is being used")
+	case sandbox.ErrUnavailable:
+		return e.Status == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// isStatus reports whether err is an apiError with the given status.
+func isStatus(err error, status int) bool {
+	var ae *apiError
+	return errors.As(err, &ae) && ae.Status == status
+}
+
+// newRequest builds a request for path (which excludes the version prefix).
+// A body that is an io.Reader is sent as a tar archive; anything else non-nil
+// is JSON-encoded.
+func (c *client) newRequest(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	u := "http://docker/" + apiVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var r io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		r = b
+		contentType = "application/x-tar"
+	default:
+		buf, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s %s: %w", method, path, err)
+		}
+		r = bytes.NewReader(buf)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// do performs a request and decodes a JSON response into out (if non-nil).
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	rc, err := c.stream(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if out == nil {
+		_, err := io.Copy(io.Discard, rc)
+		return err
+	}
+	if err := json.NewDecoder(rc).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// stream performs a request and returns the raw response body.
+func (c *client) stream(ctx context.Context, method, path string, query url.Values, body any) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, sandbox.WrapError(fmt.Errorf("docker %s %s: %w", method, path, err))
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp.Body, nil
+}
+
+func readError(resp *http.Response) error {
+	var msg struct {
+		Message string `json:"message"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(b, &msg) != nil || msg.Message == "" {
+		msg.Message = strings.TrimSpace(string(b))
+	}
+	return &apiError{Status: resp.StatusCode, Message: msg.Message}
+}
+
+// hijack performs a request that upgrades the connection to a raw stream,
+// as POST /exec/{id}/start does. The caller owns the returned connection;
+// reads must go through the returned reader, which holds any bytes buffered
+// while parsing the response headers.
+func (c *client) hijack(ctx context.Context, path string, body any) (net.Conn, io.Reader, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, path, nil, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("docker POST %s: %w", path, err)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("docker POST %s: %w", path, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("docker POST %s: %w", path, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer conn.Close()
+		return nil, nil, readError(resp)
+	}
+	return conn, br, nil
+}
+
+// demux splits a multiplexed exec stream (8-byte header: stream type, three
+// zero bytes, big-endian payload length) into stdout and stderr.
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if hdr[0] == 2 {
+			w = stderr
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[4:]))
+		if _, err := io.CopyN(w, r, n); err != nil {
+			return err
+		}
+	}
+}
+
+// pullProgress is one line of the JSON progress stream from image pulls
+// and loads.
+type pullProgress struct {
+	Error string `json:"error"`
+}
+
+// pull fetches ref from its registry, consuming the progress stream.
+func (c *client) pull(ctx context.Context, ref string) error {
+	q := url.Values{"fromImage": {ref}}
+	rc, err := c.stream(ctx, http.MethodPost, "/images/create", q, nil)
+	if err != nil {
+		return fmt.Errorf("pulling %s: %w", ref, err)
+	}
+	defer rc.Close()
+	if err := readProgress(rc); err != nil {
+		return fmt.Errorf("pulling %s: %w", ref, err)
+	}
+	return nil
+}
+
+// load imports the images in a docker save tar stream.
+func (c *client) load(ctx context.Context, r io.Reader) error {
+	q := url.Values{"quiet": {"1"}}
+	rc, err := c.stream(ctx, http.MethodPost, "/images/load", q, r)
+	if err != nil {
+		return fmt.Errorf("loading image: %w", err)
+	}
+	defer rc.Close()
+	if err := readProgress(rc); err != nil {
+		return fmt.Errorf("loading image: %w", err)
+	}
+	return nil
+}
+
+// readProgress consumes a JSON progress stream, returning the first error
+// it reports.
+func readProgress(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var p pullProgress
+		if err := dec.Decode(&p); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if p.Error != "" {
+			return errors.New(p.Error)
+		}
+	}
+}
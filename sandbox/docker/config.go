@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox/user"
+)
+
+// dockerCfg holds parsed backend configuration.
+type dockerCfg struct {
+	socket string
+
+	image   string
+	cpu     string
+	memory  int64 // MiB
+	network string
+
+	sshUser string
+	uid     uint32
+	gid     uint32
+
+	provision bool
+	egress    string
+	dnsFilter bool
+	allow     []string
+	dns       []string
+	policyDir string // where egress policy records are kept
+}
+
+// parseCfg extracts a dockerCfg from a flat key-value map.
+func parseCfg(m map[string]string) (*dockerCfg, error) {
+	c := &dockerCfg{
+		socket:    defaultSocket(),
+		image:     "ubuntu:24.04",
+		cpu:       "2",
+		memory:    2048,
+		sshUser:   "pixel",
+		uid:       user.UID,
+		gid:       user.GID,
+		provision: true,
+		egress:    "unrestricted",
+	}
+
+	if v := m["socket"]; v != "" {
+		c.socket = strings.TrimPrefix(v, "unix://")
+	}
+
+	if v := m["image"]; v != "" {
+		c.image = v
+	}
+	if v := m["cpu"]; v != "" {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid cpu %q: %w", v, err)
+		}
+		c.cpu = v
+	}
+	if v := m["memory"]; v != "" {
+		mem, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory %q: %w", v, err)
+		}
+		c.memory = mem
+	}
+	if v := m["network"]; v != "" {
+		c.network = v
+	}
+
+	if v := m["ssh_user"]; v != "" {
+		c.sshUser = v
+	}
+
+	if v := m["provision"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provision %q: %w", v, err)
+		}
+		c.provision = b
+	}
+	if v := m["egress"]; v != "" {
+		if err := egress.ValidateEgress(v); err != nil {
+			return nil, fmt.Errorf("invalid egress %q: %w", v, err)
+		}
+		c.egress = v
+	}
+	if v := m["enforce"]; v != "" && v != "container" {
+		return nil, fmt.Errorf("invalid enforce %q: the docker backend only enforces egress inside the container", v)
+	}
+	if v := m["dns_filter"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns_filter %q: %w", v, err)
+		}
+		c.dnsFilter = b
+	}
+	if v := m["allow"]; v != "" {
+		c.allow = strings.Split(v, ",")
+	}
+	if v := m["dns"]; v != "" {
+		c.dns = strings.Split(v, ",")
+	}
+	c.policyDir = m["policy_dir"]
+	if c.policyDir == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("finding policy_dir: %w", err)
+		}
+		c.policyDir = filepath.Join(dir, "pixels", "policies")
+	}
+
+	return c, nil
+}
+
+// defaultSocket honours a unix:// DOCKER_HOST, falling back to the standard
+// Docker socket. Podman users point "socket" at their podman.sock instead.
+func defaultSocket() string {
+	if h := os.Getenv("DOCKER_HOST"); strings.HasPrefix(h, "unix://") {
+		return strings.TrimPrefix(h, "unix://")
+	}
+	return "/var/run/docker.sock"
+}
+
+// imageRef converts the Incus-style "distro/version" aliases used in shared
+// config (e.g. "ubuntu/24.04") into a Docker reference ("ubuntu:24.04").
+// Anything else is passed through untouched.
+func imageRef(image string) string {
+	if strings.ContainsAny(image, ":@") {
+		return image
+	}
+	repo, version, ok := strings.Cut(image, "/")
+	if !ok || strings.Contains(version, "/") || version == "" || version[0] < '0' || version[0] > '9' {
+		return image
+	}
+	return repo + ":" + version
+}
@@ -0,0 +1,62 @@
+// Package docker implements the sandbox.Sandbox interface against the
+// Docker Engine HTTP API over a unix socket. Podman serves the same API, so
+// pointing "socket" at podman.sock works too.
+//
+// Instances are long-running containers; snapshots are images committed
+// from them (tagged pixels-snapshot/<container>:<label>), and restores and
+// clones recreate a container from such an image. Files move through the
+// archive API and commands through the exec API. Egress filtering uses the
+// same nftables-in-container approach as the Incus backend, so containers
+// are created with CAP_NET_ADMIN.
+package docker
+
+import (
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Compile-time check that Docker implements sandbox.Sandbox.
+var _ sandbox.Sandbox = (*Docker)(nil)
+
+// backendName tags exported checkpoints as docker image archives.
+const backendName = "docker"
+
+func init() {
+	sandbox.Register(backendName, func(cfg map[string]string) (sandbox.Sandbox, error) {
+		return New(cfg)
+	})
+}
+
+// Docker implements sandbox.Sandbox using the Docker Engine API.
+type Docker struct {
+	api *client
+	cfg *dockerCfg
+}
+
+// New creates a Docker sandbox backend from a flat config map. No
+// connection is made until the first call.
+func New(cfg map[string]string) (*Docker, error) {
+	c, err := parseCfg(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Docker{
+		api: newClient(c.socket),
+		cfg: c,
+	}, nil
+}
+
+// Capabilities advertises that the Docker backend supports all optional features.
+func (d *Docker) Capabilities() sandbox.Capabilities {
+	return sandbox.Capabilities{
+		Snapshots:     true,
+		CloneFrom:     true,
+		EgressControl: true,
+		Mounts:        true,
+	}
+}
+
+// Close releases idle connections to the daemon.
+func (d *Docker) Close() error {
+	d.api.http.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,648 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/sandboxtest"
+)
+
+func TestConformance(t *testing.T) {
+	e := newFakeEngine(t, "ubuntu:24.04")
+	sandboxtest.Run(t, func(cfg map[string]string) (sandbox.Sandbox, error) {
+		return New(cfg)
+	}, map[string]string{"socket": e.socket, "policy_dir": t.TempDir()})
+}
+
+func newTestDocker(t *testing.T, cfg map[string]string) (*Docker, *fakeEngine) {
+	t.Helper()
+	e := newFakeEngine(t, "ubuntu:24.04")
+	if cfg == nil {
+		cfg = map[string]string{}
+	}
+	cfg["socket"] = e.socket
+	if cfg["policy_dir"] == "" {
+		cfg["policy_dir"] = t.TempDir()
+	}
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d, e
+}
+
+func TestCreatePullsMissingImage(t *testing.T) {
+	d, e := newTestDocker(t, map[string]string{"image": "ubuntu/24.04", "cpu": "1.5", "memory": "512"})
+	ctx := context.Background()
+
+	inst, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Status != sandbox.StatusRunning || len(inst.Addresses) != 1 {
+		t.Errorf("Create = %+v, want running with one address", inst)
+	}
+	if !e.sawRequest("POST /images/create") {
+		t.Error("image was not pulled")
+	}
+
+	c := e.containers["px-web"]
+	if c == nil {
+		t.Fatal("container px-web not created")
+	}
+	if c.Image != "ubuntu:24.04" {
+		t.Errorf("image = %q, want ubuntu:24.04", c.Image)
+	}
+	if c.Host.NanoCPUs != 1_500_000_000 || c.Host.Memory != 512<<20 {
+		t.Errorf("limits = %d cpu / %d mem, want 1.5 CPUs / 512 MiB", c.Host.NanoCPUs, c.Host.Memory)
+	}
+	if len(c.Host.CapAdd) != 1 || c.Host.CapAdd[0] != "NET_ADMIN" {
+		t.Errorf("CapAdd = %v, want [NET_ADMIN]", c.Host.CapAdd)
+	}
+}
+
+func TestCreateUnknownImage(t *testing.T) {
+	d, _ := newTestDocker(t, map[string]string{"image": "nope:1"})
+	_, err := d.Create(context.Background(), sandbox.CreateOpts{Name: "web"})
+	if err == nil || !strings.Contains(err.Error(), "pull access denied") {
+		t.Errorf("Create = %v, want pull error", err)
+	}
+}
+
+func TestCreateProvisionsUser(t *testing.T) {
+	d, e := newTestDocker(t, map[string]string{"egress": "agent"})
+	ctx := context.Background()
+
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/usr/local/bin/pixels-setup-user.sh", "/etc/profile.d/pixels.sh", "/etc/nftables.conf"} {
+		if _, _, err := e.kernel.ReadFile(ctx, "px-web", p, 0); err != nil {
+			t.Errorf("%s not written: %v", p, err)
+		}
+	}
+	sudoers, _, _ := e.kernel.ReadFile(ctx, "px-web", "/etc/sudoers.d/pixel", 0)
+	if !strings.Contains(string(sudoers), "safe-apt") {
+		t.Errorf("sudoers = %q, want restricted", sudoers)
+	}
+	p, err := d.GetPolicy(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode != sandbox.EgressAgent || !slices.Equal(p.Presets, []string{"agent"}) || len(p.Domains) == 0 {
+		t.Errorf("GetPolicy = %+v, want the agent preset with domains", p)
+	}
+
+	if err := d.AllowDomain(ctx, "web", "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DenyDomain(ctx, "web", "PyPI.org."); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = d.GetPolicy(ctx, "web")
+	if p.Mode != sandbox.EgressAgent || !slices.Equal(p.Allow, []string{"example.com"}) || !slices.Equal(p.Deny, []string{"pypi.org"}) {
+		t.Errorf("GetPolicy after allow and deny = %+v", p)
+	}
+	domains, _, _ := e.kernel.ReadFile(ctx, "px-web", "/etc/pixels-egress-domains", 0)
+	if !strings.Contains(string(domains), "example.com\n") || strings.Contains(string(domains), "pypi.org") {
+		t.Errorf("domains file = %q", domains)
+	}
+}
+
+func TestPolicyRecord(t *testing.T) {
+	dir := t.TempDir()
+	d, _ := newTestDocker(t, map[string]string{"egress": "agent", "policy_dir": dir})
+	ctx := context.Background()
+
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "px-web.json")); err != nil {
+		t.Errorf("policy not recorded on the host: %v", err)
+	}
+
+	// Snapshots carry the policy they were taken with.
+	if err := d.CreateSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AllowDomain(ctx, "web", "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CloneFrom(ctx, "web", "base", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RestoreSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"web", "copy"} {
+		p, err := d.GetPolicy(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Mode != sandbox.EgressAgent || len(p.Allow) != 0 {
+			t.Errorf("GetPolicy(%s) = %+v, want the snapshot's policy", name, p)
+		}
+	}
+
+	// A record that was written and is gone is an error, not unrestricted.
+	if err := os.Remove(filepath.Join(dir, "px-web.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetPolicy(ctx, "web"); !errors.Is(err, egress.ErrNoRecord) {
+		t.Errorf("GetPolicy without a record = %v, want ErrNoRecord", err)
+	}
+
+	if err := d.Delete(ctx, "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "px-copy.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("record after Delete: %v", err)
+	}
+}
+
+func TestPolicyRecordNotFromContainer(t *testing.T) {
+	dir := t.TempDir()
+	d, e := newTestDocker(t, map[string]string{"policy_dir": dir})
+	ctx := context.Background()
+
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Without the host record, nothing the container holds stands in for it.
+	os.Remove(filepath.Join(dir, "px-web.json"))
+	if err := e.kernel.WriteFile(ctx, "px-web", "/etc/pixels-egress-domains", []byte("example.com\n"), 0o644, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetPolicy(ctx, "web"); !errors.Is(err, egress.ErrNoRecord) {
+		t.Errorf("GetPolicy = %v, want ErrNoRecord", err)
+	}
+	if err := d.AllowDomain(ctx, "web", "example.org"); !errors.Is(err, egress.ErrNoRecord) {
+		t.Errorf("AllowDomain = %v, want ErrNoRecord", err)
+	}
+
+	// Setting a mode records a policy again.
+	if err := d.SetEgressMode(ctx, "web", sandbox.EgressLearn); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := d.GetPolicy(ctx, "web"); err != nil || p.Mode != sandbox.EgressLearn {
+		t.Errorf("GetPolicy after learn = %+v, %v", p, err)
+	}
+}
+
+func TestListIgnoresUnmanaged(t *testing.T) {
+	d, e := newTestDocker(t, nil)
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "b", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "a", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+	e.containers["px-a"].Labels = nil
+
+	got, err := d.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "b" {
+		t.Errorf("List = %+v, want only b", got)
+	}
+}
+
+func TestRunAsUser(t *testing.T) {
+	d, _ := newTestDocker(t, nil)
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	rc, err := d.Run(ctx, "web", sandbox.ExecOpts{Cmd: []string{"whoami"}, Stdout: &out})
+	if err != nil || rc != 0 {
+		t.Fatalf("Run = %d, %v", rc, err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "pixel" {
+		t.Errorf("whoami = %q, want pixel", got)
+	}
+
+	out.Reset()
+	if _, err := d.Run(ctx, "web", sandbox.ExecOpts{Cmd: []string{"whoami"}, Stdout: &out, Root: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "root" {
+		t.Errorf("whoami as root = %q, want root", got)
+	}
+
+	out.Reset()
+	rc, err = d.Run(ctx, "web", sandbox.ExecOpts{Cmd: []string{"cat"}, Stdin: strings.NewReader("piped"), Stdout: &out})
+	if err != nil || rc != 0 {
+		t.Fatalf("Run cat = %d, %v", rc, err)
+	}
+	if out.String() != "piped" {
+		t.Errorf("cat = %q, want piped", out.String())
+	}
+}
+
+func TestRestoreKeepsLimits(t *testing.T) {
+	d, e := newTestDocker(t, map[string]string{"cpu": "3"})
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true, Memory: 1 << 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CreateSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RestoreSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	c := e.containers["px-web"]
+	if c.Image != "pixels-snapshot/px-web:base" {
+		t.Errorf("image after restore = %q", c.Image)
+	}
+	if c.Host.NanoCPUs != 3e9 || c.Host.Memory != 1<<30 {
+		t.Errorf("limits after restore = %d / %d", c.Host.NanoCPUs, c.Host.Memory)
+	}
+
+	if err := d.Delete(ctx, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.images) != 1 {
+		t.Errorf("images after Delete = %d, want only the base image", len(e.images))
+	}
+}
+
+func TestRestoreFailureKeepsContainer(t *testing.T) {
+	d, e := newTestDocker(t, nil)
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CreateSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteFile(ctx, "web", "/root/work", []byte("keep"), 0o644, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	e.failCreate = "pixels-snapshot/px-web:base"
+	if err := d.RestoreSnapshot(ctx, "web", "base"); err == nil {
+		t.Fatal("RestoreSnapshot succeeded with a failing create")
+	}
+	inst, err := d.Get(ctx, "web")
+	if err != nil {
+		t.Fatalf("container lost after a failed restore: %v", err)
+	}
+	if inst.Status != sandbox.StatusRunning {
+		t.Errorf("status after a failed restore = %s, want running again", inst.Status)
+	}
+	if data, _, err := d.ReadFile(ctx, "web", "/root/work", 0); err != nil || string(data) != "keep" {
+		t.Errorf("file after a failed restore = %q, %v", data, err)
+	}
+
+	e.failCreate = ""
+	if err := d.RestoreSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.ReadFile(ctx, "web", "/root/work", 0); err == nil {
+		t.Error("restore kept a file written after the snapshot")
+	}
+	if len(e.containers) != 1 {
+		t.Errorf("containers after restore = %d, want the old one removed", len(e.containers))
+	}
+}
+
+func TestCreateFailureRemovesContainer(t *testing.T) {
+	d, e := newTestDocker(t, nil)
+	e.failExec = "pixels-setup-user.sh"
+	if _, err := d.Create(context.Background(), sandbox.CreateOpts{Name: "web"}); err == nil {
+		t.Fatal("Create succeeded with failing provisioning")
+	}
+	if len(e.containers) != 0 {
+		t.Errorf("containers after a failed Create = %d, want none", len(e.containers))
+	}
+}
+
+func TestUpdateLimits(t *testing.T) {
+	d, e := newTestDocker(t, nil)
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true, CPU: "1", Memory: 1 << 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UpdateLimits(ctx, "web", sandbox.Limits{CPU: "2.5", Memory: 2 << 30}); err != nil {
+		t.Fatal(err)
+	}
+	if c := e.containers["px-web"]; c.Host.NanoCPUs != 25e8 || c.Host.Memory != 2<<30 {
+		t.Errorf("limits = %d / %d", c.Host.NanoCPUs, c.Host.Memory)
+	}
+	if err := d.UpdateLimits(ctx, "web", sandbox.Limits{Disk: 40 << 30}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("disk resize error = %v, want ErrUnsupported", err)
+	}
+
+	// A restore recreates the container and must keep the new limits, not
+	// the ones labelled at create.
+	if err := d.CreateSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RestoreSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if c := e.containers["px-web"]; c.Host.NanoCPUs != 25e8 || c.Host.Memory != 2<<30 {
+		t.Errorf("limits after restore = %d / %d", c.Host.NanoCPUs, c.Host.Memory)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	d, _ := newTestDocker(t, nil)
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true}); !errors.Is(err, sandbox.ErrAlreadyExists) {
+		t.Errorf("duplicate Create = %v, want ErrAlreadyExists", err)
+	}
+	if err := d.Stop(ctx, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Run(ctx, "web", sandbox.ExecOpts{Cmd: []string{"true"}}); !errors.Is(err, sandbox.ErrNotRunning) {
+		t.Errorf("Run on a stopped container = %v, want ErrNotRunning", err)
+	}
+	if err := d.Start(ctx, "gone"); sandbox.ErrorCode(err) != "not_found" {
+		t.Errorf("Start of a missing container = %v, want not_found", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	d, e := newTestDocker(t, nil)
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteFile(ctx, "web", "/tmp/blob", make([]byte, 4096), 0o644, sandbox.NoOwner, sandbox.NoOwner); err != nil {
+		t.Fatal(err)
+	}
+	c := e.containers["px-web"]
+	c.Stats.CPUStats.CPUUsage.TotalUsage = 3e9
+	c.Stats.MemoryStats.Usage = 300 << 20
+	c.Stats.MemoryStats.Stats = map[string]int64{"inactive_file": 100 << 20}
+	c.Stats.Networks = map[string]struct {
+		RxBytes int64 `json:"rx_bytes"`
+		TxBytes int64 `json:"tx_bytes"`
+	}{"eth0": {RxBytes: 1000, TxBytes: 200}, "eth1": {RxBytes: 1, TxBytes: 2}}
+
+	st, err := d.Stats(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.CPUTime != 3*time.Second || st.Memory != 200<<20 || st.NetRX != 1001 || st.NetTX != 202 {
+		t.Errorf("stats = %+v", st)
+	}
+	if st.Disk < 4096 {
+		t.Errorf("disk = %d, want at least the 4096 bytes written", st.Disk)
+	}
+}
+
+func TestInstanceMetadata(t *testing.T) {
+	d, _ := newTestDocker(t, nil)
+	ctx := context.Background()
+	labels := map[string]string{"team": "infra", "task": "gh-12"}
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true, CPU: "2", Memory: 1 << 30, Labels: labels}); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := d.Get(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Image != "ubuntu:24.04" || inst.CPU != "2" || inst.Memory != 1<<30 || inst.CreatedAt.IsZero() {
+		t.Errorf("Get = %+v", inst)
+	}
+	if !maps.Equal(inst.Labels, labels) {
+		t.Errorf("labels = %v, want %v", inst.Labels, labels)
+	}
+
+	if err := d.CreateSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RestoreSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CloneFrom(ctx, "web", "base", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"web", "copy"} {
+		inst, err := d.Get(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inst.Image != "ubuntu:24.04" || !maps.Equal(inst.Labels, labels) {
+			t.Errorf("%s after restore/clone = %+v", name, inst)
+		}
+	}
+	if inst, _ := d.Get(ctx, "copy"); inst.Origin != "web:base" {
+		t.Errorf("clone origin = %q, want web:base", inst.Origin)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src, _ := newTestDocker(t, nil)
+	ctx := context.Background()
+	labels := map[string]string{"team": "infra"}
+	if _, err := src.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true, CPU: "2", Memory: 1 << 30, Labels: labels}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.WriteFile(ctx, "web", "/srv/app.txt", []byte("ready"), 0o644, sandbox.NoOwner, sandbox.NoOwner); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CreateSnapshot(ctx, "web", "ready"); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := src.ExportSnapshot(ctx, "web", "ready", &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another daemon, which has never seen the source image.
+	dst, e := newTestDocker(t, nil)
+	if err := dst.ImportSnapshot(ctx, "copy", bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := dst.Get(ctx, "copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inst.Status.IsRunning() || inst.Origin != "web:ready" || inst.CPU != "2" || inst.Memory != 1<<30 || !maps.Equal(inst.Labels, labels) {
+		t.Errorf("imported = %+v", inst)
+	}
+	if got, _, err := dst.ReadFile(ctx, "copy", "/srv/app.txt", 0); err != nil || string(got) != "ready" {
+		t.Errorf("imported file = %q, %v", got, err)
+	}
+	if snaps, _ := dst.ListSnapshots(ctx, "copy"); len(snaps) != 1 || snaps[0].Label != "ready" {
+		t.Errorf("imported snapshots = %+v", snaps)
+	}
+	if _, ok := e.images[snapshotRepo("web")+":ready"]; ok {
+		t.Error("loaded source tag was left behind")
+	}
+
+	// Importing next to the source keeps the source's snapshot.
+	if err := src.ImportSnapshot(ctx, "copy", bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if snaps, _ := src.ListSnapshots(ctx, "web"); len(snaps) != 1 {
+		t.Errorf("source snapshots after import = %+v", snaps)
+	}
+}
+
+func TestMountsSurviveRestore(t *testing.T) {
+	d, e := newTestDocker(t, nil)
+	ctx := context.Background()
+	mounts := []sandbox.Mount{{Source: "/srv/data", Target: "/data", ReadOnly: true}, {Source: "/src", Target: "/src"}}
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true, Mounts: mounts}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/srv/data:/data:ro", "/src:/src"}
+	if got := e.containers["px-web"].Host.Binds; !slices.Equal(got, want) {
+		t.Errorf("binds = %v, want %v", got, want)
+	}
+	if err := d.CreateSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RestoreSnapshot(ctx, "web", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.containers["px-web"].Host.Binds; !slices.Equal(got, want) {
+		t.Errorf("binds after restore = %v, want %v", got, want)
+	}
+}
+
+func TestAPIErrorNotFound(t *testing.T) {
+	err := error(&apiError{Status: http.StatusNotFound, Message: "No such container: px-x"})
+	if !errors.Is(err, sandbox.ErrNotFound) {
+		t.Error("404 should match ErrNotFound")
+	}
+	err = &apiError{Status: http.StatusConflict, Message: "in use"}
+	if errors.Is(err, sandbox.ErrNotFound) {
+		t.Error("409 should not match ErrNotFound")
+	}
+	if !isStatus(err, http.StatusConflict) {
+		t.Error("isStatus(409) = false")
+	}
+}
+
+func TestExtractAddresses(t *testing.T) {
+	ns := &networkSettings{Networks: map[string]endpoint{
+		"bridge": {IPAddress: "172.17.0.2", GlobalIPv6Address: "2001:db8::2"},
+		"v4only": {IPAddress: "172.18.0.2"},
+	}}
+	if got := extractAddresses(ns, false); !slices.Equal(got, []string{"172.17.0.2", "172.18.0.2"}) {
+		t.Errorf("IPv4 = %v", got)
+	}
+	if got := extractAddresses(ns, true); !slices.Equal(got, []string{"2001:db8::2"}) {
+		t.Errorf("IPv6 = %v", got)
+	}
+}
+
+func TestDemux(t *testing.T) {
+	frame := func(stream byte, s string) []byte {
+		return append([]byte{stream, 0, 0, 0, 0, 0, 0, byte(len(s))}, s...)
+	}
+	var in bytes.Buffer
+	in.Write(frame(1, "out1 "))
+	in.Write(frame(2, "err"))
+	in.Write(frame(1, "out2"))
+
+	var stdout, stderr bytes.Buffer
+	if err := demux(&in, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out1 out2" || stderr.String() != "err" {
+		t.Errorf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+
+	if err := demux(bytes.NewReader(frame(1, "short")[:10]), &stdout, &stderr); err == nil {
+		t.Error("truncated frame: want error")
+	}
+}
+
+func TestParseCfg(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "unix:///run/user/1000/podman/podman.sock")
+	c, err := parseCfg(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.socket != "/run/user/1000/podman/podman.sock" {
+		t.Errorf("socket = %q, want DOCKER_HOST path", c.socket)
+	}
+	if c.image != "ubuntu:24.04" || c.cpu != "2" || c.memory != 2048 || !c.provision {
+		t.Errorf("defaults = %+v", c)
+	}
+
+	c, err = parseCfg(map[string]string{"socket": "unix:///tmp/d.sock", "allow": "a.com,b.com", "dns": "1.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.socket != "/tmp/d.sock" || len(c.allow) != 2 || len(c.dns) != 1 {
+		t.Errorf("parsed = %+v", c)
+	}
+
+	for _, bad := range []map[string]string{
+		{"cpu": "two"},
+		{"memory": "lots"},
+		{"provision": "maybe"},
+		{"egress": "open"},
+	} {
+		if _, err := parseCfg(bad); err == nil {
+			t.Errorf("parseCfg(%v): want error", bad)
+		}
+	}
+}
+
+func TestImageRef(t *testing.T) {
+	tests := map[string]string{
+		"ubuntu/24.04":          "ubuntu:24.04",
+		"debian/12":             "debian:12",
+		"ubuntu:24.04":          "ubuntu:24.04",
+		"library/ubuntu":        "library/ubuntu",
+		"ghcr.io/org/img":       "ghcr.io/org/img",
+		"ghcr.io/org/img:1.0":   "ghcr.io/org/img:1.0",
+		"alpine":                "alpine",
+		"img@sha256:abcdef0123": "img@sha256:abcdef0123",
+	}
+	for in, want := range tests {
+		if got := imageRef(in); got != want {
+			t.Errorf("imageRef(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReadyStoppedTimesOut(t *testing.T) {
+	d, _ := newTestDocker(t, nil)
+	ctx := context.Background()
+	if _, err := d.Create(ctx, sandbox.CreateOpts{Name: "web", Bare: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Stop(ctx, "web"); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := d.Get(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Status != sandbox.StatusStopped || inst.Addresses != nil {
+		t.Errorf("Get after Stop = %+v", inst)
+	}
+	if err := d.Ready(ctx, "web", 100*time.Millisecond); err == nil || errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("Ready on stopped = %v, want timeout", err)
+	}
+}
@@ -0,0 +1,826 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/memory"
+)
+
+// fakeEngine is a Docker Engine API server on a unix socket, just
+// functional enough for the backend. Container filesystems and commands are
+// delegated to an in-memory sandbox "kernel": each container and each image
+// is a memory instance, and commits and creates copy filesystems through
+// memory snapshots.
+type fakeEngine struct {
+	socket string
+	kernel *memory.Memory
+
+	mu         sync.Mutex
+	seq        int
+	pullable   map[string]bool
+	containers map[string]*fakeContainer // by name
+	images     map[string]*fakeImage     // by "repo:tag"
+	execs      map[string]*fakeExec
+	requests   []string // "METHOD /path", version prefix stripped
+
+	failCreate string // creating a container from this image fails
+	failExec   string // commands containing this exit 1
+
+	evMu     sync.Mutex
+	watchers []chan eventMessage
+}
+
+type fakeContainer struct {
+	ID      string
+	Name    string
+	Kernel  string // memory instance running it; its name at create
+	Image   string
+	Labels  map[string]string
+	Host    hostConfig
+	Created time.Time
+	Started bool
+	Stats   containerStats // returned as-is by the stats endpoint
+}
+
+type fakeImage struct {
+	ID      string
+	Kernel  string // memory instance holding the filesystem
+	Labels  map[string]string
+	Created time.Time
+}
+
+type fakeExec struct {
+	ID        string
+	Container string
+	Config    execConfig
+	Running   bool
+	ExitCode  int
+}
+
+// newFakeEngine starts a fake engine that can "pull" the given images.
+func newFakeEngine(t *testing.T, pullable ...string) *fakeEngine {
+	t.Helper()
+
+	kernel, err := memory.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Package managers, nft and the pixels scripts all succeed.
+	kernel.Handle("*", func(context.Context, *memory.Cmd) int { return 0 })
+
+	// Keep the socket path short: sun_path is limited to ~108 bytes.
+	dir, err := os.MkdirTemp("", "pxd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	e := &fakeEngine{
+		socket:     filepath.Join(dir, "docker.sock"),
+		kernel:     kernel,
+		pullable:   map[string]bool{},
+		containers: map[string]*fakeContainer{},
+		images:     map[string]*fakeImage{},
+		execs:      map[string]*fakeExec{},
+	}
+	for _, ref := range pullable {
+		e.pullable[ref] = true
+	}
+
+	ln, err := net.Listen("unix", e.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: e.routes()}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return e
+}
+
+func (e *fakeEngine) routes() http.Handler {
+	mux := http.NewServeMux()
+	v := "/" + apiVersion
+	mux.HandleFunc("POST "+v+"/containers/create", e.createContainer)
+	mux.HandleFunc("GET "+v+"/containers/json", e.listContainers)
+	mux.HandleFunc("GET "+v+"/containers/{name}/json", e.inspectContainer)
+	mux.HandleFunc("POST "+v+"/containers/{name}/start", e.startContainer)
+	mux.HandleFunc("POST "+v+"/containers/{name}/stop", e.stopContainer)
+	mux.HandleFunc("DELETE "+v+"/containers/{name}", e.deleteContainer)
+	mux.HandleFunc("POST "+v+"/containers/{name}/rename", e.renameContainer)
+	mux.HandleFunc("POST "+v+"/containers/{name}/update", e.updateContainer)
+	mux.HandleFunc("GET "+v+"/containers/{name}/stats", e.containerStats)
+	mux.HandleFunc("POST "+v+"/containers/{name}/exec", e.createExec)
+	mux.HandleFunc("HEAD "+v+"/containers/{name}/archive", e.statArchive)
+	mux.HandleFunc("GET "+v+"/containers/{name}/archive", e.getArchive)
+	mux.HandleFunc("PUT "+v+"/containers/{name}/archive", e.putArchive)
+	mux.HandleFunc("POST "+v+"/exec/{id}/start", e.startExec)
+	mux.HandleFunc("GET "+v+"/exec/{id}/json", e.inspectExec)
+	mux.HandleFunc("POST "+v+"/exec/{id}/resize", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("POST "+v+"/commit", e.commit)
+	mux.HandleFunc("GET "+v+"/images/json", e.listImages)
+	mux.HandleFunc("POST "+v+"/images/create", e.pullImage)
+	mux.HandleFunc("GET "+v+"/images/get", e.saveImage)
+	mux.HandleFunc("POST "+v+"/images/load", e.loadImage)
+	mux.HandleFunc("DELETE "+v+"/images/{ref...}", e.deleteImage)
+	mux.HandleFunc("GET "+v+"/events", e.events)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		e.requests = append(e.requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, v))
+		e.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// sawRequest reports whether a request matching "METHOD /path" was served.
+func (e *fakeEngine) sawRequest(req string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.requests {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *fakeEngine) nextID() string {
+	e.seq++
+	return fmt.Sprintf("%064x", e.seq)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"message": fmt.Sprintf(format, args...)})
+}
+
+// container looks up a container, writing a 404 if it doesn't exist.
+func (e *fakeEngine) container(w http.ResponseWriter, r *http.Request) (*fakeContainer, bool) {
+	e.mu.Lock()
+	c, ok := e.containers[r.PathValue("name")]
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: %s", r.PathValue("name"))
+	}
+	return c, ok
+}
+
+func (e *fakeEngine) running(c *fakeContainer) bool {
+	inst, err := e.kernel.Get(context.Background(), c.Kernel)
+	return err == nil && inst.Status.IsRunning()
+}
+
+// instanceFromImage copies an image's filesystem into a new, stopped
+// memory instance.
+func (e *fakeEngine) instanceFromImage(ctx context.Context, img *fakeImage, name string) error {
+	if err := e.kernel.CreateSnapshot(ctx, img.Kernel, "copy"); err != nil {
+		return err
+	}
+	defer e.kernel.DeleteSnapshot(ctx, img.Kernel, "copy")
+	if err := e.kernel.CloneFrom(ctx, img.Kernel, "copy", name); err != nil {
+		return err
+	}
+	return e.kernel.Stop(ctx, name)
+}
+
+func (e *fakeEngine) createContainer(w http.ResponseWriter, r *http.Request) {
+	var body containerConfig
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	name := r.URL.Query().Get("name")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.containers[name]; ok {
+		writeError(w, http.StatusConflict, "Conflict. The container name %q is already in use", "/"+name)
+		return
+	}
+	img, ok := e.images[body.Image]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: %s", body.Image)
+		return
+	}
+	if body.Image == e.failCreate {
+		writeError(w, http.StatusInternalServerError, "failed to create container from %s", body.Image)
+		return
+	}
+	// The kernel instance keeps the name a container was created with, so
+	// one renamed aside still holds it.
+	id := e.nextID()
+	kernel := name
+	if _, err := e.kernel.Get(r.Context(), kernel); err == nil {
+		kernel = "container-" + id[len(id)-8:]
+	}
+	if err := e.instanceFromImage(r.Context(), img, kernel); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	// Like the daemon, the container inherits the image's labels.
+	labels := maps.Clone(img.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	maps.Copy(labels, body.Labels)
+	c := &fakeContainer{ID: id, Name: name, Kernel: kernel, Image: body.Image, Labels: labels, Created: time.Now()}
+	if body.HostConfig != nil {
+		c.Host = *body.HostConfig
+	}
+	e.containers[name] = c
+	e.emit("container", "create", c.ID, name)
+	writeJSON(w, http.StatusCreated, createResponse{ID: c.ID})
+}
+
+func (e *fakeEngine) state(c *fakeContainer) (string, *networkSettings) {
+	inst, err := e.kernel.Get(context.Background(), c.Kernel)
+	if err != nil || !inst.Status.IsRunning() {
+		if c.Started {
+			return "exited", nil
+		}
+		return "created", nil
+	}
+	ns := &networkSettings{Networks: map[string]endpoint{}}
+	for _, a := range inst.Addresses {
+		ns.Networks["bridge"] = endpoint{IPAddress: a}
+	}
+	return "running", ns
+}
+
+func (e *fakeEngine) inspectContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	status, ns := e.state(c)
+	out := containerJSON{
+		ID:              c.ID,
+		Name:            "/" + c.Name,
+		Created:         c.Created.Format(time.RFC3339Nano),
+		State:           containerState{Status: status, Running: status == "running"},
+		Config:          containerConfig{Image: c.Image, Labels: c.Labels},
+		HostConfig:      &c.Host,
+		NetworkSettings: ns,
+	}
+	if r.URL.Query().Get("size") == "true" {
+		st, err := e.kernel.Stats(r.Context(), c.Kernel)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		out.SizeRw = st.Disk
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (e *fakeEngine) containerStats(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Stats)
+}
+
+func (e *fakeEngine) listContainers(w http.ResponseWriter, r *http.Request) {
+	var filters map[string][]string
+	if f := r.URL.Query().Get("filters"); f != "" {
+		json.Unmarshal([]byte(f), &filters)
+	}
+
+	e.mu.Lock()
+	var cs []*fakeContainer
+	for _, c := range e.containers {
+		cs = append(cs, c)
+	}
+	e.mu.Unlock()
+
+	out := []containerSummary{}
+	for _, c := range cs {
+		match := true
+		for _, l := range filters["label"] {
+			k, v, _ := strings.Cut(l, "=")
+			if c.Labels[k] != v {
+				match = false
+			}
+		}
+		if !match {
+			continue
+		}
+		status, ns := e.state(c)
+		out = append(out, containerSummary{ID: c.ID, Names: []string{"/" + c.Name}, State: status, Labels: c.Labels, NetworkSettings: ns})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (e *fakeEngine) startContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	if e.running(c) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if err := e.kernel.Start(r.Context(), c.Kernel); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	e.mu.Lock()
+	c.Started = true
+	e.mu.Unlock()
+	e.emit("container", "start", c.ID, c.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *fakeEngine) stopContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	if !e.running(c) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if err := e.kernel.Stop(r.Context(), c.Kernel); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	e.emit("container", "die", c.ID, c.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *fakeEngine) updateContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	var body updateConfig
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if body.NanoCPUs > 0 {
+		c.Host.NanoCPUs = body.NanoCPUs
+	}
+	if body.Memory > 0 {
+		c.Host.Memory = body.Memory
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"Warnings": []string{}})
+}
+
+func (e *fakeEngine) deleteContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	if e.running(c) && r.URL.Query().Get("force") != "1" {
+		writeError(w, http.StatusConflict, "cannot remove container %q: container is running", c.Name)
+		return
+	}
+	e.kernel.Delete(r.Context(), c.Kernel)
+	e.mu.Lock()
+	delete(e.containers, c.Name)
+	e.mu.Unlock()
+	e.emit("container", "destroy", c.ID, c.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *fakeEngine) renameContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	to := r.URL.Query().Get("name")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.containers[to]; ok {
+		writeError(w, http.StatusConflict, "Conflict. The container name %q is already in use", "/"+to)
+		return
+	}
+	delete(e.containers, c.Name)
+	c.Name = to
+	e.containers[to] = c
+	e.emit("container", "rename", c.ID, to)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *fakeEngine) createExec(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	if !e.running(c) {
+		writeError(w, http.StatusConflict, "container %s is not running", c.ID)
+		return
+	}
+	var body execConfig
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	e.mu.Lock()
+	x := &fakeExec{ID: e.nextID(), Container: c.Kernel, Config: body}
+	e.execs[x.ID] = x
+	e.mu.Unlock()
+	writeJSON(w, http.StatusCreated, createResponse{ID: x.ID})
+}
+
+// frameWriter writes one stream of the multiplexed exec protocol.
+type frameWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	stream byte
+}
+
+func (f frameWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var hdr [8]byte
+	hdr[0] = f.stream
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(p)))
+	if _, err := f.w.Write(hdr[:]); err != nil {
+		return 0, err
+	}
+	return f.w.Write(p)
+}
+
+func (e *fakeEngine) startExec(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	x, ok := e.execs[r.PathValue("id")]
+	if ok {
+		x.Running = true
+	}
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such exec instance: %s", r.PathValue("id"))
+		return
+	}
+
+	e.emit("container", "exec_start: "+strings.Join(x.Config.Cmd, " "), x.Container, x.Container)
+
+	// Consume the start body before hijacking, so the connection carries
+	// only stdin from here on.
+	var start execStart
+	json.NewDecoder(r.Body).Decode(&start)
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprint(rw, "HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	rw.Flush()
+
+	var stdin io.Reader
+	if x.Config.AttachStdin {
+		stdin = rw.Reader
+	}
+	var mu sync.Mutex
+	var stdout, stderr io.Writer = frameWriter{&mu, conn, 1}, frameWriter{&mu, conn, 2}
+	if x.Config.Tty {
+		stdout, stderr = conn, conn
+	}
+
+	root := x.Config.User == "" || x.Config.User == "root" || strings.HasPrefix(x.Config.User, "0:")
+	rc, err := e.kernel.Run(r.Context(), x.Container, sandbox.ExecOpts{
+		Cmd:    x.Config.Cmd,
+		Env:    x.Config.Env,
+		Root:   root,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		rc = 126
+	}
+	if e.failExec != "" && strings.Contains(strings.Join(x.Config.Cmd, " "), e.failExec) {
+		rc = 1
+	}
+
+	e.mu.Lock()
+	x.Running, x.ExitCode = false, rc
+	e.mu.Unlock()
+}
+
+func (e *fakeEngine) inspectExec(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	x, ok := e.execs[r.PathValue("id")]
+	var out execInspect
+	if ok {
+		out = execInspect{Running: x.Running, ExitCode: x.ExitCode}
+	}
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such exec instance: %s", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// stat reports whether p exists in the container, and whether it is a
+// directory.
+func (e *fakeEngine) stat(ctx context.Context, name, p string) (exists, dir bool) {
+	if _, _, err := e.kernel.ReadFile(ctx, name, p, 0); err == nil {
+		return true, false
+	}
+	if _, err := e.kernel.ListFiles(ctx, name, p, false); err == nil {
+		return true, true
+	}
+	return false, false
+}
+
+func (e *fakeEngine) statArchive(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	if exists, _ := e.stat(r.Context(), c.Kernel, r.URL.Query().Get("path")); !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (e *fakeEngine) getArchive(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	p := r.URL.Query().Get("path")
+	if exists, _ := e.stat(r.Context(), c.Kernel, p); !exists {
+		writeError(w, http.StatusNotFound, "Could not find the file %s in container %s", p, c.Name)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	e.kernel.ReadArchive(r.Context(), c.Kernel, p, w)
+}
+
+func (e *fakeEngine) putArchive(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.container(w, r)
+	if !ok {
+		return
+	}
+	dir := r.URL.Query().Get("path")
+	if exists, isDir := e.stat(r.Context(), c.Kernel, dir); !exists || !isDir {
+		writeError(w, http.StatusNotFound, "Could not find the file %s in container %s", dir, c.Name)
+		return
+	}
+	if err := e.kernel.WriteArchive(r.Context(), c.Kernel, dir, r.Body); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (e *fakeEngine) commit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	e.mu.Lock()
+	c, ok := e.containers[q.Get("container")]
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: %s", q.Get("container"))
+		return
+	}
+	var body containerConfig
+	json.NewDecoder(r.Body).Decode(&body)
+
+	ctx := r.Context()
+	e.mu.Lock()
+	img := &fakeImage{ID: "sha256:" + e.nextID(), Labels: body.Labels, Created: time.Now()}
+	e.mu.Unlock()
+	img.Kernel = "image-" + img.ID[len(img.ID)-8:]
+	if err := e.kernel.CreateSnapshot(ctx, c.Kernel, "commit"); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	defer e.kernel.DeleteSnapshot(ctx, c.Kernel, "commit")
+	if err := e.kernel.CloneFrom(ctx, c.Kernel, "commit", img.Kernel); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+
+	ref := q.Get("repo") + ":" + q.Get("tag")
+	e.mu.Lock()
+	e.images[ref] = img
+	e.mu.Unlock()
+	e.emit("image", "tag", img.ID, ref)
+	writeJSON(w, http.StatusCreated, createResponse{ID: img.ID})
+}
+
+func (e *fakeEngine) listImages(w http.ResponseWriter, r *http.Request) {
+	var filters map[string][]string
+	if f := r.URL.Query().Get("filters"); f != "" {
+		json.Unmarshal([]byte(f), &filters)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	byID := map[string]*imageSummary{}
+	for ref, img := range e.images {
+		repo := ref[:strings.LastIndex(ref, ":")]
+		if want := filters["reference"]; len(want) > 0 && want[0] != repo {
+			continue
+		}
+		s, ok := byID[img.ID]
+		if !ok {
+			s = &imageSummary{ID: img.ID, Created: img.Created.Unix(), Size: 1, Labels: img.Labels}
+			byID[img.ID] = s
+		}
+		s.RepoTags = append(s.RepoTags, ref)
+	}
+	out := []imageSummary{}
+	for _, s := range byID {
+		sort.Strings(s.RepoTags)
+		out = append(out, *s)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (e *fakeEngine) pullImage(w http.ResponseWriter, r *http.Request) {
+	ref := r.URL.Query().Get("fromImage")
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.pullable[ref] {
+		enc.Encode(map[string]string{"error": "pull access denied for " + ref})
+		return
+	}
+	img := &fakeImage{ID: "sha256:" + e.nextID(), Created: time.Now()}
+	img.Kernel = "image-" + img.ID[len(img.ID)-8:]
+	if _, err := e.kernel.Create(r.Context(), sandbox.CreateOpts{Name: img.Kernel, Image: ref, Bare: true}); err != nil {
+		enc.Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	e.images[ref] = img
+	enc.Encode(map[string]string{"status": "Pulling from " + ref})
+	enc.Encode(map[string]string{"status": "Downloaded newer image for " + ref})
+}
+
+// savedImage heads the fake engine's docker save format: a tar holding this
+// as image.json, then the image filesystem as a memory checkpoint archive.
+type savedImage struct {
+	Ref    string
+	Labels map[string]string
+}
+
+func (e *fakeEngine) saveImage(w http.ResponseWriter, r *http.Request) {
+	ref := r.URL.Query().Get("names")
+	e.mu.Lock()
+	img, ok := e.images[ref]
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: %s", ref)
+		return
+	}
+
+	ctx := r.Context()
+	var fs bytes.Buffer
+	if err := e.kernel.CreateSnapshot(ctx, img.Kernel, "save"); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	defer e.kernel.DeleteSnapshot(ctx, img.Kernel, "save")
+	if err := e.kernel.ExportSnapshot(ctx, img.Kernel, "save", &fs); err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	meta, _ := json.Marshal(savedImage{Ref: ref, Labels: img.Labels})
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	tw := tar.NewWriter(w)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"image.json", meta}, {"kernel", fs.Bytes()}} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data))})
+		tw.Write(f.data)
+	}
+	tw.Close()
+}
+
+// emit sends an event to every open /events stream.
+func (e *fakeEngine) emit(typ, action, id, name string) {
+	m := eventMessage{Type: typ, Action: action, TimeNano: time.Now().UnixNano()}
+	m.Actor.ID = id
+	m.Actor.Attributes = map[string]string{"name": name}
+	e.evMu.Lock()
+	defer e.evMu.Unlock()
+	for _, ch := range e.watchers {
+		select {
+		case ch <- m:
+		default: // a stalled reader drops events, as the daemon would
+		}
+	}
+}
+
+// events streams events until the client goes away. Filters are ignored;
+// the backend drops anything it doesn't know.
+func (e *fakeEngine) events(w http.ResponseWriter, r *http.Request) {
+	ch := make(chan eventMessage, 64)
+	e.evMu.Lock()
+	e.watchers = append(e.watchers, ch)
+	e.evMu.Unlock()
+	defer func() {
+		e.evMu.Lock()
+		e.watchers = slices.DeleteFunc(e.watchers, func(c chan eventMessage) bool { return c == ch })
+		e.evMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m := <-ch:
+			enc.Encode(m)
+			rc.Flush()
+		}
+	}
+}
+
+func (e *fakeEngine) loadImage(w http.ResponseWriter, r *http.Request) {
+	var meta savedImage
+	var fs []byte
+	tr := tar.NewReader(r.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		data, _ := io.ReadAll(tr)
+		switch hdr.Name {
+		case "image.json":
+			json.Unmarshal(data, &meta)
+		case "kernel":
+			fs = data
+		}
+	}
+
+	e.mu.Lock()
+	img := &fakeImage{ID: "sha256:" + e.nextID(), Labels: meta.Labels, Created: time.Now()}
+	e.mu.Unlock()
+	img.Kernel = "image-" + img.ID[len(img.ID)-8:]
+	if err := e.kernel.ImportSnapshot(r.Context(), img.Kernel, bytes.NewReader(fs)); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	e.mu.Lock()
+	e.images[meta.Ref] = img
+	e.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"stream": "Loaded image: " + meta.Ref + "\n"})
+}
+
+func (e *fakeEngine) deleteImage(w http.ResponseWriter, r *http.Request) {
+	ref := r.PathValue("ref")
+	e.mu.Lock()
+	img, ok := e.images[ref]
+	delete(e.images, ref)
+	shared := false
+	for _, other := range e.images {
+		shared = shared || other == img
+	}
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: %s", ref)
+		return
+	}
+	if !shared {
+		e.kernel.Delete(r.Context(), img.Kernel)
+	}
+	writeJSON(w, http.StatusOK, []map[string]string{{"Untagged": ref}})
+}
@@ -0,0 +1,248 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/deevus/pixels/internal/retry"
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Run executes a command inside a sandbox instance and returns its exit code.
+func (d *Docker) Run(ctx context.Context, name string, opts sandbox.ExecOpts) (int, error) {
+	ec := execConfig{
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          shellWrap(opts.Cmd),
+		Env:          opts.Env,
+	}
+	if !opts.Root && d.cfg.uid != 0 {
+		d.applyUser(&ec)
+	}
+	return d.exec(ctx, name, ec, opts.Stdin, opts.Stdout, opts.Stderr, nil)
+}
+
+// StartProcess runs a command in the background on its own exec instance.
+// Signals are sent with `kill` from a second exec as root.
+func (d *Docker) StartProcess(ctx context.Context, name string, opts sandbox.ExecOpts) (sandbox.Process, error) {
+	run := func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error) {
+		return d.Run(ctx, name, sandbox.ExecOpts{
+			Cmd:    cmd,
+			Env:    opts.Env,
+			Stdout: stdout,
+			Stderr: stderr,
+			Root:   opts.Root,
+		})
+	}
+	signal := func(ctx context.Context, pid int, sig syscall.Signal) error {
+		_, err := d.Output(ctx, name, sandbox.KillCommand(pid, sig))
+		return err
+	}
+	return sandbox.RunInBackground(ctx, opts.Cmd, run, signal)
+}
+
+// Output executes a command as root and returns its stdout.
+func (d *Docker) Output(ctx context.Context, name string, cmd []string) ([]byte, error) {
+	var stdout bytes.Buffer
+	rc, err := d.exec(ctx, name, execConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          shellWrap(cmd),
+	}, nil, &stdout, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rc != 0 {
+		return stdout.Bytes(), fmt.Errorf("command exited with code %d", rc)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Console attaches an interactive TTY session to a container.
+func (d *Docker) Console(ctx context.Context, name string, opts sandbox.ConsoleOpts) error {
+	cmd := opts.RemoteCmd
+	if len(cmd) == 0 {
+		cmd = []string{"bash", "-l"}
+	}
+	ec := execConfig{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          true,
+		Cmd:          cmd,
+		Env:          opts.Env,
+	}
+	if d.cfg.uid != 0 {
+		d.applyUser(&ec)
+	}
+
+	fd := int(os.Stdin.Fd())
+	var resize func(id string)
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("setting raw terminal: %w", err)
+		}
+		defer term.Restore(fd, oldState)
+
+		resize = func(id string) {
+			w, h, err := term.GetSize(fd)
+			if err != nil {
+				return
+			}
+			q := url.Values{"w": {strconv.Itoa(w)}, "h": {strconv.Itoa(h)}}
+			_ = d.api.do(ctx, http.MethodPost, "/exec/"+id+"/resize", q, nil, nil)
+		}
+	}
+
+	rc, err := d.exec(ctx, name, ec, os.Stdin, os.Stdout, os.Stderr, resize)
+	if err != nil {
+		return fmt.Errorf("console on %s: %w", name, err)
+	}
+	if rc != 0 {
+		return fmt.Errorf("console exited with code %d", rc)
+	}
+	return nil
+}
+
+// Ready waits until the container is running. There is no SSH to wait for:
+// every Exec and Files call goes through the Engine API.
+func (d *Docker) Ready(ctx context.Context, name string, timeout time.Duration) error {
+	err := retry.Poll(ctx, time.Second, timeout, func(ctx context.Context) (bool, error) {
+		c, err := d.inspect(ctx, name)
+		if errors.Is(err, sandbox.ErrNotFound) {
+			return false, err
+		}
+		if err != nil {
+			return false, nil
+		}
+		return c.State.Running, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for %s to be ready: %w", name, err)
+	}
+	return nil
+}
+
+// exec creates an exec instance, attaches to it and waits for the command
+// to exit. started, if non-nil, is called with the exec ID once attached.
+func (d *Docker) exec(ctx context.Context, name string, ec execConfig, stdin io.Reader, stdout, stderr io.Writer, started func(id string)) (int, error) {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	var created createResponse
+	if err := d.api.do(ctx, http.MethodPost, "/containers/"+prefixed(name)+"/exec", nil, ec, &created); err != nil {
+		return 1, fmt.Errorf("exec on %s: %w", name, err)
+	}
+
+	conn, r, err := d.api.hijack(ctx, "/exec/"+created.ID+"/start", execStart{Tty: ec.Tty})
+	if err != nil {
+		return 1, fmt.Errorf("starting exec on %s: %w", name, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if started != nil {
+		started(created.ID)
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(conn, stdin)
+			if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			}
+		}()
+	}
+
+	if ec.Tty {
+		_, err = io.Copy(stdout, r)
+	} else {
+		err = demux(r, stdout, stderr)
+	}
+	if ctx.Err() != nil {
+		return 1, ctx.Err()
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return 1, fmt.Errorf("reading exec output: %w", err)
+	}
+
+	// The stream can close a moment before the daemon records the exit code.
+	var info execInspect
+	err = retry.Poll(ctx, 20*time.Millisecond, 10*time.Second, func(ctx context.Context) (bool, error) {
+		if err := d.api.do(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &info); err != nil {
+			return false, err
+		}
+		return !info.Running, nil
+	})
+	if err != nil {
+		return 1, fmt.Errorf("inspecting exec: %w", err)
+	}
+	return info.ExitCode, nil
+}
+
+// execSimple runs a command as root and returns its exit code, ignoring
+// errors for best-effort operations.
+func (d *Docker) execSimple(ctx context.Context, full string, cmd []string) int {
+	rc, err := d.exec(ctx, unprefixed(full), execConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	}, nil, nil, nil, nil)
+	if err != nil {
+		return 1
+	}
+	return rc
+}
+
+// applyUser runs the exec as the configured sandbox user with the login
+// environment SSH would provide.
+func (d *Docker) applyUser(ec *execConfig) {
+	home := "/home/" + d.cfg.sshUser
+	ec.User = fmt.Sprintf("%d:%d", d.cfg.uid, d.cfg.gid)
+	ec.WorkingDir = home
+	defaults := []string{"HOME=" + home, "USER=" + d.cfg.sshUser, "SHELL=/bin/bash"}
+	for _, kv := range defaults {
+		k, _, _ := strings.Cut(kv, "=")
+		if !hasEnv(ec.Env, k) {
+			ec.Env = append(ec.Env, kv)
+		}
+	}
+}
+
+func hasEnv(env []string, key string) bool {
+	for _, e := range env {
+		if k, _, _ := strings.Cut(e, "="); k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// shellWrap ensures a command is a proper argv for the exec API, which
+// doesn't use a shell. Single-string shell expressions (e.g. "test -f /path")
+// are wrapped in sh -c so the shell interprets them.
+func shellWrap(cmd []string) []string {
+	if len(cmd) == 1 && strings.Contains(cmd[0], " ") {
+		return []string{"sh", "-c", cmd[0]}
+	}
+	return cmd
+}
@@ -0,0 +1,95 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// ExportSnapshot writes the snapshot image, as docker save produces it, in
+// a checkpoint archive. The image is spooled to a temporary file first,
+// since the archive records the payload size up front.
+func (d *Docker) ExportSnapshot(ctx context.Context, name, label string, w io.Writer) error {
+	c, err := d.inspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := d.requireSnapshot(ctx, name, label); err != nil {
+		return err
+	}
+
+	q := url.Values{"names": {snapshotRepo(name) + ":" + label}}
+	rc, err := d.api.stream(ctx, http.MethodGet, "/images/get", q, nil)
+	if err != nil {
+		return fmt.Errorf("saving snapshot image: %w", err)
+	}
+	defer rc.Close()
+
+	f, err := os.CreateTemp("", "pixels-export-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, rc)
+	if err != nil {
+		return fmt.Errorf("saving snapshot image: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	manifest := sandbox.NewExportManifest(backendName, d.toInstance(name, c), label)
+	return sandbox.WriteExport(w, manifest, f, size)
+}
+
+// ImportSnapshot loads the archived image, creates newName from it with the
+// archived limits and labels, commits it as newName's snapshot and starts
+// it. The image loads under the source's snapshot tag; that tag is removed
+// again unless this daemon already had it, so importing next to the source
+// leaves the source's snapshots alone.
+func (d *Docker) ImportSnapshot(ctx context.Context, newName string, r io.Reader) error {
+	return sandbox.ReadExport(r, backendName, func(m *sandbox.ExportManifest, payload io.Reader) error {
+		if _, err := d.inspect(ctx, newName); err == nil {
+			return fmt.Errorf("instance %s: %w", newName, sandbox.ErrAlreadyExists)
+		} else if !errors.Is(err, sandbox.ErrNotFound) {
+			return err
+		}
+
+		ref := snapshotRepo(m.Source) + ":" + m.Label
+		hadRef := d.requireSnapshot(ctx, m.Source, m.Label) == nil
+		if err := d.api.load(ctx, payload); err != nil {
+			return err
+		}
+		if !hadRef {
+			defer d.deleteImage(ctx, ref)
+		}
+
+		snap, err := d.snapshotPolicy(ctx, m.Source, m.Label)
+		if err != nil {
+			return err
+		}
+
+		labels := map[string]string{labelImage: m.Image, labelOrigin: m.Origin()}
+		for k, v := range m.Labels {
+			labels[labelUserPrefix+k] = v
+		}
+		spec := containerSpec{Image: ref, CPU: m.CPU, Memory: m.Memory, Labels: labels}
+		if err := d.createContainer(ctx, newName, spec); err != nil {
+			return fmt.Errorf("creating %s: %w", newName, err)
+		}
+		if err := d.restorePolicy(prefixed(newName), snap); err != nil {
+			return err
+		}
+		if err := d.CreateSnapshot(ctx, newName, m.Label); err != nil {
+			return err
+		}
+		return d.Start(ctx, newName)
+	})
+}
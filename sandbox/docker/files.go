@@ -0,0 +1,207 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// WriteFile writes content to path inside the container via the archive
+// API. Missing parents are created with `mkdir -p` (root-owned, 0o755).
+// uid/gid set ownership; pass [sandbox.NoOwner] (negative) to leave the file
+// root-owned.
+func (d *Docker) WriteFile(ctx context.Context, name, p string, content []byte, mode os.FileMode, uid, gid int) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	full := prefixed(name)
+
+	dir := path.Dir(p)
+	if dir != "." && dir != "/" {
+		q := url.Values{"path": {dir}}
+		err := d.api.do(ctx, http.MethodHead, "/containers/"+full+"/archive", q, nil, nil)
+		if isStatus(err, http.StatusNotFound) {
+			if rc := d.execSimple(ctx, full, []string{"mkdir", "-p", "--", dir}); rc != 0 {
+				return fmt.Errorf("mkdir %s: exit code %d", dir, rc)
+			}
+		}
+	}
+
+	if uid < 0 || gid < 0 {
+		uid, gid = 0, 0
+	}
+	if err := d.putArchive(ctx, full, p, content, mode, uid, gid); err != nil {
+		return fmt.Errorf("write %s: %w", p, err)
+	}
+	return nil
+}
+
+// putArchive uploads a single-file tar archive that extracts to p.
+func (d *Docker) putArchive(ctx context.Context, full, p string, content []byte, mode os.FileMode, uid, gid int) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Base(p),
+		Size:     int64(len(content)),
+		Mode:     int64(mode.Perm()),
+		Uid:      uid,
+		Gid:      gid,
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	q := url.Values{"path": {path.Dir(p)}}
+	return d.api.do(ctx, http.MethodPut, "/containers/"+full+"/archive", q, &buf, nil)
+}
+
+// ReadFile streams the file (or first maxBytes) out of the container's
+// archive API. If maxBytes>0 and the file is larger, returns truncated=true.
+func (d *Docker) ReadFile(ctx context.Context, name, p string, maxBytes int64) ([]byte, bool, error) {
+	q := url.Values{"path": {p}}
+	rc, err := d.api.stream(ctx, http.MethodGet, "/containers/"+prefixed(name)+"/archive", q, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("read %s: %w", p, err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, false, fmt.Errorf("read %s: %w", p, err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, false, fmt.Errorf("read %s: not a regular file", p)
+	}
+
+	if maxBytes <= 0 || hdr.Size <= maxBytes {
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, false, fmt.Errorf("read %s: %w", p, err)
+		}
+		return body, false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(tr, maxBytes))
+	if err != nil {
+		return nil, false, fmt.Errorf("read %s: %w", p, err)
+	}
+	return body, true, nil
+}
+
+// WriteArchive extracts a tar stream into dir through the archive API,
+// creating dir with `mkdir -p` if it is missing. The engine applies the
+// modes and ownership recorded in the stream.
+func (d *Docker) WriteArchive(ctx context.Context, name, dir string, r io.Reader) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	full := prefixed(name)
+
+	q := url.Values{"path": {dir}}
+	err := d.api.do(ctx, http.MethodHead, "/containers/"+full+"/archive", q, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		if rc := d.execSimple(ctx, full, []string{"mkdir", "-p", "--", dir}); rc != 0 {
+			return fmt.Errorf("mkdir %s: exit code %d", dir, rc)
+		}
+	}
+	if err := d.api.do(ctx, http.MethodPut, "/containers/"+full+"/archive", q, r, nil); err != nil {
+		return fmt.Errorf("extract into %s: %w", dir, err)
+	}
+	return nil
+}
+
+// ReadArchive streams p out of the archive API, which already roots the
+// tar at p's base name.
+func (d *Docker) ReadArchive(ctx context.Context, name, p string, w io.Writer) error {
+	q := url.Values{"path": {p}}
+	rc, err := d.api.stream(ctx, http.MethodGet, "/containers/"+prefixed(name)+"/archive", q, nil)
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", p, err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(w, rc); err != nil {
+		return fmt.Errorf("archive %s: %w", p, err)
+	}
+	return nil
+}
+
+// ListFiles enumerates entries via shell `find -printf` since the archive
+// API would have to stream every file's content to list a directory.
+func (d *Docker) ListFiles(ctx context.Context, name, p string, recursive bool) ([]sandbox.FileEntry, error) {
+	args := []string{"find", p, "-mindepth", "1", "-printf", "%p\t%s\t%m\t%y\n"}
+	if !recursive {
+		args = []string{"find", p, "-mindepth", "1", "-maxdepth", "1", "-printf", "%p\t%s\t%m\t%y\n"}
+	}
+	out, err := d.Output(ctx, name, args)
+	if err != nil {
+		return nil, fmt.Errorf("find %s: %w", p, err)
+	}
+	var entries []sandbox.FileEntry
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		size, _ := strconv.ParseInt(parts[1], 10, 64)
+		modeOct, _ := strconv.ParseUint(parts[2], 8, 32)
+		entries = append(entries, sandbox.FileEntry{
+			Path:  parts[0],
+			Size:  size,
+			Mode:  os.FileMode(modeOct),
+			IsDir: parts[3] == "d",
+		})
+	}
+	return entries, nil
+}
+
+// DeleteFile removes a single file. The archive API has no delete, so this
+// runs `rm` as root.
+func (d *Docker) DeleteFile(ctx context.Context, name, p string) error {
+	rc, err := d.exec(ctx, name, execConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          []string{"rm", "--", p},
+	}, nil, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", p, err)
+	}
+	if rc != 0 {
+		return fmt.Errorf("delete %s: exit code %d", p, rc)
+	}
+	return nil
+}
+
+// pushFile writes a root-owned file into a running container.
+func (d *Docker) pushFile(ctx context.Context, full, p string, content []byte, mode os.FileMode) error {
+	return d.WriteFile(ctx, unprefixed(full), p, content, mode, sandbox.NoOwner, sandbox.NoOwner)
+}
+
+// readFile reads a whole file from inside a container.
+func (d *Docker) readFile(ctx context.Context, full, p string) ([]byte, error) {
+	b, _, err := d.ReadFile(ctx, unprefixed(full), p, 0)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", p, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,29 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Docker fixes published ports when a container is created, so forwards
+// can't be added to a running sandbox. Containers on the default bridge are
+// reachable from the host by their address instead.
+var errForwardUnsupported = fmt.Errorf("port forwarding with the docker backend: %w", errors.ErrUnsupported)
+
+// AddForward is not supported by the Docker backend.
+func (d *Docker) AddForward(ctx context.Context, name string, f sandbox.Forward) error {
+	return errForwardUnsupported
+}
+
+// ListForwards is not supported by the Docker backend.
+func (d *Docker) ListForwards(ctx context.Context, name string) ([]sandbox.Forward, error) {
+	return nil, errForwardUnsupported
+}
+
+// RemoveForward is not supported by the Docker backend.
+func (d *Docker) RemoveForward(ctx context.Context, name, forward string) error {
+	return errForwardUnsupported
+}
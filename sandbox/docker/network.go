@@ -0,0 +1,326 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Egress rules live in the container's own network namespace, which is why
+// containers are created with CAP_NET_ADMIN. Files and paths match the
+// Incus backend so the same in-container tooling works on both.
+const (
+	egressDomainsFile = "/etc/pixels-egress-domains"
+	egressResolve     = "/usr/local/bin/pixels-resolve-egress.sh"
+)
+
+// SetEgressMode sets the egress filtering mode for a container.
+func (d *Docker) SetEgressMode(ctx context.Context, name string, mode sandbox.EgressMode) error {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	full := prefixed(name)
+
+	switch mode {
+	case sandbox.EgressUnrestricted:
+		// Flush nftables.
+		d.execSimple(ctx, full, []string{"nft", "flush", "ruleset"})
+		d.execSimple(ctx, full, []string{"bash", "-c", egress.StopDNSFilterScript()})
+		d.execSimple(ctx, full, []string{"bash", "-c", egress.StopRefreshScript()})
+
+		// Remove egress files.
+		d.execSimple(ctx, full, []string{"rm", "-f",
+			egressDomainsFile,
+			"/etc/pixels-egress-cidrs",
+			egress.LearnFile,
+			"/etc/nftables.conf",
+			egressResolve,
+			"/usr/local/bin/safe-apt",
+		})
+
+		// Restore blanket sudoers.
+		if err := d.pushFile(ctx, full, "/etc/sudoers.d/pixel", []byte(egress.SudoersUnrestricted()), 0o440); err != nil {
+			return fmt.Errorf("writing unrestricted sudoers: %w", err)
+		}
+		return d.writePolicy(full, egress.NewPolicy(mode, nil))
+
+	case sandbox.EgressLearn:
+		// Without a record, learning starts from an empty list.
+		prev, err := d.readPolicy(full)
+		if err != nil && !errors.Is(err, egress.ErrNoRecord) {
+			return err
+		}
+		if err := d.setLearnMode(ctx, full); err != nil {
+			return err
+		}
+		return d.writePolicy(full, egress.LearnPolicy(prev))
+
+	default:
+		if err := egress.ValidateEgress(string(mode)); err != nil {
+			return err
+		}
+		policy := egress.NewPolicy(mode, d.cfg.allow)
+		domains := policy.Domains
+		d.execSimple(ctx, full, []string{"rm", "-f", egress.LearnFile})
+		if !d.cfg.dnsFilter {
+			d.execSimple(ctx, full, []string{"bash", "-c", egress.StopDNSFilterScript()})
+		}
+
+		if err := d.pushFile(ctx, full, egressDomainsFile, []byte(egress.DomainsFileContent(domains)), 0o644); err != nil {
+			return fmt.Errorf("writing egress domains: %w", err)
+		}
+		cidrs := policy.CIDRs
+		if len(cidrs) > 0 {
+			if err := d.pushFile(ctx, full, "/etc/pixels-egress-cidrs", []byte(egress.CIDRsFileContent(cidrs)), 0o644); err != nil {
+				return fmt.Errorf("writing egress cidrs: %w", err)
+			}
+		}
+		if err := d.pushFile(ctx, full, "/etc/nftables.conf", []byte(egress.NftablesConf()), 0o644); err != nil {
+			return fmt.Errorf("writing nftables.conf: %w", err)
+		}
+		if err := d.pushFile(ctx, full, egressResolve, []byte(egress.ResolveScript()), 0o755); err != nil {
+			return fmt.Errorf("writing resolve script: %w", err)
+		}
+		if d.cfg.dnsFilter {
+			bin, err := egress.DNSFilterBinary()
+			if err != nil {
+				return err
+			}
+			if err := d.pushFile(ctx, full, egress.DNSFilterPath, bin, 0o755); err != nil {
+				return fmt.Errorf("writing DNS filter: %w", err)
+			}
+		}
+		if err := d.pushFile(ctx, full, "/usr/local/bin/safe-apt", []byte(egress.SafeAptScript()), 0o755); err != nil {
+			return fmt.Errorf("writing safe-apt: %w", err)
+		}
+		if err := d.pushFile(ctx, full, "/etc/sudoers.d/pixel", []byte(egress.SudoersRestricted()), 0o440); err != nil {
+			return fmt.Errorf("writing restricted sudoers: %w", err)
+		}
+
+		// Stock images don't ship nftables; install it while egress is
+		// still open.
+		rc := d.execSimple(ctx, full, []string{"bash", "-c", "command -v nft >/dev/null || { DEBIAN_FRONTEND=noninteractive apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -o Dpkg::Options::=--force-confold nftables; } >/dev/null 2>&1"})
+		if rc != 0 {
+			return fmt.Errorf("installing nftables: exit code %d", rc)
+		}
+
+		rc = d.execSimple(ctx, full, []string{egressResolve})
+		if rc != 0 {
+			return fmt.Errorf("resolving egress: exit code %d", rc)
+		}
+		return d.writePolicy(full, policy)
+
+	}
+}
+
+// setLearnMode switches full to learn mode, keeping its current domain
+// list in the learn file for suggestions to be compared against.
+func (d *Docker) setLearnMode(ctx context.Context, full string) error {
+	if d.execSimple(ctx, full, []string{"test", "-f", egress.LearnFile}) != 0 {
+		current, _ := d.readFile(ctx, full, egressDomainsFile)
+		if err := d.pushFile(ctx, full, egress.LearnFile, current, 0o644); err != nil {
+			return fmt.Errorf("writing learn file: %w", err)
+		}
+	}
+	d.execSimple(ctx, full, []string{"rm", "-f",
+		egressDomainsFile,
+		"/etc/pixels-egress-cidrs",
+		"/usr/local/bin/safe-apt",
+	})
+
+	if err := d.pushFile(ctx, full, "/etc/nftables.conf", []byte(egress.LearnNftablesConf()), 0o644); err != nil {
+		return fmt.Errorf("writing nftables.conf: %w", err)
+	}
+	if err := d.pushFile(ctx, full, egressResolve, []byte(egress.LearnScript()), 0o755); err != nil {
+		return fmt.Errorf("writing learn script: %w", err)
+	}
+	// The DNS filter names what the container connects to; without it,
+	// names come from the resolver cache.
+	if bin, err := egress.DNSFilterBinary(); err == nil {
+		if err := d.pushFile(ctx, full, egress.DNSFilterPath, bin, 0o755); err != nil {
+			return fmt.Errorf("writing DNS filter: %w", err)
+		}
+	}
+	if err := d.pushFile(ctx, full, "/etc/sudoers.d/pixel", []byte(egress.SudoersUnrestricted()), 0o440); err != nil {
+		return fmt.Errorf("writing unrestricted sudoers: %w", err)
+	}
+
+	rc := d.execSimple(ctx, full, []string{"bash", "-c", "command -v nft >/dev/null || { DEBIAN_FRONTEND=noninteractive apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -o Dpkg::Options::=--force-confold nftables; } >/dev/null 2>&1"})
+	if rc != 0 {
+		return fmt.Errorf("installing nftables: exit code %d", rc)
+	}
+	if rc := d.execSimple(ctx, full, []string{egressResolve}); rc != 0 {
+		return fmt.Errorf("starting learn mode: exit code %d", rc)
+	}
+	return nil
+}
+
+// AllowDomain adds a domain to the egress allowlist and re-resolves.
+func (d *Docker) AllowDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	full := prefixed(name)
+
+	// Ensure egress infrastructure exists.
+	if rc := d.execSimple(ctx, full, []string{"test", "-f", egressDomainsFile}); rc != 0 {
+		if err := d.SetEgressMode(ctx, name, sandbox.EgressAllowlist); err != nil {
+			return fmt.Errorf("setting up egress infra: %w", err)
+		}
+	}
+
+	policy, err := d.readPolicy(full)
+	if err != nil {
+		return err
+	}
+	policy = egress.UpgradePolicy(policy)
+	if slices.Contains(policy.Domains, domain) {
+		return nil
+	}
+	policy.Add(domain)
+
+	if err := d.pushFile(ctx, full, egressDomainsFile, []byte(egress.DomainsFileContent(policy.Domains)), 0o644); err != nil {
+		return fmt.Errorf("writing domains: %w", err)
+	}
+	d.execSimple(ctx, full, []string{egressResolve})
+	return d.writePolicy(full, *policy)
+}
+
+// DenyDomain removes a domain from the egress allowlist and re-resolves.
+func (d *Docker) DenyDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
+	if _, err := d.inspect(ctx, name); err != nil {
+		return err
+	}
+	full := prefixed(name)
+
+	policy, err := d.readPolicy(full)
+	if err != nil {
+		return err
+	}
+	policy = egress.UpgradePolicy(policy)
+	if !policy.Remove(domain) {
+		return fmt.Errorf("domain %q not in allowlist", domain)
+	}
+
+	if err := d.pushFile(ctx, full, egressDomainsFile, []byte(egress.DomainsFileContent(policy.Domains)), 0o644); err != nil {
+		return fmt.Errorf("writing domains: %w", err)
+	}
+	d.execSimple(ctx, full, []string{egressResolve})
+	return d.writePolicy(full, *policy)
+}
+
+// GetPolicy returns the recorded egress policy for an instance.
+func (d *Docker) GetPolicy(ctx context.Context, name string) (*sandbox.Policy, error) {
+	if _, err := d.inspect(ctx, name); err != nil {
+		return nil, err
+	}
+	return d.readPolicy(prefixed(name))
+}
+
+// policyPath returns where full's egress policy is recorded. The record is
+// kept on the host so nothing running in the container can rewrite it.
+func (d *Docker) policyPath(full string) string {
+	return filepath.Join(d.cfg.policyDir, full+".json")
+}
+
+// writePolicy records p as full's egress policy.
+func (d *Docker) writePolicy(full string, p sandbox.Policy) error {
+	if err := os.MkdirAll(d.cfg.policyDir, 0o700); err != nil {
+		return fmt.Errorf("writing egress policy: %w", err)
+	}
+	f, err := os.CreateTemp(d.cfg.policyDir, full+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing egress policy: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(egress.MarshalPolicy(p)); err != nil {
+		f.Close()
+		return fmt.Errorf("writing egress policy: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing egress policy: %w", err)
+	}
+	if err := os.Rename(f.Name(), d.policyPath(full)); err != nil {
+		return fmt.Errorf("writing egress policy: %w", err)
+	}
+	return nil
+}
+
+// removePolicy deletes full's policy record.
+func (d *Docker) removePolicy(full string) error {
+	if err := os.Remove(d.policyPath(full)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing egress policy: %w", err)
+	}
+	return nil
+}
+
+// readPolicy returns full's recorded egress policy. If there is no record,
+// the error wraps egress.ErrNoRecord: nothing in the container is trusted to
+// stand in for it.
+func (d *Docker) readPolicy(full string) (*sandbox.Policy, error) {
+	data, err := os.ReadFile(d.policyPath(full))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", unprefixed(full), egress.ErrNoRecord)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading egress policy: %w", err)
+	}
+	return egress.ParsePolicy(data)
+}
+
+// snapshotPolicy returns the policy recorded on name's snapshot label, or
+// nil if the snapshot was taken without one.
+func (d *Docker) snapshotPolicy(ctx context.Context, name, label string) (*sandbox.Policy, error) {
+	repo := snapshotRepo(name)
+	filters, _ := json.Marshal(map[string][]string{"reference": {repo}})
+	q := url.Values{"filters": {string(filters)}}
+
+	var images []imageSummary
+	if err := d.api.do(ctx, http.MethodGet, "/images/json", q, nil, &images); err != nil {
+		return nil, fmt.Errorf("listing snapshots: %w", err)
+	}
+	for _, img := range images {
+		if !slices.Contains(img.RepoTags, repo+":"+label) {
+			continue
+		}
+		if v := img.Labels[labelSnapshotPolicy]; v != "" {
+			return egress.ParsePolicy([]byte(v))
+		}
+	}
+	return nil, nil
+}
+
+// restorePolicy records snap, the policy of the snapshot full was created
+// from, as full's. Without one the record is removed.
+func (d *Docker) restorePolicy(full string, snap *sandbox.Policy) error {
+	if snap == nil {
+		return d.removePolicy(full)
+	}
+	return d.writePolicy(full, *snap)
+}
+
+// reloadEgress re-applies the nftables rules after a start. Best-effort: a
+// container without an egress policy has no resolve script.
+func (d *Docker) reloadEgress(ctx context.Context, full string) {
+	if d.execSimple(ctx, full, []string{"test", "-x", egressResolve}) == 0 {
+		d.execSimple(ctx, full, []string{egressResolve})
+	}
+}
@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/internal/scripts"
+)
+
+// setupUserScript creates the sandbox user at the configured uid/gid. Stock
+// images such as ubuntu:24.04 already ship a uid 1000 user ("ubuntu"),
+// which is renamed rather than duplicated. sudo is installed best-effort so
+// the sudoers drop-in has something to apply to.
+const setupUserScript = `#!/bin/bash
+set -eu
+USER_NAME="$1" USER_ID="$2" GROUP_ID="$3"
+
+if ! getent group "$GROUP_ID" >/dev/null; then
+	groupadd -g "$GROUP_ID" "$USER_NAME"
+elif [ "$(getent group "$GROUP_ID" | cut -d: -f1)" != "$USER_NAME" ]; then
+	groupmod -n "$USER_NAME" "$(getent group "$GROUP_ID" | cut -d: -f1)"
+fi
+
+existing="$(getent passwd "$USER_ID" | cut -d: -f1 || true)"
+if [ -z "$existing" ]; then
+	useradd -m -u "$USER_ID" -g "$GROUP_ID" -s /bin/bash "$USER_NAME"
+elif [ "$existing" != "$USER_NAME" ]; then
+	usermod -l "$USER_NAME" -d "/home/$USER_NAME" -m -s /bin/bash "$existing"
+fi
+
+if ! command -v sudo >/dev/null; then
+	DEBIAN_FRONTEND=noninteractive apt-get update -qq >/dev/null 2>&1 || true
+	DEBIAN_FRONTEND=noninteractive apt-get install -y -qq sudo >/dev/null 2>&1 || true
+fi
+`
+
+// provision creates the sandbox user and writes the shell profile and
+// sudoers drop-in. Images are stock and have no init system, so everything
+// is done directly through the exec and archive APIs.
+func (d *Docker) provision(ctx context.Context, full string) error {
+	if err := d.pushFile(ctx, full, "/usr/local/bin/pixels-setup-user.sh", []byte(setupUserScript), 0o755); err != nil {
+		return fmt.Errorf("writing user setup script: %w", err)
+	}
+	rc := d.execSimple(ctx, full, []string{
+		"/usr/local/bin/pixels-setup-user.sh",
+		d.cfg.sshUser,
+		fmt.Sprint(d.cfg.uid),
+		fmt.Sprint(d.cfg.gid),
+	})
+	if rc != 0 {
+		return fmt.Errorf("creating user %s: exit code %d", d.cfg.sshUser, rc)
+	}
+
+	if err := d.pushFile(ctx, full, "/etc/profile.d/pixels.sh", []byte(scripts.PixelsProfile), 0o644); err != nil {
+		return fmt.Errorf("writing profile: %w", err)
+	}
+	if err := d.pushFile(ctx, full, "/etc/sudoers.d/pixel", []byte(egress.SudoersUnrestricted()), 0o440); err != nil {
+		return fmt.Errorf("writing sudoers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package docker
+
+// Engine API wire types. Only the fields the backend reads or writes are
+// declared; the JSON names follow the Engine API reference.
+
+type containerConfig struct {
+	Image      string            `json:"Image,omitempty"`
+	Cmd        []string          `json:"Cmd,omitempty"`
+	Hostname   string            `json:"Hostname,omitempty"`
+	Env        []string          `json:"Env,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+	HostConfig *hostConfig       `json:"HostConfig,omitempty"`
+}
+
+type hostConfig struct {
+	NanoCPUs    int64    `json:"NanoCpus,omitempty"`
+	Memory      int64    `json:"Memory,omitempty"`
+	Init        bool     `json:"Init,omitempty"`
+	CapAdd      []string `json:"CapAdd,omitempty"`
+	DNS         []string `json:"Dns,omitempty"`
+	NetworkMode string   `json:"NetworkMode,omitempty"`
+	Binds       []string `json:"Binds,omitempty"`
+}
+
+// containerStats is a sample from GET /containers/{id}/stats.
+type containerStats struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage int64 `json:"total_usage"` // nanoseconds
+		} `json:"cpu_usage"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage    int64            `json:"usage"`
+		MaxUsage int64            `json:"max_usage"` // cgroup v1 only
+		Stats    map[string]int64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes int64 `json:"rx_bytes"`
+		TxBytes int64 `json:"tx_bytes"`
+	} `json:"networks"`
+}
+
+// updateConfig is the body of POST /containers/{id}/update.
+type updateConfig struct {
+	NanoCPUs   int64 `json:"NanoCpus,omitempty"`
+	Memory     int64 `json:"Memory,omitempty"`
+	MemorySwap int64 `json:"MemorySwap,omitempty"`
+}
+
+type createResponse struct {
+	ID string `json:"Id"`
+}
+
+type containerJSON struct {
+	ID              string           `json:"Id"`
+	Name            string           `json:"Name"`
+	Created         string           `json:"Created"`
+	State           containerState   `json:"State"`
+	Config          containerConfig  `json:"Config"`
+	HostConfig      *hostConfig      `json:"HostConfig"`
+	NetworkSettings *networkSettings `json:"NetworkSettings"`
+	SizeRw          int64            `json:"SizeRw,omitempty"` // only with ?size=true
+}
+
+type containerState struct {
+	Status  string `json:"Status"`
+	Running bool   `json:"Running"`
+}
+
+type networkSettings struct {
+	Networks map[string]endpoint `json:"Networks"`
+}
+
+type endpoint struct {
+	IPAddress         string `json:"IPAddress"`
+	GlobalIPv6Address string `json:"GlobalIPv6Address"`
+}
+
+// containerSummary is an entry of GET /containers/json.
+type containerSummary struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	State           string            `json:"State"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings *networkSettings  `json:"NetworkSettings"`
+}
+
+// imageSummary is an entry of GET /images/json.
+type imageSummary struct {
+	ID       string            `json:"Id"`
+	RepoTags []string          `json:"RepoTags"`
+	Created  int64             `json:"Created"`
+	Size     int64             `json:"Size"`
+	Labels   map[string]string `json:"Labels"`
+}
+
+type execConfig struct {
+	AttachStdin  bool     `json:"AttachStdin"`
+	AttachStdout bool     `json:"AttachStdout"`
+	AttachStderr bool     `json:"AttachStderr"`
+	Tty          bool     `json:"Tty"`
+	Env          []string `json:"Env,omitempty"`
+	Cmd          []string `json:"Cmd"`
+	User         string   `json:"User,omitempty"`
+	WorkingDir   string   `json:"WorkingDir,omitempty"`
+}
+
+type execStart struct {
+	Detach bool `json:"Detach"`
+	Tty    bool `json:"Tty"`
+}
+
+type execInspect struct {
+	Running  bool `json:"Running"`
+	ExitCode int  `json:"ExitCode"`
+}
+
+// eventMessage is an entry of the GET /events stream.
+type eventMessage struct {
+	Type     string     `json:"Type"`
+	Action   string     `json:"Action"`
+	Actor    eventActor `json:"Actor"`
+	TimeNano int64      `json:"timeNano"`
+}
+
+type eventActor struct {
+	ID         string            `json:"ID"`
+	Attributes map[string]string `json:"Attributes"`
+}
@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// containerActions maps the container event actions pixels reports to
+// event types. "die" covers both stops and processes exiting on their own.
+var containerActions = map[string]sandbox.EventType{
+	"create":  sandbox.EventCreated,
+	"start":   sandbox.EventStarted,
+	"die":     sandbox.EventStopped,
+	"destroy": sandbox.EventDeleted,
+}
+
+// Watch follows the engine's event stream. Checkpoints are reported from
+// the image tag events that commits produce.
+func (d *Docker) Watch(ctx context.Context, fn func(sandbox.Event)) error {
+	filters, err := json.Marshal(map[string][]string{"type": {"container", "image"}})
+	if err != nil {
+		return err
+	}
+	rc, err := d.api.stream(ctx, http.MethodGet, "/events", url.Values{"filters": {string(filters)}}, nil)
+	if err != nil {
+		return fmt.Errorf("listening for events: %w", err)
+	}
+	defer rc.Close()
+
+	dec := json.NewDecoder(rc)
+	for {
+		var m eventMessage
+		if err := dec.Decode(&m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("event stream: %w", err)
+		}
+		if e, ok := engineEvent(m); ok {
+			fn(e)
+		}
+	}
+}
+
+// engineEvent converts an engine event about a pixels container or one of
+// its snapshot images.
+func engineEvent(m eventMessage) (sandbox.Event, bool) {
+	e := sandbox.Event{Time: time.Unix(0, m.TimeNano).UTC()}
+	name := m.Actor.Attributes["name"]
+	switch m.Type {
+	case "container":
+		typ, ok := containerActions[m.Action]
+		if strings.HasPrefix(m.Action, "exec_start") {
+			typ, ok = sandbox.EventExecStarted, true
+		}
+		if !ok || !strings.HasPrefix(name, containerPrefix) || strings.HasSuffix(name, asideSuffix) {
+			return e, false
+		}
+		e.Type, e.Name = typ, unprefixed(name)
+	case "image":
+		repo, tag, ok := strings.Cut(name, ":")
+		pixel, isSnapshot := strings.CutPrefix(repo, snapshotRepo(""))
+		if m.Action != "tag" || !ok || !isSnapshot || pixel == "" {
+			return e, false
+		}
+		e.Type, e.Name, e.Snapshot = sandbox.EventSnapshotCreated, pixel, tag
+	default:
+		return e, false
+	}
+	return e, true
+}
@@ -3,9 +3,125 @@ package sandbox
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strings"
+	"syscall"
 )
 
+// Backend operations return errors wrapping one of these when the failure
+// falls into a kind callers may want to act on. Use [errors.Is] to test
+// for them, or [ErrorCode] for a stable name; the wording of the wrapped
+// error is not part of the contract.
+var (
+	// ErrNotFound means the target instance, snapshot or forward does not
+	// exist.
+	ErrNotFound = errors.New("sandbox: not found")
+	// ErrAlreadyExists means an instance, snapshot or forward with that
+	// name already exists.
+	ErrAlreadyExists = errors.New("sandbox: already exists")
+	// ErrNotRunning means the operation needs a running instance.
+	ErrNotRunning = errors.New("sandbox: not running")
+	// ErrSnapshotInUse means a snapshot can't be removed because something,
+	// such as a clone, still depends on it.
+	ErrSnapshotInUse = errors.New("sandbox: snapshot in use")
+	// ErrUnsupported means the backend can't do this at all; it is
+	// [errors.ErrUnsupported], so existing checks keep working.
+	ErrUnsupported = errors.ErrUnsupported
+	// ErrQuotaExceeded means a storage quota, disk or project limit was hit.
+	ErrQuotaExceeded = errors.New("sandbox: quota exceeded")
+	// ErrUnavailable means the backend couldn't be reached or dropped the
+	// connection. Unlike the others, retrying may succeed.
+	ErrUnavailable = errors.New("sandbox: backend unavailable")
+)
+
+// errorCodes names each kind for [ErrorCode], in the order kinds are
+// checked.
+var errorCodes = []struct {
+	kind error
+	code string
+}{
+	{ErrNotFound, "not_found"},
+	{ErrAlreadyExists, "already_exists"},
+	{ErrNotRunning, "not_running"},
+	{ErrSnapshotInUse, "snapshot_in_use"},
+	{ErrUnsupported, "unsupported"},
+	{ErrQuotaExceeded, "quota_exceeded"},
+	{ErrUnavailable, "unavailable"},
+}
+
+// ErrorCode returns a stable snake_case name for the kind of err, such as
+// "not_found", or "" if err is nil or of no known kind.
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.kind) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// kindError marks err as being of a kind without changing its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// Wrap returns err marked as kind, one of the errors above, keeping its
+// message and chain. It returns err unchanged if it is nil or already of
+// some kind.
+func Wrap(kind, err error) error {
+	if err == nil || ErrorCode(err) != "" {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// unavailablePhrases are the transport failures WrapError recognises,
+// lower-cased, for clients that report a dropped connection as text.
+var unavailablePhrases = []string{"connection refused", "connection reset", "broken pipe", "i/o timeout", "client closed", "not connected"}
+
+// WrapError marks a network error as ErrUnavailable, for backends whose
+// libraries don't say what kind an error is. It doesn't guess other kinds
+// from the message, since file, exec and quota text would be misread;
+// backends check typed upstream errors (status codes, errnos) first and use
+// [WrapLookupError] where a missing instance or snapshot only shows in the
+// message. Errors already of some kind, and unrecognised ones, pass through
+// unchanged.
+func WrapError(err error) error {
+	if err == nil || ErrorCode(err) != "" {
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return Wrap(ErrUnavailable, err)
+	}
+	msg := strings.ToLower(err.Error())
+	for _, phrase := range unavailablePhrases {
+		if strings.Contains(msg, phrase) {
+			return Wrap(ErrUnavailable, err)
+		}
+	}
+	return err
+}
+
+// WrapLookupError is WrapError for the error from looking up one instance
+// or snapshot, where the upstream "not found" or "does not exist" message
+// can only mean the target is missing. Use it at those call sites only.
+func WrapLookupError(err error) error {
+	err = WrapError(err)
+	if err == nil || ErrorCode(err) != "" {
+		return err
+	}
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "not found") || strings.Contains(msg, "does not exist") {
+		return Wrap(ErrNotFound, err)
+	}
+	return err
+}
+
 // WrapNotFound translates upstream "not found" errors into a [ErrNotFound]
 // chain so callers can use [errors.Is](err, [ErrNotFound]). Other errors
 // pass through unchanged. Idempotent — wrapping an already-wrapped error
@@ -23,6 +139,8 @@ import (
 //
 // The first time either upstream library exposes a typed IsNotFound
 // predicate, switch the body to use that — call sites stay the same.
+//
+// Backends that want every kind, not just ErrNotFound, use [WrapError].
 func WrapNotFound(err error) error {
 	if err == nil {
 		return nil
@@ -2,6 +2,9 @@ package sandbox
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"syscall"
 	"testing"
 )
 
@@ -58,3 +61,60 @@ func TestWrapNotFoundNilPasses(t *testing.T) {
 		t.Errorf("expected nil; got %v", err)
 	}
 }
+
+func TestWrapKeepsMessageAndChain(t *testing.T) {
+	original := errors.New("boom")
+	err := Wrap(ErrQuotaExceeded, original)
+	if !errors.Is(err, ErrQuotaExceeded) || !errors.Is(err, original) {
+		t.Errorf("Wrap lost the kind or the original: %v", err)
+	}
+	if err.Error() != "boom" {
+		t.Errorf("Wrap changed the message to %q", err.Error())
+	}
+	if again := Wrap(ErrNotFound, err); ErrorCode(again) != "quota_exceeded" {
+		t.Errorf("rewrapping changed the kind to %s", ErrorCode(again))
+	}
+	if Wrap(ErrNotFound, nil) != nil {
+		t.Error("Wrap(nil) is not nil")
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, "unavailable"},
+		{fmt.Errorf("exec: %w", syscall.ECONNRESET), "unavailable"},
+		{errors.New("write tcp: broken pipe"), "unavailable"},
+		{fmt.Errorf("resize: %w", errors.ErrUnsupported), "unsupported"},
+		{errors.New("Instance not found"), ""},
+		{errors.New("cat: /etc/x: No such file or directory"), ""},
+		{errors.New("disk quota exceeded"), ""},
+		{errors.New("permission denied"), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := ErrorCode(WrapError(tt.err)); got != tt.want {
+			t.Errorf("ErrorCode(WrapError(%v)) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWrapLookupError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("Instance not found"), "not_found"},
+		{errors.New("VirtInstance px-a does not exist"), "not_found"},
+		{errors.New("cat: /etc/x: No such file or directory"), ""},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, "unavailable"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := ErrorCode(WrapLookupError(tt.err)); got != tt.want {
+			t.Errorf("ErrorCode(WrapLookupError(%v)) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package sandbox
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// exportVersion is the checkpoint archive format written by [WriteExport].
+const exportVersion = 1
+
+// Entry names inside a checkpoint archive, in the order they appear.
+const (
+	exportManifestEntry = "manifest.json"
+	exportPayloadEntry  = "checkpoint"
+)
+
+// ExportManifest describes the checkpoint in an archive written by
+// [Backend.ExportSnapshot]. The payload that follows it is in the
+// exporting backend's native format, so an archive can only be imported by
+// the same kind of backend. Policy, the egress policy recorded with the
+// checkpoint, is set by backends whose payload doesn't carry it.
+type ExportManifest struct {
+	Version    int               `json:"version"`
+	Backend    string            `json:"backend"`
+	Source     string            `json:"source"`
+	Label      string            `json:"label"`
+	Image      string            `json:"image,omitempty"`
+	CPU        string            `json:"cpu,omitempty"`
+	Memory     int64             `json:"memory,omitempty"`
+	Egress     EgressMode        `json:"egress,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Policy     *Policy           `json:"policy,omitempty"`
+	ExportedAt time.Time         `json:"exported_at"`
+}
+
+// NewExportManifest describes checkpoint label of inst for backend.
+func NewExportManifest(backend string, inst *Instance, label string) ExportManifest {
+	return ExportManifest{
+		Version:    exportVersion,
+		Backend:    backend,
+		Source:     inst.Name,
+		Label:      label,
+		Image:      inst.Image,
+		CPU:        inst.CPU,
+		Memory:     inst.Memory,
+		Egress:     inst.Egress,
+		Labels:     maps.Clone(inst.Labels),
+		ExportedAt: time.Now().UTC(),
+	}
+}
+
+// Origin is the "source:label" an imported instance records as its
+// [Instance.Origin].
+func (m *ExportManifest) Origin() string { return m.Source + ":" + m.Label }
+
+// WriteExport writes a checkpoint archive to w: a zstd-compressed tar
+// holding the manifest followed by size bytes of payload.
+func WriteExport(w io.Writer, m ExportManifest, payload io.Reader, size int64) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	now := time.Now()
+	if err := tw.WriteHeader(&tar.Header{Name: exportManifestEntry, Mode: 0o644, Size: int64(len(manifest)), ModTime: now}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: exportPayloadEntry, Mode: 0o600, Size: size, ModTime: now}); err != nil {
+		return err
+	}
+	if n, err := io.Copy(tw, payload); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	} else if n != size {
+		return fmt.Errorf("writing checkpoint: got %d bytes, want %d", n, size)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadExport reads a checkpoint archive written by [WriteExport] and calls
+// fn with its manifest and payload. It fails before calling fn if the
+// archive came from a different kind of backend.
+func ReadExport(r io.Reader, backend string, fn func(m *ExportManifest, payload io.Reader) error) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("reading checkpoint archive: %w", err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	var m ExportManifest
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != exportManifestEntry {
+		return errors.New("not a pixels checkpoint archive")
+	}
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+	if m.Version != exportVersion {
+		return Wrap(ErrUnsupported, fmt.Errorf("unsupported checkpoint archive version %d", m.Version))
+	}
+	if m.Backend != backend {
+		return Wrap(ErrUnsupported, fmt.Errorf("checkpoint archive is from the %s backend, not %s", m.Backend, backend))
+	}
+
+	hdr, err = tr.Next()
+	if err != nil || hdr.Name != exportPayloadEntry {
+		return errors.New("checkpoint archive has no payload")
+	}
+	return fn(&m, tr)
+}
@@ -0,0 +1,54 @@
+package sandbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	inst := &Instance{Name: "base", Image: "ubuntu/24.04", CPU: "2", Memory: 1 << 30, Labels: map[string]string{"team": "infra"}}
+	payload := "filesystem bytes"
+
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, NewExportManifest("incus", inst, "ready"), strings.NewReader(payload), int64(len(payload))); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	err := ReadExport(bytes.NewReader(archive), "incus", func(m *ExportManifest, r io.Reader) error {
+		if m.Origin() != "base:ready" || m.Image != "ubuntu/24.04" || m.CPU != "2" || m.Memory != 1<<30 || m.Labels["team"] != "infra" {
+			t.Errorf("manifest = %+v", m)
+		}
+		got, err := io.ReadAll(r)
+		if string(got) != payload {
+			t.Errorf("payload = %q, want %q", got, payload)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	err = ReadExport(bytes.NewReader(archive), "docker", func(*ExportManifest, io.Reader) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Errorf("ReadExport with another backend: err = %v, called = %v", err, called)
+	}
+
+	if err := ReadExport(strings.NewReader("not an archive"), "incus", nil); err == nil {
+		t.Error("ReadExport of garbage: want error")
+	}
+}
+
+func TestWriteExportShortPayload(t *testing.T) {
+	inst := &Instance{Name: "base"}
+	err := WriteExport(io.Discard, NewExportManifest("incus", inst, "ready"), strings.NewReader("abc"), 10)
+	if err == nil {
+		t.Error("want error when the payload is shorter than its size")
+	}
+}
@@ -0,0 +1,46 @@
+package sandbox
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ParseForward parses a "[addr:]local:remote" spec such as "8080:3000" or
+// "0.0.0.0:8080:3000". Without an address the forward listens on
+// 127.0.0.1. The forward is named after its local port.
+func ParseForward(spec string) (Forward, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return Forward{}, fmt.Errorf("invalid forward %q: want [addr:]local:remote", spec)
+	}
+	local, remote := spec[:i], spec[i+1:]
+	port, err := parsePort(remote)
+	if err != nil {
+		return Forward{}, fmt.Errorf("invalid forward %q: remote %w", spec, err)
+	}
+
+	host, localPort := "127.0.0.1", local
+	if strings.Contains(local, ":") {
+		if host, localPort, err = net.SplitHostPort(local); err != nil {
+			return Forward{}, fmt.Errorf("invalid forward %q: %w", spec, err)
+		}
+	}
+	if _, err := parsePort(localPort); err != nil {
+		return Forward{}, fmt.Errorf("invalid forward %q: local %w", spec, err)
+	}
+	return Forward{
+		Name:   localPort,
+		Listen: net.JoinHostPort(host, localPort),
+		Port:   port,
+	}, nil
+}
+
+func parsePort(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("port %q is not a number between 1 and 65535", s)
+	}
+	return n, nil
+}
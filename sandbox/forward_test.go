@@ -0,0 +1,23 @@
+package sandbox
+
+import "testing"
+
+func TestParseForward(t *testing.T) {
+	tests := map[string]Forward{
+		"8080:3000":          {Name: "8080", Listen: "127.0.0.1:8080", Port: 3000},
+		"0.0.0.0:8080:3000":  {Name: "8080", Listen: "0.0.0.0:8080", Port: 3000},
+		"[::1]:5432:5432":    {Name: "5432", Listen: "[::1]:5432", Port: 5432},
+		"localhost:9000:900": {Name: "9000", Listen: "localhost:9000", Port: 900},
+	}
+	for spec, want := range tests {
+		got, err := ParseForward(spec)
+		if err != nil || got != want {
+			t.Errorf("ParseForward(%q) = %+v, %v, want %+v", spec, got, err, want)
+		}
+	}
+	for _, bad := range []string{"8080", "8080:", ":3000", "x:3000", "8080:70000", "a:b:c:3000"} {
+		if _, err := ParseForward(bad); err == nil {
+			t.Errorf("ParseForward(%q): want error", bad)
+		}
+	}
+}
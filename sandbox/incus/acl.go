@@ -0,0 +1,446 @@
+package incus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Egress enforcement modes. With enforceHost, restricted egress is an
+// Incus network ACL attached to the container's NIC and applied by the
+// host's firewall, so root inside the container can't lift it.
+const (
+	enforceContainer = "container"
+	enforceHost      = "host"
+)
+
+// ACL config keys holding the policy the rules were resolved from, so it
+// can be read back and re-resolved without looking inside the container.
+const (
+	aclDomainsKey = "user.pixels.domains"
+	aclCIDRsKey   = "user.pixels.cidrs"
+)
+
+// NIC device keys that attach an ACL. Ingress stays open, as it is under
+// in-container enforcement, so SSH and forwards keep working.
+const (
+	nicACLs        = "security.acls"
+	nicACLsEgress  = "security.acls.default.egress.action"
+	nicACLsIngress = "security.acls.default.ingress.action"
+)
+
+// aclName returns the name of the ACL holding full's egress policy.
+func aclName(full string) string { return full + "-egress" }
+
+// hostEgress reports whether egress is enforced by host-side ACLs.
+func (i *Incus) hostEgress() bool { return i.cfg.enforce == enforceHost }
+
+// containerEgress returns the egress mode to set up inside new containers:
+// the configured one, or unrestricted when the host enforces it instead.
+func (i *Incus) containerEgress() string {
+	if i.hostEgress() {
+		return string(sandbox.EgressUnrestricted)
+	}
+	return i.cfg.egress
+}
+
+// setHostEgress applies mode to full as an ACL, or removes its ACL for
+// unrestricted.
+func (i *Incus) setHostEgress(ctx context.Context, full string, mode sandbox.EgressMode) error {
+	switch mode {
+	case sandbox.EgressUnrestricted:
+		return i.removeACL(ctx, full)
+	case sandbox.EgressLearn:
+		return sandbox.Wrap(sandbox.ErrUnsupported,
+			fmt.Errorf("learn mode on %s: needs network.enforce = \"container\"", full))
+	default:
+		if err := egress.ValidateEgress(string(mode)); err != nil {
+			return err
+		}
+		domains := egress.ResolveDomains(string(mode), i.cfg.allow)
+		return i.applyACL(ctx, full, domains, egress.PresetCIDRs(string(mode)))
+	}
+}
+
+// applyACL resolves domains on the host, writes the result and cidrs to
+// full's ACL, creating it if needed, and attaches it to the container's
+// NIC.
+func (i *Incus) applyACL(ctx context.Context, full string, domains, cidrs []string) error {
+	rules, _ := resolveRules(ctx, domains)
+	return i.writeACL(ctx, full, domains, cidrs, rules)
+}
+
+// writeACL writes rules, resolved from domains, and cidrs to full's ACL,
+// creating it if needed and leaving it alone if it already holds them, and
+// attaches it to the container's NIC.
+func (i *Incus) writeACL(ctx context.Context, full string, domains, cidrs []string, rules []egress.Rule) error {
+	name := aclName(full)
+	put := api.NetworkACLPut{
+		Description: "pixels egress policy for " + full,
+		Egress:      aclRules(rules, cidrs, i.cfg.dns),
+		Config: map[string]string{
+			aclDomainsKey: strings.Join(domains, ","),
+			aclCIDRsKey:   strings.Join(cidrs, ","),
+		},
+	}
+	acl, etag, err := i.server.GetNetworkACL(name)
+	switch {
+	case api.StatusErrorCheck(err, http.StatusNotFound):
+		err = i.server.CreateNetworkACL(api.NetworkACLsPost{
+			NetworkACLPost: api.NetworkACLPost{Name: name},
+			NetworkACLPut:  put,
+		})
+	case err == nil && (!slices.Equal(acl.Egress, put.Egress) || !maps.Equal(acl.Config, put.Config)):
+		err = i.server.UpdateNetworkACL(name, put, etag)
+	}
+	if err != nil {
+		return wrapError(fmt.Errorf("writing network ACL %s: %w", name, err))
+	}
+	return i.attachACL(ctx, full, name)
+}
+
+// removeACL detaches full's ACL and deletes it.
+func (i *Incus) removeACL(ctx context.Context, full string) error {
+	if err := i.attachACL(ctx, full, ""); err != nil {
+		return err
+	}
+	if err := i.server.DeleteNetworkACL(aclName(full)); err != nil && !api.StatusErrorCheck(err, http.StatusNotFound) {
+		return wrapError(fmt.Errorf("deleting network ACL %s: %w", aclName(full), err))
+	}
+	return nil
+}
+
+// copyACL gives dst its own copy of src's ACL, if src has one. Copies of
+// an instance keep its NIC settings, which would otherwise leave dst
+// pointing at src's ACL.
+func (i *Incus) copyACL(ctx context.Context, src, dst string) error {
+	acl, _, err := i.server.GetNetworkACL(aclName(src))
+	if api.StatusErrorCheck(err, http.StatusNotFound) {
+		return i.attachACL(ctx, dst, "")
+	}
+	if err != nil {
+		return wrapError(fmt.Errorf("getting network ACL %s: %w", aclName(src), err))
+	}
+	return i.applyACL(ctx, dst, splitList(acl.Config[aclDomainsKey]), splitList(acl.Config[aclCIDRsKey]))
+}
+
+// syncACL attaches full's ACL if it has one and detaches any other. Run
+// after anything that resets the NIC, such as restoring a snapshot taken
+// under another policy.
+func (i *Incus) syncACL(ctx context.Context, full string) error {
+	_, _, err := i.server.GetNetworkACL(aclName(full))
+	switch {
+	case api.StatusErrorCheck(err, http.StatusNotFound):
+		return i.attachACL(ctx, full, "")
+	case err != nil:
+		return wrapError(fmt.Errorf("getting network ACL %s: %w", aclName(full), err))
+	}
+	return i.attachACL(ctx, full, aclName(full))
+}
+
+// HostState returns the rules name's ACL applies, for egress.ReadState,
+// with the names in p resolved from the host. ok is false unless egress is
+// enforced by the host.
+func (i *Incus) HostState(ctx context.Context, name string, p sandbox.Policy) (egress.State, bool, error) {
+	if !i.hostEgress() {
+		return egress.State{}, false, nil
+	}
+	full := prefixed(name)
+	inst, _, err := i.server.GetInstance(full)
+	if err != nil {
+		return egress.State{}, true, wrapError(fmt.Errorf("getting %s: %w", full, err))
+	}
+	acl, _, err := i.server.GetNetworkACL(aclName(full))
+	switch {
+	case api.StatusErrorCheck(err, http.StatusNotFound):
+		acl = nil
+	case err != nil:
+		return egress.State{}, true, wrapError(fmt.Errorf("getting network ACL %s: %w", aclName(full), err))
+	}
+	_, nic := managedNIC(inst.ExpandedDevices)
+	s := aclState(acl, nic)
+	s.Resolved = resolveNames(ctx, p.Domains)
+	return s, true, nil
+}
+
+// RefreshHost resolves the domains in name's ACL again and rewrites it if
+// their addresses have changed. If a lookup fails other than by the name
+// not existing, the ACL is left as it was rather than dropping the name's
+// addresses.
+func (i *Incus) RefreshHost(ctx context.Context, name string) error {
+	if !i.hostEgress() {
+		return nil
+	}
+	full := prefixed(name)
+	domains, cidrs, ok, err := i.aclPolicy(full)
+	if err != nil || !ok {
+		return err
+	}
+	rules, failed := resolveRules(ctx, domains)
+	if len(failed) > 0 {
+		return fmt.Errorf("refreshing network ACL %s: resolving %s failed; keeping its addresses", aclName(full), strings.Join(failed, ", "))
+	}
+	return i.writeACL(ctx, full, domains, cidrs, rules)
+}
+
+// aclState returns the egress enforcement acl, which may be nil, applies
+// through nic. The allowlist is only loaded if nic uses acl and drops all
+// other egress.
+func aclState(acl *api.NetworkACL, nic map[string]string) egress.State {
+	s := egress.State{Ruleset: egress.RulesetNone, Host: true}
+	if acl == nil {
+		return s
+	}
+	if nic[nicACLs] == acl.Name && nic[nicACLsEgress] == "drop" {
+		s.Ruleset = egress.RulesetAllowlist
+	}
+	s.Domains = splitList(acl.Config[aclDomainsKey])
+	s.CIDRs = splitList(acl.Config[aclCIDRsKey])
+	for _, rule := range acl.Egress {
+		if rule.Action != "allow" || rule.Description != "pixels allowlist" || rule.State == "disabled" {
+			continue
+		}
+		port, _ := strconv.Atoi(rule.DestinationPort)
+		for _, dst := range splitList(rule.Destination) {
+			r, err := egress.ParseRule(dst)
+			if err != nil {
+				continue
+			}
+			r.Port, r.Proto = port, rule.Protocol
+			s.Allowed = append(s.Allowed, r.String())
+		}
+	}
+	return s
+}
+
+// aclPolicy returns the domains and CIDRs in full's ACL. ok is false if it
+// has none.
+func (i *Incus) aclPolicy(full string) (domains, cidrs []string, ok bool, err error) {
+	acl, _, err := i.server.GetNetworkACL(aclName(full))
+	if api.StatusErrorCheck(err, http.StatusNotFound) {
+		return nil, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, wrapError(fmt.Errorf("getting network ACL %s: %w", aclName(full), err))
+	}
+	return splitList(acl.Config[aclDomainsKey]), splitList(acl.Config[aclCIDRsKey]), true, nil
+}
+
+// attachACL points the container's managed-network NIC at acl, dropping
+// all other egress, or with acl "" restores the NIC's defaults. A NIC
+// inherited from a profile is overridden with a local copy.
+func (i *Incus) attachACL(ctx context.Context, full, acl string) error {
+	inst, etag, err := i.server.GetInstance(full)
+	if err != nil {
+		return wrapError(fmt.Errorf("getting %s: %w", full, err))
+	}
+	dev, nic := managedNIC(inst.ExpandedDevices)
+	if nic == nil {
+		if acl == "" {
+			return nil
+		}
+		return sandbox.Wrap(sandbox.ErrUnsupported,
+			fmt.Errorf("host-enforced egress on %s: no NIC on a managed Incus network", full))
+	}
+	if nic[nicACLs] == acl {
+		return nil
+	}
+
+	updated := make(map[string]string, len(nic)+3)
+	for k, v := range nic {
+		updated[k] = v
+	}
+	if acl == "" {
+		delete(updated, nicACLs)
+		delete(updated, nicACLsEgress)
+		delete(updated, nicACLsIngress)
+	} else {
+		updated[nicACLs] = acl
+		updated[nicACLsEgress] = "drop"
+		updated[nicACLsIngress] = "allow"
+	}
+	put := inst.Writable()
+	if put.Devices == nil {
+		put.Devices = map[string]map[string]string{}
+	}
+	put.Devices[dev] = updated
+	op, err := i.server.UpdateInstance(full, put, etag)
+	if err != nil {
+		return wrapError(fmt.Errorf("attaching network ACL to %s: %w", full, err))
+	}
+	return wrapError(op.WaitContext(ctx))
+}
+
+// managedNIC returns the first NIC, by device name, that is attached to a
+// managed network, which is what ACLs can be applied to.
+func managedNIC(devices map[string]map[string]string) (string, map[string]string) {
+	names := make([]string, 0, len(devices))
+	for name := range devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if d := devices[name]; d["type"] == "nic" && d["network"] != "" {
+			return name, d
+		}
+	}
+	return "", nil
+}
+
+// resolveRules parses the allowlist entries and replaces each domain with
+// its A and AAAA records, looked up from the host, keeping the entry's port
+// and protocol. Domains that don't resolve are skipped, as the in-container
+// resolver does; failed lists those whose lookup failed for any reason
+// other than the name not existing.
+func resolveRules(ctx context.Context, entries []string) (rules []egress.Rule, failed []string) {
+	seen := map[egress.Rule]bool{}
+	add := func(r egress.Rule) {
+		if !seen[r] {
+			seen[r] = true
+			rules = append(rules, r)
+		}
+	}
+	for _, r := range egress.ParseRules(entries) {
+		if r.IsAddr() {
+			add(r)
+			continue
+		}
+		name, ok := r.Resolvable()
+		if !ok {
+			continue
+		}
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", name)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				failed = append(failed, name)
+			}
+			continue
+		}
+		for _, ip := range ips {
+			add(egress.Rule{Host: ip.Unmap().String(), Port: r.Port, Proto: r.Proto})
+		}
+	}
+	return rules, failed
+}
+
+// resolveNames looks up the names in the allowlist entries from the host,
+// mapping each to its addresses.
+func resolveNames(ctx context.Context, entries []string) map[string][]string {
+	resolved := map[string][]string{}
+	for _, r := range egress.ParseRules(entries) {
+		name, ok := r.Resolvable()
+		if !ok || r.IsAddr() {
+			continue
+		}
+		if _, ok := resolved[name]; ok {
+			continue
+		}
+		ips, _ := net.DefaultResolver.LookupNetIP(ctx, "ip", name)
+		addrs := []string{}
+		for _, ip := range ips {
+			if a := ip.Unmap().String(); !slices.Contains(addrs, a) {
+				addrs = append(addrs, a)
+			}
+		}
+		resolved[name] = addrs
+	}
+	return resolved
+}
+
+// aclRules builds egress rules allowing rules, whose hosts are addresses,
+// and cidrs: one rule per address family for destinations allowed on any
+// port, and one per family, protocol and port for the rest. DNS is allowed
+// to any configured nameservers. DNS and DHCP to the managed network itself
+// are allowed by Incus.
+func aclRules(rules []egress.Rule, cidrs, dns []string) []api.NetworkACLRule {
+	type key struct {
+		proto string
+		port  int
+		v6    bool
+	}
+	var keys []key
+	dests := map[key][]string{}
+	add := func(k key, dst string) {
+		if _, ok := dests[k]; !ok {
+			keys = append(keys, k)
+		}
+		dests[k] = append(dests[k], dst)
+	}
+	// Destinations on any port come first, addresses before CIDRs.
+	for _, v6 := range []bool{false, true} {
+		for _, r := range rules {
+			if r.Port == 0 && strings.Contains(r.Host, ":") == v6 {
+				add(key{v6: v6}, r.Host)
+			}
+		}
+		for _, c := range cidrs {
+			if strings.Contains(c, ":") == v6 {
+				add(key{v6: v6}, c)
+			}
+		}
+	}
+	for _, r := range rules {
+		if r.Port == 0 {
+			continue
+		}
+		for _, proto := range r.Protos() {
+			add(key{proto, r.Port, strings.Contains(r.Host, ":")}, r.Host)
+		}
+	}
+
+	var out []api.NetworkACLRule
+	for _, k := range keys {
+		rule := api.NetworkACLRule{
+			Action:      "allow",
+			Destination: strings.Join(dests[k], ","),
+			Description: "pixels allowlist",
+			State:       "enabled",
+		}
+		if k.port > 0 {
+			rule.Protocol = k.proto
+			rule.DestinationPort = strconv.Itoa(k.port)
+		}
+		out = append(out, rule)
+	}
+	var nameservers []string
+	for _, ns := range dns {
+		if _, err := netip.ParseAddr(ns); err == nil {
+			nameservers = append(nameservers, ns)
+		}
+	}
+	if len(nameservers) > 0 {
+		for _, proto := range []string{"udp", "tcp"} {
+			out = append(out, api.NetworkACLRule{
+				Action:          "allow",
+				Destination:     strings.Join(nameservers, ","),
+				Protocol:        proto,
+				DestinationPort: "53",
+				Description:     "pixels DNS",
+				State:           "enabled",
+			})
+		}
+	}
+	return out
+}
+
+// splitList splits a comma-separated ACL config value.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
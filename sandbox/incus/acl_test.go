@@ -0,0 +1,112 @@
+package incus
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestACLRules(t *testing.T) {
+	rules := aclRules(
+		[]egress.Rule{
+			{Host: "140.82.112.3"},
+			{Host: "2606:50c0:8000::153"},
+			{Host: "10.0.0.5", Port: 5432, Proto: "tcp"},
+			{Host: "10.0.0.6", Port: 5432, Proto: "tcp"},
+			{Host: "2001:db8::1", Port: 443},
+		},
+		[]string{"185.199.108.0/22", "2606:50c0::/32"},
+		[]string{"1.1.1.1", "not-an-ip"},
+	)
+	want := []api.NetworkACLRule{
+		{Action: "allow", Destination: "140.82.112.3,185.199.108.0/22", Description: "pixels allowlist", State: "enabled"},
+		{Action: "allow", Destination: "2606:50c0:8000::153,2606:50c0::/32", Description: "pixels allowlist", State: "enabled"},
+		{Action: "allow", Destination: "10.0.0.5,10.0.0.6", Protocol: "tcp", DestinationPort: "5432", Description: "pixels allowlist", State: "enabled"},
+		{Action: "allow", Destination: "2001:db8::1", Protocol: "tcp", DestinationPort: "443", Description: "pixels allowlist", State: "enabled"},
+		{Action: "allow", Destination: "2001:db8::1", Protocol: "udp", DestinationPort: "443", Description: "pixels allowlist", State: "enabled"},
+		{Action: "allow", Destination: "1.1.1.1", Protocol: "udp", DestinationPort: "53", Description: "pixels DNS", State: "enabled"},
+		{Action: "allow", Destination: "1.1.1.1", Protocol: "tcp", DestinationPort: "53", Description: "pixels DNS", State: "enabled"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d: %+v", len(rules), len(want), rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+
+	// An empty allowlist allows nothing; the NIC's default action drops it.
+	if rules := aclRules(nil, nil, nil); len(rules) != 0 {
+		t.Errorf("empty policy rules = %+v", rules)
+	}
+}
+
+func TestManagedNIC(t *testing.T) {
+	devices := map[string]map[string]string{
+		"root": {"type": "disk", "path": "/"},
+		"mv0":  {"type": "nic", "nictype": "macvlan", "parent": "eno1"},
+		"eth1": {"type": "nic", "network": "lan"},
+		"eth0": {"type": "nic", "network": "incusbr0"},
+	}
+	if name, nic := managedNIC(devices); name != "eth0" || nic["network"] != "incusbr0" {
+		t.Errorf("managedNIC = %q, %v; want eth0", name, nic)
+	}
+	delete(devices, "eth0")
+	delete(devices, "eth1")
+	if name, nic := managedNIC(devices); nic != nil {
+		t.Errorf("managedNIC = %q, %v; want none for macvlan", name, nic)
+	}
+}
+
+func TestACLState(t *testing.T) {
+	p := sandbox.Policy{
+		Version: sandbox.PolicyVersion,
+		Mode:    sandbox.EgressAllowlist,
+		Domains: []string{"github.com", "10.0.0.5:5432/tcp"},
+		CIDRs:   []string{"185.199.108.0/22"},
+	}
+	acl := &api.NetworkACL{
+		NetworkACLPost: api.NetworkACLPost{Name: "px-web-egress"},
+		NetworkACLPut: api.NetworkACLPut{
+			Egress: aclRules(
+				[]egress.Rule{{Host: "140.82.112.3"}, {Host: "10.0.0.5", Port: 5432, Proto: "tcp"}},
+				p.CIDRs, []string{"1.1.1.1"},
+			),
+			Config: map[string]string{
+				aclDomainsKey: strings.Join(p.Domains, ","),
+				aclCIDRsKey:   strings.Join(p.CIDRs, ","),
+			},
+		},
+	}
+	nic := map[string]string{"type": "nic", "network": "incusbr0", nicACLs: "px-web-egress", nicACLsEgress: "drop"}
+
+	s := aclState(acl, nic)
+	s.Resolved = map[string][]string{"github.com": {"140.82.112.3"}}
+	if want := []string{"140.82.112.3", "185.199.108.0/22", "10.0.0.5:5432/tcp"}; !slices.Equal(s.Allowed, want) {
+		t.Errorf("Allowed = %v, want %v", s.Allowed, want)
+	}
+	if d := egress.Diff(p, s); len(d) != 0 {
+		t.Errorf("Diff of an intact ACL = %v, want none", d)
+	}
+
+	// Detached from the NIC, the ACL no longer enforces anything.
+	delete(nic, nicACLs)
+	if d := egress.Drift(p, aclState(acl, nic)); len(d) == 0 || d[0].Kind != egress.DiffRuleset {
+		t.Errorf("Drift of a detached ACL = %v, want the ruleset missing", d)
+	}
+	// An ACL edited to allow more, or deleted, is drift too.
+	acl.Egress = append(acl.Egress, api.NetworkACLRule{Action: "allow", Destination: "0.0.0.0/0", Description: "pixels allowlist", State: "enabled"})
+	nic[nicACLs] = "px-web-egress"
+	if d := egress.Drift(p, aclState(acl, nic)); !slices.ContainsFunc(d, func(d egress.Difference) bool { return d.Entry == "0.0.0.0/0" }) {
+		t.Errorf("Drift of a widened ACL = %v, want 0.0.0.0/0 extra", d)
+	}
+	if d := egress.Drift(p, aclState(nil, nic)); len(d) == 0 {
+		t.Error("Drift of a deleted ACL is empty")
+	}
+}
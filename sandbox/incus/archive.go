@@ -0,0 +1,55 @@
+package incus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	incusclient "github.com/lxc/incus/v6/client"
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// WriteArchive extracts a tar stream into dir by piping it to tar inside
+// the container, as root so recorded ownership is applied.
+func (i *Incus) WriteArchive(ctx context.Context, name, dir string, r io.Reader) error {
+	return i.tar(ctx, name, dir, sandbox.ExtractCommand(dir), r, io.Discard)
+}
+
+// ReadArchive streams p out of the container through tar.
+func (i *Incus) ReadArchive(ctx context.Context, name, p string, w io.Writer) error {
+	return i.tar(ctx, name, p, sandbox.ArchiveCommand(p), nil, w)
+}
+
+// tar runs a tar command line as root with binary-safe stdio. Unlike Run,
+// a non-nil stdin doesn't allocate a pty, which would mangle the stream.
+func (i *Incus) tar(ctx context.Context, name, p string, cmd []string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	dataDone := make(chan bool)
+	args := &incusclient.InstanceExecArgs{
+		Stdin:    stdin,
+		Stdout:   stdout,
+		Stderr:   &stderr,
+		DataDone: dataDone,
+	}
+
+	op, err := i.server.ExecInstance(prefixed(name), api.InstanceExecPost{
+		Command:     shellWrap(cmd),
+		WaitForWS:   true,
+		Interactive: false,
+	}, args)
+	if err != nil {
+		return i.execError(name, err)
+	}
+	if err := op.WaitContext(ctx); err != nil {
+		return fmt.Errorf("waiting for exec: %w", err)
+	}
+	<-dataDone
+
+	if rc := exitCodeFromOp(op); rc != 0 {
+		return sandbox.ArchiveError(p, rc, stderr.String())
+	}
+	return nil
+}
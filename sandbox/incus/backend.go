@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	incusclient "github.com/lxc/incus/v6/client"
 	"github.com/lxc/incus/v6/shared/api"
+	"github.com/lxc/incus/v6/shared/units"
 
 	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/provision"
@@ -24,6 +26,16 @@ const containerPrefix = "px-"
 func prefixed(name string) string  { return containerPrefix + name }
 func unprefixed(name string) string { return strings.TrimPrefix(name, containerPrefix) }
 
+// Instance config keys holding pixels metadata. User labels are stored as
+// user.label.<key>.
+const (
+	configImage       = "user.pixels.image"
+	configOrigin      = "user.pixels.origin"
+	configEgress      = "user.pixels.egress"
+	configPolicy      = "user.pixels.egress.policy"
+	configLabelPrefix = "user.label."
+)
+
 // Create creates a new container instance with the full provisioning flow.
 // When opts.Bare is true, only the instance is created (no provisioning).
 func (i *Incus) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.Instance, error) {
@@ -43,9 +55,19 @@ func (i *Incus) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.I
 		memory = i.cfg.memory * 1024 * 1024 // MiB → bytes
 	}
 
+	egressMode := sandbox.EgressUnrestricted
+	if !opts.Bare && i.cfg.provision && i.cfg.egress != "" {
+		egressMode = sandbox.EgressMode(i.cfg.egress)
+	}
 	config := map[string]string{
 		"limits.cpu":    cpu,
 		"limits.memory": fmt.Sprintf("%d", memory),
+		configImage:     image,
+		configEgress:    string(egressMode),
+		configPolicy:    string(egress.MarshalPolicy(egress.NewPolicy(egressMode, i.cfg.allow))),
+	}
+	for k, v := range opts.Labels {
+		config[configLabelPrefix+k] = v
 	}
 
 	devices := map[string]map[string]string{}
@@ -67,6 +89,7 @@ func (i *Incus) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.I
 			"parent":  i.cfg.parent,
 		}
 	}
+	addMountDevices(devices, opts.Mounts)
 
 	source := api.InstanceSource{
 		Type:  "image",
@@ -89,10 +112,19 @@ func (i *Incus) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.I
 
 	op, err := i.server.CreateInstance(req)
 	if err != nil {
-		return nil, fmt.Errorf("creating instance: %w", err)
+		return nil, wrapStorageError(fmt.Errorf("creating instance: %w", err))
 	}
 	if err := op.WaitContext(ctx); err != nil {
-		return nil, fmt.Errorf("waiting for instance creation: %w", err)
+		return nil, wrapStorageError(fmt.Errorf("waiting for instance creation: %w", err))
+	}
+
+	// A host-enforced policy is in place before the first start, so the
+	// container never has unrestricted egress.
+	if i.hostEgress() && egressMode != sandbox.EgressUnrestricted {
+		if err := i.setHostEgress(ctx, full, egressMode); err != nil {
+			_ = i.Delete(context.WithoutCancel(ctx), name)
+			return nil, err
+		}
 	}
 
 	// Start the instance.
@@ -101,26 +133,23 @@ func (i *Incus) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.I
 		Timeout: -1,
 	}, "")
 	if err != nil {
-		return nil, fmt.Errorf("starting instance: %w", err)
+		return nil, wrapError(fmt.Errorf("starting instance: %w", err))
 	}
 	if err := startOp.WaitContext(ctx); err != nil {
-		return nil, fmt.Errorf("waiting for instance start: %w", err)
+		return nil, wrapError(fmt.Errorf("waiting for instance start: %w", err))
 	}
 
 	if opts.Bare {
 		inst, _, err := i.server.GetInstance(full)
 		if err != nil {
-			return nil, fmt.Errorf("getting instance: %w", err)
+			return nil, wrapError(fmt.Errorf("getting instance: %w", err))
 		}
-		return &sandbox.Instance{
-			Name:   name,
-			Status: normalizeStatus(inst.Status),
-		}, nil
+		return toInstance(inst, nil), nil
 	}
 
 	// Wait for the Incus agent to be ready.
 	if err := i.waitAgentReady(ctx, full, 60*time.Second); err != nil {
-		return nil, fmt.Errorf("waiting for agent: %w", err)
+		return nil, wrapError(fmt.Errorf("waiting for agent: %w", err))
 	}
 
 	// Provision if enabled.
@@ -132,34 +161,29 @@ func (i *Incus) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.I
 	}
 
 	// Poll for IP assignment.
-	var addrs []string
+	var state *api.InstanceState
 	if err := retry.Poll(ctx, time.Second, 30*time.Second, func(ctx context.Context) (bool, error) {
-		state, _, err := i.server.GetInstanceState(full)
+		s, _, err := i.server.GetInstanceState(full)
 		if err != nil {
 			return false, nil
 		}
-		addrs = extractIPv4(state)
-		return len(addrs) > 0, nil
+		state = s
+		return len(extractAddresses(state, "inet")) > 0, nil
 	}); err != nil && !errors.Is(err, retry.ErrTimeout) {
 		return nil, err
 	}
 
 	inst, _, err := i.server.GetInstance(full)
 	if err != nil {
-		return nil, fmt.Errorf("getting instance: %w", err)
+		return nil, wrapError(fmt.Errorf("getting instance: %w", err))
 	}
-
-	return &sandbox.Instance{
-		Name:      name,
-		Status:    normalizeStatus(inst.Status),
-		Addresses: addrs,
-	}, nil
+	return toInstance(inst, state), nil
 }
 
 // provisionInstance pushes files and runs bootstrap inside the container.
 func (i *Incus) provisionInstance(ctx context.Context, full string) error {
 	pubKey := readSSHPubKey(i.cfg.sshKey)
-	steps := provision.Steps(i.cfg.egress, i.cfg.devtools)
+	steps := provision.Steps(i.containerEgress(), i.cfg.devtools)
 
 	// Ensure directories exist.
 	i.mkdir(full, "/root/.ssh", 0o700)
@@ -219,9 +243,10 @@ func (i *Incus) provisionInstance(ctx context.Context, full string) error {
 	}
 
 	// Egress files.
-	isRestricted := i.cfg.egress == "agent" || i.cfg.egress == "allowlist"
+	egressMode := i.containerEgress()
+	isRestricted := egress.IsRestricted(egressMode)
 	if isRestricted {
-		if err := i.pushEgressFiles(ctx, full, i.cfg.egress, i.cfg.allow); err != nil {
+		if err := i.pushEgressFiles(ctx, full, egressMode, i.cfg.allow); err != nil {
 			return err
 		}
 	}
@@ -264,6 +289,9 @@ func (i *Incus) pushEgressFiles(ctx context.Context, full, egressMode string, al
 	if err := i.pushFile(full, "/usr/local/bin/pixels-resolve-egress.sh", []byte(egress.ResolveScript()), 0o755); err != nil {
 		return fmt.Errorf("writing resolve script: %w", err)
 	}
+	if err := i.pushDNSFilter(full); err != nil {
+		return err
+	}
 	if err := i.pushFile(full, "/usr/local/bin/safe-apt", []byte(egress.SafeAptScript()), 0o755); err != nil {
 		return fmt.Errorf("writing safe-apt: %w", err)
 	}
@@ -295,26 +323,21 @@ func (i *Incus) Get(ctx context.Context, name string) (*sandbox.Instance, error)
 	full := prefixed(name)
 	inst, _, err := i.server.GetInstance(full)
 	if err != nil {
-		return nil, sandbox.WrapNotFound(fmt.Errorf("getting %s: %w", name, err))
+		return nil, wrapError(fmt.Errorf("getting %s: %w", name, err))
 	}
 
 	state, _, err := i.server.GetInstanceState(full)
 	if err != nil {
-		return nil, fmt.Errorf("getting state for %s: %w", name, err)
+		return nil, wrapError(fmt.Errorf("getting state for %s: %w", name, err))
 	}
-
-	return &sandbox.Instance{
-		Name:      name,
-		Status:    normalizeStatus(inst.Status),
-		Addresses: extractIPv4(state),
-	}, nil
+	return toInstance(inst, state), nil
 }
 
 // List returns all px- prefixed instances with the prefix stripped.
 func (i *Incus) List(ctx context.Context) ([]sandbox.Instance, error) {
 	instances, err := i.server.GetInstances(api.InstanceTypeContainer)
 	if err != nil {
-		return nil, fmt.Errorf("listing instances: %w", err)
+		return nil, wrapError(fmt.Errorf("listing instances: %w", err))
 	}
 
 	var result []sandbox.Instance
@@ -322,15 +345,9 @@ func (i *Incus) List(ctx context.Context) ([]sandbox.Instance, error) {
 		if !strings.HasPrefix(inst.Name, containerPrefix) {
 			continue
 		}
-		si := sandbox.Instance{
-			Name:   unprefixed(inst.Name),
-			Status: normalizeStatus(inst.Status),
-		}
-		// Get addresses from instance state.
-		if state, _, err := i.server.GetInstanceState(inst.Name); err == nil {
-			si.Addresses = extractIPv4(state)
-		}
-		result = append(result, si)
+		// Addresses come from instance state; list without them if it fails.
+		state, _, _ := i.server.GetInstanceState(inst.Name)
+		result = append(result, *toInstance(&inst, state))
 	}
 	return result, nil
 }
@@ -343,10 +360,10 @@ func (i *Incus) Start(ctx context.Context, name string) error {
 		Timeout: -1,
 	}, "")
 	if err != nil {
-		return fmt.Errorf("starting %s: %w", name, err)
+		return wrapError(fmt.Errorf("starting %s: %w", name, err))
 	}
 	if err := op.WaitContext(ctx); err != nil {
-		return fmt.Errorf("waiting for %s to start: %w", name, err)
+		return wrapError(fmt.Errorf("waiting for %s to start: %w", name, err))
 	}
 	return nil
 }
@@ -360,10 +377,10 @@ func (i *Incus) Stop(ctx context.Context, name string) error {
 		Force:   true,
 	}, "")
 	if err != nil {
-		return fmt.Errorf("stopping %s: %w", name, err)
+		return wrapError(fmt.Errorf("stopping %s: %w", name, err))
 	}
 	if err := op.WaitContext(ctx); err != nil {
-		return fmt.Errorf("waiting for %s to stop: %w", name, err)
+		return wrapError(fmt.Errorf("waiting for %s to stop: %w", name, err))
 	}
 	return nil
 }
@@ -386,25 +403,100 @@ func (i *Incus) Delete(ctx context.Context, name string) error {
 	if err := retry.Do(ctx, 3, 2*time.Second, func(ctx context.Context) error {
 		delOp, err := i.server.DeleteInstance(full)
 		if err != nil {
-			return fmt.Errorf("deleting %s: %w", name, err)
+			return wrapError(fmt.Errorf("deleting %s: %w", name, err))
 		}
 		return delOp.WaitContext(ctx)
 	}); err != nil {
-		return err
+		return wrapError(err)
+	}
+	if i.hostEgress() {
+		_ = i.server.DeleteNetworkACL(aclName(full))
+	}
+	return nil
+}
+
+// UpdateLimits sets limits.cpu and limits.memory, which Incus applies to a
+// running container immediately, and grows the root disk by overriding the
+// profile's root device with a local one.
+func (i *Incus) UpdateLimits(ctx context.Context, name string, l sandbox.Limits) error {
+	full := prefixed(name)
+	inst, etag, err := i.server.GetInstance(full)
+	if err != nil {
+		return wrapError(fmt.Errorf("getting %s: %w", name, err))
+	}
+
+	put := inst.Writable()
+	if put.Config == nil {
+		put.Config = map[string]string{}
+	}
+	if l.CPU != "" {
+		put.Config["limits.cpu"] = l.CPU
+	}
+	if l.Memory > 0 {
+		put.Config["limits.memory"] = fmt.Sprintf("%d", l.Memory)
+	}
+	if l.Disk > 0 {
+		root := inst.ExpandedDevices["root"]
+		if root == nil || root["type"] != "disk" {
+			return fmt.Errorf("%s has no root disk device", name)
+		}
+		dev := make(map[string]string, len(root)+1)
+		for k, v := range root {
+			dev[k] = v
+		}
+		dev["size"] = fmt.Sprintf("%d", l.Disk)
+		if put.Devices == nil {
+			put.Devices = map[string]map[string]string{}
+		}
+		put.Devices["root"] = dev
+	}
+
+	op, err := i.server.UpdateInstance(full, put, etag)
+	if err != nil {
+		return wrapError(fmt.Errorf("updating limits on %s: %w", name, err))
+	}
+	if err := op.WaitContext(ctx); err != nil {
+		return wrapError(fmt.Errorf("waiting for limits on %s: %w", name, err))
 	}
 	return nil
 }
 
+// Stats returns the usage counters Incus keeps in the instance state.
+func (i *Incus) Stats(ctx context.Context, name string) (*sandbox.Stats, error) {
+	state, _, err := i.server.GetInstanceState(prefixed(name))
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("getting state for %s: %w", name, err))
+	}
+	st := &sandbox.Stats{
+		CPUTime:    time.Duration(state.CPU.Usage),
+		Memory:     state.Memory.Usage,
+		MemoryPeak: state.Memory.UsagePeak,
+		Disk:       state.Disk["root"].Usage,
+	}
+	for dev, net := range state.Network {
+		if dev == "lo" {
+			continue
+		}
+		st.NetRX += net.Counters.BytesReceived
+		st.NetTX += net.Counters.BytesSent
+	}
+	return st, nil
+}
+
 // CreateSnapshot creates a snapshot for the named instance.
 func (i *Incus) CreateSnapshot(ctx context.Context, name, label string) error {
 	full := prefixed(name)
+	// A taken label doesn't reliably come back as 409, so check first.
+	if _, _, err := i.server.GetInstanceSnapshot(full, label); err == nil {
+		return fmt.Errorf("snapshot %s of %s: %w", label, name, sandbox.ErrAlreadyExists)
+	}
 	op, err := i.server.CreateInstanceSnapshot(full, api.InstanceSnapshotsPost{
 		Name: label,
 	})
 	if err != nil {
-		return fmt.Errorf("creating snapshot: %w", err)
+		return wrapStorageError(fmt.Errorf("creating snapshot: %w", err))
 	}
-	return op.WaitContext(ctx)
+	return wrapStorageError(op.WaitContext(ctx))
 }
 
 // ListSnapshots returns all snapshots for the named instance.
@@ -412,7 +504,7 @@ func (i *Incus) ListSnapshots(ctx context.Context, name string) ([]sandbox.Snaps
 	full := prefixed(name)
 	snaps, err := i.server.GetInstanceSnapshots(full)
 	if err != nil {
-		return nil, fmt.Errorf("listing snapshots: %w", err)
+		return nil, wrapError(fmt.Errorf("listing snapshots: %w", err))
 	}
 	result := make([]sandbox.Snapshot, len(snaps))
 	for idx, s := range snaps {
@@ -422,47 +514,58 @@ func (i *Incus) ListSnapshots(ctx context.Context, name string) ([]sandbox.Snaps
 			CreatedAt: s.CreatedAt,
 		}
 	}
+	sort.SliceStable(result, func(a, b int) bool { return result[a].CreatedAt.Before(result[b].CreatedAt) })
 	return result, nil
 }
 
-
 // DeleteSnapshot deletes a snapshot by label.
 func (i *Incus) DeleteSnapshot(ctx context.Context, name, label string) error {
 	full := prefixed(name)
 	op, err := i.server.DeleteInstanceSnapshot(full, label)
 	if err != nil {
-		return fmt.Errorf("deleting snapshot: %w", err)
+		return wrapSnapshotDeleteError(fmt.Errorf("deleting snapshot: %w", err))
 	}
-	return op.WaitContext(ctx)
+	return wrapSnapshotDeleteError(op.WaitContext(ctx))
 }
 
 // RestoreSnapshot rolls back to the given snapshot: stop, restore, start.
 func (i *Incus) RestoreSnapshot(ctx context.Context, name, label string) error {
 	full := prefixed(name)
 
+	// Check the snapshot exists before stopping, so a bad label leaves the
+	// instance running.
+	if _, _, err := i.server.GetInstanceSnapshot(full, label); err != nil {
+		return wrapError(fmt.Errorf("getting snapshot %s: %w", label, err))
+	}
+
 	// Stop instance.
 	if err := i.Stop(ctx, name); err != nil {
-		return fmt.Errorf("stopping for restore: %w", err)
+		return wrapError(fmt.Errorf("stopping for restore: %w", err))
 	}
 
 	// Restore from snapshot.
 	inst, etag, err := i.server.GetInstance(full)
 	if err != nil {
-		return fmt.Errorf("getting instance for restore: %w", err)
+		return wrapError(fmt.Errorf("getting instance for restore: %w", err))
 	}
 	put := inst.Writable()
 	put.Restore = label
 	op, err := i.server.UpdateInstance(full, put, etag)
 	if err != nil {
-		return fmt.Errorf("restoring snapshot: %w", err)
+		return wrapError(fmt.Errorf("restoring snapshot: %w", err))
 	}
 	if err := op.WaitContext(ctx); err != nil {
-		return fmt.Errorf("waiting for restore: %w", err)
+		return wrapError(fmt.Errorf("waiting for restore: %w", err))
+	}
+	if i.hostEgress() {
+		if err := i.syncACL(ctx, full); err != nil {
+			return err
+		}
 	}
 
 	// Start instance.
 	if err := i.Start(ctx, name); err != nil {
-		return fmt.Errorf("starting after restore: %w", err)
+		return wrapError(fmt.Errorf("starting after restore: %w", err))
 	}
 
 	return nil
@@ -479,46 +582,111 @@ func (i *Incus) CloneFrom(ctx context.Context, source, label, newName string) er
 	// Get source instance for the copy.
 	sourceInst, _, err := i.server.GetInstance(sourceFull)
 	if err != nil {
-		return fmt.Errorf("getting source instance: %w", err)
+		return wrapError(fmt.Errorf("getting source instance: %w", err))
+	}
+	if _, _, err := i.server.GetInstanceSnapshot(sourceFull, label); err != nil {
+		return wrapError(fmt.Errorf("getting snapshot %s: %w", label, err))
 	}
 
-	// Strip volatile.* keys: these encode per-instance identity (MAC, idmap,
-	// last_state, etc.) and must not survive into the clone. Matches the
-	// behaviour of the `incus copy` CLI.
-	for k := range sourceInst.Config {
-		if strings.HasPrefix(k, "volatile.") {
-			delete(sourceInst.Config, k)
+	sourceInst.Config[configOrigin] = source + ":" + label
+	if err := i.copySnapshot(sourceInst, label, newFull); err != nil {
+		return err
+	}
+	if i.hostEgress() {
+		if err := i.copyACL(ctx, sourceFull, newFull); err != nil {
+			_ = i.Delete(context.WithoutCancel(ctx), newName)
+			return err
 		}
 	}
 
-	// Copy from snapshot.
-	sourceInst.Name = sourceFull + "/" + label
-	op, err := i.server.CopyInstance(i.server, *sourceInst, &incusclient.InstanceCopyArgs{
-		Name:         newFull,
+	// Callers (BuildBase, create_sandbox) expect a clone to be running on
+	// return — Ready polls for state.Running. Match the TrueNAS backend and
+	// the post-Create flow above.
+	if err := i.Start(ctx, newName); err != nil {
+		return wrapError(fmt.Errorf("starting clone: %w", err))
+	}
+
+	return nil
+}
+
+// copySnapshot copies snapshot label of inst into a new, stopped instance
+// called dst. Volatile keys are stripped first: they encode per-instance
+// identity (MAC, idmap, last_state, etc.) and must not survive into the
+// copy. Matches the behaviour of the `incus copy` CLI.
+func (i *Incus) copySnapshot(inst *api.Instance, label, dst string) error {
+	stripVolatile(inst.Config)
+	src := *inst
+	src.Name = inst.Name + "/" + label
+	op, err := i.server.CopyInstance(i.server, src, &incusclient.InstanceCopyArgs{
+		Name:         dst,
 		InstanceOnly: true,
 	})
 	if err != nil {
-		return fmt.Errorf("copying instance: %w", err)
+		return wrapStorageError(fmt.Errorf("copying instance: %w", err))
 	}
 	if err := op.Wait(); err != nil {
-		return fmt.Errorf("waiting for copy: %w", err)
+		return wrapStorageError(fmt.Errorf("waiting for copy: %w", err))
 	}
+	return nil
+}
 
-	// Callers (BuildBase, create_sandbox) expect a clone to be running on
-	// return — Ready polls for state.Running. Match the TrueNAS backend and
-	// the post-Create flow above.
-	if err := i.Start(ctx, newName); err != nil {
-		return fmt.Errorf("starting clone: %w", err)
+// stripVolatile deletes volatile.* keys from an instance config.
+func stripVolatile(config map[string]string) {
+	for k := range config {
+		if strings.HasPrefix(k, "volatile.") {
+			delete(config, k)
+		}
 	}
+}
 
+// requireInstance returns an error wrapping sandbox.ErrNotFound when the
+// instance does not exist. Methods that probe the container with exec
+// would otherwise mistake a missing instance for an unconfigured one.
+func (i *Incus) requireInstance(name string) error {
+	if _, _, err := i.server.GetInstance(prefixed(name)); err != nil {
+		return wrapError(fmt.Errorf("getting %s: %w", name, err))
+	}
 	return nil
 }
 
+// toInstance converts an Incus instance, reading limits from its expanded
+// config so profile defaults count. Addresses are read from state, which
+// may be nil.
+func toInstance(inst *api.Instance, state *api.InstanceState) *sandbox.Instance {
+	out := &sandbox.Instance{
+		Name:        unprefixed(inst.Name),
+		Status:      normalizeStatus(inst.Status),
+		Addresses:   extractAddresses(state, "inet"),
+		AddressesV6: extractAddresses(state, "inet6"),
+		CreatedAt:   inst.CreatedAt,
+		Image:       inst.Config[configImage],
+		Origin:      inst.Config[configOrigin],
+		CPU:         inst.ExpandedConfig["limits.cpu"],
+		Egress:      sandbox.EgressMode(inst.Config[configEgress]),
+	}
+	if out.Image == "" {
+		out.Image = inst.Config["image.description"]
+	}
+	if mem, err := units.ParseByteSizeString(inst.ExpandedConfig["limits.memory"]); err == nil {
+		out.Memory = mem
+	}
+	for k, v := range inst.Config {
+		if key, ok := strings.CutPrefix(k, configLabelPrefix); ok {
+			if out.Labels == nil {
+				out.Labels = map[string]string{}
+			}
+			out.Labels[key] = v
+		}
+	}
+	return out
+}
+
 // normalizeStatus converts Incus status strings ("Running") to sandbox.Status ("RUNNING").
 func normalizeStatus(s string) sandbox.Status { return sandbox.Status(strings.ToUpper(s)) }
 
-// extractIPv4 extracts all global IPv4 addresses from instance state.
-func extractIPv4(state *api.InstanceState) []string {
+// extractAddresses extracts all global addresses of family ("inet" or
+// "inet6") from instance state.
+func extractAddresses(state *api.InstanceState, family string) []string {
 	if state == nil || state.Network == nil {
 		return nil
 	}
@@ -528,7 +696,7 @@ func extractIPv4(state *api.InstanceState) []string {
 			continue
 		}
 		for _, addr := range net.Addresses {
-			if addr.Family == "inet" && addr.Scope == "global" {
+			if addr.Family == family && addr.Scope == "global" {
 				addrs = append(addrs, addr.Address)
 			}
 		}
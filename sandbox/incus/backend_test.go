@@ -0,0 +1,31 @@
+package incus
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lxc/incus/v6/shared/api"
+)
+
+func TestExtractAddresses(t *testing.T) {
+	state := &api.InstanceState{Network: map[string]api.InstanceStateNetwork{
+		"lo": {Addresses: []api.InstanceStateNetworkAddress{
+			{Family: "inet", Address: "127.0.0.1", Scope: "local"},
+			{Family: "inet6", Address: "::1", Scope: "local"},
+		}},
+		"eth0": {Addresses: []api.InstanceStateNetworkAddress{
+			{Family: "inet", Address: "10.0.0.5", Scope: "global"},
+			{Family: "inet6", Address: "fe80::5", Scope: "link"},
+			{Family: "inet6", Address: "2001:db8::5", Scope: "global"},
+		}},
+	}}
+	if got := extractAddresses(state, "inet"); !slices.Equal(got, []string{"10.0.0.5"}) {
+		t.Errorf("inet = %v", got)
+	}
+	if got := extractAddresses(state, "inet6"); !slices.Equal(got, []string{"2001:db8::5"}) {
+		t.Errorf("inet6 = %v", got)
+	}
+	if got := extractAddresses(nil, "inet"); got != nil {
+		t.Errorf("nil state = %v", got)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/sandbox/user"
 )
 
@@ -37,6 +38,8 @@ type incusCfg struct {
 	provision bool
 	devtools  bool
 	egress    string
+	enforce   string // enforceContainer or enforceHost
+	dnsFilter bool
 	allow     []string
 	dns       []string
 
@@ -58,6 +61,7 @@ func parseCfg(m map[string]string) (*incusCfg, error) {
 		provision:   true,
 		devtools:    true,
 		egress:      "unrestricted",
+		enforce:     enforceContainer,
 	}
 
 	if v := m["socket"]; v != "" {
@@ -131,13 +135,29 @@ func parseCfg(m map[string]string) (*incusCfg, error) {
 		c.devtools = b
 	}
 	if v := m["egress"]; v != "" {
+		if err := egress.ValidateEgress(v); err != nil {
+			return nil, fmt.Errorf("invalid egress %q: %w", v, err)
+		}
+		c.egress = v
+	}
+	if v := m["enforce"]; v != "" {
 		switch v {
-		case "unrestricted", "agent", "allowlist":
-			c.egress = v
+		case enforceContainer, enforceHost:
+			c.enforce = v
 		default:
-			return nil, fmt.Errorf("invalid egress %q: must be unrestricted, agent, or allowlist", v)
+			return nil, fmt.Errorf("invalid enforce %q: must be container or host", v)
 		}
 	}
+	if v := m["dns_filter"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns_filter %q: %w", v, err)
+		}
+		c.dnsFilter = b
+	}
+	if c.dnsFilter && c.enforce == enforceHost {
+		return nil, fmt.Errorf("dns_filter needs enforce = container: host-enforced egress is resolved on the host")
+	}
 	if v := m["allow"]; v != "" {
 		c.allow = strings.Split(v, ",")
 	}
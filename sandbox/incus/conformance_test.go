@@ -0,0 +1,20 @@
+package incus
+
+import (
+	"testing"
+
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/sandboxtest"
+)
+
+// TestConformance runs the shared backend suite against a real Incus
+// daemon. It creates and deletes px-sbt-* containers, so it only runs when
+// PIXELS_CONFORMANCE_INCUS_SOCKET points at the daemon's unix socket.
+func TestConformance(t *testing.T) {
+	cfg := map[string]string{
+		"socket": sandboxtest.Env(t, "PIXELS_CONFORMANCE_INCUS_SOCKET"),
+	}
+	sandboxtest.Run(t, func(cfg map[string]string) (sandbox.Sandbox, error) {
+		return New(cfg)
+	}, cfg)
+}
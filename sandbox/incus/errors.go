@@ -0,0 +1,82 @@
+package incus
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// statusKinds maps the API status codes Incus uses for a kind of failure.
+// Incus answers a name clash with 409 Conflict.
+var statusKinds = map[int]error{
+	http.StatusNotFound:           sandbox.ErrNotFound,
+	http.StatusConflict:           sandbox.ErrAlreadyExists,
+	http.StatusServiceUnavailable: sandbox.ErrUnavailable,
+}
+
+// wrapError marks an Incus error with its sandbox error kind, going by the
+// response status where there is one and by sandbox.WrapError otherwise.
+// Failed operations only carry a message, so beyond network failures they
+// are left without a kind.
+func wrapError(err error) error {
+	for status, kind := range statusKinds {
+		if api.StatusErrorCheck(err, status) {
+			return sandbox.Wrap(kind, err)
+		}
+	}
+	return sandbox.WrapError(err)
+}
+
+// quotaPhrases are the lower-cased messages of a full pool or volume
+// (ENOSPC, EDQUOT) and of a project limit, which Incus passes on as text.
+var quotaPhrases = []string{"no space left on device", "disk quota exceeded", "reached maximum"}
+
+// snapshotBusyPhrases are the lower-cased messages of a storage driver
+// refusing to delete a snapshot that something still depends on.
+var snapshotBusyPhrases = []string{"device or resource busy", "has dependent", "is in use"}
+
+// wrapStorageError is wrapError for calls that write to storage: creating
+// instances and snapshots, copies and file pushes. A full disk or a
+// project limit only shows in the message, so it is matched there.
+func wrapStorageError(err error) error {
+	return wrapPhrases(wrapError(err), quotaPhrases, sandbox.ErrQuotaExceeded)
+}
+
+// wrapSnapshotDeleteError is wrapError for deleting a snapshot, where a
+// busy dataset means a clone or mount still holds it.
+func wrapSnapshotDeleteError(err error) error {
+	return wrapPhrases(wrapError(err), snapshotBusyPhrases, sandbox.ErrSnapshotInUse)
+}
+
+// wrapPhrases marks err as kind if it has no kind yet and its message
+// contains one of phrases.
+func wrapPhrases(err error, phrases []string, kind error) error {
+	if err == nil || sandbox.ErrorCode(err) != "" {
+		return err
+	}
+	msg := strings.ToLower(err.Error())
+	for _, phrase := range phrases {
+		if strings.Contains(msg, phrase) {
+			return sandbox.Wrap(kind, err)
+		}
+	}
+	return err
+}
+
+// execError wraps the error from starting an exec on name. Incus refuses
+// an exec on a stopped instance with a bare 400, so on a 400 the
+// instance's state tells whether it was stopped.
+func (i *Incus) execError(name string, err error) error {
+	err = fmt.Errorf("exec on %s: %w", name, err)
+	if api.StatusErrorCheck(err, http.StatusBadRequest) {
+		state, _, serr := i.server.GetInstanceState(prefixed(name))
+		if serr == nil && state.StatusCode != api.Running {
+			return sandbox.Wrap(sandbox.ErrNotRunning, err)
+		}
+	}
+	return wrapError(err)
+}
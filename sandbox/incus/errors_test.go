@@ -0,0 +1,97 @@
+package incus
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	incusclient "github.com/lxc/incus/v6/client"
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{api.StatusErrorf(http.StatusNotFound, "Instance not found"), sandbox.ErrNotFound},
+		{api.StatusErrorf(http.StatusConflict, "Instance %q already exists", "px-a"), sandbox.ErrAlreadyExists},
+		{api.StatusErrorf(http.StatusServiceUnavailable, "Cluster member offline"), sandbox.ErrUnavailable},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, sandbox.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		err := wrapError(fmt.Errorf("op: %w", tt.err))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("wrapError(%v) = %v, want %v", tt.err, err, tt.want)
+		}
+	}
+}
+
+func TestWrapStorageError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{errors.New("Failed to write file: no space left on device"), sandbox.ErrQuotaExceeded},
+		{errors.New("cannot create snapshot: Disk quota exceeded"), sandbox.ErrQuotaExceeded},
+		{api.StatusErrorf(http.StatusBadRequest, "Reached maximum number of instances in project %q", "dev"), sandbox.ErrQuotaExceeded},
+		{api.StatusErrorf(http.StatusConflict, "Snapshot %q already exists", "ready"), sandbox.ErrAlreadyExists},
+	}
+	for _, tt := range tests {
+		err := wrapStorageError(fmt.Errorf("op: %w", tt.err))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("wrapStorageError(%v) = %v, want %v", tt.err, err, tt.want)
+		}
+	}
+	if err := wrapStorageError(errors.New("Failed to mount: device or resource busy")); sandbox.ErrorCode(err) != "" {
+		t.Errorf("wrapStorageError(busy) = %v, want no kind", err)
+	}
+}
+
+func TestWrapSnapshotDeleteError(t *testing.T) {
+	err := wrapSnapshotDeleteError(errors.New("cannot destroy snapshot: dataset is busy: device or resource busy"))
+	if !errors.Is(err, sandbox.ErrSnapshotInUse) {
+		t.Errorf("busy snapshot = %v, want ErrSnapshotInUse", err)
+	}
+	err = wrapSnapshotDeleteError(api.StatusErrorf(http.StatusNotFound, "Snapshot not found"))
+	if !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("missing snapshot = %v, want ErrNotFound", err)
+	}
+}
+
+// stateServer answers GetInstanceState with a fixed status; other calls
+// panic through the nil embedded interface.
+type stateServer struct {
+	incusclient.InstanceServer
+	status api.StatusCode
+}
+
+func (s stateServer) GetInstanceState(name string) (*api.InstanceState, string, error) {
+	return &api.InstanceState{StatusCode: s.status}, "", nil
+}
+
+func TestExecError(t *testing.T) {
+	refused := api.StatusErrorf(http.StatusBadRequest, "Instance is not running")
+	tests := []struct {
+		name   string
+		status api.StatusCode
+		err    error
+		want   string
+	}{
+		{"stopped", api.Stopped, refused, "not_running"},
+		{"running", api.Running, refused, ""},
+		{"missing", api.Stopped, api.StatusErrorf(http.StatusNotFound, "Instance not found"), "not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Incus{server: stateServer{status: tt.status}}
+			if got := sandbox.ErrorCode(i.execError("a", tt.err)); got != tt.want {
+				t.Errorf("execError kind = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
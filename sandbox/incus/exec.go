@@ -3,12 +3,16 @@ package incus
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/lxc/incus/v6/shared/api"
 	"golang.org/x/term"
 
@@ -20,6 +24,58 @@ import (
 
 // Run executes a command inside a sandbox instance and returns its exit code.
 func (i *Incus) Run(ctx context.Context, name string, opts sandbox.ExecOpts) (int, error) {
+	return i.run(ctx, name, opts, nil)
+}
+
+// StartProcess runs a command in the background. Signals are delivered
+// over the exec operation's control websocket rather than with a second
+// exec.
+func (i *Incus) StartProcess(ctx context.Context, name string, opts sandbox.ExecOpts) (sandbox.Process, error) {
+	ctl := &execControl{}
+	run := func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error) {
+		return i.run(ctx, name, sandbox.ExecOpts{
+			Cmd:    cmd,
+			Env:    opts.Env,
+			Stdout: stdout,
+			Stderr: stderr,
+			Root:   opts.Root,
+		}, ctl.attach)
+	}
+	signal := func(ctx context.Context, pid int, sig syscall.Signal) error {
+		if ok, err := ctl.signal(sig); ok {
+			return err
+		}
+		_, err := i.Output(ctx, name, sandbox.KillCommand(pid, sig))
+		return err
+	}
+	return sandbox.RunInBackground(ctx, opts.Cmd, run, signal)
+}
+
+// execControl holds the control websocket of a running exec operation.
+type execControl struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (c *execControl) attach(conn *websocket.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = conn
+}
+
+// signal sends sig over the control websocket. ok is false when no
+// websocket was attached.
+func (c *execControl) signal(sig syscall.Signal) (ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return false, nil
+	}
+	return true, c.conn.WriteJSON(api.InstanceExecControl{Command: "signal", Signal: int(sig)})
+}
+
+// run is Run with an optional handler for the exec control websocket.
+func (i *Incus) run(ctx context.Context, name string, opts sandbox.ExecOpts, control func(*websocket.Conn)) (int, error) {
 	full := prefixed(name)
 
 	env := envSliceToMap(opts.Env)
@@ -64,12 +120,13 @@ func (i *Incus) Run(ctx context.Context, name string, opts sandbox.ExecOpts) (in
 		Stdin:    stdin,
 		Stdout:   stdout,
 		Stderr:   stderr,
+		Control:  control,
 		DataDone: dataDone,
 	}
 
 	op, err := i.server.ExecInstance(full, execPost, args)
 	if err != nil {
-		return 1, fmt.Errorf("exec on %s: %w", name, err)
+		return 1, i.execError(name, err)
 	}
 
 	if err := op.WaitContext(ctx); err != nil {
@@ -103,7 +160,7 @@ func (i *Incus) Output(ctx context.Context, name string, cmd []string) ([]byte,
 		Interactive: false,
 	}, args)
 	if err != nil {
-		return nil, fmt.Errorf("exec on %s: %w", name, err)
+		return nil, i.execError(name, err)
 	}
 
 	if err := op.WaitContext(ctx); err != nil {
@@ -201,6 +258,11 @@ func (i *Incus) Ready(ctx context.Context, name string, timeout time.Duration) e
 	err := retry.Poll(ctx, time.Second, timeout, func(ctx context.Context) (bool, error) {
 		state, _, err := i.server.GetInstanceState(full)
 		if err != nil {
+			// A missing instance will never become ready; anything else
+			// may be transient.
+			if err := wrapError(err); errors.Is(err, sandbox.ErrNotFound) {
+				return false, err
+			}
 			return false, nil
 		}
 		if state.StatusCode != api.Running {
@@ -0,0 +1,129 @@
+package incus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	incusclient "github.com/lxc/incus/v6/client"
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// exportBackup names the backup taken of the temporary export instance.
+const exportBackup = "pixels-export"
+
+// ExportSnapshot writes an Incus instance backup of the snapshot in a
+// checkpoint archive. Incus can only back up whole instances, so the
+// snapshot is first copied to a temporary instance, which is backed up
+// without snapshots and then deleted. The backup is downloaded to a
+// temporary file, since the archive records its size up front.
+func (i *Incus) ExportSnapshot(ctx context.Context, name, label string, w io.Writer) error {
+	full := prefixed(name)
+	inst, _, err := i.server.GetInstance(full)
+	if err != nil {
+		return wrapError(fmt.Errorf("getting %s: %w", name, err))
+	}
+	if _, _, err := i.server.GetInstanceSnapshot(full, label); err != nil {
+		return wrapError(fmt.Errorf("getting snapshot %s: %w", label, err))
+	}
+	manifest := sandbox.NewExportManifest(backendName, toInstance(inst, nil), label)
+
+	tmp := fmt.Sprintf("%s-export-%d", full, time.Now().Unix())
+	if err := i.copySnapshot(inst, label, tmp); err != nil {
+		return err
+	}
+	defer func() {
+		if op, err := i.server.DeleteInstance(tmp); err == nil {
+			_ = op.Wait()
+		}
+	}()
+
+	op, err := i.server.CreateInstanceBackup(tmp, api.InstanceBackupsPost{
+		Name:                 exportBackup,
+		ExpiresAt:            time.Now().Add(24 * time.Hour),
+		InstanceOnly:         true,
+		CompressionAlgorithm: "none", // the archive is compressed as a whole
+	})
+	if err != nil {
+		return wrapStorageError(fmt.Errorf("creating backup: %w", err))
+	}
+	if err := op.WaitContext(ctx); err != nil {
+		return wrapStorageError(fmt.Errorf("waiting for backup: %w", err))
+	}
+
+	f, err := os.CreateTemp("", "pixels-export-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	resp, err := i.server.GetInstanceBackupFile(tmp, exportBackup, &incusclient.BackupFileRequest{BackupFile: f})
+	if err != nil {
+		return fmt.Errorf("downloading backup: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return sandbox.WriteExport(w, manifest, f, resp.Size)
+}
+
+// ImportSnapshot restores the archived backup into the configured storage
+// pool as newName, recreates the checkpoint as a snapshot and starts it.
+// Volatile keys from the exporting host are dropped so Incus regenerates
+// them, as CloneFrom does.
+func (i *Incus) ImportSnapshot(ctx context.Context, newName string, r io.Reader) error {
+	newFull := prefixed(newName)
+	return sandbox.ReadExport(r, backendName, func(m *sandbox.ExportManifest, payload io.Reader) error {
+		if _, _, err := i.server.GetInstance(newFull); err == nil {
+			return fmt.Errorf("instance %s: %w", newName, sandbox.ErrAlreadyExists)
+		}
+
+		op, err := i.server.CreateInstanceFromBackup(incusclient.InstanceBackupArgs{
+			BackupFile: payload,
+			PoolName:   i.cfg.pool,
+			Name:       newFull,
+		})
+		if err != nil {
+			return wrapStorageError(fmt.Errorf("importing backup: %w", err))
+		}
+		if err := op.WaitContext(ctx); err != nil {
+			return wrapStorageError(fmt.Errorf("waiting for import: %w", err))
+		}
+
+		inst, etag, err := i.server.GetInstance(newFull)
+		if err != nil {
+			return fmt.Errorf("getting %s: %w", newName, err)
+		}
+		put := inst.Writable()
+		stripVolatile(put.Config)
+		put.Config[configOrigin] = m.Origin()
+		op, err = i.server.UpdateInstance(newFull, put, etag)
+		if err != nil {
+			return fmt.Errorf("updating %s: %w", newName, err)
+		}
+		if err := op.WaitContext(ctx); err != nil {
+			return fmt.Errorf("updating %s: %w", newName, err)
+		}
+
+		// The archive's NIC may name an ACL from the exporting host.
+		if err := i.attachACL(ctx, newFull, ""); err != nil {
+			return err
+		}
+		if i.hostEgress() && m.Egress != "" {
+			if err := i.SetEgressMode(ctx, newName, m.Egress); err != nil {
+				return err
+			}
+		}
+		if err := i.CreateSnapshot(ctx, newName, m.Label); err != nil {
+			return err
+		}
+		if err := i.Start(ctx, newName); err != nil {
+			return fmt.Errorf("starting %s: %w", newName, err)
+		}
+		return nil
+	})
+}
@@ -26,9 +26,9 @@ func (i *Incus) WriteFile(ctx context.Context, name, p string, content []byte, m
 	}
 
 	if uid < 0 || gid < 0 {
-		return i.pushFile(full, p, content, int(mode))
+		return wrapStorageError(i.pushFile(full, p, content, int(mode)))
 	}
-	return i.pushFileOwned(full, p, content, int(mode), int64(uid), int64(gid))
+	return wrapStorageError(i.pushFileOwned(full, p, content, int(mode), int64(uid), int64(gid)))
 }
 
 // ReadFile streams the file (or first maxBytes) into memory via the native
@@ -37,7 +37,7 @@ func (i *Incus) ReadFile(ctx context.Context, name, p string, maxBytes int64) ([
 	full := prefixed(name)
 	rc, _, err := i.server.GetInstanceFile(full, p)
 	if err != nil {
-		return nil, false, fmt.Errorf("read %s: %w", p, err)
+		return nil, false, wrapError(fmt.Errorf("read %s: %w", p, err))
 	}
 	defer rc.Close()
 
@@ -96,7 +96,7 @@ func (i *Incus) ListFiles(ctx context.Context, name, p string, recursive bool) (
 func (i *Incus) DeleteFile(ctx context.Context, name, p string) error {
 	full := prefixed(name)
 	if err := i.server.DeleteInstanceFile(full, p); err != nil {
-		return fmt.Errorf("delete %s: %w", p, err)
+		return wrapError(fmt.Errorf("delete %s: %w", p, err))
 	}
 	return nil
 }
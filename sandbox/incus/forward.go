@@ -0,0 +1,107 @@
+package incus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// forwardDevicePrefix marks the proxy devices pixels manages, so forwards
+// added by hand with `incus config device add` are left alone.
+const forwardDevicePrefix = "pixels-fwd-"
+
+// AddForward adds a proxy device that listens on the Incus host and
+// connects to the port on the container's loopback. The proxy runs inside
+// the container's network namespace, so it works even where the host can't
+// route to the container (macvlan NICs).
+func (i *Incus) AddForward(ctx context.Context, name string, f sandbox.Forward) error {
+	full := prefixed(name)
+	inst, etag, err := i.server.GetInstance(full)
+	if err != nil {
+		return wrapError(fmt.Errorf("getting %s: %w", name, err))
+	}
+	dev := forwardDevicePrefix + f.Name
+	if _, ok := inst.Devices[dev]; ok {
+		return fmt.Errorf("forward %s on %s: %w", f.Name, name, sandbox.ErrAlreadyExists)
+	}
+
+	put := inst.Writable()
+	if put.Devices == nil {
+		put.Devices = map[string]map[string]string{}
+	}
+	put.Devices[dev] = map[string]string{
+		"type":    "proxy",
+		"listen":  "tcp:" + f.Listen,
+		"connect": "tcp:127.0.0.1:" + strconv.Itoa(f.Port),
+		"bind":    "host",
+	}
+	op, err := i.server.UpdateInstance(full, put, etag)
+	if err != nil {
+		return fmt.Errorf("adding forward %s: %w", f.Name, err)
+	}
+	if err := op.WaitContext(ctx); err != nil {
+		return fmt.Errorf("waiting for forward %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// ListForwards returns the pixels-managed proxy devices, sorted by name.
+func (i *Incus) ListForwards(ctx context.Context, name string) ([]sandbox.Forward, error) {
+	inst, _, err := i.server.GetInstance(prefixed(name))
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("getting %s: %w", name, err))
+	}
+	var out []sandbox.Forward
+	for dev, cfg := range inst.Devices {
+		fwd, ok := strings.CutPrefix(dev, forwardDevicePrefix)
+		if !ok || cfg["type"] != "proxy" {
+			continue
+		}
+		out = append(out, sandbox.Forward{
+			Name:   fwd,
+			Listen: strings.TrimPrefix(cfg["listen"], "tcp:"),
+			Port:   proxyPort(cfg["connect"]),
+		})
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out, nil
+}
+
+// RemoveForward deletes a forward's proxy device.
+func (i *Incus) RemoveForward(ctx context.Context, name, forward string) error {
+	full := prefixed(name)
+	inst, etag, err := i.server.GetInstance(full)
+	if err != nil {
+		return wrapError(fmt.Errorf("getting %s: %w", name, err))
+	}
+	dev := forwardDevicePrefix + forward
+	if _, ok := inst.Devices[dev]; !ok {
+		return fmt.Errorf("forward %s/%s: %w", name, forward, sandbox.ErrNotFound)
+	}
+
+	put := inst.Writable()
+	delete(put.Devices, dev)
+	op, err := i.server.UpdateInstance(full, put, etag)
+	if err != nil {
+		return fmt.Errorf("removing forward %s: %w", forward, err)
+	}
+	if err := op.WaitContext(ctx); err != nil {
+		return fmt.Errorf("waiting for forward removal %s: %w", forward, err)
+	}
+	return nil
+}
+
+// proxyPort extracts the port from a proxy address like "tcp:127.0.0.1:80".
+func proxyPort(addr string) int {
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(addr, "tcp:"))
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
@@ -16,8 +16,12 @@ import (
 // Compile-time check that Incus implements sandbox.Sandbox.
 var _ sandbox.Sandbox = (*Incus)(nil)
 
+// backendName is also stamped on exported checkpoints, which only
+// another Incus backend can import.
+const backendName = "incus"
+
 func init() {
-	sandbox.Register("incus", func(cfg map[string]string) (sandbox.Sandbox, error) {
+	sandbox.Register(backendName, func(cfg map[string]string) (sandbox.Sandbox, error) {
 		return New(cfg)
 	})
 }
@@ -37,7 +41,7 @@ func New(cfg map[string]string) (*Incus, error) {
 
 	server, err := connect(c)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	if c.project != "" {
@@ -114,6 +118,8 @@ func (i *Incus) Capabilities() sandbox.Capabilities {
 		Snapshots:     true,
 		CloneFrom:     true,
 		EgressControl: true,
+		PortForward:   true,
+		Mounts:        true,
 	}
 }
 
@@ -0,0 +1,28 @@
+package incus
+
+import (
+	"fmt"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// mountDevicePrefix names the disk devices pixels adds for host mounts.
+const mountDevicePrefix = "pixels-mount-"
+
+// addMountDevices adds a disk device per mount. Devices are shifted so host
+// files appear owned by the matching container IDs rather than nobody,
+// which needs idmapped mount support on the Incus host.
+func addMountDevices(devices map[string]map[string]string, mounts []sandbox.Mount) {
+	for n, m := range mounts {
+		dev := map[string]string{
+			"type":   "disk",
+			"source": m.Source,
+			"path":   m.Target,
+			"shift":  "true",
+		}
+		if m.ReadOnly {
+			dev["readonly"] = "true"
+		}
+		devices[fmt.Sprintf("%s%d", mountDevicePrefix, n)] = dev
+	}
+}
@@ -2,8 +2,9 @@ package incus
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"slices"
 
 	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/sandbox"
@@ -11,17 +12,30 @@ import (
 
 // SetEgressMode sets the egress filtering mode for a container.
 func (i *Incus) SetEgressMode(ctx context.Context, name string, mode sandbox.EgressMode) error {
+	if err := i.requireInstance(name); err != nil {
+		return err
+	}
 	full := prefixed(name)
 
+	if i.hostEgress() {
+		if err := i.setHostEgress(ctx, full, mode); err != nil {
+			return err
+		}
+		return i.recordPolicy(ctx, full, egress.NewPolicy(mode, i.cfg.allow))
+	}
+
 	switch mode {
 	case sandbox.EgressUnrestricted:
 		// Flush nftables.
 		i.execSimple(ctx, full, []string{"nft", "flush", "ruleset"})
+		i.execSimple(ctx, full, []string{"bash", "-c", egress.StopDNSFilterScript()})
+		i.execSimple(ctx, full, []string{"bash", "-c", egress.StopRefreshScript()})
 
 		// Remove egress files.
 		i.execSimple(ctx, full, []string{"rm", "-f",
 			"/etc/pixels-egress-domains",
 			"/etc/pixels-egress-cidrs",
+			egress.LearnFile,
 			"/etc/nftables.conf",
 			"/usr/local/bin/pixels-resolve-egress.sh",
 			"/usr/local/bin/safe-apt",
@@ -34,21 +48,37 @@ func (i *Incus) SetEgressMode(ctx context.Context, name string, mode sandbox.Egr
 		// Remove restricted sudoers if present.
 		i.execSimple(ctx, full, []string{"rm", "-f", "/etc/sudoers.d/pixel.restricted"})
 
-		return nil
+		return i.recordPolicy(ctx, full, egress.NewPolicy(mode, nil))
+
+	case sandbox.EgressLearn:
+		// Without a record, learning starts from an empty list.
+		prev, err := i.readPolicy(full)
+		if err != nil && !errors.Is(err, egress.ErrNoRecord) {
+			return err
+		}
+		if err := i.setLearnMode(ctx, full); err != nil {
+			return err
+		}
+		return i.recordPolicy(ctx, full, egress.LearnPolicy(prev))
 
-	case sandbox.EgressAgent, sandbox.EgressAllowlist:
-		egressName := string(mode)
-		domains := egress.ResolveDomains(egressName, i.cfg.allow)
+	default:
+		if err := egress.ValidateEgress(string(mode)); err != nil {
+			return err
+		}
+		policy := egress.NewPolicy(mode, i.cfg.allow)
+		i.execSimple(ctx, full, []string{"rm", "-f", egress.LearnFile})
+		if !i.cfg.dnsFilter {
+			i.execSimple(ctx, full, []string{"bash", "-c", egress.StopDNSFilterScript()})
+		}
 
 		// Write domain list.
-		if err := i.pushFile(full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(domains)), 0o644); err != nil {
+		if err := i.pushFile(full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(policy.Domains)), 0o644); err != nil {
 			return fmt.Errorf("writing egress domains: %w", err)
 		}
 
 		// Write CIDRs if any.
-		cidrs := egress.PresetCIDRs(egressName)
-		if len(cidrs) > 0 {
-			if err := i.pushFile(full, "/etc/pixels-egress-cidrs", []byte(egress.CIDRsFileContent(cidrs)), 0o644); err != nil {
+		if len(policy.CIDRs) > 0 {
+			if err := i.pushFile(full, "/etc/pixels-egress-cidrs", []byte(egress.CIDRsFileContent(policy.CIDRs)), 0o644); err != nil {
 				return fmt.Errorf("writing egress cidrs: %w", err)
 			}
 		}
@@ -62,6 +92,9 @@ func (i *Incus) SetEgressMode(ctx context.Context, name string, mode sandbox.Egr
 		if err := i.pushFile(full, "/usr/local/bin/pixels-resolve-egress.sh", []byte(egress.ResolveScript()), 0o755); err != nil {
 			return fmt.Errorf("writing resolve script: %w", err)
 		}
+		if err := i.pushDNSFilter(full); err != nil {
+			return err
+		}
 
 		// Write safe-apt wrapper.
 		if err := i.pushFile(full, "/usr/local/bin/safe-apt", []byte(egress.SafeAptScript()), 0o755); err != nil {
@@ -84,17 +117,132 @@ func (i *Incus) SetEgressMode(ctx context.Context, name string, mode sandbox.Egr
 			return fmt.Errorf("resolving egress: exit code %d", rc)
 		}
 
+		return i.recordPolicy(ctx, full, policy)
+
+	}
+}
+
+// setLearnMode switches full to learn mode, keeping its current domain
+// list in the learn file for suggestions to be compared against.
+func (i *Incus) setLearnMode(ctx context.Context, full string) error {
+	if i.execSimple(ctx, full, []string{"test", "-f", egress.LearnFile}) != 0 {
+		current, _ := i.readFile(full, "/etc/pixels-egress-domains")
+		if err := i.pushFile(full, egress.LearnFile, current, 0o644); err != nil {
+			return fmt.Errorf("writing learn file: %w", err)
+		}
+	}
+	i.execSimple(ctx, full, []string{"rm", "-f",
+		"/etc/pixels-egress-domains",
+		"/etc/pixels-egress-cidrs",
+		"/usr/local/bin/safe-apt",
+	})
+
+	if err := i.pushFile(full, "/etc/nftables.conf", []byte(egress.LearnNftablesConf()), 0o644); err != nil {
+		return fmt.Errorf("writing nftables.conf: %w", err)
+	}
+	if err := i.pushFile(full, "/usr/local/bin/pixels-resolve-egress.sh", []byte(egress.LearnScript()), 0o755); err != nil {
+		return fmt.Errorf("writing learn script: %w", err)
+	}
+	// The DNS filter names what the container connects to; without it,
+	// names come from the resolver cache.
+	if bin, err := egress.DNSFilterBinary(); err == nil {
+		if err := i.pushFile(full, egress.DNSFilterPath, bin, 0o755); err != nil {
+			return fmt.Errorf("writing DNS filter: %w", err)
+		}
+		if err := i.pushFile(full, egress.DNSFilterUnitPath, []byte(egress.DNSFilterUnit()), 0o644); err != nil {
+			return fmt.Errorf("writing DNS filter unit: %w", err)
+		}
+	}
+
+	// Nothing is blocked, so sudo need not be restricted.
+	if err := i.pushFile(full, "/etc/sudoers.d/pixel", []byte(egress.SudoersUnrestricted()), 0o440); err != nil {
+		return fmt.Errorf("writing unrestricted sudoers: %w", err)
+	}
+	i.execSimple(ctx, full, []string{"rm", "-f", "/etc/sudoers.d/pixel.restricted"})
+
+	rc := i.execSimple(ctx, full, []string{"bash", "-c", "command -v nft >/dev/null || DEBIAN_FRONTEND=noninteractive apt-get install -y -o Dpkg::Options::=--force-confold nftables >/dev/null 2>&1"})
+	if rc != 0 {
+		return fmt.Errorf("installing nftables: exit code %d", rc)
+	}
+	if rc := i.execSimple(ctx, full, []string{"/usr/local/bin/pixels-resolve-egress.sh"}); rc != 0 {
+		return fmt.Errorf("starting learn mode: exit code %d", rc)
+	}
+	return nil
+}
+
+// pushDNSFilter installs the egress DNS filter in full if it is enabled.
+// The resolve script starts it.
+func (i *Incus) pushDNSFilter(full string) error {
+	if !i.cfg.dnsFilter {
 		return nil
+	}
+	bin, err := egress.DNSFilterBinary()
+	if err != nil {
+		return err
+	}
+	if err := i.pushFile(full, egress.DNSFilterPath, bin, 0o755); err != nil {
+		return fmt.Errorf("writing DNS filter: %w", err)
+	}
+	if err := i.pushFile(full, egress.DNSFilterUnitPath, []byte(egress.DNSFilterUnit()), 0o644); err != nil {
+		return fmt.Errorf("writing DNS filter unit: %w", err)
+	}
+	return nil
+}
 
-	default:
-		return fmt.Errorf("unknown egress mode %q", mode)
+// recordPolicy stores p in the instance config, and its mode alongside so
+// Get and List can report it without probing the container.
+func (i *Incus) recordPolicy(ctx context.Context, full string, p sandbox.Policy) error {
+	inst, etag, err := i.server.GetInstance(full)
+	if err != nil {
+		return fmt.Errorf("getting %s: %w", full, err)
+	}
+	record := string(egress.MarshalPolicy(p))
+	if inst.Config[configEgress] == string(p.Mode) && inst.Config[configPolicy] == record {
+		return nil
+	}
+	put := inst.Writable()
+	put.Config[configEgress] = string(p.Mode)
+	put.Config[configPolicy] = record
+	op, err := i.server.UpdateInstance(full, put, etag)
+	if err != nil {
+		return fmt.Errorf("recording egress policy: %w", err)
 	}
+	return op.WaitContext(ctx)
+}
+
+// readPolicy returns full's recorded egress policy. If there is no record,
+// the error wraps egress.ErrNoRecord: neither the container nor an ACL it
+// may have been given is trusted to stand in for it.
+func (i *Incus) readPolicy(full string) (*sandbox.Policy, error) {
+	inst, _, err := i.server.GetInstance(full)
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("getting %s: %w", full, err))
+	}
+	record := inst.Config[configPolicy]
+	if record == "" {
+		return nil, fmt.Errorf("%s: %w", unprefixed(full), egress.ErrNoRecord)
+	}
+	return egress.ParsePolicy([]byte(record))
 }
 
 // AllowDomain adds a domain to the egress allowlist and re-resolves.
 func (i *Incus) AllowDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
+	if err := i.requireInstance(name); err != nil {
+		return err
+	}
 	full := prefixed(name)
 
+	if i.hostEgress() {
+		return i.editACLDomains(ctx, name, func(p *sandbox.Policy) error {
+			p.Add(domain)
+			return nil
+		})
+	}
+
 	// Ensure egress infrastructure exists.
 	rc := i.execSimple(ctx, full, []string{"test", "-f", "/etc/pixels-egress-domains"})
 	if rc != 0 {
@@ -103,96 +251,101 @@ func (i *Incus) AllowDomain(ctx context.Context, name, domain string) error {
 		}
 	}
 
-	// Read current domains.
-	out, err := i.readFile(full, "/etc/pixels-egress-domains")
+	policy, err := i.readPolicy(full)
 	if err != nil {
-		return fmt.Errorf("reading domains: %w", err)
+		return err
 	}
-
-	domains := parseDomains(string(out))
-
-	// Check for duplicate.
-	for _, d := range domains {
-		if d == domain {
-			return nil
-		}
+	policy = egress.UpgradePolicy(policy)
+	if slices.Contains(policy.Domains, domain) {
+		return nil
 	}
-
-	domains = append(domains, domain)
+	policy.Add(domain)
 
 	// Write updated domains.
-	if err := i.pushFile(full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(domains)), 0o644); err != nil {
+	if err := i.pushFile(full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(policy.Domains)), 0o644); err != nil {
 		return fmt.Errorf("writing domains: %w", err)
 	}
 
 	// Re-resolve.
 	i.execSimple(ctx, full, []string{"/usr/local/bin/pixels-resolve-egress.sh"})
 
-	return nil
+	return i.recordPolicy(ctx, full, *policy)
 }
 
 // DenyDomain removes a domain from the egress allowlist and re-resolves.
 func (i *Incus) DenyDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
+	if err := i.requireInstance(name); err != nil {
+		return err
+	}
 	full := prefixed(name)
 
-	out, err := i.readFile(full, "/etc/pixels-egress-domains")
-	if err != nil {
-		return fmt.Errorf("reading domains: %w", err)
+	if i.hostEgress() {
+		return i.editACLDomains(ctx, name, func(p *sandbox.Policy) error {
+			if !p.Remove(domain) {
+				return fmt.Errorf("domain %q not in allowlist", domain)
+			}
+			return nil
+		})
 	}
 
-	domains := parseDomains(string(out))
-	var filtered []string
-	found := false
-	for _, d := range domains {
-		if d == domain {
-			found = true
-			continue
-		}
-		filtered = append(filtered, d)
+	policy, err := i.readPolicy(full)
+	if err != nil {
+		return err
 	}
-	if !found {
+	policy = egress.UpgradePolicy(policy)
+	if !policy.Remove(domain) {
 		return fmt.Errorf("domain %q not in allowlist", domain)
 	}
 
-	if err := i.pushFile(full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(filtered)), 0o644); err != nil {
+	if err := i.pushFile(full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(policy.Domains)), 0o644); err != nil {
 		return fmt.Errorf("writing domains: %w", err)
 	}
 
 	// Re-resolve.
 	i.execSimple(ctx, full, []string{"/usr/local/bin/pixels-resolve-egress.sh"})
 
-	return nil
+	return i.recordPolicy(ctx, full, *policy)
 }
 
-// GetPolicy returns the current egress policy for an instance.
+// GetPolicy returns the recorded egress policy for an instance.
 func (i *Incus) GetPolicy(ctx context.Context, name string) (*sandbox.Policy, error) {
-	full := prefixed(name)
-
-	rc := i.execSimple(ctx, full, []string{"test", "-f", "/etc/pixels-egress-domains"})
-	if rc != 0 {
-		return &sandbox.Policy{Mode: sandbox.EgressUnrestricted}, nil
+	if err := i.requireInstance(name); err != nil {
+		return nil, err
 	}
+	return i.readPolicy(prefixed(name))
+}
 
-	out, err := i.readFile(full, "/etc/pixels-egress-domains")
+// editACLDomains changes name's policy with edit, rewrites its ACL with
+// the result and re-resolves it, switching to allowlist mode first if name
+// is unrestricted.
+func (i *Incus) editACLDomains(ctx context.Context, name string, edit func(*sandbox.Policy) error) error {
+	full := prefixed(name)
+	_, cidrs, ok, err := i.aclPolicy(full)
 	if err != nil {
-		return nil, fmt.Errorf("reading domains: %w", err)
+		return err
 	}
-
-	domains := parseDomains(string(out))
-	return &sandbox.Policy{
-		Mode:    sandbox.EgressAllowlist,
-		Domains: domains,
-	}, nil
-}
-
-// parseDomains splits newline-delimited domain content into a slice.
-func parseDomains(content string) []string {
-	var domains []string
-	for _, line := range strings.Split(content, "\n") {
-		d := strings.TrimSpace(line)
-		if d != "" {
-			domains = append(domains, d)
+	if !ok {
+		if err := i.SetEgressMode(ctx, name, sandbox.EgressAllowlist); err != nil {
+			return fmt.Errorf("setting up egress ACL: %w", err)
 		}
+		if _, cidrs, _, err = i.aclPolicy(full); err != nil {
+			return err
+		}
+	}
+	policy, err := i.readPolicy(full)
+	if err != nil {
+		return err
+	}
+	policy = egress.UpgradePolicy(policy)
+	if err := edit(policy); err != nil {
+		return err
+	}
+	if err := i.applyACL(ctx, full, policy.Domains, cidrs); err != nil {
+		return err
 	}
-	return domains
+	return i.recordPolicy(ctx, full, *policy)
 }
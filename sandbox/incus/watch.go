@@ -0,0 +1,97 @@
+package incus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// lifecycleActions maps the Incus lifecycle actions pixels reports to event
+// types. A graceful stop is reported as instance-shutdown.
+var lifecycleActions = map[string]sandbox.EventType{
+	api.EventLifecycleInstanceCreated:         sandbox.EventCreated,
+	api.EventLifecycleInstanceStarted:         sandbox.EventStarted,
+	api.EventLifecycleInstanceStopped:         sandbox.EventStopped,
+	api.EventLifecycleInstanceShutdown:        sandbox.EventStopped,
+	api.EventLifecycleInstanceDeleted:         sandbox.EventDeleted,
+	api.EventLifecycleInstanceSnapshotCreated: sandbox.EventSnapshotCreated,
+	api.EventLifecycleInstanceExec:            sandbox.EventExecStarted,
+}
+
+// Watch listens to lifecycle events on the Incus events websocket. The
+// client library runs each handler in its own goroutine, so events that
+// arrive within moments of each other may be delivered out of order.
+func (i *Incus) Watch(ctx context.Context, fn func(sandbox.Event)) error {
+	listener, err := i.server.GetEvents()
+	if err != nil {
+		return fmt.Errorf("listening for events: %w", err)
+	}
+	defer listener.Disconnect()
+
+	events := make(chan sandbox.Event, 64)
+	_, err = listener.AddHandler([]string{api.EventTypeLifecycle}, func(e api.Event) {
+		if ev, ok := lifecycleEvent(e); ok {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("listening for events: %w", err)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- listener.Wait() }()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-closed:
+			if err == nil {
+				err = errors.New("connection closed")
+			}
+			return fmt.Errorf("event stream: %w", err)
+		case ev := <-events:
+			fn(ev)
+		}
+	}
+}
+
+// lifecycleEvent converts an Incus lifecycle event on a pixels instance.
+// Sources look like /1.0/instances/px-name or
+// /1.0/instances/px-name/snapshots/label, with an optional query string.
+func lifecycleEvent(e api.Event) (sandbox.Event, bool) {
+	var lc api.EventLifecycle
+	if err := json.Unmarshal(e.Metadata, &lc); err != nil {
+		return sandbox.Event{}, false
+	}
+	typ, ok := lifecycleActions[lc.Action]
+	if !ok {
+		return sandbox.Event{}, false
+	}
+	u, err := url.Parse(lc.Source)
+	if err != nil {
+		return sandbox.Event{}, false
+	}
+	rest, ok := strings.CutPrefix(u.Path, "/1.0/instances/")
+	if !ok {
+		return sandbox.Event{}, false
+	}
+	full, snapshot, _ := strings.Cut(rest, "/snapshots/")
+	if !strings.HasPrefix(full, containerPrefix) || strings.Contains(full, "/") {
+		return sandbox.Event{}, false
+	}
+	ev := sandbox.Event{Type: typ, Name: unprefixed(full), Time: e.Timestamp}
+	if typ == sandbox.EventSnapshotCreated {
+		ev.Snapshot = snapshot
+	}
+	return ev, true
+}
@@ -0,0 +1,43 @@
+package incus
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lxc/incus/v6/shared/api"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestLifecycleEvent(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := func(action, source string) api.Event {
+		md, _ := json.Marshal(api.EventLifecycle{Action: action, Source: source})
+		return api.Event{Type: api.EventTypeLifecycle, Timestamp: now, Metadata: md}
+	}
+
+	tests := []struct {
+		name string
+		in   api.Event
+		want sandbox.Event
+		ok   bool
+	}{
+		{"started", event("instance-started", "/1.0/instances/px-a"), sandbox.Event{Type: sandbox.EventStarted, Name: "a", Time: now}, true},
+		{"shutdown", event("instance-shutdown", "/1.0/instances/px-a?project=dev"), sandbox.Event{Type: sandbox.EventStopped, Name: "a", Time: now}, true},
+		{"snapshot", event("instance-snapshot-created", "/1.0/instances/px-a/snapshots/ready"), sandbox.Event{Type: sandbox.EventSnapshotCreated, Name: "a", Snapshot: "ready", Time: now}, true},
+		{"exec", event("instance-exec", "/1.0/instances/px-a"), sandbox.Event{Type: sandbox.EventExecStarted, Name: "a", Time: now}, true},
+		{"not a pixel", event("instance-started", "/1.0/instances/web"), sandbox.Event{}, false},
+		{"unreported action", event("instance-file-pushed", "/1.0/instances/px-a"), sandbox.Event{}, false},
+		{"snapshot deleted", event("instance-snapshot-deleted", "/1.0/instances/px-a/snapshots/ready"), sandbox.Event{}, false},
+		{"not an instance", event("image-created", "/1.0/images/abc"), sandbox.Event{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lifecycleEvent(tt.in)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("lifecycleEvent = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
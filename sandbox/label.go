@@ -0,0 +1,38 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateLabelKey checks a label key: 1-63 lowercase letters, digits,
+// '.', '_' or '-', starting and ending with a letter or digit. Keys are
+// restricted so every backend can store them verbatim.
+func ValidateLabelKey(key string) error {
+	if key == "" || len(key) > 63 {
+		return fmt.Errorf("invalid label key %q: must be 1-63 characters", key)
+	}
+	for i, r := range key {
+		alnum := r >= 'a' && r <= 'z' || r >= '0' && r <= '9'
+		edge := i == 0 || i == len(key)-1
+		if !alnum && (edge || !strings.ContainsRune("._-", r)) {
+			return fmt.Errorf("invalid label key %q: use lowercase letters, digits, '.', '_' and '-'", key)
+		}
+	}
+	return nil
+}
+
+// ParseLabel parses a "key=value" label. The value may be empty.
+func ParseLabel(s string) (key, value string, err error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid label %q: want key=value", s)
+	}
+	if err := ValidateLabelKey(key); err != nil {
+		return "", "", err
+	}
+	if strings.ContainsAny(value, "\n\x00") {
+		return "", "", fmt.Errorf("invalid label %q: value contains a newline or NUL", s)
+	}
+	return key, value, nil
+}
@@ -0,0 +1,23 @@
+package sandbox
+
+import "testing"
+
+func TestParseLabel(t *testing.T) {
+	tests := map[string][2]string{
+		"team=infra":          {"team", "infra"},
+		"task.id=gh-123":      {"task.id", "gh-123"},
+		"empty=":              {"empty", ""},
+		"url=https://x.y/?a=": {"url", "https://x.y/?a="},
+	}
+	for s, want := range tests {
+		k, v, err := ParseLabel(s)
+		if err != nil || k != want[0] || v != want[1] {
+			t.Errorf("ParseLabel(%q) = %q, %q, %v, want %q, %q", s, k, v, err, want[0], want[1])
+		}
+	}
+	for _, bad := range []string{"team", "=x", "Team=x", "-a=x", "a.=x", "a b=x", "a=line\nbreak"} {
+		if _, _, err := ParseLabel(bad); err == nil {
+			t.Errorf("ParseLabel(%q): want error", bad)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// WriteArchive extracts a tar stream into dir. Directories and regular
+// files are kept with their modes and ownership; other entry types
+// (symlinks, devices) have no node to live in and are skipped.
+func (m *Memory) WriteArchive(ctx context.Context, name, dir string, r io.Reader) error {
+	dir, err := cleanPath(dir)
+	if err != nil {
+		return err
+	}
+	// Decode before taking the lock; the whole tree is held in memory
+	// anyway.
+	type entry struct {
+		path string
+		node *node
+	}
+	var entries []entry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+		rel := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return fmt.Errorf("archive entry %q escapes %s", hdr.Name, dir)
+		}
+		n := &node{Mode: os.FileMode(hdr.Mode).Perm(), UID: hdr.Uid, GID: hdr.Gid}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			n.Mode |= os.ModeDir
+		case tar.TypeReg:
+			if n.Data, err = io.ReadAll(tr); err != nil {
+				return fmt.Errorf("reading archive: %w", err)
+			}
+		default:
+			continue
+		}
+		entries = append(entries, entry{path.Join(dir, rel), n})
+	}
+
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		sizes := make(map[string]int64, len(entries))
+		for _, e := range entries {
+			sizes[e.path] = int64(len(e.node.Data))
+		}
+		if err := inst.fits(sizes); err != nil {
+			return err
+		}
+		if err := inst.FS.mkdirAll(dir); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := inst.FS.mkdirAll(path.Dir(e.path)); err != nil {
+				return err
+			}
+			if old, ok := inst.FS[e.path]; ok && old.Mode.IsDir() != e.node.Mode.IsDir() {
+				return fmt.Errorf("extract %s: file exists", e.path)
+			}
+			inst.FS[e.path] = e.node
+		}
+		return nil
+	})
+}
+
+// ReadArchive writes path and everything below it as a tar stream rooted at
+// path's base name.
+func (m *Memory) ReadArchive(ctx context.Context, name, p string, w io.Writer) error {
+	p, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		name string
+		node node
+	}
+	var entries []entry
+	err = m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		n, ok := inst.FS[p]
+		if !ok {
+			return fmt.Errorf("%s: %w", p, sandbox.ErrNotFound)
+		}
+		base := path.Base(p)
+		entries = append(entries, entry{base, *n})
+		if !n.Mode.IsDir() {
+			return nil
+		}
+		prefix := strings.TrimSuffix(p, "/") + "/"
+		for q, n := range inst.FS {
+			if strings.HasPrefix(q, prefix) {
+				entries = append(entries, entry{path.Join(base, q[len(prefix):]), *n})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Parents sort before their children, as tar expects.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: tar.TypeReg,
+			Mode:     int64(e.node.Mode.Perm()),
+			Size:     int64(len(e.node.Data)),
+			Uid:      e.node.UID,
+			Gid:      e.node.GID,
+		}
+		if e.node.Mode.IsDir() {
+			hdr.Name += "/"
+			hdr.Typeflag = tar.TypeDir
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.node.Data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,344 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Create creates a running instance with a fresh filesystem. Addresses are
+// allocated sequentially from 192.0.2.0/24 (TEST-NET-1), so they are never
+// routable. Unless opts.Bare is set or provisioning is disabled, the
+// configured egress policy is applied.
+func (m *Memory) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox.Instance, error) {
+	if len(opts.Mounts) > 0 {
+		return nil, fmt.Errorf("host mounts: %w", errors.ErrUnsupported)
+	}
+	var out *sandbox.Instance
+	err := m.update(func(s *state) error {
+		if _, ok := s.Instances[opts.Name]; ok {
+			return fmt.Errorf("instance %s: %w", opts.Name, sandbox.ErrAlreadyExists)
+		}
+
+		inst := &instance{
+			Name:      opts.Name,
+			Status:    sandbox.StatusRunning,
+			Address:   s.allocAddress(),
+			Image:     opts.Image,
+			CPU:       opts.CPU,
+			Memory:    opts.Memory,
+			CreatedAt: s.now(),
+			FS:        newFileSystem(m.cfg.sshUser),
+			Policy:    egress.NewPolicy(sandbox.EgressUnrestricted, nil),
+		}
+		if inst.Image == "" {
+			inst.Image = m.cfg.image
+		}
+		if inst.CPU == "" {
+			inst.CPU = m.cfg.cpu
+		}
+		if inst.Memory == 0 {
+			inst.Memory = m.cfg.memory * 1024 * 1024 // MiB → bytes
+		}
+		if len(opts.Labels) > 0 {
+			inst.Labels = maps.Clone(opts.Labels)
+		}
+		if !opts.Bare && m.cfg.provision {
+			inst.Policy = egress.NewPolicy(sandbox.EgressMode(m.cfg.egress), m.cfg.allow)
+		}
+
+		s.Instances[inst.Name] = inst
+		s.emit(sandbox.EventCreated, inst.Name, "")
+		s.emit(sandbox.EventStarted, inst.Name, "")
+		out = inst.toInstance()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Get returns a single instance by name.
+func (m *Memory) Get(ctx context.Context, name string) (*sandbox.Instance, error) {
+	var out *sandbox.Instance
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		out = inst.toInstance()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// List returns all instances sorted by name.
+func (m *Memory) List(ctx context.Context) ([]sandbox.Instance, error) {
+	var out []sandbox.Instance
+	err := m.view(func(s *state) error {
+		for _, inst := range s.Instances {
+			out = append(out, *inst.toInstance())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Start marks an instance as running. Starting a running instance is a no-op.
+func (m *Memory) Start(ctx context.Context, name string) error {
+	return m.setStatus(name, sandbox.StatusRunning)
+}
+
+// Stop marks an instance as stopped and kills its processes. Stopping a
+// stopped instance is a no-op.
+func (m *Memory) Stop(ctx context.Context, name string) error {
+	if err := m.setStatus(name, sandbox.StatusStopped); err != nil {
+		return err
+	}
+	m.killAll(name)
+	return nil
+}
+
+func (m *Memory) setStatus(name string, status sandbox.Status) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		if inst.Status == status {
+			return nil
+		}
+		inst.Status = status
+		if status.IsRunning() {
+			s.emit(sandbox.EventStarted, name, "")
+		} else {
+			s.emit(sandbox.EventStopped, name, "")
+		}
+		return nil
+	})
+}
+
+// Delete removes an instance and all of its snapshots, killing its
+// processes.
+func (m *Memory) Delete(ctx context.Context, name string) error {
+	err := m.update(func(s *state) error {
+		if _, err := s.instance(name); err != nil {
+			return err
+		}
+		delete(s.Instances, name)
+		s.emit(sandbox.EventDeleted, name, "")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.killAll(name)
+	return nil
+}
+
+// UpdateLimits records new limits. A disk size below what the filesystem
+// already holds is refused, as a real shrink would be.
+func (m *Memory) UpdateLimits(ctx context.Context, name string, l sandbox.Limits) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		if l.Disk > 0 && l.Disk < inst.FS.size() {
+			return fmt.Errorf("disk size %d is below the %d bytes in use", l.Disk, inst.FS.size())
+		}
+		if l.CPU != "" {
+			inst.CPU = l.CPU
+		}
+		if l.Memory > 0 {
+			inst.Memory = l.Memory
+		}
+		if l.Disk > 0 {
+			inst.Disk = l.Disk
+		}
+		return nil
+	})
+}
+
+// Stats reports the filesystem's size as disk usage. Nothing runs in the
+// memory backend, so CPU, memory and network usage are always zero.
+func (m *Memory) Stats(ctx context.Context, name string) (*sandbox.Stats, error) {
+	var out *sandbox.Stats
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		out = &sandbox.Stats{Disk: inst.FS.size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateSnapshot captures a deep copy of the instance's filesystem.
+func (m *Memory) CreateSnapshot(ctx context.Context, name, label string) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		if inst.snapshot(label) != nil {
+			return fmt.Errorf("snapshot %s/%s: %w", name, label, sandbox.ErrAlreadyExists)
+		}
+		inst.Snapshots = append(inst.Snapshots, &snapshot{
+			Label:     label,
+			CreatedAt: s.now(),
+			FS:        inst.FS.clone(),
+		})
+		s.emit(sandbox.EventSnapshotCreated, name, label)
+		return nil
+	})
+}
+
+// ListSnapshots returns the instance's snapshots, oldest first.
+func (m *Memory) ListSnapshots(ctx context.Context, name string) ([]sandbox.Snapshot, error) {
+	var out []sandbox.Snapshot
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		for _, snap := range inst.Snapshots {
+			out = append(out, sandbox.Snapshot{
+				Label:     snap.Label,
+				Size:      snap.FS.size(),
+				CreatedAt: snap.CreatedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// DeleteSnapshot removes a snapshot.
+func (m *Memory) DeleteSnapshot(ctx context.Context, name, label string) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		for i, snap := range inst.Snapshots {
+			if snap.Label == label {
+				inst.Snapshots = append(inst.Snapshots[:i], inst.Snapshots[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("snapshot %s/%s: %w", name, label, sandbox.ErrNotFound)
+	})
+}
+
+// RestoreSnapshot replaces the instance's filesystem with a copy of the
+// snapshot. Later snapshots are kept. The instance is left running.
+func (m *Memory) RestoreSnapshot(ctx context.Context, name, label string) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		snap := inst.snapshot(label)
+		if snap == nil {
+			return fmt.Errorf("snapshot %s/%s: %w", name, label, sandbox.ErrNotFound)
+		}
+		inst.FS = snap.FS.clone()
+		if !inst.Status.IsRunning() {
+			inst.Status = sandbox.StatusRunning
+			s.emit(sandbox.EventStarted, name, "")
+		}
+		return nil
+	})
+}
+
+// CloneFrom creates newName from a copy of source's snapshot. The clone gets
+// its own address and starts with no snapshots of its own.
+func (m *Memory) CloneFrom(ctx context.Context, source, label, newName string) error {
+	return m.update(func(s *state) error {
+		src, err := s.instance(source)
+		if err != nil {
+			return err
+		}
+		snap := src.snapshot(label)
+		if snap == nil {
+			return fmt.Errorf("snapshot %s/%s: %w", source, label, sandbox.ErrNotFound)
+		}
+		if _, ok := s.Instances[newName]; ok {
+			return fmt.Errorf("instance %s: %w", newName, sandbox.ErrAlreadyExists)
+		}
+		s.Instances[newName] = &instance{
+			Name:      newName,
+			Status:    sandbox.StatusRunning,
+			Address:   s.allocAddress(),
+			Image:     src.Image,
+			CPU:       src.CPU,
+			Memory:    src.Memory,
+			Origin:    source + ":" + label,
+			Labels:    maps.Clone(src.Labels),
+			CreatedAt: s.now(),
+			FS:        snap.FS.clone(),
+			Policy:    clonePolicy(src.Policy),
+		}
+		s.emit(sandbox.EventCreated, newName, "")
+		s.emit(sandbox.EventStarted, newName, "")
+		return nil
+	})
+}
+
+// snapshot returns the snapshot with the given label, or nil.
+func (i *instance) snapshot(label string) *snapshot {
+	for _, snap := range i.Snapshots {
+		if snap.Label == label {
+			return snap
+		}
+	}
+	return nil
+}
+
+// toInstance converts to the backend-agnostic representation. Stopped
+// instances report no addresses, like a real container.
+func (i *instance) toInstance() *sandbox.Instance {
+	out := &sandbox.Instance{
+		Name:      i.Name,
+		Status:    i.Status,
+		CreatedAt: i.CreatedAt,
+		Image:     i.Image,
+		Origin:    i.Origin,
+		CPU:       i.CPU,
+		Memory:    i.Memory,
+		Egress:    i.Policy.Mode,
+		Labels:    maps.Clone(i.Labels),
+	}
+	if i.Status.IsRunning() {
+		out.Addresses = []string{i.Address}
+	}
+	return out
+}
+
+// allocAddress hands out the next address in 192.0.2.0/24.
+func (s *state) allocAddress() string {
+	s.NextAddr++
+	return fmt.Sprintf("192.0.2.%d", (s.NextAddr-1)%254+1)
+}
@@ -0,0 +1,626 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/user"
+)
+
+// builtins is the default command table. Every entry can be replaced with
+// [Memory.Handle].
+var builtins = map[string]Handler{
+	"true":    func(context.Context, *Cmd) int { return 0 },
+	":":       func(context.Context, *Cmd) int { return 0 },
+	"false":   func(context.Context, *Cmd) int { return 1 },
+	"echo":    builtinEcho,
+	"printf":  builtinPrintf,
+	"cat":     builtinCat,
+	"env":     builtinEnv,
+	"find":    builtinFind,
+	"id":      builtinID,
+	"whoami":  builtinWhoami,
+	"pwd":     builtinPwd,
+	"sh":      builtinShell,
+	"bash":    builtinShell,
+	"test":    builtinTest,
+	"[":       builtinTest,
+	"mkdir":   builtinMkdir,
+	"rm":      builtinRm,
+	"stat":    builtinStat,
+	"sleep":   builtinSleep,
+	"command": builtinCommand,
+	"kill":    builtinKill,
+}
+
+func builtinEcho(_ context.Context, c *Cmd) int {
+	args := c.Args[1:]
+	newline := true
+	if len(args) > 0 && args[0] == "-n" {
+		newline = false
+		args = args[1:]
+	}
+	fmt.Fprint(c.Stdout, strings.Join(args, " "))
+	if newline {
+		fmt.Fprintln(c.Stdout)
+	}
+	return 0
+}
+
+// builtinPrintf supports %s, %d, %% and the \n / \t escapes, reusing the
+// format until all arguments are consumed.
+func builtinPrintf(_ context.Context, c *Cmd) int {
+	if len(c.Args) < 2 {
+		fmt.Fprintln(c.Stderr, "printf: usage: printf format [arguments]")
+		return 2
+	}
+	format := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\\`, `\`).Replace(c.Args[1])
+	args := c.Args[2:]
+	for {
+		var b strings.Builder
+		used := 0
+		for i := 0; i < len(format); i++ {
+			if format[i] != '%' || i+1 == len(format) {
+				b.WriteByte(format[i])
+				continue
+			}
+			i++
+			switch format[i] {
+			case '%':
+				b.WriteByte('%')
+			case 's', 'd':
+				if used < len(args) {
+					b.WriteString(args[used])
+				}
+				used++
+			default:
+				b.WriteByte('%')
+				b.WriteByte(format[i])
+			}
+		}
+		fmt.Fprint(c.Stdout, b.String())
+		if used == 0 || used >= len(args) {
+			return 0
+		}
+		args = args[used:]
+	}
+}
+
+func builtinCat(ctx context.Context, c *Cmd) int {
+	var files []string
+	for _, a := range c.Args[1:] {
+		if a != "--" {
+			files = append(files, a)
+		}
+	}
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	rc := 0
+	for _, f := range files {
+		if f == "-" {
+			io.Copy(c.Stdout, c.Stdin)
+			continue
+		}
+		b, err := c.ReadFile(ctx, f)
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "cat: %s: No such file or directory\n", f)
+			rc = 1
+			continue
+		}
+		c.Stdout.Write(b)
+	}
+	return rc
+}
+
+// builtinEnv implements `env [-C dir] [-u name] [NAME=value...] [--] [cmd...]`,
+// the wrapper the MCP exec tool puts around every command.
+func builtinEnv(ctx context.Context, c *Cmd) int {
+	n := c.sub(nil)
+	args := c.Args[1:]
+	for len(args) > 0 {
+		a := args[0]
+		switch {
+		case a == "--":
+			args = args[1:]
+			goto run
+		case a == "-C" && len(args) > 1:
+			n.Dir = n.abs(args[1])
+			args = args[2:]
+		case a == "-u" && len(args) > 1:
+			delete(n.Env, args[1])
+			args = args[2:]
+		case isAssignment(a):
+			k, v, _ := strings.Cut(a, "=")
+			n.Env[k] = v
+			args = args[1:]
+		default:
+			goto run
+		}
+	}
+run:
+	if len(args) == 0 {
+		keys := make([]string, 0, len(n.Env))
+		for k := range n.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(c.Stdout, "%s=%s\n", k, n.Env[k])
+		}
+		return 0
+	}
+	n.Args = args
+	return c.Sandbox.dispatch(ctx, n)
+}
+
+func builtinID(_ context.Context, c *Cmd) int {
+	uid, name := user.UID, c.Sandbox.cfg.sshUser
+	if c.Root {
+		uid, name = 0, "root"
+	}
+	switch strings.Join(c.Args[1:], " ") {
+	case "-u", "-g":
+		fmt.Fprintln(c.Stdout, uid)
+	case "-un", "-gn", "-u -n", "-g -n":
+		fmt.Fprintln(c.Stdout, name)
+	default:
+		fmt.Fprintf(c.Stdout, "uid=%d(%s) gid=%d(%s) groups=%d(%s)\n", uid, name, uid, name, uid, name)
+	}
+	return 0
+}
+
+func builtinWhoami(_ context.Context, c *Cmd) int {
+	if c.Root {
+		fmt.Fprintln(c.Stdout, "root")
+	} else {
+		fmt.Fprintln(c.Stdout, c.Sandbox.cfg.sshUser)
+	}
+	return 0
+}
+
+func builtinPwd(_ context.Context, c *Cmd) int {
+	fmt.Fprintln(c.Stdout, c.Dir)
+	return 0
+}
+
+// builtinShell implements sh and bash. `-c script` is interpreted by the
+// mini shell. A script file is not interpreted: a handler registered for
+// its path runs if there is one, otherwise the file only has to exist. With
+// neither, stdin is executed line by line (used by Console).
+func builtinShell(ctx context.Context, c *Cmd) int {
+	args := c.Args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flags := args[0]
+		args = args[1:]
+		if strings.Contains(flags, "c") {
+			if len(args) == 0 {
+				fmt.Fprintf(c.Stderr, "%s: -c: option requires an argument\n", c.Args[0])
+				return 2
+			}
+			return runScript(ctx, c, args[0])
+		}
+	}
+
+	if len(args) > 0 {
+		script := c.abs(args[0])
+		if h, ok := c.Sandbox.exactHandler(script); ok {
+			n := c.sub(args)
+			n.Args[0] = script
+			return h(ctx, n)
+		}
+		if _, err := c.ReadFile(ctx, script); err != nil {
+			fmt.Fprintf(c.Stderr, "%s: %s: No such file or directory\n", c.Args[0], args[0])
+			return 127
+		}
+		return 0
+	}
+
+	sh := newShell(c)
+	scanner := bufio.NewScanner(c.Stdin)
+	for scanner.Scan() {
+		sh.status = sh.run(ctx, scanner.Text())
+		if sh.exited {
+			break
+		}
+	}
+	return sh.status
+}
+
+// builtinTest implements the file and string tests scripts use for guards.
+func builtinTest(ctx context.Context, c *Cmd) int {
+	args := c.Args[1:]
+	if c.Args[0] == "[" {
+		if len(args) == 0 || args[len(args)-1] != "]" {
+			fmt.Fprintln(c.Stderr, "[: missing `]'")
+			return 2
+		}
+		args = args[:len(args)-1]
+	}
+	negate := false
+	if len(args) > 0 && args[0] == "!" {
+		negate = true
+		args = args[1:]
+	}
+	ok, err := evalTest(c, args)
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "test: %v\n", err)
+		return 2
+	}
+	if ok != negate {
+		return 0
+	}
+	return 1
+}
+
+func evalTest(c *Cmd, args []string) (bool, error) {
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return args[0] != "", nil
+	case 2:
+		switch args[0] {
+		case "-n":
+			return args[1] != "", nil
+		case "-z":
+			return args[1] == "", nil
+		case "-e", "-f", "-d", "-s", "-x":
+			n, ok := c.Sandbox.stat(c.Name, c.abs(args[1]))
+			if !ok {
+				return false, nil
+			}
+			switch args[0] {
+			case "-f":
+				return !n.Mode.IsDir(), nil
+			case "-d":
+				return n.Mode.IsDir(), nil
+			case "-s":
+				return len(n.Data) > 0, nil
+			case "-x":
+				return n.Mode&0o111 != 0, nil
+			}
+			return true, nil
+		}
+	case 3:
+		switch args[1] {
+		case "=", "==":
+			return args[0] == args[2], nil
+		case "!=":
+			return args[0] != args[2], nil
+		case "-eq", "-ne", "-lt", "-le", "-gt", "-ge":
+			a, err1 := strconv.Atoi(args[0])
+			b, err2 := strconv.Atoi(args[2])
+			if err1 != nil || err2 != nil {
+				return false, fmt.Errorf("integer expression expected")
+			}
+			switch args[1] {
+			case "-eq":
+				return a == b, nil
+			case "-ne":
+				return a != b, nil
+			case "-lt":
+				return a < b, nil
+			case "-le":
+				return a <= b, nil
+			case "-gt":
+				return a > b, nil
+			default:
+				return a >= b, nil
+			}
+		}
+	}
+	return false, fmt.Errorf("unsupported expression %q", strings.Join(args, " "))
+}
+
+func builtinMkdir(_ context.Context, c *Cmd) int {
+	parents := false
+	var dirs []string
+	for _, a := range c.Args[1:] {
+		switch a {
+		case "-p":
+			parents = true
+		case "--":
+		default:
+			dirs = append(dirs, a)
+		}
+	}
+	rc := 0
+	for _, d := range dirs {
+		if err := c.Sandbox.mkdir(c, c.abs(d), parents); err != nil {
+			fmt.Fprintf(c.Stderr, "mkdir: %v\n", err)
+			rc = 1
+		}
+	}
+	return rc
+}
+
+func builtinRm(_ context.Context, c *Cmd) int {
+	force, recursive := false, false
+	var targets []string
+	for _, a := range c.Args[1:] {
+		if strings.HasPrefix(a, "-") && a != "-" && a != "--" {
+			force = force || strings.Contains(a, "f")
+			recursive = recursive || strings.ContainsAny(a, "rR")
+			continue
+		}
+		if a != "--" {
+			targets = append(targets, a)
+		}
+	}
+	rc := 0
+	for _, t := range targets {
+		if err := c.Sandbox.remove(c.Name, c.abs(t), recursive); err != nil {
+			if force && errors.Is(err, sandbox.ErrNotFound) {
+				continue
+			}
+			fmt.Fprintf(c.Stderr, "rm: %v\n", err)
+			rc = 1
+		}
+	}
+	return rc
+}
+
+// builtinFind implements `find dir [-mindepth N] [-maxdepth N] [-type f|d]
+// [-printf FORMAT]` with the %p, %s, %m and %y directives, which is how the
+// exec-based backends list files.
+func builtinFind(ctx context.Context, c *Cmd) int {
+	var (
+		dirs     []string
+		kind     string
+		format   = "%p\n"
+		minDepth = 0
+		maxDepth = -1
+	)
+	args := c.Args[1:]
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") {
+			dirs = append(dirs, a)
+			continue
+		}
+		if i+1 >= len(args) {
+			fmt.Fprintf(c.Stderr, "find: missing argument to `%s'\n", a)
+			return 1
+		}
+		i++
+		switch a {
+		case "-mindepth", "-maxdepth":
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				fmt.Fprintf(c.Stderr, "find: invalid argument `%s' to `%s'\n", args[i], a)
+				return 1
+			}
+			if a == "-mindepth" {
+				minDepth = n
+			} else {
+				maxDepth = n
+			}
+		case "-type":
+			kind = args[i]
+		case "-printf":
+			format = args[i]
+		default:
+			fmt.Fprintf(c.Stderr, "find: unknown predicate `%s'\n", a)
+			return 1
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	rc := 0
+	for _, dir := range dirs {
+		root := c.abs(dir)
+		n, ok := c.Sandbox.stat(c.Name, root)
+		if !ok {
+			fmt.Fprintf(c.Stderr, "find: '%s': No such file or directory\n", dir)
+			rc = 1
+			continue
+		}
+		entries := []sandbox.FileEntry{{Path: root, Size: int64(len(n.Data)), Mode: n.Mode.Perm(), IsDir: n.Mode.IsDir()}}
+		if n.Mode.IsDir() && maxDepth != 0 {
+			children, err := c.Sandbox.ListFiles(ctx, c.Name, root, maxDepth != 1)
+			if err != nil {
+				fmt.Fprintf(c.Stderr, "find: %v\n", err)
+				rc = 1
+				continue
+			}
+			entries = append(entries, children...)
+		}
+		base := strings.Count(strings.TrimSuffix(root, "/"), "/")
+		for _, e := range entries {
+			depth := 0
+			if e.Path != root {
+				depth = strings.Count(e.Path, "/") - base
+			}
+			if depth < minDepth || (maxDepth >= 0 && depth > maxDepth) {
+				continue
+			}
+			typ := "f"
+			if e.IsDir {
+				typ = "d"
+			}
+			if kind != "" && kind != typ {
+				continue
+			}
+			fmt.Fprint(c.Stdout, strings.NewReplacer(
+				"%p", e.Path,
+				"%s", strconv.FormatInt(e.Size, 10),
+				"%m", strconv.FormatUint(uint64(e.Mode.Perm()), 8),
+				"%y", typ,
+				"%%", "%",
+				`\n`, "\n",
+				`\t`, "\t",
+			).Replace(format))
+		}
+	}
+	return rc
+}
+
+// builtinStat implements `stat -c FORMAT [--] file...` with the %s, %u, %g,
+// %a and %n directives — enough for size and ownership checks.
+func builtinStat(_ context.Context, c *Cmd) int {
+	var format string
+	var files []string
+	args := c.Args[1:]
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "-c" && i+1 < len(args):
+			i++
+			format = args[i]
+		case a == "--":
+			files = append(files, args[i+1:]...)
+			i = len(args)
+		default:
+			files = append(files, a)
+		}
+	}
+	if format == "" || len(files) == 0 {
+		fmt.Fprintln(c.Stderr, "stat: usage: stat -c FORMAT file...")
+		return 2
+	}
+	rc := 0
+	for _, f := range files {
+		n, ok := c.Sandbox.stat(c.Name, c.abs(f))
+		if !ok {
+			fmt.Fprintf(c.Stderr, "stat: cannot statx '%s': No such file or directory\n", f)
+			rc = 1
+			continue
+		}
+		r := strings.NewReplacer(
+			"%s", strconv.Itoa(len(n.Data)),
+			"%u", strconv.Itoa(n.UID),
+			"%g", strconv.Itoa(n.GID),
+			"%a", strconv.FormatUint(uint64(n.Mode.Perm()), 8),
+			"%n", f,
+			"%%", "%",
+		)
+		fmt.Fprintln(c.Stdout, r.Replace(format))
+	}
+	return rc
+}
+
+func builtinSleep(ctx context.Context, c *Cmd) int {
+	if len(c.Args) < 2 {
+		fmt.Fprintln(c.Stderr, "sleep: missing operand")
+		return 1
+	}
+	secs, err := strconv.ParseFloat(strings.TrimSuffix(c.Args[1], "s"), 64)
+	if err != nil {
+		fmt.Fprintf(c.Stderr, "sleep: invalid time interval %q\n", c.Args[1])
+		return 1
+	}
+	select {
+	case <-time.After(time.Duration(secs * float64(time.Second))):
+		return 0
+	case <-ctx.Done():
+		return 130
+	}
+}
+
+// builtinCommand implements `command -v name` (exit 0 if the command table
+// has an entry) and `command name args...`.
+func builtinCommand(ctx context.Context, c *Cmd) int {
+	args := c.Args[1:]
+	if len(args) >= 2 && args[0] == "-v" {
+		if _, ok := c.Sandbox.handler(args[1]); ok {
+			fmt.Fprintln(c.Stdout, args[1])
+			return 0
+		}
+		return 1
+	}
+	return c.Exec(ctx, args...)
+}
+
+// stat returns the node at p, if any.
+func (m *Memory) stat(name, p string) (node, bool) {
+	var (
+		out node
+		ok  bool
+	)
+	_ = m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		if n, found := inst.FS[p]; found {
+			out, ok = *n, true
+		}
+		return nil
+	})
+	return out, ok
+}
+
+// mkdir creates a directory owned by the exec user (or root).
+func (m *Memory) mkdir(c *Cmd, p string, parents bool) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(c.Name)
+		if err != nil {
+			return err
+		}
+		if n, ok := inst.FS[p]; ok {
+			if parents && n.Mode.IsDir() {
+				return nil
+			}
+			return fmt.Errorf("cannot create directory %s: File exists", p)
+		}
+		parent := p[:strings.LastIndex(p, "/")]
+		if parent == "" {
+			parent = "/"
+		}
+		if parents {
+			if err := inst.FS.mkdirAll(parent); err != nil {
+				return err
+			}
+		} else if n, ok := inst.FS[parent]; !ok || !n.Mode.IsDir() {
+			return fmt.Errorf("cannot create directory %s: No such file or directory", p)
+		}
+		n := &node{Mode: os.ModeDir | 0o755}
+		if !c.Root {
+			n.UID, n.GID = user.UID, user.GID
+		}
+		inst.FS[p] = n
+		return nil
+	})
+}
+
+// remove deletes a file, or with recursive a whole directory tree.
+func (m *Memory) remove(name, p string, recursive bool) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		n, ok := inst.FS[p]
+		if !ok {
+			return fmt.Errorf("cannot remove %s: %w", p, sandbox.ErrNotFound)
+		}
+		if !n.Mode.IsDir() {
+			delete(inst.FS, p)
+			return nil
+		}
+		if !recursive {
+			return fmt.Errorf("cannot remove %s: Is a directory", p)
+		}
+		if p == "/" {
+			return fmt.Errorf("refusing to remove /")
+		}
+		prefix := p + "/"
+		for q := range inst.FS {
+			if q == p || strings.HasPrefix(q, prefix) {
+				delete(inst.FS, q)
+			}
+		}
+		return nil
+	})
+}
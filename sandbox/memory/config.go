@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/deevus/pixels/internal/egress"
+)
+
+// memoryCfg holds parsed backend configuration.
+type memoryCfg struct {
+	stateFile string
+
+	image  string
+	cpu    string
+	memory int64 // MiB
+
+	sshUser string
+
+	provision bool
+	egress    string
+	allow     []string
+}
+
+// parseCfg extracts a memoryCfg from a flat key-value map. Keys that only
+// make sense for real backends (socket, host, pool, ...) are ignored.
+func parseCfg(m map[string]string) (*memoryCfg, error) {
+	c := &memoryCfg{
+		image:     "ubuntu/24.04",
+		cpu:       "2",
+		memory:    2048,
+		sshUser:   "pixel",
+		provision: true,
+		egress:    "unrestricted",
+	}
+
+	if v := m["state_file"]; v != "" {
+		c.stateFile = v
+	}
+	if v := m["image"]; v != "" {
+		c.image = v
+	}
+	if v := m["cpu"]; v != "" {
+		c.cpu = v
+	}
+	if v := m["memory"]; v != "" {
+		mem, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory %q: %w", v, err)
+		}
+		c.memory = mem
+	}
+	if v := m["ssh_user"]; v != "" {
+		c.sshUser = v
+	}
+	if v := m["provision"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provision %q: %w", v, err)
+		}
+		c.provision = b
+	}
+	if v := m["egress"]; v != "" {
+		if err := egress.ValidateEgress(v); err != nil {
+			return nil, fmt.Errorf("invalid egress %q: %w", v, err)
+		}
+		c.egress = v
+	}
+	if v := m["enforce"]; v != "" && v != "container" {
+		return nil, fmt.Errorf("invalid enforce %q: the memory backend only enforces egress inside the container", v)
+	}
+	if v := m["allow"]; v != "" {
+		c.allow = strings.Split(v, ",")
+	}
+
+	return c, nil
+}
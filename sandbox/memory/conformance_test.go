@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/sandboxtest"
+)
+
+func TestConformance(t *testing.T) {
+	sandboxtest.Run(t, func(cfg map[string]string) (sandbox.Sandbox, error) {
+		return New(cfg)
+	}, nil)
+}
@@ -0,0 +1,252 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/internal/retry"
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/user"
+)
+
+// Handler implements one entry in the command table. It returns the
+// command's exit code.
+type Handler func(ctx context.Context, c *Cmd) int
+
+// Cmd describes a single command invocation passed to a [Handler].
+type Cmd struct {
+	Sandbox *Memory
+	Name    string   // instance the command runs in
+	PID     int      // process ID of the enclosing Run call
+	Args    []string // Args[0] is the command name as invoked
+	Env     map[string]string
+	Dir     string
+	Root    bool
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// Handle registers h for commands whose name (or base name, so "/usr/bin/git"
+// matches "git") is cmd, replacing any builtin of the same name. Registering
+// "*" sets a fallback for commands with no handler; without one they exit 127.
+func (m *Memory) Handle(cmd string, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[cmd] = h
+}
+
+// handler looks up the handler for a command name.
+func (m *Memory) handler(name string) (Handler, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h, ok := m.handlers[name]; ok {
+		return h, true
+	}
+	if h, ok := m.handlers[path.Base(name)]; ok {
+		return h, true
+	}
+	h, ok := m.handlers["*"]
+	return h, ok
+}
+
+// exactHandler looks up a handler registered under exactly name.
+func (m *Memory) exactHandler(name string) (Handler, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.handlers[name]
+	return h, ok
+}
+
+// Run executes a command against the command table and returns its exit
+// code. A single-element command containing spaces is interpreted as a
+// shell line, matching how the SSH-based backends treat it.
+func (m *Memory) Run(ctx context.Context, name string, opts sandbox.ExecOpts) (int, error) {
+	if err := m.update(func(s *state) error {
+		if _, err := s.running(name); err != nil {
+			return err
+		}
+		s.emit(sandbox.EventExecStarted, name, "")
+		return nil
+	}); err != nil {
+		return 1, fmt.Errorf("exec on %s: %w", name, err)
+	}
+
+	pid, ctx, release := m.spawn(ctx, name)
+	c := m.newCmd(name, opts)
+	c.PID = pid
+	argv := opts.Cmd
+	if len(argv) == 1 && strings.Contains(argv[0], " ") {
+		argv = []string{"sh", "-c", argv[0]}
+	}
+	c.Args = argv
+	rc := m.dispatch(ctx, c)
+	if sig := release(); sig != 0 {
+		rc = 128 + int(sig)
+	}
+	return rc, nil
+}
+
+// Output executes a command and returns its stdout.
+func (m *Memory) Output(ctx context.Context, name string, cmd []string) ([]byte, error) {
+	var stdout bytes.Buffer
+	rc, err := m.Run(ctx, name, sandbox.ExecOpts{Cmd: cmd, Stdout: &stdout, Root: true})
+	if err != nil {
+		return nil, err
+	}
+	if rc != 0 {
+		return stdout.Bytes(), fmt.Errorf("command exited with code %d", rc)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Console runs RemoteCmd (default: a login shell reading commands from
+// stdin) wired to the process's stdio. There is no TTY; each stdin line is
+// executed as it arrives.
+func (m *Memory) Console(ctx context.Context, name string, opts sandbox.ConsoleOpts) error {
+	cmd := opts.RemoteCmd
+	if len(cmd) == 0 {
+		cmd = []string{"bash", "-l"}
+	}
+	rc, err := m.Run(ctx, name, sandbox.ExecOpts{
+		Cmd:    cmd,
+		Env:    opts.Env,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+	if err != nil {
+		return err
+	}
+	if rc != 0 {
+		return fmt.Errorf("console exited with code %d", rc)
+	}
+	return nil
+}
+
+// Ready waits until the instance is running. A missing instance fails
+// immediately with an error wrapping sandbox.ErrNotFound.
+func (m *Memory) Ready(ctx context.Context, name string, timeout time.Duration) error {
+	err := retry.Poll(ctx, 50*time.Millisecond, timeout, func(ctx context.Context) (bool, error) {
+		var running bool
+		err := m.view(func(s *state) error {
+			inst, err := s.instance(name)
+			if err != nil {
+				return err
+			}
+			running = inst.Status.IsRunning()
+			return nil
+		})
+		return running, err
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for %s to be ready: %w", name, err)
+	}
+	return nil
+}
+
+// newCmd builds the invocation context for a Run call: login environment
+// for the exec user, home directory as cwd, and non-nil stdio.
+func (m *Memory) newCmd(name string, opts sandbox.ExecOpts) *Cmd {
+	home, usr := path.Join("/home", m.cfg.sshUser), m.cfg.sshUser
+	if opts.Root {
+		home, usr = "/root", "root"
+	}
+	env := map[string]string{
+		"HOME":  home,
+		"USER":  usr,
+		"SHELL": "/bin/bash",
+		"PATH":  "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	}
+	for _, kv := range opts.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	c := &Cmd{
+		Sandbox: m,
+		Name:    name,
+		Env:     env,
+		Dir:     home,
+		Root:    opts.Root,
+		Stdin:   opts.Stdin,
+		Stdout:  opts.Stdout,
+		Stderr:  opts.Stderr,
+	}
+	if c.Stdin == nil {
+		c.Stdin = strings.NewReader("")
+	}
+	if c.Stdout == nil {
+		c.Stdout = io.Discard
+	}
+	if c.Stderr == nil {
+		c.Stderr = io.Discard
+	}
+	return c
+}
+
+// dispatch runs c through the command table.
+func (m *Memory) dispatch(ctx context.Context, c *Cmd) int {
+	if len(c.Args) == 0 {
+		return 0
+	}
+	if err := ctx.Err(); err != nil {
+		return 130
+	}
+	h, ok := m.handler(c.Args[0])
+	if !ok {
+		fmt.Fprintf(c.Stderr, "%s: command not found\n", c.Args[0])
+		return 127
+	}
+	return h(ctx, c)
+}
+
+// sub returns a copy of c for a nested command with the given argv. Env is
+// copied so the child cannot mutate the parent's environment.
+func (c *Cmd) sub(args []string) *Cmd {
+	n := *c
+	n.Args = args
+	n.Env = make(map[string]string, len(c.Env))
+	for k, v := range c.Env {
+		n.Env[k] = v
+	}
+	return &n
+}
+
+// Exec runs argv through the command table with c's environment and stdio.
+// Handlers use it to invoke other commands.
+func (c *Cmd) Exec(ctx context.Context, argv ...string) int {
+	return c.Sandbox.dispatch(ctx, c.sub(argv))
+}
+
+// ReadFile reads a file from the instance's filesystem, resolving relative
+// paths against c.Dir.
+func (c *Cmd) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	b, _, err := c.Sandbox.ReadFile(ctx, c.Name, c.abs(p), 0)
+	return b, err
+}
+
+// WriteFile writes a file into the instance's filesystem, owned by the exec
+// user unless the command runs as root.
+func (c *Cmd) WriteFile(ctx context.Context, p string, content []byte, mode os.FileMode) error {
+	uid, gid := sandbox.NoOwner, sandbox.NoOwner
+	if !c.Root {
+		uid, gid = user.UID, user.GID
+	}
+	return c.Sandbox.WriteFile(ctx, c.Name, c.abs(p), content, mode, uid, gid)
+}
+
+// abs resolves p against the working directory.
+func (c *Cmd) abs(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(c.Dir, p)
+}
@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func newRunning(t *testing.T) *Memory {
+	t.Helper()
+	m := newTestMemory(t, nil)
+	if _, err := m.Create(context.Background(), sandbox.CreateOpts{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func run(t *testing.T, m *Memory, opts sandbox.ExecOpts) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	opts.Stdout, opts.Stderr = &stdout, &stderr
+	rc, err := m.Run(context.Background(), "a", opts)
+	if err != nil {
+		t.Fatalf("Run(%q): %v", opts.Cmd, err)
+	}
+	return rc, stdout.String(), stderr.String()
+}
+
+func TestShell(t *testing.T) {
+	tests := []struct {
+		name   string
+		cmd    []string
+		rc     int
+		stdout string
+	}{
+		{"argv", []string{"echo", "a b", "c"}, 0, "a b c\n"},
+		{"single string", []string{"echo hello  world"}, 0, "hello world\n"},
+		{"quotes", []string{"sh", "-c", `echo 'a  b' "c $USER" \$HOME`}, 0, "a  b c pixel $HOME\n"},
+		{"and", []string{"sh", "-c", "true && echo yes"}, 0, "yes\n"},
+		{"and short-circuit", []string{"sh", "-c", "false && echo yes"}, 1, ""},
+		{"or", []string{"sh", "-c", "false || echo fallback"}, 0, "fallback\n"},
+		{"sequence", []string{"sh", "-c", "echo a; echo b"}, 0, "a\nb\n"},
+		{"status var", []string{"sh", "-c", "false; echo $?"}, 0, "1\n"},
+		{"export", []string{"sh", "-c", "export X=1; echo $X ${X}"}, 0, "1 1\n"},
+		{"prefix assignment", []string{"sh", "-c", "X=2 env -u PATH -u HOME -u SHELL -u USER"}, 0, "X=2\n"},
+		{"substitution", []string{"bash", "-lc", `eval "$(mise activate bash 2>/dev/null)"; echo "$(echo inner)"`}, 0, "inner\n"},
+		{"pipe", []string{"sh", "-c", "echo piped | cat"}, 0, "piped\n"},
+		{"exit", []string{"sh", "-c", "exit 3; echo unreachable"}, 3, ""},
+		{"unknown", []string{"nosuchcmd"}, 127, ""},
+		{"env wrapper", []string{"env", "-C", "/tmp", "--", "pwd"}, 0, "/tmp\n"},
+		{"command -v", []string{"sh", "-c", "command -v zmx >/dev/null 2>&1"}, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newRunning(t)
+			rc, stdout, stderr := run(t, m, sandbox.ExecOpts{Cmd: tt.cmd})
+			if rc != tt.rc {
+				t.Errorf("rc = %d, want %d (stderr %q)", rc, tt.rc, stderr)
+			}
+			if stdout != tt.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.stdout)
+			}
+		})
+	}
+}
+
+func TestShellRedirectsWriteFiles(t *testing.T) {
+	ctx := context.Background()
+	m := newRunning(t)
+
+	rc, _, stderr := run(t, m, sandbox.ExecOpts{Cmd: []string{"sh", "-c", "echo one > out.txt && echo two >> out.txt"}})
+	if rc != 0 {
+		t.Fatalf("rc = %d, stderr %q", rc, stderr)
+	}
+	body, _, err := m.ReadFile(ctx, "a", "/home/pixel/out.txt", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "one\ntwo\n" {
+		t.Errorf("out.txt = %q", body)
+	}
+	entries, _ := m.ListFiles(ctx, "a", "/home/pixel", false)
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	_, stdout, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"cat", "/home/pixel/out.txt"}})
+	if stdout != "one\ntwo\n" {
+		t.Errorf("cat = %q", stdout)
+	}
+	if rc, _, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"test", "-f", "/home/pixel/out.txt"}}); rc != 0 {
+		t.Errorf("test -f rc = %d", rc)
+	}
+	if rc, _, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"sh", "-c", "rm out.txt && [ ! -e out.txt ]"}}); rc != 0 {
+		t.Errorf("rm rc = %d", rc)
+	}
+}
+
+func TestRunAsRoot(t *testing.T) {
+	m := newRunning(t)
+	_, stdout, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"id", "-u"}})
+	if stdout != "1000\n" {
+		t.Errorf("id -u = %q, want 1000", stdout)
+	}
+	_, stdout, _ = run(t, m, sandbox.ExecOpts{Cmd: []string{"id", "-u"}, Root: true})
+	if stdout != "0\n" {
+		t.Errorf("id -u as root = %q, want 0", stdout)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	m := newRunning(t)
+	m.Handle("git", func(_ context.Context, c *Cmd) int {
+		c.Stdout.Write([]byte("git " + strings.Join(c.Args[1:], " ") + " in " + c.Dir + "\n"))
+		return 0
+	})
+	m.Handle("/tmp/setup.sh", func(_ context.Context, c *Cmd) int { return 42 })
+
+	_, stdout, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"sh", "-c", "cd /srv && /usr/bin/git status"}})
+	if stdout != "git status in /srv\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if rc, _, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"bash", "/tmp/setup.sh"}}); rc != 42 {
+		t.Errorf("script handler rc = %d, want 42", rc)
+	}
+
+	m.Handle("*", func(_ context.Context, c *Cmd) int { return 0 })
+	if rc, _, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"apt-get", "install", "-y", "curl"}}); rc != 0 {
+		t.Errorf("fallback rc = %d, want 0", rc)
+	}
+}
+
+func TestShellScriptFile(t *testing.T) {
+	ctx := context.Background()
+	m := newRunning(t)
+	if rc, _, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"bash", "/tmp/missing.sh"}}); rc != 127 {
+		t.Errorf("missing script rc = %d, want 127", rc)
+	}
+	if err := m.WriteFile(ctx, "a", "/tmp/setup.sh", []byte("apt-get install -y x\n"), 0o755, -1, -1); err != nil {
+		t.Fatal(err)
+	}
+	if rc, _, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"bash", "/tmp/setup.sh"}}); rc != 0 {
+		t.Errorf("existing script rc = %d, want 0", rc)
+	}
+}
+
+func TestInteractiveShellReadsStdin(t *testing.T) {
+	m := newRunning(t)
+	rc, stdout, _ := run(t, m, sandbox.ExecOpts{
+		Cmd:   []string{"bash", "-l"},
+		Stdin: strings.NewReader("echo first\nexport V=2\necho $V\nexit 5\necho never\n"),
+	})
+	if rc != 5 {
+		t.Errorf("rc = %d, want 5", rc)
+	}
+	if stdout != "first\n2\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	m := newRunning(t)
+	out, err := m.Output(context.Background(), "a", []string{"whoami"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "root\n" {
+		t.Errorf("Output = %q, want root", out)
+	}
+	if _, err := m.Output(context.Background(), "a", []string{"false"}); err == nil {
+		t.Error("Output of failing command returned nil error")
+	}
+}
+
+func TestFindAndStat(t *testing.T) {
+	ctx := context.Background()
+	m := newRunning(t)
+	if err := m.WriteFile(ctx, "a", "/srv/app/main.go", []byte("package main\n"), 0o640, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stdout, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"find", "/srv", "-mindepth", "1", "-printf", `%p\t%s\t%m\t%y\n`}})
+	want := "/srv/app\t0\t755\td\n/srv/app/main.go\t13\t640\tf\n"
+	if stdout != want {
+		t.Errorf("find = %q, want %q", stdout, want)
+	}
+	_, stdout, _ = run(t, m, sandbox.ExecOpts{Cmd: []string{"find", "/srv", "-maxdepth", "1"}})
+	if stdout != "/srv\n/srv/app\n" {
+		t.Errorf("find -maxdepth 1 = %q", stdout)
+	}
+
+	_, stdout, _ = run(t, m, sandbox.ExecOpts{Cmd: []string{"stat", "-c", "%s %u:%g %a", "--", "/srv/app/main.go"}})
+	if stdout != "13 1000:1000 640\n" {
+		t.Errorf("stat = %q", stdout)
+	}
+	if rc, _, _ := run(t, m, sandbox.ExecOpts{Cmd: []string{"stat", "-c", "%s", "/nope"}}); rc != 1 {
+		t.Errorf("stat missing rc = %d, want 1", rc)
+	}
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// exportPayload is the memory backend's checkpoint payload.
+type exportPayload struct {
+	FS     fileSystem     `json:"fs"`
+	Policy sandbox.Policy `json:"policy"`
+}
+
+// ExportSnapshot writes the snapshot's filesystem and the instance's egress
+// policy as a checkpoint archive.
+func (m *Memory) ExportSnapshot(ctx context.Context, name, label string, w io.Writer) error {
+	var manifest sandbox.ExportManifest
+	var payload []byte
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		snap := inst.snapshot(label)
+		if snap == nil {
+			return fmt.Errorf("snapshot %s/%s: %w", name, label, sandbox.ErrNotFound)
+		}
+		manifest = sandbox.NewExportManifest(backendName, inst.toInstance(), label)
+		payload, err = json.Marshal(exportPayload{FS: snap.FS, Policy: inst.Policy})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return sandbox.WriteExport(w, manifest, bytes.NewReader(payload), int64(len(payload)))
+}
+
+// ImportSnapshot creates newName from a checkpoint archive, running, with
+// the checkpoint as its only snapshot.
+func (m *Memory) ImportSnapshot(ctx context.Context, newName string, r io.Reader) error {
+	return sandbox.ReadExport(r, backendName, func(manifest *sandbox.ExportManifest, payload io.Reader) error {
+		var p exportPayload
+		if err := json.NewDecoder(payload).Decode(&p); err != nil {
+			return fmt.Errorf("reading checkpoint: %w", err)
+		}
+		return m.update(func(s *state) error {
+			if _, ok := s.Instances[newName]; ok {
+				return fmt.Errorf("instance %s: %w", newName, sandbox.ErrAlreadyExists)
+			}
+			now := s.now()
+			s.Instances[newName] = &instance{
+				Name:      newName,
+				Status:    sandbox.StatusRunning,
+				Address:   s.allocAddress(),
+				Image:     manifest.Image,
+				CPU:       manifest.CPU,
+				Memory:    manifest.Memory,
+				Origin:    manifest.Origin(),
+				Labels:    manifest.Labels,
+				CreatedAt: now,
+				FS:        p.FS.clone(),
+				Snapshots: []*snapshot{{Label: manifest.Label, CreatedAt: now, FS: p.FS}},
+				Policy:    p.Policy,
+			}
+			s.emit(sandbox.EventCreated, newName, "")
+			s.emit(sandbox.EventStarted, newName, "")
+			return nil
+		})
+	})
+}
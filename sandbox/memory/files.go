@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// WriteFile writes content to path inside the instance's filesystem.
+// Parents are created as root-owned 0o755 directories (mkdir-p semantics).
+// uid/gid set ownership; pass [sandbox.NoOwner] to leave the file
+// root-owned.
+func (m *Memory) WriteFile(ctx context.Context, name, p string, content []byte, mode os.FileMode, uid, gid int) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		clean, err := cleanPath(p)
+		if err != nil {
+			return fmt.Errorf("write %s: %w", p, err)
+		}
+		if err := inst.fits(map[string]int64{clean: int64(len(content))}); err != nil {
+			return err
+		}
+		if err := inst.FS.write(p, content, mode, uid, gid); err != nil {
+			return fmt.Errorf("write %s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// ReadFile returns the file (or first maxBytes). If maxBytes>0 and the file
+// is larger, returns truncated=true.
+func (m *Memory) ReadFile(ctx context.Context, name, p string, maxBytes int64) ([]byte, bool, error) {
+	var (
+		body      []byte
+		truncated bool
+	)
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		n, err := inst.FS.read(p)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", p, err)
+		}
+		body = n.Data
+		if maxBytes > 0 && int64(len(body)) > maxBytes {
+			body, truncated = body[:maxBytes], true
+		}
+		body = append([]byte(nil), body...)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return body, truncated, nil
+}
+
+// ListFiles enumerates entries below p, sorted by path.
+func (m *Memory) ListFiles(ctx context.Context, name, p string, recursive bool) ([]sandbox.FileEntry, error) {
+	var entries []sandbox.FileEntry
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		entries, err = inst.FS.list(p, recursive)
+		if err != nil {
+			return fmt.Errorf("list %s: %w", p, err)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// DeleteFile removes a single file. Directories are refused.
+func (m *Memory) DeleteFile(ctx context.Context, name, p string) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		if err := inst.FS.remove(p); err != nil {
+			return fmt.Errorf("delete %s: %w", p, err)
+		}
+		return nil
+	})
+}
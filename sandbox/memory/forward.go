@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// AddForward records a port forward. Nothing listens: the forward exists so
+// callers can exercise the add/list/remove flow without a container
+// runtime. Listen addresses are unique across instances, as a real host's
+// ports would be.
+func (m *Memory) AddForward(ctx context.Context, name string, f sandbox.Forward) error {
+	if f.Name == "" || f.Listen == "" || f.Port < 1 || f.Port > 65535 {
+		return fmt.Errorf("invalid forward %+v", f)
+	}
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		for _, other := range s.Instances {
+			for _, g := range other.Forwards {
+				if other == inst && g.Name == f.Name {
+					return fmt.Errorf("forward %s on %s: %w", f.Name, name, sandbox.ErrAlreadyExists)
+				}
+				if g.Listen == f.Listen {
+					return fmt.Errorf("listen address %s already in use by %s/%s", f.Listen, other.Name, g.Name)
+				}
+			}
+		}
+		inst.Forwards = append(inst.Forwards, f)
+		return nil
+	})
+}
+
+// ListForwards returns the instance's forwards in the order they were added.
+func (m *Memory) ListForwards(ctx context.Context, name string) ([]sandbox.Forward, error) {
+	var out []sandbox.Forward
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		out = slices.Clone(inst.Forwards)
+		return nil
+	})
+	return out, err
+}
+
+// RemoveForward deletes a forward by name.
+func (m *Memory) RemoveForward(ctx context.Context, name, forward string) error {
+	return m.update(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		for i, f := range inst.Forwards {
+			if f.Name == forward {
+				inst.Forwards = slices.Delete(inst.Forwards, i, i+1)
+				return nil
+			}
+		}
+		return fmt.Errorf("forward %s/%s: %w", name, forward, sandbox.ErrNotFound)
+	})
+}
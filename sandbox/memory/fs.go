@@ -0,0 +1,180 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/user"
+)
+
+// node is a single file or directory. Directories carry os.ModeDir in Mode
+// and no data.
+type node struct {
+	Data []byte      `json:"data,omitempty"`
+	Mode os.FileMode `json:"mode"`
+	UID  int         `json:"uid"`
+	GID  int         `json:"gid"`
+}
+
+// fileSystem maps cleaned absolute paths to nodes. The root directory is
+// always present.
+type fileSystem map[string]*node
+
+// newFileSystem returns the skeleton every fresh instance starts with,
+// including a home directory owned by the sandbox user.
+func newFileSystem(sshUser string) fileSystem {
+	fs := fileSystem{
+		"/":     {Mode: os.ModeDir | 0o755},
+		"/etc":  {Mode: os.ModeDir | 0o755},
+		"/root": {Mode: os.ModeDir | 0o700},
+		"/tmp":  {Mode: os.ModeDir | os.ModeSticky | 0o777},
+		"/home": {Mode: os.ModeDir | 0o755},
+	}
+	fs[path.Join("/home", sshUser)] = &node{Mode: os.ModeDir | 0o755, UID: user.UID, GID: user.GID}
+	return fs
+}
+
+// clone returns a deep copy, so snapshots and clones never share buffers.
+func (fs fileSystem) clone() fileSystem {
+	out := make(fileSystem, len(fs))
+	for p, n := range fs {
+		c := *n
+		c.Data = append([]byte(nil), n.Data...)
+		out[p] = &c
+	}
+	return out
+}
+
+// cleanPath validates that p is absolute and returns its cleaned form.
+func cleanPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("path %q is not absolute", p)
+	}
+	return path.Clean(p), nil
+}
+
+// mkdirAll creates p and any missing ancestors as root-owned 0o755
+// directories.
+func (fs fileSystem) mkdirAll(p string) error {
+	if p == "/" {
+		return nil
+	}
+	if err := fs.mkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+	if n, ok := fs[p]; ok {
+		if !n.Mode.IsDir() {
+			return fmt.Errorf("mkdir %s: not a directory", p)
+		}
+		return nil
+	}
+	fs[p] = &node{Mode: os.ModeDir | 0o755}
+	return nil
+}
+
+// write creates or replaces the file at p. Parents are created with
+// mkdir-p semantics. Negative uid/gid leave the file root-owned.
+func (fs fileSystem) write(p string, content []byte, mode os.FileMode, uid, gid int) error {
+	p, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	if err := fs.mkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+	if n, ok := fs[p]; ok && n.Mode.IsDir() {
+		return fmt.Errorf("write %s: is a directory", p)
+	}
+	if uid < 0 || gid < 0 {
+		uid, gid = 0, 0
+	}
+	fs[p] = &node{
+		Data: append([]byte(nil), content...),
+		Mode: mode.Perm(),
+		UID:  uid,
+		GID:  gid,
+	}
+	return nil
+}
+
+// read returns the file at p.
+func (fs fileSystem) read(p string) (*node, error) {
+	p, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := fs[p]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", p, sandbox.ErrNotFound)
+	}
+	if n.Mode.IsDir() {
+		return nil, fmt.Errorf("%s: is a directory", p)
+	}
+	return n, nil
+}
+
+// list enumerates entries below dir, sorted by path. Non-recursive listings
+// only include direct children.
+func (fs fileSystem) list(dir string, recursive bool) ([]sandbox.FileEntry, error) {
+	dir, err := cleanPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := fs[dir]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", dir, sandbox.ErrNotFound)
+	}
+	if !n.Mode.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", dir)
+	}
+
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	var entries []sandbox.FileEntry
+	for p, n := range fs {
+		if p == dir || !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		if !recursive && strings.Contains(p[len(prefix):], "/") {
+			continue
+		}
+		entries = append(entries, sandbox.FileEntry{
+			Path:  p,
+			Size:  int64(len(n.Data)),
+			Mode:  n.Mode.Perm(),
+			IsDir: n.Mode.IsDir(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// remove deletes a single file. Directories are refused, matching `rm`
+// without -r.
+func (fs fileSystem) remove(p string) error {
+	p, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+	n, ok := fs[p]
+	if !ok {
+		return fmt.Errorf("%s: %w", p, sandbox.ErrNotFound)
+	}
+	if n.Mode.IsDir() {
+		return fmt.Errorf("%s: is a directory", p)
+	}
+	delete(fs, p)
+	return nil
+}
+
+// size is the total number of file bytes, used as the snapshot size.
+func (fs fileSystem) size() int64 {
+	var total int64
+	for _, n := range fs {
+		total += int64(len(n.Data))
+	}
+	return total
+}
@@ -0,0 +1,195 @@
+// Package memory implements the sandbox.Sandbox interface entirely in
+// process memory. Instances are plain structs, their filesystems are maps of
+// path to file node, and commands run against a scriptable table of Go
+// handlers instead of a real shell.
+//
+// The backend exists so the CLI and the MCP server can run end-to-end
+// without Incus or TrueNAS — for black-box tests and for laptop demos. Set
+// the "state_file" config key to persist instances as JSON so that separate
+// CLI invocations (and the MCP daemon) see the same sandboxes.
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Compile-time check that Memory implements sandbox.Sandbox.
+var _ sandbox.Sandbox = (*Memory)(nil)
+
+// backendName is recorded in, and checked against, checkpoint archives.
+const backendName = "memory"
+
+func init() {
+	sandbox.Register(backendName, func(cfg map[string]string) (sandbox.Sandbox, error) {
+		return New(cfg)
+	})
+}
+
+// Memory implements sandbox.Sandbox without any container runtime.
+type Memory struct {
+	cfg *memoryCfg
+
+	mu       sync.Mutex
+	state    *state
+	handlers map[string]Handler
+
+	// The process table is per-Memory and never persisted: processes
+	// don't outlive the Go process that runs them.
+	procMu  sync.Mutex
+	procs   map[int]*proc
+	nextPID int
+}
+
+// New creates an in-memory sandbox backend from a flat config map. When
+// cfg["state_file"] is set, existing state is loaded from it and every
+// mutation is written back.
+func New(cfg map[string]string) (*Memory, error) {
+	c, err := parseCfg(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Memory{
+		cfg:      c,
+		state:    newState(),
+		handlers: make(map[string]Handler),
+		procs:    make(map[int]*proc),
+		nextPID:  100,
+	}
+	for name, h := range builtins {
+		m.handlers[name] = h
+	}
+
+	if c.stateFile != "" {
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Capabilities advertises that the memory backend supports every optional
+// feature except host mounts: an in-memory filesystem cannot share a host
+// directory.
+func (m *Memory) Capabilities() sandbox.Capabilities {
+	return sandbox.Capabilities{
+		Snapshots:     true,
+		CloneFrom:     true,
+		EgressControl: true,
+		PortForward:   true,
+	}
+}
+
+// Close is a no-op; state is persisted after every mutation.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// view runs fn against the current state. With a state file configured the
+// state is reloaded first so changes made by other processes are visible.
+func (m *Memory) view(fn func(s *state) error) error {
+	return m.transact(false, fn)
+}
+
+// update runs fn against the current state and persists the result when a
+// state file is configured. Nothing is written if fn returns an error.
+func (m *Memory) update(fn func(s *state) error) error {
+	return m.transact(true, fn)
+}
+
+func (m *Memory) transact(write bool, fn func(s *state) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cfg.stateFile == "" {
+		return fn(m.state)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.cfg.stateFile), 0o755); err != nil {
+		return fmt.Errorf("creating memory state dir: %w", err)
+	}
+	lock := flock.New(m.cfg.stateFile + ".lock")
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("flock %s: %w", m.cfg.stateFile, err)
+	}
+	defer lock.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+	if err := fn(m.state); err != nil {
+		return err
+	}
+	if !write {
+		return nil
+	}
+	return m.save()
+}
+
+// instance returns the named instance or an error wrapping
+// sandbox.ErrNotFound.
+func (s *state) instance(name string) (*instance, error) {
+	inst, ok := s.Instances[name]
+	if !ok {
+		return nil, fmt.Errorf("instance %s: %w", name, sandbox.ErrNotFound)
+	}
+	return inst, nil
+}
+
+// running returns the named instance if it exists and is running.
+func (s *state) running(name string) (*instance, error) {
+	inst, err := s.instance(name)
+	if err != nil {
+		return nil, err
+	}
+	if !inst.Status.IsRunning() {
+		return nil, sandbox.Wrap(sandbox.ErrNotRunning, fmt.Errorf("instance %s is %s — start it first", name, inst.Status))
+	}
+	return inst, nil
+}
+
+// fits returns an error wrapping sandbox.ErrQuotaExceeded if writing
+// files, a map from path to new size, would take the instance past its
+// disk size.
+func (inst *instance) fits(files map[string]int64) error {
+	if inst.Disk <= 0 {
+		return nil
+	}
+	total := inst.FS.size()
+	for p, size := range files {
+		if n, ok := inst.FS[p]; ok {
+			total -= int64(len(n.Data))
+		}
+		total += size
+	}
+	if total > inst.Disk {
+		return sandbox.Wrap(sandbox.ErrQuotaExceeded, fmt.Errorf("instance %s: %d bytes exceed its %d byte disk", inst.Name, total, inst.Disk))
+	}
+	return nil
+}
+
+// now is the clock used for CreatedAt stamps. Stamps are forced to be
+// strictly increasing so snapshot ordering is stable even when the wall
+// clock has coarse resolution.
+func (s *state) now() time.Time {
+	t := time.Now().UTC()
+	if !t.After(s.LastStamp) {
+		t = s.LastStamp.Add(time.Microsecond)
+	}
+	s.LastStamp = t
+	return t
+}
+
+// isNotExist reports whether err is a missing-file error.
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,377 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func newTestMemory(t *testing.T, cfg map[string]string) *Memory {
+	t.Helper()
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+func TestRegistered(t *testing.T) {
+	sb, err := sandbox.Open("memory", nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, ok := sb.(*Memory); !ok {
+		t.Errorf("Open returned %T, want *Memory", sb)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory(t, nil)
+
+	inst, err := m.Create(ctx, sandbox.CreateOpts{Name: "a"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if inst.Status != sandbox.StatusRunning {
+		t.Errorf("status = %s, want RUNNING", inst.Status)
+	}
+	if len(inst.Addresses) != 1 || inst.Addresses[0] != "192.0.2.1" {
+		t.Errorf("addresses = %v, want [192.0.2.1]", inst.Addresses)
+	}
+	if _, err := m.Create(ctx, sandbox.CreateOpts{Name: "a"}); err == nil {
+		t.Error("duplicate Create succeeded")
+	}
+
+	if err := m.Stop(ctx, "a"); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	got, err := m.Get(ctx, "a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Status != sandbox.StatusStopped || len(got.Addresses) != 0 {
+		t.Errorf("after Stop: %+v", got)
+	}
+	if _, err := m.Run(ctx, "a", sandbox.ExecOpts{Cmd: []string{"true"}}); err == nil {
+		t.Error("Run on stopped instance succeeded")
+	}
+
+	if err := m.Start(ctx, "a"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := m.Create(ctx, sandbox.CreateOpts{Name: "b"}); err != nil {
+		t.Fatalf("Create b: %v", err)
+	}
+	list, err := m.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "a" || list[1].Name != "b" {
+		t.Errorf("List = %+v", list)
+	}
+
+	if err := m.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := m.Get(ctx, "a"); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory(t, nil)
+
+	checks := map[string]error{
+		"Get":            func() error { _, err := m.Get(ctx, "nope"); return err }(),
+		"Start":          m.Start(ctx, "nope"),
+		"Stop":           m.Stop(ctx, "nope"),
+		"Delete":         m.Delete(ctx, "nope"),
+		"CreateSnapshot": m.CreateSnapshot(ctx, "nope", "x"),
+		"Ready":          m.Ready(ctx, "nope", time.Second),
+		"WriteFile":      m.WriteFile(ctx, "nope", "/x", nil, 0o644, -1, -1),
+		"GetPolicy":      func() error { _, err := m.GetPolicy(ctx, "nope"); return err }(),
+	}
+	for name, err := range checks {
+		if !errors.Is(err, sandbox.ErrNotFound) {
+			t.Errorf("%s: err = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestSnapshotsAndClone(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory(t, nil)
+	if _, err := m.Create(ctx, sandbox.CreateOpts{Name: "src"}); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := m.WriteFile(ctx, name, "/work/file", []byte(content), 0o644, -1, -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		b, _, err := m.ReadFile(ctx, name, "/work/file", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	write("src", "one")
+	if err := m.CreateSnapshot(ctx, "src", "first"); err != nil {
+		t.Fatal(err)
+	}
+	write("src", "two")
+	if err := m.CreateSnapshot(ctx, "src", "second"); err != nil {
+		t.Fatal(err)
+	}
+
+	snaps, err := m.ListSnapshots(ctx, "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[0].Label != "first" || snaps[1].Label != "second" {
+		t.Fatalf("ListSnapshots = %+v", snaps)
+	}
+	if !snaps[0].CreatedAt.Before(snaps[1].CreatedAt) {
+		t.Error("snapshots not ordered by CreatedAt")
+	}
+
+	if err := m.RestoreSnapshot(ctx, "src", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("src"); got != "one" {
+		t.Errorf("after restore = %q, want one", got)
+	}
+
+	if err := m.CloneFrom(ctx, "src", "second", "clone"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("clone"); got != "two" {
+		t.Errorf("clone = %q, want two", got)
+	}
+	write("clone", "changed")
+	if got := read("src"); got != "one" {
+		t.Errorf("source changed through clone: %q", got)
+	}
+
+	if err := m.DeleteSnapshot(ctx, "src", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RestoreSnapshot(ctx, "src", "first"); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("restore deleted snapshot: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory(t, nil)
+	if _, err := m.Create(ctx, sandbox.CreateOpts{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.WriteFile(ctx, "a", "/srv/app/main.go", []byte("package main\n"), 0o600, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	body, truncated, err := m.ReadFile(ctx, "a", "/srv/app/main.go", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "pack" || !truncated {
+		t.Errorf("ReadFile(4) = %q, %v", body, truncated)
+	}
+	if _, truncated, _ := m.ReadFile(ctx, "a", "/srv/app/main.go", 13); truncated {
+		t.Error("exact-size read reported truncation")
+	}
+
+	entries, err := m.ListFiles(ctx, "a", "/srv", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/srv/app" || !entries[0].IsDir {
+		t.Errorf("ListFiles(/srv) = %+v", entries)
+	}
+	entries, _ = m.ListFiles(ctx, "a", "/srv", true)
+	if len(entries) != 2 || entries[1].Mode != 0o600 || entries[1].Size != 13 {
+		t.Errorf("ListFiles(/srv, recursive) = %+v", entries)
+	}
+
+	if err := m.DeleteFile(ctx, "a", "/srv/app"); err == nil {
+		t.Error("DeleteFile on a directory succeeded")
+	}
+	if err := m.DeleteFile(ctx, "a", "/srv/app/main.go"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.ReadFile(ctx, "a", "/srv/app/main.go", 0); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("read deleted file: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDiskQuota(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory(t, nil)
+	if _, err := m.Create(ctx, sandbox.CreateOpts{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateLimits(ctx, "a", sandbox.Limits{Disk: 8}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.WriteFile(ctx, "a", "/f", []byte("12345678"), 0o644, 0, 0); err != nil {
+		t.Fatalf("write up to the disk size: %v", err)
+	}
+	if err := m.WriteFile(ctx, "a", "/f", []byte("abcdefgh"), 0o644, 0, 0); err != nil {
+		t.Errorf("overwrite of the same size: %v", err)
+	}
+	if err := m.WriteFile(ctx, "a", "/g", []byte("x"), 0o644, 0, 0); !errors.Is(err, sandbox.ErrQuotaExceeded) {
+		t.Errorf("write past the disk size: err = %v, want ErrQuotaExceeded", err)
+	}
+	if _, _, err := m.ReadFile(ctx, "a", "/g", 0); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("refused write left a file: err = %v", err)
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory(t, map[string]string{"egress": "agent", "allow": "extra.example"})
+	if _, err := m.Create(ctx, sandbox.CreateOpts{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pol, err := m.GetPolicy(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pol.Mode != sandbox.EgressAgent || len(pol.Domains) == 0 {
+		t.Fatalf("initial policy = %+v", pol)
+	}
+
+	if err := m.SetEgressMode(ctx, "a", sandbox.EgressUnrestricted); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AllowDomain(ctx, "a", "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	pol, _ = m.GetPolicy(ctx, "a")
+	if pol.Mode != sandbox.EgressAllowlist {
+		t.Errorf("mode after AllowDomain = %s, want allowlist", pol.Mode)
+	}
+	want := []string{"extra.example", "example.com"}
+	if len(pol.Domains) != 2 || pol.Domains[0] != want[0] || pol.Domains[1] != want[1] {
+		t.Errorf("domains = %v, want %v", pol.Domains, want)
+	}
+
+	if err := m.DenyDomain(ctx, "a", "Example.COM."); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DenyDomain(ctx, "a", "example.com"); err == nil {
+		t.Error("denying an absent domain succeeded")
+	}
+}
+
+func TestStateFileSharedAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	cfg := map[string]string{"state_file": filepath.Join(t.TempDir(), "state.json")}
+
+	a := newTestMemory(t, cfg)
+	if _, err := a.Create(ctx, sandbox.CreateOpts{Name: "shared"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.WriteFile(ctx, "shared", "/tmp/x", []byte("hi"), 0o644, -1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestMemory(t, cfg)
+	body, _, err := b.ReadFile(ctx, "shared", "/tmp/x", 0)
+	if err != nil {
+		t.Fatalf("second backend cannot see file: %v", err)
+	}
+	if string(body) != "hi" {
+		t.Errorf("body = %q", body)
+	}
+
+	// Changes made after b was opened are still visible to b.
+	if err := a.Stop(ctx, "shared"); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := b.Get(ctx, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Status != sandbox.StatusStopped {
+		t.Errorf("status seen by b = %s, want STOPPED", inst.Status)
+	}
+}
+
+func TestWatchSeesOtherInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := map[string]string{"state_file": filepath.Join(t.TempDir(), "state.json")}
+
+	a := newTestMemory(t, cfg)
+	if _, err := a.Create(ctx, sandbox.CreateOpts{Name: "w"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestMemory(t, cfg)
+	events := make(chan sandbox.Event, 16)
+	done := make(chan error, 1)
+	go func() { done <- b.Watch(ctx, func(e sandbox.Event) { events <- e }) }()
+	time.Sleep(2 * watchInterval) // let Watch note where the log ends
+
+	a.Run(ctx, "w", sandbox.ExecOpts{Cmd: []string{"true"}})
+	a.CreateSnapshot(ctx, "w", "s1")
+	a.Delete(ctx, "w")
+
+	want := []sandbox.Event{
+		{Type: sandbox.EventExecStarted, Name: "w"},
+		{Type: sandbox.EventSnapshotCreated, Name: "w", Snapshot: "s1"},
+		{Type: sandbox.EventDeleted, Name: "w"},
+	}
+	for _, w := range want {
+		select {
+		case e := <-events:
+			if e.Type != w.Type || e.Name != w.Name || e.Snapshot != w.Snapshot || e.Time.IsZero() {
+				t.Errorf("event = %+v, want %+v", e, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", w.Type)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch = %v, want nil after cancel", err)
+	}
+}
+
+func TestReadyWaitsForStart(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMemory(t, nil)
+	if _, err := m.Create(ctx, sandbox.CreateOpts{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Stop(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Ready(ctx, "a", 100*time.Millisecond); err == nil {
+		t.Error("Ready on stopped instance succeeded")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = m.Start(ctx, "a")
+	}()
+	if err := m.Ready(ctx, "a", 2*time.Second); err != nil {
+		t.Errorf("Ready: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/deevus/pixels/internal/egress"
+	"github.com/deevus/pixels/sandbox"
+)
+
+// SetEgressMode records the egress mode for an instance. Restricted modes
+// reset the domain list to the preset plus the configured allow list, as
+// the real backends do when they rewrite /etc/pixels-egress-domains.
+func (m *Memory) SetEgressMode(ctx context.Context, name string, mode sandbox.EgressMode) error {
+	return m.update(func(s *state) error {
+		inst, err := s.running(name)
+		if err != nil {
+			return err
+		}
+		switch mode {
+		case sandbox.EgressUnrestricted:
+			inst.Policy = egress.NewPolicy(mode, nil)
+		case sandbox.EgressLearn:
+			inst.Policy = egress.LearnPolicy(&inst.Policy)
+		default:
+			if err := egress.ValidateEgress(string(mode)); err != nil {
+				return err
+			}
+			inst.Policy = egress.NewPolicy(mode, m.cfg.allow)
+		}
+		return nil
+	})
+}
+
+// AllowDomain adds a domain to the egress allowlist. An unrestricted or
+// learning instance is switched to allowlist mode first.
+func (m *Memory) AllowDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
+	return m.update(func(s *state) error {
+		inst, err := s.running(name)
+		if err != nil {
+			return err
+		}
+		if inst.Policy.Mode == sandbox.EgressUnrestricted || inst.Policy.Mode == sandbox.EgressLearn || inst.Policy.Mode == "" {
+			inst.Policy = egress.NewPolicy(sandbox.EgressAllowlist, m.cfg.allow)
+		}
+		inst.Policy = *egress.UpgradePolicy(&inst.Policy)
+		inst.Policy.Add(domain)
+		return nil
+	})
+}
+
+// DenyDomain removes a domain from the egress allowlist.
+func (m *Memory) DenyDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
+	return m.update(func(s *state) error {
+		inst, err := s.running(name)
+		if err != nil {
+			return err
+		}
+		inst.Policy = *egress.UpgradePolicy(&inst.Policy)
+		if !inst.Policy.Remove(domain) {
+			return fmt.Errorf("domain %q not in allowlist", domain)
+		}
+		return nil
+	})
+}
+
+// GetPolicy returns the current egress policy for an instance.
+func (m *Memory) GetPolicy(ctx context.Context, name string) (*sandbox.Policy, error) {
+	var out *sandbox.Policy
+	err := m.view(func(s *state) error {
+		inst, err := s.instance(name)
+		if err != nil {
+			return err
+		}
+		if inst.Policy.Mode == "" {
+			out = &sandbox.Policy{Mode: sandbox.EgressUnrestricted}
+			return nil
+		}
+		p := clonePolicy(inst.Policy)
+		out = &p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// clonePolicy returns a copy of p that shares no slices with it.
+func clonePolicy(p sandbox.Policy) sandbox.Policy {
+	p.Presets, p.Allow, p.Deny = slices.Clone(p.Presets), slices.Clone(p.Allow), slices.Clone(p.Deny)
+	p.Domains, p.CIDRs = slices.Clone(p.Domains), slices.Clone(p.CIDRs)
+	return p
+}
@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// proc is an entry in the process table: one Run call. Nested commands
+// (sh -c, exec, pipelines) share their Run's PID, as if every command
+// exec'd in place.
+type proc struct {
+	instance string
+	cancel   context.CancelCauseFunc
+}
+
+// signalled is the cancellation cause recorded by `kill`.
+type signalled struct{ sig syscall.Signal }
+
+func (s signalled) Error() string { return "killed by signal " + strconv.Itoa(int(s.sig)) }
+
+// spawn registers a process for instance and returns its PID, a context
+// cancelled when it is signalled, and a release func that reports the
+// signal that ended it (0 if none).
+func (m *Memory) spawn(ctx context.Context, instance string) (int, context.Context, func() syscall.Signal) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	m.procMu.Lock()
+	m.nextPID++
+	pid := m.nextPID
+	m.procs[pid] = &proc{instance: instance, cancel: cancel}
+	m.procMu.Unlock()
+
+	return pid, ctx, func() syscall.Signal {
+		m.procMu.Lock()
+		delete(m.procs, pid)
+		m.procMu.Unlock()
+
+		var s signalled
+		errors.As(context.Cause(ctx), &s)
+		cancel(nil)
+		return s.sig
+	}
+}
+
+// signal delivers sig to pid in instance. Signal 0 only checks existence.
+// Every other signal terminates the process: handlers have no way to catch
+// one.
+func (m *Memory) signal(instance string, pid int, sig syscall.Signal) error {
+	m.procMu.Lock()
+	defer m.procMu.Unlock()
+	p, ok := m.procs[pid]
+	if !ok || p.instance != instance {
+		return fmt.Errorf("(%d) - No such process", pid)
+	}
+	if sig != 0 {
+		p.cancel(signalled{sig})
+	}
+	return nil
+}
+
+// killAll terminates every process in instance, as stopping a container
+// would.
+func (m *Memory) killAll(instance string) {
+	m.procMu.Lock()
+	defer m.procMu.Unlock()
+	for _, p := range m.procs {
+		if p.instance == instance {
+			p.cancel(signalled{syscall.SIGKILL})
+		}
+	}
+}
+
+// StartProcess runs a command in the background through the same
+// PID-reporting wrapper the remote backends use.
+func (m *Memory) StartProcess(ctx context.Context, name string, opts sandbox.ExecOpts) (sandbox.Process, error) {
+	run := func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error) {
+		return m.Run(ctx, name, sandbox.ExecOpts{
+			Cmd:    cmd,
+			Env:    opts.Env,
+			Stdout: stdout,
+			Stderr: stderr,
+			Root:   opts.Root,
+		})
+	}
+	signal := func(ctx context.Context, pid int, sig syscall.Signal) error {
+		return m.signal(name, pid, sig)
+	}
+	return sandbox.RunInBackground(ctx, opts.Cmd, run, signal)
+}
+
+// builtinKill implements `kill [-s SIG | -SIG] [--] pid...`. A negative PID
+// names a process group; since nested commands share their Run's PID, the
+// group is just that process.
+func builtinKill(_ context.Context, c *Cmd) int {
+	sig := syscall.SIGTERM
+	args := c.Args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		a := args[0]
+		args = args[1:]
+		if a == "--" {
+			break
+		}
+		name := a[1:]
+		if a == "-s" && len(args) > 0 {
+			name, args = args[0], args[1:]
+		}
+		s, err := sandbox.ParseSignal(name)
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "kill: %s: invalid signal specification\n", name)
+			return 1
+		}
+		sig = s
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(c.Stderr, "kill: usage: kill [-s sigspec | -signum] pid...")
+		return 2
+	}
+
+	rc := 0
+	for _, a := range args {
+		pid, err := strconv.Atoi(strings.TrimPrefix(a, "-"))
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "kill: %s: arguments must be process or job IDs\n", a)
+			rc = 1
+			continue
+		}
+		if err := c.Sandbox.signal(c.Name, pid, sig); err != nil {
+			fmt.Fprintf(c.Stderr, "kill: %v\n", err)
+			rc = 1
+		}
+	}
+	return rc
+}
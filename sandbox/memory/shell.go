@@ -0,0 +1,580 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// shell is a deliberately small POSIX-ish interpreter used for `sh -c`
+// strings. It understands quoting, $VAR / ${VAR} / $? / $$ / $(...)
+// expansion, `;`, `&&`, `||`, pipes, exec, and the common redirections. Control flow
+// (if/for/functions) is out of scope: every simple command goes through the
+// command table, so tests script behaviour with [Memory.Handle] rather than
+// with shell code.
+type shell struct {
+	c      *Cmd
+	env    map[string]string
+	dir    string
+	status int
+	exited bool
+}
+
+func newShell(c *Cmd) *shell {
+	env := make(map[string]string, len(c.Env))
+	for k, v := range c.Env {
+		env[k] = v
+	}
+	return &shell{c: c, env: env, dir: c.Dir}
+}
+
+// runScript executes script with c's environment and stdio and returns the
+// exit status of the last command.
+func runScript(ctx context.Context, c *Cmd, script string) int {
+	return newShell(c).run(ctx, script)
+}
+
+// command is one simple command: argv plus redirections.
+type command struct {
+	args   []string
+	redirs []redir
+}
+
+type redir struct {
+	op     string // ">", ">>", "<", "2>", "2>>", "2>&1", ">&2", "&>"
+	target string
+}
+
+// run executes a script, one and-or list element at a time so expansions
+// see variables exported by earlier commands.
+func (sh *shell) run(ctx context.Context, script string) int {
+	lx := &lexer{src: []rune(script), sh: sh, ctx: ctx}
+	skip := false
+	for {
+		lx.skip = skip
+		pipeline, sep, err := lx.pipeline()
+		if err != nil {
+			fmt.Fprintf(sh.c.Stderr, "sh: %v\n", err)
+			return 2
+		}
+		if !skip && len(pipeline) > 0 {
+			sh.status = sh.pipeline(ctx, pipeline)
+			if sh.exited {
+				return sh.status
+			}
+		}
+		switch sep {
+		case "":
+			return sh.status
+		case "&&":
+			skip = sh.status != 0
+		case "||":
+			skip = sh.status == 0
+		default:
+			skip = false
+		}
+	}
+}
+
+// pipeline runs commands left to right, buffering each stdout into the
+// next command's stdin.
+func (sh *shell) pipeline(ctx context.Context, cmds []command) int {
+	stdin := sh.c.Stdin
+	status := 0
+	for i, cmd := range cmds {
+		if i == len(cmds)-1 {
+			status = sh.simple(ctx, cmd, stdin, sh.c.Stdout)
+			break
+		}
+		var buf bytes.Buffer
+		sh.simple(ctx, cmd, stdin, &buf)
+		stdin = &buf
+	}
+	return status
+}
+
+// simple runs a single command with its assignments and redirections.
+func (sh *shell) simple(ctx context.Context, cmd command, stdin io.Reader, stdout io.Writer) int {
+	args := cmd.args
+	assign := map[string]string{}
+	for len(args) > 0 && isAssignment(args[0]) {
+		k, v, _ := strings.Cut(args[0], "=")
+		assign[k] = v
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		for k, v := range assign {
+			sh.env[k] = v
+		}
+		return 0
+	}
+
+	stderr := sh.c.Stderr
+	var files []pendingWrite
+	for _, r := range cmd.redirs {
+		switch r.op {
+		case "<":
+			b, err := sh.c.ReadFile(ctx, sh.abs(r.target))
+			if err != nil {
+				fmt.Fprintf(stderr, "sh: %s: No such file or directory\n", r.target)
+				return 1
+			}
+			stdin = bytes.NewReader(b)
+		case "2>&1":
+			stderr = stdout
+		case ">&2":
+			stdout = stderr
+		default:
+			w, pw := sh.redirectTarget(r)
+			if pw != nil {
+				files = append(files, *pw)
+			}
+			switch r.op {
+			case ">", ">>":
+				stdout = w
+			case "2>", "2>>":
+				stderr = w
+			case "&>":
+				stdout, stderr = w, w
+			}
+		}
+	}
+
+	status := sh.builtin(ctx, args, assign, stdin, stdout, stderr)
+	for _, pw := range files {
+		if err := pw.flush(ctx, sh); err != nil {
+			fmt.Fprintf(stderr, "sh: %s: %v\n", pw.path, err)
+			return 1
+		}
+	}
+	return status
+}
+
+// builtin handles the commands that must mutate shell state, and sends
+// everything else through the command table.
+func (sh *shell) builtin(ctx context.Context, args []string, assign map[string]string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// exec replaces the shell: run the command, then stop the script.
+	if args[0] == "exec" && len(args) > 1 {
+		args = args[1:]
+		sh.exited = true
+	}
+	switch args[0] {
+	case "cd":
+		dir := sh.env["HOME"]
+		if len(args) > 1 {
+			dir = sh.abs(args[1])
+		}
+		sh.dir = dir
+		return 0
+	case "export":
+		for _, a := range args[1:] {
+			if k, v, ok := strings.Cut(a, "="); ok {
+				sh.env[k] = v
+			}
+		}
+		return 0
+	case "unset":
+		for _, a := range args[1:] {
+			delete(sh.env, a)
+		}
+		return 0
+	case "set":
+		return 0
+	case "exit":
+		sh.exited = true
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return 2
+			}
+			return n
+		}
+		return sh.status
+	case "eval":
+		return sh.withStdio(stdin, stdout, stderr, func() int {
+			return sh.run(ctx, strings.Join(args[1:], " "))
+		})
+	}
+
+	c := sh.c.sub(args)
+	for k, v := range sh.env {
+		c.Env[k] = v
+	}
+	for k, v := range assign {
+		c.Env[k] = v
+	}
+	c.Dir = sh.dir
+	c.Stdin, c.Stdout, c.Stderr = stdin, stdout, stderr
+	return sh.c.Sandbox.dispatch(ctx, c)
+}
+
+// withStdio temporarily swaps the shell's stdio for fn.
+func (sh *shell) withStdio(stdin io.Reader, stdout, stderr io.Writer, fn func() int) int {
+	c := sh.c
+	sh.c = c.sub(c.Args)
+	sh.c.Stdin, sh.c.Stdout, sh.c.Stderr = stdin, stdout, stderr
+	defer func() { sh.c = c }()
+	return fn()
+}
+
+// pendingWrite buffers redirected output until the command finishes.
+type pendingWrite struct {
+	path   string
+	buf    *bytes.Buffer
+	append bool
+}
+
+func (pw pendingWrite) flush(ctx context.Context, sh *shell) error {
+	content := pw.buf.Bytes()
+	if pw.append {
+		if old, err := sh.c.ReadFile(ctx, pw.path); err == nil {
+			content = append(old, content...)
+		}
+	}
+	return sh.c.WriteFile(ctx, pw.path, content, 0o644)
+}
+
+// redirectTarget returns the writer for an output redirection. /dev/null
+// discards; anything else is buffered and written when the command ends.
+func (sh *shell) redirectTarget(r redir) (io.Writer, *pendingWrite) {
+	if r.target == "/dev/null" {
+		return io.Discard, nil
+	}
+	pw := &pendingWrite{
+		path:   sh.abs(r.target),
+		buf:    &bytes.Buffer{},
+		append: strings.HasSuffix(r.op, ">>"),
+	}
+	return pw.buf, pw
+}
+
+func (sh *shell) abs(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(sh.dir, p)
+}
+
+// substitute runs script in a subshell and returns its stdout with trailing
+// newlines removed, as $(...) does.
+func (sh *shell) substitute(ctx context.Context, script string) string {
+	var out bytes.Buffer
+	c := sh.c.sub(sh.c.Args)
+	c.Env, c.Dir = sh.env, sh.dir
+	c.Stdin, c.Stdout = strings.NewReader(""), &out
+	sub := newShell(c)
+	sh.status = sub.run(ctx, script)
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// isAssignment reports whether w has the form NAME=value.
+func isAssignment(w string) bool {
+	k, _, ok := strings.Cut(w, "=")
+	if !ok || k == "" {
+		return false
+	}
+	for i, r := range k {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// lexer turns script text into commands. Expansion happens during lexing,
+// against the shell's current environment.
+type lexer struct {
+	src  []rune
+	pos  int
+	sh   *shell
+	ctx  context.Context
+	skip bool // suppress command substitution for short-circuited commands
+}
+
+// pipeline reads commands up to the next list separator and returns them
+// along with that separator ("" at end of input).
+func (lx *lexer) pipeline() ([]command, string, error) {
+	var (
+		cmds []command
+		cur  command
+	)
+	for {
+		tok, op, err := lx.next()
+		if err != nil {
+			return nil, "", err
+		}
+		switch op {
+		case "":
+			cur.args = append(cur.args, tok)
+			continue
+		case "|":
+			if len(cur.args) == 0 {
+				return nil, "", fmt.Errorf("syntax error near unexpected token `|'")
+			}
+			cmds = append(cmds, cur)
+			cur = command{}
+			continue
+		case ">", ">>", "<", "2>", "2>>", "&>":
+			target, top, err := lx.next()
+			if err != nil {
+				return nil, "", err
+			}
+			if top != "" {
+				return nil, "", fmt.Errorf("syntax error near unexpected token `%s'", top)
+			}
+			cur.redirs = append(cur.redirs, redir{op: op, target: target})
+			continue
+		case "2>&1", ">&2":
+			cur.redirs = append(cur.redirs, redir{op: op})
+			continue
+		}
+
+		// List separator or end of input.
+		if len(cur.args) > 0 {
+			cmds = append(cmds, cur)
+		}
+		if op == "eof" {
+			op = ""
+		}
+		return cmds, op, nil
+	}
+}
+
+// next returns the next word (op == "") or operator. End of input is
+// reported as op "eof".
+func (lx *lexer) next() (string, string, error) {
+	// Skip blanks, line continuations and comments.
+	for lx.pos < len(lx.src) {
+		r := lx.src[lx.pos]
+		switch {
+		case r == ' ' || r == '\t' || r == '\r':
+			lx.pos++
+		case r == '\\' && lx.peek(1) == '\n':
+			lx.pos += 2
+		case r == '#':
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.pos++
+			}
+		default:
+			goto scan
+		}
+	}
+	return "", "eof", nil
+
+scan:
+	r := lx.src[lx.pos]
+	switch {
+	case r == '\n' || r == ';':
+		lx.pos++
+		return "", ";", nil
+	case r == '&' && lx.peek(1) == '&':
+		lx.pos += 2
+		return "", "&&", nil
+	case r == '&' && lx.peek(1) == '>':
+		lx.pos += 2
+		return "", "&>", nil
+	case r == '&':
+		// Background jobs run in the foreground.
+		lx.pos++
+		return "", ";", nil
+	case r == '|' && lx.peek(1) == '|':
+		lx.pos += 2
+		return "", "||", nil
+	case r == '|':
+		lx.pos++
+		return "", "|", nil
+	case r == '>' && lx.peek(1) == '&' && lx.peek(2) == '2':
+		lx.pos += 3
+		return "", ">&2", nil
+	case r == '>' && lx.peek(1) == '>':
+		lx.pos += 2
+		return "", ">>", nil
+	case r == '>':
+		lx.pos++
+		return "", ">", nil
+	case r == '<':
+		lx.pos++
+		return "", "<", nil
+	case r == '2' && lx.peek(1) == '>':
+		switch {
+		case lx.peek(2) == '&' && lx.peek(3) == '1':
+			lx.pos += 4
+			return "", "2>&1", nil
+		case lx.peek(2) == '>':
+			lx.pos += 3
+			return "", "2>>", nil
+		default:
+			lx.pos += 2
+			return "", "2>", nil
+		}
+	}
+	w, err := lx.word()
+	return w, "", err
+}
+
+// word reads one word, processing quotes, escapes and expansions.
+func (lx *lexer) word() (string, error) {
+	var b strings.Builder
+	for lx.pos < len(lx.src) {
+		r := lx.src[lx.pos]
+		switch {
+		case strings.ContainsRune(" \t\r\n;&|<>", r):
+			return b.String(), nil
+		case r == '\\':
+			lx.pos++
+			if lx.pos < len(lx.src) {
+				b.WriteRune(lx.src[lx.pos])
+				lx.pos++
+			}
+		case r == '\'':
+			end := lx.index('\'', lx.pos+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated quote")
+			}
+			b.WriteString(string(lx.src[lx.pos+1 : end]))
+			lx.pos = end + 1
+		case r == '"':
+			lx.pos++
+			if err := lx.doubleQuoted(&b); err != nil {
+				return "", err
+			}
+		case r == '$':
+			s, err := lx.dollar()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		default:
+			b.WriteRune(r)
+			lx.pos++
+		}
+	}
+	return b.String(), nil
+}
+
+// doubleQuoted reads up to the closing quote. Only $, backslash and the
+// quote itself are special.
+func (lx *lexer) doubleQuoted(b *strings.Builder) error {
+	for lx.pos < len(lx.src) {
+		r := lx.src[lx.pos]
+		switch r {
+		case '"':
+			lx.pos++
+			return nil
+		case '\\':
+			if n := lx.peek(1); n == '"' || n == '\\' || n == '$' || n == '`' {
+				b.WriteRune(n)
+				lx.pos += 2
+				continue
+			}
+			b.WriteRune(r)
+			lx.pos++
+		case '$':
+			s, err := lx.dollar()
+			if err != nil {
+				return err
+			}
+			b.WriteString(s)
+		default:
+			b.WriteRune(r)
+			lx.pos++
+		}
+	}
+	return fmt.Errorf("unterminated quote")
+}
+
+// dollar expands the $-expression at the current position.
+func (lx *lexer) dollar() (string, error) {
+	lx.pos++ // '$'
+	if lx.pos >= len(lx.src) {
+		return "$", nil
+	}
+	r := lx.src[lx.pos]
+	switch {
+	case r == '(':
+		end, err := lx.matchParen(lx.pos)
+		if err != nil {
+			return "", err
+		}
+		inner := string(lx.src[lx.pos+1 : end])
+		lx.pos = end + 1
+		if lx.skip {
+			return "", nil
+		}
+		return lx.sh.substitute(lx.ctx, inner), nil
+	case r == '{':
+		end := lx.index('}', lx.pos+1)
+		if end < 0 {
+			return "", fmt.Errorf("bad substitution")
+		}
+		name := string(lx.src[lx.pos+1 : end])
+		lx.pos = end + 1
+		if k, def, ok := strings.Cut(name, ":-"); ok {
+			if v := lx.sh.env[k]; v != "" {
+				return v, nil
+			}
+			return def, nil
+		}
+		return lx.sh.env[name], nil
+	case r == '?':
+		lx.pos++
+		return strconv.Itoa(lx.sh.status), nil
+	case r == '$':
+		lx.pos++
+		return strconv.Itoa(lx.sh.c.PID), nil
+	case r == '_' || unicode.IsLetter(r):
+		start := lx.pos
+		for lx.pos < len(lx.src) && (lx.src[lx.pos] == '_' || unicode.IsLetter(lx.src[lx.pos]) || unicode.IsDigit(lx.src[lx.pos])) {
+			lx.pos++
+		}
+		return lx.sh.env[string(lx.src[start:lx.pos])], nil
+	}
+	return "$", nil
+}
+
+// matchParen returns the index of the ')' closing the '(' at open, skipping
+// quoted sections.
+func (lx *lexer) matchParen(open int) (int, error) {
+	depth := 0
+	for i := open; i < len(lx.src); i++ {
+		switch lx.src[i] {
+		case '\'':
+			end := lx.index('\'', i+1)
+			if end < 0 {
+				return 0, fmt.Errorf("unterminated quote")
+			}
+			i = end
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated command substitution")
+}
+
+func (lx *lexer) peek(n int) rune {
+	if lx.pos+n < len(lx.src) {
+		return lx.src[lx.pos+n]
+	}
+	return 0
+}
+
+func (lx *lexer) index(r rune, from int) int {
+	for i := from; i < len(lx.src); i++ {
+		if lx.src[i] == r {
+			return i
+		}
+	}
+	return -1
+}
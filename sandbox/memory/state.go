@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/renameio/v2/maybe"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// state is everything the backend knows. It doubles as the on-disk JSON
+// wire format when a state file is configured.
+type state struct {
+	Instances map[string]*instance `json:"instances"`
+	NextAddr  int                  `json:"next_addr"`
+	LastStamp time.Time            `json:"last_stamp"`
+	Events    []loggedEvent        `json:"events,omitempty"` // newest last, see Watch
+	EventSeq  int64                `json:"event_seq"`
+}
+
+// instance is one in-memory container.
+type instance struct {
+	Name      string            `json:"name"`
+	Status    sandbox.Status    `json:"status"`
+	Address   string            `json:"address"`
+	Image     string            `json:"image"`
+	CPU       string            `json:"cpu"`
+	Memory    int64             `json:"memory"`
+	Disk      int64             `json:"disk,omitempty"`
+	Origin    string            `json:"origin,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	FS        fileSystem        `json:"fs"`
+	Snapshots []*snapshot       `json:"snapshots,omitempty"`
+	Policy    sandbox.Policy    `json:"policy"`
+	Forwards  []sandbox.Forward `json:"forwards,omitempty"`
+}
+
+// snapshot is a deep copy of an instance's filesystem at a point in time.
+type snapshot struct {
+	Label     string     `json:"label"`
+	CreatedAt time.Time  `json:"created_at"`
+	FS        fileSystem `json:"fs"`
+}
+
+func newState() *state {
+	return &state{Instances: make(map[string]*instance)}
+}
+
+// load replaces the in-memory state with the contents of the state file.
+// A missing file yields an empty state.
+func (m *Memory) load() error {
+	b, err := os.ReadFile(m.cfg.stateFile)
+	if isNotExist(err) {
+		m.state = newState()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading memory state: %w", err)
+	}
+	s := newState()
+	if err := json.Unmarshal(b, s); err != nil {
+		return fmt.Errorf("parsing memory state %s: %w", m.cfg.stateFile, err)
+	}
+	if s.Instances == nil {
+		s.Instances = make(map[string]*instance)
+	}
+	m.state = s
+	return nil
+}
+
+// save writes the state file atomically.
+func (m *Memory) save() error {
+	b, err := json.Marshal(m.state)
+	if err != nil {
+		return fmt.Errorf("encoding memory state: %w", err)
+	}
+	if err := maybe.WriteFile(m.cfg.stateFile, b, 0o600); err != nil {
+		return fmt.Errorf("writing memory state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// maxEvents bounds the event log kept in state. A watcher that falls
+// further behind than this misses the oldest events.
+const maxEvents = 256
+
+// watchInterval is how often Watch checks the event log. Polling the state
+// (rather than notifying in process) lets a watcher see events from other
+// processes sharing the state file.
+const watchInterval = 50 * time.Millisecond
+
+// loggedEvent is an entry in the state's event log. Seq increases by one
+// per event, so a watcher can tell which entries it has already seen.
+type loggedEvent struct {
+	Seq int64 `json:"seq"`
+	sandbox.Event
+}
+
+// emit appends an event to the log. It must be called from an update.
+func (s *state) emit(typ sandbox.EventType, name, snapshot string) {
+	s.EventSeq++
+	s.Events = append(s.Events, loggedEvent{
+		Seq:   s.EventSeq,
+		Event: sandbox.Event{Type: typ, Name: name, Snapshot: snapshot, Time: time.Now().UTC()},
+	})
+	if n := len(s.Events) - maxEvents; n > 0 {
+		s.Events = append(s.Events[:0:0], s.Events[n:]...)
+	}
+}
+
+// Watch polls the state's event log and calls fn with each new entry.
+func (m *Memory) Watch(ctx context.Context, fn func(sandbox.Event)) error {
+	var seen int64
+	if err := m.view(func(s *state) error {
+		seen = s.EventSeq
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		var events []sandbox.Event
+		err := m.view(func(s *state) error {
+			for _, e := range s.Events {
+				if e.Seq > seen {
+					events = append(events, e.Event)
+					seen = e.Seq
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fn(e)
+		}
+	}
+}
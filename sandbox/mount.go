@@ -0,0 +1,47 @@
+package sandbox
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ParseMount parses a "source:target[:ro|:rw]" spec such as
+// "/srv/data:/data:ro". The target must be absolute. The source is
+// returned as given: expanding ~ and relative paths is left to the caller,
+// which knows which machine they refer to.
+func ParseMount(spec string) (Mount, error) {
+	parts := strings.Split(spec, ":")
+	var m Mount
+	switch len(parts) {
+	case 3:
+		switch parts[2] {
+		case "ro":
+			m.ReadOnly = true
+		case "rw":
+		default:
+			return Mount{}, fmt.Errorf("invalid mount %q: mode must be ro or rw", spec)
+		}
+		fallthrough
+	case 2:
+		m.Source, m.Target = parts[0], parts[1]
+	default:
+		return Mount{}, fmt.Errorf("invalid mount %q: want source:target[:ro]", spec)
+	}
+	if m.Source == "" || !path.IsAbs(m.Target) {
+		return Mount{}, fmt.Errorf("invalid mount %q: want a source and an absolute target", spec)
+	}
+	m.Target = path.Clean(m.Target)
+	if m.Target == "/" {
+		return Mount{}, fmt.Errorf("invalid mount %q: cannot mount over /", spec)
+	}
+	return m, nil
+}
+
+// String formats m as a spec ParseMount accepts.
+func (m Mount) String() string {
+	if m.ReadOnly {
+		return m.Source + ":" + m.Target + ":ro"
+	}
+	return m.Source + ":" + m.Target
+}
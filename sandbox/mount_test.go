@@ -0,0 +1,35 @@
+package sandbox
+
+import "testing"
+
+func TestParseMount(t *testing.T) {
+	tests := map[string]Mount{
+		"/srv/data:/data":       {Source: "/srv/data", Target: "/data"},
+		"/srv/data:/data/:ro":   {Source: "/srv/data", Target: "/data", ReadOnly: true},
+		"~/code/app:/app:rw":    {Source: "~/code/app", Target: "/app"},
+		"./src:/home/pixel/src": {Source: "./src", Target: "/home/pixel/src"},
+	}
+	for spec, want := range tests {
+		got, err := ParseMount(spec)
+		if err != nil || got != want {
+			t.Errorf("ParseMount(%q) = %+v, %v, want %+v", spec, got, err, want)
+		}
+	}
+	for _, bad := range []string{"/srv", "/srv:", ":/data", "/srv:data", "/srv:/", "/srv:/data:rx", "/a:/b:ro:x"} {
+		if _, err := ParseMount(bad); err == nil {
+			t.Errorf("ParseMount(%q): want error", bad)
+		}
+	}
+}
+
+func TestMountString(t *testing.T) {
+	for _, spec := range []string{"/srv:/data", "/srv:/data:ro"} {
+		m, err := ParseMount(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.String() != spec {
+			t.Errorf("String() = %q, want %q", m.String(), spec)
+		}
+	}
+}
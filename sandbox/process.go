@@ -0,0 +1,258 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"al.essio.dev/pkg/shellescape"
+)
+
+// Process is a command started in the background with
+// [Exec.StartProcess]. It keeps running after the context passed to
+// StartProcess is done; use Kill to stop it.
+type Process interface {
+	// PID is the process ID inside the sandbox.
+	PID() int
+	// Wait blocks until the process exits or ctx is done and returns the
+	// exit code. A process ended by a signal reports 128+signal.
+	Wait(ctx context.Context) (exitCode int, err error)
+	// Exited reports the exit code without blocking; done is false while
+	// the process is still running.
+	Exited() (exitCode int, done bool)
+	// Signal delivers sig to the process (and its process group, where the
+	// backend supports it). Signalling an exited process returns
+	// os.ErrProcessDone.
+	Signal(ctx context.Context, sig syscall.Signal) error
+	// Kill sends SIGKILL.
+	Kill(ctx context.Context) error
+	// Stdout and Stderr return the output buffered so far. Only the most
+	// recent [ProcessOutputMax] bytes of each stream are kept.
+	Stdout() []byte
+	Stderr() []byte
+}
+
+// ProcessOutputMax bounds how much of each stream a [Process] buffers.
+const ProcessOutputMax = 1 << 20
+
+// OutputBuffer is a concurrency-safe writer that keeps the last max bytes
+// written to it.
+type OutputBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	max     int
+	dropped int64
+}
+
+// NewOutputBuffer returns a buffer holding at most max bytes.
+func NewOutputBuffer(max int) *OutputBuffer {
+	return &OutputBuffer{max: max}
+}
+
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.dropped += int64(over)
+	}
+	return len(p), nil
+}
+
+// Bytes returns a copy of the buffered output.
+func (b *OutputBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf)
+}
+
+// Dropped is the number of bytes discarded from the front of the stream.
+func (b *OutputBuffer) Dropped() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// RunFunc runs cmd to completion inside a sandbox, the shape of a blocking
+// [Exec.Run] call.
+type RunFunc func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error)
+
+// SignalFunc delivers sig to pid inside a sandbox.
+type SignalFunc func(ctx context.Context, pid int, sig syscall.Signal) error
+
+// RunInBackground implements [Exec.StartProcess] on top of a blocking run
+// function. The command is wrapped by [PIDWrap] so the first line of stdout
+// carries its PID; RunInBackground returns once that line arrives, or with
+// an error if the command ends (or ctx is done) first. A process whose start
+// is cancelled is killed once it reports its PID, since no caller holds it.
+func RunInBackground(ctx context.Context, cmd []string, run RunFunc, signal SignalFunc) (Process, error) {
+	p := &remoteProcess{
+		stdout: NewOutputBuffer(ProcessOutputMax),
+		stderr: NewOutputBuffer(ProcessOutputMax),
+		done:   make(chan struct{}),
+		signal: signal,
+	}
+	pw := &pidWriter{next: p.stdout, pid: make(chan int, 1)}
+
+	// The process outlives the caller's request, so detach from its
+	// cancellation while keeping its values.
+	go func() {
+		code, err := run(context.WithoutCancel(ctx), PIDWrap(cmd), pw, p.stderr)
+		p.code, p.err = code, err
+		close(p.done)
+	}()
+
+	select {
+	case pid := <-pw.pid:
+		p.pid = pid
+		return p, nil
+	case <-p.done:
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, fmt.Errorf("process exited with code %d before reporting its PID: %s", p.code, strings.TrimSpace(string(p.stderr.Bytes())))
+	case <-ctx.Done():
+		// Nothing will hold the process, so kill it once its PID arrives.
+		go func() {
+			select {
+			case pid := <-pw.pid:
+				_ = signal(context.WithoutCancel(ctx), pid, syscall.SIGKILL)
+			case <-p.done:
+			case <-time.After(abandonedPIDWait):
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// abandonedPIDWait is how long RunInBackground waits for the PID of a
+// process whose start was cancelled, to kill it.
+const abandonedPIDWait = 30 * time.Second
+
+// PIDWrap returns a single shell line that prints the shell's PID and then
+// execs cmd in its place, so the printed PID is the command's. A one-element
+// cmd is treated as a shell line, as [ExecOpts.Cmd] is everywhere else.
+func PIDWrap(cmd []string) []string {
+	body := shellescape.QuoteCommand(cmd)
+	if len(cmd) == 1 {
+		body = "sh -c " + shellescape.Quote(cmd[0])
+	}
+	return []string{"echo $$; exec " + body}
+}
+
+// KillCommand returns a shell line that signals pid's process group, falling
+// back to pid alone when it doesn't lead one.
+func KillCommand(pid int, sig syscall.Signal) []string {
+	return []string{fmt.Sprintf("kill -%d -- -%d 2>/dev/null || kill -%d -- %d", int(sig), pid, int(sig), pid)}
+}
+
+// signalNames maps the names [ParseSignal] accepts to signals.
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// ParseSignal parses a signal number or name ("TERM", "SIGTERM", "term").
+func ParseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(s), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal %q", s)
+}
+
+// remoteProcess is the [Process] returned by [RunInBackground].
+type remoteProcess struct {
+	pid    int
+	stdout *OutputBuffer
+	stderr *OutputBuffer
+	signal SignalFunc
+
+	done chan struct{}
+	code int
+	err  error
+}
+
+func (p *remoteProcess) PID() int { return p.pid }
+
+func (p *remoteProcess) Wait(ctx context.Context) (int, error) {
+	select {
+	case <-p.done:
+		return p.code, p.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (p *remoteProcess) Exited() (int, bool) {
+	select {
+	case <-p.done:
+		return p.code, true
+	default:
+		return 0, false
+	}
+}
+
+func (p *remoteProcess) Signal(ctx context.Context, sig syscall.Signal) error {
+	if _, done := p.Exited(); done {
+		return os.ErrProcessDone
+	}
+	if err := p.signal(ctx, p.pid, sig); err != nil {
+		if _, done := p.Exited(); done {
+			return os.ErrProcessDone
+		}
+		return fmt.Errorf("signalling process %d: %w", p.pid, err)
+	}
+	return nil
+}
+
+func (p *remoteProcess) Kill(ctx context.Context) error { return p.Signal(ctx, syscall.SIGKILL) }
+
+func (p *remoteProcess) Stdout() []byte { return p.stdout.Bytes() }
+func (p *remoteProcess) Stderr() []byte { return p.stderr.Bytes() }
+
+// pidWriter consumes the PID line PIDWrap prints and forwards everything
+// after it.
+type pidWriter struct {
+	next io.Writer
+	line []byte
+	pid  chan int
+	seen bool
+}
+
+func (w *pidWriter) Write(p []byte) (int, error) {
+	if w.seen {
+		return w.next.Write(p)
+	}
+	n := len(p)
+	i := bytes.IndexByte(p, '\n')
+	if i < 0 {
+		w.line = append(w.line, p...)
+		return n, nil
+	}
+	w.line = append(w.line, p[:i]...)
+	w.seen = true
+	pid, err := strconv.Atoi(strings.TrimSpace(string(w.line)))
+	if err != nil {
+		return 0, errors.New("process did not report a PID")
+	}
+	w.pid <- pid
+	if _, err := w.next.Write(p[i+1:]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,125 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOutputBufferKeepsTail(t *testing.T) {
+	b := NewOutputBuffer(4)
+	b.Write([]byte("ab"))
+	b.Write([]byte("cdef"))
+	if got := string(b.Bytes()); got != "cdef" {
+		t.Errorf("Bytes = %q, want cdef", got)
+	}
+	if b.Dropped() != 2 {
+		t.Errorf("Dropped = %d, want 2", b.Dropped())
+	}
+}
+
+func TestPIDWrap(t *testing.T) {
+	if got := PIDWrap([]string{"echo", "a b"})[0]; got != "echo $$; exec echo 'a b'" {
+		t.Errorf("PIDWrap(argv) = %q", got)
+	}
+	if got := PIDWrap([]string{"make && ./serve"})[0]; got != "echo $$; exec sh -c 'make && ./serve'" {
+		t.Errorf("PIDWrap(line) = %q", got)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for in, want := range map[string]syscall.Signal{"9": syscall.SIGKILL, "TERM": syscall.SIGTERM, "sigint": syscall.SIGINT} {
+		if got, err := ParseSignal(in); err != nil || got != want {
+			t.Errorf("ParseSignal(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseSignal("NOPE"); err == nil {
+		t.Error("ParseSignal(NOPE): want error")
+	}
+}
+
+func TestRunInBackground(t *testing.T) {
+	release := make(chan struct{})
+	run := func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error) {
+		io.WriteString(stdout, "42\nhello")
+		<-release
+		return 7, nil
+	}
+	var signalled syscall.Signal
+	signal := func(ctx context.Context, pid int, sig syscall.Signal) error {
+		signalled = sig
+		close(release)
+		return nil
+	}
+
+	ctx := context.Background()
+	p, err := RunInBackground(ctx, []string{"serve"}, run, signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.PID() != 42 || string(p.Stdout()) != "hello" {
+		t.Errorf("PID = %d, stdout = %q", p.PID(), p.Stdout())
+	}
+	if err := p.Kill(ctx); err != nil || signalled != syscall.SIGKILL {
+		t.Errorf("Kill = %v, signalled %v", err, signalled)
+	}
+	if rc, err := p.Wait(ctx); rc != 7 || err != nil {
+		t.Errorf("Wait = %d, %v", rc, err)
+	}
+	if err := p.Kill(ctx); !errors.Is(err, os.ErrProcessDone) {
+		t.Errorf("Kill after exit = %v, want os.ErrProcessDone", err)
+	}
+}
+
+func TestRunInBackgroundExitsEarly(t *testing.T) {
+	run := func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error) {
+		io.WriteString(stderr, "sh: nope: not found\n")
+		return 127, nil
+	}
+	_, err := RunInBackground(context.Background(), []string{"nope"}, run, nil)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("err = %v, want early-exit error with stderr", err)
+	}
+}
+
+func TestRunInBackgroundCancelledKills(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	killed, exit := make(chan int, 1), make(chan struct{})
+	run := func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error) {
+		close(started)
+		<-release
+		io.WriteString(stdout, "42\n")
+		<-exit
+		return 137, nil
+	}
+	signal := func(ctx context.Context, pid int, sig syscall.Signal) error {
+		if sig == syscall.SIGKILL {
+			killed <- pid
+			close(exit)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := RunInBackground(ctx, []string{"serve"}, run, signal); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	close(release)
+	select {
+	case pid := <-killed:
+		if pid != 42 {
+			t.Errorf("killed pid %d, want 42", pid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the abandoned process was not killed")
+	}
+}
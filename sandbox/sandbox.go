@@ -5,17 +5,12 @@ package sandbox
 
 import (
 	"context"
-	"errors"
 	"io"
 	"os"
+	"slices"
 	"time"
 )
 
-// ErrNotFound is returned (wrapped) by backend operations when the target
-// instance or snapshot does not exist. Callers can use errors.Is to
-// disambiguate from other errors.
-var ErrNotFound = errors.New("sandbox: not found")
-
 // Backend manages the lifecycle of sandbox instances and their snapshots.
 type Backend interface {
 	Create(ctx context.Context, opts CreateOpts) (*Instance, error)
@@ -24,12 +19,30 @@ type Backend interface {
 	Start(ctx context.Context, name string) error
 	Stop(ctx context.Context, name string) error
 	Delete(ctx context.Context, name string) error
+	// UpdateLimits changes an existing instance's resource limits, live
+	// where the backend allows. Backends that cannot resize the root disk
+	// return an error wrapping errors.ErrUnsupported when l.Disk is set.
+	UpdateLimits(ctx context.Context, name string, l Limits) error
+	// Stats samples a running instance's resource usage.
+	Stats(ctx context.Context, name string) (*Stats, error)
 
 	CreateSnapshot(ctx context.Context, name, label string) error
 	ListSnapshots(ctx context.Context, name string) ([]Snapshot, error)
 	DeleteSnapshot(ctx context.Context, name, label string) error
 	RestoreSnapshot(ctx context.Context, name, label string) error
 	CloneFrom(ctx context.Context, source, label, newName string) error
+	// ExportSnapshot writes name's snapshot label to w as a checkpoint
+	// archive (see [WriteExport]) that ImportSnapshot can restore on
+	// another host.
+	ExportSnapshot(ctx context.Context, name, label string, w io.Writer) error
+	// ImportSnapshot creates and starts newName from a checkpoint archive
+	// written by the same kind of backend. newName keeps the checkpoint
+	// under its original label and records it as its Origin.
+	ImportSnapshot(ctx context.Context, newName string, r io.Reader) error
+	// Watch calls fn with each lifecycle event on the backend's instances,
+	// one at a time, until ctx is done (returning nil) or the event source
+	// fails. Events from before Watch has subscribed are not replayed.
+	Watch(ctx context.Context, fn func(Event)) error
 
 	Capabilities() Capabilities
 	Close() error
@@ -38,6 +51,9 @@ type Backend interface {
 // Exec runs commands and interactive sessions inside a sandbox instance.
 type Exec interface {
 	Run(ctx context.Context, name string, opts ExecOpts) (exitCode int, err error)
+	// StartProcess starts a command without waiting for it. opts.Stdin,
+	// Stdout and Stderr are ignored; output is buffered on the [Process].
+	StartProcess(ctx context.Context, name string, opts ExecOpts) (Process, error)
 	Output(ctx context.Context, name string, cmd []string) ([]byte, error)
 	Console(ctx context.Context, name string, opts ConsoleOpts) error
 	Ready(ctx context.Context, name string, timeout time.Duration) error
@@ -51,6 +67,15 @@ type NetworkPolicy interface {
 	GetPolicy(ctx context.Context, name string) (*Policy, error)
 }
 
+// Forwarding exposes ports inside a sandbox instance on the host. Backends
+// without [Capabilities.PortForward] return an error wrapping
+// [errors.ErrUnsupported] from every method.
+type Forwarding interface {
+	AddForward(ctx context.Context, name string, f Forward) error
+	ListForwards(ctx context.Context, name string) ([]Forward, error)
+	RemoveForward(ctx context.Context, name, forward string) error
+}
+
 // FileEntry describes one entry in a ListFiles result.
 type FileEntry struct {
 	Path  string      `json:"path"`
@@ -69,6 +94,12 @@ type Files interface {
 	ReadFile(ctx context.Context, name, path string, maxBytes int64) (content []byte, truncated bool, err error)
 	ListFiles(ctx context.Context, name, path string, recursive bool) ([]FileEntry, error)
 	DeleteFile(ctx context.Context, name, path string) error
+	// WriteArchive extracts the tar stream r into dir, creating dir if
+	// needed. Entries keep the modes and numeric ownership in their headers.
+	WriteArchive(ctx context.Context, name, dir string, r io.Reader) error
+	// ReadArchive writes path (a file or a directory tree) to w as a tar
+	// stream whose entries are rooted at path's base name.
+	ReadArchive(ctx context.Context, name, path string, w io.Writer) error
 }
 
 // NoOwner is the sentinel for "leave default ownership" passed to
@@ -81,6 +112,7 @@ type Sandbox interface {
 	Exec
 	Files
 	NetworkPolicy
+	Forwarding
 }
 
 // Status represents a container's lifecycle state.
@@ -94,11 +126,20 @@ const (
 // IsRunning reports whether the container is in a running state.
 func (s Status) IsRunning() bool { return s == StatusRunning }
 
-// Instance is the backend-agnostic representation of a container.
+// Instance is the backend-agnostic representation of a container. Fields
+// other than Name and Status are zero when the backend can't report them.
 type Instance struct {
-	Name      string
-	Status    Status
-	Addresses []string
+	Name        string
+	Status      Status
+	Addresses   []string // IPv4
+	AddressesV6 []string // global IPv6; link-local addresses are left out
+	CreatedAt   time.Time
+	Image       string            // image the instance, or its clone source, was created from
+	Origin      string            // "source:label" for instances made by CloneFrom
+	CPU         string            // cores limit
+	Memory      int64             // memory limit in bytes
+	Egress      EgressMode        // as last set by pixels
+	Labels      map[string]string // user labels from CreateOpts.Labels
 }
 
 // Snapshot is a point-in-time capture of an instance's filesystem.
@@ -115,6 +156,62 @@ type CreateOpts struct {
 	CPU    string
 	Memory int64
 	Bare   bool // create instance only, skip provisioning and SSH wait
+	// Mounts attaches host directories. Backends without
+	// [Capabilities.Mounts] refuse a create that asks for any.
+	Mounts []Mount
+	// Labels are arbitrary key=value pairs kept with the instance; keys
+	// must pass [ValidateLabelKey]. Clones inherit their source's labels.
+	Labels map[string]string
+}
+
+// Limits are an instance's resource limits. Zero fields are left as they
+// are.
+type Limits struct {
+	CPU    string // cores, e.g. "4"
+	Memory int64  // bytes
+	Disk   int64  // root disk size in bytes
+}
+
+// Stats is a point-in-time sample of an instance's resource usage. CPU time
+// and network counters are cumulative since the instance started; fields a
+// backend cannot report are zero.
+type Stats struct {
+	CPUTime    time.Duration
+	Memory     int64 // bytes in use
+	MemoryPeak int64 // highest Memory seen
+	Disk       int64 // root filesystem bytes used
+	NetRX      int64 // bytes received, all interfaces but lo
+	NetTX      int64 // bytes sent, all interfaces but lo
+}
+
+// EventType is the kind of lifecycle change an [Event] reports.
+type EventType string
+
+const (
+	EventCreated         EventType = "created"
+	EventStarted         EventType = "started"
+	EventStopped         EventType = "stopped"
+	EventDeleted         EventType = "deleted"
+	EventSnapshotCreated EventType = "snapshot-created"
+	EventExecStarted     EventType = "exec-started"
+)
+
+// Event is a lifecycle change on an instance, as reported by
+// [Backend.Watch].
+type Event struct {
+	Type     EventType `json:"type"`
+	Name     string    `json:"name"`
+	Snapshot string    `json:"snapshot,omitempty"` // label, for EventSnapshotCreated
+	Time     time.Time `json:"time"`
+}
+
+// Mount attaches a host directory inside an instance. Source is a path on
+// the machine running the containers: the Incus or Docker host, or the
+// TrueNAS server.
+type Mount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
 }
 
 // ExecOpts holds parameters for running a command inside a sandbox.
@@ -133,19 +230,74 @@ type ConsoleOpts struct {
 	RemoteCmd []string
 }
 
-// EgressMode controls what network traffic a sandbox may initiate.
+// EgressMode controls what network traffic a sandbox may initiate. Besides
+// the modes below, it may name one or more egress presets separated by
+// commas, such as "agent,rust".
 type EgressMode string
 
 const (
 	EgressUnrestricted EgressMode = "unrestricted"
 	EgressAgent        EgressMode = "agent"
 	EgressAllowlist    EgressMode = "allowlist"
+	// EgressLearn allows all egress while recording where it goes, for
+	// building an allowlist from.
+	EgressLearn EgressMode = "learn"
 )
 
-// Policy describes the current egress policy for a sandbox instance.
+// PolicyVersion is the version of the Policy record backends store.
+const PolicyVersion = 1
+
+// Policy describes the current egress policy for a sandbox instance: its
+// mode and allowlist, and how the allowlist was arrived at. Backends record
+// a policy when it is applied and return that record, so it shows what the
+// instance was configured with even if its rules have since been changed
+// by hand. Version is 0 for a policy applied before records were kept, of
+// which only Mode and Domains are known.
 type Policy struct {
-	Mode    EgressMode
-	Domains []string
+	Version int        `json:"version"`
+	Mode    EgressMode `json:"mode"`
+	Presets []string   `json:"presets,omitempty"` // presets the allowlist started from
+	Allow   []string   `json:"allow,omitempty"`   // entries added to the presets'
+	Deny    []string   `json:"deny,omitempty"`    // preset entries since removed
+	Domains []string   `json:"domains,omitempty"` // the resulting allowlist
+	CIDRs   []string   `json:"cidrs,omitempty"`   // ranges the presets allow
+}
+
+// Add adds entry to the allowlist, recording it in Allow, or taking it off
+// Deny if it was a preset entry removed before.
+func (p *Policy) Add(entry string) {
+	if slices.Contains(p.Domains, entry) {
+		return
+	}
+	p.Domains = append(p.Domains, entry)
+	if i := slices.Index(p.Deny, entry); i >= 0 {
+		p.Deny = slices.Delete(p.Deny, i, i+1)
+	} else {
+		p.Allow = append(p.Allow, entry)
+	}
+}
+
+// Remove removes entry from the allowlist, reporting whether it was on it.
+// An entry that came from a preset is recorded in Deny.
+func (p *Policy) Remove(entry string) bool {
+	i := slices.Index(p.Domains, entry)
+	if i < 0 {
+		return false
+	}
+	p.Domains = slices.Delete(p.Domains, i, i+1)
+	if j := slices.Index(p.Allow, entry); j >= 0 {
+		p.Allow = slices.Delete(p.Allow, j, j+1)
+	} else {
+		p.Deny = append(p.Deny, entry)
+	}
+	return true
+}
+
+// Forward exposes a TCP port inside an instance on the host.
+type Forward struct {
+	Name   string // unique within the instance
+	Listen string // host address, e.g. "127.0.0.1:8080"
+	Port   int    // port inside the instance
 }
 
 // Capabilities advertises optional features a backend supports.
@@ -153,4 +305,6 @@ type Capabilities struct {
 	Snapshots     bool
 	CloneFrom     bool
 	EgressControl bool
+	PortForward   bool
+	Mounts        bool
 }
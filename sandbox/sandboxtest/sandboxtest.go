@@ -0,0 +1,1012 @@
+// Package sandboxtest is a conformance suite for [sandbox.Sandbox]
+// implementations. Every backend should pass [Run]; the MCP layer relies on
+// the behaviour it pins down (ErrNotFound wrapping, Ready semantics,
+// ReadFile truncation, snapshot ordering) being the same everywhere.
+//
+// Backends that talk to real infrastructure should gate the suite behind an
+// environment variable so plain `go test ./...` stays hermetic.
+package sandboxtest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+const (
+	// readyTimeout bounds Ready on an instance that should become ready.
+	readyTimeout = 3 * time.Minute
+	// stoppedTimeout bounds Ready on an instance that never will.
+	stoppedTimeout = 3 * time.Second
+	// ownerUID and ownerGID are the ownership used for WriteFile checks.
+	ownerUID, ownerGID = 1000, 1000
+)
+
+// Run exercises the sandbox built by f(cfg). Each subtest opens its own
+// backend and creates uniquely named instances, deleting them on cleanup.
+// Optional features are only checked when Capabilities advertises them;
+// features that are not advertised must fail rather than silently succeed.
+func Run(t *testing.T, f sandbox.Factory, cfg map[string]string) {
+	s := &suite{factory: f, cfg: cfg}
+	t.Run("Lifecycle", s.lifecycle)
+	t.Run("NotFound", s.notFound)
+	t.Run("ErrorKinds", s.errorKinds)
+	t.Run("Exec", s.exec)
+	t.Run("Processes", s.processes)
+	t.Run("Ready", s.ready)
+	t.Run("Files", s.files)
+	t.Run("ReadFileTruncation", s.readFileTruncation)
+	t.Run("Archives", s.archives)
+	t.Run("Snapshots", s.snapshots)
+	t.Run("CloneFrom", s.cloneFrom)
+	t.Run("ExportImport", s.exportImport)
+	t.Run("NetworkPolicy", s.networkPolicy)
+	t.Run("Forwards", s.forwards)
+	t.Run("Watch", s.watch)
+	t.Run("Capabilities", s.capabilities)
+}
+
+type suite struct {
+	factory sandbox.Factory
+	cfg     map[string]string
+}
+
+// open returns a fresh backend, closed when t finishes.
+func (s *suite) open(t *testing.T) sandbox.Sandbox {
+	t.Helper()
+	sb, err := s.factory(s.cfg)
+	if err != nil {
+		t.Fatalf("opening backend: %v", err)
+	}
+	t.Cleanup(func() { sb.Close() })
+	return sb
+}
+
+// suiteLabels are set on every instance the suite creates.
+var suiteLabels = map[string]string{"created-by": "sandboxtest"}
+
+// create makes a running instance with a unique name and registers its
+// deletion.
+func (s *suite) create(t *testing.T, sb sandbox.Sandbox) string {
+	t.Helper()
+	name := uniqueName()
+	inst, err := sb.Create(context.Background(), sandbox.CreateOpts{Name: name, Labels: suiteLabels})
+	t.Cleanup(func() { cleanup(sb, name) })
+	if err != nil {
+		t.Fatalf("Create(%s): %v", name, err)
+	}
+	if inst.Name != name {
+		t.Errorf("Create returned name %q, want %q", inst.Name, name)
+	}
+	if err := sb.Ready(context.Background(), name, readyTimeout); err != nil {
+		t.Fatalf("Ready(%s): %v", name, err)
+	}
+	return name
+}
+
+func cleanup(sb sandbox.Sandbox, name string) {
+	_ = sb.Delete(context.Background(), name)
+}
+
+func uniqueName() string {
+	return fmt.Sprintf("sbt-%08x", rand.Uint32())
+}
+
+func (s *suite) lifecycle(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+
+	wantStatus(t, sb, name, sandbox.StatusRunning)
+	if _, err := sb.Create(ctx, sandbox.CreateOpts{Name: name}); err == nil {
+		t.Error("Create with an existing name succeeded")
+	}
+	inst, err := sb.Get(ctx, name)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if inst.CreatedAt.IsZero() || inst.Image == "" {
+		t.Errorf("Get = %+v, want a creation time and image", inst)
+	}
+	if !maps.Equal(inst.Labels, suiteLabels) {
+		t.Errorf("labels = %v, want %v", inst.Labels, suiteLabels)
+	}
+
+	if err := sb.Stop(ctx, name); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	wantStatus(t, sb, name, sandbox.StatusStopped)
+
+	if err := sb.Start(ctx, name); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	wantStatus(t, sb, name, sandbox.StatusRunning)
+
+	if err := sb.UpdateLimits(ctx, name, sandbox.Limits{CPU: "1", Memory: 512 << 20}); err != nil {
+		t.Errorf("UpdateLimits: %v", err)
+	}
+	if st, err := sb.Stats(ctx, name); err != nil {
+		t.Errorf("Stats: %v", err)
+	} else if st.CPUTime < 0 || st.Memory < 0 || st.Disk < 0 {
+		t.Errorf("Stats = %+v, want no negative counters", st)
+	}
+	wantStatus(t, sb, name, sandbox.StatusRunning)
+
+	if err := sb.Delete(ctx, name); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := sb.Get(ctx, name); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if listed(t, sb, name) != nil {
+		t.Error("List still contains deleted instance")
+	}
+}
+
+// wantStatus checks Get and List agree that name has the given status.
+func wantStatus(t *testing.T, sb sandbox.Sandbox, name string, want sandbox.Status) {
+	t.Helper()
+	inst, err := sb.Get(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", name, err)
+	}
+	if inst.Name != name || inst.Status != want {
+		t.Errorf("Get(%s) = %s/%s, want %s/%s", name, inst.Name, inst.Status, name, want)
+	}
+	l := listed(t, sb, name)
+	if l == nil {
+		t.Fatalf("List does not contain %s", name)
+	}
+	if l.Status != want {
+		t.Errorf("List status of %s = %s, want %s", name, l.Status, want)
+	}
+}
+
+func listed(t *testing.T, sb sandbox.Sandbox, name string) *sandbox.Instance {
+	t.Helper()
+	all, err := sb.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for i := range all {
+		if all[i].Name == name {
+			return &all[i]
+		}
+	}
+	return nil
+}
+
+func (s *suite) notFound(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	caps := sb.Capabilities()
+	missing := uniqueName()
+
+	checks := []struct {
+		name string
+		skip bool
+		fn   func() error
+	}{
+		{"Get", false, func() error { _, err := sb.Get(ctx, missing); return err }},
+		{"Start", false, func() error { return sb.Start(ctx, missing) }},
+		{"Stop", false, func() error { return sb.Stop(ctx, missing) }},
+		{"Delete", false, func() error { return sb.Delete(ctx, missing) }},
+		{"Stats", false, func() error { _, err := sb.Stats(ctx, missing); return err }},
+		{"UpdateLimits", false, func() error { return sb.UpdateLimits(ctx, missing, sandbox.Limits{CPU: "1"}) }},
+		{"Run", false, func() error { _, err := sb.Run(ctx, missing, sandbox.ExecOpts{Cmd: []string{"true"}}); return err }},
+		{"Output", false, func() error { _, err := sb.Output(ctx, missing, []string{"true"}); return err }},
+		{"StartProcess", false, func() error {
+			_, err := sb.StartProcess(ctx, missing, sandbox.ExecOpts{Cmd: []string{"true"}})
+			return err
+		}},
+		{"Ready", false, func() error { return sb.Ready(ctx, missing, stoppedTimeout) }},
+		{"WriteFile", false, func() error {
+			return sb.WriteFile(ctx, missing, "/tmp/x", []byte("x"), 0o644, sandbox.NoOwner, sandbox.NoOwner)
+		}},
+		{"ReadFile", false, func() error { _, _, err := sb.ReadFile(ctx, missing, "/etc/hostname", 0); return err }},
+		{"ListFiles", false, func() error { _, err := sb.ListFiles(ctx, missing, "/tmp", false); return err }},
+		{"DeleteFile", false, func() error { return sb.DeleteFile(ctx, missing, "/tmp/x") }},
+		{"WriteArchive", false, func() error { return sb.WriteArchive(ctx, missing, "/tmp", emptyArchive()) }},
+		{"ReadArchive", false, func() error { return sb.ReadArchive(ctx, missing, "/etc", io.Discard) }},
+		{"CreateSnapshot", !caps.Snapshots, func() error { return sb.CreateSnapshot(ctx, missing, "s") }},
+		{"ListSnapshots", !caps.Snapshots, func() error { _, err := sb.ListSnapshots(ctx, missing); return err }},
+		{"DeleteSnapshot", !caps.Snapshots, func() error { return sb.DeleteSnapshot(ctx, missing, "s") }},
+		{"RestoreSnapshot", !caps.Snapshots, func() error { return sb.RestoreSnapshot(ctx, missing, "s") }},
+		{"CloneFrom", !caps.CloneFrom, func() error { return sb.CloneFrom(ctx, missing, "s", uniqueName()) }},
+		{"ExportSnapshot", !caps.Snapshots, func() error { return sb.ExportSnapshot(ctx, missing, "s", io.Discard) }},
+		{"SetEgressMode", !caps.EgressControl, func() error { return sb.SetEgressMode(ctx, missing, sandbox.EgressAllowlist) }},
+		{"AllowDomain", !caps.EgressControl, func() error { return sb.AllowDomain(ctx, missing, "example.com") }},
+		{"DenyDomain", !caps.EgressControl, func() error { return sb.DenyDomain(ctx, missing, "example.com") }},
+		{"GetPolicy", !caps.EgressControl, func() error { _, err := sb.GetPolicy(ctx, missing); return err }},
+		{"ListForwards", !caps.PortForward, func() error { _, err := sb.ListForwards(ctx, missing); return err }},
+		{"RemoveForward", !caps.PortForward, func() error { return sb.RemoveForward(ctx, missing, "80") }},
+	}
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			if c.skip {
+				t.Skip("capability not advertised")
+			}
+			if err := c.fn(); !errors.Is(err, sandbox.ErrNotFound) {
+				t.Errorf("err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+// errorKinds checks the other kinds callers act on. SnapshotInUse and
+// QuotaExceeded depend on the storage underneath, so where the operation
+// succeeds instead there is nothing to check; where it fails, the error
+// must carry the kind.
+func (s *suite) errorKinds(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	caps := sb.Capabilities()
+	name := s.create(t, sb)
+
+	t.Run("AlreadyExists", func(t *testing.T) {
+		if _, err := sb.Create(ctx, sandbox.CreateOpts{Name: name}); !errors.Is(err, sandbox.ErrAlreadyExists) {
+			t.Errorf("Create with an existing name = %v, want ErrAlreadyExists", err)
+		}
+		if !caps.Snapshots {
+			return
+		}
+		if err := sb.CreateSnapshot(ctx, name, "kinds"); err != nil {
+			t.Fatalf("CreateSnapshot: %v", err)
+		}
+		if err := sb.CreateSnapshot(ctx, name, "kinds"); !errors.Is(err, sandbox.ErrAlreadyExists) {
+			t.Errorf("CreateSnapshot with an existing label = %v, want ErrAlreadyExists", err)
+		}
+	})
+
+	t.Run("SnapshotInUse", func(t *testing.T) {
+		if !caps.Snapshots || !caps.CloneFrom {
+			t.Skip("CloneFrom not supported")
+		}
+		if err := sb.CreateSnapshot(ctx, name, "held"); err != nil {
+			t.Fatalf("CreateSnapshot: %v", err)
+		}
+		clone := uniqueName()
+		t.Cleanup(func() { cleanup(sb, clone) })
+		if err := sb.CloneFrom(ctx, name, "held", clone); err != nil {
+			t.Fatalf("CloneFrom: %v", err)
+		}
+		if err := sb.DeleteSnapshot(ctx, name, "held"); err != nil && !errors.Is(err, sandbox.ErrSnapshotInUse) {
+			t.Errorf("DeleteSnapshot of a cloned snapshot = %v, want nil or ErrSnapshotInUse", err)
+		}
+	})
+
+	t.Run("QuotaExceeded", func(t *testing.T) {
+		st, err := sb.Stats(ctx, name)
+		if err != nil {
+			t.Fatalf("Stats: %v", err)
+		}
+		if err := sb.UpdateLimits(ctx, name, sandbox.Limits{Disk: st.Disk + 1<<20}); err != nil {
+			t.Skipf("UpdateLimits(Disk): %v", err)
+		}
+		// Random bytes, so a compressing filesystem can't fit them.
+		blob := make([]byte, 4<<20)
+		rand.NewChaCha8([32]byte{}).Read(blob)
+		err = sb.WriteFile(ctx, name, "/var/tmp/sbt-quota.bin", blob, 0o644, sandbox.NoOwner, sandbox.NoOwner)
+		if err == nil {
+			t.Skip("disk size not enforced on writes")
+		}
+		if !errors.Is(err, sandbox.ErrQuotaExceeded) {
+			t.Errorf("WriteFile past the disk size = %v, want ErrQuotaExceeded", err)
+		}
+	})
+
+	t.Run("NotRunning", func(t *testing.T) {
+		if err := sb.Stop(ctx, name); err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+		if _, err := sb.Run(ctx, name, sandbox.ExecOpts{Cmd: []string{"true"}}); !errors.Is(err, sandbox.ErrNotRunning) {
+			t.Errorf("Run = %v, want ErrNotRunning", err)
+		}
+		if _, err := sb.Output(ctx, name, []string{"true"}); !errors.Is(err, sandbox.ErrNotRunning) {
+			t.Errorf("Output = %v, want ErrNotRunning", err)
+		}
+		if _, err := sb.StartProcess(ctx, name, sandbox.ExecOpts{Cmd: []string{"true"}}); !errors.Is(err, sandbox.ErrNotRunning) {
+			t.Errorf("StartProcess = %v, want ErrNotRunning", err)
+		}
+	})
+}
+
+func (s *suite) exec(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+
+	out, err := sb.Output(ctx, name, []string{"echo", "hello"})
+	if err != nil {
+		t.Fatalf("Output: %v", err)
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("Output = %q, want %q", out, "hello\n")
+	}
+	if _, err := sb.Output(ctx, name, []string{"false"}); err == nil {
+		t.Error("Output of a failing command returned nil error")
+	}
+
+	var stdout bytes.Buffer
+	rc, err := sb.Run(ctx, name, sandbox.ExecOpts{
+		Cmd:    []string{"sh", "-c", "echo $GREETING; exit 3"},
+		Env:    []string{"GREETING=hi"},
+		Stdout: &stdout,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if rc != 3 {
+		t.Errorf("Run exit code = %d, want 3", rc)
+	}
+	if stdout.String() != "hi\n" {
+		t.Errorf("Run stdout = %q, want %q", stdout.String(), "hi\n")
+	}
+}
+
+func (s *suite) processes(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+
+	p, err := sb.StartProcess(ctx, name, sandbox.ExecOpts{Cmd: []string{"sh", "-c", "echo out; echo err >&2; exit 4"}})
+	if err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+	if p.PID() <= 0 {
+		t.Errorf("PID = %d, want > 0", p.PID())
+	}
+	rc, err := p.Wait(ctx)
+	if err != nil || rc != 4 {
+		t.Errorf("Wait = %d, %v, want 4", rc, err)
+	}
+	if string(p.Stdout()) != "out\n" || string(p.Stderr()) != "err\n" {
+		t.Errorf("output = %q / %q, want out / err", p.Stdout(), p.Stderr())
+	}
+	if err := p.Signal(ctx, syscall.SIGTERM); !errors.Is(err, os.ErrProcessDone) {
+		t.Errorf("Signal after exit = %v, want os.ErrProcessDone", err)
+	}
+
+	p, err = sb.StartProcess(ctx, name, sandbox.ExecOpts{Cmd: []string{"sleep", "60"}})
+	if err != nil {
+		t.Fatalf("StartProcess(sleep): %v", err)
+	}
+	if _, done := p.Exited(); done {
+		t.Error("sleep exited immediately")
+	}
+	if err := p.Kill(ctx); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	wctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if rc, err := p.Wait(wctx); err != nil || rc != 128+int(syscall.SIGKILL) {
+		t.Errorf("Wait after Kill = %d, %v, want %d", rc, err, 128+int(syscall.SIGKILL))
+	}
+}
+
+func (s *suite) ready(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+
+	if err := sb.Stop(ctx, name); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := sb.Ready(ctx, name, stoppedTimeout); err == nil {
+		t.Error("Ready on a stopped instance returned nil")
+	} else if errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("Ready on a stopped instance = %v, want a non-ErrNotFound error", err)
+	}
+
+	if err := sb.Start(ctx, name); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := sb.Ready(ctx, name, readyTimeout); err != nil {
+		t.Errorf("Ready after Start: %v", err)
+	}
+}
+
+func (s *suite) files(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+	dir := "/tmp/sbt-files"
+	path := dir + "/nested/hello.txt"
+	content := []byte("hello, world\n")
+
+	if err := sb.WriteFile(ctx, name, path, content, 0o640, sandbox.NoOwner, sandbox.NoOwner); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, truncated, err := sb.ReadFile(ctx, name, path, 0)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, content) || truncated {
+		t.Errorf("ReadFile = %q (truncated=%v), want %q", got, truncated, content)
+	}
+	if owner := stat(t, sb, name, "%u:%g", path); owner != "0:0" {
+		t.Errorf("owner with NoOwner = %s, want 0:0", owner)
+	}
+
+	owned := dir + "/owned.txt"
+	if err := sb.WriteFile(ctx, name, owned, content, 0o600, ownerUID, ownerGID); err != nil {
+		t.Fatalf("WriteFile owned: %v", err)
+	}
+	if owner, want := stat(t, sb, name, "%u:%g", owned), fmt.Sprintf("%d:%d", ownerUID, ownerGID); owner != want {
+		t.Errorf("owner = %s, want %s", owner, want)
+	}
+
+	entries, err := sb.ListFiles(ctx, name, dir, false)
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if e := entry(entries, dir+"/nested"); e == nil || !e.IsDir {
+		t.Errorf("ListFiles(%s) = %+v, want nested directory", dir, entries)
+	}
+	if entry(entries, path) != nil {
+		t.Errorf("non-recursive ListFiles returned nested file: %+v", entries)
+	}
+
+	entries, err = sb.ListFiles(ctx, name, dir, true)
+	if err != nil {
+		t.Fatalf("ListFiles recursive: %v", err)
+	}
+	e := entry(entries, path)
+	if e == nil {
+		t.Fatalf("recursive ListFiles(%s) = %+v, missing %s", dir, entries, path)
+	}
+	if e.IsDir || e.Size != int64(len(content)) || e.Mode.Perm() != 0o640 {
+		t.Errorf("entry = %+v, want file of %d bytes, mode 0640", *e, len(content))
+	}
+
+	if err := sb.DeleteFile(ctx, name, path); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if _, _, err := sb.ReadFile(ctx, name, path, 0); err == nil {
+		t.Error("ReadFile after DeleteFile succeeded")
+	}
+	if err := sb.DeleteFile(ctx, name, path); err == nil {
+		t.Error("DeleteFile of a missing file succeeded")
+	}
+}
+
+// stat runs `stat -c format path` inside the instance.
+func stat(t *testing.T, sb sandbox.Sandbox, name, format, path string) string {
+	t.Helper()
+	out, err := sb.Output(context.Background(), name, []string{"stat", "-c", format, "--", path})
+	if err != nil {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func entry(entries []sandbox.FileEntry, path string) *sandbox.FileEntry {
+	for i := range entries {
+		if entries[i].Path == path {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *suite) readFileTruncation(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+	path := "/tmp/sbt-truncate.txt"
+	content := []byte("0123456789")
+
+	if err := sb.WriteFile(ctx, name, path, content, 0o644, sandbox.NoOwner, sandbox.NoOwner); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	tests := []struct {
+		maxBytes  int64
+		want      string
+		truncated bool
+	}{
+		{0, "0123456789", false},
+		{-1, "0123456789", false},
+		{100, "0123456789", false},
+		{10, "0123456789", false},
+		{9, "012345678", true},
+		{1, "0", true},
+	}
+	for _, tt := range tests {
+		got, truncated, err := sb.ReadFile(ctx, name, path, tt.maxBytes)
+		if err != nil {
+			t.Errorf("ReadFile(max=%d): %v", tt.maxBytes, err)
+			continue
+		}
+		if string(got) != tt.want || truncated != tt.truncated {
+			t.Errorf("ReadFile(max=%d) = %q, truncated=%v; want %q, %v", tt.maxBytes, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
+
+func (s *suite) archives(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+	dir := "/tmp/sbt-archive"
+	content := []byte("archived\n")
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range []*tar.Header{
+		{Name: "tree/", Typeflag: tar.TypeDir, Mode: 0o750, Uid: ownerUID, Gid: ownerGID},
+		{Name: "tree/sub/", Typeflag: tar.TypeDir, Mode: 0o755, Uid: ownerUID, Gid: ownerGID},
+		{Name: "tree/sub/a.txt", Typeflag: tar.TypeReg, Mode: 0o640, Size: int64(len(content)), Uid: ownerUID, Gid: ownerGID},
+	} {
+		h.ModTime = time.Now()
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write(content)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sb.WriteArchive(ctx, name, dir, &buf); err != nil {
+		t.Fatalf("WriteArchive: %v", err)
+	}
+	file := dir + "/tree/sub/a.txt"
+	got, _, err := sb.ReadFile(ctx, name, file, 0)
+	if err != nil {
+		t.Fatalf("ReadFile after WriteArchive: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("extracted content = %q, want %q", got, content)
+	}
+	if st, want := stat(t, sb, name, "%a %u:%g", file), fmt.Sprintf("640 %d:%d", ownerUID, ownerGID); st != want {
+		t.Errorf("extracted file = %s, want %s", st, want)
+	}
+	if st := stat(t, sb, name, "%a", dir+"/tree"); st != "750" {
+		t.Errorf("extracted directory mode = %s, want 750", st)
+	}
+
+	buf.Reset()
+	if err := sb.ReadArchive(ctx, name, dir+"/tree", &buf); err != nil {
+		t.Fatalf("ReadArchive: %v", err)
+	}
+	headers := map[string]*tar.Header{}
+	tr := tar.NewReader(&buf)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading archive: %v", err)
+		}
+		headers[h.Name] = h
+		if h.Name == "tree/sub/a.txt" {
+			if body, _ := io.ReadAll(tr); !bytes.Equal(body, content) {
+				t.Errorf("archived content = %q, want %q", body, content)
+			}
+		}
+	}
+	for _, n := range []string{"tree/", "tree/sub/", "tree/sub/a.txt"} {
+		if headers[n] == nil {
+			t.Errorf("archive is missing %s (has %v)", n, slices.Sorted(maps.Keys(headers)))
+		}
+	}
+	if h := headers["tree/sub/a.txt"]; h != nil && (h.Mode&0o777 != 0o640 || h.Uid != ownerUID) {
+		t.Errorf("archived file mode/uid = %o/%d, want 640/%d", h.Mode, h.Uid, ownerUID)
+	}
+
+	if err := sb.ReadArchive(ctx, name, dir+"/missing", io.Discard); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("ReadArchive of a missing path = %v, want ErrNotFound", err)
+	}
+}
+
+// emptyArchive returns a valid tar stream with no entries.
+func emptyArchive() io.Reader {
+	var buf bytes.Buffer
+	tar.NewWriter(&buf).Close()
+	return &buf
+}
+
+func (s *suite) snapshots(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	if !sb.Capabilities().Snapshots {
+		t.Skip("snapshots not supported")
+	}
+	name := s.create(t, sb)
+	path := "/tmp/sbt-snapshot.txt"
+
+	write(t, sb, name, path, "one")
+	if err := sb.CreateSnapshot(ctx, name, "first"); err != nil {
+		t.Fatalf("CreateSnapshot first: %v", err)
+	}
+	write(t, sb, name, path, "two")
+	if err := sb.CreateSnapshot(ctx, name, "second"); err != nil {
+		t.Fatalf("CreateSnapshot second: %v", err)
+	}
+	wantSnapshots(t, sb, name, "first", "second")
+
+	if err := sb.RestoreSnapshot(ctx, name, "first"); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if err := sb.Ready(ctx, name, readyTimeout); err != nil {
+		t.Fatalf("Ready after restore: %v", err)
+	}
+	wantStatus(t, sb, name, sandbox.StatusRunning)
+	if got := read(t, sb, name, path); got != "one" {
+		t.Errorf("after restore %s = %q, want %q", path, got, "one")
+	}
+	wantSnapshots(t, sb, name, "first", "second")
+
+	if err := sb.RestoreSnapshot(ctx, name, "missing"); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("RestoreSnapshot(missing) = %v, want ErrNotFound", err)
+	}
+	if err := sb.DeleteSnapshot(ctx, name, "first"); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	wantSnapshots(t, sb, name, "second")
+	if err := sb.DeleteSnapshot(ctx, name, "first"); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("DeleteSnapshot twice = %v, want ErrNotFound", err)
+	}
+}
+
+// wantSnapshots checks ListSnapshots returns exactly labels, oldest first.
+func wantSnapshots(t *testing.T, sb sandbox.Sandbox, name string, labels ...string) {
+	t.Helper()
+	snaps, err := sb.ListSnapshots(context.Background(), name)
+	if err != nil {
+		t.Fatalf("ListSnapshots: %v", err)
+	}
+	var got []string
+	for i, s := range snaps {
+		got = append(got, s.Label)
+		if i > 0 && s.CreatedAt.Before(snaps[i-1].CreatedAt) {
+			t.Errorf("snapshots not ordered by CreatedAt: %+v", snaps)
+		}
+	}
+	if !slices.Equal(got, labels) {
+		t.Errorf("snapshots = %v, want %v", got, labels)
+	}
+}
+
+func (s *suite) cloneFrom(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	if caps := sb.Capabilities(); !caps.CloneFrom || !caps.Snapshots {
+		t.Skip("CloneFrom not supported")
+	}
+	source := s.create(t, sb)
+	path := "/tmp/sbt-clone.txt"
+
+	write(t, sb, source, path, "base")
+	if err := sb.CreateSnapshot(ctx, source, "golden"); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+
+	missing := uniqueName()
+	if err := sb.CloneFrom(ctx, source, "missing", missing); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("CloneFrom(missing label) = %v, want ErrNotFound", err)
+	}
+	if _, err := sb.Get(ctx, missing); !errors.Is(err, sandbox.ErrNotFound) {
+		cleanup(sb, missing)
+		t.Errorf("failed CloneFrom left %s behind", missing)
+	}
+
+	clone := uniqueName()
+	t.Cleanup(func() { cleanup(sb, clone) })
+	if err := sb.CloneFrom(ctx, source, "golden", clone); err != nil {
+		t.Fatalf("CloneFrom: %v", err)
+	}
+	if err := sb.Ready(ctx, clone, readyTimeout); err != nil {
+		t.Fatalf("Ready(clone): %v", err)
+	}
+	wantStatus(t, sb, clone, sandbox.StatusRunning)
+	if inst, err := sb.Get(ctx, clone); err != nil {
+		t.Errorf("Get(clone): %v", err)
+	} else if inst.Origin != source+":golden" || !maps.Equal(inst.Labels, suiteLabels) {
+		t.Errorf("clone origin = %q, labels = %v; want %s:golden and the source's labels", inst.Origin, inst.Labels, source)
+	}
+	if got := read(t, sb, clone, path); got != "base" {
+		t.Errorf("clone %s = %q, want %q", path, got, "base")
+	}
+
+	write(t, sb, clone, path, "clone")
+	write(t, sb, source, path, "source")
+	if got := read(t, sb, clone, path); got != "clone" {
+		t.Errorf("clone sees source write: %q", got)
+	}
+	if got := read(t, sb, source, path); got != "source" {
+		t.Errorf("source sees clone write: %q", got)
+	}
+}
+
+func (s *suite) exportImport(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	if !sb.Capabilities().Snapshots {
+		t.Skip("snapshots not supported")
+	}
+	source := s.create(t, sb)
+	path := "/tmp/sbt-export.txt"
+
+	write(t, sb, source, path, "exported")
+	if err := sb.CreateSnapshot(ctx, source, "golden"); err != nil {
+		t.Fatalf("CreateSnapshot: %v", err)
+	}
+	if err := sb.ExportSnapshot(ctx, source, "missing", io.Discard); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("ExportSnapshot(missing label) = %v, want ErrNotFound", err)
+	}
+	var archive bytes.Buffer
+	if err := sb.ExportSnapshot(ctx, source, "golden", &archive); err != nil {
+		t.Fatalf("ExportSnapshot: %v", err)
+	}
+	write(t, sb, source, path, "after export")
+
+	if err := sb.ImportSnapshot(ctx, source, bytes.NewReader(archive.Bytes())); err == nil {
+		t.Errorf("ImportSnapshot over an existing instance succeeded")
+	}
+	if got := read(t, sb, source, path); got != "after export" {
+		t.Errorf("failed import changed the source: %s = %q", path, got)
+	}
+
+	imported := uniqueName()
+	t.Cleanup(func() { cleanup(sb, imported) })
+	if err := sb.ImportSnapshot(ctx, imported, bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatalf("ImportSnapshot: %v", err)
+	}
+	if err := sb.Ready(ctx, imported, readyTimeout); err != nil {
+		t.Fatalf("Ready(imported): %v", err)
+	}
+	wantStatus(t, sb, imported, sandbox.StatusRunning)
+	if inst, err := sb.Get(ctx, imported); err != nil {
+		t.Errorf("Get(imported): %v", err)
+	} else if inst.Origin != source+":golden" || !maps.Equal(inst.Labels, suiteLabels) {
+		t.Errorf("imported origin = %q, labels = %v; want %s:golden and the source's labels", inst.Origin, inst.Labels, source)
+	}
+	if got := read(t, sb, imported, path); got != "exported" {
+		t.Errorf("imported %s = %q, want %q", path, got, "exported")
+	}
+	wantSnapshots(t, sb, imported, "golden")
+	wantSnapshots(t, sb, source, "golden")
+}
+
+func write(t *testing.T, sb sandbox.Sandbox, name, path, content string) {
+	t.Helper()
+	if err := sb.WriteFile(context.Background(), name, path, []byte(content), 0o644, sandbox.NoOwner, sandbox.NoOwner); err != nil {
+		t.Fatalf("WriteFile(%s, %s): %v", name, path, err)
+	}
+}
+
+func read(t *testing.T, sb sandbox.Sandbox, name, path string) string {
+	t.Helper()
+	b, _, err := sb.ReadFile(context.Background(), name, path, 0)
+	if err != nil {
+		t.Fatalf("ReadFile(%s, %s): %v", name, path, err)
+	}
+	return string(b)
+}
+
+func (s *suite) networkPolicy(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	if !sb.Capabilities().EgressControl {
+		t.Skip("egress control not supported")
+	}
+	name := s.create(t, sb)
+
+	if err := sb.SetEgressMode(ctx, name, sandbox.EgressAllowlist); err != nil {
+		t.Fatalf("SetEgressMode(allowlist): %v", err)
+	}
+	if p := policy(t, sb, name); p.Mode != sandbox.EgressAllowlist {
+		t.Errorf("mode = %s, want allowlist", p.Mode)
+	}
+
+	if err := sb.AllowDomain(ctx, name, "sbt.example.com"); err != nil {
+		t.Fatalf("AllowDomain: %v", err)
+	}
+	if p := policy(t, sb, name); !slices.Contains(p.Domains, "sbt.example.com") {
+		t.Errorf("domains after AllowDomain = %v", p.Domains)
+	}
+	if err := sb.DenyDomain(ctx, name, "sbt.example.com"); err != nil {
+		t.Fatalf("DenyDomain: %v", err)
+	}
+	if p := policy(t, sb, name); slices.Contains(p.Domains, "sbt.example.com") {
+		t.Errorf("domains after DenyDomain = %v", p.Domains)
+	}
+	if err := sb.DenyDomain(ctx, name, "sbt.example.com"); err == nil {
+		t.Error("DenyDomain of an absent domain succeeded")
+	}
+
+	if err := sb.SetEgressMode(ctx, name, sandbox.EgressUnrestricted); err != nil {
+		t.Fatalf("SetEgressMode(unrestricted): %v", err)
+	}
+	if p := policy(t, sb, name); p.Mode != sandbox.EgressUnrestricted {
+		t.Errorf("mode = %s, want unrestricted", p.Mode)
+	}
+}
+
+func policy(t *testing.T, sb sandbox.Sandbox, name string) *sandbox.Policy {
+	t.Helper()
+	p, err := sb.GetPolicy(context.Background(), name)
+	if err != nil {
+		t.Fatalf("GetPolicy: %v", err)
+	}
+	return p
+}
+
+func (s *suite) forwards(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	if !sb.Capabilities().PortForward {
+		t.Skip("port forwarding not supported")
+	}
+	name := s.create(t, sb)
+
+	port := 20000 + rand.IntN(20000)
+	f := sandbox.Forward{Name: "sbt", Listen: fmt.Sprintf("127.0.0.1:%d", port), Port: 22}
+	if err := sb.AddForward(ctx, name, f); err != nil {
+		t.Fatalf("AddForward: %v", err)
+	}
+	if err := sb.AddForward(ctx, name, f); err == nil {
+		t.Error("AddForward with an existing name succeeded")
+	}
+	got, err := sb.ListForwards(ctx, name)
+	if err != nil {
+		t.Fatalf("ListForwards: %v", err)
+	}
+	if len(got) != 1 || got[0] != f {
+		t.Errorf("ListForwards = %+v, want [%+v]", got, f)
+	}
+
+	if err := sb.RemoveForward(ctx, name, f.Name); err != nil {
+		t.Fatalf("RemoveForward: %v", err)
+	}
+	if got, _ := sb.ListForwards(ctx, name); len(got) != 0 {
+		t.Errorf("ListForwards after remove = %+v", got)
+	}
+	if err := sb.RemoveForward(ctx, name, f.Name); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("RemoveForward of a missing forward = %v, want ErrNotFound", err)
+	}
+}
+
+// watchSettle is how long the watch subtest waits for Watch to subscribe
+// before acting; Watch has no ready signal.
+const watchSettle = time.Second
+
+// watch checks lifecycle changes made through the backend are reported.
+// Events may arrive in any order, and exec-started isn't checked since not
+// every backend can see execs.
+func (s *suite) watch(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	name := s.create(t, sb)
+
+	wctx, cancel := context.WithCancel(ctx)
+	events := make(chan sandbox.Event, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- sb.Watch(wctx, func(e sandbox.Event) {
+			if e.Name == name {
+				events <- e
+			}
+		})
+	}()
+	returned := false
+	defer func() {
+		cancel()
+		if returned {
+			return
+		}
+		if err := <-done; err != nil {
+			t.Errorf("Watch after cancel = %v, want nil", err)
+		}
+	}()
+	time.Sleep(watchSettle)
+
+	want := map[sandbox.EventType]bool{sandbox.EventStopped: true, sandbox.EventStarted: true, sandbox.EventDeleted: true}
+	if err := sb.Stop(ctx, name); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := sb.Start(ctx, name); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if sb.Capabilities().Snapshots {
+		want[sandbox.EventSnapshotCreated] = true
+		if err := sb.CreateSnapshot(ctx, name, "watched"); err != nil {
+			t.Fatalf("CreateSnapshot: %v", err)
+		}
+	}
+	if err := sb.Delete(ctx, name); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	timeout := time.After(readyTimeout)
+	for len(want) > 0 {
+		select {
+		case e := <-events:
+			if e.Type == sandbox.EventSnapshotCreated && e.Snapshot != "watched" {
+				t.Errorf("snapshot event = %+v, want snapshot %q", e, "watched")
+			}
+			if e.Time.IsZero() {
+				t.Errorf("event %+v has no time", e)
+			}
+			delete(want, e.Type)
+		case err := <-done:
+			returned = true
+			t.Fatalf("Watch returned early: %v", err)
+		case <-timeout:
+			t.Fatalf("no events for %v", slices.Collect(maps.Keys(want)))
+		}
+	}
+}
+
+// capabilities checks that features a backend does not advertise fail
+// loudly instead of pretending to work. Advertised features are covered by
+// the subtests above.
+func (s *suite) capabilities(t *testing.T) {
+	ctx := context.Background()
+	sb := s.open(t)
+	caps := sb.Capabilities()
+	if caps.Snapshots && caps.CloneFrom && caps.EgressControl && caps.PortForward && caps.Mounts {
+		t.Skip("all capabilities advertised")
+	}
+	name := s.create(t, sb)
+
+	if !caps.Snapshots {
+		if err := sb.CreateSnapshot(ctx, name, "unsupported"); err == nil {
+			t.Error("CreateSnapshot succeeded without the Snapshots capability")
+		}
+	}
+	if !caps.CloneFrom {
+		clone := uniqueName()
+		if err := sb.CloneFrom(ctx, name, "unsupported", clone); err == nil {
+			cleanup(sb, clone)
+			t.Error("CloneFrom succeeded without the CloneFrom capability")
+		}
+	}
+	if !caps.EgressControl {
+		if err := sb.SetEgressMode(ctx, name, sandbox.EgressAllowlist); err == nil {
+			t.Error("SetEgressMode succeeded without the EgressControl capability")
+		}
+	}
+	if !caps.PortForward {
+		f := sandbox.Forward{Name: "sbt", Listen: "127.0.0.1:0", Port: 80}
+		if err := sb.AddForward(ctx, name, f); err == nil {
+			t.Error("AddForward succeeded without the PortForward capability")
+		}
+	}
+	if !caps.Mounts {
+		other := uniqueName()
+		mount := sandbox.Mount{Source: t.TempDir(), Target: "/mnt/sbt"}
+		if _, err := sb.Create(ctx, sandbox.CreateOpts{Name: other, Mounts: []sandbox.Mount{mount}}); err == nil {
+			cleanup(sb, other)
+			t.Error("Create with a mount succeeded without the Mounts capability")
+		}
+	}
+}
+
+// Env returns the value of key, skipping t when it is unset. Backends use
+// it to gate the suite on real infrastructure.
+func Env(t *testing.T, key string) string {
+	t.Helper()
+	v := os.Getenv(key)
+	if v == "" {
+		t.Skipf("%s not set", key)
+	}
+	return v
+}
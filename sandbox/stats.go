@@ -0,0 +1,60 @@
+package sandbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsCommand returns a shell line that prints an instance's resource usage
+// from inside it, for backends that implement [Backend.Stats] over exec. It
+// reads the container's own cgroup v2 files, so it reports the container
+// rather than the host. Parse its output with [ParseStats].
+func StatsCommand() []string {
+	return []string{`cg=/sys/fs/cgroup
+echo "cpu_usec $(awk '$1 == "usage_usec" {print $2}' $cg/cpu.stat)"
+echo "memory $(cat $cg/memory.current)"
+echo "memory_peak $(cat $cg/memory.peak 2>/dev/null)"
+echo "disk $(df -P -B1 / | awk 'NR == 2 {print $3}')"
+sed 's/:/ /' /proc/net/dev | awk 'NR > 2 && $1 != "lo" {rx += $2; tx += $10} END {print "net", rx + 0, tx + 0}'`}
+}
+
+// ParseStats parses the output of [StatsCommand]. Missing values are left
+// zero, since not every kernel exposes memory.peak.
+func ParseStats(out []byte) (*Stats, error) {
+	var st Stats
+	var usec int64
+	fields := map[string][]*int64{
+		"cpu_usec":    {&usec},
+		"memory":      {&st.Memory},
+		"memory_peak": {&st.MemoryPeak},
+		"disk":        {&st.Disk},
+		"net":         {&st.NetRX, &st.NetTX},
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 || fields[f[0]] == nil {
+			continue
+		}
+		dst := fields[f[0]]
+		if len(f)-1 != len(dst) {
+			return nil, fmt.Errorf("parsing stats: malformed line %q", sc.Text())
+		}
+		for i, p := range dst {
+			v, err := strconv.ParseInt(f[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", f[0], err)
+			}
+			*p = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	st.CPUTime = time.Duration(usec) * time.Microsecond
+	return &st, nil
+}
@@ -0,0 +1,24 @@
+package sandbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStats(t *testing.T) {
+	out := "cpu_usec 2500000\nmemory 104857600\nmemory_peak \ndisk 4096\nnet 1000 200\n"
+	st, err := ParseStats([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{CPUTime: 2500 * time.Millisecond, Memory: 100 << 20, Disk: 4096, NetRX: 1000, NetTX: 200}
+	if *st != want {
+		t.Errorf("ParseStats = %+v, want %+v", *st, want)
+	}
+
+	for _, bad := range []string{"memory lots\n", "net 1000\n"} {
+		if _, err := ParseStats([]byte(bad)); err == nil {
+			t.Errorf("ParseStats(%q): want error", bad)
+		}
+	}
+}
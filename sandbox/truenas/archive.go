@@ -0,0 +1,38 @@
+package truenas
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// WriteArchive extracts a tar stream into dir by piping it to tar over
+// SSH, as root so recorded ownership is applied.
+func (t *TrueNAS) WriteArchive(ctx context.Context, name, dir string, r io.Reader) error {
+	return t.tar(ctx, name, dir, sandbox.ExtractCommand(dir), r, io.Discard)
+}
+
+// ReadArchive streams p out of the container through tar over SSH.
+func (t *TrueNAS) ReadArchive(ctx context.Context, name, p string, w io.Writer) error {
+	return t.tar(ctx, name, p, sandbox.ArchiveCommand(p), nil, w)
+}
+
+func (t *TrueNAS) tar(ctx context.Context, name, p string, cmd []string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	rc, err := t.Run(ctx, name, sandbox.ExecOpts{
+		Cmd:    cmd,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: &stderr,
+		Root:   true,
+	})
+	if err != nil {
+		return err
+	}
+	if rc != 0 {
+		return sandbox.ArchiveError(p, rc, stderr.String())
+	}
+	return nil
+}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"net/netip"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	tnapi "github.com/deevus/truenas-go"
 
+	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/provision"
 	"github.com/deevus/pixels/internal/retry"
 	"github.com/deevus/pixels/internal/ssh"
@@ -48,6 +52,14 @@ func (t *TrueNAS) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox
 	name := opts.Name
 	full := prefixed(name)
 
+	// The middleware rejects a taken name as a validation error, with no
+	// errno to tell it apart.
+	if _, err := t.lookup(ctx, name); err == nil {
+		return nil, fmt.Errorf("instance %s: %w", name, sandbox.ErrAlreadyExists)
+	} else if !errors.Is(err, sandbox.ErrNotFound) {
+		return nil, err
+	}
+
 	image := opts.Image
 	if image == "" {
 		image = t.cfg.image
@@ -61,12 +73,18 @@ func (t *TrueNAS) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox
 		memory = t.cfg.memory * 1024 * 1024 // MiB → bytes
 	}
 
+	egressMode := sandbox.EgressUnrestricted
+	if !opts.Bare && t.cfg.provision && t.cfg.egress != "" {
+		egressMode = sandbox.EgressMode(t.cfg.egress)
+	}
 	createOpts := CreateInstanceOpts{
-		Name:      full,
-		Image:     image,
-		CPU:       cpu,
-		Memory:    memory,
-		Autostart: true,
+		Name:        full,
+		Image:       image,
+		CPU:         cpu,
+		Memory:      memory,
+		Autostart:   true,
+		Mounts:      opts.Mounts,
+		Environment: metadataEnv(image, egressMode, opts.Labels, time.Now()),
 	}
 
 	// Resolve NIC: config override or auto-detect.
@@ -84,16 +102,15 @@ func (t *TrueNAS) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox
 
 	instance, err := t.client.CreateInstance(ctx, createOpts)
 	if err != nil {
-		return nil, fmt.Errorf("creating instance: %w", err)
+		return nil, wrapError(fmt.Errorf("creating instance: %w", err))
+	}
+	if err := t.writePolicy(ctx, name, egress.NewPolicy(egressMode, t.cfg.allow)); err != nil {
+		return nil, err
 	}
 
 	// Bare mode: return immediately without provisioning or waiting.
 	if opts.Bare {
-		return &sandbox.Instance{
-			Name:      name,
-			Status:    sandbox.Status(instance.Status),
-			Addresses: collectAddresses(instance.Aliases),
-		}, nil
+		return toInstance(instance), nil
 	}
 
 	// Provision if enabled.
@@ -113,6 +130,13 @@ func (t *TrueNAS) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox
 		if len(steps) > 0 {
 			provOpts.ProvisionScript = provision.Script(steps)
 		}
+		if t.cfg.dnsFilter && t.cfg.egress != string(sandbox.EgressUnrestricted) {
+			bin, err := egress.DNSFilterBinary()
+			if err != nil {
+				t.warnf("egress DNS filter for %s: %v", name, err)
+			}
+			provOpts.DNSFilter = bin
+		}
 
 		needsProvision := pubKey != "" || len(t.cfg.dns) > 0 ||
 			len(t.cfg.env) > 0 || t.cfg.devtools
@@ -135,7 +159,7 @@ func (t *TrueNAS) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox
 	if err := retry.Poll(ctx, time.Second, 15*time.Second, func(ctx context.Context) (bool, error) {
 		inst, err := t.client.Virt.GetInstance(ctx, full)
 		if err != nil {
-			return false, fmt.Errorf("refreshing instance: %w", err)
+			return false, wrapError(fmt.Errorf("refreshing instance: %w", err))
 		}
 		instance = inst
 		return ipFromAliases(inst.Aliases) != "", nil
@@ -150,21 +174,17 @@ func (t *TrueNAS) Create(ctx context.Context, opts sandbox.CreateOpts) (*sandbox
 		t.clearAndRefreshHostKey(ctx, name, ip, full, 90*time.Second)
 	}
 
-	return &sandbox.Instance{
-		Name:      name,
-		Status:    sandbox.Status(instance.Status),
-		Addresses: collectAddresses(instance.Aliases),
-	}, nil
+	return toInstance(instance), nil
 }
 
 // Get returns a single instance by bare name.
 func (t *TrueNAS) Get(ctx context.Context, name string) (*sandbox.Instance, error) {
 	inst, err := t.client.Virt.GetInstance(ctx, prefixed(name))
 	if err != nil {
-		return nil, sandbox.WrapNotFound(fmt.Errorf("getting %s: %w", name, err))
+		return nil, wrapLookupError(fmt.Errorf("getting %s: %w", name, err))
 	}
 	if inst == nil {
-		return nil, sandbox.WrapNotFound(fmt.Errorf("instance %q not found", name))
+		return nil, fmt.Errorf("instance %q: %w", name, sandbox.ErrNotFound)
 	}
 	return toInstance(inst), nil
 }
@@ -177,11 +197,7 @@ func (t *TrueNAS) List(ctx context.Context) ([]sandbox.Instance, error) {
 	}
 	result := make([]sandbox.Instance, len(instances))
 	for i, inst := range instances {
-		result[i] = sandbox.Instance{
-			Name:      unprefixed(inst.Name),
-			Status:    sandbox.Status(inst.Status),
-			Addresses: collectAddresses(inst.Aliases),
-		}
+		result[i] = *toInstance(&inst)
 	}
 	return result, nil
 }
@@ -190,13 +206,13 @@ func (t *TrueNAS) List(ctx context.Context) ([]sandbox.Instance, error) {
 func (t *TrueNAS) Start(ctx context.Context, name string) error {
 	full := prefixed(name)
 	if err := t.client.Virt.StartInstance(ctx, full); err != nil {
-		return fmt.Errorf("starting %s: %w", name, err)
+		return wrapError(fmt.Errorf("starting %s: %w", name, err))
 	}
 
 	// Get instance and wait for SSH.
-	inst, err := t.client.Virt.GetInstance(ctx, full)
+	inst, err := t.lookup(ctx, name)
 	if err != nil {
-		return fmt.Errorf("refreshing %s: %w", name, err)
+		return wrapError(fmt.Errorf("refreshing %s: %w", name, err))
 	}
 
 	ip := ipFromAliases(inst.Aliases)
@@ -208,10 +224,14 @@ func (t *TrueNAS) Start(ctx context.Context, name string) error {
 
 // Stop stops a running instance. No-ops if the instance is already stopped.
 func (t *TrueNAS) Stop(ctx context.Context, name string) error {
+	// StopInstanceIfRunning swallows a missing instance; surface it here.
+	if _, err := t.lookup(ctx, name); err != nil {
+		return err
+	}
 	if err := t.client.StopInstanceIfRunning(ctx, prefixed(name), tnapi.StopVirtInstanceOpts{
 		Timeout: stopTimeoutSeconds,
 	}); err != nil {
-		return fmt.Errorf("stopping %s: %w", name, err)
+		return wrapError(fmt.Errorf("stopping %s: %w", name, err))
 	}
 	return nil
 }
@@ -229,8 +249,8 @@ func (t *TrueNAS) Delete(ctx context.Context, name string) error {
 	// If the instance is already gone, short-circuit with ErrNotFound so
 	// callers (e.g. MCP DestroySandbox) can clean up their state idempotently.
 	inst, getErr := t.client.Virt.GetInstance(ctx, full)
-	if inst == nil || errors.Is(sandbox.WrapNotFound(getErr), sandbox.ErrNotFound) {
-		return sandbox.WrapNotFound(fmt.Errorf("instance %q does not exist", name))
+	if inst == nil || errors.Is(wrapLookupError(getErr), sandbox.ErrNotFound) {
+		return fmt.Errorf("instance %q: %w", name, sandbox.ErrNotFound)
 	}
 	ip := ipFromAliases(inst.Aliases)
 
@@ -238,33 +258,88 @@ func (t *TrueNAS) Delete(ctx context.Context, name string) error {
 	if err := retry.Do(ctx, 3, 2*time.Second, func(ctx context.Context) error {
 		return t.client.Virt.DeleteInstance(ctx, full)
 	}); err != nil {
-		return fmt.Errorf("deleting %s: %w", name, err)
+		return wrapError(fmt.Errorf("deleting %s: %w", name, err))
 	}
 
-	// Clean up known_hosts entries for the now-dead container.
+	// Clean up known_hosts entries and tunnels for the now-dead container.
 	t.clearKnownHosts(ip, full)
+	t.stopForwards(name)
 	return nil
 }
 
-// CreateSnapshot creates a ZFS snapshot for the named instance.
+// UpdateLimits changes CPU and memory through virt.instance.update, which
+// applies them to a running container. TrueNAS exposes no root disk size
+// for containers, so Disk is unsupported.
+func (t *TrueNAS) UpdateLimits(ctx context.Context, name string, l sandbox.Limits) error {
+	if l.Disk > 0 {
+		return fmt.Errorf("resizing the root disk: %w", errors.ErrUnsupported)
+	}
+	full := prefixed(name)
+	inst, err := t.client.Virt.GetInstance(ctx, full)
+	if err != nil {
+		return wrapLookupError(fmt.Errorf("getting %s: %w", name, err))
+	}
+	if inst == nil {
+		return fmt.Errorf("instance %q: %w", name, sandbox.ErrNotFound)
+	}
+	if err := t.client.UpdateInstanceLimits(ctx, full, l.CPU, l.Memory); err != nil {
+		return wrapError(fmt.Errorf("updating limits on %s: %w", name, err))
+	}
+	return nil
+}
+
+// Stats reads the container's usage on the host, where the container
+// can't change it: see hostStats. With stats_over_ssh set, a host that
+// won't serve those reads falls back to running sandbox.StatsCommand in
+// the container over SSH, whose numbers the container reports itself.
+func (t *TrueNAS) Stats(ctx context.Context, name string) (*sandbox.Stats, error) {
+	if _, err := t.ensureRunning(ctx, name); err != nil {
+		return nil, err
+	}
+	st, err := t.hostStats(ctx, name)
+	if err == nil || !t.cfg.statsOverSSH {
+		return st, wrapError(err)
+	}
+	return t.sshStats(ctx, name)
+}
+
+// sshStats reads the container's cgroup and network counters from inside
+// it over SSH, as root.
+func (t *TrueNAS) sshStats(ctx context.Context, name string) (*sandbox.Stats, error) {
+	cc := ssh.NewConnConfig(prefixed(name), "root", t.cfg.sshKey, t.cfg.knownHosts)
+	out, err := t.ssh.OutputQuiet(ctx, cc, sandbox.StatsCommand())
+	if err != nil {
+		return nil, fmt.Errorf("reading stats for %s over SSH: %w", name, err)
+	}
+	return sandbox.ParseStats(out)
+}
+
+// CreateSnapshot creates a ZFS snapshot for the named instance and copies
+// its egress policy record onto the snapshot.
 func (t *TrueNAS) CreateSnapshot(ctx context.Context, name, label string) error {
-	ds, err := t.resolveDataset(ctx, name)
+	ds, err := t.instanceDataset(ctx, name)
 	if err != nil {
 		return err
 	}
+	// A clash comes back from ZFS as a plain failure, so check first.
+	if err := t.requireSnapshot(ctx, ds, label); err == nil {
+		return fmt.Errorf("snapshot %s@%s: %w", ds, label, sandbox.ErrAlreadyExists)
+	} else if !errors.Is(err, sandbox.ErrNotFound) {
+		return err
+	}
 	_, err = t.client.Snapshot.Create(ctx, tnapi.CreateSnapshotOpts{
 		Dataset: ds,
 		Name:    label,
 	})
 	if err != nil {
-		return fmt.Errorf("creating snapshot: %w", err)
+		return wrapError(fmt.Errorf("creating snapshot: %w", err))
 	}
-	return nil
+	return t.copyPolicy(ctx, ds, ds+"@"+label)
 }
 
 // ListSnapshots returns all snapshots for the named instance.
 func (t *TrueNAS) ListSnapshots(ctx context.Context, name string) ([]sandbox.Snapshot, error) {
-	ds, err := t.resolveDataset(ctx, name)
+	ds, err := t.instanceDataset(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -272,54 +347,68 @@ func (t *TrueNAS) ListSnapshots(ctx context.Context, name string) ([]sandbox.Sna
 	if err != nil {
 		return nil, err
 	}
+	times, err := t.client.SnapshotTimes(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	// Order by CreateTXG, which ZFS assigns in creation order; creation
+	// times only have one-second resolution.
+	txg := func(s tnapi.Snapshot) int64 {
+		n, _ := strconv.ParseInt(s.CreateTXG, 10, 64)
+		return n
+	}
+	sort.SliceStable(snaps, func(a, b int) bool { return txg(snaps[a]) < txg(snaps[b]) })
 	result := make([]sandbox.Snapshot, len(snaps))
 	for i, s := range snaps {
-		// TrueNAS doesn't expose ZFS creation time via truenas-go; synthesize from CreateTXG for monotonic ordering. Not real wall-clock time.
-		var createdAt time.Time
-		if txg, err := strconv.ParseInt(s.CreateTXG, 10, 64); err == nil {
-			createdAt = time.Unix(txg, 0).UTC()
-		}
 		result[i] = sandbox.Snapshot{
 			Label:     s.SnapshotName,
 			Size:      s.Referenced,
-			CreatedAt: createdAt,
+			CreatedAt: times[s.SnapshotName], // zero, so retention keeps it, if unknown
 		}
 	}
 	return result, nil
 }
 
-
 // DeleteSnapshot deletes a ZFS snapshot by label.
 func (t *TrueNAS) DeleteSnapshot(ctx context.Context, name, label string) error {
-	ds, err := t.resolveDataset(ctx, name)
+	ds, err := t.instanceDataset(ctx, name)
 	if err != nil {
 		return err
 	}
-	return t.client.Snapshot.Delete(ctx, ds+"@"+label)
+	if err := t.client.Snapshot.Delete(ctx, ds+"@"+label); err != nil {
+		return wrapError(fmt.Errorf("deleting snapshot %s: %w", label, err))
+	}
+	return nil
 }
 
-// RestoreSnapshot rolls back to the given snapshot: stop, rollback, start,
-// poll IP, SSH wait.
+// RestoreSnapshot rolls back to the given snapshot: stop, rollback, restore
+// the snapshot's egress policy record, start, poll IP, SSH wait.
 func (t *TrueNAS) RestoreSnapshot(ctx context.Context, name, label string) error {
 	full := prefixed(name)
-	ds, err := t.resolveDataset(ctx, name)
+	ds, err := t.instanceDataset(ctx, name)
 	if err != nil {
 		return err
 	}
+	if err := t.requireSnapshot(ctx, ds, label); err != nil {
+		return err
+	}
 
 	if err := t.client.StopInstanceIfRunning(ctx, full, tnapi.StopVirtInstanceOpts{Timeout: stopTimeoutSeconds}); err != nil {
-		return fmt.Errorf("stopping %s: %w", name, err)
+		return wrapError(fmt.Errorf("stopping %s: %w", name, err))
 	}
 	if err := t.client.SnapshotRollback(ctx, ds+"@"+label); err != nil {
+		return wrapError(err)
+	}
+	if err := t.copyPolicy(ctx, ds+"@"+label, ds); err != nil {
 		return err
 	}
 	if err := t.client.Virt.StartInstance(ctx, full); err != nil {
-		return fmt.Errorf("starting %s: %w", name, err)
+		return wrapError(fmt.Errorf("starting %s: %w", name, err))
 	}
 
-	inst, err := t.client.Virt.GetInstance(ctx, full)
+	inst, err := t.lookup(ctx, name)
 	if err != nil {
-		return fmt.Errorf("refreshing %s: %w", name, err)
+		return wrapError(fmt.Errorf("refreshing %s: %w", name, err))
 	}
 
 	ip := ipFromAliases(inst.Aliases)
@@ -330,21 +419,66 @@ func (t *TrueNAS) RestoreSnapshot(ctx context.Context, name, label string) error
 }
 
 // CloneFrom clones a source container's snapshot into a new container.
-// CloneFrom creates newName as an independent copy of source@label.
+// CloneFrom creates newName as an independent copy of source@label,
+// with the egress policy record taken with the snapshot.
 func (t *TrueNAS) CloneFrom(ctx context.Context, source, label, newName string) error {
 	// Get source instance to copy its resource limits.
-	src, err := t.client.Virt.GetInstance(ctx, prefixed(source))
+	src, err := t.lookup(ctx, source)
 	if err != nil {
-		return fmt.Errorf("getting source %s: %w", source, err)
+		return wrapError(fmt.Errorf("getting source %s: %w", source, err))
 	}
 
-	// Create a bare container with matching resource limits.
+	// Resolve and check the snapshot before creating anything, so a bad
+	// label doesn't leave an empty clone shell behind.
+	ds, err := t.resolveDataset(ctx, source)
+	if err != nil {
+		return err
+	}
+	if err := t.requireSnapshot(ctx, ds, label); err != nil {
+		return err
+	}
+
+	// Create a bare container with matching resource limits and metadata.
+	env := maps.Clone(src.Environment)
+	if env == nil {
+		env = map[string]string{}
+	}
+	env[envOrigin] = source + ":" + label
+	env[envCreated] = time.Now().UTC().Format(time.RFC3339)
+	if err := t.createShell(ctx, newName, src.CPU, src.Memory, env); err != nil {
+		return err
+	}
+
+	// Replace root filesystem with a ZFS clone of the snapshot.
+	if err := t.client.ReplaceContainerRootfs(ctx, prefixed(newName), ds+"@"+label); err != nil {
+		return wrapError(fmt.Errorf("replacing rootfs: %w", err))
+	}
+	newDS, err := t.resolveDataset(ctx, newName)
+	if err != nil {
+		return err
+	}
+	if err := t.copyPolicy(ctx, ds+"@"+label, newDS); err != nil {
+		return err
+	}
+
+	// Start the clone.
+	if err := t.client.Virt.StartInstance(ctx, prefixed(newName)); err != nil {
+		return wrapError(fmt.Errorf("starting clone: %w", err))
+	}
+
+	return nil
+}
+
+// createShell creates a stopped container whose rootfs is about to be
+// replaced, with the given limits and environment and the configured NIC.
+func (t *TrueNAS) createShell(ctx context.Context, name, cpu string, memory int64, env map[string]string) error {
 	createOpts := CreateInstanceOpts{
-		Name:      prefixed(newName),
-		Image:     t.cfg.image, // irrelevant; rootfs gets replaced
-		CPU:       src.CPU,
-		Memory:    src.Memory,
-		Autostart: false,
+		Name:        prefixed(name),
+		Image:       t.cfg.image, // irrelevant; rootfs gets replaced
+		CPU:         cpu,
+		Memory:      memory,
+		Autostart:   false,
+		Environment: env,
 	}
 	if t.cfg.nicType != "" {
 		createOpts.NIC = &NICOpts{
@@ -359,29 +493,14 @@ func (t *TrueNAS) CloneFrom(ctx context.Context, source, label, newName string)
 	}
 
 	if _, err := t.client.CreateInstance(ctx, createOpts); err != nil {
-		return fmt.Errorf("creating clone shell: %w", err)
+		return wrapError(fmt.Errorf("creating clone shell: %w", err))
 	}
 
 	// Defensive stop in case the shell ended up running (Autostart=false should
 	// keep it stopped, but the helper makes it a no-op either way).
-	if err := t.client.StopInstanceIfRunning(ctx, prefixed(newName), tnapi.StopVirtInstanceOpts{Timeout: stopTimeoutSeconds}); err != nil {
-		return fmt.Errorf("stopping clone shell: %w", err)
-	}
-
-	// Replace root filesystem with a ZFS clone of the snapshot.
-	ds, err := t.resolveDataset(ctx, source)
-	if err != nil {
-		return err
-	}
-	if err := t.client.ReplaceContainerRootfs(ctx, prefixed(newName), ds+"@"+label); err != nil {
-		return fmt.Errorf("replacing rootfs: %w", err)
+	if err := t.client.StopInstanceIfRunning(ctx, prefixed(name), tnapi.StopVirtInstanceOpts{Timeout: stopTimeoutSeconds}); err != nil {
+		return wrapError(fmt.Errorf("stopping clone shell: %w", err))
 	}
-
-	// Start the clone.
-	if err := t.client.Virt.StartInstance(ctx, prefixed(newName)); err != nil {
-		return fmt.Errorf("starting clone: %w", err)
-	}
-
 	return nil
 }
 
@@ -393,21 +512,41 @@ func (t *TrueNAS) resolveDataset(ctx context.Context, name string) (string, erro
 	return t.client.ContainerDataset(ctx, prefixed(name))
 }
 
-// toInstance converts a truenas-go VirtInstance to a sandbox.Instance.
-func toInstance(inst *tnapi.VirtInstance) *sandbox.Instance {
-	return &sandbox.Instance{
-		Name:      unprefixed(inst.Name),
-		Status:    sandbox.Status(inst.Status),
-		Addresses: collectAddresses(inst.Aliases),
+// instanceDataset is resolveDataset for an instance that must exist.
+func (t *TrueNAS) instanceDataset(ctx context.Context, name string) (string, error) {
+	if _, err := t.lookup(ctx, name); err != nil {
+		return "", err
 	}
+	return t.resolveDataset(ctx, name)
 }
 
-// collectAddresses extracts all IPv4 addresses from aliases.
-func collectAddresses(aliases []tnapi.VirtAlias) []string {
+// requireSnapshot returns an error wrapping sandbox.ErrNotFound if
+// dataset@label does not exist.
+func (t *TrueNAS) requireSnapshot(ctx context.Context, ds, label string) error {
+	snaps, err := t.client.ListSnapshots(ctx, ds)
+	if err != nil {
+		return wrapError(fmt.Errorf("listing snapshots: %w", err))
+	}
+	for _, s := range snaps {
+		if s.SnapshotName == label {
+			return nil
+		}
+	}
+	return fmt.Errorf("snapshot %s@%s: %w", ds, label, sandbox.ErrNotFound)
+}
+
+// collectAddresses extracts all IPv4 addresses from aliases, or with v6
+// all IPv6 addresses except link-local ones.
+func collectAddresses(aliases []tnapi.VirtAlias, v6 bool) []string {
 	var addrs []string
 	for _, a := range aliases {
-		if a.Type == "INET" || a.Type == "ipv4" {
+		switch {
+		case !v6 && (a.Type == "INET" || a.Type == "ipv4"):
 			addrs = append(addrs, a.Address)
+		case v6 && (a.Type == "INET6" || a.Type == "ipv6"):
+			if ip, err := netip.ParseAddr(a.Address); err == nil && !ip.IsLinkLocalUnicast() {
+				addrs = append(addrs, a.Address)
+			}
 		}
 	}
 	return addrs
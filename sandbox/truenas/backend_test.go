@@ -1,15 +1,25 @@
 package truenas
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	tnapi "github.com/deevus/truenas-go"
+	"github.com/deevus/truenas-go/client"
 
+	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/ssh"
 	"github.com/deevus/pixels/sandbox"
 )
@@ -245,8 +255,13 @@ func TestDelete(t *testing.T) {
 
 func TestCreateSnapshot(t *testing.T) {
 	var created tnapi.CreateSnapshotOpts
+	props := zfsProps{"tank/ix-virt/containers/px-test": {policyProperty: `{"version":1,"mode":"agent"}`}}
 	tn := newTestBackend(t, &Client{
+		ws: props.client(),
 		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING"}, nil
+			},
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
 				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt"}, nil
 			},
@@ -268,11 +283,49 @@ func TestCreateSnapshot(t *testing.T) {
 	if created.Name != "snap1" {
 		t.Errorf("name = %q", created.Name)
 	}
+	if got := props["tank/ix-virt/containers/px-test@snap1"][policyProperty]; got != `{"version":1,"mode":"agent"}` {
+		t.Errorf("snapshot policy record = %q, want the instance's", got)
+	}
+}
+
+func TestCreateSnapshotExisting(t *testing.T) {
+	tn := newTestBackend(t, &Client{
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING"}, nil
+			},
+			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
+				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt"}, nil
+			},
+		},
+		Snapshot: &tnapi.MockSnapshotService{
+			QueryFunc: func(ctx context.Context, filters [][]any) ([]tnapi.Snapshot, error) {
+				return []tnapi.Snapshot{{SnapshotName: "snap1"}}, nil
+			},
+			CreateFunc: func(ctx context.Context, opts tnapi.CreateSnapshotOpts) (*tnapi.Snapshot, error) {
+				t.Error("Snapshot.Create called for a taken label")
+				return nil, errors.New("Failed to snapshot: dataset already exists")
+			},
+		},
+	})
+
+	err := tn.CreateSnapshot(context.Background(), "test", "snap1")
+	if !errors.Is(err, sandbox.ErrAlreadyExists) {
+		t.Errorf("err = %v, want ErrAlreadyExists", err)
+	}
 }
 
 func TestListSnapshots(t *testing.T) {
 	tn := newTestBackend(t, &Client{
+		ws: &client.MockClient{
+			CallFunc: func(ctx context.Context, method string, params any) (json.RawMessage, error) {
+				return json.RawMessage(`[{"snapshot_name": "snap1", "properties": {"creation": {"rawvalue": "1767225600"}}}]`), nil
+			},
+		},
 		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING"}, nil
+			},
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
 				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt"}, nil
 			},
@@ -300,12 +353,21 @@ func TestListSnapshots(t *testing.T) {
 	if snaps[1].Label != "snap2" || snaps[1].Size != 2048 {
 		t.Errorf("snap[1] = %+v", snaps[1])
 	}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); !snaps[0].CreatedAt.Equal(want) {
+		t.Errorf("snap1 created %v, want %v", snaps[0].CreatedAt, want)
+	}
+	if !snaps[1].CreatedAt.IsZero() {
+		t.Errorf("snap2 created %v, want zero for an unknown time", snaps[1].CreatedAt)
+	}
 }
 
 func TestDeleteSnapshot(t *testing.T) {
 	var deletedID string
 	tn := newTestBackend(t, &Client{
 		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING"}, nil
+			},
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
 				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt"}, nil
 			},
@@ -366,9 +428,13 @@ func TestResolveDataset(t *testing.T) {
 
 func TestCreateNoProvision(t *testing.T) {
 	mssh := &mockSSH{}
+	props := zfsProps{}
+	created := false
 	tn, _ := NewForTest(&Client{
+		ws: props.client(),
 		Virt: &tnapi.MockVirtService{
 			CreateInstanceFunc: func(ctx context.Context, opts tnapi.CreateVirtInstanceOpts) (*tnapi.VirtInstance, error) {
+				created = true
 				return &tnapi.VirtInstance{
 					Name:   opts.Name,
 					Status: "RUNNING",
@@ -378,14 +444,22 @@ func TestCreateNoProvision(t *testing.T) {
 				}, nil
 			},
 			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				if !created {
+					return nil, nil
+				}
 				return &tnapi.VirtInstance{
 					Name:   name,
 					Status: "RUNNING",
 					Aliases: []tnapi.VirtAlias{
 						{Type: "INET", Address: "10.0.0.42"},
+						{Type: "INET6", Address: "fe80::1"},
+						{Type: "INET6", Address: "2001:db8::42"},
 					},
 				}, nil
 			},
+			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
+				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt"}, nil
+			},
 		},
 		Interface: &tnapi.MockInterfaceService{},
 		Network:   &tnapi.MockNetworkService{},
@@ -404,6 +478,54 @@ func TestCreateNoProvision(t *testing.T) {
 	if len(inst.Addresses) != 1 || inst.Addresses[0] != "10.0.0.42" {
 		t.Errorf("addresses = %v", inst.Addresses)
 	}
+	if len(inst.AddressesV6) != 1 || inst.AddressesV6[0] != "2001:db8::42" {
+		t.Errorf("IPv6 addresses = %v, want only the global one", inst.AddressesV6)
+	}
+	p, err := egress.ParsePolicy([]byte(props["tank/ix-virt/containers/px-test"][policyProperty]))
+	if err != nil {
+		t.Fatalf("policy record: %v", err)
+	}
+	if p.Mode != sandbox.EgressUnrestricted {
+		t.Errorf("recorded mode = %q, want unrestricted", p.Mode)
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	tn := newTestBackend(t, &Client{
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING"}, nil
+			},
+			CreateInstanceFunc: func(ctx context.Context, opts tnapi.CreateVirtInstanceOpts) (*tnapi.VirtInstance, error) {
+				t.Error("CreateInstance called for a taken name")
+				return nil, errors.New("[EINVAL] virt_instance_create.name: Name already exists")
+			},
+		},
+	})
+
+	_, err := tn.Create(context.Background(), sandbox.CreateOpts{Name: "test", Bare: true})
+	if !errors.Is(err, sandbox.ErrAlreadyExists) {
+		t.Errorf("err = %v, want ErrAlreadyExists", err)
+	}
+}
+
+func TestInstanceMetadata(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	env := metadataEnv("ubuntu/24.04", sandbox.EgressAgent, map[string]string{"team": "infra"}, created)
+	inst := toInstance(&tnapi.VirtInstance{Name: "px-box", Status: "RUNNING", CPU: "2", Memory: 4 << 30, Environment: env})
+	if inst.Image != "ubuntu/24.04" || inst.Egress != sandbox.EgressAgent || !inst.CreatedAt.Equal(created) {
+		t.Errorf("metadata = %+v", inst)
+	}
+	if inst.CPU != "2" || inst.Memory != 4<<30 || inst.Labels["team"] != "infra" || len(inst.Labels) != 1 {
+		t.Errorf("limits/labels = %+v", inst)
+	}
+
+	// Instances created before pixels recorded metadata fall back to the
+	// image description.
+	old := toInstance(&tnapi.VirtInstance{Name: "px-old", Image: tnapi.VirtInstanceImageResponse{Description: "Ubuntu noble"}})
+	if old.Image != "Ubuntu noble" || old.Labels != nil || !old.CreatedAt.IsZero() {
+		t.Errorf("old instance = %+v", old)
+	}
 }
 
 func TestStart(t *testing.T) {
@@ -442,8 +564,10 @@ func TestCloneFrom(t *testing.T) {
 	cfg["nic_type"] = "MACVLAN"
 	cfg["parent"] = "br0"
 	cfg["dataset_prefix"] = "tank/virt"
+	props := zfsProps{"tank/virt/px-source@snap1": {policyProperty: `{"version":1,"mode":"agent"}`}}
 
 	tn, _ := NewForTest(&Client{
+		ws: props.client(),
 		Virt: &tnapi.MockVirtService{
 			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
 				switch name {
@@ -451,6 +575,7 @@ func TestCloneFrom(t *testing.T) {
 					return &tnapi.VirtInstance{
 						Name: "px-source", Status: "RUNNING",
 						CPU: "4", Memory: 8192,
+						Environment: map[string]string{envImage: "ubuntu/24.04", envLabelPrefix + "team": "infra"},
 					}, nil
 				case "px-newbox":
 					// Reported as STOPPED so StopInstanceIfRunning is a no-op.
@@ -484,6 +609,11 @@ func TestCloneFrom(t *testing.T) {
 				return nil
 			},
 		},
+		Snapshot: &tnapi.MockSnapshotService{
+			QueryFunc: func(ctx context.Context, filters [][]any) ([]tnapi.Snapshot, error) {
+				return []tnapi.Snapshot{{SnapshotName: "snap1"}}, nil
+			},
+		},
 	}, mssh, cfg)
 
 	if err := tn.CloneFrom(context.Background(), "source", "snap1", "newbox"); err != nil {
@@ -502,6 +632,10 @@ func TestCloneFrom(t *testing.T) {
 	if createOpts.Autostart {
 		t.Error("CreateInstance Autostart should be false")
 	}
+	clone := toInstance(&tnapi.VirtInstance{Name: "px-newbox", Environment: createOpts.Environment})
+	if clone.Origin != "source:snap1" || clone.Image != "ubuntu/24.04" || clone.Labels["team"] != "infra" {
+		t.Errorf("clone metadata = %+v, want origin, image and labels from source", clone)
+	}
 	if len(createOpts.Devices) != 1 {
 		t.Fatalf("CreateInstance Devices = %v, want one NIC", createOpts.Devices)
 	}
@@ -522,6 +656,9 @@ func TestCloneFrom(t *testing.T) {
 	if deletedCronJobID != 42 {
 		t.Errorf("Cron.Delete called with id=%d, want 42 (cleanup of temp job)", deletedCronJobID)
 	}
+	if got := props["tank/virt/px-newbox"][policyProperty]; got != `{"version":1,"mode":"agent"}` {
+		t.Errorf("clone policy record = %q, want the snapshot's", got)
+	}
 }
 
 func TestCloneFromSourceNotFound(t *testing.T) {
@@ -542,6 +679,207 @@ func TestCloneFromSourceNotFound(t *testing.T) {
 	}
 }
 
+func TestImportSnapshot(t *testing.T) {
+	var createOpts tnapi.CreateVirtInstanceOpts
+	var chunks []string
+	var cronCmds []string
+	var starts, stops int
+	status := "" // the shell's status once created
+
+	props := zfsProps{}
+
+	cfg := testCfg()
+	cfg["nic_type"] = "MACVLAN"
+	cfg["parent"] = "br0"
+	tn, _ := NewForTest(&Client{
+		ws: props.client(),
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				if status == "" {
+					return nil, errors.New("instance does not exist")
+				}
+				return &tnapi.VirtInstance{Name: name, Status: status}, nil
+			},
+			CreateInstanceFunc: func(ctx context.Context, opts tnapi.CreateVirtInstanceOpts) (*tnapi.VirtInstance, error) {
+				createOpts, status = opts, "STOPPED"
+				return &tnapi.VirtInstance{Name: opts.Name, Status: "STOPPED"}, nil
+			},
+			StartInstanceFunc: func(ctx context.Context, name string) error {
+				starts, status = starts+1, "RUNNING"
+				return nil
+			},
+			StopInstanceFunc: func(ctx context.Context, name string, opts tnapi.StopVirtInstanceOpts) error {
+				stops, status = stops+1, "STOPPED"
+				return nil
+			},
+			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
+				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt", Pool: "tank"}, nil
+			},
+		},
+		Filesystem: &tnapi.MockFilesystemService{
+			WriteFileFunc: func(ctx context.Context, path string, params tnapi.WriteFileParams) error {
+				chunks = append(chunks, path)
+				return nil
+			},
+		},
+		Cron: &tnapi.MockCronService{
+			CreateFunc: func(ctx context.Context, opts tnapi.CreateCronJobOpts) (*tnapi.CronJob, error) {
+				cronCmds = append(cronCmds, opts.Command)
+				return &tnapi.CronJob{ID: int64(len(cronCmds))}, nil
+			},
+		},
+	}, &mockSSH{}, cfg)
+
+	src := &sandbox.Instance{Name: "base", Image: "ubuntu/24.04", CPU: "2", Memory: 4096, Labels: map[string]string{"team": "infra"}}
+	stream := bytes.Repeat([]byte{'z'}, importChunk+10)
+	m := sandbox.NewExportManifest("truenas", src, "ready")
+	policy := egress.NewPolicy(sandbox.EgressAllowlist, []string{"example.com"})
+	m.Policy = &policy
+	var archive bytes.Buffer
+	if err := sandbox.WriteExport(&archive, m, bytes.NewReader(stream), int64(len(stream))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tn.ImportSnapshot(context.Background(), "copy", &archive); err != nil {
+		t.Fatalf("ImportSnapshot: %v", err)
+	}
+
+	if createOpts.Name != "px-copy" || createOpts.CPU != "2" || createOpts.Memory != 4096 {
+		t.Errorf("shell = %+v, want px-copy with the archived limits", createOpts)
+	}
+	inst := toInstance(&tnapi.VirtInstance{Name: "px-copy", Environment: createOpts.Environment})
+	if inst.Origin != "base:ready" || inst.Image != "ubuntu/24.04" || inst.Labels["team"] != "infra" {
+		t.Errorf("imported metadata = %+v", inst)
+	}
+	if len(chunks) != 2 || !strings.HasPrefix(chunks[0], "/mnt/tank/.pixels-staging/") ||
+		!strings.HasSuffix(chunks[0], "/stream.0000") || chunks[1] != strings.TrimSuffix(chunks[0], "0")+"1" {
+		t.Errorf("uploaded chunks = %v, want stream.0000 and stream.0001 in a host staging directory", chunks)
+	}
+	if len(cronCmds) != 4 {
+		t.Fatalf("cron commands = %q, want mkdir, receive, swap, then cleanup", cronCmds)
+	}
+	dir := path.Dir(chunks[0])
+	if !strings.HasSuffix(cronCmds[0], "&& mkdir "+dir) {
+		t.Errorf("staging cmd = %q, want a fresh %s", cronCmds[0], dir)
+	}
+	if cronCmds[1] != "cat "+dir+"/stream.* | /usr/sbin/zfs receive -u tank/ix-virt/containers/px-copy.import" {
+		t.Errorf("receive cmd = %q", cronCmds[1])
+	}
+	if !strings.Contains(cronCmds[2], "zfs rename tank/ix-virt/containers/px-copy.import tank/ix-virt/containers/px-copy") ||
+		!strings.Contains(cronCmds[2], "mv -f -T") {
+		t.Errorf("swap cmd = %q", cronCmds[2])
+	}
+	if cronCmds[3] != "rm -rf "+dir {
+		t.Errorf("cleanup cmd = %q", cronCmds[3])
+	}
+	if starts != 1 || stops != 0 {
+		t.Errorf("starts = %d, stops = %d; want the shell started once, after the swap", starts, stops)
+	}
+	for _, id := range []string{"tank/ix-virt/containers/px-copy", "tank/ix-virt/containers/px-copy@ready"} {
+		p, err := egress.ParsePolicy([]byte(props[id][policyProperty]))
+		if err != nil || !slices.Equal(p.Allow, policy.Allow) {
+			t.Errorf("policy on %s = %+v, %v; want the exported one", id, p, err)
+		}
+	}
+}
+
+func TestExportSnapshot(t *testing.T) {
+	stream := []byte("zfs send stream")
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_download/7" || r.URL.Query().Get("auth_token") != "tok" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(stream)
+	}))
+	defer srv.Close()
+
+	var cronCmds []string
+	var downloaded string
+	policy := egress.NewPolicy(sandbox.EgressAllowlist, []string{"example.com"})
+	props := allowlistProps()
+	props[testDataset+"@ready"] = map[string]string{policyProperty: string(egress.MarshalPolicy(policy))}
+	tn, _ := NewForTest(&Client{
+		ws: &client.MockClient{CallFunc: func(ctx context.Context, method string, params any) (json.RawMessage, error) {
+			switch method {
+			case "filesystem.stat":
+				return json.RawMessage(fmt.Sprintf(`{"size": %d}`, len(stream))), nil
+			case "core.download":
+				args := params.([]any)
+				downloaded = args[1].([]any)[0].(string)
+				return json.RawMessage(`[7, "/_download/7?auth_token=tok"]`), nil
+			}
+			return props.client().CallFunc(ctx, method, params)
+		}},
+		web:     srv.Client(),
+		baseURL: srv.URL,
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "STOPPED"}, nil
+			},
+			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
+				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt", Pool: "tank"}, nil
+			},
+		},
+		Snapshot: &tnapi.MockSnapshotService{
+			QueryFunc: func(ctx context.Context, filters [][]any) ([]tnapi.Snapshot, error) {
+				return []tnapi.Snapshot{{ID: testDataset + "@ready", SnapshotName: "ready"}}, nil
+			},
+		},
+		Cron: &tnapi.MockCronService{
+			CreateFunc: func(ctx context.Context, opts tnapi.CreateCronJobOpts) (*tnapi.CronJob, error) {
+				cronCmds = append(cronCmds, opts.Command)
+				return &tnapi.CronJob{ID: int64(len(cronCmds))}, nil
+			},
+		},
+	}, &mockSSH{}, testCfg())
+
+	var archive bytes.Buffer
+	if err := tn.ExportSnapshot(context.Background(), "test", "ready", &archive); err != nil {
+		t.Fatalf("ExportSnapshot: %v", err)
+	}
+
+	if len(cronCmds) != 3 {
+		t.Fatalf("cron commands = %q, want mkdir, send, then cleanup", cronCmds)
+	}
+	dir := path.Dir(downloaded)
+	if !strings.HasPrefix(dir, "/mnt/tank/.pixels-staging/") || path.Base(downloaded) != "stream" {
+		t.Errorf("downloaded %q, want a stream in a host staging directory", downloaded)
+	}
+	if cronCmds[1] != "set -C && /usr/sbin/zfs send "+testDataset+"@ready > "+downloaded {
+		t.Errorf("send cmd = %q", cronCmds[1])
+	}
+	if cronCmds[2] != "rm -rf "+dir {
+		t.Errorf("cleanup cmd = %q", cronCmds[2])
+	}
+	err := sandbox.ReadExport(&archive, "truenas", func(m *sandbox.ExportManifest, payload io.Reader) error {
+		if m.Policy == nil || !slices.Equal(m.Policy.Allow, policy.Allow) {
+			t.Errorf("manifest policy = %+v, want the snapshot's %+v", m.Policy, policy)
+		}
+		got, err := io.ReadAll(payload)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, stream) {
+			t.Errorf("payload = %q, want %q", got, stream)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadExport: %v", err)
+	}
+}
+
+func TestImportSnapshotWrongBackend(t *testing.T) {
+	tn := newTestBackend(t, &Client{Virt: &tnapi.MockVirtService{}})
+	var archive bytes.Buffer
+	sandbox.WriteExport(&archive, sandbox.NewExportManifest("incus", &sandbox.Instance{Name: "base"}, "ready"), strings.NewReader("x"), 1)
+	err := tn.ImportSnapshot(context.Background(), "copy", &archive)
+	if err == nil || !strings.Contains(err.Error(), "incus backend") {
+		t.Errorf("err = %v, want an error naming the incus backend", err)
+	}
+}
+
 func TestWriteFile(t *testing.T) {
 	t.Run("root-owned skips chown", func(t *testing.T) {
 		var writePath string
@@ -895,3 +1233,97 @@ func TestCapabilities(t *testing.T) {
 		t.Error("EgressControl should be true")
 	}
 }
+
+func TestMissingInstanceWrapsNotFound(t *testing.T) {
+	tn := newTestBackend(t, &Client{
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return nil, nil
+			},
+			StopInstanceFunc: func(ctx context.Context, name string, opts tnapi.StopVirtInstanceOpts) error {
+				t.Error("StopInstance called for missing instance")
+				return nil
+			},
+		},
+	})
+	ctx := context.Background()
+
+	tests := map[string]func() error{
+		"Stop":            func() error { return tn.Stop(ctx, "gone") },
+		"CreateSnapshot":  func() error { return tn.CreateSnapshot(ctx, "gone", "s") },
+		"ListSnapshots":   func() error { _, err := tn.ListSnapshots(ctx, "gone"); return err },
+		"DeleteSnapshot":  func() error { return tn.DeleteSnapshot(ctx, "gone", "s") },
+		"RestoreSnapshot": func() error { return tn.RestoreSnapshot(ctx, "gone", "s") },
+		"CloneFrom":       func() error { return tn.CloneFrom(ctx, "gone", "s", "new") },
+		"Output":          func() error { _, err := tn.Output(ctx, "gone", []string{"true"}); return err },
+		"Ready":           func() error { return tn.Ready(ctx, "gone", time.Second) },
+		"GetPolicy":       func() error { _, err := tn.GetPolicy(ctx, "gone"); return err },
+	}
+	for name, fn := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := fn(); !errors.Is(err, sandbox.ErrNotFound) {
+				t.Errorf("err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestCloneFromSnapshotNotFound(t *testing.T) {
+	cfg := testCfg()
+	cfg["dataset_prefix"] = "tank/virt"
+	tn, _ := NewForTest(&Client{
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING"}, nil
+			},
+			CreateInstanceFunc: func(ctx context.Context, opts tnapi.CreateVirtInstanceOpts) (*tnapi.VirtInstance, error) {
+				t.Error("clone shell created for a missing snapshot")
+				return nil, nil
+			},
+		},
+		Snapshot: &tnapi.MockSnapshotService{
+			QueryFunc: func(ctx context.Context, filters [][]any) ([]tnapi.Snapshot, error) {
+				return []tnapi.Snapshot{{SnapshotName: "other"}}, nil
+			},
+		},
+	}, &mockSSH{}, cfg)
+
+	err := tn.CloneFrom(context.Background(), "source", "snap1", "newbox")
+	if !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListSnapshotsOrderedByCreateTXG(t *testing.T) {
+	tn := newTestBackend(t, &Client{
+		ws: &client.MockClient{
+			CallFunc: func(ctx context.Context, method string, params any) (json.RawMessage, error) {
+				return json.RawMessage(`[]`), nil
+			},
+		},
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING"}, nil
+			},
+			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
+				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt"}, nil
+			},
+		},
+		Snapshot: &tnapi.MockSnapshotService{
+			QueryFunc: func(ctx context.Context, filters [][]any) ([]tnapi.Snapshot, error) {
+				return []tnapi.Snapshot{
+					{SnapshotName: "newer", CreateTXG: "300"},
+					{SnapshotName: "older", CreateTXG: "100"},
+				}, nil
+			},
+		},
+	})
+
+	snaps, err := tn.ListSnapshots(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snaps) != 2 || snaps[0].Label != "older" || snaps[1].Label != "newer" {
+		t.Errorf("snapshots = %+v, want older then newer", snaps)
+	}
+}
@@ -2,23 +2,34 @@ package truenas
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"net"
+	"net/http"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	truenas "github.com/deevus/truenas-go"
 	"github.com/deevus/truenas-go/client"
 
 	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/scripts"
+	"github.com/deevus/pixels/sandbox"
 	"github.com/deevus/pixels/sandbox/user"
 )
 
 // Client wraps a truenas-go WebSocket client and its typed services.
 type Client struct {
 	ws         client.Client
+	web        *http.Client // fetches files from the API's download endpoint
+	baseURL    string       // https://host:port of the API
 	Virt       truenas.VirtServiceAPI
 	Snapshot   truenas.SnapshotServiceAPI
 	Interface  truenas.InterfaceServiceAPI
@@ -41,12 +52,23 @@ func connect(ctx context.Context, cfg *tnConfig) (*Client, error) {
 	}
 
 	if err := ws.Connect(ctx); err != nil {
-		return nil, fmt.Errorf("connecting to %s: %w", cfg.host, err)
+		return nil, wrapError(fmt.Errorf("connecting to %s: %w", cfg.host, err))
+	}
+
+	port := cfg.port
+	if port == 0 {
+		port = 443
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.insecure {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 
 	v := ws.Version()
 	return &Client{
 		ws:         ws,
+		web:        &http.Client{Transport: tr},
+		baseURL:    "https://" + net.JoinHostPort(cfg.host, strconv.Itoa(port)),
 		Virt:       truenas.NewVirtService(ws, v),
 		Snapshot:   truenas.NewSnapshotService(ws, v),
 		Interface:  truenas.NewInterfaceService(ws, v),
@@ -75,20 +97,29 @@ func (c *Client) ContainerDataset(ctx context.Context, name string) (string, err
 // WriteContainerFile writes a file into a running container's rootfs via the
 // TrueNAS filesystem API (no SSH required).
 func (c *Client) WriteContainerFile(ctx context.Context, name, path string, content []byte, mode fs.FileMode) error {
-	gcfg, err := c.Virt.GetGlobalConfig(ctx)
+	rootfs, err := c.containerRootfs(ctx, name)
 	if err != nil {
-		return fmt.Errorf("querying virt global config: %w", err)
-	}
-	if gcfg.Pool == "" {
-		return fmt.Errorf("no pool in virt global config")
+		return err
 	}
-	rootfs := fmt.Sprintf("/var/lib/incus/storage-pools/%s/containers/%s/rootfs", gcfg.Pool, name)
 	return c.Filesystem.WriteFile(ctx, rootfs+path, truenas.WriteFileParams{
 		Content: content,
 		Mode:    mode,
 	})
 }
 
+// containerRootfs returns the host path of a running container's root
+// filesystem.
+func (c *Client) containerRootfs(ctx context.Context, name string) (string, error) {
+	gcfg, err := c.Virt.GetGlobalConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("querying virt global config: %w", err)
+	}
+	if gcfg.Pool == "" {
+		return "", fmt.Errorf("no pool in virt global config")
+	}
+	return fmt.Sprintf("/var/lib/incus/storage-pools/%s/containers/%s/rootfs", gcfg.Pool, name), nil
+}
+
 // ProvisionOpts contains options for provisioning a container.
 type ProvisionOpts struct {
 	SSHPubKey       string
@@ -96,8 +127,9 @@ type ProvisionOpts struct {
 	Env             map[string]string // environment variables to inject into /etc/environment
 	EnvForwardKeys  []string          // env var names for sshd AcceptEnv restriction
 	DevTools        bool              // whether to install dev tools (mise, claude-code, codex, opencode)
-	Egress          string            // "unrestricted", "agent", or "allowlist"
-	EgressAllow     []string          // custom domains (merged into agent, standalone for allowlist)
+	Egress          string            // "unrestricted", "allowlist", or presets, e.g. "agent,rust"
+	EgressAllow     []string          // custom domains (merged into presets, standalone for allowlist)
+	DNSFilter       []byte            // egress DNS filter binary; nil resolves domains up front instead
 	ProvisionScript string            // zmx provision script content (written to /usr/local/bin/pixels-provision.sh)
 	Log             io.Writer         // optional; verbose progress output
 }
@@ -226,16 +258,16 @@ func (c *Client) Provision(ctx context.Context, name string, opts ProvisionOpts)
 	}
 
 	// Write egress control files when egress mode is restricted.
-	isRestricted := opts.Egress == "agent" || opts.Egress == "allowlist"
+	isRestricted := egress.IsRestricted(opts.Egress)
 	if isRestricted {
-		domains := egress.ResolveDomains(opts.Egress, opts.EgressAllow)
+		policy := egress.NewPolicy(sandbox.EgressMode(opts.Egress), opts.EgressAllow)
 		if err := c.Filesystem.WriteFile(ctx, rootfs+"/etc/pixels-egress-domains", truenas.WriteFileParams{
-			Content: []byte(egress.DomainsFileContent(domains)),
+			Content: []byte(egress.DomainsFileContent(policy.Domains)),
 			Mode:    0o644,
 		}); err != nil {
 			return fmt.Errorf("writing egress domains: %w", err)
 		}
-		cidrs := egress.PresetCIDRs(opts.Egress)
+		cidrs := policy.CIDRs
 		if len(cidrs) > 0 {
 			if err := c.Filesystem.WriteFile(ctx, rootfs+"/etc/pixels-egress-cidrs", truenas.WriteFileParams{
 				Content: []byte(egress.CIDRsFileContent(cidrs)),
@@ -256,6 +288,20 @@ func (c *Client) Provision(ctx context.Context, name string, opts ProvisionOpts)
 		}); err != nil {
 			return fmt.Errorf("writing egress resolve script: %w", err)
 		}
+		if opts.DNSFilter != nil {
+			if err := c.Filesystem.WriteFile(ctx, rootfs+egress.DNSFilterPath, truenas.WriteFileParams{
+				Content: opts.DNSFilter,
+				Mode:    0o755,
+			}); err != nil {
+				return fmt.Errorf("writing DNS filter: %w", err)
+			}
+			if err := c.Filesystem.WriteFile(ctx, rootfs+egress.DNSFilterUnitPath, truenas.WriteFileParams{
+				Content: []byte(egress.DNSFilterUnit()),
+				Mode:    0o644,
+			}); err != nil {
+				return fmt.Errorf("writing DNS filter unit: %w", err)
+			}
+		}
 		if err := c.Filesystem.WriteFile(ctx, rootfs+"/usr/local/bin/safe-apt", truenas.WriteFileParams{
 			Content: []byte(egress.SafeAptScript()),
 			Mode:    0o755,
@@ -280,7 +326,7 @@ func (c *Client) Provision(ctx context.Context, name string, opts ProvisionOpts)
 		}); err != nil {
 			return fmt.Errorf("writing egress enable script: %w", err)
 		}
-		logf("Wrote egress files (%d domains, %d cidrs, staged restricted sudoers)", len(domains), len(cidrs))
+		logf("Wrote egress files (%d domains, %d cidrs, staged restricted sudoers)", len(policy.Domains), len(cidrs))
 	}
 
 	// Write the zmx provision script (generated by provision.Script()).
@@ -391,6 +437,10 @@ type CreateInstanceOpts struct {
 	Memory    int64 // bytes
 	Autostart bool
 	NIC       *NICOpts
+	Mounts    []sandbox.Mount // host paths on the TrueNAS server
+	// Environment is passed to the container; pixels also keeps its
+	// metadata here.
+	Environment map[string]string
 }
 
 // CreateInstance creates an Incus container via the Virt service.
@@ -402,22 +452,65 @@ func (c *Client) CreateInstance(ctx context.Context, opts CreateInstanceOpts) (*
 		CPU:          opts.CPU,
 		Memory:       opts.Memory,
 		Autostart:    opts.Autostart,
+		Environment:  opts.Environment,
 	}
 	if opts.NIC != nil {
-		createOpts.Devices = []truenas.VirtDeviceOpts{{
+		createOpts.Devices = append(createOpts.Devices, truenas.VirtDeviceOpts{
 			DevType: "NIC",
 			NICType: opts.NIC.NICType,
 			Parent:  opts.NIC.Parent,
-		}}
+		})
+	}
+	for _, m := range opts.Mounts {
+		createOpts.Devices = append(createOpts.Devices, truenas.VirtDeviceOpts{
+			DevType:     "DISK",
+			Source:      m.Source,
+			Destination: m.Target,
+			Readonly:    m.ReadOnly,
+		})
 	}
 	return c.Virt.CreateInstance(ctx, createOpts)
 }
 
+// UpdateInstanceLimits sets a container's CPU and memory (bytes) through
+// virt.instance.update. Empty or zero values are left unchanged.
+func (c *Client) UpdateInstanceLimits(ctx context.Context, name, cpu string, memory int64) error {
+	params := map[string]any{}
+	if cpu != "" {
+		params["cpu"] = cpu
+	}
+	if memory > 0 {
+		params["memory"] = memory
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	_, err := c.ws.CallAndWait(ctx, "virt.instance.update", []any{name, params})
+	return err
+}
+
 // ListInstances queries all Incus instances with the px- prefix.
 func (c *Client) ListInstances(ctx context.Context) ([]truenas.VirtInstance, error) {
 	return c.Virt.ListInstances(ctx, [][]any{{"name", "^", "px-"}})
 }
 
+// SubscribeInstances subscribes to changes to virt instances. Updates
+// carry whatever fields changed, or none for a removal, so callers treat
+// each one as a cue to re-list.
+func (c *Client) SubscribeInstances(ctx context.Context) (*truenas.Subscription[json.RawMessage], error) {
+	return c.ws.Subscribe(ctx, "virt.instance.query", nil)
+}
+
+// SubscribeSnapshots subscribes to changes to ZFS snapshots, under the
+// collection name the server's version uses.
+func (c *Client) SubscribeSnapshots(ctx context.Context) (*truenas.Subscription[json.RawMessage], error) {
+	collection := "zfs.snapshot.query"
+	if c.ws.Version().AtLeast(25, 10) {
+		collection = "pool.snapshot.query"
+	}
+	return c.ws.Subscribe(ctx, collection, nil)
+}
+
 // StopInstanceIfRunning stops the named instance only if its current status is
 // RUNNING. No-ops on any other status (STOPPED, FROZEN, etc.) so callers don't
 // need to know the prior state. Returns nil if the instance can't be found —
@@ -438,6 +531,106 @@ func (c *Client) ListSnapshots(ctx context.Context, dataset string) ([]truenas.S
 	return c.Snapshot.Query(ctx, [][]any{{"dataset", "=", dataset}})
 }
 
+// SnapshotTimes returns the ZFS creation time of each snapshot of dataset,
+// keyed by snapshot name. truenas-go's Snapshot doesn't carry it, so the
+// creation property is queried directly.
+func (c *Client) SnapshotTimes(ctx context.Context, dataset string) (map[string]time.Time, error) {
+	method := "zfs.snapshot.query"
+	if c.ws.Version().AtLeast(25, 10) {
+		method = "pool.snapshot.query"
+	}
+	raw, err := c.ws.Call(ctx, method, []any{
+		[][]any{{"dataset", "=", dataset}},
+		map[string]any{"extra": map[string]any{"properties": []string{"creation"}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("querying snapshot times: %w", err)
+	}
+	var resp []struct {
+		SnapshotName string `json:"snapshot_name"`
+		Properties   struct {
+			Creation struct {
+				RawValue string `json:"rawvalue"`
+			} `json:"creation"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("parsing snapshot times: %w", err)
+	}
+	times := make(map[string]time.Time, len(resp))
+	for _, r := range resp {
+		if sec, err := strconv.ParseInt(r.Properties.Creation.RawValue, 10, 64); err == nil {
+			times[r.SnapshotName] = time.Unix(sec, 0).UTC()
+		}
+	}
+	return times, nil
+}
+
+// UserProperty returns the ZFS user property key of id, a dataset or a
+// snapshot (dataset@name), or "" if it isn't set.
+func (c *Client) UserProperty(ctx context.Context, id, key string) (string, error) {
+	method := "pool.dataset.query"
+	if strings.Contains(id, "@") {
+		method = "zfs.snapshot.query"
+		if c.ws.Version().AtLeast(25, 10) {
+			method = "pool.snapshot.query"
+		}
+	}
+	raw, err := c.ws.Call(ctx, method, []any{
+		[][]any{{"id", "=", id}},
+		map[string]any{"extra": map[string]any{"properties": []string{key}, "user_properties": true}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("querying %s on %s: %w", key, id, err)
+	}
+	// Datasets report user properties apart from the native ones;
+	// snapshots report them among the properties asked for.
+	type prop struct {
+		Value  string `json:"value"`
+		Source string `json:"source"`
+	}
+	var resp []struct {
+		UserProperties map[string]prop `json:"user_properties"`
+		Properties     map[string]prop `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return "", fmt.Errorf("parsing %s on %s: %w", key, id, err)
+	}
+	if len(resp) == 0 {
+		return "", fmt.Errorf("querying %s on %s: %w", key, id, sandbox.ErrNotFound)
+	}
+	v, ok := resp[0].UserProperties[key]
+	if !ok {
+		v = resp[0].Properties[key]
+	}
+	if v.Source == "NONE" || v.Value == "-" {
+		return "", nil
+	}
+	return v.Value, nil
+}
+
+// SetUserProperty sets the ZFS user property key of id, a dataset or a
+// snapshot (dataset@name), to value, or removes it if value is "".
+func (c *Client) SetUserProperty(ctx context.Context, id, key, value string) error {
+	method := "pool.dataset.update"
+	if strings.Contains(id, "@") {
+		method = "zfs.snapshot.update"
+		if c.ws.Version().AtLeast(25, 10) {
+			method = "pool.snapshot.update"
+		}
+	}
+	update := map[string]any{"key": key, "value": value}
+	if value == "" {
+		update = map[string]any{"key": key, "remove": true}
+	}
+	if _, err := c.ws.Call(ctx, method, []any{id, map[string]any{
+		"user_properties_update": []any{update},
+	}}); err != nil {
+		return fmt.Errorf("setting %s on %s: %w", key, id, err)
+	}
+	return nil
+}
+
 // SnapshotRollback rolls back to the given snapshot ID (dataset@name).
 func (c *Client) SnapshotRollback(ctx context.Context, snapshotID string) error {
 	return c.Snapshot.Rollback(ctx, snapshotID)
@@ -446,35 +639,250 @@ func (c *Client) SnapshotRollback(ctx context.Context, snapshotID string) error
 // ReplaceContainerRootfs destroys the container's ZFS dataset and clones
 // the checkpoint snapshot in its place. The container must be stopped.
 func (c *Client) ReplaceContainerRootfs(ctx context.Context, containerName, snapshotID string) error {
+	dstDataset, err := c.ContainerDataset(ctx, containerName)
+	if err != nil {
+		return err
+	}
+	if err := checkZFSPaths(dstDataset, snapshotID); err != nil {
+		return err
+	}
+
+	cmd := fmt.Sprintf(
+		"/usr/sbin/zfs destroy -r %s && /usr/sbin/zfs clone %s %s && %s",
+		dstDataset, snapshotID, dstDataset, setHostnameCmd(dstDataset, containerName),
+	)
+	if err := c.runAsRoot(ctx, "clone checkpoint", cmd); err != nil {
+		return fmt.Errorf("running ZFS clone: %w", err)
+	}
+	return nil
+}
+
+// stagingDir is the directory under the pool's mountpoint where exports
+// and imports stage ZFS send streams. It is outside every container's
+// rootfs, so no container can read a staged stream or plant links for the
+// root commands that write and read it.
+const stagingDir = ".pixels-staging"
+
+// NewStaging creates a fresh directory only root can use for one export or
+// import and returns its host path. [Client.RemoveStaging] deletes it.
+func (c *Client) NewStaging(ctx context.Context) (string, error) {
 	gcfg, err := c.Virt.GetGlobalConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("querying virt global config: %w", err)
+		return "", fmt.Errorf("querying virt global config: %w", err)
 	}
-	if gcfg.Dataset == "" {
-		return fmt.Errorf("no dataset in virt global config")
+	if gcfg.Pool == "" {
+		return "", fmt.Errorf("no pool in virt global config")
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("naming staging directory: %w", err)
+	}
+	root := "/mnt/" + gcfg.Pool + "/" + stagingDir
+	dir := root + "/" + hex.EncodeToString(b[:])
+	if err := checkZFSPaths(dir); err != nil {
+		return "", err
 	}
-	dstDataset := gcfg.Dataset + "/containers/" + containerName
+	// The last mkdir has no -p, so it fails unless it creates dir itself.
+	cmd := fmt.Sprintf("umask 077 && mkdir -p %s && [ ! -L %s ] && mkdir %s", root, root, dir)
+	if err := c.runAsRoot(ctx, "stage checkpoint", cmd); err != nil {
+		return "", fmt.Errorf("creating staging directory: %w", err)
+	}
+	return dir, nil
+}
+
+// RemoveStaging deletes a directory made by [Client.NewStaging] and
+// everything staged in it.
+func (c *Client) RemoveStaging(ctx context.Context, dir string) error {
+	if err := checkZFSPaths(dir); err != nil {
+		return err
+	}
+	if err := c.runAsRoot(ctx, "remove checkpoint staging", "rm -rf "+dir); err != nil {
+		return fmt.Errorf("removing staging directory: %w", err)
+	}
+	return nil
+}
+
+// SendSnapshot writes a ZFS send stream of snapshotID to path, a new file in
+// a directory from [Client.NewStaging]. With noclobber set the shell
+// creates path exclusively, so it never follows or reuses anything there.
+func (c *Client) SendSnapshot(ctx context.Context, snapshotID, path string) error {
+	if err := checkZFSPaths(snapshotID, path); err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("set -C && /usr/sbin/zfs send %s > %s", snapshotID, path)
+	if err := c.runAsRoot(ctx, "export checkpoint", cmd); err != nil {
+		return fmt.Errorf("running ZFS send: %w", err)
+	}
+	return nil
+}
+
+// OpenHostFile streams a file off the TrueNAS host through the API's
+// download endpoint and returns it with its size. The caller closes it.
+func (c *Client) OpenHostFile(ctx context.Context, hostPath string) (io.ReadCloser, int64, error) {
+	raw, err := c.ws.Call(ctx, "filesystem.stat", hostPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("stat %s: %w", hostPath, err)
+	}
+	var st struct {
+		Size int64 `json:"size"`
+	}
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return nil, 0, fmt.Errorf("parsing stat of %s: %w", hostPath, err)
+	}
+	body, err := c.download(ctx, hostPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, st.Size, nil
+}
+
+// maxHostFile bounds what ReadHostFile reads.
+const maxHostFile = 1 << 20
+
+// ReadHostFile returns a small file from the TrueNAS host, such as a
+// cgroup or /proc file, whose stat size doesn't say how much it holds.
+func (c *Client) ReadHostFile(ctx context.Context, hostPath string) ([]byte, error) {
+	body, err := c.download(ctx, hostPath)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxHostFile))
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", hostPath, err)
+	}
+	return data, nil
+}
+
+// download fetches hostPath through core.download and filesystem.get.
+func (c *Client) download(ctx context.Context, hostPath string) (io.ReadCloser, error) {
+	raw, err := c.ws.Call(ctx, "core.download", []any{"filesystem.get", []any{hostPath}, path.Base(hostPath)})
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", hostPath, err)
+	}
+	var job []json.RawMessage // [job ID, URL]
+	var url string
+	if err := json.Unmarshal(raw, &job); err != nil || len(job) != 2 {
+		return nil, fmt.Errorf("parsing download of %s: %s", hostPath, raw)
+	}
+	if err := json.Unmarshal(job[1], &url); err != nil {
+		return nil, fmt.Errorf("parsing download URL of %s: %w", hostPath, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", hostPath, err)
+	}
+	resp, err := c.web.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", hostPath, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s: %s", hostPath, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// DatasetUsed returns the ZFS used property of dataset in bytes.
+func (c *Client) DatasetUsed(ctx context.Context, dataset string) (int64, error) {
+	raw, err := c.ws.Call(ctx, "pool.dataset.query", []any{
+		[][]any{{"id", "=", dataset}},
+		map[string]any{"extra": map[string]any{"properties": []string{"used"}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("querying used on %s: %w", dataset, err)
+	}
+	var resp []struct {
+		Used struct {
+			RawValue string `json:"rawvalue"`
+		} `json:"used"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return 0, fmt.Errorf("parsing used on %s: %w", dataset, err)
+	}
+	if len(resp) == 0 {
+		return 0, fmt.Errorf("querying used on %s: %w", dataset, sandbox.ErrNotFound)
+	}
+	used, err := strconv.ParseInt(resp[0].Used.RawValue, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing used on %s: %w", dataset, err)
+	}
+	return used, nil
+}
+
+// ReceiveContainerRootfs receives the ZFS send stream staged as path.0000,
+// path.0001, ... in a directory from [Client.NewStaging] into a sibling
+// of the container's dataset. [Client.SwapContainerRootfs] then puts the
+// received dataset in place.
+func (c *Client) ReceiveContainerRootfs(ctx context.Context, containerName, path string) error {
+	dataset, err := c.ContainerDataset(ctx, containerName)
+	if err != nil {
+		return err
+	}
+	if err := checkZFSPaths(dataset, path); err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("cat %s.* | /usr/sbin/zfs receive -u %s.import", path, dataset)
+	if err := c.runAsRoot(ctx, "import checkpoint", cmd); err != nil {
+		return fmt.Errorf("running ZFS receive: %w", err)
+	}
+	return nil
+}
 
-	for _, p := range []string{dstDataset, snapshotID} {
+// SwapContainerRootfs replaces the container's dataset with the one
+// [Client.ReceiveContainerRootfs] received. The container must be stopped.
+func (c *Client) SwapContainerRootfs(ctx context.Context, containerName string) error {
+	dataset, err := c.ContainerDataset(ctx, containerName)
+	if err != nil {
+		return err
+	}
+	if err := checkZFSPaths(dataset); err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("/usr/sbin/zfs destroy -r %s && /usr/sbin/zfs rename %s.import %s && %s",
+		dataset, dataset, dataset, setHostnameCmd(dataset, containerName))
+	if err := c.runAsRoot(ctx, "import checkpoint", cmd); err != nil {
+		return fmt.Errorf("replacing dataset: %w", err)
+	}
+	return nil
+}
+
+// setHostnameCmd returns a shell command that mounts dataset and writes
+// hostname to its rootfs, so a container built from another's filesystem
+// doesn't boot with the other's name. The rootfs may come from an
+// untrusted archive: it is mounted nosuid,nodev, the write is refused if
+// rootfs or etc is a link, and the new file is renamed over etc/hostname,
+// which replaces a link there instead of following it.
+func setHostnameCmd(dataset, hostname string) string {
+	return fmt.Sprintf("tmp=$(mktemp -d) && mount -t zfs -o nosuid,nodev %s \"$tmp\" && {"+
+		" etc=\"$tmp/rootfs/etc\"; rc=1;"+
+		" if [ ! -L \"$tmp/rootfs\" ] && [ ! -L \"$etc\" ] && [ -d \"$etc\" ] && f=$(mktemp \"$etc/.hostname.XXXXXX\"); then"+
+		" echo '%s' > \"$f\" && chmod 644 \"$f\" && mv -f -T \"$f\" \"$etc/hostname\"; rc=$?; fi;"+
+		" umount \"$tmp\" && rmdir \"$tmp\" && [ $rc -eq 0 ]; }", dataset, hostname)
+}
+
+// checkZFSPaths rejects dataset names and paths that would need quoting in
+// a shell command.
+func checkZFSPaths(paths ...string) error {
+	for _, p := range paths {
 		for _, ch := range p {
 			if !isZFSPathChar(ch) {
 				return fmt.Errorf("unsafe character %q in ZFS path %q", string(ch), p)
 			}
 		}
 	}
+	return nil
+}
 
-	cmd := fmt.Sprintf(
-		"/usr/sbin/zfs destroy -r %s && /usr/sbin/zfs clone %s %s"+
-			" && tmp=$(mktemp -d) && mount -t zfs %s \"$tmp\""+
-			" && echo '%s' > \"$tmp/rootfs/etc/hostname\""+
-			" && umount \"$tmp\" && rmdir \"$tmp\"",
-		dstDataset, snapshotID, dstDataset, dstDataset, containerName,
-	)
-
+// runAsRoot runs a shell command as root on the TrueNAS host. The API has
+// no direct way to do that, so it goes through a temporary, disabled cron
+// job that is run once and deleted.
+func (c *Client) runAsRoot(ctx context.Context, what, cmd string) error {
 	job, err := c.Cron.Create(ctx, truenas.CreateCronJobOpts{
 		Command:     cmd,
 		User:        "root",
-		Description: "pixels: clone checkpoint (temporary)",
+		Description: "pixels: " + what + " (temporary)",
 		Enabled:     false,
 		Schedule: truenas.Schedule{
 			Minute: "00",
@@ -492,11 +900,7 @@ func (c *Client) ReplaceContainerRootfs(ctx context.Context, containerName, snap
 		_ = c.Cron.Delete(ctx, job.ID)
 	}()
 
-	if err := c.Cron.Run(ctx, job.ID, false); err != nil {
-		return fmt.Errorf("running ZFS clone: %w", err)
-	}
-
-	return nil
+	return c.Cron.Run(ctx, job.ID, false)
 }
 
 // WriteAuthorizedKey writes an SSH public key to a running container's
@@ -2,11 +2,15 @@ package truenas
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"strings"
 	"testing"
 
 	truenas "github.com/deevus/truenas-go"
+	"github.com/deevus/truenas-go/client"
+
+	"github.com/deevus/pixels/sandbox"
 )
 
 // physicalUp returns a physical, UP interface with the given name and IPv4 alias.
@@ -738,6 +742,55 @@ func TestCreateInstance(t *testing.T) {
 			t.Errorf("expected no devices, got %v", captured.Devices)
 		}
 	})
+
+	t.Run("with mounts", func(t *testing.T) {
+		_, err := c.CreateInstance(context.Background(), CreateInstanceOpts{
+			Name: "px-mnt", Image: "ubuntu/24.04",
+			Mounts: []sandbox.Mount{{Source: "/mnt/tank/data", Target: "/data", ReadOnly: true}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(captured.Devices) != 1 {
+			t.Fatalf("expected 1 device, got %v", captured.Devices)
+		}
+		d := captured.Devices[0]
+		if d.DevType != "DISK" || d.Source != "/mnt/tank/data" || d.Destination != "/data" || !d.Readonly {
+			t.Errorf("disk device = %+v", d)
+		}
+	})
+}
+
+func TestUpdateInstanceLimits(t *testing.T) {
+	var calls []any
+	c := &Client{ws: &client.MockClient{
+		CallAndWaitFunc: func(ctx context.Context, method string, params any) (json.RawMessage, error) {
+			if method != "virt.instance.update" {
+				t.Errorf("method = %q, want virt.instance.update", method)
+			}
+			calls = append(calls, params)
+			return nil, nil
+		},
+	}}
+
+	if err := c.UpdateInstanceLimits(context.Background(), "px-test", "4", 8<<30); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("calls = %d, want 1", len(calls))
+	}
+	args := calls[0].([]any)
+	params := args[1].(map[string]any)
+	if args[0] != "px-test" || params["cpu"] != "4" || params["memory"] != int64(8<<30) {
+		t.Errorf("params = %v", args)
+	}
+
+	if err := c.UpdateInstanceLimits(context.Background(), "px-test", "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Error("empty limits still called virt.instance.update")
+	}
 }
 
 func TestListInstances(t *testing.T) {
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/deevus/pixels/internal/egress"
 )
 
 // tnConfig holds parsed backend configuration.
@@ -30,9 +32,14 @@ type tnConfig struct {
 
 	datasetPrefix string
 
+	forwardDir string // where SSH tunnel PIDs and logs are kept
+
+	statsOverSSH bool // Stats may fall back to asking the container
+
 	provision bool
 	devtools  bool
 	egress    string
+	dnsFilter bool
 	allow     []string
 	dns       []string
 
@@ -115,6 +122,16 @@ func parseCfg(m map[string]string) (*tnConfig, error) {
 		c.datasetPrefix = v
 	}
 
+	c.forwardDir = expandHome(m["forward_dir"])
+
+	if v := m["stats_over_ssh"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stats_over_ssh %q: %w", v, err)
+		}
+		c.statsOverSSH = b
+	}
+
 	if v := m["provision"]; v != "" {
 		b, err := strconv.ParseBool(v)
 		if err != nil {
@@ -130,12 +147,20 @@ func parseCfg(m map[string]string) (*tnConfig, error) {
 		c.devtools = b
 	}
 	if v := m["egress"]; v != "" {
-		switch v {
-		case "unrestricted", "agent", "allowlist":
-			c.egress = v
-		default:
-			return nil, fmt.Errorf("invalid egress %q: must be unrestricted, agent, or allowlist", v)
+		if err := egress.ValidateEgress(v); err != nil {
+			return nil, fmt.Errorf("invalid egress %q: %w", v, err)
+		}
+		c.egress = v
+	}
+	if v := m["enforce"]; v != "" && v != "container" {
+		return nil, fmt.Errorf("invalid enforce %q: the truenas backend only enforces egress inside the container", v)
+	}
+	if v := m["dns_filter"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns_filter %q: %w", v, err)
 		}
+		c.dnsFilter = b
 	}
 	if v := m["allow"]; v != "" {
 		c.allow = strings.Split(v, ",")
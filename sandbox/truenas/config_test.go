@@ -171,6 +171,34 @@ func TestParseCfg(t *testing.T) {
 			cfg:     map[string]string{"host": "nas", "api_key": "k", "egress": "deny-all"},
 			wantErr: "invalid egress",
 		},
+		{
+			name:    "host enforcement unsupported",
+			cfg:     map[string]string{"host": "nas", "api_key": "k", "enforce": "host"},
+			wantErr: "invalid enforce",
+		},
+		{
+			name: "dns_filter parsed",
+			cfg:  map[string]string{"host": "nas", "api_key": "k", "dns_filter": "true"},
+			check: func(t *testing.T, c *tnConfig) {
+				if !c.dnsFilter {
+					t.Error("dnsFilter = false, want true")
+				}
+			},
+		},
+		{
+			name:    "invalid dns_filter",
+			cfg:     map[string]string{"host": "nas", "api_key": "k", "dns_filter": "maybe"},
+			wantErr: "invalid dns_filter",
+		},
+		{
+			name: "stats_over_ssh parsed",
+			cfg:  map[string]string{"host": "nas", "api_key": "k", "stats_over_ssh": "true"},
+			check: func(t *testing.T, c *tnConfig) {
+				if !c.statsOverSSH {
+					t.Error("statsOverSSH = false, want true")
+				}
+			},
+		},
 		{
 			name: "env_forward_keys parsed",
 			cfg: map[string]string{
@@ -0,0 +1,24 @@
+package truenas
+
+import (
+	"os"
+	"testing"
+
+	"github.com/deevus/pixels/sandbox"
+	"github.com/deevus/pixels/sandbox/sandboxtest"
+)
+
+// TestConformance runs the shared backend suite against a real TrueNAS
+// host. It creates and deletes px-sbt-* containers, so it only runs when
+// PIXELS_CONFORMANCE_TRUENAS_HOST and PIXELS_CONFORMANCE_TRUENAS_API_KEY
+// are set.
+func TestConformance(t *testing.T) {
+	cfg := map[string]string{
+		"host":    sandboxtest.Env(t, "PIXELS_CONFORMANCE_TRUENAS_HOST"),
+		"api_key": sandboxtest.Env(t, "PIXELS_CONFORMANCE_TRUENAS_API_KEY"),
+		"ssh_key": os.Getenv("PIXELS_CONFORMANCE_TRUENAS_SSH_KEY"),
+	}
+	sandboxtest.Run(t, func(cfg map[string]string) (sandbox.Sandbox, error) {
+		return New(cfg)
+	}, cfg)
+}
@@ -0,0 +1,54 @@
+package truenas
+
+import (
+	"errors"
+
+	"github.com/deevus/truenas-go/client"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// errnoKinds maps the errnos the middleware reports to sandbox error kinds.
+// The server is Linux, so these are Linux errno values whatever the
+// client's OS. EBUSY comes back when a snapshot still has dependent clones.
+var errnoKinds = map[string]struct {
+	errno int
+	kind  error
+}{
+	"ENOENT": {2, sandbox.ErrNotFound},
+	"EEXIST": {17, sandbox.ErrAlreadyExists},
+	"EBUSY":  {16, sandbox.ErrSnapshotInUse},
+	"ENOSPC": {28, sandbox.ErrQuotaExceeded},
+	"EDQUOT": {122, sandbox.ErrQuotaExceeded},
+}
+
+// wrapError marks a TrueNAS error with its sandbox error kind, going by
+// the errno of a middleware or job error where there is one and by
+// sandbox.WrapError otherwise.
+func wrapError(err error) error {
+	var rpcErr *client.JSONRPCError
+	if errors.As(err, &rpcErr) {
+		if rpcErr.Code == client.ErrCodeTooManyConcurrent {
+			return sandbox.Wrap(sandbox.ErrUnavailable, err)
+		}
+		for _, e := range errnoKinds {
+			if rpcErr.Data != nil && rpcErr.Data.Error == e.errno {
+				return sandbox.Wrap(e.kind, err)
+			}
+		}
+	}
+	var tnErr *client.TrueNASError
+	if errors.As(err, &tnErr) {
+		if e, ok := errnoKinds[tnErr.Code]; ok {
+			return sandbox.Wrap(e.kind, err)
+		}
+	}
+	return sandbox.WrapError(err)
+}
+
+// wrapLookupError is wrapError for looking up one instance or snapshot,
+// where an upstream "does not exist" message without an errno still means
+// the target is missing.
+func wrapLookupError(err error) error {
+	return sandbox.WrapLookupError(wrapError(err))
+}
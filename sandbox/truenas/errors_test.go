@@ -0,0 +1,41 @@
+package truenas
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/deevus/truenas-go/client"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"rpc errno", &client.JSONRPCError{Code: client.ErrCodeTrueNASCall, Message: "x", Data: &client.JSONRPCData{Error: 17}}, sandbox.ErrAlreadyExists},
+		{"rpc quota", &client.JSONRPCError{Code: client.ErrCodeTrueNASCall, Message: "x", Data: &client.JSONRPCData{Error: 122}}, sandbox.ErrQuotaExceeded},
+		{"rpc busy", &client.JSONRPCError{Code: client.ErrCodeTooManyConcurrent, Message: "x"}, sandbox.ErrUnavailable},
+		{"job error", client.ParseTrueNASError("[EBUSY] snapshot has dependent clones"), sandbox.ErrSnapshotInUse},
+		{"job not found", client.ParseTrueNASError("[ENOENT] tank/px-a@x not found"), sandbox.ErrNotFound},
+	}
+	for _, tt := range tests {
+		err := wrapError(fmt.Errorf("op: %w", tt.err))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: wrapError(%v) = %v, want %v", tt.name, tt.err, err, tt.want)
+		}
+	}
+}
+
+func TestWrapLookupError(t *testing.T) {
+	if err := wrapLookupError(fmt.Errorf("op: %w", errors.New("VirtInstance px-a does not exist"))); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("wrapLookupError = %v, want ErrNotFound", err)
+	}
+	// Outside a lookup, the same text doesn't decide the kind.
+	if err := wrapError(errors.New("cat: /etc/x: No such file or directory")); sandbox.ErrorCode(err) != "" {
+		t.Errorf("wrapError = %v, want no kind", err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/deevus/pixels/internal/retry"
@@ -54,6 +56,34 @@ func (t *TrueNAS) Run(ctx context.Context, name string, opts sandbox.ExecOpts) (
 	return t.ssh.Exec(ctx, cc, opts.Cmd)
 }
 
+// StartProcess runs a command in the background over its own SSH session.
+// Signals are sent with `kill` over a second session as root.
+func (t *TrueNAS) StartProcess(ctx context.Context, name string, opts sandbox.ExecOpts) (sandbox.Process, error) {
+	if _, err := t.ensureRunning(ctx, name); err != nil {
+		return nil, err
+	}
+	run := func(ctx context.Context, cmd []string, stdout, stderr io.Writer) (int, error) {
+		return t.Run(ctx, name, sandbox.ExecOpts{
+			Cmd:    cmd,
+			Env:    opts.Env,
+			Stdout: stdout,
+			Stderr: stderr,
+			Root:   opts.Root,
+		})
+	}
+	signal := func(ctx context.Context, pid int, sig syscall.Signal) error {
+		rc, err := t.Run(ctx, name, sandbox.ExecOpts{Cmd: sandbox.KillCommand(pid, sig), Root: true})
+		if err != nil {
+			return err
+		}
+		if rc != 0 {
+			return fmt.Errorf("kill exited with code %d", rc)
+		}
+		return nil
+	}
+	return sandbox.RunInBackground(ctx, opts.Cmd, run, signal)
+}
+
 // Output executes a command and returns its combined stdout.
 func (t *TrueNAS) Output(ctx context.Context, name string, cmd []string) ([]byte, error) {
 	if _, err := t.ensureRunning(ctx, name); err != nil {
@@ -91,13 +121,10 @@ func (t *TrueNAS) Ready(ctx context.Context, name string, timeout time.Duration)
 	// is single-shot; this is the polling equivalent that handles slow DHCP
 	// after a fresh boot or rootfs clone.
 	if err := retry.Poll(ctx, time.Second, timeout, func(ctx context.Context) (bool, error) {
-		inst, err := t.client.Virt.GetInstance(ctx, full)
+		inst, err := t.lookup(ctx, name)
 		if err != nil {
 			return false, fmt.Errorf("refreshing instance: %w", err)
 		}
-		if inst == nil {
-			return false, fmt.Errorf("instance %q not found", name)
-		}
 		if inst.Status != "RUNNING" {
 			return false, nil // keep polling; container may still be starting
 		}
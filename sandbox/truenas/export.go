@@ -0,0 +1,140 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	tnapi "github.com/deevus/truenas-go"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// streamFile is the name a ZFS send stream is staged under, in a
+// directory from [Client.NewStaging], while it is exported or imported.
+const streamFile = "stream"
+
+// importChunk is how much of an imported stream each file_receive call
+// uploads; the API takes a whole file per message.
+const importChunk = 16 << 20
+
+// ExportSnapshot writes a ZFS send stream of the snapshot in a checkpoint
+// archive. A root cron job stages the stream on the host, outside the
+// container, and it is read back through the API's download endpoint.
+func (t *TrueNAS) ExportSnapshot(ctx context.Context, name, label string, w io.Writer) error {
+	inst, err := t.lookup(ctx, name)
+	if err != nil {
+		return err
+	}
+	ds, err := t.resolveDataset(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := t.requireSnapshot(ctx, ds, label); err != nil {
+		return err
+	}
+	m := sandbox.NewExportManifest(backendName, toInstance(inst), label)
+	if m.Policy, err = t.snapshotPolicy(ctx, ds+"@"+label); err != nil {
+		return err
+	}
+
+	dir, err := t.client.NewStaging(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.client.RemoveStaging(context.WithoutCancel(ctx), dir)
+
+	stream := dir + "/" + streamFile
+	if err := t.client.SendSnapshot(ctx, ds+"@"+label, stream); err != nil {
+		return err
+	}
+	r, size, err := t.client.OpenHostFile(ctx, stream)
+	if err != nil {
+		return fmt.Errorf("reading staged checkpoint: %w", err)
+	}
+	defer r.Close()
+
+	return sandbox.WriteExport(w, m, r, size)
+}
+
+// ImportSnapshot creates newName from a checkpoint archive: a stopped
+// shell container is created, the ZFS stream is uploaded in chunks to a
+// staging directory on the host and received beside the shell's dataset
+// by a root cron job, and the received dataset replaces the shell's own.
+// The egress policy the checkpoint was exported with is recorded for it.
+// The shell is deleted if any step fails.
+func (t *TrueNAS) ImportSnapshot(ctx context.Context, newName string, r io.Reader) error {
+	return sandbox.ReadExport(r, backendName, func(m *sandbox.ExportManifest, payload io.Reader) error {
+		if _, err := t.lookup(ctx, newName); err == nil {
+			return fmt.Errorf("instance %s: %w", newName, sandbox.ErrAlreadyExists)
+		}
+
+		env := metadataEnv(m.Image, m.Egress, m.Labels, time.Now())
+		env[envOrigin] = m.Origin()
+		if err := t.createShell(ctx, newName, m.CPU, m.Memory, env); err != nil {
+			return err
+		}
+		err := t.importInto(ctx, newName, payload)
+		if err == nil && m.Policy != nil {
+			err = t.importPolicy(ctx, newName, m.Label, *m.Policy)
+		}
+		if err != nil {
+			_ = t.Delete(context.WithoutCancel(ctx), newName)
+			return err
+		}
+		return nil
+	})
+}
+
+// importInto replaces the stopped shell newName's dataset with the ZFS
+// stream read from payload, then starts it.
+func (t *TrueNAS) importInto(ctx context.Context, newName string, payload io.Reader) error {
+	full := prefixed(newName)
+	dir, err := t.client.NewStaging(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.client.RemoveStaging(context.WithoutCancel(ctx), dir)
+
+	stream := dir + "/" + streamFile
+	buf := make([]byte, importChunk)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(payload, buf)
+		if n > 0 {
+			chunk := fmt.Sprintf("%s.%04d", stream, i)
+			if err := t.client.Filesystem.WriteFile(ctx, chunk, tnapi.WriteFileParams{Content: buf[:n], Mode: 0o600}); err != nil {
+				return fmt.Errorf("uploading checkpoint: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading checkpoint: %w", err)
+		}
+	}
+	if err := t.client.ReceiveContainerRootfs(ctx, full, stream); err != nil {
+		return err
+	}
+	if err := t.client.SwapContainerRootfs(ctx, full); err != nil {
+		return err
+	}
+	if err := t.client.Virt.StartInstance(ctx, full); err != nil {
+		return fmt.Errorf("starting %s: %w", newName, err)
+	}
+	return nil
+}
+
+// importPolicy records p, the policy an imported checkpoint was exported
+// with, as newName's and its checkpoint's.
+func (t *TrueNAS) importPolicy(ctx context.Context, newName, label string, p sandbox.Policy) error {
+	if err := t.writePolicy(ctx, newName, p); err != nil {
+		return err
+	}
+	ds, err := t.resolveDataset(ctx, newName)
+	if err != nil {
+		return err
+	}
+	return t.copyPolicy(ctx, ds, ds+"@"+label)
+}
@@ -21,7 +21,7 @@ import (
 // BuildBase behaviour.
 func (t *TrueNAS) WriteFile(ctx context.Context, name, path string, content []byte, mode os.FileMode, uid, gid int) error {
 	if err := t.client.WriteContainerFile(ctx, prefixed(name), path, content, mode); err != nil {
-		return err
+		return wrapError(err)
 	}
 	if uid < 0 || gid < 0 {
 		return nil
@@ -0,0 +1,161 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/deevus/pixels/internal/ssh"
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Forwards are `ssh -N -L` tunnels to the container, run as detached
+// processes on this machine. Each instance's tunnels are recorded in
+// <forward_dir>/<container>.json so later invocations can list and stop
+// them; records whose process has died, or whose PID now belongs to some
+// other process, are dropped on the next read.
+
+// forwardRecord is one tunnel in an instance's forward file.
+type forwardRecord struct {
+	Name   string `json:"name"`
+	Listen string `json:"listen"`
+	Port   int    `json:"port"`
+	ssh.Tunnel
+}
+
+// AddForward starts an SSH tunnel from f.Listen to the port on the
+// container's loopback.
+func (t *TrueNAS) AddForward(ctx context.Context, name string, f sandbox.Forward) error {
+	if _, err := t.ensureRunning(ctx, name); err != nil {
+		return err
+	}
+	recs, err := t.readForwards(name)
+	if err != nil {
+		return err
+	}
+	for _, r := range recs {
+		if r.Name == f.Name {
+			return fmt.Errorf("forward %s on %s: %w", f.Name, name, sandbox.ErrAlreadyExists)
+		}
+	}
+
+	if err := os.MkdirAll(t.cfg.forwardDir, 0o700); err != nil {
+		return fmt.Errorf("creating forward dir: %w", err)
+	}
+
+	full := prefixed(name)
+	cc := ssh.NewConnConfig(full, t.cfg.sshUser, t.cfg.sshKey, t.cfg.knownHosts)
+	logPath := filepath.Join(t.cfg.forwardDir, full+"-"+f.Name+".log")
+	tun, err := t.ssh.StartForward(ctx, cc, f.Listen, f.Port, logPath)
+	if err != nil {
+		return fmt.Errorf("forwarding %s to %s:%d: %w", f.Listen, name, f.Port, err)
+	}
+
+	recs = append(recs, forwardRecord{Name: f.Name, Listen: f.Listen, Port: f.Port, Tunnel: tun})
+	if err := t.writeForwards(name, recs); err != nil {
+		_ = t.ssh.StopForward(tun)
+		return err
+	}
+	return nil
+}
+
+// ListForwards returns the instance's running tunnels.
+func (t *TrueNAS) ListForwards(ctx context.Context, name string) ([]sandbox.Forward, error) {
+	if _, err := t.lookup(ctx, name); err != nil {
+		return nil, err
+	}
+	recs, err := t.readForwards(name)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sandbox.Forward, 0, len(recs))
+	for _, r := range recs {
+		out = append(out, sandbox.Forward{Name: r.Name, Listen: r.Listen, Port: r.Port})
+	}
+	return out, nil
+}
+
+// RemoveForward stops a tunnel by name.
+func (t *TrueNAS) RemoveForward(ctx context.Context, name, forward string) error {
+	if _, err := t.lookup(ctx, name); err != nil {
+		return err
+	}
+	recs, err := t.readForwards(name)
+	if err != nil {
+		return err
+	}
+	for i, r := range recs {
+		if r.Name != forward {
+			continue
+		}
+		if err := t.ssh.StopForward(r.Tunnel); err != nil {
+			return err
+		}
+		os.Remove(filepath.Join(t.cfg.forwardDir, prefixed(name)+"-"+forward+".log"))
+		return t.writeForwards(name, append(recs[:i], recs[i+1:]...))
+	}
+	return fmt.Errorf("forward %s/%s: %w", name, forward, sandbox.ErrNotFound)
+}
+
+// stopForwards stops every tunnel to a deleted instance. Best-effort.
+func (t *TrueNAS) stopForwards(name string) {
+	if t.cfg.forwardDir == "" {
+		return
+	}
+	recs, _ := t.readForwards(name)
+	for _, r := range recs {
+		_ = t.ssh.StopForward(r.Tunnel)
+		os.Remove(filepath.Join(t.cfg.forwardDir, prefixed(name)+"-"+r.Name+".log"))
+	}
+	os.Remove(t.forwardFile(name))
+}
+
+func (t *TrueNAS) forwardFile(name string) string {
+	return filepath.Join(t.cfg.forwardDir, prefixed(name)+".json")
+}
+
+// readForwards loads the instance's tunnel records, keeping only those whose
+// process is still running.
+func (t *TrueNAS) readForwards(name string) ([]forwardRecord, error) {
+	if t.cfg.forwardDir == "" {
+		return nil, errors.New("port forwarding needs forward_dir to be configured")
+	}
+	data, err := os.ReadFile(t.forwardFile(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading forwards: %w", err)
+	}
+	var recs []forwardRecord
+	if err := json.Unmarshal(data, &recs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", t.forwardFile(name), err)
+	}
+	live := recs[:0]
+	for _, r := range recs {
+		if t.ssh.ForwardRunning(r.Tunnel) {
+			live = append(live, r)
+		}
+	}
+	return live, nil
+}
+
+func (t *TrueNAS) writeForwards(name string, recs []forwardRecord) error {
+	if len(recs) == 0 {
+		if err := os.Remove(t.forwardFile(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing forwards file: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(recs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(t.forwardFile(name), data, 0o600); err != nil {
+		return fmt.Errorf("writing forwards: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tnapi "github.com/deevus/truenas-go"
+
+	"github.com/deevus/pixels/internal/ssh"
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestForwards(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testCfg()
+	cfg["forward_dir"] = dir
+	mock := &mockSSH{}
+	tn, err := NewForTest(&Client{
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{
+					Name:    name,
+					Status:  "RUNNING",
+					Aliases: []tnapi.VirtAlias{{Type: "INET", Address: "10.0.0.5"}},
+				}, nil
+			},
+		},
+	}, mock, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	web := sandbox.Forward{Name: "8080", Listen: "127.0.0.1:8080", Port: 3000}
+	if err := tn.AddForward(ctx, "box", web); err != nil {
+		t.Fatalf("AddForward: %v", err)
+	}
+	if err := tn.AddForward(ctx, "box", web); err == nil {
+		t.Error("duplicate AddForward: want error")
+	}
+	if err := tn.AddForward(ctx, "box", sandbox.Forward{Name: "5432", Listen: "127.0.0.1:5432", Port: 5432}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "px-box.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []forwardRecord
+	if err := json.Unmarshal(data, &recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Tunnel != (ssh.Tunnel{PID: 1000, Start: "1"}) {
+		t.Errorf("forward records = %+v, want the tunnel's PID and start time", recs)
+	}
+
+	got, err := tn.ListForwards(ctx, "box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != web {
+		t.Errorf("ListForwards = %+v", got)
+	}
+
+	// A tunnel that died on its own drops out of the list.
+	mock.tunnels[1001] = false
+	if got, _ := tn.ListForwards(ctx, "box"); len(got) != 1 {
+		t.Errorf("ListForwards after tunnel exit = %+v, want only 8080", got)
+	}
+
+	if err := tn.RemoveForward(ctx, "box", "8080"); err != nil {
+		t.Fatalf("RemoveForward: %v", err)
+	}
+	if mock.tunnels[1000] {
+		t.Error("tunnel still running after RemoveForward")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "px-box.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("forward file left behind: %v", err)
+	}
+	if err := tn.RemoveForward(ctx, "box", "8080"); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("RemoveForward twice = %v, want ErrNotFound", err)
+	}
+}
+
+func TestForwardsNeedDir(t *testing.T) {
+	tn := newTestBackend(t, &Client{
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING", Aliases: []tnapi.VirtAlias{{Type: "INET", Address: "10.0.0.5"}}}, nil
+			},
+		},
+	})
+	err := tn.AddForward(context.Background(), "box", sandbox.Forward{Name: "80", Listen: "127.0.0.1:80", Port: 80})
+	if err == nil {
+		t.Error("AddForward without forward_dir: want error")
+	}
+}
@@ -0,0 +1,84 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	tnapi "github.com/deevus/truenas-go"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// The virt API has no user config keys, so pixels keeps its metadata in the
+// instance environment. Labels are stored as PIXELS_LABEL_<key>.
+const (
+	envImage       = "PIXELS_IMAGE"
+	envOrigin      = "PIXELS_ORIGIN"
+	envEgress      = "PIXELS_EGRESS"
+	envCreated     = "PIXELS_CREATED"
+	envLabelPrefix = "PIXELS_LABEL_"
+)
+
+// metadataEnv returns the environment recording a new instance's metadata.
+func metadataEnv(image string, mode sandbox.EgressMode, labels map[string]string, now time.Time) map[string]string {
+	env := map[string]string{
+		envImage:   image,
+		envEgress:  string(mode),
+		envCreated: now.UTC().Format(time.RFC3339),
+	}
+	for k, v := range labels {
+		env[envLabelPrefix+k] = v
+	}
+	return env
+}
+
+// recordEgress stores mode in the instance environment so Get and List can
+// report it without probing the container.
+func (t *TrueNAS) recordEgress(ctx context.Context, inst *tnapi.VirtInstance, mode sandbox.EgressMode) error {
+	if inst.Environment[envEgress] == string(mode) {
+		return nil
+	}
+	env := maps.Clone(inst.Environment)
+	if env == nil {
+		env = map[string]string{}
+	}
+	env[envEgress] = string(mode)
+	if _, err := t.client.Virt.UpdateInstance(ctx, inst.Name, tnapi.UpdateVirtInstanceOpts{Environment: env}); err != nil {
+		return fmt.Errorf("recording egress mode: %w", err)
+	}
+	return nil
+}
+
+// toInstance converts a truenas-go VirtInstance to a sandbox.Instance.
+func toInstance(inst *tnapi.VirtInstance) *sandbox.Instance {
+	env := inst.Environment
+	out := &sandbox.Instance{
+		Name:        unprefixed(inst.Name),
+		Status:      sandbox.Status(inst.Status),
+		Addresses:   collectAddresses(inst.Aliases, false),
+		AddressesV6: collectAddresses(inst.Aliases, true),
+		Image:       env[envImage],
+		Origin:      env[envOrigin],
+		CPU:         inst.CPU,
+		Memory:      inst.Memory,
+		Egress:      sandbox.EgressMode(env[envEgress]),
+	}
+	if out.Image == "" {
+		out.Image = inst.Image.Description
+	}
+	if t, err := time.Parse(time.RFC3339, env[envCreated]); err == nil {
+		out.CreatedAt = t
+	}
+	for k, v := range env {
+		if key, ok := strings.CutPrefix(k, envLabelPrefix); ok {
+			if out.Labels == nil {
+				out.Labels = map[string]string{}
+			}
+			out.Labels[key] = v
+		}
+	}
+	return out
+}
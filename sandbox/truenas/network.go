@@ -1,9 +1,12 @@
 package truenas
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"slices"
 
 	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/ssh"
@@ -15,11 +18,15 @@ import (
 // For "unrestricted": flushes nftables, removes egress files, restores
 // blanket sudoers.
 //
-// For "agent"/"allowlist": writes nftables config, domains/cidrs, resolve
-// script, safe-apt wrapper, restricted sudoers via the TrueNAS API, then
-// SSHes in to install nftables and resolve domains.
+// For "allowlist" and presets such as "agent" or "agent,rust": writes
+// nftables config, domains/cidrs, resolve script, safe-apt wrapper,
+// restricted sudoers via the TrueNAS API, then SSHes in to install
+// nftables and resolve domains.
+//
+// For "learn": records egress in place of filtering it; see setLearnMode.
 func (t *TrueNAS) SetEgressMode(ctx context.Context, name string, mode sandbox.EgressMode) error {
-	if _, err := t.ensureRunning(ctx, name); err != nil {
+	inst, err := t.ensureRunning(ctx, name)
+	if err != nil {
 		return err
 	}
 	full := prefixed(name)
@@ -29,9 +36,11 @@ func (t *TrueNAS) SetEgressMode(ctx context.Context, name string, mode sandbox.E
 	case sandbox.EgressUnrestricted:
 		// Flush nftables.
 		t.ssh.ExecQuiet(ctx, cc, []string{"nft flush ruleset"})
+		t.ssh.ExecQuiet(ctx, cc, []string{egress.StopDNSFilterScript()})
+		t.ssh.ExecQuiet(ctx, cc, []string{egress.StopRefreshScript()})
 
 		// Remove egress files.
-		t.ssh.ExecQuiet(ctx, cc, []string{"rm -f /etc/pixels-egress-domains /etc/pixels-egress-cidrs /etc/nftables.conf /usr/local/bin/pixels-resolve-egress.sh /usr/local/bin/safe-apt"})
+		t.ssh.ExecQuiet(ctx, cc, []string{"rm -f /etc/pixels-egress-domains /etc/pixels-egress-cidrs " + egress.LearnFile + " /etc/nftables.conf /usr/local/bin/pixels-resolve-egress.sh /usr/local/bin/safe-apt"})
 
 		// Restore blanket sudoers.
 		if err := t.client.WriteContainerFile(ctx, full, "/etc/sudoers.d/pixel", []byte(egress.SudoersUnrestricted()), 0o440); err != nil {
@@ -40,11 +49,35 @@ func (t *TrueNAS) SetEgressMode(ctx context.Context, name string, mode sandbox.E
 		// Remove restricted sudoers if present.
 		t.ssh.ExecQuiet(ctx, cc, []string{"rm -f /etc/sudoers.d/pixel.restricted"})
 
-		return nil
+		if err := t.writePolicy(ctx, name, egress.NewPolicy(mode, nil)); err != nil {
+			return err
+		}
+		return t.recordEgress(ctx, inst, mode)
 
-	case sandbox.EgressAgent, sandbox.EgressAllowlist:
-		egressName := string(mode)
-		domains := egress.ResolveDomains(egressName, t.cfg.allow)
+	case sandbox.EgressLearn:
+		// Without a record, learning starts from an empty list.
+		prev, err := t.readPolicy(ctx, name)
+		if err != nil && !errors.Is(err, egress.ErrNoRecord) {
+			return err
+		}
+		if err := t.setLearnMode(ctx, full, cc); err != nil {
+			return err
+		}
+		if err := t.writePolicy(ctx, name, egress.LearnPolicy(prev)); err != nil {
+			return err
+		}
+		return t.recordEgress(ctx, inst, mode)
+
+	default:
+		if err := egress.ValidateEgress(string(mode)); err != nil {
+			return err
+		}
+		policy := egress.NewPolicy(mode, t.cfg.allow)
+		domains := policy.Domains
+		t.ssh.ExecQuiet(ctx, cc, []string{"rm -f " + egress.LearnFile})
+		if !t.cfg.dnsFilter {
+			t.ssh.ExecQuiet(ctx, cc, []string{egress.StopDNSFilterScript()})
+		}
 
 		// Write domain list.
 		if err := t.client.WriteContainerFile(ctx, full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(domains)), 0o644); err != nil {
@@ -52,7 +85,7 @@ func (t *TrueNAS) SetEgressMode(ctx context.Context, name string, mode sandbox.E
 		}
 
 		// Write CIDRs if any.
-		cidrs := egress.PresetCIDRs(egressName)
+		cidrs := policy.CIDRs
 		if len(cidrs) > 0 {
 			if err := t.client.WriteContainerFile(ctx, full, "/etc/pixels-egress-cidrs", []byte(egress.CIDRsFileContent(cidrs)), 0o644); err != nil {
 				return fmt.Errorf("writing egress cidrs: %w", err)
@@ -69,6 +102,20 @@ func (t *TrueNAS) SetEgressMode(ctx context.Context, name string, mode sandbox.E
 			return fmt.Errorf("writing resolve script: %w", err)
 		}
 
+		// Write the DNS filter, if enabled.
+		if t.cfg.dnsFilter {
+			bin, err := egress.DNSFilterBinary()
+			if err != nil {
+				return err
+			}
+			if err := t.client.WriteContainerFile(ctx, full, egress.DNSFilterPath, bin, 0o755); err != nil {
+				return fmt.Errorf("writing DNS filter: %w", err)
+			}
+			if err := t.client.WriteContainerFile(ctx, full, egress.DNSFilterUnitPath, []byte(egress.DNSFilterUnit()), 0o644); err != nil {
+				return fmt.Errorf("writing DNS filter unit: %w", err)
+			}
+		}
+
 		// Write safe-apt wrapper.
 		if err := t.client.WriteContainerFile(ctx, full, "/usr/local/bin/safe-apt", []byte(egress.SafeAptScript()), 0o755); err != nil {
 			return fmt.Errorf("writing safe-apt: %w", err)
@@ -96,15 +143,72 @@ func (t *TrueNAS) SetEgressMode(ctx context.Context, name string, mode sandbox.E
 			return fmt.Errorf("resolving egress: exit code %d", code)
 		}
 
-		return nil
+		if err := t.writePolicy(ctx, name, policy); err != nil {
+			return err
+		}
+		return t.recordEgress(ctx, inst, mode)
 
-	default:
-		return fmt.Errorf("unknown egress mode %q", mode)
 	}
 }
 
+// setLearnMode switches full, reached over cc, to learn mode, keeping its
+// current domain list in the learn file for suggestions to be compared
+// against.
+func (t *TrueNAS) setLearnMode(ctx context.Context, full string, cc ssh.ConnConfig) error {
+	if code, _ := t.ssh.ExecQuiet(ctx, cc, []string{"test -f " + egress.LearnFile}); code != 0 {
+		current, _ := t.ssh.OutputQuiet(ctx, cc, []string{"cat /etc/pixels-egress-domains 2>/dev/null"})
+		if err := t.client.WriteContainerFile(ctx, full, egress.LearnFile, current, 0o644); err != nil {
+			return fmt.Errorf("writing learn file: %w", err)
+		}
+	}
+	t.ssh.ExecQuiet(ctx, cc, []string{"rm -f /etc/pixels-egress-domains /etc/pixels-egress-cidrs /usr/local/bin/safe-apt"})
+
+	if err := t.client.WriteContainerFile(ctx, full, "/etc/nftables.conf", []byte(egress.LearnNftablesConf()), 0o644); err != nil {
+		return fmt.Errorf("writing nftables.conf: %w", err)
+	}
+	if err := t.client.WriteContainerFile(ctx, full, "/usr/local/bin/pixels-resolve-egress.sh", []byte(egress.LearnScript()), 0o755); err != nil {
+		return fmt.Errorf("writing learn script: %w", err)
+	}
+	// The DNS filter names what the container connects to; without it,
+	// names come from the resolver cache.
+	if bin, err := egress.DNSFilterBinary(); err == nil {
+		if err := t.client.WriteContainerFile(ctx, full, egress.DNSFilterPath, bin, 0o755); err != nil {
+			return fmt.Errorf("writing DNS filter: %w", err)
+		}
+		if err := t.client.WriteContainerFile(ctx, full, egress.DNSFilterUnitPath, []byte(egress.DNSFilterUnit()), 0o644); err != nil {
+			return fmt.Errorf("writing DNS filter unit: %w", err)
+		}
+	}
+
+	// Nothing is blocked, so sudo need not be restricted.
+	if err := t.client.WriteContainerFile(ctx, full, "/etc/sudoers.d/pixel", []byte(egress.SudoersUnrestricted()), 0o440); err != nil {
+		return fmt.Errorf("writing unrestricted sudoers: %w", err)
+	}
+	t.ssh.ExecQuiet(ctx, cc, []string{"rm -f /etc/sudoers.d/pixel.restricted"})
+
+	code, err := t.ssh.ExecQuiet(ctx, cc, []string{"command -v nft >/dev/null || DEBIAN_FRONTEND=noninteractive apt-get install -y -o Dpkg::Options::=--force-confold nftables >/dev/null 2>&1"})
+	if err != nil {
+		return fmt.Errorf("installing nftables: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("installing nftables: exit code %d", code)
+	}
+	code, err = t.ssh.ExecQuiet(ctx, cc, []string{"/usr/local/bin/pixels-resolve-egress.sh"})
+	if err != nil {
+		return fmt.Errorf("starting learn mode: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("starting learn mode: exit code %d", code)
+	}
+	return nil
+}
+
 // AllowDomain adds a domain to the egress allowlist and re-resolves.
 func (t *TrueNAS) AllowDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
 	if _, err := t.ensureRunning(ctx, name); err != nil {
 		return err
 	}
@@ -120,104 +224,142 @@ func (t *TrueNAS) AllowDomain(ctx context.Context, name, domain string) error {
 		}
 	}
 
-	// Read current domains.
-	out, err := t.ssh.OutputQuiet(ctx, cc, []string{"cat /etc/pixels-egress-domains"})
+	policy, err := t.readPolicy(ctx, name)
 	if err != nil {
-		return fmt.Errorf("reading domains: %w", err)
+		return err
 	}
-
-	domains := parseDomains(string(out))
-
-	// Check for duplicate.
-	for _, d := range domains {
-		if d == domain {
-			return nil // already allowed
-		}
+	policy = egress.UpgradePolicy(policy)
+	if slices.Contains(policy.Domains, domain) {
+		return nil // already allowed
 	}
-
-	domains = append(domains, domain)
+	policy.Add(domain)
 
 	// Write updated domains via API.
-	if err := t.client.WriteContainerFile(ctx, full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(domains)), 0o644); err != nil {
+	if err := t.client.WriteContainerFile(ctx, full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(policy.Domains)), 0o644); err != nil {
 		return fmt.Errorf("writing domains: %w", err)
 	}
 
 	// Re-resolve.
 	t.ssh.ExecQuiet(ctx, cc, []string{"/usr/local/bin/pixels-resolve-egress.sh"})
 
-	return nil
+	return t.writePolicy(ctx, name, *policy)
 }
 
 // DenyDomain removes a domain from the egress allowlist and re-resolves.
 func (t *TrueNAS) DenyDomain(ctx context.Context, name, domain string) error {
+	domain, err := egress.NormalizeRule(domain)
+	if err != nil {
+		return err
+	}
 	if _, err := t.ensureRunning(ctx, name); err != nil {
 		return err
 	}
 	full := prefixed(name)
 	cc := ssh.NewConnConfig(full, "root", t.cfg.sshKey, t.cfg.knownHosts)
 
-	out, err := t.ssh.OutputQuiet(ctx, cc, []string{"cat /etc/pixels-egress-domains"})
+	policy, err := t.readPolicy(ctx, name)
 	if err != nil {
-		return fmt.Errorf("reading domains: %w", err)
-	}
-
-	domains := parseDomains(string(out))
-	var filtered []string
-	found := false
-	for _, d := range domains {
-		if d == domain {
-			found = true
-			continue
-		}
-		filtered = append(filtered, d)
+		return err
 	}
-	if !found {
+	policy = egress.UpgradePolicy(policy)
+	if !policy.Remove(domain) {
 		return fmt.Errorf("domain %q not in allowlist", domain)
 	}
 
-	if err := t.client.WriteContainerFile(ctx, full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(filtered)), 0o644); err != nil {
+	if err := t.client.WriteContainerFile(ctx, full, "/etc/pixels-egress-domains", []byte(egress.DomainsFileContent(policy.Domains)), 0o644); err != nil {
 		return fmt.Errorf("writing domains: %w", err)
 	}
 
 	// Re-resolve.
 	t.ssh.ExecQuiet(ctx, cc, []string{"/usr/local/bin/pixels-resolve-egress.sh"})
 
-	return nil
+	return t.writePolicy(ctx, name, *policy)
 }
 
-// GetPolicy returns the current egress policy for an instance.
+// GetPolicy returns the recorded egress policy for an instance.
 func (t *TrueNAS) GetPolicy(ctx context.Context, name string) (*sandbox.Policy, error) {
 	if _, err := t.ensureRunning(ctx, name); err != nil {
 		return nil, err
 	}
-	cc := ssh.NewConnConfig(prefixed(name), "root", t.cfg.sshKey, t.cfg.knownHosts)
+	return t.readPolicy(ctx, name)
+}
 
-	code, _ := t.ssh.ExecQuiet(ctx, cc, []string{"test -f /etc/pixels-egress-domains"})
-	if code != 0 {
-		return &sandbox.Policy{Mode: sandbox.EgressUnrestricted}, nil
+// policyProperty is the ZFS user property holding an instance's egress
+// policy record, on its dataset and on each snapshot of it. Kept there,
+// nothing running in the container can rewrite it.
+const policyProperty = "pixels:egress-policy"
+
+// maxPolicyProperty is the longest value ZFS accepts for a user property.
+const maxPolicyProperty = 8192
+
+// encodePolicy returns p as a policyProperty value.
+func encodePolicy(p sandbox.Policy) (string, error) {
+	var b bytes.Buffer
+	if err := json.Compact(&b, egress.MarshalPolicy(p)); err != nil {
+		return "", fmt.Errorf("encoding egress policy: %w", err)
+	}
+	if b.Len() > maxPolicyProperty {
+		return "", fmt.Errorf("egress policy is %d bytes, over the %d a ZFS property holds", b.Len(), maxPolicyProperty)
 	}
+	return b.String(), nil
+}
 
-	out, err := t.ssh.OutputQuiet(ctx, cc, []string{"cat /etc/pixels-egress-domains"})
+// writePolicy records p as name's egress policy.
+func (t *TrueNAS) writePolicy(ctx context.Context, name string, p sandbox.Policy) error {
+	v, err := encodePolicy(p)
 	if err != nil {
-		return nil, fmt.Errorf("reading domains: %w", err)
+		return err
 	}
+	ds, err := t.resolveDataset(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := t.client.SetUserProperty(ctx, ds, policyProperty, v); err != nil {
+		return wrapError(fmt.Errorf("writing egress policy: %w", err))
+	}
+	return nil
+}
 
-	domains := parseDomains(string(out))
-	return &sandbox.Policy{
-		Mode:    sandbox.EgressAllowlist,
-		Domains: domains,
-	}, nil
+// copyPolicy copies the policy record from the dataset or snapshot from to
+// to, removing to's if from has none.
+func (t *TrueNAS) copyPolicy(ctx context.Context, from, to string) error {
+	v, err := t.client.UserProperty(ctx, from, policyProperty)
+	if err != nil {
+		return wrapError(fmt.Errorf("reading egress policy: %w", err))
+	}
+	if err := t.client.SetUserProperty(ctx, to, policyProperty, v); err != nil {
+		return wrapError(fmt.Errorf("writing egress policy: %w", err))
+	}
+	return nil
 }
 
-// parseDomains splits newline-delimited domain content into a slice,
-// trimming whitespace and skipping empty lines.
-func parseDomains(content string) []string {
-	var domains []string
-	for _, line := range strings.Split(content, "\n") {
-		d := strings.TrimSpace(line)
-		if d != "" {
-			domains = append(domains, d)
-		}
+// snapshotPolicy returns the policy recorded on snapshot id, or nil if it
+// was taken without one.
+func (t *TrueNAS) snapshotPolicy(ctx context.Context, id string) (*sandbox.Policy, error) {
+	v, err := t.client.UserProperty(ctx, id, policyProperty)
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("reading egress policy: %w", err))
+	}
+	if v == "" {
+		return nil, nil
+	}
+	return egress.ParsePolicy([]byte(v))
+}
+
+// readPolicy returns name's recorded egress policy. If there is no record,
+// the error wraps egress.ErrNoRecord: nothing in the container is trusted to
+// stand in for it.
+func (t *TrueNAS) readPolicy(ctx context.Context, name string) (*sandbox.Policy, error) {
+	ds, err := t.resolveDataset(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := t.client.UserProperty(ctx, ds, policyProperty)
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("reading egress policy: %w", err))
+	}
+	if v == "" {
+		return nil, fmt.Errorf("%s: %w", name, egress.ErrNoRecord)
 	}
-	return domains
+	return egress.ParsePolicy([]byte(v))
 }
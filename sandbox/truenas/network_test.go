@@ -2,14 +2,20 @@ package truenas
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	tnapi "github.com/deevus/truenas-go"
+	"github.com/deevus/truenas-go/client"
 
+	"github.com/deevus/pixels/internal/egress"
 	"github.com/deevus/pixels/internal/ssh"
 	"github.com/deevus/pixels/sandbox"
 )
@@ -26,6 +32,9 @@ type mockSSH struct {
 	outputFn   func(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error)
 	waitFn     func(ctx context.Context, host string, timeout time.Duration, log io.Writer) error
 	testAuthFn func(ctx context.Context, cc ssh.ConnConfig) error
+
+	// Tunnels started by StartForward, by PID; false once stopped.
+	tunnels map[int]bool
 }
 
 type mockSSHCall struct {
@@ -34,6 +43,45 @@ type mockSSHCall struct {
 	Cmd  []string
 }
 
+// zfsProps fakes ZFS user properties, keyed by dataset or snapshot id and
+// then by property.
+type zfsProps map[string]map[string]string
+
+// client returns a WebSocket client that answers the user property queries
+// and updates from p.
+func (p zfsProps) client() *client.MockClient {
+	return &client.MockClient{
+		CallFunc: func(ctx context.Context, method string, params any) (json.RawMessage, error) {
+			args := params.([]any)
+			switch {
+			case strings.HasSuffix(method, ".query"):
+				id := args[0].([][]any)[0][2].(string)
+				props := map[string]any{}
+				for k, v := range p[id] {
+					props[k] = map[string]string{"value": v, "source": "LOCAL"}
+				}
+				return json.Marshal([]any{map[string]any{"id": id, "user_properties": props, "properties": props}})
+			case strings.HasSuffix(method, ".update"):
+				id := args[0].(string)
+				for _, u := range args[1].(map[string]any)["user_properties_update"].([]any) {
+					u := u.(map[string]any)
+					key := u["key"].(string)
+					if u["remove"] == true {
+						delete(p[id], key)
+						continue
+					}
+					if p[id] == nil {
+						p[id] = map[string]string{}
+					}
+					p[id][key] = u["value"].(string)
+				}
+				return json.RawMessage("true"), nil
+			}
+			return nil, fmt.Errorf("unexpected call %s", method)
+		},
+	}
+}
+
 func (m *mockSSH) Exec(ctx context.Context, cc ssh.ConnConfig, cmd []string) (int, error) {
 	m.execCalls = append(m.execCalls, mockSSHCall{Host: cc.Host, User: cc.User, Cmd: cmd})
 	if m.execFn != nil {
@@ -82,6 +130,22 @@ func (m *mockSSH) TestAuth(ctx context.Context, cc ssh.ConnConfig) error {
 	return nil
 }
 
+func (m *mockSSH) StartForward(ctx context.Context, cc ssh.ConnConfig, listen string, port int, logPath string) (ssh.Tunnel, error) {
+	if m.tunnels == nil {
+		m.tunnels = map[int]bool{}
+	}
+	pid := 1000 + len(m.tunnels)
+	m.tunnels[pid] = true
+	return ssh.Tunnel{PID: pid, Start: "1"}, nil
+}
+
+func (m *mockSSH) ForwardRunning(t ssh.Tunnel) bool { return t.Start != "" && m.tunnels[t.PID] }
+
+func (m *mockSSH) StopForward(t ssh.Tunnel) error {
+	m.tunnels[t.PID] = false
+	return nil
+}
+
 // writeCall records a WriteContainerFile call.
 type writeCall struct {
 	name    string
@@ -101,15 +165,48 @@ func runningInstanceFunc(ip string) func(ctx context.Context, name string) (*tna
 	}
 }
 
+// testDataset is the dataset of px-test under policyClient.
+const testDataset = "tank/ix-virt/containers/px-test"
+
+// allowlistProps returns user properties recording an allowlist of domains
+// as px-test's egress policy.
+func allowlistProps(domains ...string) zfsProps {
+	p := egress.NewPolicy(sandbox.EgressAllowlist, domains)
+	return zfsProps{testDataset: {policyProperty: string(egress.MarshalPolicy(p))}}
+}
+
+// policyClient returns a client for a running px-test with environment env,
+// whose dataset's user properties are kept in props.
+func policyClient(props zfsProps, env map[string]string) *Client {
+	return &Client{
+		ws: props.client(),
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{
+					Name:        name,
+					Status:      "RUNNING",
+					Aliases:     []tnapi.VirtAlias{{Type: "INET", Address: "10.0.0.5"}},
+					Environment: env,
+				}, nil
+			},
+			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
+				return &tnapi.VirtGlobalConfig{Pool: "tank", Dataset: "tank/ix-virt"}, nil
+			},
+		},
+		Filesystem: &tnapi.MockFilesystemService{},
+	}
+}
+
 func TestSetEgressModeUnrestricted(t *testing.T) {
 	var writes []writeCall
 	mssh := &mockSSH{}
 
 	tn, _ := NewForTest(&Client{
+		ws: zfsProps{}.client(),
 		Virt: &tnapi.MockVirtService{
 			GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
-				return &tnapi.VirtGlobalConfig{Pool: "tank"}, nil
+				return &tnapi.VirtGlobalConfig{Pool: "tank", Dataset: "tank/ix-virt"}, nil
 			},
 		},
 		Filesystem: &tnapi.MockFilesystemService{
@@ -163,10 +260,11 @@ func TestSetEgressModeAllowlist(t *testing.T) {
 	mssh := &mockSSH{}
 
 	tn, _ := NewForTest(&Client{
+		ws: zfsProps{}.client(),
 		Virt: &tnapi.MockVirtService{
 			GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
-				return &tnapi.VirtGlobalConfig{Pool: "tank"}, nil
+				return &tnapi.VirtGlobalConfig{Pool: "tank", Dataset: "tank/ix-virt"}, nil
 			},
 		},
 		Filesystem: &tnapi.MockFilesystemService{
@@ -228,20 +326,15 @@ func TestSetEgressModeAllowlist(t *testing.T) {
 
 func TestAllowDomain(t *testing.T) {
 	var lastWritten string
-	mssh := &mockSSH{
-		execFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) (int, error) {
-			return 0, nil
-		},
-		outputFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error) {
-			return []byte("existing.com\n"), nil
-		},
-	}
+	props := allowlistProps("existing.com")
+	mssh := &mockSSH{}
 
 	tn, _ := NewForTest(&Client{
+		ws: props.client(),
 		Virt: &tnapi.MockVirtService{
 			GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
-				return &tnapi.VirtGlobalConfig{Pool: "tank"}, nil
+				return &tnapi.VirtGlobalConfig{Pool: "tank", Dataset: "tank/ix-virt"}, nil
 			},
 		},
 		Filesystem: &tnapi.MockFilesystemService{
@@ -262,23 +355,55 @@ func TestAllowDomain(t *testing.T) {
 	if !strings.Contains(lastWritten, "new.example.com") {
 		t.Error("should append new domain")
 	}
+	p, err := egress.ParsePolicy([]byte(props[testDataset][policyProperty]))
+	if err != nil {
+		t.Fatalf("policy record: %v", err)
+	}
+	if !slices.Equal(p.Domains, []string{"existing.com", "new.example.com"}) {
+		t.Errorf("recorded domains = %v", p.Domains)
+	}
 }
 
-func TestAllowDomainDuplicate(t *testing.T) {
+func TestAllowDomainRecorded(t *testing.T) {
+	props := zfsProps{testDataset: {policyProperty: string(egress.MarshalPolicy(sandbox.Policy{
+		Version: sandbox.PolicyVersion,
+		Mode:    "agent",
+		Presets: []string{"agent"},
+		Deny:    []string{"pypi.org"},
+		Domains: []string{"github.com"},
+	}))}}
 	mssh := &mockSSH{
-		execFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) (int, error) {
-			return 0, nil
-		},
 		outputFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error) {
-			return []byte("example.com\n"), nil
+			t.Errorf("read %q, want the policy record from the dataset", cmd[0])
+			return nil, nil
 		},
 	}
+	tn, _ := NewForTest(policyClient(props, nil), mssh, testCfg())
+
+	for _, d := range []string{"pypi.org", "example.com"} {
+		if err := tn.AllowDomain(context.Background(), "test", d); err != nil {
+			t.Fatalf("AllowDomain(%s): %v", d, err)
+		}
+	}
+	p, err := egress.ParsePolicy([]byte(props[testDataset][policyProperty]))
+	if err != nil {
+		t.Fatalf("policy record: %v", err)
+	}
+	if p.Mode != "agent" || len(p.Deny) != 0 || !slices.Equal(p.Allow, []string{"example.com"}) {
+		t.Errorf("recorded policy = %+v, want pypi.org off Deny and example.com in Allow", p)
+	}
+}
+
+func TestAllowDomainDuplicate(t *testing.T) {
+	props := allowlistProps("example.com")
+	mssh := &mockSSH{}
 
 	tn, _ := NewForTest(&Client{
+		ws: props.client(),
 		Virt: &tnapi.MockVirtService{
 			GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
-				return &tnapi.VirtGlobalConfig{Pool: "tank"}, nil
+				return &tnapi.VirtGlobalConfig{Pool: "tank", Dataset: "tank/ix-virt"}, nil
 			},
 		},
 		Filesystem: &tnapi.MockFilesystemService{
@@ -296,17 +421,15 @@ func TestAllowDomainDuplicate(t *testing.T) {
 
 func TestDenyDomain(t *testing.T) {
 	var lastWritten string
-	mssh := &mockSSH{
-		outputFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error) {
-			return []byte("keep.com\nremove.com\nalso-keep.com\n"), nil
-		},
-	}
+	props := allowlistProps("keep.com", "remove.com", "also-keep.com")
+	mssh := &mockSSH{}
 
 	tn, _ := NewForTest(&Client{
+		ws: props.client(),
 		Virt: &tnapi.MockVirtService{
 			GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
-				return &tnapi.VirtGlobalConfig{Pool: "tank"}, nil
+				return &tnapi.VirtGlobalConfig{Pool: "tank", Dataset: "tank/ix-virt"}, nil
 			},
 		},
 		Filesystem: &tnapi.MockFilesystemService{
@@ -317,7 +440,7 @@ func TestDenyDomain(t *testing.T) {
 		},
 	}, mssh, testCfg())
 
-	if err := tn.DenyDomain(context.Background(), "test", "remove.com"); err != nil {
+	if err := tn.DenyDomain(context.Background(), "test", "Remove.COM."); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
@@ -333,17 +456,15 @@ func TestDenyDomain(t *testing.T) {
 }
 
 func TestDenyDomainNotFound(t *testing.T) {
-	mssh := &mockSSH{
-		outputFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error) {
-			return []byte("other.com\n"), nil
-		},
-	}
+	props := allowlistProps("other.com")
+	mssh := &mockSSH{}
 
 	tn, _ := NewForTest(&Client{
+		ws: props.client(),
 		Virt: &tnapi.MockVirtService{
 			GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
 			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
-				return &tnapi.VirtGlobalConfig{Pool: "tank"}, nil
+				return &tnapi.VirtGlobalConfig{Pool: "tank", Dataset: "tank/ix-virt"}, nil
 			},
 		},
 		Filesystem: &tnapi.MockFilesystemService{},
@@ -358,86 +479,54 @@ func TestDenyDomainNotFound(t *testing.T) {
 	}
 }
 
+func TestDenyDomainInvalid(t *testing.T) {
+	tn, _ := NewForTest(&Client{Virt: &tnapi.MockVirtService{}}, &mockSSH{}, testCfg())
+	if err := tn.DenyDomain(context.Background(), "test", "bad domain"); err == nil {
+		t.Fatal("expected error for an invalid entry")
+	}
+}
+
 func TestGetPolicy(t *testing.T) {
-	t.Run("unrestricted", func(t *testing.T) {
-		mssh := &mockSSH{
-			execFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) (int, error) {
-				// test -f returns 1 (file not found).
-				return 1, nil
-			},
-		}
+	want := sandbox.Policy{
+		Version: sandbox.PolicyVersion,
+		Mode:    "agent,rust",
+		Presets: []string{"agent", "rust"},
+		Allow:   []string{"example.com"},
+		Domains: []string{"crates.io", "example.com"},
+	}
 
-		tn, _ := NewForTest(&Client{
-			Virt: &tnapi.MockVirtService{
-				GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
-			},
-		}, mssh, testCfg())
+	t.Run("recorded", func(t *testing.T) {
+		props := zfsProps{testDataset: {policyProperty: string(egress.MarshalPolicy(want))}}
+		mssh := &mockSSH{}
+		tn, _ := NewForTest(policyClient(props, nil), mssh, testCfg())
 
 		policy, err := tn.GetPolicy(context.Background(), "test")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
-		if policy.Mode != sandbox.EgressUnrestricted {
-			t.Errorf("mode = %q, want unrestricted", policy.Mode)
+		if policy.Mode != want.Mode || !slices.Equal(policy.Presets, want.Presets) || !slices.Equal(policy.Allow, want.Allow) {
+			t.Errorf("GetPolicy = %+v, want %+v", policy, want)
+		}
+		if len(mssh.execCalls)+len(mssh.outputCalls) != 0 {
+			t.Error("GetPolicy looked inside the container for a recorded policy")
 		}
 	})
 
-	t.Run("restricted", func(t *testing.T) {
+	t.Run("missing record", func(t *testing.T) {
+		// Egress files and a record inside the container don't stand in
+		// for one on the dataset.
 		mssh := &mockSSH{
-			execFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) (int, error) {
-				return 0, nil // file exists
-			},
 			outputFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error) {
-				return []byte("api.example.com\ncdn.example.com\n"), nil
+				return egress.MarshalPolicy(want), nil
 			},
 		}
+		tn, _ := NewForTest(policyClient(zfsProps{}, nil), mssh, testCfg())
 
-		tn, _ := NewForTest(&Client{
-			Virt: &tnapi.MockVirtService{
-				GetInstanceFunc: runningInstanceFunc("10.0.0.5"),
-			},
-		}, mssh, testCfg())
-
-		policy, err := tn.GetPolicy(context.Background(), "test")
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		if policy.Mode != sandbox.EgressAllowlist {
-			t.Errorf("mode = %q, want allowlist", policy.Mode)
-		}
-		if len(policy.Domains) != 2 {
-			t.Fatalf("domains = %v", policy.Domains)
+		if _, err := tn.GetPolicy(context.Background(), "test"); !errors.Is(err, egress.ErrNoRecord) {
+			t.Errorf("GetPolicy = %v, want ErrNoRecord", err)
 		}
-		if policy.Domains[0] != "api.example.com" {
-			t.Errorf("domains[0] = %q", policy.Domains[0])
+		if len(mssh.execCalls)+len(mssh.outputCalls) != 0 {
+			t.Error("GetPolicy looked inside the container for a policy")
 		}
 	})
 }
-
-func TestParseDomains(t *testing.T) {
-	tests := []struct {
-		name  string
-		input string
-		want  []string
-	}{
-		{"normal", "a.com\nb.com\n", []string{"a.com", "b.com"}},
-		{"trailing whitespace", "  a.com  \n  b.com  \n", []string{"a.com", "b.com"}},
-		{"empty lines", "a.com\n\nb.com\n\n", []string{"a.com", "b.com"}},
-		{"empty string", "", nil},
-		{"single domain", "example.com\n", []string{"example.com"}},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := parseDomains(tt.input)
-			if len(got) != len(tt.want) {
-				t.Fatalf("got %v, want %v", got, tt.want)
-			}
-			for i := range got {
-				if got[i] != tt.want[i] {
-					t.Errorf("got[%d] = %q, want %q", i, got[i], tt.want[i])
-				}
-			}
-		})
-	}
-}
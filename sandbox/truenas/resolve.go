@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	tnapi "github.com/deevus/truenas-go"
+
+	"github.com/deevus/pixels/sandbox"
 )
 
 const containerPrefix = "px-"
@@ -23,17 +25,12 @@ func unprefixed(name string) string {
 // ensureRunning verifies the container is running and has a network address,
 // returning the instance for callers that need its metadata (e.g. IP).
 func (t *TrueNAS) ensureRunning(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
-	full := prefixed(name)
-
-	instance, err := t.client.Virt.GetInstance(ctx, full)
+	instance, err := t.lookup(ctx, name)
 	if err != nil {
-		return nil, fmt.Errorf("looking up %s: %w", name, err)
-	}
-	if instance == nil {
-		return nil, fmt.Errorf("instance %q not found", name)
+		return nil, err
 	}
 	if instance.Status != "RUNNING" {
-		return nil, fmt.Errorf("instance %q is %s — start it first", name, instance.Status)
+		return nil, sandbox.Wrap(sandbox.ErrNotRunning, fmt.Errorf("instance %q is %s — start it first", name, instance.Status))
 	}
 
 	if ipFromAliases(instance.Aliases) == "" {
@@ -42,6 +39,20 @@ func (t *TrueNAS) ensureRunning(ctx context.Context, name string) (*tnapi.VirtIn
 	return instance, nil
 }
 
+// lookup returns the named instance. A missing instance — reported either as
+// an upstream "does not exist" error or as a nil result — yields an error
+// wrapping sandbox.ErrNotFound.
+func (t *TrueNAS) lookup(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+	instance, err := t.client.Virt.GetInstance(ctx, prefixed(name))
+	if err != nil {
+		return nil, wrapLookupError(fmt.Errorf("looking up %s: %w", name, err))
+	}
+	if instance == nil {
+		return nil, fmt.Errorf("instance %q: %w", name, sandbox.ErrNotFound)
+	}
+	return instance, nil
+}
+
 // ipFromAliases extracts the first IPv4 address from a VirtInstance's aliases.
 func ipFromAliases(aliases []tnapi.VirtAlias) string {
 	for _, a := range aliases {
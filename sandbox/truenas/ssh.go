@@ -16,6 +16,9 @@ type sshRunner interface {
 	OutputQuiet(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error)
 	WaitReady(ctx context.Context, host string, timeout time.Duration, log io.Writer) error
 	TestAuth(ctx context.Context, cc ssh.ConnConfig) error
+	StartForward(ctx context.Context, cc ssh.ConnConfig, listen string, port int, logPath string) (ssh.Tunnel, error)
+	ForwardRunning(t ssh.Tunnel) bool
+	StopForward(t ssh.Tunnel) error
 }
 
 // realSSH is the production sshRunner that delegates to the ssh package.
@@ -40,3 +43,15 @@ func (realSSH) WaitReady(ctx context.Context, host string, timeout time.Duration
 func (realSSH) TestAuth(ctx context.Context, cc ssh.ConnConfig) error {
 	return ssh.TestAuth(ctx, cc)
 }
+
+func (realSSH) StartForward(ctx context.Context, cc ssh.ConnConfig, listen string, port int, logPath string) (ssh.Tunnel, error) {
+	return ssh.StartForward(ctx, cc, listen, port, logPath)
+}
+
+func (realSSH) ForwardRunning(t ssh.Tunnel) bool {
+	return ssh.ForwardRunning(t)
+}
+
+func (realSSH) StopForward(t ssh.Tunnel) error {
+	return ssh.StopForward(t)
+}
@@ -0,0 +1,134 @@
+package truenas
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// cgroupDir is the host cgroup Incus runs a container in.
+func cgroupDir(full string) string {
+	return "/sys/fs/cgroup/lxc.payload." + full
+}
+
+// hostStats reads the container's usage through the API from files the
+// host kernel and ZFS keep: CPU and memory from its cgroup, network
+// counters from the namespace of a process in it, and disk from the used
+// property of its dataset. Nothing runs in the container.
+func (t *TrueNAS) hostStats(ctx context.Context, name string) (*sandbox.Stats, error) {
+	full := prefixed(name)
+	cg := cgroupDir(full)
+	var st sandbox.Stats
+
+	cpu, err := t.client.ReadHostFile(ctx, cg+"/cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	usec, err := statField(cpu, "usage_usec")
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s/cpu.stat: %w", cg, err)
+	}
+	st.CPUTime = time.Duration(usec) * time.Microsecond
+
+	if st.Memory, err = t.readHostInt(ctx, cg+"/memory.current"); err != nil {
+		return nil, err
+	}
+	// Not every kernel has memory.peak.
+	st.MemoryPeak, _ = t.readHostInt(ctx, cg+"/memory.peak")
+
+	pid, err := t.cgroupPID(ctx, cg)
+	if err != nil {
+		return nil, err
+	}
+	dev, err := t.client.ReadHostFile(ctx, "/proc/"+strconv.Itoa(pid)+"/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	if st.NetRX, st.NetTX, err = parseNetDev(dev); err != nil {
+		return nil, fmt.Errorf("parsing net/dev of %s: %w", name, err)
+	}
+
+	ds, err := t.resolveDataset(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if st.Disk, err = t.client.DatasetUsed(ctx, ds); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// readHostInt reads a host file holding a single integer.
+func (t *TrueNAS) readHostInt(ctx context.Context, hostPath string) (int64, error) {
+	data, err := t.client.ReadHostFile(ctx, hostPath)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(string(bytes.TrimSpace(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", hostPath, err)
+	}
+	return v, nil
+}
+
+// cgroupPID returns a process in the container's cgroup. A container whose
+// init is systemd moves it into init.scope, leaving the top cgroup empty.
+func (t *TrueNAS) cgroupPID(ctx context.Context, cg string) (int, error) {
+	for _, dir := range []string{cg, cg + "/init.scope"} {
+		data, err := t.client.ReadHostFile(ctx, dir+"/cgroup.procs")
+		if err != nil {
+			continue
+		}
+		if f := strings.Fields(string(data)); len(f) > 0 {
+			return strconv.Atoi(f[0])
+		}
+	}
+	return 0, fmt.Errorf("no process in %s", cg)
+}
+
+// statField returns the value of key in a cgroup "key value" file such as
+// cpu.stat.
+func statField(data []byte, key string) (int64, error) {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if f := strings.Fields(sc.Text()); len(f) == 2 && f[0] == key {
+			return strconv.ParseInt(f[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no %s", key)
+}
+
+// parseNetDev sums the received and sent bytes of every interface but lo
+// in /proc/<pid>/net/dev, as sandbox.StatsCommand does.
+func parseNetDev(data []byte) (rx, tx int64, err error) {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 0; sc.Scan(); line++ {
+		if line < 2 {
+			continue // headers
+		}
+		iface, counters, ok := strings.Cut(sc.Text(), ":")
+		if !ok || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		f := strings.Fields(counters)
+		if len(f) < 9 {
+			return 0, 0, fmt.Errorf("malformed line %q", sc.Text())
+		}
+		r, err := strconv.ParseInt(f[0], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		s, err := strconv.ParseInt(f[8], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		rx, tx = rx+r, tx+s
+	}
+	return rx, tx, sc.Err()
+}
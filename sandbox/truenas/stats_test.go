@@ -0,0 +1,143 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tnapi "github.com/deevus/truenas-go"
+	"github.com/deevus/truenas-go/client"
+
+	"github.com/deevus/pixels/internal/ssh"
+	"github.com/deevus/pixels/sandbox"
+)
+
+const testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+  eth0:    3000      30    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+  eth1:     100       1    0    0    0     0          0         0       50       1    0    0    0     0       0          0
+`
+
+// hostFiles fakes a TrueNAS host that serves files through core.download,
+// and the used property of testDataset.
+func hostFiles(t *testing.T, files map[string]string) (*client.MockClient, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[strings.TrimPrefix(r.URL.Path, "/_download")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	ws := &client.MockClient{CallFunc: func(ctx context.Context, method string, params any) (json.RawMessage, error) {
+		switch method {
+		case "core.download":
+			p := params.([]any)[1].([]any)[0].(string)
+			return json.Marshal([]any{1, "/_download" + p})
+		case "pool.dataset.query":
+			if id := params.([]any)[0].([][]any)[0][2]; id != testDataset {
+				return nil, fmt.Errorf("query of %v", id)
+			}
+			return json.RawMessage(`[{"id": "` + testDataset + `", "used": {"rawvalue": "8192", "value": "8K"}}]`), nil
+		}
+		return nil, fmt.Errorf("unexpected call %s", method)
+	}}
+	return ws, srv
+}
+
+func statsBackend(t *testing.T, files map[string]string, mock *mockSSH, cfg map[string]string) *TrueNAS {
+	t.Helper()
+	ws, srv := hostFiles(t, files)
+	tn, err := NewForTest(&Client{
+		ws:      ws,
+		web:     srv.Client(),
+		baseURL: srv.URL,
+		Virt: &tnapi.MockVirtService{
+			GetInstanceFunc: func(ctx context.Context, name string) (*tnapi.VirtInstance, error) {
+				return &tnapi.VirtInstance{Name: name, Status: "RUNNING", Aliases: []tnapi.VirtAlias{{Type: "INET", Address: "10.0.0.1"}}}, nil
+			},
+			GetGlobalConfigFunc: func(ctx context.Context) (*tnapi.VirtGlobalConfig, error) {
+				return &tnapi.VirtGlobalConfig{Dataset: "tank/ix-virt"}, nil
+			},
+		},
+	}, mock, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tn
+}
+
+func TestStats(t *testing.T) {
+	cg := "/sys/fs/cgroup/lxc.payload.px-test"
+	mock := &mockSSH{}
+	tn := statsBackend(t, map[string]string{
+		cg + "/cpu.stat":                "usage_usec 1500000\nuser_usec 1000000\nsystem_usec 500000\n",
+		cg + "/memory.current":          "4096\n",
+		cg + "/memory.peak":             "6144\n",
+		cg + "/cgroup.procs":            "",
+		cg + "/init.scope/cgroup.procs": "4242\n",
+		"/proc/4242/net/dev":            testNetDev,
+	}, mock, testCfg())
+
+	st, err := tn.Stats(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	want := sandbox.Stats{CPUTime: 1500 * time.Millisecond, Memory: 4096, MemoryPeak: 6144, Disk: 8192, NetRX: 3100, NetTX: 2050}
+	if *st != want {
+		t.Errorf("Stats = %+v, want %+v", *st, want)
+	}
+	if len(mock.outputCalls)+len(mock.execCalls) != 0 {
+		t.Errorf("Stats used SSH: %+v %+v", mock.outputCalls, mock.execCalls)
+	}
+}
+
+func TestStatsOverSSH(t *testing.T) {
+	mock := &mockSSH{outputFn: func(ctx context.Context, cc ssh.ConnConfig, cmd []string) ([]byte, error) {
+		return []byte("cpu_usec 2000000\nmemory 1024\ndisk 512\nnet 10 20\n"), nil
+	}}
+
+	// The host serves nothing; without the fallback that is an error.
+	tn := statsBackend(t, nil, mock, testCfg())
+	if _, err := tn.Stats(context.Background(), "test"); err == nil {
+		t.Error("Stats without host files succeeded")
+	}
+	if len(mock.outputCalls) != 0 {
+		t.Errorf("Stats fell back to SSH without stats_over_ssh: %+v", mock.outputCalls)
+	}
+
+	cfg := testCfg()
+	cfg["stats_over_ssh"] = "true"
+	tn = statsBackend(t, nil, mock, cfg)
+	st, err := tn.Stats(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if st.CPUTime != 2*time.Second || st.Memory != 1024 || st.NetTX != 20 {
+		t.Errorf("Stats = %+v, want the container's report", *st)
+	}
+	if len(mock.outputCalls) != 1 || mock.outputCalls[0].User != "root" {
+		t.Errorf("SSH calls = %+v, want one as root", mock.outputCalls)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	rx, tx, err := parseNetDev([]byte(testNetDev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx != 3100 || tx != 2050 {
+		t.Errorf("rx, tx = %d, %d, want 3100, 2050 without lo", rx, tx)
+	}
+	if _, _, err := parseNetDev([]byte("h1\nh2\neth0: 1 2\n")); err == nil {
+		t.Error("short line: want error")
+	}
+}
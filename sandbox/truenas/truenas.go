@@ -14,8 +14,11 @@ import (
 // Compile-time check that TrueNAS implements sandbox.Sandbox.
 var _ sandbox.Sandbox = (*TrueNAS)(nil)
 
+// backendName marks exported checkpoints as ZFS streams from TrueNAS.
+const backendName = "truenas"
+
 func init() {
-	sandbox.Register("truenas", func(cfg map[string]string) (sandbox.Sandbox, error) {
+	sandbox.Register(backendName, func(cfg map[string]string) (sandbox.Sandbox, error) {
 		return New(cfg)
 	})
 }
@@ -77,6 +80,8 @@ func (t *TrueNAS) Capabilities() sandbox.Capabilities {
 		Snapshots:     true,
 		CloneFrom:     true,
 		EgressControl: true,
+		PortForward:   true,
+		Mounts:        true,
 	}
 }
 
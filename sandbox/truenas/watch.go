@@ -0,0 +1,137 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+// Watch reports lifecycle events from TrueNAS collection subscriptions.
+// Instance updates don't say what changed, so each one triggers a re-list
+// that is diffed against the last. Commands run over SSH, which the API
+// never sees, so EventExecStarted is not reported.
+func (t *TrueNAS) Watch(ctx context.Context, fn func(sandbox.Event)) error {
+	instances, err := t.client.SubscribeInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("subscribing to instances: %w", err)
+	}
+	defer instances.Close()
+	snapshots, err := t.client.SubscribeSnapshots(ctx)
+	if err != nil {
+		return fmt.Errorf("subscribing to snapshots: %w", err)
+	}
+	defer snapshots.Close()
+
+	known, err := t.statuses(ctx)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{} // snapshot IDs already reported
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-instances.C:
+			if !ok {
+				return errors.New("instance event stream closed")
+			}
+			cur, err := t.statuses(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			for _, e := range diffStatuses(known, cur, time.Now().UTC()) {
+				fn(e)
+			}
+			known = cur
+		case raw, ok := <-snapshots.C:
+			if !ok {
+				return errors.New("snapshot event stream closed")
+			}
+			e, id, ok := snapshotEvent(raw)
+			if ok && !seen[id] {
+				seen[id] = true
+				fn(e)
+			}
+		}
+	}
+}
+
+// statuses returns the status of every pixels instance by name.
+func (t *TrueNAS) statuses(ctx context.Context) (map[string]sandbox.Status, error) {
+	list, err := t.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]sandbox.Status, len(list))
+	for _, inst := range list {
+		out[inst.Name] = inst.Status
+	}
+	return out, nil
+}
+
+// diffStatuses returns the events that explain the change from prev to
+// cur. An instance that appears already running is reported as created and
+// then started.
+func diffStatuses(prev, cur map[string]sandbox.Status, now time.Time) []sandbox.Event {
+	var out []sandbox.Event
+	add := func(typ sandbox.EventType, name string) {
+		out = append(out, sandbox.Event{Type: typ, Name: name, Time: now})
+	}
+	for name, status := range cur {
+		was, existed := prev[name]
+		if !existed {
+			add(sandbox.EventCreated, name)
+		}
+		switch {
+		case status.IsRunning() && (!existed || !was.IsRunning()):
+			add(sandbox.EventStarted, name)
+		case existed && was.IsRunning() && !status.IsRunning():
+			add(sandbox.EventStopped, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			add(sandbox.EventDeleted, name)
+		}
+	}
+	return out
+}
+
+// snapshotEvent converts a snapshot collection update into an event if it
+// names a snapshot of a pixels container's dataset, returning the snapshot
+// ID (dataset@label) alongside it. Removals carry no fields and are
+// ignored.
+func snapshotEvent(raw json.RawMessage) (sandbox.Event, string, bool) {
+	var fields struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return sandbox.Event{}, "", false
+	}
+	id := fields.ID
+	if id == "" {
+		id = fields.Name
+	}
+	ds, label, ok := strings.Cut(id, "@")
+	full := path.Base(ds)
+	if !ok || !strings.HasPrefix(full, containerPrefix) {
+		return sandbox.Event{}, "", false
+	}
+	return sandbox.Event{
+		Type:     sandbox.EventSnapshotCreated,
+		Name:     unprefixed(full),
+		Snapshot: label,
+		Time:     time.Now().UTC(),
+	}, id, true
+}
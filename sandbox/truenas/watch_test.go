@@ -0,0 +1,118 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	tnapi "github.com/deevus/truenas-go"
+	"github.com/deevus/truenas-go/client"
+
+	"github.com/deevus/pixels/sandbox"
+)
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subs := map[string]chan json.RawMessage{
+		"virt.instance.query": make(chan json.RawMessage, 4),
+		"pool.snapshot.query": make(chan json.RawMessage, 4),
+	}
+	var mu sync.Mutex
+	listed := []tnapi.VirtInstance{{Name: "px-a", Status: "RUNNING"}, {Name: "px-b", Status: "STOPPED"}}
+	tn := newTestBackend(t, &Client{
+		ws: &client.MockClient{
+			VersionVal: tnapi.Version{Major: 25, Minor: 10},
+			SubscribeFunc: func(ctx context.Context, collection string, params any) (*tnapi.Subscription[json.RawMessage], error) {
+				ch, ok := subs[collection]
+				if !ok {
+					t.Errorf("unexpected subscription to %s", collection)
+				}
+				return tnapi.NewSubscription[json.RawMessage](ch, func() {}), nil
+			},
+		},
+		Virt: &tnapi.MockVirtService{
+			ListInstancesFunc: func(ctx context.Context, filters [][]any) ([]tnapi.VirtInstance, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return listed, nil
+			},
+		},
+	})
+
+	events := make(chan sandbox.Event, 16)
+	done := make(chan error, 1)
+	go func() { done <- tn.Watch(ctx, func(e sandbox.Event) { events <- e }) }()
+
+	next := func() sandbox.Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return sandbox.Event{}
+		}
+	}
+
+	// The seeding List happens after subscribing, so wait for Watch to
+	// settle before changing what it will see.
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	listed = []tnapi.VirtInstance{{Name: "px-b", Status: "RUNNING"}}
+	mu.Unlock()
+	subs["virt.instance.query"] <- json.RawMessage(`{"status":"RUNNING"}`)
+
+	got := map[sandbox.EventType]string{}
+	for range 2 {
+		e := next()
+		got[e.Type] = e.Name
+	}
+	if got[sandbox.EventStarted] != "b" || got[sandbox.EventDeleted] != "a" {
+		t.Errorf("instance events = %v, want b started and a deleted", got)
+	}
+
+	subs["pool.snapshot.query"] <- json.RawMessage(`{"id":"tank/ix-virt/containers/px-b@ready"}`)
+	subs["pool.snapshot.query"] <- json.RawMessage(`{"id":"tank/ix-virt/containers/px-b@ready"}`) // a later change to it
+	subs["pool.snapshot.query"] <- json.RawMessage(`{"id":"tank/data@nightly"}`)
+	subs["pool.snapshot.query"] <- json.RawMessage(`{"id":"tank/ix-virt/containers/px-b@next"}`)
+	if e := next(); e.Type != sandbox.EventSnapshotCreated || e.Name != "b" || e.Snapshot != "ready" {
+		t.Errorf("snapshot event = %+v", e)
+	}
+	if e := next(); e.Snapshot != "next" {
+		t.Errorf("second snapshot event = %+v, want next (duplicates and other datasets skipped)", e)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch = %v, want nil after cancel", err)
+	}
+}
+
+func TestDiffStatuses(t *testing.T) {
+	now := time.Now()
+	prev := map[string]sandbox.Status{"up": sandbox.StatusRunning, "down": sandbox.StatusStopped, "gone": sandbox.StatusStopped}
+	cur := map[string]sandbox.Status{"up": sandbox.StatusStopped, "down": sandbox.StatusStopped, "new": sandbox.StatusRunning}
+
+	got := map[string][]sandbox.EventType{}
+	for _, e := range diffStatuses(prev, cur, now) {
+		got[e.Name] = append(got[e.Name], e.Type)
+	}
+	want := map[string][]sandbox.EventType{
+		"up":   {sandbox.EventStopped},
+		"gone": {sandbox.EventDeleted},
+		"new":  {sandbox.EventCreated, sandbox.EventStarted},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for name, w := range want {
+		if !slices.Equal(got[name], w) {
+			t.Errorf("%s events = %v, want %v", name, got[name], w)
+		}
+	}
+}